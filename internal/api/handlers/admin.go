@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"argus-sdr/internal/shared"
+	"argus-sdr/pkg/config"
+	"argus-sdr/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	db               *sql.DB
+	logger           *logger.Logger
+	cfg              *config.Config
+	collectorHandler *CollectorHandler
+}
+
+// BroadcastRequest is the body of POST /api/admin/collectors/broadcast
+type BroadcastRequest struct {
+	Command        string `json:"command" binding:"required"`
+	ContainerImage string `json:"container_image"`
+	Reason         string `json:"reason"`
+}
+
+// LogLevelRequest is the body of POST /api/admin/loglevel
+type LogLevelRequest struct {
+	Level string `json:"level" binding:"required"`
+}
+
+func NewAdminHandler(db *sql.DB, log *logger.Logger, cfg *config.Config, collectorHandler *CollectorHandler) *AdminHandler {
+	return &AdminHandler{
+		db:               db,
+		logger:           log,
+		cfg:              cfg,
+		collectorHandler: collectorHandler,
+	}
+}
+
+// BroadcastToCollectors handles POST /api/admin/collectors/broadcast
+func (h *AdminHandler) BroadcastToCollectors(c *gin.Context) {
+	var req BroadcastRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !shared.IsValidControlCommand(req.Command) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown command: %s", req.Command)})
+		return
+	}
+
+	if req.ContainerImage != "" && req.Command != shared.ControlCommandReload {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "container_image is only valid for the reload command"})
+		return
+	}
+
+	email, _ := c.Get("user_email")
+	issuedBy, _ := email.(string)
+
+	control := shared.ControlMessage{
+		Command:        req.Command,
+		ContainerImage: req.ContainerImage,
+		Reason:         req.Reason,
+		IssuedBy:       issuedBy,
+		Timestamp:      time.Now().Unix(),
+	}
+
+	h.logger.Info("Admin %s broadcasting %s command to collectors", issuedBy, req.Command)
+
+	sent, failed := h.collectorHandler.BroadcastControl(control)
+
+	c.JSON(http.StatusOK, gin.H{
+		"command": req.Command,
+		"sent":    sent,
+		"failed":  failed,
+	})
+}
+
+// GetLogLevel handles GET /api/admin/loglevel
+func (h *AdminHandler) GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"level": h.logger.Level().String()})
+}
+
+// SetLogLevel handles POST /api/admin/loglevel, changing the server's log level
+// until it restarts
+func (h *AdminHandler) SetLogLevel(c *gin.Context) {
+	var req LogLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	level, err := logger.ParseLevel(req.Level)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email, _ := c.Get("user_email")
+	previous := h.logger.Level()
+
+	// Lower the level before logging the change and raise it after, so the message is written if either level allows it
+	if level < previous {
+		h.logger.SetLevel(level)
+	}
+	h.logger.Info("Admin %v changed the log level from %s to %s", email, previous, level)
+	h.logger.SetLevel(level)
+
+	c.JSON(http.StatusOK, gin.H{
+		"level":    level.String(),
+		"previous": previous.String(),
+	})
+}
+
+// GetRecentLogs handles GET /api/admin/logs/recent, returning the latest log
+// lines kept in memory, oldest first. ?limit=N returns only the last N.
+func (h *AdminHandler) GetRecentLogs(c *gin.Context) {
+	entries, enabled := h.logger.Recent()
+	if !enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recent logs are not kept on this server; set LOG_RECENT_ENABLED=true"})
+		return
+	}
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a non-negative integer"})
+			return
+		}
+		if limit < len(entries) {
+			entries = entries[len(entries)-limit:]
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logs":     entries,
+		"count":    len(entries),
+		"capacity": h.logger.RecentCapacity(),
+		"level":    h.logger.Level().String(),
+	})
+}
+
+// GetSelectionConfig handles GET /api/admin/selection/config, reporting the
+// SELECTION_WEIGHT_* weights stations are ranked by, each one's share of a
+// station's score and the selection strategies requests can pick instead
+func (h *AdminHandler) GetSelectionConfig(c *gin.Context) {
+	weights := h.cfg.Server.SelectionWeights
+	total := float64(weights.Total())
+	c.JSON(http.StatusOK, gin.H{
+		"weights": weights,
+		"shares": gin.H{
+			"load":     float64(weights.Load) / total,
+			"success":  float64(weights.Success) / total,
+			"response": float64(weights.Response) / total,
+			"disk":     float64(weights.Disk) / total,
+		},
+		"strategies":       shared.SelectionStrategies,
+		"default_strategy": shared.SelectionWeighted,
+	})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
+	"strings"
 	"time"
 
 	"argus-sdr/internal/auth"
@@ -28,6 +29,12 @@ func NewAuthHandler(db *sql.DB, log *logger.Logger, cfg *config.Config) *AuthHan
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
+	if !h.cfg.Auth.AllowRegistration {
+		h.log.Warn("Registration attempt from %s while registration is disabled", c.ClientIP())
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled; ask an administrator for an account"})
+		return
+	}
+
 	var req models.RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -38,6 +45,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	var existingID int
 	err := h.db.QueryRow("SELECT id FROM users WHERE email = ?", req.Email).Scan(&existingID)
 	if err != sql.ErrNoRows {
+		h.log.Warn("Registration for existing user %s from %s", req.Email, c.ClientIP())
 		c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
 		return
 	}
@@ -62,9 +70,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	userID, _ := result.LastInsertId()
+	h.log.Info("Registered user %s (client type %d) from %s", req.Email, req.ClientType, c.ClientIP())
 
 	// Generate token
-	token, err := auth.GenerateToken(int(userID), req.Email, req.ClientType, h.cfg.Auth.JWTSecret, h.cfg.Auth.TokenExpiry)
+	role := h.roleFor(req.Email, models.RoleUser)
+	token, err := auth.GenerateToken(int(userID), req.Email, req.ClientType, role, h.cfg.Auth.JWTSecret, h.cfg.Auth.TokenExpiryFor(req.ClientType))
 	if err != nil {
 		h.log.Error("Failed to generate token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
@@ -75,6 +85,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		ID:         int(userID),
 		Email:      req.Email,
 		ClientType: req.ClientType,
+		Role:       role,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
@@ -95,11 +106,12 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	// Get user from database
 	var user models.User
 	err := h.db.QueryRow(
-		"SELECT id, email, password_hash, client_type, created_at, updated_at FROM users WHERE email = ?",
+		"SELECT id, email, password_hash, client_type, role, created_at, updated_at FROM users WHERE email = ?",
 		req.Email,
-	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.ClientType, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.ClientType, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 
 	if err == sql.ErrNoRows {
+		h.log.Warn("Failed login for unknown user %s from %s", req.Email, c.ClientIP())
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
@@ -111,18 +123,21 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// Check password
 	if !auth.CheckPasswordHash(req.Password, user.PasswordHash) {
+		h.log.Warn("Failed login for %s from %s: wrong password", req.Email, c.ClientIP())
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	// Generate token
-	token, err := auth.GenerateToken(user.ID, user.Email, user.ClientType, h.cfg.Auth.JWTSecret, h.cfg.Auth.TokenExpiry)
+	user.Role = h.roleFor(user.Email, user.Role)
+	token, err := auth.GenerateToken(user.ID, user.Email, user.ClientType, user.Role, h.cfg.Auth.JWTSecret, h.cfg.Auth.TokenExpiryFor(user.ClientType))
 	if err != nil {
 		h.log.Error("Failed to generate token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
+	h.log.Info("User %s logged in from %s", user.Email, c.ClientIP())
 	c.JSON(http.StatusOK, models.AuthResponse{
 		Token: token,
 		User:  user,
@@ -140,9 +155,9 @@ func (h *AuthHandler) Me(c *gin.Context) {
 
 	var user models.User
 	err := h.db.QueryRow(
-		"SELECT id, email, client_type, created_at, updated_at FROM users WHERE id = ?",
+		"SELECT id, email, client_type, role, created_at, updated_at FROM users WHERE id = ?",
 		userID,
-	).Scan(&user.ID, &user.Email, &user.ClientType, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Email, &user.ClientType, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
 		h.log.Error("Failed to get user: %v", err)
@@ -150,5 +165,20 @@ func (h *AuthHandler) Me(c *gin.Context) {
 		return
 	}
 
+	user.Role = h.roleFor(user.Email, user.Role)
 	c.JSON(http.StatusOK, user)
+}
+
+// roleFor returns the role a user's tokens carry. Users listed in the legacy
+// ADMIN_EMAILS setting are admins regardless of their stored role.
+func (h *AuthHandler) roleFor(email, role string) string {
+	for _, adminEmail := range h.cfg.Auth.AdminEmails {
+		if strings.EqualFold(adminEmail, email) {
+			return models.RoleAdmin
+		}
+	}
+	if role == "" {
+		return models.RoleUser
+	}
+	return role
 }
\ No newline at end of file
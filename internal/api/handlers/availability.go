@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// stationHealth is what the server knows about a station when routing a request
+type stationHealth struct {
+	StationID         string
+	Status            string        // collector_sessions status: connected, draining or unhealthy
+	HeartbeatAge      time.Duration // time since the last heartbeat
+	DiskFreeBytes     sql.NullInt64 // free space in the collector's data directory, if reported
+	ClockSynchronized sql.NullBool  // whether the collector's clock is synchronized, if reported
+	ImageReady        sql.NullBool  // whether the collector's container image is ready, if reported
+}
+
+// isStationAvailable reports whether a station should be sent new requests,
+// and if not, why. Being connected isn't enough: the station's WebSocket must
+// be open, its last heartbeat no older than STATION_HEARTBEAT_MAX_AGE_SECONDS,
+// it must not be draining or unhealthy, it must have STATION_MIN_FREE_DISK_MB free and,
+// with STATION_REQUIRE_CLOCK_SYNC, a synchronized clock. A collector that
+// doesn't report its disk space isn't held back by it, but one that doesn't
+// report its clock state can't meet STATION_REQUIRE_CLOCK_SYNC. A collector
+// that reports its container image could not be pulled is left out too.
+func (h *DataHandler) isStationAvailable(health stationHealth) (bool, string) {
+	if h.collectorHandler != nil && !h.collectorHandler.IsStationConnected(health.StationID) {
+		return false, "no open WebSocket"
+	}
+
+	maxAge := time.Duration(h.cfg.Server.StationHeartbeatMaxAge) * time.Second
+	if health.HeartbeatAge > maxAge {
+		return false, fmt.Sprintf("last heartbeat %v ago", health.HeartbeatAge.Round(time.Second))
+	}
+
+	if health.Status == "draining" {
+		return false, "draining"
+	}
+	if health.Status == "unhealthy" {
+		return false, "unhealthy: its collections keep failing"
+	}
+
+	if health.ImageReady.Valid && !health.ImageReady.Bool {
+		return false, "container image not ready"
+	}
+
+	minFree := int64(h.cfg.Server.StationMinFreeDiskMB) * 1024 * 1024
+	if health.DiskFreeBytes.Valid && health.DiskFreeBytes.Int64 < minFree {
+		return false, fmt.Sprintf("only %d MB of disk space free", health.DiskFreeBytes.Int64/(1024*1024))
+	}
+
+	if h.cfg.Server.StationRequireClockSync {
+		if !health.ClockSynchronized.Valid {
+			return false, "clock state unknown"
+		}
+		if !health.ClockSynchronized.Bool {
+			return false, "clock not synchronized"
+		}
+	}
+
+	return true, ""
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"argus-sdr/internal/database"
+	"argus-sdr/internal/models"
+	"argus-sdr/internal/shared"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CancelRequest handles POST /api/data/cancel/:id. Only the requester or an
+// admin may cancel a request. A cancelled request stays cancelled whatever its
+// collectors report afterwards, its subscribers aren't told about data that
+// becomes ready, and transfers already under way are stopped.
+func (h *DataHandler) CancelRequest(c *gin.Context) {
+	requestID := c.Param("id")
+	userIDInt, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	userID := fmt.Sprintf("%d", userIDInt)
+
+	var requestedBy, status string
+	err := h.db.QueryRow("SELECT requested_by, status FROM data_requests WHERE id = ?", requestID).Scan(&requestedBy, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to look up request %s: %v", requestID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel request"})
+		return
+	}
+
+	if requestedBy != userID && c.GetString("role") != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the requester can cancel a request"})
+		return
+	}
+	if status == "cancelled" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Request is already cancelled"})
+		return
+	}
+
+	query := `
+		UPDATE data_requests
+		SET status = 'cancelled', completed_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	if _, err := database.ExecWithRetry(h.db, query, requestID); err != nil {
+		h.logger.Error("Failed to cancel request %s: %v", requestID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel request"})
+		return
+	}
+
+	h.signalRequestChanged(requestID)
+
+	cancelled, err := h.cancelTransfers(requestID)
+	if err != nil {
+		h.logger.Error("Failed to cancel transfers of request %s: %v", requestID, err)
+	}
+
+	h.logger.Info("User %s cancelled request %s (%d transfers stopped)", userID, requestID, cancelled)
+	c.JSON(http.StatusOK, gin.H{
+		"request_id":          requestID,
+		"status":              "cancelled",
+		"cancelled_transfers": cancelled,
+	})
+}
+
+// isRequestCancelled reports whether a request has been cancelled
+func (h *DataHandler) isRequestCancelled(requestID string) bool {
+	var status string
+	err := h.db.QueryRow("SELECT status FROM data_requests WHERE id = ?", requestID).Scan(&status)
+	if err != nil {
+		return false
+	}
+	return status == "cancelled"
+}
+
+// requestTransfer is an ICE session transferring a station's data for a request
+type requestTransfer struct {
+	SessionID string
+	UserID    int // the receiver that opened the session
+	StationID string
+}
+
+// cancelTransfers tells both peers of each of a request's ICE sessions that
+// the session is cancelled, so the collector stops sending and the receiver
+// stops writing, and marks the sessions cancelled. It returns the number of
+// sessions cancelled.
+func (h *DataHandler) cancelTransfers(requestID string) (int, error) {
+	// Sessions are bound to a request and station by the parameters the receiver opened them with
+	rows, err := h.db.Query(`
+		SELECT s.session_id, s.initiator_user_id, COALESCE(json_extract(ft.parameters, '$.station_id'), '')
+		FROM ice_sessions s
+		JOIN file_transfers ft ON s.session_id = ft.session_id
+		WHERE s.status != 'cancelled' AND json_valid(ft.parameters) AND json_extract(ft.parameters, '$.request_id') = ?
+	`, requestID)
+	if err != nil {
+		return 0, err
+	}
+	var transfers []requestTransfer
+	for rows.Next() {
+		var transfer requestTransfer
+		if err := rows.Scan(&transfer.SessionID, &transfer.UserID, &transfer.StationID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		transfers = append(transfers, transfer)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, transfer := range transfers {
+		if _, err := database.ExecWithRetry(h.db, `
+			UPDATE ice_sessions
+			SET status = 'cancelled', updated_at = CURRENT_TIMESTAMP
+			WHERE session_id = ?
+		`, transfer.SessionID); err != nil {
+			return 0, err
+		}
+
+		notification := shared.SessionCancelledNotification{
+			SessionID: transfer.SessionID,
+			RequestID: requestID,
+			Timestamp: time.Now().Unix(),
+		}
+		if transfer.StationID != "" && h.collectorHandler != nil {
+			if err := h.collectorHandler.NotifyCollectorOfSessionCancelled(transfer.StationID, notification); err != nil {
+				h.logger.Warn("Failed to tell station %s that session %s is cancelled: %v", transfer.StationID, transfer.SessionID, err)
+			}
+		}
+		message := shared.ReceiverMessage{Type: "session_cancelled", Payload: notification}
+		if _, err := h.sendReceiverNotification(strconv.Itoa(transfer.UserID), message); err != nil {
+			h.logger.Warn("Failed to tell user %d that session %s is cancelled: %v", transfer.UserID, transfer.SessionID, err)
+		}
+	}
+
+	return len(transfers), nil
+}
@@ -3,14 +3,19 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
+	"argus-sdr/internal/database"
 	"argus-sdr/internal/models"
 	"argus-sdr/internal/shared"
 	"argus-sdr/pkg/config"
 	"argus-sdr/pkg/logger"
+	"argus-sdr/pkg/version"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -24,15 +29,46 @@ type CollectorHandler struct {
 	upgrader       websocket.Upgrader
 	connections    map[string]*CollectorConnection
 	connectionsMux sync.RWMutex
+	limiter        *ConnectionLimiter
 }
 
 type CollectorConnection struct {
 	StationID   string
 	Conn        *websocket.Conn
 	LastSeen    time.Time
+
+	newerVersionWarned bool // already warned that the collector speaks a newer message version
+
+	writeMu sync.Mutex // a WebSocket takes one writer at a time
+
+	// lastMessage is when the collector last sent a message, such as a
+	// heartbeat; unlike LastSeen, pongs don't count
+	messageMux  sync.Mutex
+	lastMessage time.Time
+}
+
+// markMessage records that the collector sent a message
+func (cc *CollectorConnection) markMessage() {
+	cc.messageMux.Lock()
+	defer cc.messageMux.Unlock()
+	cc.lastMessage = time.Now()
+}
+
+// sinceLastMessage returns how long ago the collector last sent a message
+func (cc *CollectorConnection) sinceLastMessage() time.Duration {
+	cc.messageMux.Lock()
+	defer cc.messageMux.Unlock()
+	return time.Since(cc.lastMessage)
+}
+
+// write sends a text message, one writer at a time
+func (cc *CollectorConnection) write(data []byte) error {
+	cc.writeMu.Lock()
+	defer cc.writeMu.Unlock()
+	return cc.Conn.WriteMessage(websocket.TextMessage, data)
 }
 
-func NewCollectorHandler(db *sql.DB, log *logger.Logger, cfg *config.Config, dataHandler *DataHandler) *CollectorHandler {
+func NewCollectorHandler(db *sql.DB, log *logger.Logger, cfg *config.Config, dataHandler *DataHandler, limits *ConnectionLimits) *CollectorHandler {
 	return &CollectorHandler{
 		db:          db,
 		logger:      log,
@@ -42,25 +78,43 @@ func NewCollectorHandler(db *sql.DB, log *logger.Logger, cfg *config.Config, dat
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Allow all origins for now
 			},
+			Subprotocols: shared.WebSocketSubprotocols,
 		},
 		connections: make(map[string]*CollectorConnection),
+		limiter:     limits.Limiter("collector", cfg.Server.MaxCollectorConnections),
 	}
 }
 
 // WebSocketHandler handles WebSocket connections from collector clients
 func (h *CollectorHandler) WebSocketHandler(c *gin.Context) {
+	if !checkSubprotocol(c) {
+		h.logger.Warn("Rejecting collector connection from %s: unsupported WebSocket subprotocols %v",
+			c.ClientIP(), websocket.Subprotocols(c.Request))
+		return
+	}
+
 	// Upgrade HTTP connection to WebSocket
 	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		h.logger.Error("Failed to upgrade connection: %v", err)
 		return
 	}
+
+	if !h.limiter.Acquire() {
+		h.logger.Warn("Rejecting collector connection from %s: limit of %d reached", c.ClientIP(), h.cfg.Server.MaxCollectorConnections)
+		h.limiter.Reject(conn)
+		return
+	}
+	defer h.limiter.Release()
 	defer conn.Close()
 
-	// Handle initial authentication/registration
-	collectorConn, err := h.handleCollectorAuth(conn)
+	// Handle initial authentication/registration; the token was checked before the upgrade
+	collectorConn, err := h.handleCollectorAuth(conn, c.GetInt("user_id"))
 	if err != nil {
-		h.logger.Error("Collector authentication failed: %v", err)
+		h.logger.Error("Collector authentication failed for user %d (%s): %v", c.GetInt("user_id"), c.ClientIP(), err)
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()),
+			time.Now().Add(time.Second))
 		return
 	}
 
@@ -74,15 +128,101 @@ func (h *CollectorHandler) WebSocketHandler(c *gin.Context) {
 		h.logger.Error("Failed to register collector session: %v", err)
 	}
 
-	h.logger.Info("Station connected: %s", collectorConn.StationID)
+	h.logger.Info("Station connected: %s (subprotocol %s)", collectorConn.StationID, shared.SubprotocolName(conn.Subprotocol()))
+
+	// Requests the station lost when its previous connection dropped
+	h.dataHandler.reforwardPendingRequests(collectorConn.StationID)
 
 	// Handle messages
 	defer h.cleanupConnection(collectorConn.StationID)
+
+	// Ping the collector so half-open connections are detected by the read deadline
+	done := make(chan struct{})
+	defer close(done)
+	go h.keepAlive(collectorConn, done)
+	go h.watchHeartbeats(collectorConn, done)
+
 	h.handleMessages(collectorConn)
 }
 
+// livenessIntervals returns the configured ping interval and pong timeout of
+// collector and receiver WebSockets. The pong timeout always exceeds the ping
+// interval so a healthy peer never trips the read deadline between pings.
+func livenessIntervals(cfg *config.Config) (time.Duration, time.Duration) {
+	pingInterval := 30 * time.Second
+	pongTimeout := 75 * time.Second
+	if cfg != nil {
+		if cfg.Server.WSPingInterval > 0 {
+			pingInterval = time.Duration(cfg.Server.WSPingInterval) * time.Second
+		}
+		if cfg.Server.WSPongTimeout > 0 {
+			pongTimeout = time.Duration(cfg.Server.WSPongTimeout) * time.Second
+		}
+	}
+	if pongTimeout <= pingInterval {
+		pongTimeout = 2 * pingInterval
+	}
+	return pingInterval, pongTimeout
+}
+
+// keepAlive sends periodic pings to a collector until done is closed
+func (h *CollectorHandler) keepAlive(collectorConn *CollectorConnection, done <-chan struct{}) {
+	pingInterval, _ := livenessIntervals(h.cfg)
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			// WriteControl is safe to call concurrently with the other writers
+			deadline := time.Now().Add(10 * time.Second)
+			if err := collectorConn.Conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				h.logger.Warn("Failed to ping station %s, closing connection: %v", collectorConn.StationID, err)
+				// Closing the connection unblocks the reader so cleanup runs
+				collectorConn.Conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// watchHeartbeats closes a collector's connection once it has sent no message
+// for STATION_HEARTBEAT_TIMEOUT_SECONDS, until done is closed. Pings only
+// find connections that stopped answering; this also finds collectors that
+// still answer pings but stopped working, so they are dropped and their
+// session marked disconnected instead of lingering until the socket closes.
+func (h *CollectorHandler) watchHeartbeats(collectorConn *CollectorConnection, done <-chan struct{}) {
+	timeout := time.Duration(h.cfg.Server.StationHeartbeatTimeout) * time.Second
+	if timeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(timeout / 10)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			silent := collectorConn.sinceLastMessage()
+			if silent < timeout {
+				continue
+			}
+			h.logger.Warn("Station %s sent no heartbeat for %v, closing connection", collectorConn.StationID, silent.Round(time.Second))
+			collectorConn.Conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "heartbeat timeout"),
+				time.Now().Add(time.Second))
+			// Closing the connection unblocks the reader so cleanup runs
+			collectorConn.Conn.Close()
+			return
+		}
+	}
+}
+
 // handleCollectorAuth handles the initial authentication handshake
-func (h *CollectorHandler) handleCollectorAuth(conn *websocket.Conn) (*CollectorConnection, error) {
+func (h *CollectorHandler) handleCollectorAuth(conn *websocket.Conn, userID int) (*CollectorConnection, error) {
 	// Set read deadline for auth
 	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
 
@@ -128,41 +268,89 @@ func (h *CollectorHandler) handleCollectorAuth(conn *websocket.Conn) (*Collector
 		}
 	}
 
-	// Send auth success response
+	// A station belongs to the first user that connects it
+	if err := h.claimStation(registration.StationID, userID); err != nil {
+		return nil, err
+	}
+
+	// Send auth success response, with what the server expects of the collector
+	server := version.Current()
+	iceConfig := iceServerConfig(h.cfg.ICE, strconv.Itoa(userID))
 	response := shared.WebSocketMessage{
 		Type: "auth_success",
-		Payload: map[string]string{
-			"status": "authenticated",
+		Payload: shared.AuthSuccess{
+			Status:      "authenticated",
+			Server:      &server,
+			ICE:         &iceConfig,
+			FilePattern: h.cfg.Server.CaptureFilePattern,
+			MaxFileSize: int64(h.cfg.Storage.MaxUploadSize) * 1024 * 1024,
 		},
 	}
 
-	if err := h.sendMessage(conn, response); err != nil {
+	collectorConn := &CollectorConnection{
+		StationID:   registration.StationID,
+		Conn:        conn,
+		LastSeen:    time.Now(),
+		lastMessage: time.Now(),
+	}
+	if err := h.sendMessage(collectorConn, response); err != nil {
 		return nil, err
 	}
 
 	// Clear read deadline
 	conn.SetReadDeadline(time.Time{})
 
-	return &CollectorConnection{
-		StationID:   registration.StationID,
-		Conn:        conn,
-		LastSeen:    time.Now(),
-	}, nil
+	return collectorConn, nil
+}
+
+// claimStation binds a station ID to a user the first time it connects and
+// rejects later connections for that station from any other user
+func (h *CollectorHandler) claimStation(stationID string, userID int) error {
+	if _, err := h.db.Exec(`
+		INSERT INTO stations (station_id, user_id) VALUES (?, ?)
+		ON CONFLICT(station_id) DO NOTHING
+	`, stationID, userID); err != nil {
+		return fmt.Errorf("failed to bind station %s: %w", stationID, err)
+	}
+
+	var ownerID int
+	if err := h.db.QueryRow("SELECT user_id FROM stations WHERE station_id = ?", stationID).Scan(&ownerID); err != nil {
+		return fmt.Errorf("failed to look up station %s: %w", stationID, err)
+	}
+	if ownerID != userID {
+		return fmt.Errorf("station %s is registered to another user", stationID)
+	}
+	return nil
 }
 
 // handleMessages processes incoming messages from a collector
 func (h *CollectorHandler) handleMessages(collectorConn *CollectorConnection) {
+	_, pongTimeout := livenessIntervals(h.cfg)
+
+	// Any pong or message from the collector proves the connection is alive
+	collectorConn.Conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	collectorConn.Conn.SetPongHandler(func(string) error {
+		collectorConn.LastSeen = time.Now()
+		return collectorConn.Conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
+
 	for {
 		messageType, message, err := collectorConn.Conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				h.logger.Warn("Station %s missed liveness deadline (%v), closing connection", collectorConn.StationID, pongTimeout)
+				h.limiter.Evicted()
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				h.logger.Error("WebSocket error: %v", err)
 			}
 			break
 		}
 
+		collectorConn.Conn.SetReadDeadline(time.Now().Add(pongTimeout))
+
 		if messageType == websocket.TextMessage {
 			collectorConn.LastSeen = time.Now()
+			collectorConn.markMessage()
 			h.processMessage(collectorConn, message)
 		}
 	}
@@ -176,15 +364,22 @@ func (h *CollectorHandler) processMessage(collectorConn *CollectorConnection, me
 		return
 	}
 
+	if version := wsMsg.EffectiveVersion(); version > shared.MessageVersion && !collectorConn.newerVersionWarned {
+		collectorConn.newerVersionWarned = true
+		h.logger.Warn("Collector %s sends WebSocket message version %d, this server understands %d", collectorConn.StationID, version, shared.MessageVersion)
+	}
+
 	switch wsMsg.Type {
 	case "data_response":
 		h.handleDataResponse(collectorConn, wsMsg)
+	case "upload_failed":
+		h.handleUploadFailed(collectorConn, wsMsg)
 	case "heartbeat":
 		h.handleHeartbeat(collectorConn, wsMsg)
 	case "heartbeat_response":
 		h.handleHeartbeatResponse(collectorConn, wsMsg)
 	default:
-		h.logger.Warn("Unknown message type from collector %s: %s", collectorConn.StationID, wsMsg.Type)
+		h.logger.Debug("Ignoring unknown message type from collector %s: %s", collectorConn.StationID, wsMsg.Type)
 	}
 }
 
@@ -234,34 +429,30 @@ func (h *CollectorHandler) handleDataResponse(collectorConn *CollectorConnection
 		h.logger.Error("Collector %s reported error for request %s: %s",
 			collectorConn.StationID, response.RequestID, response.Error)
 
-	default:
-		h.logger.Warn("Unknown response status from station %s: %s",
-			collectorConn.StationID, response.Status)
-	}
-}
-
-// handleFileReady processes file ready notifications
-func (h *CollectorHandler) handleFileReady(response shared.DataResponse) {
-	// Update database with file ready status
-	if err := h.dataHandler.UpdateDataRequestStatus(response.RequestID, "ready", response.FilePath, response.FileSize); err != nil {
-		h.logger.Error("Failed to update data request status: %v", err)
-		return
-	}
+	case "rejected":
+		// The collector declined the request (e.g. it is draining); try another station
+		h.logger.Warn("Collector %s rejected request %s: %s",
+			collectorConn.StationID, response.RequestID, response.Error)
 
-	h.logger.Info("File ready for request %s: %s (%d bytes)", response.RequestID, response.FilePath, response.FileSize)
+		if err := h.dataHandler.StoreCollectorResponse(response.RequestID,
+			collectorConn.StationID, response.Status, "", 0, response.Error); err != nil {
+			h.logger.Error("Failed to store rejected response: %v", err)
+		}
 
-	// TODO: Notify waiting receiver clients
-}
+		if _, err := h.dataHandler.RerouteRequest(response.RequestID, collectorConn.StationID); err != nil {
+			h.logger.Error("Failed to reroute request %s: %v", response.RequestID, err)
+			// Nothing took the station's place, so it counts as failed; storing the error notifies the receiver
+			message := fmt.Sprintf("station rejected the request (%s) and it could not be rerouted: %v", response.Error, err)
+			if err := h.dataHandler.StoreCollectorResponse(response.RequestID,
+				collectorConn.StationID, "error", "", 0, message); err != nil {
+				h.logger.Error("Failed to store failed reroute for request %s: %v", response.RequestID, err)
+			}
+		}
 
-// handleCollectorError processes error responses from collectors
-func (h *CollectorHandler) handleCollectorError(response shared.DataResponse) {
-	// Update database with error status
-	if err := h.dataHandler.UpdateDataRequestStatus(response.RequestID, "error", "", 0); err != nil {
-		h.logger.Error("Failed to update data request status: %v", err)
-		return
+	default:
+		h.logger.Warn("Unknown response status from station %s: %s",
+			collectorConn.StationID, response.Status)
 	}
-
-	h.logger.Error("Collector error for request %s: %s", response.RequestID, response.Error)
 }
 
 // handleProcessingUpdate processes status updates from collectors
@@ -271,8 +462,16 @@ func (h *CollectorHandler) handleProcessingUpdate(response shared.DataResponse)
 
 // handleHeartbeat processes heartbeat messages
 func (h *CollectorHandler) handleHeartbeat(collectorConn *CollectorConnection, wsMsg shared.WebSocketMessage) {
+	var heartbeat shared.HeartbeatMessage
+	payload, _ := json.Marshal(wsMsg.Payload)
+	if err := json.Unmarshal(payload, &heartbeat); err != nil {
+		h.logger.Error("Failed to unmarshal heartbeat from station %s: %v", collectorConn.StationID, err)
+	}
+
+	h.logger.Debug("Heartbeat from station %s: %s, %d active requests", collectorConn.StationID, heartbeat.Status, heartbeat.ActiveRequests)
+
 	// Update last heartbeat in database
-	if err := h.dataHandler.UpdateCollectorHeartbeat(collectorConn.StationID); err != nil {
+	if err := h.dataHandler.UpdateCollectorHeartbeat(collectorConn.StationID, heartbeat); err != nil {
 		h.logger.Error("Failed to update collector heartbeat: %v", err)
 	}
 
@@ -286,15 +485,21 @@ func (h *CollectorHandler) handleHeartbeat(collectorConn *CollectorConnection, w
 		},
 	}
 
-	if err := h.sendMessage(collectorConn.Conn, response); err != nil {
+	if err := h.sendMessage(collectorConn, response); err != nil {
 		h.logger.Error("Failed to send heartbeat response: %v", err)
 	}
 }
 
 // handleHeartbeatResponse processes heartbeat responses
 func (h *CollectorHandler) handleHeartbeatResponse(collectorConn *CollectorConnection, wsMsg shared.WebSocketMessage) {
+	var heartbeat shared.HeartbeatMessage
+	payload, _ := json.Marshal(wsMsg.Payload)
+	if err := json.Unmarshal(payload, &heartbeat); err != nil {
+		h.logger.Error("Failed to unmarshal heartbeat response from station %s: %v", collectorConn.StationID, err)
+	}
+
 	// Update last heartbeat in database
-	if err := h.dataHandler.UpdateCollectorHeartbeat(collectorConn.StationID); err != nil {
+	if err := h.dataHandler.UpdateCollectorHeartbeat(collectorConn.StationID, heartbeat); err != nil {
 		h.logger.Error("Failed to update collector heartbeat: %v", err)
 	}
 }
@@ -318,17 +523,79 @@ func (h *CollectorHandler) SendDataRequest(stationID string, request shared.Data
 		Payload: request,
 	}
 
-	return h.sendMessage(conn.Conn, message)
+	return h.sendMessage(conn, message)
+}
+
+// RequestUpload asks a station to upload its file for a request to the server cache
+func (h *CollectorHandler) RequestUpload(stationID, requestID string) error {
+	h.connectionsMux.RLock()
+	conn, exists := h.connections[stationID]
+	h.connectionsMux.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("station %s not connected", stationID)
+	}
+
+	message := shared.WebSocketMessage{
+		Type:    "upload_request",
+		Payload: shared.UploadRequest{RequestID: requestID},
+	}
+
+	return h.sendMessage(conn, message)
+}
+
+// handleUploadFailed processes a collector's report that it couldn't upload a file
+func (h *CollectorHandler) handleUploadFailed(collectorConn *CollectorConnection, wsMsg shared.WebSocketMessage) {
+	var failed shared.UploadFailed
+	payload, _ := json.Marshal(wsMsg.Payload)
+	if err := json.Unmarshal(payload, &failed); err != nil {
+		h.logger.Error("Failed to unmarshal upload failure: %v", err)
+		return
+	}
+
+	h.dataHandler.UploadFailed(failed.RequestID, collectorConn.StationID, failed.Error)
+}
+
+// BroadcastControl sends a control message to every connected collector.
+// It returns the stations that received it and the errors for those that didn't.
+func (h *CollectorHandler) BroadcastControl(control shared.ControlMessage) ([]string, map[string]string) {
+	h.connectionsMux.RLock()
+	connections := make([]*CollectorConnection, 0, len(h.connections))
+	for _, conn := range h.connections {
+		connections = append(connections, conn)
+	}
+	h.connectionsMux.RUnlock()
+
+	message := shared.WebSocketMessage{
+		Type:    "control",
+		Payload: control,
+	}
+
+	sent := make([]string, 0, len(connections))
+	failed := make(map[string]string)
+	for _, conn := range connections {
+		if err := h.sendMessage(conn, message); err != nil {
+			h.logger.Error("Failed to send %s control to station %s: %v", control.Command, conn.StationID, err)
+			failed[conn.StationID] = err.Error()
+			continue
+		}
+		sent = append(sent, conn.StationID)
+	}
+
+	h.logger.Info("Broadcast %s control to %d/%d collectors", control.Command, len(sent), len(connections))
+	return sent, failed
 }
 
-// sendMessage sends a WebSocket message
-func (h *CollectorHandler) sendMessage(conn *websocket.Conn, message shared.WebSocketMessage) error {
+// sendMessage sends a WebSocket message. Request handlers, the ICE relays and
+// admin broadcasts all send to the same connections, so every message to a
+// collector goes through here.
+func (h *CollectorHandler) sendMessage(conn *CollectorConnection, message shared.WebSocketMessage) error {
 	data, err := json.Marshal(message)
 	if err != nil {
 		return err
 	}
 
-	return conn.WriteMessage(websocket.TextMessage, data)
+	return conn.write(data)
 }
 
 // cleanupConnection cleans up a collector connection
@@ -343,13 +610,22 @@ func (h *CollectorHandler) cleanupConnection(stationID string) {
 		SET status = 'disconnected', last_heartbeat = CURRENT_TIMESTAMP
 		WHERE station_id = ?
 	`
-	if _, err := h.db.Exec(query, stationID); err != nil {
+	if _, err := database.ExecWithRetry(h.db, query, stationID); err != nil {
 		h.logger.Error("Failed to update collector session status: %v", err)
 	}
 
 	h.logger.Info("Station disconnected: %s", stationID)
 }
 
+// IsStationConnected reports whether a station's WebSocket is open
+func (h *CollectorHandler) IsStationConnected(stationID string) bool {
+	h.connectionsMux.RLock()
+	defer h.connectionsMux.RUnlock()
+
+	_, exists := h.connections[stationID]
+	return exists
+}
+
 // GetConnectedStations returns a list of currently connected stations
 func (h *CollectorHandler) GetConnectedStations() []string {
 	h.connectionsMux.RLock()
@@ -363,6 +639,21 @@ func (h *CollectorHandler) GetConnectedStations() []string {
 	return stations
 }
 
+// GoingAway tells every connected collector the server is going away and
+// returns how many were told
+func (h *CollectorHandler) GoingAway(reason string) int {
+	h.connectionsMux.RLock()
+	defer h.connectionsMux.RUnlock()
+
+	notified := 0
+	for _, conn := range h.connections {
+		if sendGoingAway(conn.Conn, reason) {
+			notified++
+		}
+	}
+	return notified
+}
+
 // NotifyCollectorOfICEAnswer sends a WebSocket notification to a collector about a new ICE answer
 func (h *CollectorHandler) NotifyCollectorOfICEAnswer(stationID, sessionID, answerSDP string) error {
 	h.connectionsMux.RLock()
@@ -376,14 +667,14 @@ func (h *CollectorHandler) NotifyCollectorOfICEAnswer(stationID, sessionID, answ
 
 	notification := shared.WebSocketMessage{
 		Type: "ice_answer",
-		Payload: map[string]interface{}{
-			"session_id": sessionID,
-			"answer_sdp": answerSDP,
-			"timestamp":  time.Now().Unix(),
+		Payload: shared.ICEAnswerNotification{
+			SessionID: sessionID,
+			AnswerSDP: answerSDP,
+			Timestamp: time.Now().Unix(),
 		},
 	}
 
-	if err := h.sendMessage(conn.Conn, notification); err != nil {
+	if err := h.sendMessage(conn, notification); err != nil {
 		h.logger.Error("Failed to send ICE answer notification to station %s: %v", stationID, err)
 		return err
 	}
@@ -392,6 +683,35 @@ func (h *CollectorHandler) NotifyCollectorOfICEAnswer(stationID, sessionID, answ
 	return nil
 }
 
+// NotifyCollectorOfICERestart asks a collector to restart ICE for a session.
+// Unlike the other signals it fails if the collector isn't connected, so the
+// receiver doesn't wait for an offer that can't come.
+func (h *CollectorHandler) NotifyCollectorOfICERestart(stationID, sessionID string) error {
+	h.connectionsMux.RLock()
+	conn, exists := h.connections[stationID]
+	h.connectionsMux.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("%w: %s", errStationNotConnected, stationID)
+	}
+
+	notification := shared.WebSocketMessage{
+		Type: "ice_restart",
+		Payload: shared.ICERestartNotification{
+			SessionID: sessionID,
+			Timestamp: time.Now().Unix(),
+		},
+	}
+
+	if err := h.sendMessage(conn, notification); err != nil {
+		h.logger.Error("Failed to send ICE restart notification to station %s: %v", stationID, err)
+		return err
+	}
+
+	h.logger.Info("Sent ICE restart notification to station %s for session %s", stationID, sessionID)
+	return nil
+}
+
 // NotifyCollectorOfICECandidate sends a WebSocket notification to a collector about a new ICE candidate
 func (h *CollectorHandler) NotifyCollectorOfICECandidate(stationID, sessionID string, candidate *models.ICECandidate) error {
 	h.connectionsMux.RLock()
@@ -404,17 +724,11 @@ func (h *CollectorHandler) NotifyCollectorOfICECandidate(stationID, sessionID st
 	}
 
 	notification := shared.WebSocketMessage{
-		Type: "ice_candidate",
-		Payload: map[string]interface{}{
-			"session_id":      sessionID,
-			"candidate":       candidate.Candidate,
-			"sdp_mline_index": candidate.SDPMLineIndex,
-			"sdp_mid":         candidate.SDPMid,
-			"timestamp":       time.Now().Unix(),
-		},
+		Type:    "ice_candidate",
+		Payload: shared.NewICECandidateNotification(sessionID, candidate),
 	}
 
-	if err := h.sendMessage(conn.Conn, notification); err != nil {
+	if err := h.sendMessage(conn, notification); err != nil {
 		h.logger.Error("Failed to send ICE candidate notification to station %s: %v", stationID, err)
 		return err
 	}
@@ -423,6 +737,56 @@ func (h *CollectorHandler) NotifyCollectorOfICECandidate(stationID, sessionID st
 	return nil
 }
 
+// NotifyCollectorOfSessionCancelled tells a collector to stop a transfer whose request was cancelled
+func (h *CollectorHandler) NotifyCollectorOfSessionCancelled(stationID string, cancelled shared.SessionCancelledNotification) error {
+	h.connectionsMux.RLock()
+	conn, exists := h.connections[stationID]
+	h.connectionsMux.RUnlock()
+
+	if !exists {
+		h.logger.Debug("No active collector connection for station %s", stationID)
+		return nil
+	}
+
+	notification := shared.WebSocketMessage{
+		Type:    "session_cancelled",
+		Payload: cancelled,
+	}
+
+	if err := h.sendMessage(conn, notification); err != nil {
+		h.logger.Error("Failed to send session cancelled notification to station %s: %v", stationID, err)
+		return err
+	}
+
+	h.logger.Info("Sent session cancelled notification to station %s for session %s", stationID, cancelled.SessionID)
+	return nil
+}
+
+// NotifyCollectorOfSessionFailed tells a collector to give up on a session the server failed
+func (h *CollectorHandler) NotifyCollectorOfSessionFailed(stationID string, failed shared.SessionFailedNotification) error {
+	h.connectionsMux.RLock()
+	conn, exists := h.connections[stationID]
+	h.connectionsMux.RUnlock()
+
+	if !exists {
+		h.logger.Debug("No active collector connection for station %s", stationID)
+		return nil
+	}
+
+	notification := shared.WebSocketMessage{
+		Type:    "session_failed",
+		Payload: failed,
+	}
+
+	if err := h.sendMessage(conn, notification); err != nil {
+		h.logger.Error("Failed to send session failed notification to station %s: %v", stationID, err)
+		return err
+	}
+
+	h.logger.Info("Sent session failed notification to station %s for session %s", stationID, failed.SessionID)
+	return nil
+}
+
 // NotifyCollectorOfNewICESession sends a WebSocket notification to collectors about a new ICE session
 func (h *CollectorHandler) NotifyCollectorOfNewICESession(sessionID, requestType string, userID int, parameters string) error {
 	h.connectionsMux.RLock()
@@ -439,18 +803,18 @@ func (h *CollectorHandler) NotifyCollectorOfNewICESession(sessionID, requestType
 
 	notification := shared.WebSocketMessage{
 		Type: "new_ice_session",
-		Payload: map[string]interface{}{
-			"session_id":   sessionID,
-			"request_type": requestType,
-			"from_user":    userID,
-			"parameters":   parameters,
-			"timestamp":    time.Now().Unix(),
+		Payload: shared.NewICESessionNotification{
+			SessionID:   sessionID,
+			RequestType: requestType,
+			FromUser:    userID,
+			Parameters:  parameters,
+			Timestamp:   time.Now().Unix(),
 		},
 	}
 
 	successCount := 0
 	for _, conn := range connections {
-		if err := h.sendMessage(conn.Conn, notification); err != nil {
+		if err := h.sendMessage(conn, notification); err != nil {
 			h.logger.Error("Failed to send new ICE session notification to station %s: %v", conn.StationID, err)
 		} else {
 			h.logger.Debug("Sent new ICE session notification to station %s for session %s", conn.StationID, sessionID)
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ConnectionLimiter caps the number of concurrent WebSocket connections of
+// one kind. It is created with ConnectionLimits.Limiter, which reports the
+// current counts and the connections closed for not answering pings.
+type ConnectionLimiter struct {
+	name   string
+	max    int // 0 means unlimited
+	active atomic.Int64
+
+	evictions atomic.Int64
+}
+
+// ConnectionLimits holds the connection limiter of every kind of WebSocket
+// one server accepts
+type ConnectionLimits struct {
+	limiters map[string]*ConnectionLimiter
+	mu       sync.Mutex
+}
+
+// NewConnectionLimits creates an empty set of connection limiters
+func NewConnectionLimits() *ConnectionLimits {
+	return &ConnectionLimits{limiters: make(map[string]*ConnectionLimiter)}
+}
+
+// Limiter creates the limiter for a connection kind. Creating a limiter with
+// a name that already exists replaces the old one.
+func (l *ConnectionLimits) Limiter(name string, max int) *ConnectionLimiter {
+	limiter := &ConnectionLimiter{name: name, max: max}
+
+	l.mu.Lock()
+	l.limiters[name] = limiter
+	l.mu.Unlock()
+
+	return limiter
+}
+
+// Acquire reserves a connection slot, or reports false if the limit is reached.
+// Every successful Acquire must be paired with a Release.
+func (l *ConnectionLimiter) Acquire() bool {
+	if l.active.Add(1) > int64(l.max) && l.max > 0 {
+		l.active.Add(-1)
+		return false
+	}
+	return true
+}
+
+// Release frees a slot reserved by Acquire
+func (l *ConnectionLimiter) Release() {
+	l.active.Add(-1)
+}
+
+// Evicted counts a connection closed for not answering pings
+func (l *ConnectionLimiter) Evicted() {
+	l.evictions.Add(1)
+}
+
+// Reject completes the upgrade only to close the connection with 1013 (try
+// again later), so WebSocket clients see why they were turned away
+func (l *ConnectionLimiter) Reject(conn *websocket.Conn) {
+	reason := fmt.Sprintf("too many %s connections (limit %d)", l.name, l.max)
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseTryAgainLater, reason),
+		time.Now().Add(time.Second))
+	conn.Close()
+}
+
+// Active returns the current number of connections of each kind
+func (l *ConnectionLimits) Active() map[string]int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	counts := make(map[string]int64, len(l.limiters))
+	for name, limiter := range l.limiters {
+		counts[name] = limiter.active.Load()
+	}
+	return counts
+}
+
+// Evictions returns the number of connections of each kind closed for not
+// answering pings since the server started
+func (l *ConnectionLimits) Evictions() map[string]int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	counts := make(map[string]int64, len(l.limiters))
+	for name, limiter := range l.limiters {
+		counts[name] = limiter.evictions.Load()
+	}
+	return counts
+}
@@ -2,15 +2,27 @@ package handlers
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"argus-sdr/internal/auth"
+	"argus-sdr/internal/collector"
+	"argus-sdr/internal/convert"
+	"argus-sdr/internal/database"
 	"argus-sdr/internal/models"
+	"argus-sdr/internal/notify"
+	"argus-sdr/internal/safehttp"
 	"argus-sdr/internal/shared"
+	"argus-sdr/internal/storage"
 	"argus-sdr/pkg/config"
 	"argus-sdr/pkg/logger"
 
@@ -24,10 +36,46 @@ type DataHandler struct {
 	logger           *logger.Logger
 	cfg              *config.Config
 	collectorHandler *CollectorHandler
-	receiverConns    map[string]*websocket.Conn
+	receiverConns    map[string]*receiverConn
 	connMutex        sync.RWMutex
+
+	// Long-polls waiting for requests to change, by request ID
+	requestWaiters map[string]*requestWaiter
+	waitersMutex   sync.Mutex
+
+	// Stations each request was forwarded to, so rejected requests can be rerouted
+	routedRequests map[string]*routedRequest
+	routedMutex    sync.Mutex
+
+	// File cache for collector uploads; nil when the server doesn't cache files
+	storage storage.Storage
+
+	// Fan-out uploads requested from collectors, with their WebRTC fallback timers
+	pendingUploads map[string]*time.Timer
+	uploadsMutex   sync.Mutex
+
+	// Caps the number of concurrent receiver WebSocket connections
+	receiverLimiter *ConnectionLimiter
+
+	// Held while a request is checked against its user's daily quota and stored
+	quotaMutex sync.Mutex
+
+	// Delivers notifications to request callback URLs; nil disables webhooks
+	notifier notify.Notifier
+
+	// Fetches files from collector download URLs without reaching internal addresses
+	downloadClient *http.Client
+}
+
+// routedRequest tracks which stations a request has been sent to
+type routedRequest struct {
+	stations    map[string]bool
+	forwardedAt time.Time
 }
 
+// routedRequestTTL is how long routing information is kept for rerouting
+const routedRequestTTL = time.Hour
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
@@ -35,6 +83,7 @@ var upgrader = websocket.Upgrader{
 	HandshakeTimeout: 30 * time.Second,
 	ReadBufferSize:   1024,
 	WriteBufferSize:  1024,
+	Subprotocols:     shared.WebSocketSubprotocols,
 }
 
 // SetCollectorHandler sets the collector handler for WebSocket communications
@@ -42,27 +91,164 @@ func (h *DataHandler) SetCollectorHandler(collectorHandler *CollectorHandler) {
 	h.collectorHandler = collectorHandler
 }
 
-func NewDataHandler(db *sql.DB, log *logger.Logger, cfg *config.Config) *DataHandler {
+func NewDataHandler(db *sql.DB, log *logger.Logger, cfg *config.Config, limits *ConnectionLimits) *DataHandler {
 	return &DataHandler{
 		db:            db,
 		logger:        log,
 		cfg:           cfg,
-		receiverConns: make(map[string]*websocket.Conn),
+		receiverConns: make(map[string]*receiverConn),
+
+		requestWaiters: make(map[string]*requestWaiter),
+
+		routedRequests: make(map[string]*routedRequest),
+		pendingUploads: make(map[string]*time.Timer),
+
+		receiverLimiter: limits.Limiter("receiver", cfg.Server.MaxReceiverConnections),
+
+		downloadClient: safehttp.NewClient(safehttp.Options{
+			Timeout:          30 * time.Second,
+			AllowedNetworks:  OutboundAllowedNetworks(cfg),
+			MaxRedirects:     3,
+			MaxResponseBytes: int64(cfg.Storage.MaxProxyDownloadSize) * 1024 * 1024,
+		}),
+	}
+}
+
+// OutboundAllowedNetworks returns the internal networks server-initiated
+// requests may reach, from OUTBOUND_ALLOWED_NETWORKS
+func OutboundAllowedNetworks(cfg *config.Config) []*net.IPNet {
+	// The entries were validated when the config was loaded
+	networks, _ := safehttp.ParseNetworks(cfg.Server.OutboundAllowedNetworks)
+	return networks
+}
+
+// bindDataRequest reads a data request from the body of POST
+// /api/data/request or /api/data/request/plan, starting from the template in
+// template_id if given, and checks its fields. If they are invalid, it
+// responds and returns false.
+func (h *DataHandler) bindDataRequest(c *gin.Context) (shared.DataRequest, bool) {
+	var body struct {
+		shared.DataRequest
+		TemplateID int64 `json:"template_id"` // a saved template to start from
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return shared.DataRequest{}, false
+	}
+	request := body.DataRequest
+
+	if body.TemplateID != 0 {
+		templates, err := h.userTemplates(c.GetInt("user_id"), body.TemplateID)
+		if err != nil {
+			h.logger.Error("Failed to load template %d: %v", body.TemplateID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
+			return request, false
+		}
+		if len(templates) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			return request, false
+		}
+		template := templates[0]
+		if err := applyTemplate(&request, template); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return request, false
+		}
+		// The parameter rules may have changed since the template was saved
+		if err := collector.ValidateParameters(request.Parameters, request.DurationSeconds); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("template %q is no longer valid: %v", template.Name, err)})
+			return request, false
+		}
 	}
+
+	// Parameters are stored and sent to every collector, so they must be
+	// bounded and parse before they get that far
+	if err := h.checkParameters(request.Parameters); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return request, false
+	}
+
+	// Only formats the collectors can convert to are accepted
+	if _, err := convert.Lookup(request.Format); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "supported_formats": convert.Supported()})
+		return request, false
+	}
+
+	if request.Region != nil {
+		if err := request.Region.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid region: " + err.Error()})
+			return request, false
+		}
+	}
+
+	if err := h.checkDurationSeconds(request.DurationSeconds); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return request, false
+	}
+
+	if !shared.IsValidSelectionStrategy(request.SelectionStrategy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown selection_strategy %q", request.SelectionStrategy), "selection_strategies": shared.SelectionStrategies})
+		return request, false
+	}
+
+	if request.MinStations < 0 || request.MinStations > maxCollectorsPerRequest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("min_stations must be between 0 and %d", maxCollectorsPerRequest)})
+		return request, false
+	}
+	if request.MaxStations < 0 || request.MaxStations > maxCollectorsPerRequest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("max_stations must be between 0 and %d", maxCollectorsPerRequest)})
+		return request, false
+	}
+	if request.MaxStations > 0 && request.MinStations > request.MaxStations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("min_stations (%d) can't be more than max_stations (%d)", request.MinStations, request.MaxStations)})
+		return request, false
+	}
+
+	return request, true
+}
+
+// checkParameters checks that a request's parameters are at most
+// REQUEST_MAX_PARAMETERS_BYTES long and, unless empty, a JSON object. Which
+// parameters are allowed is up to each collector.
+func (h *DataHandler) checkParameters(parameters string) error {
+	if maxBytes := h.cfg.Server.MaxParametersBytes; len(parameters) > maxBytes {
+		return fmt.Errorf("parameters are %d bytes long, at most %d are allowed", len(parameters), maxBytes)
+	}
+	if parameters == "" {
+		return nil
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(parameters), &values); err != nil {
+		return fmt.Errorf("parameters must be a JSON object: %w", err)
+	}
+	return nil
 }
 
 // RequestData handles POST /api/data/request
 func (h *DataHandler) RequestData(c *gin.Context) {
-	var request shared.DataRequest
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	request, ok := h.bindDataRequest(c)
+	if !ok {
 		return
 	}
 
-	// Generate unique request ID if not provided
-	if request.ID == "" {
-		request.ID = uuid.New().String()
+	// Webhooks must point at public addresses so they can't be used to probe the server's network
+	if request.CallbackURL != "" {
+		if h.notifier == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook callbacks are not enabled on this server"})
+			return
+		}
+		if err := h.notifier.Validate(request.CallbackURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Request IDs are primary keys and name files on servers, collectors and
+	// receivers, so they are always generated here and the client learns
+	// the ID from the response
+	if request.ID != "" {
+		h.logger.Debug("Ignoring client supplied request ID %q", request.ID)
 	}
+	request.ID = uuid.New().String()
 	userIDInt, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
@@ -74,24 +260,60 @@ func (h *DataHandler) RequestData(c *gin.Context) {
 	
 	h.logger.Debug("RequestData: userID=%s, request.RequestedBy=%s", userID, request.RequestedBy)
 
+	// Counting and storing under one lock keeps concurrent requests from
+	// overrunning the user's daily quota
+	h.quotaMutex.Lock()
+	quota, err := h.userQuota(c, userID)
+	if err != nil {
+		h.quotaMutex.Unlock()
+		h.logger.Error("Failed to count requests of user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
+		return
+	}
+	if quota.Exceeded() {
+		h.quotaMutex.Unlock()
+		h.logger.Info("User %s exceeded their daily quota of %d requests", userID, quota.Limit)
+		quotaExceeded(c, quota)
+		return
+	}
+
 	// Store request in database
-	if err := h.createDataRequest(&request); err != nil {
+	err = h.createDataRequest(&request)
+	h.quotaMutex.Unlock()
+	if err != nil {
 		h.logger.Error("Failed to create data request: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
 		return
 	}
 
 	// Forward to available collectors
-	if err := h.forwardToCollectors(request); err != nil {
+	collectorCount, err := h.forwardToCollectors(request)
+	if err != nil {
 		h.logger.Error("Failed to forward to collectors: %v", err)
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No collectors available"})
+		// The receiver retries with a new request, so this one is finished
+		h.UpdateDataRequestStatus(request.ID, "failed", "", 0)
+		h.serviceUnavailable(c, selectionError(err, request))
 		return
 	}
 
-	c.JSON(http.StatusAccepted, gin.H{
+	quota.Used++
+	setQuotaHeaders(c, quota)
+
+	response := gin.H{
 		"request_id": request.ID,
 		"status":     "processing",
-	})
+		"collectors": collectorCount,
+	}
+
+	// Estimate when the data will be ready from how long past requests took
+	if responses, err := h.GetCollectorResponses(request.ID); err != nil {
+		h.logger.Warn("Failed to load collector responses to estimate request %s: %v", request.ID, err)
+	} else if readyAt, _ := h.estimateReadyAt(request.RequestType, request.DurationSeconds, time.Now(), responses); !readyAt.IsZero() {
+		response["eta_seconds"] = int(time.Until(readyAt).Round(time.Second).Seconds())
+		response["estimated_ready_at"] = readyAt.UTC().Format(time.RFC3339)
+	}
+
+	c.JSON(http.StatusAccepted, response)
 }
 
 // GetRequestStatus handles GET /api/data/status/:id
@@ -184,12 +406,12 @@ func (h *DataHandler) DownloadFile(c *gin.Context) {
 	// Get the specific collector response for this request and station
 	var response CollectorResponse
 	query := `
-		SELECT request_id, station_id, status, download_url, file_size
+		SELECT request_id, station_id, status, download_url, file_size, cached_path, sha256, capture_metadata
 		FROM collector_responses
 		WHERE request_id = ? AND station_id = ? AND status = 'ready'
 	`
 
-	var downloadURL sql.NullString
+	var downloadURL, cachedPath, checksum, captureMetadata sql.NullString
 	var fileSize sql.NullInt64
 
 	err := h.db.QueryRow(query, requestID, stationID).Scan(
@@ -198,6 +420,9 @@ func (h *DataHandler) DownloadFile(c *gin.Context) {
 		&response.Status,
 		&downloadURL,
 		&fileSize,
+		&cachedPath,
+		&checksum,
+		&captureMetadata,
 	)
 
 	if err != nil {
@@ -210,6 +435,13 @@ func (h *DataHandler) DownloadFile(c *gin.Context) {
 		return
 	}
 
+	// Serve from the server cache when the collector uploaded the file
+	if cachedPath.Valid && cachedPath.String != "" {
+		if h.serveCachedFile(c, requestID, stationID, cachedPath.String, checksum.String, captureMetadata.String) {
+			return
+		}
+	}
+
 	if !downloadURL.Valid || downloadURL.String == "" {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Download URL not available"})
 		return
@@ -218,61 +450,259 @@ func (h *DataHandler) DownloadFile(c *gin.Context) {
 	// Proxy the request to the collector
 	h.logger.Info("Proxying download request for %s from station %s to %s", requestID, stationID, downloadURL.String)
 
-	// Create HTTP client and make request to collector
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(downloadURL.String)
+	// Files the collector says are too large aren't fetched at all
+	maxSize := int64(h.cfg.Storage.MaxProxyDownloadSize) * 1024 * 1024
+	if maxSize > 0 && fileSize.Valid && fileSize.Int64 > maxSize {
+		h.refuseOversizedDownload(c, requestID, stationID, fileSize.Int64)
+		return
+	}
+
+	// The URL comes from the collector, so it must not lead into the server's own network
+	resp, err := h.downloadClient.Get(downloadURL.String)
+	if errors.Is(err, safehttp.ErrBlockedAddress) {
+		h.logger.Warn("Refusing to proxy download for %s from station %s: %v", requestID, stationID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Collector download URL is not allowed"})
+		return
+	}
+	if errors.Is(err, safehttp.ErrResponseTooLarge) {
+		h.refuseOversizedDownload(c, requestID, stationID, -1)
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to proxy download request: %v", err)
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to download from collector"})
+		h.serviceUnavailable(c, "Failed to download from collector")
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		h.logger.Error("Collector returned status %d for download", resp.StatusCode)
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Collector download failed"})
+		h.serviceUnavailable(c, "Collector download failed")
 		return
 	}
 
 	// Set appropriate headers
-	c.Header("Content-Type", "application/octet-stream")
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s_%s_data.npz\"", requestID, stationID))
-	if fileSize.Valid {
+	h.setDownloadHeaders(c, requestID, stationID)
+	if resp.ContentLength >= 0 {
+		c.Header("Content-Length", fmt.Sprintf("%d", resp.ContentLength))
+	} else if fileSize.Valid {
 		c.Header("Content-Length", fmt.Sprintf("%d", fileSize.Int64))
 	}
+	c.Status(http.StatusOK)
+
+	// Copy the response body to the client without trusting its declared
+	// length; chunked responses (ContentLength -1) are capped the same way
+	body := io.Reader(resp.Body)
+	if maxSize > 0 {
+		body = io.LimitReader(resp.Body, maxSize+1)
+	}
+	written, err := io.Copy(c.Writer, body)
+	if maxSize > 0 && (written > maxSize || errors.Is(err, safehttp.ErrResponseTooLarge)) {
+		h.logger.Warn("Aborting proxied download for %s from station %s: collector sent more than %d MB", requestID, stationID, h.cfg.Storage.MaxProxyDownloadSize)
+		abortResponse(c)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Proxied download for %s from station %s failed after %d bytes: %v", requestID, stationID, written, err)
+		abortResponse(c)
+		return
+	}
+	h.recordDownload(c, stationID, written)
+}
 
-	// Copy the response body directly to the client
-	c.DataFromReader(http.StatusOK, resp.ContentLength, "application/octet-stream", resp.Body, nil)
+// recordDownload adds a file the user downloaded from the server to their usage
+func (h *DataHandler) recordDownload(c *gin.Context, stationID string, bytes int64) {
+	if bytes <= 0 {
+		// Nothing was sent, as for HEAD or unchanged conditional requests
+		return
+	}
+	if err := recordTransfer(h.db, c.GetInt("user_id"), stationID, shared.TransferHTTP, bytes); err != nil {
+		h.logger.Error("Failed to record download of %d bytes from station %s: %v", bytes, stationID, err)
+	}
 }
 
-// createDataRequest stores a new data request in the database
+// refuseOversizedDownload rejects a proxied download larger than PROXY_MAX_DOWNLOAD_MB.
+// size is the declared size, or -1 when it isn't known.
+func (h *DataHandler) refuseOversizedDownload(c *gin.Context, requestID, stationID string, size int64) {
+	h.logger.Warn("Refusing to proxy download for %s from station %s: file of %d bytes exceeds %d MB", requestID, stationID, size, h.cfg.Storage.MaxProxyDownloadSize)
+	c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Collector file exceeds the maximum proxied download size of %d MB", h.cfg.Storage.MaxProxyDownloadSize)})
+}
+
+// abortResponse closes the client connection in the middle of a response, so
+// a truncated download isn't mistaken for a complete one. HTTP/2 connections
+// can't be hijacked; their clients rely on Content-Length to notice truncation.
+func abortResponse(c *gin.Context) {
+	c.Writer.Flush()
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		return
+	}
+	conn.Close()
+}
+
+// maxRequestIDAttempts bounds how often createDataRequest draws a new ID when
+// the one it drew is taken
+const maxRequestIDAttempts = 3
+
+// createDataRequest stores a new data request in the database and subscribes
+// the requester to it, both or neither. Should request.ID already be taken,
+// the request is stored under a new ID instead.
 func (h *DataHandler) createDataRequest(request *shared.DataRequest) error {
+	// The region is kept so rerouted requests stay in it
+	var region sql.NullString
+	if request.Region != nil {
+		encoded, err := json.Marshal(request.Region)
+		if err != nil {
+			return err
+		}
+		region = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := h.insertDataRequest(request, region)
+		if err == nil || !database.IsUniqueViolation(err) || attempt >= maxRequestIDAttempts {
+			return err
+		}
+		h.logger.Warn("Request ID %s is already taken, generating a new one", request.ID)
+		request.ID = uuid.New().String()
+	}
+}
+
+// insertDataRequest inserts a request and its requester's subscription in one
+// transaction
+func (h *DataHandler) insertDataRequest(request *shared.DataRequest, region sql.NullString) error {
 	query := `
-		INSERT INTO data_requests (id, request_type, parameters, requested_by, status, created_at)
-		VALUES (?, ?, ?, ?, 'pending', CURRENT_TIMESTAMP)
+		INSERT INTO data_requests (id, request_type, parameters, format, image, callback_url, region, region_fallback, selection_strategy, duration_seconds, requested_by, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'pending', CURRENT_TIMESTAMP)
 	`
-	_, err := h.db.Exec(query, request.ID, request.RequestType, request.Parameters, request.RequestedBy)
+	duration := sql.NullFloat64{Float64: request.DurationSeconds, Valid: request.DurationSeconds != 0}
+	return database.WithTx(h.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(query, request.ID, request.RequestType, request.Parameters, request.Format, sql.NullString{String: request.Image, Valid: request.Image != ""}, sql.NullString{String: request.CallbackURL, Valid: request.CallbackURL != ""}, region, request.RegionFallback, sql.NullString{String: request.SelectionStrategy, Valid: request.SelectionStrategy != ""}, duration, request.RequestedBy); err != nil {
+			return err
+		}
+
+		// The requester is always subscribed to their own request's notifications
+		_, err := tx.Exec(addSubscriberQuery, request.ID, request.RequestedBy)
+		return err
+	})
+}
+
+// serviceUnavailable answers 503 with a Retry-After hint, so clients back off
+// instead of retrying while the server has no collector to serve them
+func (h *DataHandler) serviceUnavailable(c *gin.Context, message string) {
+	if h.cfg.Server.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(h.cfg.Server.RetryAfter))
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": message})
+}
+
+// setDownloadHeaders sets the media type and file name a request's download
+// is served with, for the format the receiver asked for. Station IDs are
+// chosen by collectors, so the IDs are reduced to safe characters first.
+func (h *DataHandler) setDownloadHeaders(c *gin.Context, requestID, stationID string) {
+	format := h.requestFormat(requestID)
+	filename := fmt.Sprintf("%s_%s_data%s", fileNamePart(requestID), fileNamePart(stationID), convert.Extension(format))
+	c.Header("Content-Type", convert.ContentType(format))
+	c.Header("Content-Disposition", attachment(filename))
+}
+
+// requestFormat returns the file format a request asked for, empty for the
+// collection container's own NPZ
+func (h *DataHandler) requestFormat(requestID string) string {
+	var format sql.NullString
+	h.db.QueryRow("SELECT format FROM data_requests WHERE id = ?", requestID).Scan(&format)
+	return format.String
+}
+
+// fileNamePart replaces everything but letters, digits, dots, dashes and
+// underscores in an ID with underscores, for use in a file name
+func fileNamePart(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, id)
+}
+
+// attachment returns a Content-Disposition value offering a download as
+// filename, quoted or encoded as RFC 6266 requires
+func attachment(filename string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+}
+
+// SubscribeToRequest handles POST /api/data/subscribe/:id. Subscribers get
+// the request's data ready notifications; requests with several subscribers
+// are served from the server cache.
+func (h *DataHandler) SubscribeToRequest(c *gin.Context) {
+	requestID := c.Param("id")
+	userIDInt, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	userID := fmt.Sprintf("%d", userIDInt)
+
+	var id string
+	err := h.db.QueryRow("SELECT id FROM data_requests WHERE id = ?", requestID).Scan(&id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to look up request %s: %v", requestID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to subscribe"})
+		return
+	}
+
+	if err := h.AddRequestSubscriber(requestID, userID); err != nil {
+		h.logger.Error("Failed to subscribe user %s to request %s: %v", userID, requestID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to subscribe"})
+		return
+	}
+
+	h.logger.Info("User %s subscribed to request %s", userID, requestID)
+	c.JSON(http.StatusOK, gin.H{"request_id": requestID, "subscribed": true})
+}
+
+// addSubscriberQuery subscribes a user to a request; subscribing twice does
+// nothing
+const addSubscriberQuery = `
+	INSERT OR IGNORE INTO request_subscribers (request_id, user_id)
+	VALUES (?, ?)
+`
+
+// AddRequestSubscriber subscribes a user to a request's notifications
+func (h *DataHandler) AddRequestSubscriber(requestID, userID string) error {
+	_, err := h.db.Exec(addSubscriberQuery, requestID, userID)
 	return err
 }
 
-// getDataRequestStatus retrieves the status of a data request
+// getDataRequestStatus retrieves the status of a data request, with each
+// collector's status and a summary across them
 func (h *DataHandler) getDataRequestStatus(requestID string) (*shared.DataRequestStatus, error) {
 	query := `
-		SELECT id, status, file_path, file_size, assigned_station
+		SELECT id, request_type, status, file_path, file_size, duration_seconds, created_at
 		FROM data_requests
 		WHERE id = ?
 	`
 
 	var status shared.DataRequestStatus
-	var filePath, stationID sql.NullString
+	var requestType string
+	var filePath sql.NullString
 	var fileSize sql.NullInt64
+	var duration sql.NullFloat64
+	var createdAt time.Time
 
 	err := h.db.QueryRow(query, requestID).Scan(
 		&status.RequestID,
+		&requestType,
 		&status.Status,
 		&filePath,
 		&fileSize,
-		&stationID,
+		&duration,
+		&createdAt,
 	)
 
 	if err != nil {
@@ -285,8 +715,40 @@ func (h *DataHandler) getDataRequestStatus(requestID string) (*shared.DataReques
 	if fileSize.Valid {
 		status.FileSize = fileSize.Int64
 	}
-	if stationID.Valid {
-		status.StationID = stationID.String
+	status.DurationSeconds = duration.Float64
+
+	responses, err := h.GetCollectorResponses(requestID)
+	if err != nil {
+		return nil, err
+	}
+	if len(responses) == 0 {
+		// Not sent to any station yet, or forwarding failed
+		return &status, nil
+	}
+
+	summary, aggregate := aggregateStatus(responses)
+	if status.Status != "cancelled" {
+		status.Status = aggregate
+	}
+	status.Summary = &summary
+
+	readyAt, stationsReadyAt := h.estimateReadyAt(requestType, status.DurationSeconds, createdAt, responses)
+	if !readyAt.IsZero() {
+		status.EstimatedReadyAt = readyAt.UTC().Format(time.RFC3339)
+	}
+
+	for _, response := range responses {
+		collector := shared.CollectorStatus{
+			StationID:   response.StationID,
+			Status:      response.Status,
+			FileSize:    response.FileSize,
+			Error:       response.ErrorMessage,
+			CompletedAt: response.CompletedAt,
+		}
+		if stationReadyAt, ok := stationsReadyAt[response.StationID]; ok {
+			collector.EstimatedReadyAt = stationReadyAt.UTC().Format(time.RFC3339)
+		}
+		status.Collectors = append(status.Collectors, collector)
 	}
 
 	return &status, nil
@@ -295,7 +757,7 @@ func (h *DataHandler) getDataRequestStatus(requestID string) (*shared.DataReques
 // getDataRequestsByUser retrieves all data requests for a specific user
 func (h *DataHandler) getDataRequestsByUser(userID string) ([]shared.DataRequestStatus, error) {
 	query := `
-		SELECT id, status, file_path, file_size, assigned_station, created_at
+		SELECT id, status, file_path, file_size, created_at
 		FROM data_requests
 		WHERE requested_by = ?
 		ORDER BY created_at DESC
@@ -311,7 +773,7 @@ func (h *DataHandler) getDataRequestsByUser(userID string) ([]shared.DataRequest
 	var requests []shared.DataRequestStatus
 	for rows.Next() {
 		var req shared.DataRequestStatus
-		var filePath, stationID sql.NullString
+		var filePath sql.NullString
 		var fileSize sql.NullInt64
 		var createdAt string
 
@@ -320,7 +782,6 @@ func (h *DataHandler) getDataRequestsByUser(userID string) ([]shared.DataRequest
 			&req.Status,
 			&filePath,
 			&fileSize,
-			&stationID,
 			&createdAt,
 		)
 		if err != nil {
@@ -333,9 +794,6 @@ func (h *DataHandler) getDataRequestsByUser(userID string) ([]shared.DataRequest
 		if fileSize.Valid {
 			req.FileSize = fileSize.Int64
 		}
-		if stationID.Valid {
-			req.StationID = stationID.String
-		}
 
 		requests = append(requests, req)
 	}
@@ -343,26 +801,36 @@ func (h *DataHandler) getDataRequestsByUser(userID string) ([]shared.DataRequest
 	return requests, nil
 }
 
-// forwardToCollectors sends the request to available collectors
-func (h *DataHandler) forwardToCollectors(request shared.DataRequest) error {
+// maxCollectorsPerRequest is how many of the available stations a request is sent to
+const maxCollectorsPerRequest = 3
+
+// forwardToCollectors sends the request to available collectors and returns
+// how many collectors received it
+func (h *DataHandler) forwardToCollectors(request shared.DataRequest) (int, error) {
 	// Get available stations
 	stations, err := h.getAvailableStations()
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	limit := stationLimit(request)
+	if stations, err = h.candidateStations(stations, request, limit, nil); err != nil {
+		return 0, err
 	}
 
 	if len(stations) == 0 {
-		return gin.Error{
+		return 0, gin.Error{
 			Err:  nil,
 			Type: gin.ErrorTypePublic,
 			Meta: "No stations available",
 		}
 	}
 
-	// Limit to maximum of 3 collectors
-	maxCollectors := 3
-	if len(stations) > maxCollectors {
-		stations = stations[:maxCollectors]
+	if len(stations) > limit {
+		stations = stations[:limit]
+	}
+	if err := checkMinStations(stations, request); err != nil {
+		return 0, err
 	}
 
 	h.logger.Info("Forwarding request %s to %d collectors: %v", request.ID, len(stations), stations)
@@ -380,6 +848,10 @@ func (h *DataHandler) forwardToCollectors(request shared.DataRequest) error {
 				continue
 			}
 			h.logger.Info("Forwarded request %s to station %s via WebSocket", request.ID, stationID)
+			h.recordRoutedStation(request.ID, stationID)
+			if err := h.addPendingResponse(request.ID, stationID); err != nil {
+				h.logger.Error("Failed to track request %s for station %s: %v", request.ID, stationID, err)
+			}
 			successCount++
 		} else {
 			h.logger.Warn("CollectorHandler not set, cannot send WebSocket message")
@@ -390,57 +862,220 @@ func (h *DataHandler) forwardToCollectors(request shared.DataRequest) error {
 	// If no collectors received the request successfully, return error
 	if successCount == 0 {
 		if lastError != nil {
-			return lastError
+			return 0, lastError
 		}
-		return fmt.Errorf("failed to send request to any collectors")
+		return 0, fmt.Errorf("failed to send request to any collectors")
 	}
 
-	// Update the request with the first assigned station for tracking purposes
-	// The first station to complete will update the status
-	if err := h.assignStation(request.ID, stations[0]); err != nil {
-		h.logger.Error("Failed to assign station for tracking: %v", err)
-		// Don't return error here as the requests were already sent
+	// Don't return an error here as the requests were already sent
+	if err := h.refreshRequestStatus(request.ID); err != nil {
+		h.logger.Error("Failed to update status of request %s: %v", request.ID, err)
 	}
 
 	h.logger.Info("Successfully forwarded request %s to %d/%d collectors", request.ID, successCount, len(stations))
-	return nil
+	return successCount, nil
+}
+
+// recordRoutedStation remembers that a request was sent to a station
+func (h *DataHandler) recordRoutedStation(requestID, stationID string) {
+	h.routedMutex.Lock()
+	defer h.routedMutex.Unlock()
+
+	// Drop routing information for old requests
+	for id, routed := range h.routedRequests {
+		if time.Since(routed.forwardedAt) > routedRequestTTL {
+			delete(h.routedRequests, id)
+		}
+	}
+
+	routed, exists := h.routedRequests[requestID]
+	if !exists {
+		routed = &routedRequest{stations: make(map[string]bool), forwardedAt: time.Now()}
+		h.routedRequests[requestID] = routed
+	}
+	routed.stations[stationID] = true
+}
+
+// wasRoutedTo reports whether a request has already been sent to a station
+func (h *DataHandler) wasRoutedTo(requestID, stationID string) bool {
+	h.routedMutex.Lock()
+	defer h.routedMutex.Unlock()
+
+	routed, exists := h.routedRequests[requestID]
+	return exists && routed.stations[stationID]
+}
+
+// RerouteRequest sends a request rejected by a station (e.g. because it is draining)
+// to another available station that hasn't already received it
+func (h *DataHandler) RerouteRequest(requestID, rejectedStation string) (string, error) {
+	if h.collectorHandler == nil {
+		return "", fmt.Errorf("CollectorHandler not set")
+	}
+
+	var request shared.DataRequest
+	var parameters, region, strategy sql.NullString
+	var regionFallback sql.NullBool
+	var duration sql.NullFloat64
+	query := `SELECT id, request_type, parameters, region, region_fallback, selection_strategy, duration_seconds, requested_by FROM data_requests WHERE id = ?`
+	if err := h.db.QueryRow(query, requestID).Scan(&request.ID, &request.RequestType, &parameters, &region, &regionFallback, &strategy, &duration, &request.RequestedBy); err != nil {
+		return "", fmt.Errorf("failed to load request: %w", err)
+	}
+	request.Parameters = parameters.String
+	request.RegionFallback = regionFallback.Bool
+	request.SelectionStrategy = strategy.String
+	request.DurationSeconds = duration.Float64
+	request.Timestamp = time.Now().Unix()
+	if region.Valid {
+		if err := json.Unmarshal([]byte(region.String), &request.Region); err != nil {
+			return "", fmt.Errorf("failed to load region of request: %w", err)
+		}
+	}
+
+	stations, err := h.getAvailableStations()
+	if err != nil {
+		return "", err
+	}
+	// Leave out the stations that already had the request before relaxing the region
+	var untried []string
+	for _, stationID := range stations {
+		if stationID != rejectedStation && !h.wasRoutedTo(requestID, stationID) {
+			untried = append(untried, stationID)
+		}
+	}
+	if stations, err = h.candidateStations(untried, request, 1, nil); err != nil {
+		return "", err
+	}
+
+	for _, stationID := range stations {
+		if err := h.collectorHandler.SendDataRequest(stationID, request); err != nil {
+			h.logger.Error("Failed to reroute request %s to station %s: %v", requestID, stationID, err)
+			continue
+		}
+
+		h.recordRoutedStation(requestID, stationID)
+		if err := h.addPendingResponse(requestID, stationID); err != nil {
+			h.logger.Error("Failed to track request %s for station %s: %v", requestID, stationID, err)
+		}
+		if err := h.refreshRequestStatus(requestID); err != nil {
+			h.logger.Error("Failed to update status of request %s: %v", requestID, err)
+		}
+		h.logger.Info("Rerouted request %s from station %s to station %s", requestID, rejectedStation, stationID)
+		return stationID, nil
+	}
+
+	return "", fmt.Errorf("no alternative station available")
 }
 
 // getAvailableStations returns a list of available station IDs
 func (h *DataHandler) getAvailableStations() ([]string, error) {
+	stations, _, err := h.stationAvailability()
+	return stations, err
+}
+
+// stationAvailability returns the available station IDs and why each other
+// connected station isn't available
+func (h *DataHandler) stationAvailability() ([]string, map[string]string, error) {
 	query := `
-		SELECT station_id
+		SELECT station_id, status, (julianday('now') - julianday(last_heartbeat)) * 86400,
+		       disk_free_bytes, clock_synchronized, image_ready
 		FROM collector_sessions
-		WHERE status = 'connected'
-		AND last_heartbeat > datetime('now', '-2 minutes')
+		WHERE status IN ('connected', 'draining', 'unhealthy')
 	`
 
 	rows, err := h.db.Query(query)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	var stations []string
+	unavailable := make(map[string]string)
 	for rows.Next() {
-		var stationID string
-		if err := rows.Scan(&stationID); err != nil {
+		var health stationHealth
+		var heartbeatAge float64
+		if err := rows.Scan(&health.StationID, &health.Status, &heartbeatAge, &health.DiskFreeBytes, &health.ClockSynchronized, &health.ImageReady); err != nil {
+			continue
+		}
+		health.HeartbeatAge = time.Duration(heartbeatAge * float64(time.Second))
+
+		if available, reason := h.isStationAvailable(health); !available {
+			h.logger.Debug("Station %s is connected but not available: %s", health.StationID, reason)
+			unavailable[health.StationID] = reason
 			continue
 		}
-		stations = append(stations, stationID)
+		stations = append(stations, health.StationID)
 	}
 
-	return stations, nil
+	return stations, unavailable, nil
 }
 
-// assignStation assigns a request to a specific station
-func (h *DataHandler) assignStation(requestID, stationID string) error {
+// addPendingResponse records that a request was sent to a station, so the
+// station counts towards the request's status before it responds
+func (h *DataHandler) addPendingResponse(requestID, stationID string) error {
+	query := `
+		INSERT INTO collector_responses (request_id, station_id, status)
+		VALUES (?, ?, 'pending')
+		ON CONFLICT(request_id, station_id) DO NOTHING
+	`
+	_, err := database.ExecWithRetry(h.db, query, requestID, stationID)
+	return err
+}
+
+// aggregateStatus summarizes a request's collector responses. The status is
+// "<ready>_of_<total>_ready" while stations are still working, and once all
+// of them have finished "complete", or "failed" if none of them delivered.
+func aggregateStatus(responses []CollectorResponse) (shared.RequestSummary, string) {
+	var summary shared.RequestSummary
+	for _, response := range responses {
+		switch response.Status {
+		case "rejected":
+			// The request was rerouted to another station, which is counted instead
+			continue
+		case "ready":
+			summary.Ready++
+		case "error":
+			summary.Error++
+		default:
+			summary.Pending++
+		}
+		summary.Total++
+	}
+	summary.Complete = summary.Total > 0 && summary.Pending == 0
+
+	switch {
+	case summary.Complete && summary.Ready == 0:
+		return summary, "failed"
+	case summary.Complete:
+		return summary, "complete"
+	}
+	return summary, fmt.Sprintf("%d_of_%d_ready", summary.Ready, summary.Total)
+}
+
+// refreshRequestStatus stores a request's aggregate status, and when it
+// completed, in data_requests
+func (h *DataHandler) refreshRequestStatus(requestID string) error {
+	return database.WithTx(h.db, func(tx *sql.Tx) error {
+		return updateRequestStatus(tx, requestID)
+	})
+}
+
+// updateRequestStatus aggregates a request's collector responses into its
+// status; reading the responses and writing the status in one transaction
+// keeps concurrent responses from storing a stale status
+func updateRequestStatus(q database.Queryer, requestID string) error {
+	responses, err := collectorResponses(q, requestID)
+	if err != nil {
+		return err
+	}
+	summary, status := aggregateStatus(responses)
+
+	// A cancelled request stays cancelled
 	query := `
 		UPDATE data_requests
-		SET assigned_station = ?, status = 'assigned'
-		WHERE id = ?
+		SET status = ?, completed_at = CASE WHEN ? THEN COALESCE(completed_at, CURRENT_TIMESTAMP) ELSE NULL END
+		WHERE id = ? AND status != 'cancelled'
 	`
-	_, err := h.db.Exec(query, stationID, requestID)
+	_, err = q.Exec(query, status, summary.Complete, requestID)
 	return err
 }
 
@@ -451,32 +1086,58 @@ func (h *DataHandler) UpdateDataRequestStatus(requestID, status, filePath string
 		SET status = ?, file_path = ?, file_size = ?, completed_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := h.db.Exec(query, status, filePath, fileSize, requestID)
+	_, err := database.ExecWithRetry(h.db, query, status, filePath, fileSize, requestID)
 	return err
 }
 
 // StoreCollectorResponse stores an individual collector response
 func (h *DataHandler) StoreCollectorResponse(requestID, stationID, status, filePath string, fileSize int64, errorMessage string) error {
 	query := `
-		INSERT OR REPLACE INTO collector_responses
+		INSERT INTO collector_responses
 		(request_id, station_id, status, file_path, file_size, error_message, completed_at)
 		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(request_id, station_id) DO UPDATE SET
+			status = excluded.status,
+			file_path = excluded.file_path,
+			file_size = excluded.file_size,
+			error_message = excluded.error_message,
+			completed_at = excluded.completed_at
 	`
-	_, err := h.db.Exec(query, requestID, stationID, status, filePath, fileSize, errorMessage)
+	// The response only counts once the request's status includes it
+	err := database.WithTx(h.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(query, requestID, stationID, status, filePath, fileSize, errorMessage); err != nil {
+			return err
+		}
+		return updateRequestStatus(tx, requestID)
+	})
 	if err != nil {
 		return err
 	}
+	h.signalRequestChanged(requestID)
+
+	// Nobody waits for a cancelled request's data
+	if h.isRequestCancelled(requestID) {
+		h.logger.Info("Not notifying subscribers of cancelled request %s about station %s", requestID, stationID)
+		return nil
+	}
 
 	// Send notification to receiver if data is ready
 	if status == "ready" {
 		h.logger.Info("Timestamp: Sending WebSocket notification to receiver at %s", time.Now().Format("2006-01-02 15:04:05.000"))
-		if err := h.NotifyReceiverDataReady(requestID, stationID); err != nil {
+		if err := h.deliverReady(requestID, stationID); err != nil {
 			h.logger.Error("Failed to notify receiver about ready data: %v", err)
 		} else {
 			h.logger.Info("Timestamp: WebSocket notification sent successfully at %s", time.Now().Format("2006-01-02 15:04:05.000"))
 		}
 	}
 
+	// Let the receiver know this collector failed so it doesn't wait for it
+	if status == "error" {
+		if err := h.NotifyReceiverCollectionError(requestID, stationID, errorMessage); err != nil {
+			h.logger.Error("Failed to notify receiver about collection error: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -487,20 +1148,25 @@ func (h *DataHandler) UpdateCollectorResponseURL(requestID, stationID, downloadU
 		SET download_url = ?
 		WHERE request_id = ? AND station_id = ?
 	`
-	_, err := h.db.Exec(query, downloadURL, requestID, stationID)
+	_, err := database.ExecWithRetry(h.db, query, downloadURL, requestID, stationID)
 	return err
 }
 
 // GetCollectorResponses returns all collector responses for a request
 func (h *DataHandler) GetCollectorResponses(requestID string) ([]CollectorResponse, error) {
+	return collectorResponses(h.db, requestID)
+}
+
+// collectorResponses reads a request's collector responses
+func collectorResponses(q database.Queryer, requestID string) ([]CollectorResponse, error) {
 	query := `
-		SELECT request_id, station_id, status, file_path, file_size, error_message, completed_at
+		SELECT request_id, station_id, status, file_path, file_size, error_message, completed_at, cached_path
 		FROM collector_responses
 		WHERE request_id = ?
 		ORDER BY completed_at ASC
 	`
 
-	rows, err := h.db.Query(query, requestID)
+	rows, err := q.Query(query, requestID)
 	if err != nil {
 		return nil, err
 	}
@@ -511,7 +1177,7 @@ func (h *DataHandler) GetCollectorResponses(requestID string) ([]CollectorRespon
 		var response CollectorResponse
 		var filePath, errorMessage sql.NullString
 		var fileSize sql.NullInt64
-		var completedAt sql.NullString
+		var completedAt, cachedPath sql.NullString
 
 		err := rows.Scan(
 			&response.RequestID,
@@ -521,6 +1187,7 @@ func (h *DataHandler) GetCollectorResponses(requestID string) ([]CollectorRespon
 			&fileSize,
 			&errorMessage,
 			&completedAt,
+			&cachedPath,
 		)
 		if err != nil {
 			continue
@@ -538,6 +1205,11 @@ func (h *DataHandler) GetCollectorResponses(requestID string) ([]CollectorRespon
 		if completedAt.Valid {
 			response.CompletedAt = completedAt.String
 		}
+		if cachedPath.Valid && cachedPath.String != "" {
+			response.Transfer = shared.TransferHTTP
+		} else {
+			response.Transfer = shared.TransferWebRTC
+		}
 
 		responses = append(responses, response)
 	}
@@ -605,6 +1277,7 @@ type CollectorResponse struct {
 	FileSize     int64  `json:"file_size,omitempty"`
 	ErrorMessage string `json:"error_message,omitempty"`
 	CompletedAt  string `json:"completed_at,omitempty"`
+	Transfer     string `json:"transfer,omitempty"` // shared.TransferWebRTC or shared.TransferHTTP
 }
 
 // RegisterCollectorSession registers a new collector session
@@ -613,18 +1286,46 @@ func (h *DataHandler) RegisterCollectorSession(stationID string) error {
 		INSERT OR REPLACE INTO collector_sessions (station_id, connected_at, last_heartbeat, status)
 		VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'connected')
 	`
-	_, err := h.db.Exec(query, stationID)
+	_, err := database.ExecWithRetry(h.db, query, stationID)
 	return err
 }
 
-// UpdateCollectorHeartbeat updates the last heartbeat for a collector
-func (h *DataHandler) UpdateCollectorHeartbeat(stationID string) error {
+// UpdateCollectorHeartbeat updates the last heartbeat for a collector and
+// the health and location it reports. A collector reporting "draining" or
+// "unhealthy" is marked as such so it is no longer selected for new requests;
+// any other status marks it connected again.
+func (h *DataHandler) UpdateCollectorHeartbeat(stationID string, heartbeat shared.HeartbeatMessage) error {
+	status := "connected"
+	if heartbeat.Status == "draining" || heartbeat.Status == "unhealthy" {
+		status = heartbeat.Status
+	}
+
+	var diskFree, clockSynchronized, imageReady interface{}
+	if heartbeat.DiskFreeBytes != nil {
+		diskFree = int64(*heartbeat.DiskFreeBytes)
+	}
+	if heartbeat.ClockSynchronized != nil {
+		clockSynchronized = *heartbeat.ClockSynchronized
+	}
+	if heartbeat.ImageReady != nil {
+		imageReady = *heartbeat.ImageReady
+	}
+	var latitude, longitude interface{}
+	if heartbeat.Location != nil {
+		if err := heartbeat.Location.Validate(); err != nil {
+			h.logger.Warn("Ignoring invalid location of station %s: %v", stationID, err)
+		} else {
+			latitude, longitude = heartbeat.Location.Latitude, heartbeat.Location.Longitude
+		}
+	}
+
 	query := `
 		UPDATE collector_sessions
-		SET last_heartbeat = CURRENT_TIMESTAMP
+		SET last_heartbeat = CURRENT_TIMESTAMP, status = ?, disk_free_bytes = ?, clock_synchronized = ?,
+		    image_ready = ?, latitude = ?, longitude = ?
 		WHERE station_id = ?
 	`
-	_, err := h.db.Exec(query, stationID)
+	_, err := database.ExecWithRetry(h.db, query, status, diskFree, clockSynchronized, imageReady, latitude, longitude, stationID)
 	return err
 }
 
@@ -658,6 +1359,12 @@ func (h *DataHandler) ReceiverWebSocketHandler(c *gin.Context) {
 	userID := fmt.Sprintf("%d", claims.UserID)
 	h.logger.Info("WebSocket authentication successful for user %s", claims.Email)
 
+	if !checkSubprotocol(c) {
+		h.logger.Warn("Rejecting receiver connection for user %s: unsupported WebSocket subprotocols %v",
+			userID, websocket.Subprotocols(c.Request))
+		return
+	}
+
 	// Upgrade to WebSocket
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -665,29 +1372,45 @@ func (h *DataHandler) ReceiverWebSocketHandler(c *gin.Context) {
 		return
 	}
 
-	h.logger.Info("WebSocket upgrade successful for user %s", userID)
+	receiver := &receiverConn{conn: conn}
+	receiver.markSeen()
 
-	// Don't set read deadline initially - let it be open
-	conn.SetWriteDeadline(time.Time{})  // No write deadline
-	conn.SetReadDeadline(time.Time{})   // No read deadline initially
+	// A receiver that stopped answering pings gives up its slot to a new one
+	pingInterval, pongTimeout := livenessIntervals(h.cfg)
+	if !h.receiverLimiter.Acquire() && !h.evictUnresponsiveReceiver(2*pingInterval) {
+		h.logger.Warn("Rejecting receiver connection for user %s: limit of %d reached", userID, h.cfg.Server.MaxReceiverConnections)
+		h.receiverLimiter.Reject(conn)
+		return
+	}
+	defer func() {
+		if !receiver.evicted.Load() {
+			h.receiverLimiter.Release()
+		}
+	}()
 
-	// Set up ping/pong handler
+	h.logger.Info("WebSocket upgrade successful for user %s", userID)
+
+	// Any pong or frame from the receiver proves the connection is alive
+	conn.SetWriteDeadline(time.Time{})
+	conn.SetReadDeadline(time.Now().Add(pongTimeout))
 	conn.SetPongHandler(func(string) error {
 		h.logger.Debug("Received pong from user %s", userID)
-		return nil
+		receiver.markSeen()
+		return conn.SetReadDeadline(time.Now().Add(pongTimeout))
 	})
 
 	h.connMutex.Lock()
-	h.receiverConns[userID] = conn
+	h.receiverConns[userID] = receiver
 	h.connMutex.Unlock()
 
-	h.logger.Info("Receiver WebSocket connected: %s", userID)
+	h.logger.Info("Receiver WebSocket connected: %s (subprotocol %s)", userID, shared.SubprotocolName(conn.Subprotocol()))
+
+	// Deliver what the user missed while no receiver was connected
+	h.flushPendingNotifications(userID)
 
 	// Handle connection cleanup
 	defer func() {
-		h.connMutex.Lock()
-		delete(h.receiverConns, userID)
-		h.connMutex.Unlock()
+		h.removeReceiverConn(userID, receiver)
 		conn.Close()
 		h.logger.Info("Receiver WebSocket disconnected: %s", userID)
 	}()
@@ -697,37 +1420,60 @@ func (h *DataHandler) ReceiverWebSocketHandler(c *gin.Context) {
 	
 	// Set up a channel to detect when connection is closed
 	connectionClosed := make(chan bool, 1)
+	signalClosed := func() {
+		select {
+		case connectionClosed <- true:
+		default:
+		}
+	}
 	
 	// Set up close handler
 	conn.SetCloseHandler(func(code int, text string) error {
 		h.logger.Debug("WebSocket close handler called for user %s: %d %s", userID, code, text)
-		connectionClosed <- true
+		signalClosed()
 		return nil
 	})
 
+	// Read (and discard) client frames so a dropped connection is noticed
+	// right away and its slot in the connection limit is freed
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					h.logger.Warn("Receiver of user %s missed liveness deadline (%v), closing connection", userID, pongTimeout)
+					h.receiverLimiter.Evicted()
+				} else {
+					h.logger.Debug("Receiver WebSocket read ended for user %s: %v", userID, err)
+				}
+				signalClosed()
+				return
+			}
+			receiver.markSeen()
+			conn.SetReadDeadline(time.Now().Add(pongTimeout))
+		}
+	}()
+
 	// Start a ping/pong based connection monitor
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
 				h.logger.Error("Recovered from panic in WebSocket monitor for user %s: %v", userID, r)
-				connectionClosed <- true
+				signalClosed()
 			}
 		}()
 		
-		pingTicker := time.NewTicker(30 * time.Second)
+		pingTicker := time.NewTicker(pingInterval)
 		defer pingTicker.Stop()
 		
 		for {
 			select {
 			case <-pingTicker.C:
 				// Send ping to check if connection is still alive
-				conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				if _, err := receiver.write(websocket.PingMessage, nil, 10*time.Second); err != nil {
 					h.logger.Debug("Failed to send ping to user %s: %v", userID, err)
-					connectionClosed <- true
+					signalClosed()
 					return
 				}
-				conn.SetWriteDeadline(time.Time{})
 				h.logger.Debug("Sent ping to user %s", userID)
 			}
 		}
@@ -739,100 +1485,150 @@ func (h *DataHandler) ReceiverWebSocketHandler(c *gin.Context) {
 }
 
 // NotifyReceiverDataReady sends a notification to a receiver when data is ready
-func (h *DataHandler) NotifyReceiverDataReady(requestID, stationID string) error {
-	// Get the user who made the request
-	userID, err := h.getUserForRequest(requestID)
+func (h *DataHandler) NotifyReceiverDataReady(requestID, stationID, transfer string) error {
+	h.logger.Debug("NotifyReceiverDataReady: requestID=%s, stationID=%s, transfer=%s", requestID, stationID, transfer)
+
+	payload := shared.DataReadyNotification{
+		RequestID: requestID,
+		StationID: stationID,
+		Transfer:  transfer,
+		Timestamp: time.Now().Unix(),
+	}
+	if transfer == shared.TransferHTTP {
+		payload.DownloadURL = fmt.Sprintf("/api/data/download/%s/%s", requestID, stationID)
+	}
+	notification := shared.ReceiverMessage{Type: "data_ready", Payload: payload}
+
+	h.notifyWebhook(requestID, notification)
+
+	sent, err := h.notifyRequestSubscribers(requestID, notification)
+	if sent > 0 {
+		h.logger.Info("Sent data ready notification to %d subscribers for request %s from station %s", sent, requestID, stationID)
+	}
+	return err
+}
+
+// NotifyReceiverCollectionError sends a notification to a receiver when a collector fails a request
+func (h *DataHandler) NotifyReceiverCollectionError(requestID, stationID, errorMessage string) error {
+	notification := shared.ReceiverMessage{
+		Type: "collection_error",
+		Payload: shared.CollectionErrorNotification{
+			RequestID: requestID,
+			StationID: stationID,
+			Error:     errorMessage,
+			Timestamp: time.Now().Unix(),
+		},
+	}
+
+	h.notifyWebhook(requestID, notification)
+
+	sent, err := h.notifyRequestSubscribers(requestID, notification)
+	if sent > 0 {
+		h.logger.Info("Sent collection error notification to %d subscribers for request %s from station %s", sent, requestID, stationID)
+	}
+	return err
+}
+
+// notifyRequestSubscribers sends a notification to every user subscribed to a request.
+// A failed write to one subscriber doesn't stop the others from being notified;
+// the errors are combined and returned along with the number of successful sends.
+// Subscribers without a connected receiver have the notification queued.
+func (h *DataHandler) notifyRequestSubscribers(requestID string, notification interface{}) (int, error) {
+	userIDs, err := h.getUsersForRequest(requestID)
 	if err != nil {
-		return fmt.Errorf("failed to get user for request: %w", err)
+		return 0, fmt.Errorf("failed to get users for request: %w", err)
 	}
 
-	h.logger.Debug("NotifyReceiverDataReady: requestID=%s, stationID=%s, userID=%s", requestID, stationID, userID)
+	sentCount := 0
+	var errs []error
+	for _, userID := range userIDs {
+		sent, err := h.sendReceiverNotification(userID, notification)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", userID, err))
+		}
+		if sent {
+			sentCount++
+			continue
+		}
 
-	h.connMutex.RLock()
-	conn, exists := h.receiverConns[userID]
-	h.logger.Debug("WebSocket connections available: %v", func() []string {
-		var keys []string
-		for k := range h.receiverConns {
-			keys = append(keys, k)
+		// Receivers that aren't connected get it when they reconnect
+		if err := h.queueNotification(userID, requestID, notification); err != nil {
+			errs = append(errs, fmt.Errorf("user %s: failed to queue notification: %w", userID, err))
 		}
-		return keys
-	}())
-	h.connMutex.RUnlock()
+	}
 
-	if !exists {
+	return sentCount, errors.Join(errs...)
+}
+
+// sendReceiverNotification writes a notification to the user's receiver WebSocket.
+// It reports false without an error when the user has no active connection.
+func (h *DataHandler) sendReceiverNotification(userID string, notification interface{}) (bool, error) {
+	sent, err := h.writeToReceiver(userID, notification)
+	if err != nil {
+		h.logger.Error("Failed to send notification to user %s: %v", userID, err)
+	} else if !sent {
 		h.logger.Debug("No active WebSocket connection for user %s", userID)
-		return nil
 	}
+	return sent, err
+}
 
-	notification := map[string]interface{}{
-		"type":       "data_ready",
-		"request_id": requestID,
-		"station_id": stationID,
-		"timestamp":  time.Now().Unix(),
+// getUsersForRequest retrieves the IDs of all users subscribed to a request.
+// The original requester is always included, even for requests created before
+// subscriptions were tracked.
+func (h *DataHandler) getUsersForRequest(requestID string) ([]string, error) {
+	query := `
+		SELECT requested_by FROM data_requests WHERE id = ?
+		UNION
+		SELECT user_id FROM request_subscribers WHERE request_id = ?
+	`
+	rows, err := h.db.Query(query, requestID, requestID)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Set write deadline to avoid blocking
-	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-	
-	if err := conn.WriteJSON(notification); err != nil {
-		h.logger.Error("Failed to send notification to user %s: %v", userID, err)
-		// Remove the connection if it's broken
-		h.connMutex.Lock()
-		delete(h.receiverConns, userID)
-		h.connMutex.Unlock()
-		return err
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-	
-	// Clear write deadline
-	conn.SetWriteDeadline(time.Time{})
 
-	h.logger.Info("Sent data ready notification to user %s for request %s from station %s", userID, requestID, stationID)
-	return nil
-}
+	h.logger.Debug("getUsersForRequest: requestID=%s, userIDs=%v", requestID, userIDs)
 
-// getUserForRequest retrieves the user ID for a given request ID
-func (h *DataHandler) getUserForRequest(requestID string) (string, error) {
-	query := `SELECT requested_by FROM data_requests WHERE id = ?`
-	var userID string
-	err := h.db.QueryRow(query, requestID).Scan(&userID)
-	h.logger.Debug("getUserForRequest: requestID=%s, userID=%s, err=%v", requestID, userID, err)
-	return userID, err
+	if len(userIDs) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return userIDs, nil
 }
 
 // NotifyReceiverOfICEOffer sends a WebSocket notification to a receiver about a new ICE offer
 func (h *DataHandler) NotifyReceiverOfICEOffer(userID int, sessionID, offerSDP string) error {
 	userIDStr := fmt.Sprintf("%d", userID)
-	
-	h.connMutex.RLock()
-	conn, exists := h.receiverConns[userIDStr]
-	h.connMutex.RUnlock()
 
-	if !exists {
-		h.logger.Debug("No active WebSocket connection for user %d", userID)
-		return nil
+	notification := shared.ReceiverMessage{
+		Type: "ice_offer",
+		Payload: shared.ICEOfferNotification{
+			SessionID: sessionID,
+			OfferSDP:  offerSDP,
+			Timestamp: time.Now().Unix(),
+		},
 	}
 
-	notification := map[string]interface{}{
-		"type":       "ice_offer",
-		"session_id": sessionID,
-		"offer_sdp":  offerSDP,
-		"timestamp":  time.Now().Unix(),
-	}
-
-	// Set write deadline to avoid blocking
-	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-	
-	if err := conn.WriteJSON(notification); err != nil {
+	sent, err := h.writeToReceiver(userIDStr, notification)
+	if err != nil {
 		h.logger.Error("Failed to send ICE offer notification to user %d: %v", userID, err)
-		// Remove the connection if it's broken
-		h.connMutex.Lock()
-		delete(h.receiverConns, userIDStr)
-		h.connMutex.Unlock()
 		return err
 	}
-	
-	// Clear write deadline
-	conn.SetWriteDeadline(time.Time{})
+	if !sent {
+		h.logger.Debug("No active WebSocket connection for user %d", userID)
+		return nil
+	}
 
 	h.logger.Info("Sent ICE offer notification to user %d for session %s", userID, sessionID)
 	return nil
@@ -849,6 +1645,16 @@ func (h *DataHandler) NotifyCollectorOfICEAnswer(stationID, sessionID, answerSDP
 	return nil
 }
 
+// NotifyCollectorOfICERestart asks a collector to restart ICE for a session
+func (h *DataHandler) NotifyCollectorOfICERestart(stationID, sessionID string) error {
+	if h.collectorHandler != nil {
+		return h.collectorHandler.NotifyCollectorOfICERestart(stationID, sessionID)
+	}
+
+	h.logger.Debug("CollectorHandler not available to send ICE restart notification")
+	return nil
+}
+
 // NotifyCollectorOfICECandidate sends a WebSocket notification to a collector about a new ICE candidate
 func (h *DataHandler) NotifyCollectorOfICECandidate(stationID, sessionID string, candidate *models.ICECandidate) error {
 	// We need to send this to the collector handler since collectors connect there
@@ -863,39 +1669,21 @@ func (h *DataHandler) NotifyCollectorOfICECandidate(stationID, sessionID string,
 // NotifyReceiverOfICECandidate sends a WebSocket notification to a receiver about a new ICE candidate
 func (h *DataHandler) NotifyReceiverOfICECandidate(userID int, sessionID string, candidate *models.ICECandidate) error {
 	userIDStr := fmt.Sprintf("%d", userID)
-	
-	h.connMutex.RLock()
-	conn, exists := h.receiverConns[userIDStr]
-	h.connMutex.RUnlock()
-
-	if !exists {
-		h.logger.Debug("No active WebSocket connection for user %d", userID)
-		return nil
-	}
 
-	notification := map[string]interface{}{
-		"type":          "ice_candidate",
-		"session_id":    sessionID,
-		"candidate":     candidate.Candidate,
-		"sdp_mline_index": candidate.SDPMLineIndex,
-		"sdp_mid":       candidate.SDPMid,
-		"timestamp":     time.Now().Unix(),
+	notification := shared.ReceiverMessage{
+		Type:    "ice_candidate",
+		Payload: shared.NewICECandidateNotification(sessionID, candidate),
 	}
 
-	// Set write deadline to avoid blocking
-	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-	
-	if err := conn.WriteJSON(notification); err != nil {
+	sent, err := h.writeToReceiver(userIDStr, notification)
+	if err != nil {
 		h.logger.Error("Failed to send ICE candidate notification to user %d: %v", userID, err)
-		// Remove the connection if it's broken
-		h.connMutex.Lock()
-		delete(h.receiverConns, userIDStr)
-		h.connMutex.Unlock()
 		return err
 	}
-	
-	// Clear write deadline
-	conn.SetWriteDeadline(time.Time{})
+	if !sent {
+		h.logger.Debug("No active WebSocket connection for user %d", userID)
+		return nil
+	}
 
 	h.logger.Info("Sent ICE candidate notification to user %d for session %s", userID, sessionID)
 	return nil
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"argus-sdr/internal/shared"
+)
+
+// etaSampleSize is how many of a station's latest completed requests its
+// collection time is averaged over
+const etaSampleSize = 20
+
+// estimateCollectionTime estimates how long a station takes to deliver a
+// request of the given type and capture duration, from how long its latest
+// ones took between the request being made and the file being ready, less
+// the duration they asked for. Stations without history get the average of
+// all stations. It returns false when there is no history at all, and for
+// streams, which run until they are stopped.
+func (h *DataHandler) estimateCollectionTime(stationID, requestType string, durationSeconds float64) (time.Duration, bool) {
+	if requestType == shared.RequestTypeStream {
+		return 0, false
+	}
+
+	// Requests without a duration_seconds captured for however long their
+	// image or parameters said, which stays part of the overhead
+	query := `
+		SELECT AVG(seconds) FROM (
+			SELECT (julianday(cr.completed_at) - julianday(dr.created_at)) * 86400 - COALESCE(dr.duration_seconds, 0) AS seconds
+			FROM collector_responses cr
+			JOIN data_requests dr ON dr.id = cr.request_id
+			WHERE cr.status = 'ready' AND cr.completed_at IS NOT NULL
+			AND dr.request_type = ? AND (? = '' OR cr.station_id = ?)
+			ORDER BY cr.completed_at DESC
+			LIMIT ?
+		)
+	`
+
+	for _, station := range []string{stationID, ""} {
+		var seconds sql.NullFloat64
+		if err := h.db.QueryRow(query, requestType, station, station, etaSampleSize).Scan(&seconds); err != nil {
+			h.logger.Warn("Failed to estimate collection time for station %s: %v", stationID, err)
+			return 0, false
+		}
+		if seconds.Valid {
+			return time.Duration((math.Max(seconds.Float64, 0) + durationSeconds) * float64(time.Second)).Round(time.Second), true
+		}
+	}
+	return 0, false
+}
+
+// estimateReadyAt estimates when each station still working on a request made
+// at requestedAt will be ready, and when the last of them will be. It returns
+// a zero time when nothing can be estimated.
+func (h *DataHandler) estimateReadyAt(requestType string, durationSeconds float64, requestedAt time.Time, responses []CollectorResponse) (time.Time, map[string]time.Time) {
+	var last time.Time
+	stations := make(map[string]time.Time)
+	for _, response := range responses {
+		switch response.Status {
+		case "ready", "error", "rejected":
+			continue
+		}
+		estimate, ok := h.estimateCollectionTime(response.StationID, requestType, durationSeconds)
+		if !ok {
+			continue
+		}
+		readyAt := requestedAt.Add(estimate)
+		stations[response.StationID] = readyAt
+		if readyAt.After(last) {
+			last = readyAt
+		}
+	}
+	return last, stations
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"argus-sdr/internal/shared"
+	"argus-sdr/pkg/config"
+)
+
+// pendingUploadKey identifies a fan-out upload the server is waiting for
+func pendingUploadKey(requestID, stationID string) string {
+	return requestID + "/" + stationID
+}
+
+// deliverReady tells subscribers a collector's file is ready. Files already in
+// the server cache are always served over HTTP. Otherwise, when the request
+// should fan out, the collector is asked to upload the file first and
+// subscribers are notified once it arrives; if that isn't possible they fall
+// back to a WebRTC transfer from the collector.
+func (h *DataHandler) deliverReady(requestID, stationID string) error {
+	cached, err := h.isCached(requestID, stationID)
+	if err != nil {
+		h.logger.Warn("Failed to check cache for request %s from station %s: %v", requestID, stationID, err)
+	}
+	if cached {
+		return h.NotifyReceiverDataReady(requestID, stationID, shared.TransferHTTP)
+	}
+
+	fanOut, err := h.shouldFanOut(requestID)
+	if err != nil {
+		h.logger.Warn("Failed to decide fan-out for request %s: %v", requestID, err)
+	}
+	if fanOut {
+		err := h.requestUpload(requestID, stationID)
+		if err == nil {
+			return nil
+		}
+		h.logger.Warn("Could not request upload for request %s from station %s, using WebRTC: %v", requestID, stationID, err)
+	}
+
+	return h.NotifyReceiverDataReady(requestID, stationID, shared.TransferWebRTC)
+}
+
+// shouldFanOut reports whether a request's files should be served from the
+// server cache rather than peer-to-peer
+func (h *DataHandler) shouldFanOut(requestID string) (bool, error) {
+	if h.storage == nil {
+		return false, nil
+	}
+
+	switch h.cfg.Server.FanOutMode {
+	case config.FanOutAlways:
+		return true, nil
+	case config.FanOutNever:
+		return false, nil
+	}
+
+	// Auto: one receiver is served directly; several share a single upload
+	userIDs, err := h.getUsersForRequest(requestID)
+	if err != nil {
+		return false, err
+	}
+	return len(userIDs) > 1, nil
+}
+
+// isCached reports whether a collector's file for a request is in the server cache
+func (h *DataHandler) isCached(requestID, stationID string) (bool, error) {
+	var cachedPath sql.NullString
+	err := h.db.QueryRow(
+		"SELECT cached_path FROM collector_responses WHERE request_id = ? AND station_id = ?",
+		requestID, stationID,
+	).Scan(&cachedPath)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return cachedPath.Valid && cachedPath.String != "", nil
+}
+
+// requestUpload asks a collector to upload its file and starts the timer that
+// falls back to WebRTC if the upload doesn't arrive in time
+func (h *DataHandler) requestUpload(requestID, stationID string) error {
+	if h.collectorHandler == nil {
+		return fmt.Errorf("CollectorHandler not set")
+	}
+
+	timeout := time.Duration(h.cfg.Server.FanOutUploadTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+
+	key := pendingUploadKey(requestID, stationID)
+	h.uploadsMutex.Lock()
+	if _, pending := h.pendingUploads[key]; pending {
+		h.uploadsMutex.Unlock()
+		return nil
+	}
+	h.pendingUploads[key] = time.AfterFunc(timeout, func() {
+		if h.takePendingUpload(requestID, stationID) {
+			h.logger.Warn("Upload for request %s from station %s not received within %v, using WebRTC", requestID, stationID, timeout)
+			h.notifyReady(requestID, stationID, shared.TransferWebRTC)
+		}
+	})
+	h.uploadsMutex.Unlock()
+
+	if err := h.collectorHandler.RequestUpload(stationID, requestID); err != nil {
+		h.takePendingUpload(requestID, stationID)
+		return err
+	}
+
+	h.logger.Info("Requested upload of request %s from station %s for fan-out", requestID, stationID)
+	return nil
+}
+
+// takePendingUpload removes a pending fan-out upload, reporting whether it existed
+func (h *DataHandler) takePendingUpload(requestID, stationID string) bool {
+	key := pendingUploadKey(requestID, stationID)
+
+	h.uploadsMutex.Lock()
+	defer h.uploadsMutex.Unlock()
+
+	timer, pending := h.pendingUploads[key]
+	if pending {
+		timer.Stop()
+		delete(h.pendingUploads, key)
+	}
+	return pending
+}
+
+// UploadCompleted notifies subscribers waiting on a fan-out upload that the
+// file can now be downloaded from the server
+func (h *DataHandler) UploadCompleted(requestID, stationID string) {
+	if h.takePendingUpload(requestID, stationID) {
+		h.notifyReady(requestID, stationID, shared.TransferHTTP)
+	}
+}
+
+// UploadFailed falls back to WebRTC when a collector couldn't do a fan-out upload
+func (h *DataHandler) UploadFailed(requestID, stationID, reason string) {
+	if h.takePendingUpload(requestID, stationID) {
+		h.logger.Warn("Station %s could not upload request %s (%s), using WebRTC", stationID, requestID, reason)
+		h.notifyReady(requestID, stationID, shared.TransferWebRTC)
+	}
+}
+
+// notifyReady sends a data ready notification, logging any failure
+func (h *DataHandler) notifyReady(requestID, stationID, transfer string) {
+	if err := h.NotifyReceiverDataReady(requestID, stationID, transfer); err != nil {
+		h.logger.Error("Failed to notify receiver about ready data: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"argus-sdr/internal/geometry"
+	"argus-sdr/internal/shared"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errNoStationsInRegion is returned when none of the available stations is in a request's region
+var errNoStationsInRegion = errors.New("no stations available in the requested region")
+
+// stationLocation is a station and where its collector says it is
+type stationLocation struct {
+	StationID string `json:"station_id"`
+	geometry.Position
+}
+
+// GetStationGeometry handles GET /api/stations/geometry. It rates how well the
+// stations listed in station_ids (comma separated) can locate a transmitter by
+// TDOA, or without station_ids, the stations a new request would be sent to,
+// with the request's selection_strategy if given.
+// A set is usable when at least 3 of its stations report a location, its GDOP
+// is at most STATION_GEOMETRY_MAX_GDOP and no two stations are closer than
+// STATION_GEOMETRY_MIN_BASELINE_METERS; otherwise reason says why not.
+func (h *DataHandler) GetStationGeometry(c *gin.Context) {
+	var stationIDs []string
+	if param, ok := c.GetQuery("station_ids"); ok {
+		seen := make(map[string]bool)
+		for _, id := range strings.Split(param, ",") {
+			if id = strings.TrimSpace(id); id != "" && !seen[id] {
+				seen[id] = true
+				stationIDs = append(stationIDs, id)
+			}
+		}
+		if len(stationIDs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "station_ids must list at least one station"})
+			return
+		}
+	} else {
+		strategy := c.Query("selection_strategy")
+		if !shared.IsValidSelectionStrategy(strategy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown selection_strategy %q", strategy), "selection_strategies": shared.SelectionStrategies})
+			return
+		}
+		stations, err := h.getAvailableStations()
+		if err != nil {
+			h.logger.Error("Failed to get available stations: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get available stations"})
+			return
+		}
+		h.rankStations(stations, strategy)
+		if len(stations) > maxCollectorsPerRequest {
+			stations = stations[:maxCollectorsPerRequest]
+		}
+		stationIDs = stations
+	}
+
+	response, err := h.rateGeometry(stationIDs)
+	if err != nil {
+		h.logger.Error("Failed to rate station geometry: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rate station geometry"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// rateGeometry rates how well stations can locate a transmitter by TDOA, as
+// described at GetStationGeometry
+func (h *DataHandler) rateGeometry(stationIDs []string) (gin.H, error) {
+	locations, err := h.stationLocations(stationIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get station locations: %w", err)
+	}
+
+	stations := []stationLocation{}
+	missing := []string{}
+	var positions []geometry.Position
+	for _, id := range stationIDs {
+		position, ok := locations[id]
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+		stations = append(stations, stationLocation{StationID: id, Position: position})
+		positions = append(positions, position)
+	}
+
+	response := gin.H{
+		"stations":          stations,
+		"missing_locations": missing,
+		"gdop":              nil,
+		"min_baseline_m":    nil,
+		"max_baseline_m":    nil,
+		"score":             0.0,
+		"usable":            false,
+	}
+
+	if len(positions) < 3 {
+		reason := fmt.Sprintf("only %d stations report a location, at least 3 are needed", len(positions))
+		if len(stationIDs) < 3 {
+			reason = fmt.Sprintf("only %d stations, at least 3 are needed", len(stationIDs))
+		}
+		response["reason"] = reason
+		return response, nil
+	}
+
+	assessment, err := geometry.Assess(positions)
+	if err != nil {
+		// Locations are validated when they are stored
+		return nil, fmt.Errorf("failed to assess station geometry: %w", err)
+	}
+	response["min_baseline_m"] = math.Round(assessment.MinBaseline)
+	response["max_baseline_m"] = math.Round(assessment.MaxBaseline)
+	response["score"] = assessment.Score
+	if !math.IsInf(assessment.GDOP, 1) {
+		response["gdop"] = assessment.GDOP
+	}
+
+	maxGDOP := float64(h.cfg.Server.StationGeometryMaxGDOP)
+	minBaseline := float64(h.cfg.Server.StationGeometryMinBaseline)
+	switch {
+	case math.IsInf(assessment.GDOP, 1):
+		response["reason"] = "stations are collinear or at the same place"
+	case assessment.MinBaseline < minBaseline:
+		response["reason"] = fmt.Sprintf("two stations are only %.0f m apart, at least %.0f m are needed", assessment.MinBaseline, minBaseline)
+	case assessment.GDOP > maxGDOP:
+		response["reason"] = fmt.Sprintf("GDOP %.1f is above %.0f, the stations are too close to a line", assessment.GDOP, maxGDOP)
+	default:
+		response["usable"] = true
+		if len(missing) > 0 {
+			response["reason"] = fmt.Sprintf("rated without %d stations that don't report a location", len(missing))
+		}
+	}
+
+	return response, nil
+}
+
+// stationLocations returns the last location each of the given stations
+// reported; stations that never reported one are left out
+func (h *DataHandler) stationLocations(stationIDs []string) (map[string]geometry.Position, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(stationIDs)), ",")
+	args := make([]interface{}, len(stationIDs))
+	for i, id := range stationIDs {
+		args[i] = id
+	}
+
+	rows, err := h.db.Query(`
+		SELECT station_id, latitude, longitude
+		FROM collector_sessions
+		WHERE latitude IS NOT NULL AND longitude IS NOT NULL AND station_id IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := make(map[string]geometry.Position)
+	for rows.Next() {
+		var id string
+		var position geometry.Position
+		if err := rows.Scan(&id, &position.Latitude, &position.Longitude); err != nil {
+			return nil, err
+		}
+		locations[id] = position
+	}
+	return locations, rows.Err()
+}
+
+// stationsInRegion returns the stations, in order, whose last reported
+// location is inside a region. Stations that never reported a location can't
+// be placed, so they are left out.
+func (h *DataHandler) stationsInRegion(stationIDs []string, region geometry.Region) ([]string, error) {
+	if len(stationIDs) == 0 {
+		return nil, nil
+	}
+	locations, err := h.stationLocations(stationIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var inside []string
+	for _, id := range stationIDs {
+		if position, ok := locations[id]; ok && region.Contains(position) {
+			inside = append(inside, id)
+		}
+	}
+	return inside, nil
+}
@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"argus-sdr/internal/database"
+	"argus-sdr/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Formats request history can be exported in
+const (
+	exportFormatJSON = "json"
+	exportFormatCSV  = "csv"
+)
+
+// exportPageSize is how many requests an export reads at a time. Each page is
+// read in full before it is written, so a slow client doesn't keep the
+// database locked.
+const exportPageSize = 200
+
+// requestPurgeInterval is how often requests past REQUEST_RETENTION_DAYS are deleted
+const requestPurgeInterval = time.Hour
+
+// exportCSVHeader names the columns of a CSV export, which has a row per
+// collector response, or one without station columns for requests no
+// collector responded to
+var exportCSVHeader = []string{
+	"request_id", "user_id", "email", "request_type", "status", "format", "image",
+	"duration_seconds", "selection_strategy", "parameters", "region", "created_at", "completed_at",
+	"station_id", "station_status", "file_size", "sha256", "error", "capture_metadata", "station_completed_at",
+}
+
+// historyFilter selects the requests an export covers
+type historyFilter struct {
+	UserID int    // 0 for all users
+	From   string // first day (YYYY-MM-DD, UTC) requests were made on; empty for no limit
+	To     string // last day, inclusive
+}
+
+// exportedRequest is a data request in a history export
+type exportedRequest struct {
+	RequestID         string             `json:"request_id"`
+	UserID            int                `json:"user_id"`
+	Email             string             `json:"email,omitempty"`
+	RequestType       string             `json:"request_type"`
+	Status            string             `json:"status"`
+	Format            string             `json:"format,omitempty"`
+	Image             string             `json:"image,omitempty"`
+	DurationSeconds   float64            `json:"duration_seconds,omitempty"`
+	SelectionStrategy string             `json:"selection_strategy,omitempty"`
+	Parameters        json.RawMessage    `json:"parameters,omitempty"`
+	Region            json.RawMessage    `json:"region,omitempty"`
+	CreatedAt         string             `json:"created_at"`
+	CompletedAt       string             `json:"completed_at,omitempty"`
+	Responses         []exportedResponse `json:"responses"`
+
+	rowid int64
+}
+
+// exportedResponse is a collector's response to an exported request
+type exportedResponse struct {
+	StationID       string          `json:"station_id"`
+	Status          string          `json:"status"`
+	FileSize        int64           `json:"file_size,omitempty"`
+	SHA256          string          `json:"sha256,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	CaptureMetadata json.RawMessage `json:"capture_metadata,omitempty"`
+	CompletedAt     string          `json:"completed_at,omitempty"`
+}
+
+// historyWriter writes the requests of an export as they are read
+type historyWriter interface {
+	Write(request exportedRequest) error
+	// Close ends the export
+	Close() error
+}
+
+// jsonHistoryWriter writes an export as a JSON array of requests
+type jsonHistoryWriter struct {
+	w       gin.ResponseWriter
+	encoder *json.Encoder
+	written bool
+}
+
+func newJSONHistoryWriter(w gin.ResponseWriter) *jsonHistoryWriter {
+	return &jsonHistoryWriter{w: w, encoder: json.NewEncoder(w)}
+}
+
+// Write implements historyWriter
+func (j *jsonHistoryWriter) Write(request exportedRequest) error {
+	separator := ","
+	if !j.written {
+		separator = "["
+		j.written = true
+	}
+	if _, err := j.w.WriteString(separator); err != nil {
+		return err
+	}
+	return j.encoder.Encode(request)
+}
+
+// Close implements historyWriter
+func (j *jsonHistoryWriter) Close() error {
+	end := "]\n"
+	if !j.written {
+		end = "[]\n"
+	}
+	_, err := j.w.WriteString(end)
+	return err
+}
+
+// csvHistoryWriter writes an export as CSV, a row per collector response
+type csvHistoryWriter struct {
+	w *csv.Writer
+}
+
+func newCSVHistoryWriter(w gin.ResponseWriter) (*csvHistoryWriter, error) {
+	writer := &csvHistoryWriter{w: csv.NewWriter(w)}
+	return writer, writer.w.Write(exportCSVHeader)
+}
+
+// Write implements historyWriter
+func (c *csvHistoryWriter) Write(request exportedRequest) error {
+	row := []string{
+		request.RequestID, strconv.Itoa(request.UserID), request.Email, request.RequestType, request.Status,
+		request.Format, request.Image, formatDuration(request.DurationSeconds), request.SelectionStrategy,
+		string(request.Parameters), string(request.Region), request.CreatedAt, request.CompletedAt,
+	}
+	if len(request.Responses) == 0 {
+		if err := c.w.Write(append(row, "", "", "", "", "", "", "")); err != nil {
+			return err
+		}
+	}
+	for _, response := range request.Responses {
+		fileSize := ""
+		if response.FileSize > 0 {
+			fileSize = strconv.FormatInt(response.FileSize, 10)
+		}
+		record := append(append([]string{}, row...),
+			response.StationID, response.Status, fileSize, response.SHA256, response.Error,
+			string(response.CaptureMetadata), response.CompletedAt,
+		)
+		if err := c.w.Write(record); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// Close implements historyWriter
+func (c *csvHistoryWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// formatDuration formats a capture duration for CSV, empty if none was asked for
+func formatDuration(seconds float64) string {
+	if seconds == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(seconds, 'f', -1, 64)
+}
+
+// exportTime formats a stored timestamp for an export
+func exportTime(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.UTC().Format(time.RFC3339)
+}
+
+// exportJSON keeps stored JSON as it is, dropping anything else
+func exportJSON(value string) json.RawMessage {
+	if value == "" || !json.Valid([]byte(value)) {
+		return nil
+	}
+	return json.RawMessage(value)
+}
+
+// bindHistoryFilter reads the format, from and to query parameters of an
+// export. If they are invalid, it responds and returns false.
+func bindHistoryFilter(c *gin.Context) (historyFilter, string, bool) {
+	format := c.DefaultQuery("format", exportFormatJSON)
+	if format != exportFormatJSON && format != exportFormatCSV {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("format must be %q or %q", exportFormatJSON, exportFormatCSV)})
+		return historyFilter{}, "", false
+	}
+
+	var filter historyFilter
+	for _, param := range []struct {
+		name  string
+		value *string
+	}{
+		{"from", &filter.From},
+		{"to", &filter.To},
+	} {
+		*param.value = c.Query(param.name)
+		if *param.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", *param.value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be a date (YYYY-MM-DD)", param.name)})
+			return historyFilter{}, "", false
+		}
+	}
+	if filter.From != "" && filter.To != "" && filter.From > filter.To {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return historyFilter{}, "", false
+	}
+	return filter, format, true
+}
+
+// historyPage reads up to exportPageSize requests matching filter made after
+// the one with rowid after, with their collector responses
+func historyPage(db *sql.DB, filter historyFilter, after int64) ([]exportedRequest, error) {
+	rows, err := db.Query(`
+		SELECT r.rowid, r.id, r.requested_by, COALESCE(u.email, ''), r.request_type, COALESCE(r.status, ''),
+			COALESCE(r.format, ''), COALESCE(r.image, ''), COALESCE(r.duration_seconds, 0),
+			COALESCE(r.selection_strategy, ''), COALESCE(r.parameters, ''), COALESCE(r.region, ''),
+			r.created_at, r.completed_at
+		FROM data_requests r
+		LEFT JOIN users u ON u.id = r.requested_by
+		WHERE r.rowid > ? AND (? = 0 OR r.requested_by = ?)
+			AND (? = '' OR r.created_at >= ?)
+			AND (? = '' OR r.created_at < date(?, '+1 day'))
+		ORDER BY r.rowid
+		LIMIT ?
+	`, after, filter.UserID, filter.UserID, filter.From, filter.From, filter.To, filter.To, exportPageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []exportedRequest
+	index := make(map[string]int)
+	for rows.Next() {
+		var request exportedRequest
+		var parameters, region string
+		var createdAt, completedAt sql.NullTime
+		if err := rows.Scan(
+			&request.rowid, &request.RequestID, &request.UserID, &request.Email, &request.RequestType, &request.Status,
+			&request.Format, &request.Image, &request.DurationSeconds,
+			&request.SelectionStrategy, &parameters, &region,
+			&createdAt, &completedAt,
+		); err != nil {
+			return nil, err
+		}
+		request.Parameters = exportJSON(parameters)
+		request.Region = exportJSON(region)
+		request.CreatedAt = exportTime(createdAt)
+		request.CompletedAt = exportTime(completedAt)
+		request.Responses = []exportedResponse{}
+		index[request.RequestID] = len(requests)
+		requests = append(requests, request)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]interface{}, 0, len(requests))
+	for _, request := range requests {
+		ids = append(ids, request.RequestID)
+	}
+	responseRows, err := db.Query(fmt.Sprintf(`
+		SELECT request_id, station_id, status, COALESCE(file_size, 0), COALESCE(sha256, ''),
+			COALESCE(error_message, ''), COALESCE(capture_metadata, ''), completed_at
+		FROM collector_responses
+		WHERE request_id IN (%s)
+		ORDER BY request_id, station_id
+	`, strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")), ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer responseRows.Close()
+
+	for responseRows.Next() {
+		var requestID, captureMetadata string
+		var response exportedResponse
+		var completedAt sql.NullTime
+		if err := responseRows.Scan(
+			&requestID, &response.StationID, &response.Status, &response.FileSize, &response.SHA256,
+			&response.Error, &captureMetadata, &completedAt,
+		); err != nil {
+			return nil, err
+		}
+		response.CaptureMetadata = exportJSON(captureMetadata)
+		response.CompletedAt = exportTime(completedAt)
+		i := index[requestID]
+		requests[i].Responses = append(requests[i].Responses, response)
+	}
+	return requests, responseRows.Err()
+}
+
+// exportHistory streams the requests matching filter, with their collector
+// responses, in the order they were made. An error before anything was
+// written is answered with 500; later ones can only cut the export short.
+func exportHistory(c *gin.Context, db *sql.DB, log *logger.Logger, filter historyFilter, format string) {
+	page, err := historyPage(db, filter, 0)
+	if err != nil {
+		log.Error("Failed to export request history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export requests"})
+		return
+	}
+
+	filename := "requests." + format
+	var writer historyWriter
+	if format == exportFormatCSV {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+	}
+	c.Header("Content-Disposition", attachment(filename))
+	c.Status(http.StatusOK)
+	if format == exportFormatCSV {
+		writer, err = newCSVHistoryWriter(c.Writer)
+	} else {
+		writer = newJSONHistoryWriter(c.Writer)
+	}
+
+	exported := 0
+	for err == nil && len(page) > 0 {
+		for _, request := range page {
+			if err = writer.Write(request); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+		exported += len(page)
+		c.Writer.Flush()
+		if len(page) < exportPageSize {
+			break
+		}
+		page, err = historyPage(db, filter, page[len(page)-1].rowid)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		log.Error("Request history export cut short after %d requests: %v", exported, err)
+		return
+	}
+	log.Debug("Exported %d requests as %s", exported, format)
+}
+
+// ExportRequests handles GET /api/data/export, streaming the user's requests
+// with their collector responses and capture metadata as JSON or CSV,
+// optionally only those made from one day to another
+func (h *DataHandler) ExportRequests(c *gin.Context) {
+	filter, format, ok := bindHistoryFilter(c)
+	if !ok {
+		return
+	}
+	filter.UserID = c.GetInt("user_id")
+	exportHistory(c, h.db, h.logger, filter, format)
+}
+
+// ExportRequests handles GET /api/admin/export, streaming the requests of all
+// users, or of the one in user_id, like GET /api/data/export
+func (h *AdminHandler) ExportRequests(c *gin.Context) {
+	filter, format, ok := bindHistoryFilter(c)
+	if !ok {
+		return
+	}
+	if param := c.Query("user_id"); param != "" {
+		userID, err := strconv.Atoi(param)
+		if err != nil || userID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be a positive integer"})
+			return
+		}
+		filter.UserID = userID
+	}
+	exportHistory(c, h.db, h.logger, filter, format)
+}
+
+// PurgeRequestHistory deletes requests made more than days days ago, with
+// their collector responses, subscribers, queued notifications and cached
+// files, now and every requestPurgeInterval. Usage totals are kept.
+func (h *DataHandler) PurgeRequestHistory(days int) {
+	ticker := time.NewTicker(requestPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := h.purgeRequestHistory(days); err != nil {
+			h.logger.Error("Failed to purge request history: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// purgeRequestHistory deletes the requests made more than days days ago
+func (h *DataHandler) purgeRequestHistory(days int) error {
+	cutoff := fmt.Sprintf("-%d days", days)
+	expired := `SELECT id FROM data_requests WHERE created_at < datetime('now', ?)`
+
+	var cached []string
+	var purged int64
+	err := database.WithTx(h.db, func(tx *sql.Tx) error {
+		rows, err := tx.Query(`
+			SELECT cached_path FROM collector_responses
+			WHERE cached_path IS NOT NULL AND cached_path != '' AND request_id IN (`+expired+`)
+		`, cutoff)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				rows.Close()
+				return err
+			}
+			cached = append(cached, key)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, table := range []string{"collector_responses", "request_subscribers", "pending_notifications"} {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE request_id IN ("+expired+")", cutoff); err != nil {
+				return err
+			}
+		}
+		result, err := tx.Exec("DELETE FROM data_requests WHERE created_at < datetime('now', ?)", cutoff)
+		if err != nil {
+			return err
+		}
+		purged, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Files are only removed once nothing refers to them any more
+	if h.storage != nil {
+		for _, key := range cached {
+			if err := h.storage.Delete(key); err != nil {
+				h.logger.Warn("Failed to remove cached file %s of a purged request: %v", key, err)
+			}
+		}
+	}
+	if purged > 0 {
+		h.logger.Info("Purged %d requests older than %d days and %d cached files", purged, days, len(cached))
+	}
+	return nil
+}
@@ -1,13 +1,21 @@
 package handlers
 
 import (
+	"crypto/hmac"
+	"crypto/sha1"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	"argus-sdr/internal/database"
 	"argus-sdr/internal/models"
+	"argus-sdr/internal/shared"
 	"argus-sdr/pkg/config"
 	"argus-sdr/pkg/logger"
 
@@ -17,6 +25,15 @@ import (
 	"github.com/pion/webrtc/v3"
 )
 
+// errCandidateLimitReached is returned when a peer exceeds its ICE candidate cap for a session
+var errCandidateLimitReached = errors.New("ICE candidate limit reached for session")
+
+// errRestartNotAllowed is returned when anyone but a session's receiver asks to restart its ICE
+var errRestartNotAllowed = errors.New("only the receiver that opened a session can restart its ICE")
+
+// errStationNotConnected is returned when a signal can't reach a session's collector
+var errStationNotConnected = errors.New("station not connected")
+
 type ICEHandler struct {
 	db               *sql.DB
 	log              *logger.Logger
@@ -25,6 +42,10 @@ type ICEHandler struct {
 	type1Handler     *Type1Handler
 	dataHandler      *DataHandler
 	collectorHandler *CollectorHandler
+
+	// Kept up to date by ExpirePendingSessions
+	sessionsActive  atomic.Int64
+	sessionsExpired atomic.Int64
 }
 
 func NewICEHandler(db *sql.DB, log *logger.Logger, cfg *config.Config, type1Handler *Type1Handler, dataHandler *DataHandler, collectorHandler *CollectorHandler) *ICEHandler {
@@ -72,27 +93,31 @@ func (h *ICEHandler) InitiateSession(c *gin.Context) {
 	// Type2 clients always target Type1 clients for data requests
 	targetClientType := 1
 
-	// Create session record
-	_, err := h.db.Exec(`
-		INSERT INTO ice_sessions (session_id, initiator_user_id, initiator_client_type, target_client_type, status)
-		VALUES (?, ?, ?, ?, 'pending')
-	`, sessionID, userID, clientType, targetClientType)
-
-	if err != nil {
-		h.log.Error("Failed to create ICE session: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
-		return
-	}
+	// Create the session and its file transfer record together, so a session
+	// never exists without a transfer
+	err := database.WithTx(h.db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO ice_sessions (session_id, initiator_user_id, initiator_client_type, target_client_type, status)
+			VALUES (?, ?, ?, ?, 'pending')
+		`, sessionID, userID, clientType, targetClientType)
+		if err != nil {
+			return fmt.Errorf("failed to create ICE session: %w", err)
+		}
 
-	// Create file transfer record - simplified to just one file type
-	_, err = h.db.Exec(`
-		INSERT INTO file_transfers (session_id, file_name, file_size, file_type, request_type, parameters)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, sessionID, "data_file.bin", 0, "application/octet-stream", "data", req.Parameters)
+		// Create file transfer record - simplified to just one file type
+		_, err = tx.Exec(`
+			INSERT INTO file_transfers (session_id, file_name, file_size, file_type, request_type, parameters)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, sessionID, "data_file.bin", 0, "application/octet-stream", "data", req.Parameters)
+		if err != nil {
+			return fmt.Errorf("failed to create file transfer record: %w", err)
+		}
+		return nil
+	})
 
 	if err != nil {
-		h.log.Error("Failed to create file transfer record: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create file transfer"})
+		h.log.Error("Failed to initiate ICE session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
 		return
 	}
 
@@ -132,6 +157,7 @@ func (h *ICEHandler) Signal(c *gin.Context) {
 	var sessionExists bool
 	var initiatorUserID, targetUserID sql.NullInt64
 	var initiatorClientType, targetClientType int
+	var status string
 
 	// For Type 1 clients (collectors), allow them to participate in sessions that target their client type
 	var query string
@@ -140,7 +166,7 @@ func (h *ICEHandler) Signal(c *gin.Context) {
 	if clientType.(int) == 1 {
 		// Type 1 clients can participate in sessions targeting Type 1 clients
 		query = `
-			SELECT 1, initiator_user_id, target_user_id, initiator_client_type, target_client_type
+			SELECT 1, initiator_user_id, target_user_id, initiator_client_type, target_client_type, status
 			FROM ice_sessions
 			WHERE session_id = ? AND target_client_type = 1
 		`
@@ -148,14 +174,14 @@ func (h *ICEHandler) Signal(c *gin.Context) {
 	} else {
 		// Type 2 clients can only participate in sessions they initiated or are targeted for
 		query = `
-			SELECT 1, initiator_user_id, target_user_id, initiator_client_type, target_client_type
+			SELECT 1, initiator_user_id, target_user_id, initiator_client_type, target_client_type, status
 			FROM ice_sessions
 			WHERE session_id = ? AND (initiator_user_id = ? OR target_user_id = ?)
 		`
 		args = []interface{}{req.SessionID, userID, userID}
 	}
 
-	err := h.db.QueryRow(query, args...).Scan(&sessionExists, &initiatorUserID, &targetUserID, &initiatorClientType, &targetClientType)
+	err := h.db.QueryRow(query, args...).Scan(&sessionExists, &initiatorUserID, &targetUserID, &initiatorClientType, &targetClientType, &status)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found or access denied"})
@@ -167,9 +193,15 @@ func (h *ICEHandler) Signal(c *gin.Context) {
 		return
 	}
 
+	// An expired session is over; late signals can't revive it
+	if status == "failed" {
+		c.JSON(http.StatusGone, gin.H{"error": "Session has expired"})
+		return
+	}
+
 	// For Type 1 clients responding to a session, set them as the target
 	if clientType.(int) == 1 && !targetUserID.Valid {
-		_, err := h.db.Exec(`
+		_, err := database.ExecWithRetry(h.db, `
 			UPDATE ice_sessions
 			SET target_user_id = ?, updated_at = CURRENT_TIMESTAMP
 			WHERE session_id = ?
@@ -187,11 +219,25 @@ func (h *ICEHandler) Signal(c *gin.Context) {
 		err = h.handleAnswer(req, userID.(int), clientType.(int))
 	case "candidate":
 		err = h.handleICECandidate(req, userID.(int))
+	case "restart":
+		err = h.handleRestart(req, userID.(int), initiatorUserID)
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signal type"})
 		return
 	}
 
+	if errors.Is(err, errCandidateLimitReached) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errRestartNotAllowed) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errStationNotConnected) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		h.log.Error("Failed to handle signal: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process signal"})
@@ -211,7 +257,7 @@ func (h *ICEHandler) handleOffer(req models.ICESignalRequest, userID, clientType
 	}
 
 	// Store the offer
-	_, err := h.db.Exec(`
+	_, err := database.ExecWithRetry(h.db, `
 		UPDATE ice_sessions
 		SET status = 'offer_received', offer_sdp = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE session_id = ?
@@ -239,7 +285,7 @@ func (h *ICEHandler) handleAnswer(req models.ICESignalRequest, userID, clientTyp
 	}
 
 	// Store the answer
-	_, err := h.db.Exec(`
+	_, err := database.ExecWithRetry(h.db, `
 		UPDATE ice_sessions
 		SET target_user_id = ?, status = 'answer_received', answer_sdp = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE session_id = ?
@@ -261,13 +307,76 @@ func (h *ICEHandler) handleAnswer(req models.ICESignalRequest, userID, clientTyp
 	return nil
 }
 
+// handleRestart relays a receiver's request to restart ICE to the session's
+// collector, which answers with an ice-restart offer that goes through
+// handleOffer like the first one. Only the receiver that opened the session
+// may ask.
+func (h *ICEHandler) handleRestart(req models.ICESignalRequest, userID int, initiatorUserID sql.NullInt64) error {
+	if !initiatorUserID.Valid || initiatorUserID.Int64 != int64(userID) {
+		return errRestartNotAllowed
+	}
+
+	// Sessions are bound to a station by the parameters the receiver opened them with
+	var stationID string
+	err := h.db.QueryRow(`
+		SELECT COALESCE(CASE WHEN json_valid(parameters) THEN json_extract(parameters, '$.station_id') END, '')
+		FROM file_transfers
+		WHERE session_id = ?
+	`, req.SessionID).Scan(&stationID)
+	if err != nil {
+		return err
+	}
+	if stationID == "" {
+		return errors.New("station_id not found in session parameters")
+	}
+
+	if h.dataHandler != nil {
+		if err := h.dataHandler.NotifyCollectorOfICERestart(stationID, req.SessionID); err != nil {
+			return err
+		}
+	}
+
+	h.log.Info("ICE restart requested for session %s by user %d", req.SessionID, userID)
+
+	return nil
+}
+
 func (h *ICEHandler) handleICECandidate(req models.ICESignalRequest, userID int) error {
 	if req.ICECandidate == nil {
 		return errors.New("ICE candidate required")
 	}
 
+	// Ignore candidates this peer has already sent for the session
+	var duplicate int
+	err := h.db.QueryRow(`
+		SELECT COUNT(*) FROM ice_candidates
+		WHERE session_id = ? AND user_id = ? AND candidate = ? AND sdp_mline_index = ? AND sdp_mid = ?
+	`, req.SessionID, userID, req.ICECandidate.Candidate, req.ICECandidate.SDPMLineIndex, req.ICECandidate.SDPMid).Scan(&duplicate)
+	if err != nil {
+		return err
+	}
+	if duplicate > 0 {
+		h.log.Debug("Ignoring duplicate ICE candidate for session %s from user %d", req.SessionID, userID)
+		return nil
+	}
+
+	// Enforce the per-peer candidate cap so a client can't flood the session
+	if maxCandidates := h.cfg.Server.MaxICECandidates; maxCandidates > 0 {
+		var count int
+		err := h.db.QueryRow(`
+			SELECT COUNT(*) FROM ice_candidates WHERE session_id = ? AND user_id = ?
+		`, req.SessionID, userID).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count >= maxCandidates {
+			h.log.Warn("Rejecting ICE candidate for session %s from user %d: limit of %d reached", req.SessionID, userID, maxCandidates)
+			return errCandidateLimitReached
+		}
+	}
+
 	// Store the ICE candidate
-	_, err := h.db.Exec(`
+	_, err = database.ExecWithRetry(h.db, `
 		INSERT INTO ice_candidates (session_id, user_id, candidate, sdp_mline_index, sdp_mid)
 		VALUES (?, ?, ?, ?, ?)
 	`, req.SessionID, userID, req.ICECandidate.Candidate, req.ICECandidate.SDPMLineIndex, req.ICECandidate.SDPMid)
@@ -288,7 +397,10 @@ func (h *ICEHandler) handleICECandidate(req models.ICESignalRequest, userID int)
 	return nil
 }
 
-// GetSignals retrieves pending signals for a session
+// GetSignals retrieves pending signals for a session. Candidates are returned
+// in the order they were stored, at most MaxSignalsReturned per call; callers
+// pass the previous response's next_after as ?after= to fetch only newer ones.
+// Collectors and receivers get signals over WebSocket; this is for polling clients.
 func (h *ICEHandler) GetSignals(c *gin.Context) {
 	sessionID := c.Param("session_id")
 	userID, _ := c.Get("user_id")
@@ -347,13 +459,30 @@ func (h *ICEHandler) GetSignals(c *gin.Context) {
 		}
 	}
 
+	// Pollers pass the previous response's next_after to fetch only newer candidates
+	var after int64
+	if value := c.Query("after"); value != "" {
+		after, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || after < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "after must be a non-negative integer"})
+			return
+		}
+	}
+
+	// Fetch one candidate past the limit to tell whether more are waiting
+	limit := -1
+	if h.cfg.Server.MaxSignalsReturned > 0 {
+		limit = h.cfg.Server.MaxSignalsReturned + 1
+	}
+
 	// Get ICE candidates for this session (excluding the current user's candidates)
 	rows, err := h.db.Query(`
-		SELECT candidate, sdp_mline_index, sdp_mid, created_at
+		SELECT id, candidate, sdp_mline_index, sdp_mid
 		FROM ice_candidates
-		WHERE session_id = ? AND user_id != ?
-		ORDER BY created_at ASC
-	`, sessionID, userID)
+		WHERE session_id = ? AND user_id != ? AND id > ?
+		ORDER BY id ASC
+		LIMIT ?
+	`, sessionID, userID, after, limit)
 
 	if err != nil {
 		h.log.Error("Failed to fetch ICE candidates: %v", err)
@@ -363,20 +492,29 @@ func (h *ICEHandler) GetSignals(c *gin.Context) {
 	defer rows.Close()
 
 	var candidates []models.ICECandidate
+	nextAfter := after
+	hasMore := false
 	for rows.Next() {
+		if h.cfg.Server.MaxSignalsReturned > 0 && len(candidates) == h.cfg.Server.MaxSignalsReturned {
+			hasMore = true
+			break
+		}
 		var candidate models.ICECandidate
-		var createdAt time.Time
-		err := rows.Scan(&candidate.Candidate, &candidate.SDPMLineIndex, &candidate.SDPMid, &createdAt)
+		var id int64
+		err := rows.Scan(&id, &candidate.Candidate, &candidate.SDPMLineIndex, &candidate.SDPMid)
 		if err != nil {
 			h.log.Error("Failed to scan ICE candidate: %v", err)
 			continue
 		}
 		candidates = append(candidates, candidate)
+		nextAfter = id
 	}
 
 	response := gin.H{
 		"session_id": sessionID,
 		"candidates": candidates,
+		"next_after": nextAfter,
+		"has_more":   hasMore,
 	}
 	
 	if offerSDP.Valid {
@@ -390,6 +528,47 @@ func (h *ICEHandler) GetSignals(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// GetICEConfig returns the STUN and TURN servers for a transfer. TURN
+// credentials follow the TURN REST API convention used by coturn's
+// use-auth-secret: the username is "<expiry unix time>:<user id>" and the
+// credential is the base64 HMAC-SHA1 of the username keyed with TURN_SECRET,
+// so the TURN server can check them without calling back.
+func (h *ICEHandler) GetICEConfig(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	// Credentials are per request; proxies must not hand them to someone else
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, iceServerConfig(h.cfg.ICE, fmt.Sprintf("%v", userID)))
+}
+
+// iceServerConfig returns the STUN and TURN servers for a user, with fresh
+// TURN credentials
+func iceServerConfig(cfg config.ICEConfig, userID string) shared.ICEServerConfig {
+	iceConfig := shared.ICEServerConfig{ICEServers: []shared.ICEServer{}}
+	if len(cfg.STUNURLs) > 0 {
+		iceConfig.ICEServers = append(iceConfig.ICEServers, shared.ICEServer{URLs: cfg.STUNURLs})
+	}
+	if len(cfg.TURNURLs) > 0 {
+		ttl := time.Duration(cfg.TURNCredentialTTL) * time.Second
+		username, credential := turnCredentials(cfg.TURNSecret, userID, time.Now().Add(ttl))
+		iceConfig.ICEServers = append(iceConfig.ICEServers, shared.ICEServer{
+			URLs:       cfg.TURNURLs,
+			Username:   username,
+			Credential: credential,
+		})
+		iceConfig.TTL = cfg.TURNCredentialTTL
+	}
+	return iceConfig
+}
+
+// turnCredentials returns time-limited TURN credentials for a user
+func turnCredentials(secret, userID string, expiry time.Time) (string, string) {
+	username := fmt.Sprintf("%d:%s", expiry.Unix(), userID)
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
 // GetActiveSessions returns sessions that need peer connections
 func (h *ICEHandler) GetActiveSessions(c *gin.Context) {
 	userID, _ := c.Get("user_id")
@@ -531,4 +710,85 @@ func (h *ICEHandler) notifyPeerOfICECandidate(sessionID string, senderUserID int
 	}
 	
 	return nil
-}
\ No newline at end of file
+}
+
+// CompleteSession handles POST /api/ice/complete. The receiver that opened a
+// session reports that its file arrived and how many bytes it received, which
+// are added to its usage. Reporting a session again changes nothing.
+func (h *ICEHandler) CompleteSession(c *gin.Context) {
+	var req models.FileTransferComplete
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Bytes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bytes must not be negative"})
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	// Sessions are bound to a station by the parameters the receiver opened them with
+	var stationID string
+	err := h.db.QueryRow(`
+		SELECT COALESCE(CASE WHEN json_valid(ft.parameters) THEN json_extract(ft.parameters, '$.station_id') END, '')
+		FROM ice_sessions s
+		JOIN file_transfers ft ON s.session_id = ft.session_id
+		WHERE s.session_id = ? AND s.initiator_user_id = ?
+	`, req.SessionID, userID).Scan(&stationID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found or access denied"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to look up session %s: %v", req.SessionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if stationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Session is not a transfer from a station"})
+		return
+	}
+
+	// Completing the transfer and counting it happen together, so a failure
+	// leaves the session to be reported again rather than uncounted
+	recorded := false
+	err = database.WithTx(h.db, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`
+			UPDATE file_transfers
+			SET status = 'completed', file_size = ?, completed_at = CURRENT_TIMESTAMP
+			WHERE session_id = ? AND status != 'completed'
+		`, req.Bytes, req.SessionID)
+		if err != nil {
+			return err
+		}
+		if completed, _ := result.RowsAffected(); completed == 0 {
+			recorded = false
+			return nil
+		}
+
+		if _, err := tx.Exec(`
+			UPDATE ice_sessions
+			SET status = 'completed', updated_at = CURRENT_TIMESTAMP
+			WHERE session_id = ?
+		`, req.SessionID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(recordTransferQuery, userID, stationID, shared.TransferWebRTC, req.Bytes); err != nil {
+			return err
+		}
+		recorded = true
+		return nil
+	})
+	if err != nil {
+		h.log.Error("Failed to record transfer of session %s: %v", req.SessionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record transfer"})
+		return
+	}
+	if !recorded {
+		c.JSON(http.StatusOK, gin.H{"session_id": req.SessionID, "recorded": false})
+		return
+	}
+
+	h.log.Info("Session %s completed: user %d received %d bytes from station %s", req.SessionID, userID, req.Bytes, stationID)
+	c.JSON(http.StatusOK, gin.H{"session_id": req.SessionID, "bytes": req.Bytes, "recorded": true})
+}
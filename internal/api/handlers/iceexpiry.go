@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"argus-sdr/internal/database"
+	"argus-sdr/internal/shared"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Bounds for how often ExpirePendingSessions checks for expired sessions
+const (
+	minSessionExpiryInterval = time.Second
+	maxSessionExpiryInterval = time.Minute
+)
+
+// sessionExpiredReason is the reason peers of an expired session are given
+const sessionExpiredReason = "session was not established in time"
+
+// expiredSession is an ICE session that is still being negotiated past its TTL
+type expiredSession struct {
+	SessionID string
+	UserID    int // the receiver that opened the session
+	RequestID string
+	StationID string
+}
+
+// ExpirePendingSessions fails ICE sessions that are still pending or have only
+// an offer ttl after their last signaling step, such as sessions whose
+// receiver never answered, and tells both peers. It checks every quarter of
+// the TTL, within a second and a minute.
+func (h *ICEHandler) ExpirePendingSessions(ttl time.Duration) {
+	interval := ttl / 4
+	if interval < minSessionExpiryInterval {
+		interval = minSessionExpiryInterval
+	}
+	if interval > maxSessionExpiryInterval {
+		interval = maxSessionExpiryInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := h.expirePendingSessions(ttl); err != nil {
+			h.log.Error("Failed to expire pending ICE sessions: %v", err)
+		}
+	}
+}
+
+// expirePendingSessions fails the sessions that have been negotiating for
+// longer than ttl and counts the sessions still active
+func (h *ICEHandler) expirePendingSessions(ttl time.Duration) error {
+	// Sessions are bound to a request and station by the parameters the receiver opened them with
+	rows, err := h.db.Query(`
+		SELECT s.session_id, s.initiator_user_id,
+			COALESCE(CASE WHEN json_valid(ft.parameters) THEN json_extract(ft.parameters, '$.request_id') END, ''),
+			COALESCE(CASE WHEN json_valid(ft.parameters) THEN json_extract(ft.parameters, '$.station_id') END, '')
+		FROM ice_sessions s
+		LEFT JOIN file_transfers ft ON s.session_id = ft.session_id
+		WHERE s.status IN ('pending', 'offer_received') AND s.updated_at < datetime('now', ?)
+	`, fmt.Sprintf("-%d seconds", int(ttl.Seconds())))
+	if err != nil {
+		return err
+	}
+	var sessions []expiredSession
+	for rows.Next() {
+		var session expiredSession
+		if err := rows.Scan(&session.SessionID, &session.UserID, &session.RequestID, &session.StationID); err != nil {
+			rows.Close()
+			return err
+		}
+		sessions = append(sessions, session)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		expired, err := h.failSession(session.SessionID)
+		if err != nil {
+			return err
+		}
+		// Signaling may have moved the session on since it was selected
+		if !expired {
+			continue
+		}
+		h.sessionsExpired.Add(1)
+		h.log.Warn("ICE session %s of user %d was not established within %v, failing it", session.SessionID, session.UserID, ttl)
+
+		notification := shared.SessionFailedNotification{
+			SessionID: session.SessionID,
+			RequestID: session.RequestID,
+			Reason:    sessionExpiredReason,
+			Timestamp: time.Now().Unix(),
+		}
+		if session.StationID != "" && h.collectorHandler != nil {
+			if err := h.collectorHandler.NotifyCollectorOfSessionFailed(session.StationID, notification); err != nil {
+				h.log.Warn("Failed to tell station %s that session %s failed: %v", session.StationID, session.SessionID, err)
+			}
+		}
+		if h.dataHandler != nil {
+			message := shared.ReceiverMessage{Type: "session_failed", Payload: notification}
+			if _, err := h.dataHandler.sendReceiverNotification(strconv.Itoa(session.UserID), message); err != nil {
+				h.log.Warn("Failed to tell user %d that session %s failed: %v", session.UserID, session.SessionID, err)
+			}
+		}
+	}
+
+	var active int64
+	if err := h.db.QueryRow(`
+		SELECT COUNT(*) FROM ice_sessions WHERE status IN ('pending', 'offer_received', 'answer_received')
+	`).Scan(&active); err != nil {
+		return err
+	}
+	h.sessionsActive.Store(active)
+	return nil
+}
+
+// failSession marks a session that is still negotiating failed, with its
+// file transfer, and drops its ICE candidates. It returns false if the
+// session had moved on.
+func (h *ICEHandler) failSession(sessionID string) (bool, error) {
+	failed := false
+	err := database.WithTx(h.db, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`
+			UPDATE ice_sessions
+			SET status = 'failed', updated_at = CURRENT_TIMESTAMP
+			WHERE session_id = ? AND status IN ('pending', 'offer_received')
+		`, sessionID)
+		if err != nil {
+			return err
+		}
+		if updated, _ := result.RowsAffected(); updated == 0 {
+			failed = false
+			return nil
+		}
+
+		if _, err := tx.Exec(`
+			UPDATE file_transfers SET status = 'failed' WHERE session_id = ? AND status != 'completed'
+		`, sessionID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM ice_candidates WHERE session_id = ?", sessionID); err != nil {
+			return err
+		}
+		failed = true
+		return nil
+	})
+	return failed, err
+}
+
+// SessionStats reports the ICE sessions still active as of the last expiry
+// check and how many sessions have expired since the server started
+func (h *ICEHandler) SessionStats() gin.H {
+	return gin.H{
+		"active":  h.sessionsActive.Load(),
+		"expired": h.sessionsExpired.Load(),
+	}
+}
@@ -0,0 +1,31 @@
+package handlers
+
+// stationLoads returns how many requests each station is working on: those it
+// was sent and hasn't delivered, failed or rejected yet, including files it is
+// still uploading, of requests that are still running. A station's count rises
+// when a request is forwarded to it and falls once it answers.
+func (h *DataHandler) stationLoads() (map[string]int, error) {
+	rows, err := h.db.Query(`
+		SELECT cr.station_id, COUNT(*)
+		FROM collector_responses cr
+		JOIN data_requests dr ON dr.id = cr.request_id
+		WHERE cr.status IN ('pending', 'processing')
+		AND dr.status NOT IN ('cancelled', 'complete', 'failed')
+		GROUP BY cr.station_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loads := make(map[string]int)
+	for rows.Next() {
+		var stationID string
+		var count int
+		if err := rows.Scan(&stationID, &count); err != nil {
+			return nil, err
+		}
+		loads[stationID] = count
+	}
+	return loads, rows.Err()
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"argus-sdr/internal/database"
+)
+
+// pendingNotification is a queued notification for a receiver that wasn't connected
+type pendingNotification struct {
+	id        int64
+	requestID string
+	message   json.RawMessage
+}
+
+// queueNotification stores a request notification that couldn't be sent to a
+// user's receiver, so it's delivered when the receiver reconnects. It's
+// dropped after NOTIFICATION_QUEUE_TTL_HOURS.
+func (h *DataHandler) queueNotification(userID, requestID string, notification interface{}) error {
+	ttl := h.cfg.Server.NotificationQueueTTL
+	if ttl == 0 {
+		return nil
+	}
+
+	message, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	// Expired notifications, delivered or not, are cleaned up as new ones come in
+	if _, err := database.ExecWithRetry(h.db, "DELETE FROM pending_notifications WHERE expires_at <= CURRENT_TIMESTAMP"); err != nil {
+		h.logger.Warn("Failed to remove expired notifications: %v", err)
+	}
+
+	query := `
+		INSERT INTO pending_notifications (user_id, request_id, message, expires_at)
+		VALUES (?, ?, ?, datetime('now', ?))
+	`
+	if _, err := database.ExecWithRetry(h.db, query, userID, requestID, string(message), fmt.Sprintf("+%d hours", ttl)); err != nil {
+		return err
+	}
+	h.logger.Info("Queued notification for request %s until user %s reconnects", requestID, userID)
+	return nil
+}
+
+// flushPendingNotifications sends a user's queued notifications, oldest
+// first, to their receiver that has just connected, and marks each one
+// delivered. Notifications of requests cancelled in the meantime are dropped.
+// It stops at the first one that can't be sent; the rest stay queued.
+func (h *DataHandler) flushPendingNotifications(userID string) {
+	pending, err := h.pendingNotifications(userID)
+	if err != nil {
+		h.logger.Error("Failed to load queued notifications for user %s: %v", userID, err)
+		return
+	}
+
+	delivered := 0
+	for _, notification := range pending {
+		if h.isRequestCancelled(notification.requestID) {
+			if _, err := database.ExecWithRetry(h.db, "DELETE FROM pending_notifications WHERE id = ?", notification.id); err != nil {
+				h.logger.Warn("Failed to remove notification %d of cancelled request %s: %v", notification.id, notification.requestID, err)
+			}
+			continue
+		}
+
+		sent, err := h.sendReceiverNotification(userID, notification.message)
+		if err != nil || !sent {
+			h.logger.Warn("Receiver of user %s went away, keeping the rest of its queued notifications", userID)
+			return
+		}
+		delivered++
+
+		if _, err := database.ExecWithRetry(h.db, "UPDATE pending_notifications SET delivered_at = CURRENT_TIMESTAMP WHERE id = ?", notification.id); err != nil {
+			h.logger.Error("Failed to mark notification %d delivered: %v", notification.id, err)
+		}
+	}
+
+	if delivered > 0 {
+		h.logger.Info("Delivered %d queued notifications to user %s", delivered, userID)
+	}
+}
+
+// pendingNotifications returns a user's undelivered, unexpired notifications, oldest first
+func (h *DataHandler) pendingNotifications(userID string) ([]pendingNotification, error) {
+	rows, err := h.db.Query(`
+		SELECT id, request_id, message FROM pending_notifications
+		WHERE user_id = ? AND delivered_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []pendingNotification
+	for rows.Next() {
+		var notification pendingNotification
+		var message string
+		if err := rows.Scan(&notification.id, &notification.requestID, &message); err != nil {
+			return nil, err
+		}
+		notification.message = json.RawMessage(message)
+		pending = append(pending, notification)
+	}
+	return pending, rows.Err()
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"argus-sdr/internal/shared"
+
+	"github.com/gin-gonic/gin"
+)
+
+// selectionPlan explains which stations a request would go to and why
+type selectionPlan struct {
+	Strategy      string               `json:"strategy"`
+	Stations      []plannedStation     `json:"stations"` // the candidates in the order they would be tried
+	Chosen        []string             `json:"chosen"`
+	Unavailable   []unavailableStation `json:"unavailable"`
+	OutsideRegion []string             `json:"outside_region,omitempty"` // available, but not in the request's region
+	RegionRelaxed bool                 `json:"region_relaxed"`
+	Geometry      gin.H                `json:"geometry"` // as GET /api/stations/geometry rates the chosen stations
+	OK            bool                 `json:"ok"`
+	Error         string               `json:"error,omitempty"` // why the request would be refused
+
+	scores   map[string]*stationScore
+	inRegion map[string]bool // nil without a region
+}
+
+// plannedStation is a candidate station of a selectionPlan
+type plannedStation struct {
+	StationID string             `json:"station_id"`
+	Score     float64            `json:"score"`
+	Ratings   map[string]float64 `json:"ratings"`
+	InRegion  *bool              `json:"in_region,omitempty"`
+	Chosen    bool               `json:"chosen"`
+}
+
+// unavailableStation is a connected station that can't take requests
+type unavailableStation struct {
+	StationID string `json:"station_id"`
+	Reason    string `json:"reason"`
+}
+
+// addScores records station scores; like the other recording methods, it
+// does nothing on a nil plan
+func (p *selectionPlan) addScores(scores map[string]*stationScore) {
+	if p == nil {
+		return
+	}
+	if p.scores == nil {
+		p.scores = make(map[string]*stationScore)
+	}
+	for id, score := range scores {
+		p.scores[id] = score
+	}
+}
+
+// setRegion records which stations are inside the request's region
+func (p *selectionPlan) setRegion(inside, outside []string) {
+	if p == nil {
+		return
+	}
+	p.inRegion = make(map[string]bool, len(inside)+len(outside))
+	for _, id := range inside {
+		p.inRegion[id] = true
+	}
+	for _, id := range outside {
+		p.inRegion[id] = false
+	}
+	p.OutsideRegion = outside
+}
+
+// selectionError is the message a request that no stations were chosen for
+// is refused with
+func selectionError(err error, request shared.DataRequest) string {
+	switch {
+	case errors.Is(err, errNoStationsInRegion):
+		return "No collectors available in the requested region"
+	case errors.Is(err, errTooFewStations):
+		return fmt.Sprintf("Fewer than min_stations (%d) collectors available", request.MinStations)
+	}
+	return "No collectors available"
+}
+
+// PlanRequest handles POST /api/data/request/plan. It takes the same body as
+// POST /api/data/request and goes through the same station selection, but
+// only reports the outcome: the stations the request would go to, how each
+// candidate scored, which stations weren't available and why, whether the
+// region was relaxed and how well the chosen stations could locate a
+// transmitter. Nothing is stored or sent, and it doesn't count towards the
+// quota.
+func (h *DataHandler) PlanRequest(c *gin.Context) {
+	request, ok := h.bindDataRequest(c)
+	if !ok {
+		return
+	}
+
+	stations, unavailable, err := h.stationAvailability()
+	if err != nil {
+		h.logger.Error("Failed to get available stations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get available stations"})
+		return
+	}
+
+	plan := &selectionPlan{
+		Strategy:    request.SelectionStrategy,
+		Stations:    []plannedStation{},
+		Chosen:      []string{},
+		Unavailable: []unavailableStation{},
+	}
+	if plan.Strategy == "" {
+		plan.Strategy = shared.SelectionWeighted
+	}
+	for id, reason := range unavailable {
+		plan.Unavailable = append(plan.Unavailable, unavailableStation{StationID: id, Reason: reason})
+	}
+	sort.Slice(plan.Unavailable, func(i, j int) bool {
+		return plan.Unavailable[i].StationID < plan.Unavailable[j].StationID
+	})
+
+	limit := stationLimit(request)
+	candidates, err := h.candidateStations(stations, request, limit, plan)
+	chosen := candidates
+	if len(chosen) > limit {
+		chosen = chosen[:limit]
+	}
+	if err == nil && len(chosen) == 0 {
+		err = errors.New("no stations available")
+	}
+	if err == nil {
+		err = checkMinStations(chosen, request)
+	}
+	if err != nil {
+		plan.Error = selectionError(err, request)
+	} else {
+		plan.OK = true
+		plan.Chosen = chosen
+	}
+
+	for i, id := range candidates {
+		station := plannedStation{StationID: id, Ratings: map[string]float64{}, Chosen: plan.OK && i < len(chosen)}
+		if score := plan.scores[id]; score != nil {
+			station.Score, station.Ratings = score.Score, score.Ratings
+		}
+		if plan.inRegion != nil {
+			inRegion := plan.inRegion[id]
+			station.InRegion = &inRegion
+		}
+		plan.Stations = append(plan.Stations, station)
+	}
+
+	if len(plan.Chosen) > 0 {
+		if plan.Geometry, err = h.rateGeometry(plan.Chosen); err != nil {
+			// The plan is still useful without it
+			h.logger.Error("Failed to rate station geometry: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
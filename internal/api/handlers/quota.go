@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"argus-sdr/internal/models"
+	"argus-sdr/internal/shared"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestQuota is how many data requests a user may make today and how many
+// they have made. Days are UTC, so every quota resets at midnight UTC.
+type requestQuota struct {
+	Limit   int // 0 means unlimited
+	Used    int
+	ResetAt time.Time
+}
+
+// Exceeded reports whether the user may not make another request today
+func (q requestQuota) Exceeded() bool {
+	return q.Limit > 0 && q.Used >= q.Limit
+}
+
+// Remaining returns how many more requests the user may make today
+func (q requestQuota) Remaining() int {
+	if q.Used >= q.Limit {
+		return 0
+	}
+	return q.Limit - q.Used
+}
+
+// startOfDay returns midnight UTC of the day t is in
+func startOfDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// userQuota returns the daily request quota of the authenticated user.
+// Requests refused because no collector was available don't count: they are
+// marked failed without having been sent to any station.
+func (h *DataHandler) userQuota(c *gin.Context, userID string) (requestQuota, error) {
+	day := startOfDay(time.Now())
+	quota := requestQuota{
+		Limit:   h.cfg.Server.DailyRequestQuotaFor(c.GetInt("client_type"), c.GetString("role") == models.RoleAdmin),
+		ResetAt: day.Add(24 * time.Hour),
+	}
+
+	// created_at is stored as CURRENT_TIMESTAMP text, which is UTC
+	err := h.db.QueryRow(`
+		SELECT COUNT(*) FROM data_requests
+		WHERE requested_by = ? AND created_at >= ?
+		AND (status != 'failed' OR EXISTS (SELECT 1 FROM collector_responses WHERE request_id = data_requests.id))
+	`, userID, day.Format("2006-01-02 15:04:05")).Scan(&quota.Used)
+	return quota, err
+}
+
+// setQuotaHeaders reports a user's quota in the response headers; users
+// without a quota get none
+func setQuotaHeaders(c *gin.Context, quota requestQuota) {
+	if quota.Limit == 0 {
+		return
+	}
+	c.Header(shared.QuotaLimitHeader, strconv.Itoa(quota.Limit))
+	c.Header(shared.QuotaRemainingHeader, strconv.Itoa(quota.Remaining()))
+	c.Header(shared.QuotaResetHeader, strconv.FormatInt(quota.ResetAt.Unix(), 10))
+}
+
+// quotaExceeded answers 429 for a user whose daily quota is used up, with a
+// Retry-After that points at the quota's reset
+func quotaExceeded(c *gin.Context, quota requestQuota) {
+	setQuotaHeaders(c, quota)
+	c.Header("Retry-After", strconv.Itoa(int(time.Until(quota.ResetAt).Seconds())+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":    fmt.Sprintf("Daily request quota of %d exceeded", quota.Limit),
+		"limit":    quota.Limit,
+		"used":     quota.Used,
+		"reset_at": quota.ResetAt.Format(time.RFC3339),
+	})
+}
+
+// GetQuota handles GET /api/data/quota
+func (h *DataHandler) GetQuota(c *gin.Context) {
+	userIDInt, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	userID := fmt.Sprintf("%d", userIDInt)
+
+	quota, err := h.userQuota(c, userID)
+	if err != nil {
+		h.logger.Error("Failed to count requests of user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get quota"})
+		return
+	}
+	setQuotaHeaders(c, quota)
+
+	response := gin.H{
+		"unlimited": quota.Limit == 0,
+		"limit":     nil,
+		"used":      quota.Used,
+		"remaining": nil,
+		"reset_at":  quota.ResetAt.Format(time.RFC3339),
+	}
+	if quota.Limit > 0 {
+		response["limit"] = quota.Limit
+		response["remaining"] = quota.Remaining()
+	}
+	c.JSON(http.StatusOK, response)
+}
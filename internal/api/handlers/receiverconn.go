@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// receiverConn is a receiver's notification WebSocket and the health of its writes
+type receiverConn struct {
+	conn *websocket.Conn
+
+	writeMu  sync.Mutex // a WebSocket takes one writer at a time
+	failures int        // consecutive failed writes, guarded by writeMu
+
+	lastSeen atomic.Int64 // when the receiver last sent a pong or frame, in Unix nanoseconds
+	evicted  atomic.Bool  // closed to make room; its connection slot went to the newer connection
+}
+
+// markSeen records that the receiver answered a ping or sent a frame
+func (r *receiverConn) markSeen() {
+	r.lastSeen.Store(time.Now().UnixNano())
+}
+
+// sinceSeen returns how long ago the receiver last answered a ping or sent a frame
+func (r *receiverConn) sinceSeen() time.Duration {
+	return time.Since(time.Unix(0, r.lastSeen.Load()))
+}
+
+// write sends a message within timeout and returns the number of
+// consecutive failed writes on the connection, including this one
+func (r *receiverConn) write(messageType int, data []byte, timeout time.Duration) (int, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	r.conn.SetWriteDeadline(time.Now().Add(timeout))
+	err := r.conn.WriteMessage(messageType, data)
+	r.conn.SetWriteDeadline(time.Time{})
+	if err != nil {
+		r.failures++
+		return r.failures, err
+	}
+	r.failures = 0
+	return 0, nil
+}
+
+// writeToReceiver sends a message to the user's receiver WebSocket. It
+// reports false without an error when the user has no connection.
+//
+// A failed write is retried NOTIFY_WRITE_RETRIES times, NOTIFY_WRITE_RETRY_DELAY_MS
+// apart, on whatever connection the user has by then: a write that times out
+// leaves a WebSocket unable to send, so retries mostly help a receiver that
+// has reconnected meanwhile. A connection is only dropped, and closed so its
+// receiver notices, after NOTIFY_MAX_WRITE_FAILURES consecutive failed writes.
+func (h *DataHandler) writeToReceiver(userID string, message interface{}) (bool, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return false, err
+	}
+
+	timeout := time.Duration(h.cfg.Server.NotifyWriteTimeout) * time.Second
+	attempts := h.cfg.Server.NotifyWriteRetries + 1
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(h.cfg.Server.NotifyWriteRetryDelay) * time.Millisecond)
+		}
+
+		h.connMutex.RLock()
+		receiver, exists := h.receiverConns[userID]
+		h.connMutex.RUnlock()
+		if !exists {
+			return false, lastErr
+		}
+
+		failures, err := receiver.write(websocket.TextMessage, data, timeout)
+		if err == nil {
+			return true, nil
+		}
+		lastErr = err
+		h.logger.Warn("Failed to write to the receiver of user %s (attempt %d of %d, %d consecutive failures): %v",
+			userID, attempt, attempts, failures, err)
+
+		if failures >= h.cfg.Server.NotifyMaxWriteFailures {
+			h.logger.Error("Dropping the receiver connection of user %s after %d consecutive failed writes", userID, failures)
+			h.removeReceiverConn(userID, receiver)
+			receiver.conn.Close()
+		}
+	}
+	return false, lastErr
+}
+
+// removeReceiverConn forgets a user's receiver connection unless it has
+// already been replaced by a newer one
+func (h *DataHandler) removeReceiverConn(userID string, receiver *receiverConn) {
+	h.connMutex.Lock()
+	defer h.connMutex.Unlock()
+	if h.receiverConns[userID] == receiver {
+		delete(h.receiverConns, userID)
+	}
+}
+
+// GoingAway tells every connected receiver the server is going away and
+// returns how many were told
+func (h *DataHandler) GoingAway(reason string) int {
+	h.connMutex.RLock()
+	defer h.connMutex.RUnlock()
+
+	notified := 0
+	for _, receiver := range h.receiverConns {
+		if sendGoingAway(receiver.conn, reason) {
+			notified++
+		}
+	}
+	return notified
+}
+
+// evictUnresponsiveReceiver makes room for a new receiver connection once
+// MAX_RECEIVER_CONNECTIONS is reached. It closes the least recently seen
+// connection if it has been silent for longer than staleAfter, which it only
+// is when it stopped answering pings, and hands its slot to the new
+// connection. It reports false if every connection is responsive.
+func (h *DataHandler) evictUnresponsiveReceiver(staleAfter time.Duration) bool {
+	h.connMutex.Lock()
+	var victimID string
+	var victim *receiverConn
+	for userID, receiver := range h.receiverConns {
+		if victim == nil || receiver.sinceSeen() > victim.sinceSeen() {
+			victimID, victim = userID, receiver
+		}
+	}
+	if victim == nil || victim.sinceSeen() <= staleAfter {
+		h.connMutex.Unlock()
+		return false
+	}
+	// Its handler hasn't released the slot yet: that happens after it has
+	// removed the connection, which it can't while we hold connMutex
+	victim.evicted.Store(true)
+	delete(h.receiverConns, victimID)
+	h.connMutex.Unlock()
+
+	h.logger.Warn("Evicting the receiver connection of user %s to make room: no pong for %v",
+		victimID, victim.sinceSeen().Round(time.Second))
+	h.receiverLimiter.Evicted()
+	victim.conn.Close()
+	return true
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"argus-sdr/internal/shared"
+)
+
+// unansweredRequest is a request a station was sent but never answered
+type unansweredRequest struct {
+	request shared.DataRequest
+	age     float64 // seconds
+}
+
+// reforwardPendingRequests sends a station that has just (re)connected the
+// requests it was sent before its connection dropped and never answered, so
+// a transient disconnect doesn't leave their receivers waiting. Requests older
+// than REQUEST_REFORWARD_MAX_AGE_SECONDS are failed for the station instead.
+func (h *DataHandler) reforwardPendingRequests(stationID string) {
+	maxAge := h.cfg.Server.ReforwardMaxAge
+	if maxAge == 0 || h.collectorHandler == nil {
+		return
+	}
+
+	unanswered, err := h.unansweredRequests(stationID)
+	if err != nil {
+		h.logger.Error("Failed to load unanswered requests of station %s: %v", stationID, err)
+		return
+	}
+
+	for _, pending := range unanswered {
+		requestID := pending.request.ID
+		if pending.age > float64(maxAge) {
+			message := fmt.Sprintf("station disconnected before answering and the request is older than %ds", maxAge)
+			if err := h.StoreCollectorResponse(requestID, stationID, "error", "", 0, message); err != nil {
+				h.logger.Error("Failed to fail stale request %s for station %s: %v", requestID, stationID, err)
+			}
+			h.logger.Warn("Not sending request %s to station %s again: it is %.0fs old", requestID, stationID, pending.age)
+			continue
+		}
+
+		if err := h.collectorHandler.SendDataRequest(stationID, pending.request); err != nil {
+			h.logger.Error("Failed to send request %s to station %s again: %v", requestID, stationID, err)
+			return
+		}
+		h.logger.Info("Sent unanswered request %s to reconnected station %s again", requestID, stationID)
+	}
+}
+
+// unansweredRequests returns the unfinished requests a station has a pending
+// response for, oldest first, with their age
+func (h *DataHandler) unansweredRequests(stationID string) ([]unansweredRequest, error) {
+	rows, err := h.db.Query(`
+		SELECT dr.id, dr.request_type, dr.parameters, dr.format, dr.image, dr.callback_url, dr.region,
+		       dr.region_fallback, dr.duration_seconds, dr.requested_by, dr.created_at,
+		       (julianday('now') - julianday(dr.created_at)) * 86400
+		FROM collector_responses cr
+		JOIN data_requests dr ON dr.id = cr.request_id
+		WHERE cr.station_id = ? AND cr.status = 'pending'
+		AND dr.status NOT IN ('cancelled', 'complete', 'failed')
+		ORDER BY dr.created_at
+	`, stationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var unanswered []unansweredRequest
+	for rows.Next() {
+		var pending unansweredRequest
+		var parameters, format, image, callbackURL, region sql.NullString
+		var regionFallback sql.NullBool
+		var duration sql.NullFloat64
+		var createdAt time.Time
+		if err := rows.Scan(&pending.request.ID, &pending.request.RequestType, &parameters, &format, &image,
+			&callbackURL, &region, &regionFallback, &duration, &pending.request.RequestedBy, &createdAt, &pending.age); err != nil {
+			return nil, err
+		}
+
+		request := &pending.request
+		request.Parameters = parameters.String
+		request.Format = format.String
+		request.Image = image.String
+		request.CallbackURL = callbackURL.String
+		request.RegionFallback = regionFallback.Bool
+		request.DurationSeconds = duration.Float64
+		request.Timestamp = createdAt.Unix()
+		if region.Valid {
+			if err := json.Unmarshal([]byte(region.String), &request.Region); err != nil {
+				return nil, fmt.Errorf("failed to load region of request %s: %w", request.ID, err)
+			}
+		}
+		unanswered = append(unanswered, pending)
+	}
+	return unanswered, rows.Err()
+}
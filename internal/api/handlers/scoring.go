@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"database/sql"
+	"sort"
+
+	"argus-sdr/internal/geometry"
+	"argus-sdr/internal/shared"
+	"argus-sdr/pkg/config"
+)
+
+// strategyWeights returns the weights a selection strategy ranks stations by
+func (h *DataHandler) strategyWeights(strategy string) config.SelectionWeights {
+	switch strategy {
+	case shared.SelectionLeastLoaded:
+		return config.SelectionWeights{Load: 1}
+	case shared.SelectionBestPerformance:
+		return config.SelectionWeights{Success: 1, Response: 1}
+	default:
+		return h.cfg.Server.SelectionWeights
+	}
+}
+
+// stationScore is a station's score and the factor ratings it is made of
+type stationScore struct {
+	Score   float64            `json:"score"`
+	Ratings map[string]float64 `json:"ratings"` // by factor, for the factors with a weight
+}
+
+// rankStations orders stations from the best to the worst to send a request
+// to, by a selection strategy: scored by the strategy's weights and, for
+// SelectionSpread, then spread out. It returns the stations' scores.
+func (h *DataHandler) rankStations(stations []string, strategy string) map[string]*stationScore {
+	if len(stations) == 0 {
+		return nil
+	}
+	scores := h.scoreStations(stations, h.strategyWeights(strategy))
+	if strategy == shared.SelectionSpread {
+		h.spreadStations(stations)
+	}
+	return scores
+}
+
+// scoreStations orders stations by a score from the factors in weights.
+// Each factor rates a station from 0 to 1 and the score is their weighted
+// average:
+//
+//   - load: 1/(1+n) for a station with n requests in flight
+//   - success: the share of its latest requests a station delivered rather than failed
+//   - response: the quickest station's average seconds to deliver plus one, divided by its own plus one
+//   - disk: its free disk space divided by the most any station has free
+//
+// A station a factor knows nothing about, because it has no history or
+// doesn't report its disk space, rates as well as the best one. Stations with
+// the same score keep their order.
+func (h *DataHandler) scoreStations(stations []string, weights config.SelectionWeights) map[string]*stationScore {
+	scores := make(map[string]*stationScore, len(stations))
+	for _, id := range stations {
+		scores[id] = &stationScore{Ratings: make(map[string]float64)}
+	}
+	for _, factor := range []struct {
+		name   string
+		weight int
+		rate   func() (map[string]float64, error)
+	}{
+		{"load", weights.Load, h.loadRatings},
+		{"success", weights.Success, h.successRatings},
+		{"response", weights.Response, h.responseRatings},
+		{"disk", weights.Disk, h.diskRatings},
+	} {
+		if factor.weight == 0 {
+			continue
+		}
+		ratings, err := factor.rate()
+		if err != nil {
+			// Routing still works, just without this factor
+			h.logger.Error("Failed to rate stations by %s: %v", factor.name, err)
+			continue
+		}
+		for _, id := range stations {
+			rating, known := ratings[id]
+			if !known {
+				rating = 1
+			}
+			scores[id].Ratings[factor.name] = rating
+			scores[id].Score += float64(factor.weight) * rating / float64(weights.Total())
+		}
+	}
+
+	sort.SliceStable(stations, func(i, j int) bool {
+		return scores[stations[i]].Score > scores[stations[j]].Score
+	})
+	values := make(map[string]float64, len(scores))
+	for id, score := range scores {
+		values[id] = score.Score
+	}
+	h.logger.Debug("Stations by score: %v (scores %v)", stations, values)
+	return scores
+}
+
+// spreadStations reorders ranked stations so that each one is as far as
+// possible from those before it: the best ranked station with a location
+// comes first, then always the one whose nearest predecessor is farthest
+// away, ties going to the better ranked. Stations without a location follow
+// in their order.
+func (h *DataHandler) spreadStations(stations []string) {
+	locations, err := h.stationLocations(stations)
+	if err != nil {
+		h.logger.Error("Failed to get station locations to spread stations: %v", err)
+		return
+	}
+
+	var located, unlocated []string
+	for _, id := range stations {
+		if _, ok := locations[id]; ok {
+			located = append(located, id)
+		} else {
+			unlocated = append(unlocated, id)
+		}
+	}
+
+	spread := make([]string, 0, len(stations))
+	nearest := make(map[string]float64, len(located))
+	for len(located) > 0 {
+		next := 0
+		if len(spread) > 0 {
+			for i, id := range located {
+				if nearest[id] > nearest[located[next]] {
+					next = i
+				}
+			}
+		}
+		chosen := located[next]
+		located = append(located[:next], located[next+1:]...)
+		spread = append(spread, chosen)
+
+		for _, id := range located {
+			d := geometry.Distance(locations[chosen], locations[id])
+			if current, ok := nearest[id]; !ok || d < current {
+				nearest[id] = d
+			}
+		}
+	}
+	spread = append(spread, unlocated...)
+
+	copy(stations, spread)
+	h.logger.Debug("Stations spread out: %v", stations)
+}
+
+// loadRatings rates the stations by their requests in flight. Idle stations
+// aren't listed and so rate 1.
+func (h *DataHandler) loadRatings() (map[string]float64, error) {
+	loads, err := h.stationLoads()
+	if err != nil {
+		return nil, err
+	}
+	ratings := make(map[string]float64, len(loads))
+	for id, load := range loads {
+		ratings[id] = 1 / float64(1+load)
+	}
+	return ratings, nil
+}
+
+// successRatings rates the stations by the share of their latest
+// etaSampleSize finished requests they delivered
+func (h *DataHandler) successRatings() (map[string]float64, error) {
+	return h.queryRatings(`
+		SELECT station_id, AVG(status = 'ready')
+		FROM (
+			SELECT station_id, status,
+			       ROW_NUMBER() OVER (PARTITION BY station_id ORDER BY completed_at DESC) AS n
+			FROM collector_responses
+			WHERE status IN ('ready', 'error') AND completed_at IS NOT NULL
+		)
+		WHERE n <= ?
+		GROUP BY station_id
+	`, etaSampleSize)
+}
+
+// responseRatings rates the stations by how long their latest etaSampleSize
+// deliveries took, less the capture durations, as estimateCollectionTime
+// does, relative to the quickest station
+func (h *DataHandler) responseRatings() (map[string]float64, error) {
+	seconds, err := h.queryRatings(`
+		SELECT station_id, AVG(seconds)
+		FROM (
+			SELECT cr.station_id,
+			       MAX((julianday(cr.completed_at) - julianday(dr.created_at)) * 86400 - COALESCE(dr.duration_seconds, 0), 0) AS seconds,
+			       ROW_NUMBER() OVER (PARTITION BY cr.station_id ORDER BY cr.completed_at DESC) AS n
+			FROM collector_responses cr
+			JOIN data_requests dr ON dr.id = cr.request_id
+			WHERE cr.status = 'ready' AND cr.completed_at IS NOT NULL
+		)
+		WHERE n <= ?
+		GROUP BY station_id
+	`, etaSampleSize)
+	if err != nil {
+		return nil, err
+	}
+	return relativeRatings(seconds, false), nil
+}
+
+// diskRatings rates the stations by the free disk space they last reported,
+// relative to the station with the most
+func (h *DataHandler) diskRatings() (map[string]float64, error) {
+	free, err := h.queryRatings(`
+		SELECT station_id, disk_free_bytes
+		FROM collector_sessions
+		WHERE disk_free_bytes IS NOT NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return relativeRatings(free, true), nil
+}
+
+// queryRatings runs a query for station IDs and values
+func (h *DataHandler) queryRatings(query string, args ...interface{}) (map[string]float64, error) {
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string]float64)
+	for rows.Next() {
+		var id string
+		var value sql.NullFloat64
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, err
+		}
+		if value.Valid {
+			values[id] = value.Float64
+		}
+	}
+	return values, rows.Err()
+}
+
+// relativeRatings rates values against the best of them, the highest if
+// higherIsBetter and otherwise the lowest, so the best rates 1. Lower values
+// are rated with one added to both, so a best value of 0 doesn't rate every
+// other station 0; a highest value of 0 rates every station 1.
+func relativeRatings(values map[string]float64, higherIsBetter bool) map[string]float64 {
+	var best float64
+	first := true
+	for _, value := range values {
+		if first || (higherIsBetter && value > best) || (!higherIsBetter && value < best) {
+			best, first = value, false
+		}
+	}
+
+	ratings := make(map[string]float64, len(values))
+	for id, value := range values {
+		switch {
+		case !higherIsBetter:
+			ratings[id] = (best + 1) / (value + 1)
+		case best <= 0:
+			ratings[id] = 1
+		default:
+			ratings[id] = value / best
+		}
+	}
+	return ratings
+}
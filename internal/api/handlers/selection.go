@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"argus-sdr/internal/shared"
+)
+
+// errTooFewStations is returned when fewer stations than a request's
+// min_stations are available
+var errTooFewStations = errors.New("fewer stations available than min_stations")
+
+// candidateStations narrows the available stations down to those a request
+// may go to, in the order they should be tried: ranked by the request's
+// selection strategy. want is how many stations the caller is looking for.
+// If plan isn't nil, the decisions are recorded in it.
+//
+// A request with a region gets the stations inside it. If fewer than want are
+// and the request set region_fallback, the region is relaxed and stations
+// outside it follow, so the request still reaches as many stations as it can.
+func (h *DataHandler) candidateStations(stations []string, request shared.DataRequest, want int, plan *selectionPlan) ([]string, error) {
+	if request.Region == nil {
+		plan.addScores(h.rankStations(stations, request.SelectionStrategy))
+		return stations, nil
+	}
+
+	inside, err := h.stationsInRegion(stations, *request.Region)
+	if err != nil {
+		return nil, err
+	}
+	isInside := make(map[string]bool, len(inside))
+	for _, id := range inside {
+		isInside[id] = true
+	}
+	var outside []string
+	for _, id := range stations {
+		if !isInside[id] {
+			outside = append(outside, id)
+		}
+	}
+	plan.setRegion(inside, outside)
+
+	plan.addScores(h.rankStations(inside, request.SelectionStrategy))
+	if len(inside) >= want || !request.RegionFallback {
+		if len(inside) == 0 {
+			return nil, errNoStationsInRegion
+		}
+		return inside, nil
+	}
+
+	plan.addScores(h.rankStations(outside, request.SelectionStrategy))
+	added := outside
+	if len(added) > want-len(inside) {
+		added = added[:want-len(inside)]
+	}
+	candidates := append(inside, outside...)
+	switch {
+	case len(added) > 0 && plan != nil:
+		plan.RegionRelaxed = true
+	case len(added) > 0:
+		h.logger.Info("Only %d of the %d stations wanted for request %s are in its region; relaxed the region to add %v",
+			len(inside), want, request.ID, added)
+	}
+	if len(candidates) == 0 {
+		return nil, errNoStationsInRegion
+	}
+	return candidates, nil
+}
+
+// stationLimit is how many stations a request is sent to at most: its
+// max_stations, if set, or maxCollectorsPerRequest
+func stationLimit(request shared.DataRequest) int {
+	if request.MaxStations > 0 && request.MaxStations < maxCollectorsPerRequest {
+		return request.MaxStations
+	}
+	return maxCollectorsPerRequest
+}
+
+// checkMinStations fails a request that would reach fewer stations than its
+// min_stations. Unlike the region, this is never relaxed.
+func checkMinStations(stations []string, request shared.DataRequest) error {
+	if len(stations) < request.MinStations {
+		return fmt.Errorf("%w: %d available, %d required", errTooFewStations, len(stations), request.MinStations)
+	}
+	return nil
+}
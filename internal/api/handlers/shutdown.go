@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Shutdown tracks what the server has to wind down when it stops: the
+// downloads and uploads being served and the WebSocket clients to tell it is
+// going away
+type Shutdown struct {
+	transfers atomic.Int64
+
+	goingAway   []func(reason string) int
+	goingAwayMu sync.Mutex
+}
+
+// NewShutdown creates a Shutdown with no transfers in flight and no
+// WebSocket clients registered
+func NewShutdown() *Shutdown {
+	return &Shutdown{}
+}
+
+// TrackTransfer counts a file download or upload as in flight until its
+// handler returns, so a shutdown can report what it waits for
+func (s *Shutdown) TrackTransfer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.transfers.Add(1)
+		defer s.transfers.Add(-1)
+		c.Next()
+	}
+}
+
+// InFlightTransfers returns the number of downloads and uploads being served.
+// WebRTC transfers go peer-to-peer and aren't counted.
+func (s *Shutdown) InFlightTransfers() int64 {
+	return s.transfers.Load()
+}
+
+// OnShutdown registers a function that tells one kind of WebSocket client the
+// server is going away and returns how many it told
+func (s *Shutdown) OnShutdown(f func(reason string) int) {
+	s.goingAwayMu.Lock()
+	s.goingAway = append(s.goingAway, f)
+	s.goingAwayMu.Unlock()
+}
+
+// GoingAway tells every WebSocket client registered with OnShutdown that the
+// server is going away and returns how many were told
+func (s *Shutdown) GoingAway(reason string) int {
+	s.goingAwayMu.Lock()
+	defer s.goingAwayMu.Unlock()
+
+	notified := 0
+	for _, f := range s.goingAway {
+		notified += f(reason)
+	}
+	return notified
+}
+
+// sendGoingAway starts the close handshake with 1001 (going away), so clients
+// reconnect instead of treating the closed connection as an error. The
+// connection itself is closed by its read loop once the client answers.
+func sendGoingAway(conn *websocket.Conn, reason string) bool {
+	err := conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseGoingAway, reason),
+		time.Now().Add(time.Second))
+	return err == nil
+}
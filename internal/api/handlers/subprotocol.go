@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"argus-sdr/internal/shared"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// checkSubprotocol refuses a WebSocket upgrade that only offers subprotocols
+// this server doesn't speak. Clients that offer none predate subprotocols
+// and are let through. If it refuses, it responds and returns false.
+func checkSubprotocol(c *gin.Context) bool {
+	offered := websocket.Subprotocols(c.Request)
+	if len(offered) == 0 || shared.SupportsSubprotocol(offered) {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":                  fmt.Sprintf("Unsupported WebSocket subprotocol: %s", strings.Join(offered, ", ")),
+		"supported_subprotocols": shared.WebSocketSubprotocols,
+	})
+	return false
+}
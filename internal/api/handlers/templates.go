@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"argus-sdr/internal/collector"
+	"argus-sdr/internal/convert"
+	"argus-sdr/internal/database"
+	"argus-sdr/internal/geometry"
+	"argus-sdr/internal/shared"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestTemplate is a named set of request fields a user saved to reuse.
+// POST /api/data/request with its template_id starts from these fields.
+type requestTemplate struct {
+	ID              int64            `json:"id"`
+	Name            string           `json:"name"`
+	RequestType     string           `json:"request_type,omitempty"`
+	Parameters      string           `json:"parameters,omitempty"`
+	Format          string           `json:"format,omitempty"`
+	Image           string           `json:"image,omitempty"`
+	Region          *geometry.Region `json:"region,omitempty"`
+	DurationSeconds float64          `json:"duration_seconds,omitempty"`
+	CreatedAt       string           `json:"created_at,omitempty"`
+}
+
+// validateTemplate checks a template's fields like those of a request
+func (h *DataHandler) validateTemplate(template requestTemplate) error {
+	if _, err := convert.Lookup(template.Format); err != nil {
+		return err
+	}
+	if template.Region != nil {
+		if err := template.Region.Validate(); err != nil {
+			return fmt.Errorf("invalid region: %w", err)
+		}
+	}
+	if err := h.checkDurationSeconds(template.DurationSeconds); err != nil {
+		return err
+	}
+	return collector.ValidateParameters(template.Parameters, template.DurationSeconds)
+}
+
+// checkDurationSeconds checks a duration_seconds against
+// CAPTURE_MIN_DURATION_SECONDS and CAPTURE_MAX_DURATION_SECONDS (0 means none)
+func (h *DataHandler) checkDurationSeconds(seconds float64) error {
+	if seconds == 0 {
+		return nil
+	}
+	minDuration, maxDuration := h.cfg.Server.CaptureMinDuration, h.cfg.Server.CaptureMaxDuration
+	if seconds < float64(minDuration) || seconds > float64(maxDuration) {
+		return fmt.Errorf("duration_seconds must be between %d and %d", minDuration, maxDuration)
+	}
+	return nil
+}
+
+// CreateTemplate handles POST /api/data/templates
+func (h *DataHandler) CreateTemplate(c *gin.Context) {
+	var template requestTemplate
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	template.Name = strings.TrimSpace(template.Name)
+	if template.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template name is required"})
+		return
+	}
+	if err := h.validateTemplate(template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	var existingID int64
+	err := h.db.QueryRow("SELECT id FROM request_templates WHERE user_id = ? AND name = ?", userID, template.Name).Scan(&existingID)
+	if err != sql.ErrNoRows {
+		if err != nil {
+			h.logger.Error("Failed to look up template %q of user %d: %v", template.Name, userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save template"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A template named %q already exists", template.Name)})
+		return
+	}
+
+	var region interface{}
+	if template.Region != nil {
+		encoded, err := json.Marshal(template.Region)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid region: " + err.Error()})
+			return
+		}
+		region = string(encoded)
+	}
+
+	query := `
+		INSERT INTO request_templates (user_id, name, request_type, parameters, format, image, region, duration_seconds)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := database.ExecWithRetry(h.db, query, userID, template.Name, template.RequestType,
+		template.Parameters, template.Format, template.Image, region, template.DurationSeconds)
+	if err != nil {
+		h.logger.Error("Failed to save template %q of user %d: %v", template.Name, userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save template"})
+		return
+	}
+	template.ID, _ = result.LastInsertId()
+
+	h.logger.Info("User %d saved request template %d (%s)", userID, template.ID, template.Name)
+	c.JSON(http.StatusCreated, template)
+}
+
+// ListTemplates handles GET /api/data/templates
+func (h *DataHandler) ListTemplates(c *gin.Context) {
+	templates, err := h.userTemplates(c.GetInt("user_id"), 0)
+	if err != nil {
+		h.logger.Error("Failed to list templates of user %d: %v", c.GetInt("user_id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get templates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// DeleteTemplate handles DELETE /api/data/templates/:id
+func (h *DataHandler) DeleteTemplate(c *gin.Context) {
+	templateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	result, err := database.ExecWithRetry(h.db, "DELETE FROM request_templates WHERE id = ? AND user_id = ?", templateID, userID)
+	if err != nil {
+		h.logger.Error("Failed to delete template %d of user %d: %v", templateID, userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template"})
+		return
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	h.logger.Info("User %d deleted request template %d", userID, templateID)
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted", "id": templateID})
+}
+
+// userTemplates returns a user's templates by name, or only the one with
+// templateID if it isn't 0
+func (h *DataHandler) userTemplates(userID int, templateID int64) ([]requestTemplate, error) {
+	query := `
+		SELECT id, name, request_type, parameters, format, image, region, duration_seconds, created_at
+		FROM request_templates
+		WHERE user_id = ? AND (? = 0 OR id = ?)
+		ORDER BY name
+	`
+	rows, err := h.db.Query(query, userID, templateID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []requestTemplate{}
+	for rows.Next() {
+		var template requestTemplate
+		var requestType, parameters, format, image, region, createdAt sql.NullString
+		var duration sql.NullFloat64
+		if err := rows.Scan(&template.ID, &template.Name, &requestType, &parameters, &format, &image,
+			&region, &duration, &createdAt); err != nil {
+			return nil, err
+		}
+		template.RequestType = requestType.String
+		template.Parameters = parameters.String
+		template.Format = format.String
+		template.Image = image.String
+		template.DurationSeconds = duration.Float64
+		template.CreatedAt = createdAt.String
+		if region.Valid && region.String != "" {
+			if err := json.Unmarshal([]byte(region.String), &template.Region); err != nil {
+				return nil, fmt.Errorf("failed to load region of template %d: %w", template.ID, err)
+			}
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// applyTemplate fills in the fields a request leaves out from a template.
+// The request's parameters are merged over the template's, so a request can
+// change single parameters.
+func applyTemplate(request *shared.DataRequest, template requestTemplate) error {
+	if request.RequestType == "" {
+		request.RequestType = template.RequestType
+	}
+	if request.Format == "" {
+		request.Format = template.Format
+	}
+	if request.Image == "" {
+		request.Image = template.Image
+	}
+	if request.Region == nil {
+		request.Region = template.Region
+	}
+	if request.DurationSeconds == 0 {
+		request.DurationSeconds = template.DurationSeconds
+	}
+
+	if request.Parameters == "" || template.Parameters == "" {
+		if request.Parameters == "" {
+			request.Parameters = template.Parameters
+		}
+		return nil
+	}
+	var merged, overrides map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(template.Parameters), &merged); err != nil {
+		return fmt.Errorf("template parameters must be a JSON object: %w", err)
+	}
+	if err := json.Unmarshal([]byte(request.Parameters), &overrides); err != nil {
+		return fmt.Errorf("parameters must be a JSON object: %w", err)
+	}
+	if merged == nil {
+		merged = make(map[string]json.RawMessage)
+	}
+	for name, value := range overrides {
+		merged[name] = value
+	}
+	parameters, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	request.Parameters = string(parameters)
+	return nil
+}
@@ -3,11 +3,17 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"argus-sdr/internal/database"
 	"argus-sdr/internal/models"
+	"argus-sdr/internal/shared"
 	"argus-sdr/pkg/config"
 	"argus-sdr/pkg/logger"
 
@@ -22,19 +28,32 @@ type WebSocketConnection struct {
 	ConnectionID string
 	UserID       int
 	Conn         *websocket.Conn
-	Send         chan []byte
+	Send         *shared.Queue[[]byte]
 }
 
 // ConnectionManager manages active WebSocket connections
 type ConnectionManager struct {
-	connections map[string]*WebSocketConnection
-	mutex       sync.RWMutex
-	log         *logger.Logger
+	connections  map[string]*WebSocketConnection
+	mutex        sync.RWMutex
+	log          *logger.Logger
+	sendOverflow string             // overflow policy of client send queues
+	drops        *shared.QueueDrops // messages dropped from client send queues
 }
 
-// Global connection manager instance
-var connManager = &ConnectionManager{
-	connections: make(map[string]*WebSocketConnection),
+// NewConnectionManager creates a manager for Type 1 client connections whose
+// send queues overflow according to sendOverflow
+func NewConnectionManager(log *logger.Logger, sendOverflow string) *ConnectionManager {
+	return &ConnectionManager{
+		connections:  make(map[string]*WebSocketConnection),
+		log:          log,
+		sendOverflow: sendOverflow,
+		drops:        shared.NewQueueDrops(),
+	}
+}
+
+// QueueDrops returns the number of messages dropped from client send queues
+func (cm *ConnectionManager) QueueDrops() map[string]int64 {
+	return cm.drops.Counts()
 }
 
 type Type1Handler struct {
@@ -42,21 +61,51 @@ type Type1Handler struct {
 	log      *logger.Logger
 	cfg      *config.Config
 	upgrader websocket.Upgrader
+
+	// The live connections; active_connections in the database only mirrors them
+	connections *ConnectionManager
+
+	// Requests sent with SendRequestAndWait that are waiting for a reply, keyed by request ID
+	pending   map[string]*pendingRequest
+	pendingMu sync.Mutex
+
+	limiter *ConnectionLimiter
+}
+
+// pendingRequest is a request waiting for a Type 1 client's reply
+type pendingRequest struct {
+	connID string
+	reply  chan []byte // receives the reply, or is closed if the client disconnects
 }
 
-func NewType1Handler(db *sql.DB, log *logger.Logger, cfg *config.Config) *Type1Handler {
-	// Initialize the global connection manager with logger
-	connManager.log = log
-	
+var (
+	// ErrClientNotConnected is returned when a request targets a connection that doesn't exist
+	ErrClientNotConnected = errors.New("type 1 client not connected")
+	// ErrRequestTimeout is returned when a Type 1 client doesn't reply in time
+	ErrRequestTimeout = errors.New("type 1 client did not respond in time")
+)
+
+func NewType1Handler(db *sql.DB, log *logger.Logger, cfg *config.Config, connections *ConnectionManager, limits *ConnectionLimits) *Type1Handler {
 	return &Type1Handler{
-		db:  db,
-		log: log,
-		cfg: cfg,
+		db:      db,
+		log:     log,
+		cfg:     cfg,
+		pending: make(map[string]*pendingRequest),
+		limiter: limits.Limiter("type1", cfg.Server.MaxType1Connections),
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Allow all origins for now
 			},
 		},
+		connections: connections,
+	}
+}
+
+// type1SendPolicy returns the overflow policy for Type 1 client send queues
+func type1SendPolicy(cfg *config.Config) shared.OverflowPolicy {
+	return shared.OverflowPolicy{
+		Policy:       cfg.Queues.Type1SendOverflow,
+		BlockTimeout: time.Duration(cfg.Queues.BlockTimeout) * time.Second,
 	}
 }
 
@@ -74,39 +123,69 @@ func (cm *ConnectionManager) RemoveConnection(connID string) {
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
 	if conn, exists := cm.connections[connID]; exists {
-		close(conn.Send)
+		conn.Send.Close()
 		delete(cm.connections, connID)
 	}
 }
 
-// BroadcastToType1Clients sends a message to all connected Type 1 clients
+// BroadcastToType1Clients sends a message to all connected Type 1 clients.
+// Messages are queued after the lock is released, since a full queue under
+// the block policy can wait, and RemoveConnection needs the lock.
 func (cm *ConnectionManager) BroadcastToType1Clients(message []byte) {
 	cm.mutex.RLock()
-	defer cm.mutex.RUnlock()
-
+	conns := make([]*WebSocketConnection, 0, len(cm.connections))
 	for _, conn := range cm.connections {
-		select {
-		case conn.Send <- message:
-		default:
-			// Client's send channel is full, skip
-		}
+		conns = append(conns, conn)
+	}
+	cm.mutex.RUnlock()
+
+	for _, conn := range conns {
+		cm.enqueue(conn, message)
 	}
 }
 
 // SendToClient sends a message to a specific client by connection ID
 func (cm *ConnectionManager) SendToClient(connID string, message []byte) bool {
+	conn, exists := cm.connection(connID)
+	if !exists {
+		return false
+	}
+	return cm.enqueue(conn, message)
+}
+
+// enqueue queues a message for a client according to the send queue's overflow
+// policy. Clients that overflow under the disconnect policy are disconnected;
+// closing the connection makes its read pump exit and clean up. It must not be
+// called with the manager's lock held.
+func (cm *ConnectionManager) enqueue(conn *WebSocketConnection, message []byte) bool {
+	err := conn.Send.Put(message)
+	if errors.Is(err, shared.ErrQueueClosed) {
+		cm.log.Debug("Type 1 client %d disconnected before a message could be queued", conn.ClientID)
+		return false
+	}
+	if err != nil {
+		cm.log.Warn("Dropped message for Type 1 client %d: %v (%d dropped so far)", conn.ClientID, err, conn.Send.Dropped())
+		if cm.sendOverflow == shared.OverflowDisconnect {
+			conn.Conn.Close()
+		}
+		return false
+	}
+	return true
+}
+
+// GoingAway tells every connected Type 1 client the server is going away and
+// returns how many were told
+func (cm *ConnectionManager) GoingAway(reason string) int {
 	cm.mutex.RLock()
 	defer cm.mutex.RUnlock()
 
-	if conn, exists := cm.connections[connID]; exists {
-		select {
-		case conn.Send <- message:
-			return true
-		default:
-			return false
+	notified := 0
+	for _, conn := range cm.connections {
+		if sendGoingAway(conn.Conn, reason) {
+			notified++
 		}
 	}
-	return false
+	return notified
 }
 
 // GetConnectedClients returns a list of all connected Type 1 client IDs
@@ -121,6 +200,124 @@ func (cm *ConnectionManager) GetConnectedClients() []int {
 	return clientIDs
 }
 
+// clientsByConnection returns the client ID of every live connection, by
+// connection ID
+func (cm *ConnectionManager) clientsByConnection() map[string]int {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	clients := make(map[string]int, len(cm.connections))
+	for connID, conn := range cm.connections {
+		clients[connID] = conn.ClientID
+	}
+	return clients
+}
+
+// connection returns an active connection by connection ID
+func (cm *ConnectionManager) connection(connID string) (*WebSocketConnection, bool) {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	conn, exists := cm.connections[connID]
+	return conn, exists
+}
+
+// connectionForClient returns the active connection of a Type 1 client
+func (cm *ConnectionManager) connectionForClient(clientID int) (*WebSocketConnection, bool) {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	for _, conn := range cm.connections {
+		if conn.ClientID == clientID {
+			return conn, true
+		}
+	}
+	return nil, false
+}
+
+// SendRequestAndWait sends a request to a Type 1 client and waits for the
+// reply with the same request_id. msg must marshal to a JSON object with a
+// non-empty request_id; the raw reply message is returned.
+func (h *Type1Handler) SendRequestAndWait(connID string, msg interface{}, timeout time.Duration) ([]byte, error) {
+	message, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	var envelope struct {
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil || envelope.RequestID == "" {
+		return nil, errors.New("request must have a request_id")
+	}
+
+	conn, exists := h.connections.connection(connID)
+	if !exists {
+		return nil, ErrClientNotConnected
+	}
+
+	pending := &pendingRequest{connID: connID, reply: make(chan []byte, 1)}
+	h.pendingMu.Lock()
+	if _, duplicate := h.pending[envelope.RequestID]; duplicate {
+		h.pendingMu.Unlock()
+		return nil, fmt.Errorf("request %s is already pending", envelope.RequestID)
+	}
+	h.pending[envelope.RequestID] = pending
+	h.pendingMu.Unlock()
+
+	defer func() {
+		h.pendingMu.Lock()
+		if h.pending[envelope.RequestID] == pending {
+			delete(h.pending, envelope.RequestID)
+		}
+		h.pendingMu.Unlock()
+	}()
+
+	if !h.connections.enqueue(conn, message) {
+		return nil, fmt.Errorf("failed to queue request for client %d", conn.ClientID)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case reply, ok := <-pending.reply:
+		if !ok {
+			return nil, ErrClientNotConnected
+		}
+		return reply, nil
+	case <-timer.C:
+		return nil, ErrRequestTimeout
+	}
+}
+
+// resolvePending delivers a reply to the matching SendRequestAndWait call.
+// Replies from a different connection than the request went to are ignored.
+func (h *Type1Handler) resolvePending(connID, requestID string, message []byte) bool {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+
+	pending, exists := h.pending[requestID]
+	if !exists || pending.connID != connID {
+		return false
+	}
+	delete(h.pending, requestID)
+	pending.reply <- message
+	return true
+}
+
+// failPending wakes up requests waiting on a connection that has closed
+func (h *Type1Handler) failPending(connID string) {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+
+	for requestID, pending := range h.pending {
+		if pending.connID == connID {
+			close(pending.reply)
+			delete(h.pending, requestID)
+		}
+	}
+}
+
 // NotifyType1Clients sends an ICE session notification to all Type 1 clients
 func (h *Type1Handler) NotifyType1Clients(sessionID, requestType string, userID int) error {
 	notification := map[string]interface{}{
@@ -136,7 +333,7 @@ func (h *Type1Handler) NotifyType1Clients(sessionID, requestType string, userID
 		return err
 	}
 
-	connManager.BroadcastToType1Clients(messageBytes)
+	h.connections.BroadcastToType1Clients(messageBytes)
 	h.log.Info("Notified Type 1 clients about ICE session: %s", sessionID)
 	return nil
 }
@@ -248,21 +445,43 @@ func (h *Type1Handler) WebSocketHandler(c *gin.Context) {
 		h.log.Error("Failed to upgrade to WebSocket: %v", err)
 		return
 	}
+
+	if !h.limiter.Acquire() {
+		h.log.Warn("Rejecting Type 1 connection for client %d: limit of %d reached", clientID, h.cfg.Server.MaxType1Connections)
+		h.limiter.Reject(conn)
+		return
+	}
+	defer h.limiter.Release()
 	defer conn.Close()
 
-	// Generate connection ID and store in database
+	// Generate connection ID
 	connectionID := uuid.New().String()
+
+	// Create WebSocket connection object
+	wsConn := &WebSocketConnection{
+		ClientID:     clientID,
+		ConnectionID: connectionID,
+		UserID:       userID.(int),
+		Conn:         conn,
+		Send:         shared.NewQueue[[]byte]("type1_send", h.cfg.Queues.Type1SendBuffer, type1SendPolicy(h.cfg), h.connections.drops),
+	}
+
+	// Add to connection manager before storing it, so reconciliation never
+	// finds a stored connection that isn't live yet
+	h.connections.AddConnection(connectionID, wsConn)
+
 	_, err = h.db.Exec(
 		"INSERT INTO active_connections (client_id, connection_id) VALUES (?, ?)",
 		clientID, connectionID,
 	)
 	if err != nil {
 		h.log.Error("Failed to store connection: %v", err)
+		h.connections.RemoveConnection(connectionID)
 		return
 	}
 
 	// Update client status to connected
-	_, err = h.db.Exec(
+	_, err = database.ExecWithRetry(h.db,
 		"UPDATE type1_clients SET status = 'connected', last_seen = CURRENT_TIMESTAMP WHERE id = ?",
 		clientID,
 	)
@@ -270,26 +489,15 @@ func (h *Type1Handler) WebSocketHandler(c *gin.Context) {
 		h.log.Error("Failed to update client status: %v", err)
 	}
 
-	// Create WebSocket connection object
-	wsConn := &WebSocketConnection{
-		ClientID:     clientID,
-		ConnectionID: connectionID,
-		UserID:       userID.(int),
-		Conn:         conn,
-		Send:         make(chan []byte, 256),
-	}
-
-	// Add to connection manager
-	connManager.AddConnection(connectionID, wsConn)
-
 	h.log.Info("Type 1 client connected: client_id=%d, connection_id=%s", clientID, connectionID)
 
 	// Handle WebSocket messages with separate read/write goroutines
 	defer func() {
 		// Clean up connection when done
-		connManager.RemoveConnection(connectionID)
-		h.db.Exec("DELETE FROM active_connections WHERE connection_id = ?", connectionID)
-		h.db.Exec(
+		h.connections.RemoveConnection(connectionID)
+		h.failPending(connectionID)
+		database.ExecWithRetry(h.db, "DELETE FROM active_connections WHERE connection_id = ?", connectionID)
+		database.ExecWithRetry(h.db,
 			"UPDATE type1_clients SET status = 'disconnected', last_seen = CURRENT_TIMESTAMP WHERE id = ?",
 			clientID,
 		)
@@ -318,7 +526,10 @@ func (h *Type1Handler) readPump(wsConn *WebSocketConnection) {
 		// Read message from client
 		_, message, err := wsConn.Conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				h.log.Warn("Type 1 client %d missed liveness deadline, closing connection", wsConn.ClientID)
+				h.limiter.Evicted()
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				h.log.Error("WebSocket error: %v", err)
 			}
 			break
@@ -336,19 +547,21 @@ func (h *Type1Handler) writePump(wsConn *WebSocketConnection) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer func() {
 		ticker.Stop()
+		// Nothing drains the queue anymore, so don't let producers wait on it
+		wsConn.Send.Close()
 		wsConn.Conn.Close()
 	}()
 
 	for {
 		select {
-		case message, ok := <-wsConn.Send:
+		case <-wsConn.Send.Closed():
+			// The connection manager removed the connection
 			wsConn.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				// The connection manager closed the channel
-				wsConn.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
+			wsConn.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
 
+		case message := <-wsConn.Send.C:
+			wsConn.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if err := wsConn.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
 				h.log.Error("Failed to write message: %v", err)
 				return
@@ -379,6 +592,17 @@ func (h *Type1Handler) handleClientMessage(wsConn *WebSocketConnection, message
 		return
 	}
 
+	// Replies to SendRequestAndWait carry the request ID they answer
+	if requestID, ok := msg["request_id"].(string); ok && requestID != "" {
+		if h.resolvePending(wsConn.ConnectionID, requestID, message) {
+			return
+		}
+		if strings.HasSuffix(msgType, "_response") {
+			h.log.Debug("Ignoring late or unknown %s %s from client %d", msgType, requestID, wsConn.ClientID)
+			return
+		}
+	}
+
 	switch msgType {
 	case "ice_response":
 		// Handle ICE session response from Type 1 client
@@ -390,10 +614,7 @@ func (h *Type1Handler) handleClientMessage(wsConn *WebSocketConnection, message
 			"timestamp": time.Now().UTC(),
 		}
 		responseBytes, _ := json.Marshal(response)
-		select {
-		case wsConn.Send <- responseBytes:
-		default:
-		}
+		h.connections.enqueue(wsConn, responseBytes)
 	default:
 		h.log.Debug("Unknown message type from client %d: %s", wsConn.ClientID, msgType)
 	}
@@ -415,7 +636,7 @@ func (h *Type1Handler) handleICEResponse(wsConn *WebSocketConnection, msg map[st
 
 	if accepted {
 		// Update session with the responding client
-		_, err := h.db.Exec(`
+		_, err := database.ExecWithRetry(h.db, `
 			UPDATE ice_sessions
 			SET target_user_id = ?, status = 'accepted', updated_at = CURRENT_TIMESTAMP
 			WHERE session_id = ?
@@ -430,4 +651,105 @@ func (h *Type1Handler) handleICEResponse(wsConn *WebSocketConnection, msg map[st
 	} else {
 		h.log.Info("Type 1 client %d declined ICE session %s", wsConn.ClientID, sessionID)
 	}
-}
\ No newline at end of file
+}
+
+// ReconcileConnections brings the database in line with the live Type 1
+// connections every interval. A handler that dies without running its cleanup
+// leaves connections in the database that are gone; rows removed from under a
+// live connection leave it unlisted.
+func (h *Type1Handler) ReconcileConnections(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := h.reconcileConnections(); err != nil {
+			h.log.Error("Failed to reconcile Type 1 connections: %v", err)
+		}
+	}
+}
+
+// reconcileConnections deletes stored connections that aren't live and marks
+// their clients disconnected, and stores live connections that are missing
+// and marks their clients connected. A client connecting or disconnecting
+// meanwhile may be put right only on the next run.
+func (h *Type1Handler) reconcileConnections() error {
+	live := h.connections.clientsByConnection()
+
+	stored := make(map[string]bool)
+	rows, err := h.db.Query("SELECT connection_id FROM active_connections")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var connID string
+		if err := rows.Scan(&connID); err != nil {
+			rows.Close()
+			return err
+		}
+		stored[connID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for connID := range stored {
+		if _, exists := live[connID]; exists {
+			continue
+		}
+		h.log.Warn("Removing stale Type 1 connection %s", connID)
+		if _, err := database.ExecWithRetry(h.db, "DELETE FROM active_connections WHERE connection_id = ?", connID); err != nil {
+			return err
+		}
+	}
+	connected := make(map[int]bool)
+	for connID, clientID := range live {
+		connected[clientID] = true
+		if stored[connID] {
+			continue
+		}
+		h.log.Warn("Restoring missing Type 1 connection %s of client %d", connID, clientID)
+		if _, err := database.ExecWithRetry(h.db,
+			"INSERT OR IGNORE INTO active_connections (client_id, connection_id) VALUES (?, ?)",
+			clientID, connID,
+		); err != nil {
+			return err
+		}
+	}
+
+	// A client is connected exactly when it has a live connection
+	rows, err = h.db.Query("SELECT id, status FROM type1_clients WHERE status = 'connected' OR id IN (SELECT client_id FROM active_connections)")
+	if err != nil {
+		return err
+	}
+	wrong := make(map[int]string)
+	for rows.Next() {
+		var clientID int
+		var status string
+		if err := rows.Scan(&clientID, &status); err != nil {
+			rows.Close()
+			return err
+		}
+		switch {
+		case status == "connected" && !connected[clientID]:
+			wrong[clientID] = "disconnected"
+		case status != "connected" && connected[clientID]:
+			wrong[clientID] = "connected"
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for clientID, status := range wrong {
+		h.log.Warn("Marking Type 1 client %d %s", clientID, status)
+		if _, err := database.ExecWithRetry(h.db,
+			"UPDATE type1_clients SET status = ?, last_seen = CURRENT_TIMESTAMP WHERE id = ?",
+			status, clientID,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
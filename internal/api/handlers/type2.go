@@ -2,33 +2,48 @@ package handlers
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
 	"math/rand"
 	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
+	"argus-sdr/internal/models"
 	"argus-sdr/pkg/config"
 	"argus-sdr/pkg/logger"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type Type2Handler struct {
-	db  *sql.DB
-	log *logger.Logger
-	cfg *config.Config
+	db    *sql.DB
+	log   *logger.Logger
+	cfg   *config.Config
+	type1 *Type1Handler
+
+	// The live Type 1 connections, shared with type1
+	connections *ConnectionManager
 }
 
-func NewType2Handler(db *sql.DB, log *logger.Logger, cfg *config.Config) *Type2Handler {
+func NewType2Handler(db *sql.DB, log *logger.Logger, cfg *config.Config, type1 *Type1Handler, connections *ConnectionManager) *Type2Handler {
 	return &Type2Handler{
-		db:  db,
-		log: log,
-		cfg: cfg,
+		db:          db,
+		log:         log,
+		cfg:         cfg,
+		type1:       type1,
+		connections: connections,
 	}
 }
 
 func (h *Type2Handler) GetAvailability(c *gin.Context) {
 	// Get connected clients from the connection manager instead of database
 	// This ensures we only count actually connected clients
-	connectedClientIDs := connManager.GetConnectedClients()
+	connectedClientIDs := h.connections.GetConnectedClients()
 	connectedCount := len(connectedClientIDs)
 	minimumClients := 1
 
@@ -41,7 +56,39 @@ func (h *Type2Handler) GetAvailability(c *gin.Context) {
 	})
 }
 
+// Default measurement ranges when the request doesn't specify one
+const (
+	defaultSpectrumStartHz = 88.0e6
+	defaultSpectrumEndHz   = 108.0e6
+	defaultSpectrumBins    = 5
+	defaultSignalCenterHz  = 100.1e6
+	maxSpectrumBins        = 4096
+)
+
+// GetSpectrum handles GET /api/data/spectrum. Spectrum samples are requested
+// from the selected Type 1 clients and their power levels averaged per bin.
+// Optional query parameters: start_hz, end_hz, bins.
 func (h *Type2Handler) GetSpectrum(c *gin.Context) {
+	startHz, err := floatQuery(c, "start_hz", defaultSpectrumStartHz)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	endHz, err := floatQuery(c, "end_hz", defaultSpectrumEndHz)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	bins, err := strconv.Atoi(c.DefaultQuery("bins", strconv.Itoa(defaultSpectrumBins)))
+	if err != nil || bins < 1 || bins > maxSpectrumBins {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("bins must be between 1 and %d", maxSpectrumBins)})
+		return
+	}
+	if startHz <= 0 || endHz <= startHz {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_hz must be greater than start_hz"})
+		return
+	}
+
 	// Check if we have enough Type 1 clients
 	selectedClients, err := h.selectType1Clients()
 	if err != nil {
@@ -50,30 +97,78 @@ func (h *Type2Handler) GetSpectrum(c *gin.Context) {
 		return
 	}
 
-	// For now, return mock data
-	// In a real implementation, this would request data from the selected Type 1 clients
-	// via their WebSocket connections and aggregate the results
+	replies, missing := h.requestFromClients(selectedClients, func(requestID string) interface{} {
+		return models.SpectrumRequest{
+			Type:      "spectrum_request",
+			RequestID: requestID,
+			StartHz:   startHz,
+			EndHz:     endHz,
+			Bins:      bins,
+			Timestamp: time.Now().UTC(),
+		}
+	})
+
+	var responses []models.SpectrumResponse
+	responded := []int{}
+	for clientID, reply := range replies {
+		var response models.SpectrumResponse
+		if err := json.Unmarshal(reply, &response); err != nil || response.Error != "" || len(response.PowerLevels) != bins {
+			h.log.Warn("Discarding spectrum response from client %d: err=%v, error=%q, bins=%d", clientID, err, response.Error, len(response.PowerLevels))
+			missing = append(missing, clientID)
+			continue
+		}
+		responses = append(responses, response)
+		responded = append(responded, clientID)
+	}
+	sort.Ints(responded)
+	sort.Ints(missing)
 
-	spectrumData := gin.H{
+	userID, _ := c.Get("user_id")
+	h.log.Info("Spectrum data requested by user %v from clients %v (%d responded)", userID, selectedClients, len(responses))
+
+	if len(responses) == 0 {
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error":                  "No Type 1 clients returned spectrum data",
+			"requested_from_clients": selectedClients,
+		})
+		return
+	}
+
+	powerLevels := make([]float64, bins)
+	for i := range powerLevels {
+		levels := make([]float64, len(responses))
+		for j, response := range responses {
+			levels[j] = response.PowerLevels[i]
+		}
+		powerLevels[i] = averageDBm(levels)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
 		"requested_from_clients": selectedClients,
+		"responded_clients":      responded,
+		"missing_clients":        missing,
+		"partial":                len(missing) > 0,
 		"spectrum_data": gin.H{
 			"frequency_range": gin.H{
-				"start": "88.0 MHz",
-				"end":   "108.0 MHz",
+				"start_hz": startHz,
+				"end_hz":   endHz,
 			},
-			"power_levels": []float64{-65.2, -67.1, -63.5, -70.0, -68.9}, // Mock data
-			"timestamp":    "2024-01-01T12:00:00Z",
+			"power_levels": powerLevels,
+			"timestamp":    time.Now().UTC(),
 		},
 		"aggregation_method": "average",
-	}
-
-	userID, _ := c.Get("user_id")
-	h.log.Info("Spectrum data requested by user %v from clients %v", userID, selectedClients)
-
-	c.JSON(http.StatusOK, spectrumData)
+	})
 }
 
+// GetSignal handles GET /api/data/signal. Signal measurements at the
+// requested center frequency (center_hz) are combined across Type 1 clients.
 func (h *Type2Handler) GetSignal(c *gin.Context) {
+	centerHz, err := floatQuery(c, "center_hz", defaultSignalCenterHz)
+	if err != nil || centerHz <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "center_hz must be a positive number"})
+		return
+	}
+
 	selectedClients, err := h.selectType1Clients()
 	if err != nil {
 		h.log.Error("Failed to select Type 1 clients: %v", err)
@@ -81,24 +176,146 @@ func (h *Type2Handler) GetSignal(c *gin.Context) {
 		return
 	}
 
-	// Mock signal analysis data
-	signalData := gin.H{
+	replies, missing := h.requestFromClients(selectedClients, func(requestID string) interface{} {
+		return models.SignalRequest{
+			Type:            "signal_request",
+			RequestID:       requestID,
+			CenterFrequency: centerHz,
+			Timestamp:       time.Now().UTC(),
+		}
+	})
+
+	var responses []models.SignalResponse
+	responded := []int{}
+	for clientID, reply := range replies {
+		var response models.SignalResponse
+		if err := json.Unmarshal(reply, &response); err != nil || response.Error != "" {
+			h.log.Warn("Discarding signal response from client %d: err=%v, error=%q", clientID, err, response.Error)
+			missing = append(missing, clientID)
+			continue
+		}
+		responses = append(responses, response)
+		responded = append(responded, clientID)
+	}
+	sort.Ints(responded)
+	sort.Ints(missing)
+
+	userID, _ := c.Get("user_id")
+	h.log.Info("Signal analysis requested by user %v from clients %v (%d responded)", userID, selectedClients, len(responses))
+
+	if len(responses) == 0 {
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error":                  "No Type 1 clients returned signal data",
+			"requested_from_clients": selectedClients,
+		})
+		return
+	}
+
+	// Strength is averaged in linear power, SNR and bandwidth arithmetically,
+	// and the modulation is whatever most clients reported
+	strengths := make([]float64, len(responses))
+	var snr, bandwidth float64
+	modulations := make(map[string]int)
+	for i, response := range responses {
+		strengths[i] = response.SignalStrength
+		snr += response.SNR
+		bandwidth += response.Bandwidth
+		modulations[response.Modulation]++
+	}
+	count := float64(len(responses))
+
+	c.JSON(http.StatusOK, gin.H{
 		"requested_from_clients": selectedClients,
+		"responded_clients":      responded,
+		"missing_clients":        missing,
+		"partial":                len(missing) > 0,
 		"signal_analysis": gin.H{
-			"center_frequency": "100.1 MHz",
-			"bandwidth":        "200 kHz",
-			"signal_strength":  -45.3,
-			"snr":              25.7,
-			"modulation":       "FM",
-			"timestamp":        "2024-01-01T12:00:00Z",
+			"center_frequency_hz": centerHz,
+			"bandwidth_hz":        bandwidth / count,
+			"signal_strength":     averageDBm(strengths),
+			"snr":                 snr / count,
+			"modulation":          mostCommon(modulations),
+			"timestamp":           time.Now().UTC(),
 		},
 		"analysis_method": "combined",
+	})
+}
+
+// requestFromClients sends a measurement request to each client and waits for
+// their replies until the response timeout. It returns the raw replies by
+// client ID and the clients that didn't reply.
+func (h *Type2Handler) requestFromClients(clientIDs []int, build func(requestID string) interface{}) (map[int][]byte, []int) {
+	timeout := time.Duration(h.cfg.Server.Type1ResponseTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
 	}
 
-	userID, _ := c.Get("user_id")
-	h.log.Info("Signal analysis requested by user %v from clients %v", userID, selectedClients)
+	received := make(map[int][]byte)
+	var missing []int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, clientID := range clientIDs {
+		conn, connected := h.connections.connectionForClient(clientID)
+		if !connected {
+			missing = append(missing, clientID)
+			continue
+		}
+
+		wg.Add(1)
+		go func(clientID int, connID string) {
+			defer wg.Done()
+
+			reply, err := h.type1.SendRequestAndWait(connID, build(uuid.New().String()), timeout)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				h.log.Warn("Type 1 client %d did not respond: %v", clientID, err)
+				missing = append(missing, clientID)
+				return
+			}
+			received[clientID] = reply
+		}(clientID, conn.ConnectionID)
+	}
+
+	wg.Wait()
+	return received, missing
+}
 
-	c.JSON(http.StatusOK, signalData)
+// floatQuery parses an optional float query parameter
+func floatQuery(c *gin.Context, name string, defaultValue float64) (float64, error) {
+	value := c.Query(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return 0, fmt.Errorf("%s must be a number", name)
+	}
+	return parsed, nil
+}
+
+// averageDBm averages power levels in linear milliwatts and converts the
+// result back to dBm
+func averageDBm(levels []float64) float64 {
+	var total float64
+	for _, level := range levels {
+		total += math.Pow(10, level/10)
+	}
+	return 10 * math.Log10(total/float64(len(levels)))
+}
+
+// mostCommon returns the value with the highest count, breaking ties alphabetically
+func mostCommon(counts map[string]int) string {
+	var best string
+	bestCount := 0
+	for value, count := range counts {
+		if count > bestCount || (count == bestCount && value < best) {
+			best, bestCount = value, count
+		}
+	}
+	return best
 }
 
 // selectType1Clients selects up to 3 Type 1 clients randomly from available connected clients
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"argus-sdr/internal/models"
+	"argus-sdr/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sha256Pattern matches a hex-encoded SHA-256 digest
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// SetStorage sets the file cache used for collector uploads
+func (h *DataHandler) SetStorage(store storage.Storage) {
+	h.storage = store
+}
+
+// UploadFile handles POST /api/collector/upload/:request_id
+//
+// The body is streamed into the server cache. The collector identifies itself
+// with the station_id query parameter, which must be bound to its user, and
+// must send the file's SHA-256 in the X-Content-SHA256 header; uploads that
+// don't match it are discarded. The optional X-Capture-Metadata header is kept
+// and served with the file.
+func (h *DataHandler) UploadFile(c *gin.Context) {
+	requestID := c.Param("request_id")
+	stationID := c.Query("station_id")
+	checksum := c.GetHeader("X-Content-SHA256")
+
+	if stationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "station_id is required"})
+		return
+	}
+	if !sha256Pattern.MatchString(checksum) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Content-SHA256 header with a hex SHA-256 digest is required"})
+		return
+	}
+
+	var captureMetadata string
+	if value := c.GetHeader(models.CaptureMetadataHeader); value != "" {
+		metadata, err := models.ParseCaptureMetadataHeader(value)
+		if err == nil && (metadata.RequestID != requestID || metadata.StationID != stationID) {
+			err = errors.New("capture metadata is for a different request or station")
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		data, _ := json.Marshal(metadata)
+		captureMetadata = string(data)
+	}
+
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "File cache is not available"})
+		return
+	}
+
+	maxSize := int64(h.cfg.Storage.MaxUploadSize) * 1024 * 1024
+	if maxSize > 0 && c.Request.ContentLength > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File exceeds maximum upload size of %d MB", h.cfg.Storage.MaxUploadSize)})
+		return
+	}
+
+	// Only the user a station is bound to may upload for it
+	owned, err := h.ownsStation(stationID, c.GetInt("user_id"))
+	if err != nil {
+		h.logger.Error("Failed to look up station %s: %v", stationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check station"})
+		return
+	}
+	if !owned {
+		h.logger.Warn("Rejected upload for request %s from user %d for station %s, which isn't bound to them", requestID, c.GetInt("user_id"), stationID)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Station is not registered to this user"})
+		return
+	}
+
+	// Only accept files for requests that were actually sent to this station
+	allowed, err := h.expectsUpload(requestID, stationID)
+	if err != nil {
+		h.logger.Error("Failed to check upload for request %s from station %s: %v", requestID, stationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check request"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request was not sent to this station"})
+		return
+	}
+
+	key := storage.Key(requestID, stationID, h.requestFormat(requestID))
+	object, err := h.storage.Put(key, c.Request.Body, maxSize, checksum)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File exceeds maximum upload size of %d MB", h.cfg.Storage.MaxUploadSize)})
+		case errors.Is(err, storage.ErrChecksumMismatch):
+			h.logger.Warn("Rejected upload for request %s from station %s: %v", requestID, stationID, err)
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		case errors.Is(err, storage.ErrInvalidKey):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request or station ID"})
+		default:
+			h.logger.Error("Failed to store upload for request %s from station %s: %v", requestID, stationID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+		}
+		return
+	}
+
+	if err := h.StoreCachedFile(requestID, stationID, object, captureMetadata); err != nil {
+		h.logger.Error("Failed to record cached file for request %s from station %s: %v", requestID, stationID, err)
+		h.storage.Delete(key)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record file"})
+		return
+	}
+
+	h.logger.Info("Cached upload for request %s from station %s (%d bytes)", requestID, stationID, object.Size)
+
+	// Receivers waiting on a fan-out upload can now download from the cache
+	h.UploadCompleted(requestID, stationID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"request_id": requestID,
+		"station_id": stationID,
+		"file_size":  object.Size,
+		"sha256":     object.SHA256,
+	})
+}
+
+// ownsStation reports whether a station is bound to a user. Stations are bound
+// to the first user that connects them over /collector-ws (see claimStation).
+func (h *DataHandler) ownsStation(stationID string, userID int) (bool, error) {
+	var ownerID int
+	err := h.db.QueryRow("SELECT user_id FROM stations WHERE station_id = ?", stationID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return ownerID == userID, nil
+}
+
+// expectsUpload reports whether a station may upload a file for a request
+func (h *DataHandler) expectsUpload(requestID, stationID string) (bool, error) {
+	if h.wasRoutedTo(requestID, stationID) {
+		return true, nil
+	}
+
+	// Routing information is only kept in memory; fall back to stored responses
+	var exists int
+	err := h.db.QueryRow(
+		"SELECT 1 FROM collector_responses WHERE request_id = ? AND station_id = ?",
+		requestID, stationID,
+	).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// StoreCachedFile records where a collector's uploaded file is cached, with
+// its capture metadata JSON if any. The response status is left alone; the
+// collector still reports "ready" itself.
+func (h *DataHandler) StoreCachedFile(requestID, stationID string, object *storage.Object, captureMetadata string) error {
+	query := `
+		INSERT INTO collector_responses (request_id, station_id, status, file_size, cached_path, sha256, capture_metadata)
+		VALUES (?, ?, 'processing', ?, ?, ?, ?)
+		ON CONFLICT(request_id, station_id) DO UPDATE SET
+			file_size = excluded.file_size,
+			cached_path = excluded.cached_path,
+			sha256 = excluded.sha256,
+			capture_metadata = excluded.capture_metadata
+	`
+	_, err := h.db.Exec(query, requestID, stationID, object.Size, object.Key, object.SHA256,
+		sql.NullString{String: captureMetadata, Valid: captureMetadata != ""})
+	return err
+}
+
+// serveCachedFile serves a collector's file from the server cache, with
+// Range support. It returns false if the file isn't in the cache.
+func (h *DataHandler) serveCachedFile(c *gin.Context, requestID, stationID, key, checksum, captureMetadata string) bool {
+	if h.storage == nil {
+		return false
+	}
+
+	file, err := h.storage.Open(key)
+	if err != nil {
+		h.logger.Warn("Cached file %s for request %s is unavailable: %v", key, requestID, err)
+		return false
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		h.logger.Warn("Failed to stat cached file %s: %v", key, err)
+		return false
+	}
+
+	h.logger.Info("Serving cached download for %s from station %s", requestID, stationID)
+	h.setDownloadHeaders(c, requestID, stationID)
+	if checksum != "" {
+		c.Header("X-Content-SHA256", checksum)
+		c.Header("ETag", `"`+checksum+`"`)
+	}
+	if captureMetadata != "" {
+		c.Header(models.CaptureMetadataHeader, base64.StdEncoding.EncodeToString([]byte(captureMetadata)))
+	}
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime(), file)
+	h.recordDownload(c, stationID, int64(c.Writer.Size()))
+	return true
+}
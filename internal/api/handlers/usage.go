@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"argus-sdr/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUsageDays is the longest period a usage report covers
+const maxUsageDays = 366
+
+// usageTotal is the bytes and files transferred in one group of a usage report
+type usageTotal struct {
+	Day       string `json:"day,omitempty"`
+	StationID string `json:"station_id,omitempty"`
+	Transfer  string `json:"transfer,omitempty"`
+	UserID    int    `json:"user_id,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Bytes     int64  `json:"bytes"`
+	Files     int64  `json:"files"`
+}
+
+// recordTransferQuery adds a file a user received from a station, by
+// transfer (shared.TransferWebRTC or shared.TransferHTTP), to the user's
+// usage today. Its arguments are the user, station, transfer and bytes.
+const recordTransferQuery = `
+	INSERT INTO transfer_usage (user_id, day, station_id, transfer, bytes, files)
+	VALUES (?, date('now'), ?, ?, ?, 1)
+	ON CONFLICT(user_id, day, station_id, transfer) DO UPDATE SET
+		bytes = bytes + excluded.bytes,
+		files = files + 1
+`
+
+// recordTransfer records a file a user received from a station in their usage
+func recordTransfer(db *sql.DB, userID int, stationID, transfer string, bytes int64) error {
+	_, err := database.ExecWithRetry(db, recordTransferQuery, userID, stationID, transfer, bytes)
+	return err
+}
+
+// usageDays reads the days query parameter of a usage report, 30 by default.
+// If it is invalid, it responds and returns false.
+func usageDays(c *gin.Context) (int, bool) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > maxUsageDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("days must be between 1 and %d", maxUsageDays)})
+		return 0, false
+	}
+	return days, true
+}
+
+// usageReport sums the transfers of the last days UTC days, today included,
+// of one user, or of all users if userID is 0: in total, by day, by station
+// and by transfer
+func usageReport(db *sql.DB, userID, days int) (gin.H, error) {
+	from := time.Now().UTC().AddDate(0, 0, 1-days).Format("2006-01-02")
+
+	report := gin.H{
+		"from": from,
+		"to":   time.Now().UTC().Format("2006-01-02"),
+		"days": days,
+	}
+	var totalBytes, totalFiles int64
+	for _, group := range []struct{ key, column string }{
+		{"by_day", "day"},
+		{"by_station", "station_id"},
+		{"by_transfer", "transfer"},
+	} {
+		totals, err := usageTotals(db, group.column, userID, from)
+		if err != nil {
+			return nil, err
+		}
+		report[group.key] = totals
+		if group.column == "day" {
+			for _, total := range totals {
+				totalBytes += total.Bytes
+				totalFiles += total.Files
+			}
+		}
+	}
+	report["bytes"] = totalBytes
+	report["files"] = totalFiles
+	return report, nil
+}
+
+// usageTotals sums transfers since from by a transfer_usage column
+func usageTotals(db *sql.DB, group string, userID int, from string) ([]usageTotal, error) {
+	// group is one of a fixed set of column names, never user input
+	query := fmt.Sprintf(`
+		SELECT %[1]s, SUM(bytes), SUM(files)
+		FROM transfer_usage
+		WHERE day >= ? AND (? = 0 OR user_id = ?)
+		GROUP BY %[1]s
+		ORDER BY %[1]s
+	`, group)
+	rows, err := db.Query(query, from, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := []usageTotal{}
+	for rows.Next() {
+		var total usageTotal
+		var key string
+		if err := rows.Scan(&key, &total.Bytes, &total.Files); err != nil {
+			return nil, err
+		}
+		switch group {
+		case "day":
+			total.Day = key
+		case "station_id":
+			total.StationID = key
+		case "transfer":
+			total.Transfer = key
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
+}
+
+// userUsageTotals sums each user's transfers since from, the largest first
+func userUsageTotals(db *sql.DB, userID int, from string) ([]usageTotal, error) {
+	rows, err := db.Query(`
+		SELECT tu.user_id, COALESCE(u.email, ''), SUM(tu.bytes), SUM(tu.files)
+		FROM transfer_usage tu
+		LEFT JOIN users u ON u.id = tu.user_id
+		WHERE tu.day >= ? AND (? = 0 OR tu.user_id = ?)
+		GROUP BY tu.user_id
+		ORDER BY SUM(tu.bytes) DESC, tu.user_id
+	`, from, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := []usageTotal{}
+	for rows.Next() {
+		var total usageTotal
+		if err := rows.Scan(&total.UserID, &total.Email, &total.Bytes, &total.Files); err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
+}
+
+// GetUsage handles GET /api/data/usage, reporting the data the user received
+// over the last days UTC days (30 by default)
+func (h *DataHandler) GetUsage(c *gin.Context) {
+	days, ok := usageDays(c)
+	if !ok {
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	report, err := usageReport(h.db, userID, days)
+	if err != nil {
+		h.logger.Error("Failed to report usage of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// GetUsage handles GET /api/admin/usage, reporting the data all users, or
+// the one in user_id, received over the last days UTC days (30 by default),
+// also by user
+func (h *AdminHandler) GetUsage(c *gin.Context) {
+	days, ok := usageDays(c)
+	if !ok {
+		return
+	}
+	userID := 0
+	if param := c.Query("user_id"); param != "" {
+		var err error
+		if userID, err = strconv.Atoi(param); err != nil || userID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be a positive integer"})
+			return
+		}
+	}
+
+	report, err := usageReport(h.db, userID, days)
+	if err == nil {
+		report["by_user"], err = userUsageTotals(h.db, userID, report["from"].(string))
+	}
+	if err != nil {
+		h.logger.Error("Failed to report usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
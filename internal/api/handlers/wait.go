@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"argus-sdr/internal/shared"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestWaiter wakes the long-polls waiting on one request
+type requestWaiter struct {
+	changed  chan struct{} // closed when the request changes
+	watchers int
+}
+
+// watchRequest returns a channel that is closed the next time the request
+// changes, and a function to call once the caller stops watching
+func (h *DataHandler) watchRequest(requestID string) (<-chan struct{}, func()) {
+	h.waitersMutex.Lock()
+	defer h.waitersMutex.Unlock()
+
+	waiter, exists := h.requestWaiters[requestID]
+	if !exists {
+		waiter = &requestWaiter{changed: make(chan struct{})}
+		h.requestWaiters[requestID] = waiter
+	}
+	waiter.watchers++
+
+	return waiter.changed, func() {
+		h.waitersMutex.Lock()
+		defer h.waitersMutex.Unlock()
+		waiter.watchers--
+		if waiter.watchers == 0 && h.requestWaiters[requestID] == waiter {
+			delete(h.requestWaiters, requestID)
+		}
+	}
+}
+
+// signalRequestChanged wakes everyone waiting on a request
+func (h *DataHandler) signalRequestChanged(requestID string) {
+	h.waitersMutex.Lock()
+	defer h.waitersMutex.Unlock()
+
+	if waiter, exists := h.requestWaiters[requestID]; exists {
+		close(waiter.changed)
+		delete(h.requestWaiters, requestID)
+	}
+}
+
+// requestFinished reports whether a request will not change any more
+func requestFinished(status *shared.DataRequestStatus) bool {
+	if status.Status == "cancelled" {
+		return true
+	}
+	if status.Summary == nil {
+		// Never sent to a station
+		return status.Status == "failed"
+	}
+	return status.Summary.Complete
+}
+
+// stationsFinished counts the stations that are done with a request
+func stationsFinished(status *shared.DataRequestStatus) int {
+	if status.Summary == nil {
+		return 0
+	}
+	return status.Summary.Ready + status.Summary.Error
+}
+
+// WaitForRequest handles GET /api/data/wait/:id. It answers with the request's
+// status, like GET /api/data/status/:id, once the request is finished or
+// another station is done with it, or after timeout seconds (at most
+// LONG_POLL_MAX_TIMEOUT_SECONDS, which is also the default). seen is how many
+// stations the client already knows to be done; without it the wait is for
+// the next one.
+func (h *DataHandler) WaitForRequest(c *gin.Context) {
+	requestID := c.Param("id")
+	if requestID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request ID is required"})
+		return
+	}
+
+	maxTimeout := h.cfg.Server.LongPollMaxTimeout
+	timeout := maxTimeout
+	if value := c.Query("timeout"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "timeout must be a non-negative number of seconds"})
+			return
+		}
+		if seconds < maxTimeout {
+			timeout = seconds
+		}
+	}
+	seen := -1
+	if value := c.Query("seen"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "seen must be a non-negative number of stations"})
+			return
+		}
+		seen = count
+	}
+
+	deadline := time.NewTimer(time.Duration(timeout) * time.Second)
+	defer deadline.Stop()
+
+	for {
+		// Watch before loading the status so a change in between isn't missed
+		changed, release := h.watchRequest(requestID)
+		status, err := h.getDataRequestStatus(requestID)
+		if err != nil {
+			release()
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+				return
+			}
+			h.logger.Error("Failed to get request status: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get status"})
+			return
+		}
+
+		finished := stationsFinished(status)
+		if seen < 0 {
+			seen = finished
+		}
+		if requestFinished(status) || finished > seen {
+			release()
+			c.JSON(http.StatusOK, status)
+			return
+		}
+
+		select {
+		case <-changed:
+			release()
+		case <-deadline.C:
+			release()
+			c.JSON(http.StatusOK, status)
+			return
+		case <-c.Request.Context().Done():
+			release()
+			h.logger.Debug("Client stopped waiting for request %s", requestID)
+			return
+		}
+	}
+}
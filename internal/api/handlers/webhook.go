@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"argus-sdr/internal/notify"
+	"argus-sdr/internal/shared"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetNotifier sets the backend that delivers notifications to request callback URLs
+func (h *DataHandler) SetNotifier(notifier notify.Notifier) {
+	h.notifier = notifier
+}
+
+// notifyWebhook sends a request notification to the request's callback URL,
+// if it has one, signed with the requester's webhook secret
+func (h *DataHandler) notifyWebhook(requestID string, notification shared.ReceiverMessage) {
+	if h.notifier == nil {
+		return
+	}
+
+	var callbackURL sql.NullString
+	var requestedBy string
+	err := h.db.QueryRow("SELECT callback_url, requested_by FROM data_requests WHERE id = ?", requestID).Scan(&callbackURL, &requestedBy)
+	if err != nil {
+		h.logger.Error("Failed to look up callback URL for request %s: %v", requestID, err)
+		return
+	}
+	if callbackURL.String == "" {
+		return
+	}
+
+	secret, err := webhookSecret(h.db, requestedBy)
+	if err != nil {
+		h.logger.Error("Failed to get webhook secret for user %s: %v", requestedBy, err)
+		return
+	}
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		h.logger.Error("Failed to marshal webhook payload for request %s: %v", requestID, err)
+		return
+	}
+
+	h.logger.Info("Sending %s webhook for request %s", notification.Type, requestID)
+	h.notifier.Notify(callbackURL.String, secret, payload)
+}
+
+// webhookSecret returns the secret a user's webhooks are signed with,
+// creating it on first use
+func webhookSecret(db *sql.DB, userID interface{}) (string, error) {
+	var secret sql.NullString
+	if err := db.QueryRow("SELECT webhook_secret FROM users WHERE id = ?", userID).Scan(&secret); err != nil {
+		return "", err
+	}
+	if secret.Valid && secret.String != "" {
+		return secret.String, nil
+	}
+	return rotateWebhookSecret(db, userID)
+}
+
+// rotateWebhookSecret replaces a user's webhook secret with a new random one
+func rotateWebhookSecret(db *sql.DB, userID interface{}) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(buf)
+
+	if _, err := db.Exec("UPDATE users SET webhook_secret = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", secret, userID); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// WebhookSecret handles GET /api/auth/webhook-secret. Receivers verify
+// webhooks by comparing the X-Argus-Signature header with the HMAC-SHA256 of
+// the body keyed with this secret.
+func (h *AuthHandler) WebhookSecret(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	secret, err := webhookSecret(h.db, userID)
+	if err != nil {
+		h.log.Error("Failed to get webhook secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhook secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhook_secret": secret, "signature_header": notify.SignatureHeader})
+}
+
+// RotateWebhookSecret handles POST /api/auth/webhook-secret/rotate
+func (h *AuthHandler) RotateWebhookSecret(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	secret, err := rotateWebhookSecret(h.db, userID)
+	if err != nil {
+		h.log.Error("Failed to rotate webhook secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate webhook secret"})
+		return
+	}
+
+	h.log.Info("Rotated webhook secret for user %v", userID)
+	c.JSON(http.StatusOK, gin.H{"webhook_secret": secret, "signature_header": notify.SignatureHeader})
+}
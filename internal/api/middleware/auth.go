@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"argus-sdr/internal/auth"
+	"argus-sdr/internal/models"
 	"argus-sdr/pkg/config"
 
 	"github.com/gin-gonic/gin"
@@ -37,6 +38,7 @@ func RequireAuth(cfg *config.Config) gin.HandlerFunc {
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
 		c.Set("client_type", claims.ClientType)
+		c.Set("role", claims.Role)
 
 		c.Next()
 	}
@@ -59,4 +61,17 @@ func RequireClientType(clientType int) gin.HandlerFunc {
 
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// RequireAdmin restricts a route to users whose token carries the admin role
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
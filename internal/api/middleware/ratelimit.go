@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit allows each client IP at most limit requests per window and
+// rejects the rest with 429. A limit of 0 or less disables it.
+func RateLimit(limit int, window time.Duration) gin.HandlerFunc {
+	if limit <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	limiter := newIPRateLimiter(limit, window)
+	return func(c *gin.Context) {
+		if wait, ok := limiter.allow(c.ClientIP()); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, try again later"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ipRateLimiter is a token bucket per client IP. Each bucket holds up to
+// limit tokens and refills at limit tokens per window.
+type ipRateLimiter struct {
+	limit   float64
+	rate    float64 // tokens per second
+	buckets map[string]*bucket
+	mutex   sync.Mutex
+	lastGC  time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newIPRateLimiter(limit int, window time.Duration) *ipRateLimiter {
+	return &ipRateLimiter{
+		limit:   float64(limit),
+		rate:    float64(limit) / window.Seconds(),
+		buckets: make(map[string]*bucket),
+		lastGC:  time.Now(),
+	}
+}
+
+// allow takes a token for ip, or reports how long until one is available
+func (l *ipRateLimiter) allow(ip string) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.collectGarbage(now)
+
+	b, exists := l.buckets[ip]
+	if !exists {
+		b = &bucket{tokens: l.limit, last: now}
+		l.buckets[ip] = b
+	}
+
+	b.tokens = math.Min(l.limit, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// collectGarbage drops buckets that have refilled completely, so the map
+// doesn't grow with every IP ever seen
+func (l *ipRateLimiter) collectGarbage(now time.Time) {
+	if now.Sub(l.lastGC) < time.Minute {
+		return
+	}
+	l.lastGC = now
+
+	full := time.Duration(l.limit / l.rate * float64(time.Second))
+	for ip, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, ip)
+		}
+	}
+}
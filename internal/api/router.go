@@ -2,18 +2,33 @@ package api
 
 import (
 	"database/sql"
+	"net/http"
+	"time"
 
 	"argus-sdr/internal/api/handlers"
 	"argus-sdr/internal/api/middleware"
+	"argus-sdr/internal/notify"
+	"argus-sdr/internal/safehttp"
+	"argus-sdr/internal/shared"
+	"argus-sdr/internal/storage"
 	"argus-sdr/pkg/config"
 	"argus-sdr/pkg/logger"
+	"argus-sdr/pkg/version"
 
 	"github.com/gin-gonic/gin"
 )
 
-func NewRouter(db *sql.DB, log *logger.Logger, cfg *config.Config) *gin.Engine {
+// NewRouter builds the API server's routes and handlers. The Shutdown it
+// returns tells the server's WebSocket clients it is going away and counts
+// the transfers a shutdown waits for.
+func NewRouter(db *sql.DB, log *logger.Logger, cfg *config.Config) (*gin.Engine, *handlers.Shutdown) {
 	router := gin.New()
 
+	// Only honour X-Forwarded-For from configured proxies so ClientIP is the real client
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal("Invalid trusted proxies: %v", err)
+	}
+
 	// Middleware
 	router.Use(middleware.Logger(log))
 	router.Use(middleware.Recovery(log))
@@ -21,30 +36,80 @@ func NewRouter(db *sql.DB, log *logger.Logger, cfg *config.Config) *gin.Engine {
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(db, log, cfg)
-	type1Handler := handlers.NewType1Handler(db, log, cfg)
-	type2Handler := handlers.NewType2Handler(db, log, cfg)
-	dataHandler := handlers.NewDataHandler(db, log, cfg)
-	collectorHandler := handlers.NewCollectorHandler(db, log, cfg, dataHandler)
+	connLimits := handlers.NewConnectionLimits()
+	shutdown := handlers.NewShutdown()
+	type1Connections := handlers.NewConnectionManager(log, cfg.Queues.Type1SendOverflow)
+	type1Handler := handlers.NewType1Handler(db, log, cfg, type1Connections, connLimits)
+	type2Handler := handlers.NewType2Handler(db, log, cfg, type1Handler, type1Connections)
+	dataHandler := handlers.NewDataHandler(db, log, cfg, connLimits)
+	collectorHandler := handlers.NewCollectorHandler(db, log, cfg, dataHandler, connLimits)
 	iceHandler := handlers.NewICEHandler(db, log, cfg, type1Handler, dataHandler, collectorHandler)
+	adminHandler := handlers.NewAdminHandler(db, log, cfg, collectorHandler)
 
 	// Set up handler dependencies
 	dataHandler.SetCollectorHandler(collectorHandler)
 
+	// ICE sessions nobody completes the negotiation of are failed
+	if cfg.Server.ICESessionPendingTTL > 0 {
+		go iceHandler.ExpirePendingSessions(time.Duration(cfg.Server.ICESessionPendingTTL) * time.Second)
+	}
+
+	// Type 1 connections in the database are checked against the live ones
+	if cfg.Server.Type1ReconcileInterval > 0 {
+		go type1Handler.ReconcileConnections(time.Duration(cfg.Server.Type1ReconcileInterval) * time.Second)
+	}
+
+	// Requests past their retention period are deleted
+	if cfg.Server.RequestRetentionDays > 0 {
+		go dataHandler.PurgeRequestHistory(cfg.Server.RequestRetentionDays)
+	}
+
+	// Collector uploads are cached on disk unless the server only does signaling
+	if !cfg.Server.IsSignalingOnly() {
+		store, err := storage.NewLocal(cfg.Storage.Dir)
+		if err != nil {
+			log.Fatal("Failed to initialize file cache: %v", err)
+		}
+		dataHandler.SetStorage(store)
+	}
+
+	// Requests with a callback_url are also announced by signed webhook
+	dataHandler.SetNotifier(notify.NewWebhook(log, safehttp.Options{
+		Timeout:         time.Duration(cfg.Webhook.Timeout) * time.Second,
+		AllowedNetworks: handlers.OutboundAllowedNetworks(cfg),
+		AllowPrivate:    cfg.Webhook.AllowPrivateAddresses,
+	}, cfg.Webhook.MaxAttempts))
+
+	// WebSocket clients are told when the server shuts down
+	shutdown.OnShutdown(collectorHandler.GoingAway)
+	shutdown.OnShutdown(dataHandler.GoingAway)
+	shutdown.OnShutdown(type1Connections.GoingAway)
+
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
+		c.JSON(200, gin.H{"status": "ok", "version": version.Get(), "commit": version.Commit, "build_time": version.BuildTime, "queue_drops": type1Connections.QueueDrops(), "connections": connLimits.Active(), "connection_evictions": connLimits.Evictions(), "ice_sessions": iceHandler.SessionStats(), "in_flight_transfers": shutdown.InFlightTransfers()})
 	})
 
 	// API routes
 	api := router.Group("/api")
 
+	// Version information so clients can check compatibility before connecting
+	api.GET("/version", func(c *gin.Context) {
+		info := version.Current()
+		info.FileTransferProtocols = shared.SupportedFileTransferProtocols
+		c.JSON(http.StatusOK, info)
+	})
+
 	// Authentication routes
 	auth := api.Group("/auth")
 	{
-		auth.POST("/register", authHandler.Register)
-		auth.POST("/login", authHandler.Login)
+		// Registration and login are limited per client IP against account flooding and password guessing
+		auth.POST("/register", middleware.RateLimit(cfg.Auth.RateLimit, time.Minute), authHandler.Register)
+		auth.POST("/login", middleware.RateLimit(cfg.Auth.RateLimit, time.Minute), authHandler.Login)
 		auth.POST("/logout", authHandler.Logout)
 		auth.GET("/me", middleware.RequireAuth(cfg), authHandler.Me)
+		auth.GET("/webhook-secret", middleware.RequireAuth(cfg), authHandler.WebhookSecret)
+		auth.POST("/webhook-secret/rotate", middleware.RequireAuth(cfg), authHandler.RotateWebhookSecret)
 	}
 
 	// ICE routes (WebRTC signaling and file transfer)
@@ -53,8 +118,16 @@ func NewRouter(db *sql.DB, log *logger.Logger, cfg *config.Config) *gin.Engine {
 	{
 		ice.POST("/request", iceHandler.InitiateSession)
 		ice.POST("/signal", iceHandler.Signal)
-		ice.GET("/signals/:session_id", iceHandler.GetSignals)
-		ice.GET("/sessions", iceHandler.GetActiveSessions)
+		ice.POST("/complete", iceHandler.CompleteSession)
+		ice.GET("/config", iceHandler.GetICEConfig)
+		// The deprecated polling endpoints can be turned off; signals are pushed over WebSocket
+		if cfg.Server.ICEPollingEnabled {
+			ice.GET("/signals/:session_id", iceHandler.GetSignals)
+			ice.GET("/sessions", iceHandler.GetActiveSessions)
+		} else {
+			ice.GET("/signals/:session_id", pollingDisabledHandler)
+			ice.GET("/sessions", pollingDisabledHandler)
+		}
 	}
 
 	// Type 1 client routes (SDR devices)
@@ -72,10 +145,25 @@ func NewRouter(db *sql.DB, log *logger.Logger, cfg *config.Config) *gin.Engine {
 	data.Use(middleware.RequireAuth(cfg))
 	{
 		data.POST("/request", dataHandler.RequestData)
+		data.POST("/request/plan", dataHandler.PlanRequest)
 		data.GET("/status/:id", dataHandler.GetRequestStatus)
+		data.GET("/wait/:id", dataHandler.WaitForRequest)
 		data.GET("/downloads/:id", dataHandler.GetAvailableDownloads)
+		data.POST("/subscribe/:id", dataHandler.SubscribeToRequest)
+		data.POST("/cancel/:id", dataHandler.CancelRequest)
 		data.GET("/requests", dataHandler.ListRequests)
-		data.GET("/download/:id/:station_id", dataHandler.DownloadFile)
+		data.GET("/quota", dataHandler.GetQuota)
+		data.GET("/usage", dataHandler.GetUsage)
+		data.GET("/export", dataHandler.ExportRequests)
+		data.POST("/templates", dataHandler.CreateTemplate)
+		data.GET("/templates", dataHandler.ListTemplates)
+		data.DELETE("/templates/:id", dataHandler.DeleteTemplate)
+		// The HTTP download proxy is disabled when the server only does signaling
+		if cfg.Server.IsSignalingOnly() {
+			data.GET("/download/:id/:station_id", signalingOnlyHandler)
+		} else {
+			data.GET("/download/:id/:station_id", shutdown.TrackTransfer(), dataHandler.DownloadFile)
+		}
 
 		// Legacy Type 2 routes
 		data.GET("/spectrum", middleware.RequireClientType(2), type2Handler.GetSpectrum)
@@ -83,14 +171,65 @@ func NewRouter(db *sql.DB, log *logger.Logger, cfg *config.Config) *gin.Engine {
 		data.GET("/availability", middleware.RequireClientType(2), type2Handler.GetAvailability)
 	}
 
+	// Station routes
+	stations := api.Group("/stations")
+	stations.Use(middleware.RequireAuth(cfg))
+	{
+		stations.GET("/geometry", dataHandler.GetStationGeometry)
+	}
+
+	// Collector routes
+	collector := api.Group("/collector")
+	collector.Use(middleware.RequireAuth(cfg))
+	collector.Use(middleware.RequireClientType(1))
+	{
+		// Uploads to the server cache are disabled when the server only does signaling
+		if cfg.Server.IsSignalingOnly() {
+			collector.POST("/upload/:request_id", signalingOnlyHandler)
+		} else {
+			collector.POST("/upload/:request_id", shutdown.TrackTransfer(), dataHandler.UploadFile)
+		}
+	}
+
+	// Admin routes (fleet management)
+	admin := api.Group("/admin")
+	admin.Use(middleware.RequireAuth(cfg))
+	admin.Use(middleware.RequireAdmin())
+	{
+		admin.POST("/collectors/broadcast", adminHandler.BroadcastToCollectors)
+		admin.GET("/loglevel", adminHandler.GetLogLevel)
+		admin.POST("/loglevel", adminHandler.SetLogLevel)
+		admin.GET("/logs/recent", adminHandler.GetRecentLogs)
+		admin.GET("/selection/config", adminHandler.GetSelectionConfig)
+		admin.GET("/usage", adminHandler.GetUsage)
+		admin.GET("/export", adminHandler.ExportRequests)
+	}
+
 	// WebSocket endpoint for Type 1 clients (legacy)
 	router.GET("/ws", middleware.RequireAuth(cfg), middleware.RequireClientType(1), type1Handler.WebSocketHandler)
 
 	// WebSocket endpoint for collector clients (new modes system)
-	router.GET("/collector-ws", collectorHandler.WebSocketHandler)
+	router.GET("/collector-ws", middleware.RequireAuth(cfg), middleware.RequireClientType(1), collectorHandler.WebSocketHandler)
 
 	// WebSocket endpoint for receiver clients to get data ready notifications
 	router.GET("/receiver-ws", dataHandler.ReceiverWebSocketHandler)
 
-	return router
-}
\ No newline at end of file
+	return router, shutdown
+}
+
+// signalingOnlyHandler rejects routes that move file data through the server
+// when it runs with SERVER_ROLE=signaling-only
+func signalingOnlyHandler(c *gin.Context) {
+	c.JSON(http.StatusNotImplemented, gin.H{
+		"error": "This server is signaling-only; files are only transferred peer-to-peer",
+	})
+}
+
+// pollingDisabledHandler answers the deprecated ICE polling endpoints when
+// ICE_POLLING_ENABLED is false
+func pollingDisabledHandler(c *gin.Context) {
+	c.JSON(http.StatusGone, gin.H{
+		"error":     "HTTP polling for ICE signals is disabled on this server; signals are pushed over WebSocket",
+		"websocket": gin.H{"collector": "/collector-ws", "receiver": "/receiver-ws"},
+	})
+}
@@ -12,6 +12,7 @@ type Claims struct {
 	UserID     int `json:"user_id"`
 	Email      string `json:"email"`
 	ClientType int `json:"client_type"`
+	Role       string `json:"role,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -25,13 +26,14 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-func GenerateToken(userID int, email string, clientType int, secret string, expiryHours int) (string, error) {
+func GenerateToken(userID int, email string, clientType int, role string, secret string, expiry time.Duration) (string, error) {
 	claims := Claims{
 		UserID:     userID,
 		Email:      email,
 		ClientType: clientType,
+		Role:       role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expiryHours) * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -0,0 +1,203 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"argus-sdr/internal/models"
+	"argus-sdr/internal/shared"
+)
+
+// Circuit breaker states, as reported on GET /status
+const (
+	breakerClosed   = "closed"    // requests are accepted
+	breakerOpen     = "open"      // requests are rejected until the cooldown has passed
+	breakerHalfOpen = "half-open" // one trial request decides whether to close or open again
+)
+
+// requestError is a collection that failed because of the request rather
+// than the station, such as invalid parameters. It doesn't count towards
+// the circuit breaker.
+type requestError struct {
+	err error
+}
+
+func (e requestError) Error() string { return e.err.Error() }
+func (e requestError) Unwrap() error { return e.err }
+
+// circuitBreaker keeps a collector whose collections keep failing, such as
+// when its SDR or Docker is broken, from taking requests it can only fail.
+// After threshold consecutive failed collections it opens: requests are
+// rejected and heartbeats report the collector unhealthy, so the server
+// routes them elsewhere. Once cooldown has passed it is half-open: one trial
+// request is accepted, and its collection closes the breaker if it succeeds
+// or opens it again if it fails. A trial that hasn't collected within the
+// cooldown, because it was cancelled for instance, is given up on.
+type circuitBreaker struct {
+	threshold int // consecutive failed collections that open the breaker
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int       // consecutive failed collections
+	openedAt time.Time // zero while closed
+	trialAt  time.Time // when the half-open trial request was accepted; zero without one
+	timer    *time.Timer
+}
+
+// stateLocked returns the breaker's state; b.mu must be held
+func (b *circuitBreaker) stateLocked() string {
+	switch {
+	case b.openedAt.IsZero():
+		return breakerClosed
+	case time.Since(b.openedAt) < b.cooldown:
+		return breakerOpen
+	default:
+		return breakerHalfOpen
+	}
+}
+
+// State returns the breaker's state
+func (b *circuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stateLocked()
+}
+
+// Admit reports why a new request can't be accepted, or nil if it can. In
+// the half-open state the request it admits is the trial. Streams are only
+// accepted while the breaker is closed, since they don't collect until their
+// receiver connects.
+func (b *circuitBreaker) Admit(stream bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.stateLocked() {
+	case breakerOpen:
+		remaining := b.cooldown - time.Since(b.openedAt)
+		return fmt.Errorf("circuit breaker open after %d consecutive failed collections, retrying in %s",
+			b.failures, remaining.Round(time.Second))
+	case breakerHalfOpen:
+		if stream {
+			return errors.New("circuit breaker half-open, streams are accepted once a collection succeeds")
+		}
+		if !b.trialAt.IsZero() && time.Since(b.trialAt) < b.cooldown {
+			return errors.New("circuit breaker half-open, a trial collection is running")
+		}
+		b.trialAt = time.Now()
+	}
+	return nil
+}
+
+// Record records the outcome of a collection. It returns the breaker's state
+// and whether the collection changed it. onHalfOpen is called once the
+// cooldown of a breaker it opened has passed.
+func (b *circuitBreaker) Record(err error, onHalfOpen func()) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	before := b.stateLocked()
+	var invalid requestError
+	switch {
+	case errors.As(err, &invalid):
+		// Says nothing about the station; a trial that failed this way is over
+		b.trialAt = time.Time{}
+		return before, false
+	case err == nil:
+		b.failures = 0
+		b.openedAt = time.Time{}
+		b.trialAt = time.Time{}
+	default:
+		b.failures++
+		// A half-open breaker opens again on the trial's failure
+		if b.failures >= b.threshold || before == breakerHalfOpen {
+			b.openedAt = time.Now()
+			b.trialAt = time.Time{}
+			if b.timer != nil {
+				b.timer.Stop()
+			}
+			b.timer = time.AfterFunc(b.cooldown, onHalfOpen)
+		}
+	}
+	after := b.stateLocked()
+	return after, after != before
+}
+
+// Failures returns the number of consecutive failed collections
+func (b *circuitBreaker) Failures() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures
+}
+
+// BreakerStatus describes the collector's circuit breaker on GET /status
+type BreakerStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Threshold           int        `json:"threshold"`
+	OpenUntil           *time.Time `json:"open_until,omitempty"`
+}
+
+// breakerStatus describes the circuit breaker, or returns nil if it is disabled
+func (c *Client) breakerStatus() *BreakerStatus {
+	if c.breaker == nil {
+		return nil
+	}
+	b := c.breaker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := &BreakerStatus{
+		State:               b.stateLocked(),
+		ConsecutiveFailures: b.failures,
+		Threshold:           b.threshold,
+	}
+	if status.State == breakerOpen {
+		until := b.openedAt.Add(b.cooldown).UTC()
+		status.OpenUntil = &until
+	}
+	return status
+}
+
+// admitRequest reports why the circuit breaker rejects a request, or nil
+func (c *Client) admitRequest(request shared.DataRequest) error {
+	if c.breaker == nil {
+		return nil
+	}
+	return c.breaker.Admit(request.RequestType == shared.RequestTypeStream)
+}
+
+// collectData runs a request's collection and records its outcome in the
+// circuit breaker, telling the server when the breaker opens
+func (c *Client) collectData(request shared.DataRequest) (string, *models.CaptureMetadata, error) {
+	filePath, metadata, err := c.runDataCollection(request)
+	if c.breaker == nil {
+		return filePath, metadata, err
+	}
+
+	state, changed := c.breaker.Record(err, c.breakerHalfOpen)
+	if !changed {
+		return filePath, metadata, err
+	}
+	switch state {
+	case breakerOpen:
+		c.Logger.Warn("Circuit breaker open after %d consecutive failed collections: rejecting requests for %s",
+			c.breaker.Failures(), c.breaker.cooldown)
+		// Tell the server right away so it stops routing requests here
+		c.sendHeartbeat()
+	case breakerClosed:
+		c.Logger.Info("Circuit breaker closed: the collection for request %s succeeded", request.ID)
+	}
+	return filePath, metadata, err
+}
+
+// breakerHalfOpen runs once the circuit breaker's cooldown has passed
+func (c *Client) breakerHalfOpen() {
+	if c.breaker.State() != breakerHalfOpen {
+		return
+	}
+	c.Logger.Info("Circuit breaker half-open: accepting a trial request")
+	// The server routes requests here again once the collector no longer reports itself unhealthy
+	c.sendHeartbeat()
+}
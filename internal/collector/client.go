@@ -2,7 +2,10 @@ package collector
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,11 +14,15 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"argus-sdr/internal/convert"
+	"argus-sdr/internal/geometry"
 	"argus-sdr/internal/models"
 	"argus-sdr/internal/shared"
 	"argus-sdr/pkg/logger"
+	"argus-sdr/pkg/version"
 
 	"github.com/gorilla/websocket"
 	"github.com/pion/webrtc/v3"
@@ -30,21 +37,169 @@ type Client struct {
 	ContainerImage string
 	Logger         *logger.Logger
 
-	conn              *websocket.Conn
-	authToken         string
-	activeRequests    map[string]*shared.DataRequest
-	waitingForAnswer  map[string]chan webrtc.SessionDescription
-	peerConnections   map[string]*webrtc.PeerConnection
-	mu                sync.RWMutex
-	stopCh            chan struct{}
+	// LogDockerCommand enables debug logging of the redacted Docker command line
+	LogDockerCommand bool
+	// ErrorOutputLimit bounds the container output included in error responses (0 disables it)
+	ErrorOutputLimit int
+	// ExitAfterDrain stops the client once a drain completes
+	ExitAfterDrain bool
+	// DrainTransferWait is how long a finished collection is held open waiting for its transfer
+	DrainTransferWait time.Duration
+	// ICETimeouts bounds ICE gathering and how quickly dead WebRTC connections fail
+	ICETimeouts shared.ICETimeouts
+	// DataChannelLabel is the label of the file transfer data channel
+	DataChannelLabel string
+	// AllowedParameters restricts which request parameters this collector accepts (empty allows all known ones)
+	AllowedParameters []string
+	// AllowedImages lists extra images a request may select; ContainerImage is always allowed
+	AllowedImages []string
+	// SDRModel names the station's radio in capture metadata
+	SDRModel string
+	// Location of the station's antenna, reported with each heartbeat (nil if unknown)
+	Location *geometry.Position
+	// DockerMemory, DockerCPUs and DockerPidsLimit limit the collection container's resources (empty or 0 disables a limit)
+	DockerMemory    string
+	DockerCPUs      string
+	DockerPidsLimit int
+	// OutputMountPath is where the request's directory is mounted, writable, in the container
+	OutputMountPath string
+	// InputDir is mounted read-only at InputMountPath in the container (empty mounts nothing)
+	InputDir       string
+	InputMountPath string
+	// ReadOnlyRoot runs the container with a read-only root filesystem and tmpfs mounts at TmpfsPaths
+	ReadOnlyRoot bool
+	TmpfsPaths   []string
+	// CollectionTimeout kills a collection that runs longer than this (0 disables it)
+	CollectionTimeout time.Duration
+	// CaptureGrace is how much longer than its duration_seconds a collection may run (0 disables the bound)
+	CaptureGrace time.Duration
+	// StatusAddress is where the local status server listens (empty disables it)
+	StatusAddress string
+	// UploadFiles uploads each capture to the server cache in addition to offering it over WebRTC
+	UploadFiles bool
+	// DataRetention is how long a capture is kept after its last transfer (0 keeps captures forever)
+	DataRetention time.Duration
+	// TLSCAFile, TLSCertFile and TLSKeyFile set a custom CA bundle and client certificate for the API server
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+	// StreamMaxDuration ends capture streams that run longer than this (0 disables streaming)
+	StreamMaxDuration time.Duration
+	// StreamMaxPacketLifeTime makes stream data channels partially reliable: a
+	// message not delivered within it is dropped (0 keeps them fully reliable).
+	// File transfers are always reliable.
+	StreamMaxPacketLifeTime time.Duration
+	// ValidateCaptures rejects collections whose file isn't a complete NPZ archive
+	ValidateCaptures bool
+	// BreakerThreshold consecutive failed collections make the collector reject
+	// requests for BreakerCooldown (0 disables the circuit breaker)
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// PullImage pulls ContainerImage at startup, and again when a reload changes
+	// it, so the first request doesn't pay for the pull
+	PullImage bool
+	// ImageDigest pins ContainerImage to a digest (sha256:...) checked at startup (empty pins none)
+	ImageDigest string
+	// ImagePullTimeout bounds docker pull (0 disables it)
+	ImagePullTimeout time.Duration
+
+	conn               *websocket.Conn
+	writeMu            sync.Mutex // a WebSocket takes one writer at a time
+	authToken          string
+	activeRequests     map[string]*trackedRequest
+	streams            map[string]shared.DataRequest // stream requests waiting for their receiver's session
+	waitingForAnswer   map[string]chan webrtc.SessionDescription
+	peerConnections    map[string]*webrtc.PeerConnection
+	sessionCancels     map[string]chan struct{} // closed when the server cancels a transfer session
+	mu                 sync.RWMutex
+	stopCh             chan struct{}
+	stopOnce           sync.Once
+	heartbeatNow       chan chan struct{}     // asks the heartbeat goroutine for a heartbeat, closing the channel once sent
+	draining           bool                   // set by drain; no new requests are accepted
+	inFlight           int                    // collections and transfers still in progress
+	awaitingTransfer   map[string]*time.Timer // finished collections whose file hasn't been fetched yet
+	cleanupTimers      map[string]*time.Timer // transferred captures waiting to be removed
+	startedAt          time.Time
+	connected          bool        // WebSocket to the API server is up
+	lastHeartbeatAck   time.Time   // last heartbeat_response from the server
+	tlsConfig          *tls.Config // nil uses the system roots
+	newerVersionWarned bool        // already warned that the server speaks a newer message version
+
+	// negotiated is what the server asked for when it accepted the connection
+	negotiated   shared.AuthSuccess
+	negotiatedAt time.Time
+
+	// breaker rejects requests while collections keep failing; nil when disabled
+	breaker *circuitBreaker
+
+	// image is the readiness of ContainerImage; nil until it has been checked
+	image *ImageStatus
 }
 
 // Start initializes and starts the collector client
 func (c *Client) Start() error {
-	c.activeRequests = make(map[string]*shared.DataRequest)
+	c.activeRequests = make(map[string]*trackedRequest)
+	c.streams = make(map[string]shared.DataRequest)
 	c.waitingForAnswer = make(map[string]chan webrtc.SessionDescription)
 	c.peerConnections = make(map[string]*webrtc.PeerConnection)
+	c.sessionCancels = make(map[string]chan struct{})
+	c.awaitingTransfer = make(map[string]*time.Timer)
+	c.cleanupTimers = make(map[string]*time.Timer)
 	c.stopCh = make(chan struct{})
+	c.heartbeatNow = make(chan chan struct{})
+	c.startedAt = time.Now()
+	if c.BreakerThreshold > 0 {
+		c.breaker = &circuitBreaker{threshold: c.BreakerThreshold, cooldown: c.BreakerCooldown}
+	}
+
+	// Local status endpoint for operators
+	if c.StatusAddress != "" {
+		go c.startStatusServer()
+	}
+
+	// Catch typos in the parameter allowlist early
+	for _, name := range c.AllowedParameters {
+		if !knownParameter(name) {
+			c.Logger.Warn("Ignoring unknown parameter %q in allowed parameters", name)
+		}
+	}
+
+	// Fail early on a bad server URL or TLS setup rather than on the first dial
+	if _, err := shared.WebSocketURL(c.APIServerURL, "/collector-ws"); err != nil {
+		return err
+	}
+	tlsConfig, err := loadTLSConfig(c.TLSCAFile, c.TLSCertFile, c.TLSKeyFile)
+	if err != nil {
+		return fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+	c.tlsConfig = tlsConfig
+	if tlsConfig != nil && !strings.HasPrefix(c.APIServerURL, "https://") {
+		c.Logger.Warn("TLS settings are ignored because the API server URL %s is not https", c.APIServerURL)
+	}
+
+	// A missing input directory would only show up as failed collections
+	if c.InputDir != "" {
+		info, err := os.Stat(c.InputDir)
+		if err != nil {
+			return fmt.Errorf("invalid input directory: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("invalid input directory: %s is not a directory", c.InputDir)
+		}
+	}
+
+	// Pull and verify the image now rather than on the first request
+	if err := c.prepareImage(); err != nil {
+		return fmt.Errorf("container image %s not ready: %w", c.ContainerImage, err)
+	}
+
+	// Remove captures left behind by earlier runs
+	c.pruneDataDir()
+
+	// Make sure the server speaks a compatible protocol
+	if err := c.checkServerVersion(); err != nil {
+		return fmt.Errorf("incompatible server: %w", err)
+	}
 
 	// Authenticate with API server
 	if err := c.authenticate(); err != nil {
@@ -62,6 +217,12 @@ func (c *Client) Start() error {
 	// Start heartbeat
 	go c.heartbeat()
 
+	// Drop requests whose completion was missed
+	go c.sweepActiveRequests()
+
+	// Allow operators to drain the collector locally (SIGUSR1)
+	go c.watchDrainSignal()
+
 	c.Logger.Info("Collector client started successfully")
 
 	// Block main goroutine
@@ -72,6 +233,38 @@ func (c *Client) Start() error {
 }
 
 
+// retryPolicy is how the collector retries requests the server answers with
+// 429 or 503, honoring their Retry-After header
+func (c *Client) retryPolicy() shared.RetryPolicy {
+	policy := shared.DefaultRetryPolicy
+	policy.OnRetry = func(status int, wait time.Duration) {
+		c.Logger.Warn("Server returned status %d, retrying in %s", status, wait.Round(time.Millisecond))
+	}
+	return policy
+}
+
+// checkServerVersion verifies the API server is compatible with this collector.
+// Version differences only warn; an unsupported protocol version is an error.
+func (c *Client) checkServerVersion() error {
+	httpClient := c.newHTTPClient(30 * time.Second)
+	info, err := shared.FetchServerVersion(httpClient, c.APIServerURL)
+	if err != nil {
+		c.Logger.Warn("Could not verify server version: %v", err)
+		return nil
+	}
+
+	if err := version.CheckCompatible(info); err != nil {
+		return err
+	}
+
+	if info.Version != version.Get() {
+		c.Logger.Warn("Server version %s differs from collector version %s", info.Version, version.Get())
+	}
+
+	c.Logger.Info("Connected to API server version %s (protocol %d)", info.Version, info.ProtocolVersion)
+	return nil
+}
+
 // authenticate performs authentication with the API server
 func (c *Client) authenticate() error {
 	// For demo purposes, use hardcoded credentials
@@ -86,15 +279,18 @@ func (c *Client) authenticate() error {
 		return fmt.Errorf("failed to marshal login data: %w", err)
 	}
 
-	httpClient := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequest("POST", c.APIServerURL+"/api/auth/login", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create login request: %w", err)
+	httpClient := c.newHTTPClient(30 * time.Second)
+	login := func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", c.APIServerURL+"/api/auth/login", bytes.NewBuffer(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create login request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := httpClient.Do(req)
+	// Login is rate limited per IP, so back off as the server asks
+	resp, err := c.retryPolicy().Do(httpClient, login)
 	if err != nil {
 		return fmt.Errorf("failed to send login request: %w", err)
 	}
@@ -105,15 +301,9 @@ func (c *Client) authenticate() error {
 		if err := c.register(httpClient); err != nil {
 			return fmt.Errorf("failed to register user: %w", err)
 		}
-		// Try login again after registration - need to create a new request since the body was consumed
+		// Try login again after registration
 		resp.Body.Close()
-		retryReq, err := http.NewRequest("POST", c.APIServerURL+"/api/auth/login", bytes.NewBuffer(jsonData))
-		if err != nil {
-			return fmt.Errorf("failed to create retry login request: %w", err)
-		}
-		retryReq.Header.Set("Content-Type", "application/json")
-
-		resp, err = httpClient.Do(retryReq)
+		resp, err = c.retryPolicy().Do(httpClient, login)
 		if err != nil {
 			return fmt.Errorf("failed to send login request after registration: %w", err)
 		}
@@ -150,14 +340,14 @@ func (c *Client) register(httpClient *http.Client) error {
 		return fmt.Errorf("failed to marshal register data: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", c.APIServerURL+"/api/auth/register", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create register request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := httpClient.Do(req)
+	resp, err := c.retryPolicy().Do(httpClient, func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", c.APIServerURL+"/api/auth/register", bytes.NewBuffer(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create register request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
 	if err != nil {
 		return fmt.Errorf("failed to send register request: %w", err)
 	}
@@ -170,29 +360,29 @@ func (c *Client) register(httpClient *http.Client) error {
 	return nil
 }
 
-// stripProtocolAndSlash removes http:// or https:// prefix and trailing slash from URL
-func (c *Client) stripProtocolAndSlash(url string) string {
-	// Remove protocol prefix
-	url = strings.TrimPrefix(url, "http://")
-	url = strings.TrimPrefix(url, "https://")
-
-	// Remove trailing slash
-	url = strings.TrimSuffix(url, "/")
-
-	return url
-}
-
 // connectWebSocket establishes WebSocket connection to the API server
 func (c *Client) connectWebSocket() error {
-	// Strip protocol and trailing slash from API server URL
-	cleanURL := c.stripProtocolAndSlash(c.APIServerURL)
-	url := fmt.Sprintf("wss://%s/collector-ws", cleanURL)
+	wsURL, err := shared.WebSocketURL(c.APIServerURL, "/collector-ws")
+	if err != nil {
+		return err
+	}
+
+	// Authenticate the upgrade request the same way as the REST calls
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer "+c.authToken)
 
-	dialer := websocket.DefaultDialer
-	conn, _, err := dialer.Dial(url, nil)
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = c.tlsConfig
+	dialer.Subprotocols = shared.WebSocketSubprotocols
+	conn, resp, err := dialer.Dial(wsURL, headers)
 	if err != nil {
+		if resp != nil {
+			c.Logger.Error("WebSocket connection failed with status: %d %s", resp.StatusCode, resp.Status)
+		}
 		return fmt.Errorf("failed to connect to WebSocket: %w", err)
 	}
+	// Servers that predate subprotocols don't choose one
+	c.Logger.Info("WebSocket connected (subprotocol %s)", shared.SubprotocolName(conn.Subprotocol()))
 
 	c.conn = conn
 
@@ -202,7 +392,14 @@ func (c *Client) connectWebSocket() error {
 		return fmt.Errorf("authentication failed: %w", err)
 	}
 
+	c.mu.Lock()
+	c.connected = true
+	c.mu.Unlock()
+
 	c.Logger.Info("WebSocket connection established and authenticated")
+
+	// Report health and location right away instead of at the first heartbeat tick
+	c.sendHeartbeat()
 	return nil
 }
 
@@ -213,7 +410,7 @@ func (c *Client) sendAuthMessage() error {
 		Payload: shared.StationRegistration{
 			StationID:      c.StationID,
 			Capabilities:   "{}",
-			ContainerImage: c.ContainerImage,
+			ContainerImage: c.containerImage(),
 		},
 	}
 
@@ -222,7 +419,10 @@ func (c *Client) sendAuthMessage() error {
 		return fmt.Errorf("failed to marshal auth message: %w", err)
 	}
 
-	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+	c.writeMu.Lock()
+	err = c.conn.WriteMessage(websocket.TextMessage, data)
+	c.writeMu.Unlock()
+	if err != nil {
 		return fmt.Errorf("failed to send auth message: %w", err)
 	}
 
@@ -247,7 +447,22 @@ func (c *Client) sendAuthMessage() error {
 		return fmt.Errorf("authentication failed: unexpected response type %s", response.Type)
 	}
 
+	var negotiated shared.AuthSuccess
+	payload, _ := json.Marshal(response.Payload)
+	if err := json.Unmarshal(payload, &negotiated); err != nil {
+		return fmt.Errorf("failed to unmarshal auth response: %w", err)
+	}
+	if err := negotiated.Validate(); err != nil {
+		return fmt.Errorf("cannot work with the server's settings: %w", err)
+	}
+	c.negotiated = negotiated
+	c.negotiatedAt = time.Now()
+
 	c.Logger.Info("Authentication successful")
+	if negotiated.Server != nil {
+		c.Logger.Info("Server expects capture files matching %q of at most %d bytes (protocol %d)",
+			negotiated.FilePattern, negotiated.MaxFileSize, negotiated.Server.ProtocolVersion)
+	}
 	return nil
 }
 
@@ -263,6 +478,9 @@ func (c *Client) handleMessages() {
 			messageType, message, err := c.conn.ReadMessage()
 			if err != nil {
 				c.Logger.Error("Failed to read WebSocket message: %v", err)
+				c.mu.Lock()
+				c.connected = false
+				c.mu.Unlock()
 				return
 			}
 
@@ -281,11 +499,17 @@ func (c *Client) processMessage(message []byte) {
 		return
 	}
 
+	// Newer servers may send fields and message types this collector doesn't
+	// know; those are ignored
+	if version := wsMsg.EffectiveVersion(); version > shared.MessageVersion && !c.newerVersionWarned {
+		c.newerVersionWarned = true
+		c.Logger.Warn("Server sends WebSocket message version %d, this collector understands %d; consider upgrading", version, shared.MessageVersion)
+	}
+
 	switch wsMsg.Type {
 	case "data_request":
 		var request shared.DataRequest
-		payload, _ := json.Marshal(wsMsg.Payload)
-		if err := json.Unmarshal(payload, &request); err != nil {
+		if err := shared.DecodePayload(wsMsg.Payload, &request); err != nil {
 			c.Logger.Error("Failed to unmarshal data request: %v", err)
 			return
 		}
@@ -297,24 +521,63 @@ func (c *Client) processMessage(message []byte) {
 	case "ice_candidate":
 		c.handleICECandidate(wsMsg)
 
+	case "ice_restart":
+		c.handleICERestart(wsMsg)
+
 	case "new_ice_session":
 		c.handleNewICESession(wsMsg)
 
+	case "session_cancelled":
+		var cancelled shared.SessionCancelledNotification
+		if err := shared.DecodePayload(wsMsg.Payload, &cancelled); err != nil {
+			c.Logger.Error("Failed to unmarshal session cancellation: %v", err)
+			return
+		}
+		c.cancelSession(cancelled.SessionID)
+
+	case "session_failed":
+		var failed shared.SessionFailedNotification
+		if err := shared.DecodePayload(wsMsg.Payload, &failed); err != nil {
+			c.Logger.Error("Failed to unmarshal session failure: %v", err)
+			return
+		}
+		c.Logger.Warn("Server failed session %s: %s", failed.SessionID, failed.Reason)
+		c.cancelSession(failed.SessionID)
+
+	case "control":
+		var control shared.ControlMessage
+		if err := shared.DecodePayload(wsMsg.Payload, &control); err != nil {
+			c.Logger.Error("Failed to unmarshal control message: %v", err)
+			return
+		}
+		c.handleControl(control)
+
+	case "upload_request":
+		// The server wants this file in its cache to serve several receivers
+		var upload shared.UploadRequest
+		if err := shared.DecodePayload(wsMsg.Payload, &upload); err != nil {
+			c.Logger.Error("Failed to unmarshal upload request: %v", err)
+			return
+		}
+		go c.handleUploadRequest(upload)
+
 	case "heartbeat":
 		c.sendHeartbeatResponse()
 
 	case "heartbeat_response":
 		// Handle heartbeat response from server (acknowledgment of our heartbeat)
 		var heartbeat shared.HeartbeatMessage
-		payload, _ := json.Marshal(wsMsg.Payload)
-		if err := json.Unmarshal(payload, &heartbeat); err != nil {
+		if err := shared.DecodePayload(wsMsg.Payload, &heartbeat); err != nil {
 			c.Logger.Error("Failed to unmarshal heartbeat response: %v", err)
 			return
 		}
+		c.mu.Lock()
+		c.lastHeartbeatAck = time.Now()
+		c.mu.Unlock()
 		c.Logger.Debug("Received heartbeat response from server")
 
 	default:
-		c.Logger.Warn("Unknown message type: %s", wsMsg.Type)
+		c.Logger.Debug("Ignoring unknown message type: %s", wsMsg.Type)
 	}
 }
 
@@ -322,30 +585,319 @@ func (c *Client) processMessage(message []byte) {
 func (c *Client) handleDataRequest(request shared.DataRequest) {
 	c.Logger.Debug("handleDataRequest: acquiring lock for activeRequests")
 	c.mu.Lock()
-	c.activeRequests[request.ID] = &request
+	if _, active := c.activeRequests[request.ID]; active {
+		// The server sends unanswered requests again after a reconnect
+		c.mu.Unlock()
+		c.Logger.Info("Ignoring data request %s: already working on it", request.ID)
+		return
+	}
+	if c.draining {
+		c.mu.Unlock()
+		c.Logger.Warn("Rejecting data request %s: collector is draining", request.ID)
+		c.sendRejected(request.ID, "collector is draining")
+		return
+	}
+	if err := c.admitRequest(request); err != nil {
+		c.mu.Unlock()
+		c.Logger.Warn("Rejecting data request %s: %v", request.ID, err)
+		c.sendRejected(request.ID, err.Error())
+		return
+	}
+	if _, err := convert.Lookup(request.Format); err != nil {
+		c.mu.Unlock()
+		c.Logger.Warn("Rejecting data request %s: %v", request.ID, err)
+		c.sendRejected(request.ID, err.Error())
+		return
+	}
+	if _, err := c.resolveImage(request.Image); err != nil {
+		c.mu.Unlock()
+		c.Logger.Warn("Rejecting data request %s: %v", request.ID, err)
+		c.sendRejected(request.ID, err.Error())
+		return
+	}
+	if err := c.checkDuration(request); err != nil {
+		c.mu.Unlock()
+		c.Logger.Warn("Rejecting data request %s: %v", request.ID, err)
+		c.sendRejected(request.ID, err.Error())
+		return
+	}
+	if request.RequestType == shared.RequestTypeStream && c.StreamMaxDuration <= 0 {
+		c.mu.Unlock()
+		c.Logger.Warn("Rejecting stream request %s: streaming is disabled", request.ID)
+		c.sendRejected(request.ID, "streaming is disabled on this collector")
+		return
+	}
+	c.activeRequests[request.ID] = &trackedRequest{DataRequest: request, receivedAt: time.Now()}
+	c.inFlight++
+	if request.RequestType == shared.RequestTypeStream {
+		c.streams[request.ID] = request
+	}
 	c.mu.Unlock()
 	c.Logger.Debug("handleDataRequest: released lock for activeRequests")
 
 	c.Logger.Info("Received data request: %s", request.ID)
 
+	// Streams capture once the receiver connects, so they're ready right away
+	if request.RequestType == shared.RequestTypeStream {
+		go func() {
+			if err := c.sendResponse(shared.DataResponse{RequestID: request.ID, Status: "ready", StationID: c.StationID}); err != nil {
+				c.Logger.Error("Failed to announce stream %s: %v", request.ID, err)
+			}
+			c.awaitTransfer(request.ID)
+		}()
+		return
+	}
+
 	go func() {
-		if err := c.processRequest(request); err != nil {
+		err := c.processRequest(request)
+		c.requestDone(request.ID)
+		if err != nil {
 			c.sendError(request.ID, err.Error())
+			c.finishWork()
 			return
 		}
+
+		// The request isn't finished until the receiver has fetched the file
+		c.awaitTransfer(request.ID)
 	}()
 }
 
+// handleControl applies an operator control command broadcast by the API server
+func (c *Client) handleControl(control shared.ControlMessage) {
+	c.Logger.Info("Received %s control command (issued by %s, reason: %s)", control.Command, control.IssuedBy, control.Reason)
+
+	switch control.Command {
+	case shared.ControlCommandDrain:
+		c.Drain()
+
+	case shared.ControlCommandResume:
+		c.mu.Lock()
+		c.draining = false
+		c.mu.Unlock()
+		c.Logger.Info("Collector resumed accepting requests")
+		c.sendHeartbeat()
+
+	case shared.ControlCommandReload:
+		// Settings carried by the command apply to the next data collection
+		if control.ContainerImage != "" {
+			c.mu.Lock()
+			previous := c.ContainerImage
+			c.ContainerImage = control.ContainerImage
+			c.mu.Unlock()
+			c.Logger.Info("Container image changed from %s to %s", previous, control.ContainerImage)
+			if control.ContainerImage != previous {
+				go c.refreshImage(control.ContainerImage)
+			}
+		}
+
+		// Make sure the data directory is still usable
+		if err := os.MkdirAll(c.DataDir, 0755); err != nil {
+			c.Logger.Error("Data directory %s is not usable after reload: %v", c.DataDir, err)
+		}
+		c.Logger.Info("Collector configuration reloaded")
+
+	default:
+		c.Logger.Warn("Unknown control command: %s", control.Command)
+	}
+}
+
+// Drain stops the collector from accepting new requests. In-flight collections
+// and transfers complete normally; once they have, the client exits if
+// ExitAfterDrain is set.
+func (c *Client) Drain() {
+	c.mu.Lock()
+	alreadyDraining := c.draining
+	c.draining = true
+	inFlight := c.inFlight
+	c.mu.Unlock()
+
+	if alreadyDraining {
+		c.Logger.Info("Collector already draining (%d in flight)", inFlight)
+		return
+	}
+
+	c.Logger.Info("Collector draining: no longer accepting new requests (%d in flight)", inFlight)
+
+	// Tell the server right away so it stops routing requests here
+	c.requestHeartbeat()
+
+	if inFlight == 0 {
+		c.drainComplete()
+	}
+}
+
+// IsDraining reports whether the collector is draining
+func (c *Client) IsDraining() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.draining
+}
+
+// status returns the status reported in heartbeats
+func (c *Client) status() string {
+	if c.IsDraining() {
+		return "draining"
+	}
+	if c.breaker != nil && c.breaker.State() == breakerOpen {
+		return "unhealthy"
+	}
+	return "active"
+}
+
+// beginWork records the start of a collection or transfer
+func (c *Client) beginWork() {
+	c.mu.Lock()
+	c.inFlight++
+	c.mu.Unlock()
+}
+
+// finishWork records the end of a collection or transfer and completes a pending drain
+func (c *Client) finishWork() {
+	c.mu.Lock()
+	if c.inFlight > 0 {
+		c.inFlight--
+	}
+	drained := c.draining && c.inFlight == 0
+	c.mu.Unlock()
+
+	if drained {
+		c.drainComplete()
+	}
+}
+
+// awaitTransfer keeps a finished collection in flight until its file has been
+// transferred, or until DrainTransferWait passes without a transfer
+func (c *Client) awaitTransfer(requestID string) {
+	wait := c.DrainTransferWait
+	if wait <= 0 {
+		wait = 5 * time.Minute
+	}
+
+	c.mu.Lock()
+	c.awaitingTransfer[requestID] = time.AfterFunc(wait, func() {
+		c.Logger.Debug("No transfer for request %s within %v", requestID, wait)
+		c.transferDone(requestID)
+	})
+	c.mu.Unlock()
+}
+
+// transferDone releases a collection that was waiting for its transfer
+func (c *Client) transferDone(requestID string) {
+	c.mu.Lock()
+	timer, exists := c.awaitingTransfer[requestID]
+	if exists {
+		timer.Stop()
+		delete(c.awaitingTransfer, requestID)
+	}
+	// A stream nobody connected to is over too
+	if _, waiting := c.streams[requestID]; waiting {
+		delete(c.streams, requestID)
+		delete(c.activeRequests, requestID)
+	}
+	c.mu.Unlock()
+
+	if exists {
+		c.finishWork()
+	}
+
+	// Keep the file around for other subscribers until the retention period passes
+	c.scheduleCleanup(requestID)
+}
+
+// trackedRequest is an entry of activeRequests
+type trackedRequest struct {
+	shared.DataRequest
+	receivedAt time.Time
+}
+
+// activeRequestSweepInterval is how often stale activeRequests entries are looked for
+const activeRequestSweepInterval = 5 * time.Minute
+
+// requestDone forgets a request once its collection or stream has finished
+func (c *Client) requestDone(requestID string) {
+	c.mu.Lock()
+	delete(c.activeRequests, requestID)
+	c.mu.Unlock()
+}
+
+// activeRequestCount returns the number of requests being collected or streamed
+func (c *Client) activeRequestCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.activeRequests)
+}
+
+// activeRequestTTL is how long a request may stay active before the sweep
+// assumes its completion was missed: the longest a collection, a stream and
+// the wait for its transfer can take, and at least an hour
+func (c *Client) activeRequestTTL() time.Duration {
+	ttl := c.CollectionTimeout + c.StreamMaxDuration + c.DrainTransferWait
+	if ttl < time.Hour {
+		ttl = time.Hour
+	}
+	return ttl
+}
+
+// sweepActiveRequests periodically drops activeRequests entries older than
+// activeRequestTTL, so a missed completion can't grow the map forever
+func (c *Client) sweepActiveRequests() {
+	ticker := time.NewTicker(activeRequestSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+			cutoff := time.Now().Add(-c.activeRequestTTL())
+			c.mu.Lock()
+			for requestID, request := range c.activeRequests {
+				if request.receivedAt.Before(cutoff) {
+					c.Logger.Warn("Dropping stale active request %s received at %s", requestID, request.receivedAt.Format(time.RFC3339))
+					delete(c.activeRequests, requestID)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// drainComplete is called once a draining collector has no work left
+func (c *Client) drainComplete() {
+	c.Logger.Info("Drain complete: no collections or transfers in flight")
+	if c.ExitAfterDrain {
+		c.Logger.Info("Exiting after drain")
+		c.Stop()
+	}
+}
+
+// containerImage returns the image used for data collection
+func (c *Client) containerImage() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ContainerImage
+}
+
+// resolveImage returns the image a request runs in: the configured image when
+// none was asked for, otherwise the requested one if it's allowlisted.
+// c.mu must be held.
+func (c *Client) resolveImage(requested string) (string, error) {
+	if requested == "" || requested == c.ContainerImage {
+		return c.ContainerImage, nil
+	}
+	for _, image := range c.AllowedImages {
+		if requested == image {
+			return image, nil
+		}
+	}
+	return "", fmt.Errorf("image %q is not allowed on this collector", requested)
+}
+
 // handleICEAnswer processes ICE answer messages received via WebSocket
 func (c *Client) handleICEAnswer(wsMsg shared.WebSocketMessage) {
 	// Extract the answer data from the message
-	var answerData struct {
-		SessionID string `json:"session_id"`
-		AnswerSDP string `json:"answer_sdp"`
-	}
-	
-	payload, _ := json.Marshal(wsMsg.Payload)
-	if err := json.Unmarshal(payload, &answerData); err != nil {
+	var answerData shared.ICEAnswerNotification
+	if err := shared.DecodePayload(wsMsg.Payload, &answerData); err != nil {
 		c.Logger.Error("Failed to unmarshal ICE answer: %v", err)
 		return
 	}
@@ -377,58 +929,62 @@ func (c *Client) handleICEAnswer(wsMsg shared.WebSocketMessage) {
 
 // handleICECandidate processes ICE candidate messages received via WebSocket
 func (c *Client) handleICECandidate(wsMsg shared.WebSocketMessage) {
-	var signalData struct {
-		SessionID     string  `json:"session_id"`
-		Candidate     string  `json:"candidate"`
-		SDPMLineIndex float64 `json:"sdpMLineIndex"`
-		SDPMid        string  `json:"sdpMid"`
-	}
-
-	payloadBytes, err := json.Marshal(wsMsg.Payload)
-	if err != nil {
-		c.Logger.Error("Failed to marshal ICE candidate payload: %v", err)
-		return
-	}
-
-	if err := json.Unmarshal(payloadBytes, &signalData); err != nil {
-		c.Logger.Error("Failed to unmarshal ICE candidate payload: %v", err)
+	var notification shared.ICECandidateNotification
+	if err := shared.DecodePayload(wsMsg.Payload, &notification); err != nil {
+		c.Logger.Error("Ignoring malformed ICE candidate: %v", err)
 		return
 	}
+	sessionID := notification.SessionID
 
 	c.Logger.Debug("handleICECandidate: acquiring read lock for peerConnections")
 	c.mu.RLock()
-	pc, exists := c.peerConnections[signalData.SessionID]
+	pc, exists := c.peerConnections[sessionID]
 	c.mu.RUnlock()
 	c.Logger.Debug("handleICECandidate: released read lock for peerConnections")
 
 	if !exists {
-		c.Logger.Warn("No peer connection found for session %s to add ICE candidate", signalData.SessionID)
+		c.Logger.Warn("No peer connection found for session %s to add ICE candidate", sessionID)
 		return
 	}
 
-	sdpMLineIndexUint16 := uint16(signalData.SDPMLineIndex)
-
-	candidateInit := webrtc.ICECandidateInit{
-		Candidate:     signalData.Candidate,
-		SDPMLineIndex: &sdpMLineIndexUint16,
-		SDPMid:        &signalData.SDPMid,
-	}
-
-	if err := pc.AddICECandidate(candidateInit); err != nil {
-		c.Logger.Error("Failed to add ICE candidate for session %s: %v", signalData.SessionID, err)
+	if err := pc.AddICECandidate(notification.CandidateInit()); err != nil {
+		c.Logger.Error("Failed to add ICE candidate for session %s: %v", sessionID, err)
 	} else {
-		c.Logger.Debug("Successfully added ICE candidate for session %s", signalData.SessionID)
+		c.Logger.Debug("Successfully added ICE candidate for session %s", sessionID)
 	}
 }
 
 // processRequest executes the data collection process
 func (c *Client) processRequest(request shared.DataRequest) error {
 	// Run Docker command to generate data
-	filePath, err := c.runDataCollection(request)
+	filePath, metadata, err := c.collectData(request)
 	if err != nil {
 		return fmt.Errorf("data collection failed: %w", err)
 	}
 
+	// Convert to the format the receiver asked for before anyone can fetch the file
+	if request.Format != "" && request.Format != convert.FormatNPZ {
+		c.Logger.Info("Converting capture for request %s to %s", request.ID, request.Format)
+		filePath, err = convert.File(request.Format, filePath)
+		if err != nil {
+			c.removeRequestData(request.ID)
+			return err
+		}
+	}
+
+	// Receivers save the metadata next to the file; a capture without it is still usable
+	if err := c.writeCaptureMetadata(metadata, request.Format, filePath); err != nil {
+		c.Logger.Warn("Failed to write capture metadata for request %s: %v", request.ID, err)
+	}
+
+	// Push the file to the server cache first so it's there when the receiver is notified;
+	// WebRTC remains available if the upload fails
+	if c.UploadFiles {
+		if err := c.uploadFile(request.ID, filePath); err != nil {
+			c.Logger.Warn("Failed to upload file for request %s, falling back to WebRTC only: %v", request.ID, err)
+		}
+	}
+
 	// Get file size
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
@@ -450,25 +1006,68 @@ func (c *Client) processRequest(request shared.DataRequest) error {
 
 
 // runDataCollection executes the Docker command to collect data
-func (c *Client) runDataCollection(request shared.DataRequest) (string, error) {
-	// Ensure data directory exists
-	if err := os.MkdirAll(c.DataDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create data directory: %w", err)
+func (c *Client) runDataCollection(request shared.DataRequest) (string, *models.CaptureMetadata, error) {
+	// Each request writes into its own subdirectory so its output can't be
+	// confused with another collection's
+	requestDir := c.requestDataDir(request.ID)
+	if err := os.MkdirAll(requestDir, 0755); err != nil {
+		return "", nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	// Validate request parameters against the allowlist; only canonical values reach the command line
+	paramArgs, err := buildParameterArgs(request.Parameters, c.AllowedParameters)
+	if err != nil {
+		return "", nil, requestError{fmt.Errorf("invalid request parameters: %w", err)}
+	}
+	durationFlags, err := durationArgs(request.DurationSeconds, paramArgs)
+	if err != nil {
+		return "", nil, requestError{err}
+	}
+	paramArgs = append(paramArgs, durationFlags...)
+
+	// The image was checked when the request was accepted, but the configured one may have changed since
+	c.mu.RLock()
+	image, err := c.resolveImage(request.Image)
+	c.mu.RUnlock()
+	if err != nil {
+		return "", nil, requestError{err}
+	}
+	metadata := c.newCaptureMetadata(request, image)
+
+	mounts, err := c.mountArgs(requestDir)
+	if err != nil {
+		return "", nil, err
 	}
 
 	// Build Docker command with station ID as argument
-	dockerArgs := []string{"run", "-i", "--rm",
-		"--device", "/dev/bus/usb",
-		"--mount", fmt.Sprintf("type=bind,src=%s,dst=/SDR-TDOA-DF/nice_data", c.DataDir),
-		c.ContainerImage,
-		"./sync_collect_samples.py", c.StationID}
-
-	cmd := exec.Command("docker", dockerArgs...)
-
-	// Debug: Log the exact command being executed
-	c.Logger.Debug("Executing Docker command: docker %s", strings.Join(dockerArgs, " "))
-	c.Logger.Debug("Data directory: %s", c.DataDir)
-	c.Logger.Debug("Container image: %s", c.ContainerImage)
+	name := containerName(request.ID)
+	dockerArgs := []string{"run", "-i", "--rm", "--name", name,
+		"--device", "/dev/bus/usb"}
+	dockerArgs = append(dockerArgs, mounts...)
+	dockerArgs = append(dockerArgs, resourceLimitArgs(c.DockerMemory, c.DockerCPUs, c.DockerPidsLimit)...)
+	dockerArgs = append(dockerArgs, image, "./sync_collect_samples.py", c.StationID)
+	dockerArgs = append(dockerArgs, paramArgs...)
+
+	// Bound the whole collection so a hung capture can't block the collector forever
+	ctx := context.Background()
+	timeout, timeoutSetting := c.collectionTimeout(request)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, "docker", dockerArgs...)
+	setProcessGroup(cmd)
+	// Don't let a child still holding stdout/stderr keep Run from returning after a kill
+	cmd.WaitDelay = 10 * time.Second
+
+	// Debug: Log the command being executed with any sensitive values redacted
+	redactedArgs, secrets := redactDockerArgs(dockerArgs)
+	if c.LogDockerCommand {
+		c.Logger.Debug("Executing Docker command: docker %s", strings.Join(redactedArgs, " "))
+	}
+	c.Logger.Debug("Data directory: %s", requestDir)
+	c.Logger.Debug("Container image: %s", image)
 	c.Logger.Debug("Station ID: %s", c.StationID)
 
 	// Set up output capture
@@ -478,42 +1077,124 @@ func (c *Client) runDataCollection(request shared.DataRequest) (string, error) {
 
 	// Run the command
 	c.Logger.Info("Starting data collection for request %s", request.ID)
+	metadata.CaptureStart = time.Now().UTC()
 	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			// Logged separately from other failures so operators can tell when to raise the timeout
+			c.Logger.Warn("Data collection for request %s timed out after %s (%s)", request.ID, timeout, timeoutSetting)
+			c.killContainer(name)
+			c.removeRequestData(request.ID)
+
+			output := containerOutputTail(stdout.String(), stderr.String(), secrets, c.ErrorOutputLimit)
+			if output == "" {
+				return "", nil, fmt.Errorf("%w after %s", errCollectionTimeout, timeout)
+			}
+			return "", nil, fmt.Errorf("%w after %s, output: %s", errCollectionTimeout, timeout, output)
+		}
+
 		// Debug: Log detailed error information
 		c.Logger.Error("Docker command failed for request %s", request.ID)
 		c.Logger.Error("Exit error: %v", err)
-		c.Logger.Error("Stdout: %s", stdout.String())
-		c.Logger.Error("Stderr: %s", stderr.String())
-		return "", fmt.Errorf("docker command failed: %w, stderr: %s", err, stderr.String())
+		c.Logger.Error("Stdout: %s", redactOutput(stdout.String(), secrets))
+		c.Logger.Error("Stderr: %s", redactOutput(stderr.String(), secrets))
+		c.removeRequestData(request.ID)
+
+		// Include a bounded tail of the container output so the requester can see why it failed
+		output := containerOutputTail(stdout.String(), stderr.String(), secrets, c.ErrorOutputLimit)
+		if output == "" {
+			return "", nil, fmt.Errorf("docker command failed: %w", err)
+		}
+		return "", nil, fmt.Errorf("docker command failed: %w, output: %s", err, output)
 	}
 
+	metadata.CaptureEnd = time.Now().UTC()
+	metadata.Clock = clockStatus()
+
 	// Debug: Log successful execution
 	c.Logger.Debug("Docker command completed successfully for request %s", request.ID)
-	c.Logger.Debug("Stdout: %s", stdout.String())
+	c.Logger.Debug("Stdout: %s", redactOutput(stdout.String(), secrets))
 	if stderr.Len() > 0 {
-		c.Logger.Debug("Stderr: %s", stderr.String())
+		c.Logger.Debug("Stderr: %s", redactOutput(stderr.String(), secrets))
 	}
 
-	// Find the generated file (latest file in data directory)
-	filePath, err := c.findLatestFile()
+	// Find the generated file in the request's directory
+	filePath, err := findLatestFile(requestDir, c.negotiated.FilePattern)
 	if err != nil {
-		c.Logger.Error("Failed to find generated file in directory %s: %v", c.DataDir, err)
-		return "", fmt.Errorf("failed to find generated file: %w", err)
+		c.Logger.Error("Failed to find generated file in directory %s: %v", requestDir, err)
+		return "", nil, fmt.Errorf("failed to find generated file: %w", err)
+	}
+
+	// A container can exit 0 without writing a usable capture; report that instead of sending it
+	if c.ValidateCaptures {
+		if err := convert.ValidateNPZ(filePath); err != nil {
+			c.Logger.Error("Data collection for request %s produced an invalid file %s: %v", request.ID, filePath, err)
+			c.removeRequestData(request.ID)
+			return "", nil, fmt.Errorf("collection produced an invalid file: %w", err)
+		}
 	}
 
 	c.Logger.Info("Data collection completed for request %s, file: %s", request.ID, filePath)
 	c.Logger.Info("Timestamp: Data collection completed at %s", time.Now().Format("2006-01-02 15:04:05.000"))
-	return filePath, nil
+	return filePath, metadata, nil
 }
 
-// findLatestFile locates the most recently created file in the data directory
-func (c *Client) findLatestFile() (string, error) {
-	files, err := filepath.Glob(filepath.Join(c.DataDir, "*"))
+// collectionTimeout returns how long a request's collection may run and the
+// setting that limits it. A request with a duration_seconds may run
+// CaptureGrace longer than its duration, but never longer than
+// CollectionTimeout. It returns 0 when nothing limits the collection.
+func (c *Client) collectionTimeout(request shared.DataRequest) (time.Duration, string) {
+	if request.DurationSeconds > 0 && c.CaptureGrace > 0 {
+		bound := time.Duration(request.DurationSeconds*float64(time.Second)) + c.CaptureGrace
+		if c.CollectionTimeout == 0 || bound < c.CollectionTimeout {
+			return bound, "duration_seconds plus COLLECTOR_CAPTURE_GRACE_SECONDS"
+		}
+	}
+	return c.CollectionTimeout, "COLLECTOR_COLLECTION_TIMEOUT_SECONDS"
+}
+
+// checkDuration rejects a duration_seconds the collection script doesn't
+// accept or that COLLECTOR_COLLECTION_TIMEOUT_SECONDS wouldn't leave time for
+func (c *Client) checkDuration(request shared.DataRequest) error {
+	if _, err := durationArgs(request.DurationSeconds, nil); err != nil {
+		return err
+	}
+	duration := time.Duration(request.DurationSeconds * float64(time.Second))
+	if c.CollectionTimeout > 0 && duration >= c.CollectionTimeout {
+		return fmt.Errorf("duration_seconds %g is longer than this collector's collection timeout of %s", request.DurationSeconds, c.CollectionTimeout)
+	}
+	return nil
+}
+
+// killContainer force-stops a collection container. Killing the Docker CLI
+// doesn't stop the container it started, so this is needed after a timeout.
+func (c *Client) killContainer(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "docker", "kill", name).CombinedOutput()
+	if err != nil {
+		// The container may already be gone if the CLI was the only thing hung
+		c.Logger.Debug("docker kill %s: %v: %s", name, err, strings.TrimSpace(string(output)))
+		return
+	}
+	c.Logger.Info("Killed timed out container %s", name)
+}
+
+// findLatestFile locates the most recently created file in dir whose name
+// matches pattern (empty for any), ignoring the metadata sidecar
+func findLatestFile(dir, pattern string) (string, error) {
+	if pattern == "" {
+		pattern = "*"
+	}
+	files, err := filepath.Glob(filepath.Join(dir, pattern))
 	if err != nil {
 		return "", err
 	}
 
 	if len(files) == 0 {
+		if pattern != "*" {
+			return "", fmt.Errorf("no files matching %s found in data directory", pattern)
+		}
 		return "", fmt.Errorf("no files found in data directory")
 	}
 
@@ -522,8 +1203,11 @@ func (c *Client) findLatestFile() (string, error) {
 	var latestTime time.Time
 
 	for _, file := range files {
+		if filepath.Base(file) == metadataFileName {
+			continue
+		}
 		info, err := os.Stat(file)
-		if err != nil {
+		if err != nil || info.IsDir() {
 			continue
 		}
 
@@ -533,6 +1217,11 @@ func (c *Client) findLatestFile() (string, error) {
 		}
 	}
 
+	// Only directories or the metadata sidecar matched
+	if latestFile == "" {
+		return "", errors.New("no data file produced")
+	}
+
 	return latestFile, nil
 }
 
@@ -553,6 +1242,25 @@ func (c *Client) sendResponse(response shared.DataResponse) error {
 	return err
 }
 
+// sendRejected tells the API server this collector won't handle a request so it can be routed elsewhere
+func (c *Client) sendRejected(requestID, reason string) {
+	response := shared.DataResponse{
+		RequestID: requestID,
+		Status:    "rejected",
+		Error:     reason,
+		StationID: c.StationID,
+	}
+
+	message := shared.WebSocketMessage{
+		Type:    "data_response",
+		Payload: response,
+	}
+
+	if err := c.sendWebSocketMessage(message); err != nil {
+		c.Logger.Error("Failed to send rejected response: %v", err)
+	}
+}
+
 // sendError sends an error response to the API server
 func (c *Client) sendError(requestID, errorMsg string) {
 	response := shared.DataResponse{
@@ -583,21 +1291,58 @@ func (c *Client) heartbeat() {
 			return
 		case <-ticker.C:
 			c.sendHeartbeat()
+		case sent := <-c.heartbeatNow:
+			c.sendHeartbeat()
+			close(sent)
 		}
 	}
 }
 
-// sendHeartbeat sends a heartbeat message
-func (c *Client) sendHeartbeat() {
+// requestHeartbeat has the heartbeat goroutine send a heartbeat now, for
+// callers such as the SIGUSR1 handler that don't otherwise write to the
+// connection, and waits until it has been sent or the client stops
+func (c *Client) requestHeartbeat() {
+	sent := make(chan struct{})
+	select {
+	case c.heartbeatNow <- sent:
+	case <-c.stopCh:
+		return
+	}
+	select {
+	case <-sent:
+	case <-c.stopCh:
+	}
+}
+
+// heartbeatMessage reports the collector's state and the health the server routes on
+func (c *Client) heartbeatMessage() shared.HeartbeatMessage {
 	heartbeat := shared.HeartbeatMessage{
 		StationID: c.StationID,
 		Timestamp: time.Now().Unix(),
-		Status:    "active",
+		Status:    c.status(),
+
+		ActiveRequests: c.activeRequestCount(),
+		ImageReady:     c.imageReady(),
+		Location:       c.Location,
 	}
 
+	if free, _, err := diskUsage(c.DataDir); err == nil {
+		heartbeat.DiskFreeBytes = &free
+	} else {
+		c.Logger.Debug("Failed to read free disk space in %s: %v", c.DataDir, err)
+	}
+	if clock := clockStatus(); clock.Error == "" {
+		heartbeat.ClockSynchronized = &clock.Synchronized
+	}
+
+	return heartbeat
+}
+
+// sendHeartbeat sends a heartbeat message
+func (c *Client) sendHeartbeat() {
 	message := shared.WebSocketMessage{
 		Type:    "heartbeat",
-		Payload: heartbeat,
+		Payload: c.heartbeatMessage(),
 	}
 
 	if err := c.sendWebSocketMessage(message); err != nil {
@@ -607,15 +1352,9 @@ func (c *Client) sendHeartbeat() {
 
 // sendHeartbeatResponse responds to heartbeat requests
 func (c *Client) sendHeartbeatResponse() {
-	heartbeat := shared.HeartbeatMessage{
-		StationID: c.StationID,
-		Timestamp: time.Now().Unix(),
-		Status:    "active",
-	}
-
 	message := shared.WebSocketMessage{
 		Type:    "heartbeat_response",
-		Payload: heartbeat,
+		Payload: c.heartbeatMessage(),
 	}
 
 	if err := c.sendWebSocketMessage(message); err != nil {
@@ -630,54 +1369,73 @@ func (c *Client) sendWebSocketMessage(message shared.WebSocketMessage) error {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
 	return c.conn.WriteMessage(websocket.TextMessage, data)
 }
 
 // Stop gracefully shuts down the collector client
 func (c *Client) Stop() {
-	close(c.stopCh)
+	c.stopOnce.Do(func() {
+		close(c.stopCh)
 
-	if c.conn != nil {
-		c.conn.Close()
-	}
+		if c.conn != nil {
+			c.conn.Close()
+		}
+	})
 }
 
 // handleNewICESession handles a new ICE session notification from the server
 func (c *Client) handleNewICESession(wsMsg shared.WebSocketMessage) {
-	var sessionData map[string]interface{}
-	payloadBytes, err := json.Marshal(wsMsg.Payload)
-	if err != nil {
-		c.Logger.Error("Failed to marshal new ICE session payload: %v", err)
-		return
-	}
-	if err := json.Unmarshal(payloadBytes, &sessionData); err != nil {
+	var session shared.NewICESessionNotification
+	if err := shared.DecodePayload(wsMsg.Payload, &session); err != nil {
 		c.Logger.Error("Failed to unmarshal new ICE session payload: %v", err)
 		return
 	}
 
-	sessionID, ok := sessionData["session_id"].(string)
-	if !ok {
+	if session.SessionID == "" {
 		c.Logger.Error("No session_id found in new_ice_session message")
 		return
 	}
 
 	// Now that we have the session, we can handle it
-	go c.handleICESession(sessionID, sessionData)
+	go c.handleICESession(session)
+}
+
+// errTransferCancelled marks a transfer stopped because the server cancelled its session
+var errTransferCancelled = errors.New("transfer cancelled")
+
+// cancelSession stops the transfer of a session whose request was cancelled.
+// Sessions without a transfer in progress, such as finished ones, are ignored.
+func (c *Client) cancelSession(sessionID string) {
+	c.mu.Lock()
+	cancelled, exists := c.sessionCancels[sessionID]
+	if exists {
+		close(cancelled)
+		delete(c.sessionCancels, sessionID)
+	}
+	c.mu.Unlock()
+
+	if !exists {
+		c.Logger.Debug("No transfer in progress for cancelled session %s", sessionID)
+		return
+	}
+	c.Logger.Info("Server cancelled session %s, stopping its transfer", sessionID)
 }
 
 // handleICESession handles an ICE transfer session
-func (c *Client) handleICESession(sessionID string, sessionData map[string]interface{}) {
+func (c *Client) handleICESession(session shared.NewICESessionNotification) {
+	sessionID := session.SessionID
 	c.Logger.Info("Handling ICE session: %s", sessionID)
 
 	// Extract request parameters
-	parameters, ok := sessionData["parameters"].(string)
-	if !ok {
+	if session.Parameters == "" {
 		c.Logger.Error("No parameters found in ICE session")
 		return
 	}
 
 	var params map[string]interface{}
-	if err := json.Unmarshal([]byte(parameters), &params); err != nil {
+	if err := json.Unmarshal([]byte(session.Parameters), &params); err != nil {
 		c.Logger.Error("Failed to parse session parameters: %v", err)
 		return
 	}
@@ -700,6 +1458,26 @@ func (c *Client) handleICESession(sessionID string, sessionData map[string]inter
 		return
 	}
 
+	// Transfers keep running while draining; track them so a drain waits for them
+	c.beginWork()
+	defer c.finishWork()
+	defer c.transferDone(requestID)
+
+	// Streams capture for as long as the receiver wants instead of sending a file
+	if request, ok := c.claimStream(requestID); ok {
+		defer c.requestDone(requestID)
+		if err := c.streamViaWebRTC(sessionID, request); err != nil {
+			if errors.Is(err, errTransferCancelled) {
+				c.Logger.Info("Stream for request %s cancelled", requestID)
+				return
+			}
+			c.Logger.Error("Stream for request %s failed: %v", requestID, err)
+			return
+		}
+		c.Logger.Info("Stream for request %s finished", requestID)
+		return
+	}
+
 	// Find the generated file for this request
 	filePath, err := c.findFileForRequest(requestID)
 	if err != nil {
@@ -707,8 +1485,17 @@ func (c *Client) handleICESession(sessionID string, sessionData map[string]inter
 		return
 	}
 
+	// Receivers triaging captures want a preview before the file
+	metadataOnly, _ := params["metadata_only"].(bool)
+
 	// Start WebRTC transfer
-	if err := c.sendFileViaWebRTC(sessionID, filePath); err != nil {
+	if err := c.sendFileViaWebRTC(sessionID, filePath, metadataOnly); err != nil {
+		if errors.Is(err, errTransferCancelled) {
+			// Nobody will fetch a cancelled request's file
+			c.Logger.Info("Transfer for session %s cancelled, removing data of request %s", sessionID, requestID)
+			c.removeRequestData(requestID)
+			return
+		}
 		c.Logger.Error("Failed to send file via WebRTC: %v", err)
 		return
 	}
@@ -718,59 +1505,52 @@ func (c *Client) handleICESession(sessionID string, sessionData map[string]inter
 
 // findFileForRequest finds the generated file for a specific request
 func (c *Client) findFileForRequest(requestID string) (string, error) {
-	// Look for files in the data directory that might match this request
-	// This is a simplified approach - in a real implementation, you'd want to
-	// track the mapping between requests and generated files more precisely
-	files, err := filepath.Glob(filepath.Join(c.DataDir, "*"))
-	if err != nil {
-		return "", err
-	}
-
-	if len(files) == 0 {
-		return "", fmt.Errorf("no files found in data directory")
-	}
-
-	// For now, return the most recent file
-	var latestFile string
-	var latestTime time.Time
+	return findLatestFile(c.requestDataDir(requestID), "")
+}
 
-	for _, file := range files {
-		info, err := os.Stat(file)
-		if err != nil {
-			continue
-		}
+// sendFileViaWebRTC sends a file using WebRTC data channels, with a preview
+// first if metadataOnly is set
+func (c *Client) sendFileViaWebRTC(sessionID, filePath string, metadataOnly bool) error {
+	c.Logger.Debug("File to send: %s", filePath)
+	return c.sendViaWebRTC(sessionID, shared.FileTransferProtocol, func(dataChannel *webrtc.DataChannel, cancelled <-chan struct{}) error {
+		return c.sendFileData(dataChannel, filePath, metadataOnly, cancelled)
+	})
+}
 
-		if info.ModTime().After(latestTime) {
-			latestTime = info.ModTime()
-			latestFile = file
-		}
+// iceServers returns the STUN and TURN servers for a transfer: those the API
+// server sent in the handshake, or else fresh ones fetched from it, falling
+// back to the default STUN server
+func (c *Client) iceServers() []webrtc.ICEServer {
+	// The servers from the handshake do while their TURN credentials are fresh
+	if ice := c.negotiated.ICE; ice != nil && len(ice.ICEServers) > 0 &&
+		(ice.TTL == 0 || time.Since(c.negotiatedAt) < time.Duration(ice.TTL)*time.Second/2) {
+		c.Logger.Debug("Using %d ICE servers from the handshake", len(ice.ICEServers))
+		return ice.WebRTCServers()
 	}
 
-	if latestFile == "" {
-		return "", fmt.Errorf("no valid files found")
+	config, err := shared.FetchICEServers(c.newHTTPClient(10*time.Second), c.APIServerURL, c.authToken)
+	if err != nil {
+		c.Logger.Warn("Using default STUN server %s: %v", shared.DefaultSTUNServer, err)
+		return shared.DefaultICEServers()
 	}
-
-	return latestFile, nil
+	servers := config.WebRTCServers()
+	c.Logger.Debug("Using %d ICE servers from the API server", len(servers))
+	return servers
 }
 
-// sendFileViaWebRTC sends a file using WebRTC data channels
-func (c *Client) sendFileViaWebRTC(sessionID, filePath string) error {
-	c.Logger.Debug("=== Starting WebRTC file transfer for session %s ===", sessionID)
-	c.Logger.Debug("File to send: %s", filePath)
-	
-	// Create WebRTC configuration
+// sendViaWebRTC offers a data channel speaking protocol to the session's
+// receiver and runs send once it opens. The channel passed to send is closed
+// if the server cancels the session; waiting for the receiver stops then too.
+func (c *Client) sendViaWebRTC(sessionID, protocol string, send func(*webrtc.DataChannel, <-chan struct{}) error) error {
+	c.Logger.Debug("=== Starting WebRTC transfer for session %s ===", sessionID)
+
+	// Create WebRTC configuration with fresh ICE servers; TURN credentials expire
 	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: []string{"stun:stun.l.google.com:19302"},
-			},
-		},
+		ICEServers: c.iceServers(),
 	}
 
-	c.Logger.Debug("Creating peer connection with STUN server: stun:stun.l.google.com:19302")
-
-	// Create peer connection
-	peerConnection, err := webrtc.NewPeerConnection(config)
+	// Create peer connection with the configured ICE timeouts
+	peerConnection, err := shared.NewWebRTCAPI(c.ICETimeouts).NewPeerConnection(config)
 	if err != nil {
 		c.Logger.Error("Failed to create peer connection for session %s: %v", sessionID, err)
 		return fmt.Errorf("failed to create peer connection: %w", err)
@@ -778,10 +1558,16 @@ func (c *Client) sendFileViaWebRTC(sessionID, filePath string) error {
 
 	c.Logger.Debug("Peer connection created successfully for session %s", sessionID)
 
+	// Fail fast when ICE fails or gathers nothing instead of waiting out the signaling timeouts
+	transferFailed := make(chan error, 2)
+	var candidateCount int32
+
 	// Store peer connection
+	cancelled := make(chan struct{})
 	c.Logger.Debug("sendFileViaWebRTC: acquiring lock for peerConnections")
 	c.mu.Lock()
 	c.peerConnections[sessionID] = peerConnection
+	c.sessionCancels[sessionID] = cancelled
 	c.mu.Unlock()
 	c.Logger.Debug("sendFileViaWebRTC: released lock for peerConnections")
 
@@ -791,9 +1577,10 @@ func (c *Client) sendFileViaWebRTC(sessionID, filePath string) error {
 		c.Logger.Debug("sendFileViaWebRTC: acquiring lock for peerConnections (defer)")
 		c.mu.Lock()
 		delete(c.peerConnections, sessionID)
+		delete(c.sessionCancels, sessionID)
 		c.mu.Unlock()
 		c.Logger.Debug("sendFileViaWebRTC: released lock for peerConnections (defer)")
-		c.Logger.Debug("=== Finished WebRTC file transfer cleanup for session %s ===", sessionID)
+		c.Logger.Debug("=== Finished WebRTC transfer cleanup for session %s ===", sessionID)
 	}()
 
 	// Add ICE connection state monitoring
@@ -806,6 +1593,10 @@ func (c *Client) sendFileViaWebRTC(sessionID, filePath string) error {
 			c.Logger.Warn("ICE connection disconnected for session %s", sessionID)
 		case webrtc.ICEConnectionStateFailed:
 			c.Logger.Error("ICE connection failed for session %s", sessionID)
+			select {
+			case transferFailed <- fmt.Errorf("ICE connection failed"):
+			default:
+			}
 		case webrtc.ICEConnectionStateClosed:
 			c.Logger.Debug("ICE connection closed for session %s", sessionID)
 		}
@@ -816,15 +1607,24 @@ func (c *Client) sendFileViaWebRTC(sessionID, filePath string) error {
 		c.Logger.Info("Peer connection state changed for session %s: %s", sessionID, connectionState.String())
 	})
 
-	// Create data channel for file transfer
-	c.Logger.Debug("Creating data channel for session %s", sessionID)
-	dataChannel, err := peerConnection.CreateDataChannel("file-transfer", nil)
+	// Create data channel for file transfer, advertising the transfer protocol version.
+	// Files need reliable, ordered delivery; only streams may opt out of reliability.
+	label := c.DataChannelLabel
+	if label == "" {
+		label = shared.DefaultDataChannelLabel
+	}
+	channelInit := shared.FileTransferChannelInit(protocol)
+	if protocol == shared.StreamProtocol {
+		channelInit = shared.StreamChannelInit(c.StreamMaxPacketLifeTime)
+	}
+	c.Logger.Debug("Creating data channel '%s' (protocol %s) for session %s", label, protocol, sessionID)
+	dataChannel, err := peerConnection.CreateDataChannel(label, channelInit)
 	if err != nil {
 		c.Logger.Error("Failed to create data channel for session %s: %v", sessionID, err)
 		return fmt.Errorf("failed to create data channel: %w", err)
 	}
 
-	c.Logger.Debug("Data channel created successfully for session %s", sessionID)
+	c.Logger.Debug("Data channel created successfully for session %s (%s)", sessionID, shared.DescribeReliability(dataChannel))
 
 	// Set up data channel ready channel IMMEDIATELY after creation
 	dataChannelReady := make(chan struct{})
@@ -850,6 +1650,7 @@ func (c *Client) sendFileViaWebRTC(sessionID, filePath string) error {
 		}
 
 		c.Logger.Debug("Generated ICE candidate for session %s: %s", sessionID, candidate.String())
+		atomic.AddInt32(&candidateCount, 1)
 
 		// Send ICE candidate to signaling server
 		if err := c.sendICECandidate(sessionID, candidate); err != nil {
@@ -870,6 +1671,7 @@ func (c *Client) sendFileViaWebRTC(sessionID, filePath string) error {
 	c.Logger.Debug("Offer created for session %s, SDP length: %d", sessionID, len(offer.SDP))
 
 	// Set local description
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
 	c.Logger.Debug("Setting local description (offer) for session %s", sessionID)
 	if err := peerConnection.SetLocalDescription(offer); err != nil {
 		c.Logger.Error("Failed to set local description for session %s: %v", sessionID, err)
@@ -878,6 +1680,19 @@ func (c *Client) sendFileViaWebRTC(sessionID, filePath string) error {
 
 	c.Logger.Debug("Local description set successfully for session %s", sessionID)
 
+	// Bound ICE gathering time
+	go func() {
+		if err := shared.AwaitICEGathering(gatherComplete, c.ICETimeouts, func() int {
+			return int(atomic.LoadInt32(&candidateCount))
+		}); err != nil {
+			c.Logger.Error("ICE gathering failed for session %s: %v", sessionID, err)
+			select {
+			case transferFailed <- err:
+			default:
+			}
+		}
+	}()
+
 	// Send offer to signaling server
 	c.Logger.Debug("Sending offer to signaling server for session %s", sessionID)
 	if err := c.sendOffer(sessionID, offer); err != nil {
@@ -901,6 +1716,16 @@ func (c *Client) sendFileViaWebRTC(sessionID, filePath string) error {
 	select {
 	case answer = <-answerChannel:
 		c.Logger.Debug("Received answer from receiver for session %s, SDP length: %d", sessionID, len(answer.SDP))
+	case err := <-transferFailed:
+		c.mu.Lock()
+		delete(c.waitingForAnswer, sessionID)
+		c.mu.Unlock()
+		return fmt.Errorf("WebRTC connection failed: %w", err)
+	case <-cancelled:
+		c.mu.Lock()
+		delete(c.waitingForAnswer, sessionID)
+		c.mu.Unlock()
+		return errTransferCancelled
 	case <-time.After(30 * time.Second):
 		c.Logger.Error("Timeout waiting for answer from receiver for session %s", sessionID)
 		c.Logger.Debug("sendFileViaWebRTC: acquiring lock for waitingForAnswer (timeout)")
@@ -932,6 +1757,11 @@ func (c *Client) sendFileViaWebRTC(sessionID, filePath string) error {
 	select {
 	case <-dataChannelReady:
 		c.Logger.Info("Data channel ready, starting file transfer for session %s", sessionID)
+	case err := <-transferFailed:
+		c.Logger.Error("WebRTC connection failed before data channel opened for session %s: %v", sessionID, err)
+		return fmt.Errorf("WebRTC connection failed: %w", err)
+	case <-cancelled:
+		return errTransferCancelled
 	case <-time.After(30 * time.Second):
 		c.Logger.Error("Timeout waiting for data channel to open for session %s", sessionID)
 		return fmt.Errorf("timeout waiting for data channel")
@@ -939,7 +1769,7 @@ func (c *Client) sendFileViaWebRTC(sessionID, filePath string) error {
 
 	// Send file
 	c.Logger.Debug("Starting file data transfer for session %s", sessionID)
-	err = c.sendFileData(dataChannel, filePath)
+	err = send(dataChannel, cancelled)
 	if err != nil {
 		c.Logger.Error("File data transfer failed for session %s: %v", sessionID, err)
 	} else {
@@ -1010,7 +1840,7 @@ func (c *Client) sendSignal(signal models.ICESignalRequest) error {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.authToken)
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := c.newHTTPClient(10 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		c.Logger.Error("Failed to send HTTP request for %s signal (session %s): %v", signal.Type, signal.SessionID, err)
@@ -1033,8 +1863,10 @@ func (c *Client) sendSignal(signal models.ICESignalRequest) error {
 
 // All signaling now handled via WebSocket - no HTTP polling needed
 
-// sendFileData sends file data through the WebRTC data channel
-func (c *Client) sendFileData(dataChannel *webrtc.DataChannel, filePath string) error {
+// sendFileData sends file data through the WebRTC data channel, stopping
+// with errTransferCancelled once cancelled is closed. With metadataOnly the
+// receiver gets a preview first and the file only if it asks for it.
+func (c *Client) sendFileData(dataChannel *webrtc.DataChannel, filePath string, metadataOnly bool, cancelled <-chan struct{}) error {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
@@ -1047,12 +1879,29 @@ func (c *Client) sendFileData(dataChannel *webrtc.DataChannel, filePath string)
 		return fmt.Errorf("failed to get file info: %w", err)
 	}
 
-	// Send file metadata
+	// Send file metadata, with the capture's provenance for the receiver to save alongside it
 	metadata := map[string]interface{}{
 		"filename": filepath.Base(filePath),
 		"size":     fileInfo.Size(),
 		"type":     "file-metadata",
 	}
+	capture, err := readCaptureMetadata(filePath)
+	if err == nil {
+		metadata["capture"] = capture
+	} else if !os.IsNotExist(err) {
+		c.Logger.Warn("Failed to read capture metadata for %s: %v", filePath, err)
+	}
+
+	if metadataOnly {
+		fetch, err := c.sendPreview(dataChannel, filePath, fileInfo.Size(), capture, cancelled)
+		if err != nil {
+			return err
+		}
+		if !fetch {
+			c.Logger.Info("Receiver skipped %s after its preview", filepath.Base(filePath))
+			return nil
+		}
+	}
 
 	metadataJSON, err := json.Marshal(metadata)
 	if err != nil {
@@ -1065,18 +1914,44 @@ func (c *Client) sendFileData(dataChannel *webrtc.DataChannel, filePath string)
 
 	c.Logger.Info("Sending file via ICE: %s (%d bytes)", filepath.Base(filePath), fileInfo.Size())
 
-	// Send file in chunks
+	totalSent, err := c.sendChunks(dataChannel, file, fileInfo.Size(), cancelled)
+	if err != nil {
+		return err
+	}
+
+	// Wait for final buffer to drain completely
+	for dataChannel.BufferedAmount() > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Give receiver time to process final chunk
+	time.Sleep(100 * time.Millisecond)
+
+	c.Logger.Info("ICE file transfer completed: %d bytes sent", totalSent)
+	return nil
+}
+
+// sendChunks sends a file's contents as binary data channel messages, waiting
+// for the channel's buffer to drain between chunks
+func (c *Client) sendChunks(dataChannel *webrtc.DataChannel, file *os.File, size int64, cancelled <-chan struct{}) (int64, error) {
 	buffer := make([]byte, 16384) // 16KB chunks
 	totalSent := int64(0)
 
 	chunkNum := 0
 	for {
+		select {
+		case <-cancelled:
+			c.Logger.Info("ICE transfer cancelled after %d/%d bytes", totalSent, size)
+			return totalSent, errTransferCancelled
+		default:
+		}
+
 		n, err := file.Read(buffer)
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return fmt.Errorf("failed to read file: %w", err)
+			return totalSent, fmt.Errorf("failed to read file: %w", err)
 		}
 
 		chunkNum++
@@ -1084,11 +1959,11 @@ func (c *Client) sendFileData(dataChannel *webrtc.DataChannel, filePath string)
 
 		if err := dataChannel.Send(buffer[:n]); err != nil {
 			c.Logger.Error("Failed to send chunk %d: %v", chunkNum, err)
-			return fmt.Errorf("failed to send chunk: %w", err)
+			return totalSent, fmt.Errorf("failed to send chunk: %w", err)
 		}
 
 		totalSent += int64(n)
-		c.Logger.Debug("Sent chunk %d successfully, total: %d/%d bytes", chunkNum, totalSent, fileInfo.Size())
+		c.Logger.Debug("Sent chunk %d successfully, total: %d/%d bytes", chunkNum, totalSent, size)
 
 		// Add flow control - wait for buffer to drain
 		for dataChannel.BufferedAmount() > 65536 { // Wait if buffer > 64KB
@@ -1096,20 +1971,10 @@ func (c *Client) sendFileData(dataChannel *webrtc.DataChannel, filePath string)
 		}
 
 		if totalSent%1048576 == 0 { // Log every MB
-			progress := float64(totalSent) / float64(fileInfo.Size()) * 100
+			progress := float64(totalSent) / float64(size) * 100
 			c.Logger.Info("ICE transfer progress: %.2f%% (%d/%d bytes)",
-				progress, totalSent, fileInfo.Size())
+				progress, totalSent, size)
 		}
 	}
-
-	// Wait for final buffer to drain completely
-	for dataChannel.BufferedAmount() > 0 {
-		time.Sleep(10 * time.Millisecond)
-	}
-
-	// Give receiver time to process final chunk
-	time.Sleep(100 * time.Millisecond)
-
-	c.Logger.Info("ICE file transfer completed: %d bytes sent", totalSent)
-	return nil
+	return totalSent, nil
 }
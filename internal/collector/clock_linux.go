@@ -0,0 +1,29 @@
+//go:build linux
+
+package collector
+
+import (
+	"syscall"
+
+	"argus-sdr/internal/models"
+)
+
+// Kernel clock flags from <sys/timex.h>
+const (
+	timexStatusUnsync = 0x0040 // STA_UNSYNC
+	timexStateError   = 5      // TIME_ERROR
+)
+
+// clockStatus reads the kernel's clock discipline state without changing it
+func clockStatus() models.ClockStatus {
+	var timex syscall.Timex
+	state, err := syscall.Adjtimex(&timex)
+	if err != nil {
+		return models.ClockStatus{Error: err.Error()}
+	}
+	return models.ClockStatus{
+		Synchronized:   state != timexStateError && timex.Status&timexStatusUnsync == 0,
+		MaxErrorMicros: int64(timex.Maxerror),
+		EstErrorMicros: int64(timex.Esterror),
+	}
+}
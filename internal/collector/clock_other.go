@@ -0,0 +1,14 @@
+//go:build !linux
+
+package collector
+
+import (
+	"runtime"
+
+	"argus-sdr/internal/models"
+)
+
+// clockStatus is only implemented on Linux
+func clockStatus() models.ClockStatus {
+	return models.ClockStatus{Error: "clock status is not supported on " + runtime.GOOS}
+}
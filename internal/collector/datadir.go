@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// requestDataDir returns the directory a request's collection writes into.
+// It is mounted into the container in place of the whole data directory.
+func (c *Client) requestDataDir(requestID string) string {
+	name := safeName(requestID)
+	if strings.Trim(name, ".") == "" {
+		// Never resolve to the data directory itself or its parent
+		name = "_" + name
+	}
+	return filepath.Join(c.DataDir, name)
+}
+
+// removeRequestData deletes a request's directory and everything in it
+func (c *Client) removeRequestData(requestID string) {
+	dir := c.requestDataDir(requestID)
+	if err := os.RemoveAll(dir); err != nil {
+		c.Logger.Warn("Failed to remove data for request %s: %v", requestID, err)
+		return
+	}
+	c.Logger.Debug("Removed data directory %s", dir)
+}
+
+// scheduleCleanup removes a request's directory once DataRetention has passed
+// since its last transfer. Each transfer restarts the clock, so the file stays
+// available while other subscribers are still fetching it.
+func (c *Client) scheduleCleanup(requestID string) {
+	if c.DataRetention <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if timer, exists := c.cleanupTimers[requestID]; exists {
+		timer.Stop()
+	}
+	c.cleanupTimers[requestID] = time.AfterFunc(c.DataRetention, func() {
+		c.mu.Lock()
+		delete(c.cleanupTimers, requestID)
+		c.mu.Unlock()
+
+		c.Logger.Info("Retention period passed for request %s, removing its data", requestID)
+		c.removeRequestData(requestID)
+	})
+}
+
+// pruneDataDir removes request directories left over from earlier runs that
+// are older than DataRetention
+func (c *Client) pruneDataDir() {
+	if c.DataRetention <= 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(c.DataDir)
+	if err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-c.DataRetention)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		dir := filepath.Join(c.DataDir, entry.Name())
+		if err := os.RemoveAll(dir); err != nil {
+			c.Logger.Warn("Failed to remove expired data directory %s: %v", dir, err)
+			continue
+		}
+		c.Logger.Info("Removed expired data directory %s", dir)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package collector
+
+import "errors"
+
+// diskUsage is not implemented on Windows
+func diskUsage(path string) (uint64, uint64, error) {
+	return 0, 0, errors.New("disk usage is not supported on windows")
+}
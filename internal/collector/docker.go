@@ -0,0 +1,197 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// errCollectionTimeout marks a collection that was killed for running too long
+var errCollectionTimeout = errors.New("collection timed out")
+
+// redactedValue replaces sensitive values in logged commands and output
+const redactedValue = "[REDACTED]"
+
+// sensitiveKeyMarkers are substrings that mark an argument or env var name as sensitive
+var sensitiveKeyMarkers = []string{"token", "secret", "password", "passwd", "apikey", "api_key", "api-key", "auth", "credential", "private"}
+
+// isSensitiveKey reports whether a flag or variable name looks like it carries a secret
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(strings.TrimLeft(key, "-"))
+	for _, marker := range sensitiveKeyMarkers {
+		if strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactDockerArgs returns a copy of the Docker arguments with sensitive values
+// replaced, along with the secret values so they can be scrubbed from output
+func redactDockerArgs(args []string) ([]string, []string) {
+	redacted := make([]string, len(args))
+	var secrets []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		redacted[i] = arg
+
+		// Environment variables: -e KEY=VALUE / --env KEY=VALUE / --env=KEY=VALUE
+		if arg == "-e" || arg == "--env" {
+			if i+1 < len(args) {
+				i++
+				redacted[i], secrets = redactAssignment(args[i], secrets)
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--env=") {
+			value, updated := redactAssignment(strings.TrimPrefix(arg, "--env="), secrets)
+			redacted[i], secrets = "--env="+value, updated
+			continue
+		}
+
+		// Flags with an inline value: --api-token=VALUE
+		if strings.HasPrefix(arg, "-") && strings.Contains(arg, "=") {
+			redacted[i], secrets = redactAssignment(arg, secrets)
+			continue
+		}
+
+		// Flags followed by a separate value: --api-token VALUE
+		if strings.HasPrefix(arg, "-") && isSensitiveKey(arg) && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+			if args[i] != "" {
+				secrets = append(secrets, args[i])
+			}
+			redacted[i] = redactedValue
+		}
+	}
+
+	return redacted, secrets
+}
+
+// redactAssignment redacts the value of a KEY=VALUE pair when the key is sensitive
+func redactAssignment(pair string, secrets []string) (string, []string) {
+	key, value, found := strings.Cut(pair, "=")
+	if !found || !isSensitiveKey(key) {
+		return pair, secrets
+	}
+	if value != "" {
+		secrets = append(secrets, value)
+	}
+	return key + "=" + redactedValue, secrets
+}
+
+// redactOutput scrubs any known secret values from container output
+func redactOutput(output string, secrets []string) string {
+	for _, secret := range secrets {
+		output = strings.ReplaceAll(output, secret, redactedValue)
+	}
+	return output
+}
+
+// tailOutput returns at most limit bytes from the end of the output,
+// trimmed so it starts on a valid UTF-8 boundary
+func tailOutput(output string, limit int) string {
+	output = strings.TrimSpace(output)
+	if limit <= 0 {
+		return ""
+	}
+	if len(output) <= limit {
+		return output
+	}
+
+	start := len(output) - limit
+	// Skip UTF-8 continuation bytes so we don't split a multi-byte character
+	for start < len(output) && output[start]&0xC0 == 0x80 {
+		start++
+	}
+	return "..." + output[start:]
+}
+
+// containerOutputTail builds the bounded, redacted container output that is
+// reported back with a failed collection. Stderr is preferred since that is
+// where the collection scripts report errors; stdout is used as a fallback.
+func containerOutputTail(stdout, stderr string, secrets []string, limit int) string {
+	output := stderr
+	if strings.TrimSpace(output) == "" {
+		output = stdout
+	}
+	return tailOutput(redactOutput(output, secrets), limit)
+}
+
+// resourceLimitArgs builds the docker run flags that cap the collection
+// container's memory, CPU and process count. Unset limits are left out.
+func resourceLimitArgs(memory, cpus string, pidsLimit int) []string {
+	var args []string
+	if memory != "" {
+		args = append(args, "--memory", memory)
+	}
+	if cpus != "" {
+		args = append(args, "--cpus", cpus)
+	}
+	if pidsLimit > 0 {
+		args = append(args, "--pids-limit", strconv.Itoa(pidsLimit))
+	}
+	return args
+}
+
+// defaultOutputMountPath is where the collection image expects to write its capture
+const defaultOutputMountPath = "/SDR-TDOA-DF/nice_data"
+
+// mountArgs builds the docker run flags that give the collection container its
+// filesystem. Only the request's own directory is writable, mounted at
+// OutputMountPath, so a container can't touch other captures; InputDir, if
+// set, is mounted read-only at InputMountPath. With ReadOnlyRoot the image's
+// own filesystem is read-only too, and TmpfsPaths are mounted for scratch.
+func (c *Client) mountArgs(requestDir string) ([]string, error) {
+	// Bind mount sources must be absolute
+	outputDir, err := filepath.Abs(requestDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve data directory: %w", err)
+	}
+	outputPath := c.OutputMountPath
+	if outputPath == "" {
+		outputPath = defaultOutputMountPath
+	}
+
+	var args []string
+	if c.InputDir != "" {
+		inputDir, err := filepath.Abs(c.InputDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve input directory: %w", err)
+		}
+		args = append(args, "--mount", fmt.Sprintf("type=bind,src=%s,dst=%s,readonly", inputDir, c.InputMountPath))
+	}
+	// The output mount goes last; it is the one the capture is written to
+	args = append(args, "--mount", fmt.Sprintf("type=bind,src=%s,dst=%s", outputDir, outputPath))
+
+	if c.ReadOnlyRoot {
+		args = append(args, "--read-only")
+		for _, path := range c.TmpfsPaths {
+			args = append(args, "--tmpfs", path)
+		}
+	}
+	return args, nil
+}
+
+// containerName returns the Docker container name used for a request, so a
+// timed out container can be found and killed
+func containerName(requestID string) string {
+	return "argus-" + safeName(requestID)
+}
+
+// safeName replaces characters that aren't allowed in Docker container names,
+// which also keeps request IDs from escaping the data directory as paths
+func safeName(value string) string {
+	name := []byte(value)
+	for i, ch := range name {
+		valid := ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' ||
+			ch == '_' || ch == '.' || ch == '-'
+		if !valid {
+			name[i] = '-'
+		}
+	}
+	return string(name)
+}
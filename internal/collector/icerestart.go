@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"argus-sdr/internal/shared"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// iceRestartAnswerTimeout bounds the wait for the receiver's answer to an ice-restart offer
+const iceRestartAnswerTimeout = 30 * time.Second
+
+// handleICERestart handles a receiver's request to restart ICE for a session
+// whose connection failed. The collector made the session's offer, so it
+// makes the ice-restart offer too; the data channel and the transfer on it
+// carry on once the new connection is up.
+func (c *Client) handleICERestart(wsMsg shared.WebSocketMessage) {
+	var restart shared.ICERestartNotification
+	if err := shared.DecodePayload(wsMsg.Payload, &restart); err != nil {
+		c.Logger.Error("Failed to unmarshal ICE restart: %v", err)
+		return
+	}
+
+	c.mu.RLock()
+	peerConnection, exists := c.peerConnections[restart.SessionID]
+	cancelled := c.sessionCancels[restart.SessionID]
+	c.mu.RUnlock()
+
+	if !exists {
+		c.Logger.Warn("Ignoring ICE restart for session %s: no transfer in progress", restart.SessionID)
+		return
+	}
+
+	c.Logger.Info("Receiver asked to restart ICE for session %s", restart.SessionID)
+	go func() {
+		if err := c.restartICE(peerConnection, restart.SessionID, cancelled); err != nil {
+			c.Logger.Error("ICE restart for session %s failed: %v", restart.SessionID, err)
+		}
+	}()
+}
+
+// restartICE sends an ice-restart offer for a session and applies the
+// receiver's answer
+func (c *Client) restartICE(peerConnection *webrtc.PeerConnection, sessionID string, cancelled <-chan struct{}) error {
+	offer, err := peerConnection.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	if err != nil {
+		return fmt.Errorf("failed to create offer: %w", err)
+	}
+
+	// Wait for the answer the same way as for the session's first offer
+	answerChannel := make(chan webrtc.SessionDescription, 1)
+	c.mu.Lock()
+	c.waitingForAnswer[sessionID] = answerChannel
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.waitingForAnswer, sessionID)
+		c.mu.Unlock()
+	}()
+
+	if err := peerConnection.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("failed to set local description: %w", err)
+	}
+	if err := c.sendOffer(sessionID, offer); err != nil {
+		return fmt.Errorf("failed to send offer: %w", err)
+	}
+
+	var answer webrtc.SessionDescription
+	select {
+	case answer = <-answerChannel:
+	case <-cancelled:
+		return errTransferCancelled
+	case <-time.After(iceRestartAnswerTimeout):
+		return fmt.Errorf("no answer within %v", iceRestartAnswerTimeout)
+	}
+
+	if err := peerConnection.SetRemoteDescription(answer); err != nil {
+		return fmt.Errorf("failed to set remote description: %w", err)
+	}
+
+	c.Logger.Info("ICE restart for session %s negotiated", sessionID)
+	return nil
+}
@@ -0,0 +1,156 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Image readiness states, as reported on GET /status
+const (
+	imagePulling = "pulling" // docker pull is running
+	imageReady   = "ready"   // the image is present and matches its pinned digest, if any
+	imageFailed  = "failed"  // the image could not be pulled or verified
+)
+
+// ImageStatus describes the readiness of the collection image on GET /status
+type ImageStatus struct {
+	Image     string     `json:"image"`
+	State     string     `json:"state"`
+	Digest    string     `json:"digest,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// prepareImage pulls the container image if PullImage is set and checks it
+// against ImageDigest if one is pinned, so a missing or wrong image stops the
+// collector at startup instead of failing its first request. It does nothing
+// when neither is configured.
+func (c *Client) prepareImage() error {
+	if !c.PullImage && c.ImageDigest == "" {
+		return nil
+	}
+	return c.checkImage(c.containerImage(), c.ImageDigest)
+}
+
+// refreshImage pulls an image a reload switched to. The pinned digest belongs
+// to the image the collector started with, so it isn't checked. The server is
+// told about the outcome right away, since it only routes requests to
+// collectors whose image is ready.
+func (c *Client) refreshImage(image string) {
+	if !c.PullImage {
+		c.mu.Lock()
+		c.image = nil
+		c.mu.Unlock()
+		return
+	}
+	if err := c.checkImage(image, ""); err != nil {
+		c.Logger.Error("Container image %s is not ready: %v", image, err)
+	}
+	c.sendHeartbeat()
+}
+
+// checkImage pulls image if PullImage is set and verifies it has digest, if
+// one is given, recording the outcome for heartbeats and GET /status
+func (c *Client) checkImage(image, digest string) error {
+	c.setImageStatus(&ImageStatus{Image: image, State: imagePulling})
+
+	ctx := context.Background()
+	if c.ImagePullTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.ImagePullTimeout)
+		defer cancel()
+	}
+
+	found, err := c.pullImage(ctx, image, digest)
+	now := time.Now().UTC()
+	status := &ImageStatus{Image: image, State: imageReady, Digest: found, CheckedAt: &now}
+	if err != nil {
+		status.State = imageFailed
+		status.Error = err.Error()
+	}
+	c.setImageStatus(status)
+	return err
+}
+
+// pullImage runs docker pull if PullImage is set and returns the image's
+// digest, which must be digest if one is given
+func (c *Client) pullImage(ctx context.Context, image, digest string) (string, error) {
+	if c.PullImage {
+		c.Logger.Info("Pulling container image %s", image)
+		started := time.Now()
+		output, err := exec.CommandContext(ctx, "docker", "pull", image).CombinedOutput()
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("docker pull timed out after %s", c.ImagePullTimeout)
+		}
+		if err != nil {
+			return "", fmt.Errorf("docker pull failed: %w, output: %s", err, strings.TrimSpace(string(output)))
+		}
+		c.Logger.Info("Pulled container image %s in %s", image, time.Since(started).Round(time.Second))
+	}
+
+	digests, err := imageDigests(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	if digest == "" {
+		if len(digests) == 0 {
+			// Locally built images have no registry digest
+			return "", nil
+		}
+		return digests[0], nil
+	}
+	for _, found := range digests {
+		if found == digest {
+			c.Logger.Info("Container image %s matches its pinned digest %s", image, digest)
+			return found, nil
+		}
+	}
+	if len(digests) == 0 {
+		return "", fmt.Errorf("image has no registry digest, expected %s", digest)
+	}
+	return "", fmt.Errorf("image digest %s does not match the pinned %s", strings.Join(digests, ", "), digest)
+}
+
+// imageDigests returns the registry digests of a local image
+func imageDigests(ctx context.Context, image string) ([]string, error) {
+	output, err := exec.CommandContext(ctx, "docker", "image", "inspect",
+		"--format", "{{range .RepoDigests}}{{println .}}{{end}}", image).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("image not available locally: %w, output: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	var digests []string
+	for _, line := range strings.Split(string(output), "\n") {
+		// Repository digests look like name@sha256:...
+		if _, digest, ok := strings.Cut(strings.TrimSpace(line), "@"); ok {
+			digests = append(digests, digest)
+		}
+	}
+	return digests, nil
+}
+
+// setImageStatus records the readiness of the collection image, unless a
+// reload has switched to another image in the meantime
+func (c *Client) setImageStatus(status *ImageStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if status.Image != c.ContainerImage {
+		return
+	}
+	c.image = status
+}
+
+// imageReady reports whether the collection image is ready, or nil if it
+// hasn't been checked
+func (c *Client) imageReady() *bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.image == nil || c.image.State == imagePulling {
+		return nil
+	}
+	ready := c.image.State == imageReady
+	return &ready
+}
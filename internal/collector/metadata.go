@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"argus-sdr/internal/convert"
+	"argus-sdr/internal/models"
+	"argus-sdr/internal/shared"
+	"argus-sdr/pkg/version"
+)
+
+// metadataFileName is the capture metadata sidecar written into each request's directory
+const metadataFileName = "capture-metadata.json"
+
+// newCaptureMetadata starts the metadata for a capture taken with image
+func (c *Client) newCaptureMetadata(request shared.DataRequest, image string) *models.CaptureMetadata {
+	metadata := &models.CaptureMetadata{
+		Version:          models.CaptureMetadataVersion,
+		RequestID:        request.ID,
+		StationID:        c.StationID,
+		CollectorVersion: version.String(),
+		SDRModel:         c.SDRModel,
+		Image:            image,
+		DurationSeconds:  request.DurationSeconds,
+	}
+	if request.Parameters != "" && json.Valid([]byte(request.Parameters)) {
+		metadata.Parameters = json.RawMessage(request.Parameters)
+	}
+	return metadata
+}
+
+// writeCaptureMetadata describes the final file of a request and saves the
+// metadata next to it, so it can be sent with every transfer of the file
+func (c *Client) writeCaptureMetadata(metadata *models.CaptureMetadata, format, filePath string) error {
+	if err := describeCaptureFile(metadata, format, filePath); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(filepath.Dir(filePath), metadataFileName), data, 0644)
+}
+
+// describeCaptureFile fills in the metadata about the file a capture produced
+func describeCaptureFile(metadata *models.CaptureMetadata, format, filePath string) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	checksum, err := fileSHA256(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	if format == "" {
+		format = convert.FormatNPZ
+	}
+	metadata.Format = format
+	metadata.FileName = filepath.Base(filePath)
+	metadata.FileSize = info.Size()
+	metadata.SHA256 = checksum
+	return nil
+}
+
+// readCaptureMetadata loads the metadata saved next to a request's file;
+// files collected by older versions have none
+func readCaptureMetadata(filePath string) (*models.CaptureMetadata, error) {
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(filePath), metadataFileName))
+	if err != nil {
+		return nil, err
+	}
+	var metadata models.CaptureMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
@@ -0,0 +1,176 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// paramKind describes how a request parameter value is validated
+type paramKind int
+
+const (
+	paramFloat paramKind = iota
+	paramInt
+	paramEnum
+)
+
+// paramSpec describes an allowed request parameter and how it maps onto the
+// collection script's command line
+type paramSpec struct {
+	Flag   string    // Command line flag passed to the collection script
+	Kind   paramKind // Value type
+	Min    float64   // Inclusive lower bound for numeric values
+	Max    float64   // Inclusive upper bound for numeric values
+	Values []string  // Allowed values for enums
+}
+
+// parameterSpecs is the allowlist of request parameters. Anything not listed
+// here is rejected, and values are re-rendered in canonical form so raw user
+// strings never reach the Docker command line.
+var parameterSpecs = map[string]paramSpec{
+	"center_freq": {Flag: "--center-freq", Kind: paramFloat, Min: 24e6, Max: 1.766e9},    // Hz
+	"sample_rate": {Flag: "--sample-rate", Kind: paramFloat, Min: 225e3, Max: 3.2e6},     // Hz
+	"gain":        {Flag: "--gain", Kind: paramFloat, Min: 0, Max: 50},                   // dB
+	"duration":    {Flag: "--duration", Kind: paramFloat, Min: 0.1, Max: 60},             // seconds
+	"num_samples": {Flag: "--num-samples", Kind: paramInt, Min: 1024, Max: 64 * 1 << 20}, // samples
+	"gain_mode":   {Flag: "--gain-mode", Kind: paramEnum, Values: []string{"auto", "manual"}},
+}
+
+// buildParameterArgs validates the request parameters (a JSON object) against the
+// allowlist and returns the corresponding command line arguments in a stable order.
+// If allowed is non-empty, only those parameter names are accepted.
+func buildParameterArgs(parameters string, allowed []string) ([]string, error) {
+	if parameters == "" {
+		return nil, nil
+	}
+
+	var values map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(parameters)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("parameters must be a JSON object: %w", err)
+	}
+	// More would miss a stray closing bracket, so make sure nothing follows
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("parameters must be a single JSON object")
+	}
+
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		allowedSet[name] = true
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		spec, known := parameterSpecs[name]
+		if !known {
+			return nil, fmt.Errorf("unknown parameter %q", name)
+		}
+		if len(allowedSet) > 0 && !allowedSet[name] {
+			return nil, fmt.Errorf("parameter %q is not allowed on this collector", name)
+		}
+
+		value, err := spec.render(values[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for parameter %q: %w", name, err)
+		}
+		args = append(args, spec.Flag, value)
+	}
+
+	return args, nil
+}
+
+// ValidateParameters checks request parameters and duration_seconds the way
+// collectors do before running a collection, without a collector's
+// ALLOWED_PARAMETERS restriction
+func ValidateParameters(parameters string, durationSeconds float64) error {
+	paramArgs, err := buildParameterArgs(parameters, nil)
+	if err != nil {
+		return err
+	}
+	_, err = durationArgs(durationSeconds, paramArgs)
+	return err
+}
+
+// durationArgs returns the command line arguments for a request's
+// duration_seconds, validated like the duration parameter. Both set the same
+// flag, so a request can't use them together.
+func durationArgs(seconds float64, paramArgs []string) ([]string, error) {
+	if seconds == 0 {
+		return nil, nil
+	}
+	spec := parameterSpecs["duration"]
+	for _, arg := range paramArgs {
+		if arg == spec.Flag {
+			return nil, fmt.Errorf("set duration_seconds or the duration parameter, not both")
+		}
+	}
+
+	value, err := spec.render(json.Number(strconv.FormatFloat(seconds, 'f', -1, 64)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration_seconds: %w", err)
+	}
+	return []string{spec.Flag, value}, nil
+}
+
+// render validates a parameter value and returns its canonical string form
+func (s paramSpec) render(value interface{}) (string, error) {
+	switch s.Kind {
+	case paramEnum:
+		str, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("expected one of %v", s.Values)
+		}
+		for _, allowed := range s.Values {
+			if str == allowed {
+				return allowed, nil
+			}
+		}
+		return "", fmt.Errorf("expected one of %v", s.Values)
+
+	case paramInt:
+		number, ok := value.(json.Number)
+		if !ok {
+			return "", fmt.Errorf("expected an integer")
+		}
+		n, err := strconv.ParseInt(number.String(), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("expected an integer")
+		}
+		if float64(n) < s.Min || float64(n) > s.Max {
+			return "", fmt.Errorf("must be between %.0f and %.0f", s.Min, s.Max)
+		}
+		return strconv.FormatInt(n, 10), nil
+
+	default:
+		number, ok := value.(json.Number)
+		if !ok {
+			return "", fmt.Errorf("expected a number")
+		}
+		f, err := strconv.ParseFloat(number.String(), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("expected a number")
+		}
+		if f < s.Min || f > s.Max {
+			return "", fmt.Errorf("must be between %g and %g", s.Min, s.Max)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+}
+
+// knownParameter reports whether a parameter name is in the allowlist
+func knownParameter(name string) bool {
+	_, known := parameterSpecs[name]
+	return known
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"argus-sdr/internal/convert"
+	"argus-sdr/internal/models"
+	"argus-sdr/internal/shared"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// previewDecisionTimeout is how long a metadata-first transfer waits for the
+// receiver to decide whether it wants the file
+const previewDecisionTimeout = 2 * time.Minute
+
+// sendPreview sends a file's preview and waits for the receiver's decision,
+// reporting whether it wants the file. An NPZ file's preview lists its
+// arrays; other formats only get the file's name, size and capture metadata.
+func (c *Client) sendPreview(dataChannel *webrtc.DataChannel, filePath string, size int64, capture *models.CaptureMetadata, cancelled <-chan struct{}) (bool, error) {
+	preview := shared.FilePreview{
+		Type:     shared.FileMessagePreview,
+		Filename: filepath.Base(filePath),
+		Size:     size,
+		Capture:  capture,
+	}
+	if strings.EqualFold(filepath.Ext(filePath), convert.Extension(convert.FormatNPZ)) {
+		arrays, err := convert.DescribeNPZ(filePath)
+		if err != nil {
+			c.Logger.Warn("Sending preview of %s without its arrays: %v", preview.Filename, err)
+		}
+		preview.Arrays = arrays
+	}
+
+	decisions := make(chan string, 1)
+	dataChannel.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if !msg.IsString {
+			return
+		}
+		var decision shared.FileDecision
+		if err := json.Unmarshal(msg.Data, &decision); err != nil {
+			c.Logger.Warn("Ignoring invalid message about %s: %v", preview.Filename, err)
+			return
+		}
+		select {
+		case decisions <- decision.Type:
+		default:
+		}
+	})
+
+	data, err := json.Marshal(preview)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal preview: %w", err)
+	}
+	if err := dataChannel.SendText(string(data)); err != nil {
+		return false, fmt.Errorf("failed to send preview: %w", err)
+	}
+	c.Logger.Info("Sent preview of %s (%d arrays), waiting for the receiver", preview.Filename, len(preview.Arrays))
+
+	// The channel's close handler is taken, so a receiver that hangs up is noticed by polling
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	timeout := time.After(previewDecisionTimeout)
+	for {
+		select {
+		case decision := <-decisions:
+			switch decision {
+			case shared.FileMessageFetch:
+				return true, nil
+			case shared.FileMessageSkip:
+				return false, nil
+			}
+			return false, fmt.Errorf("unknown answer %q to the preview", decision)
+		case <-ticker.C:
+			if dataChannel.ReadyState() != webrtc.DataChannelStateOpen {
+				return false, fmt.Errorf("data channel closed before the receiver answered the preview")
+			}
+		case <-cancelled:
+			return false, errTransferCancelled
+		case <-timeout:
+			return false, fmt.Errorf("receiver did not answer the preview within %v", previewDecisionTimeout)
+		}
+	}
+}
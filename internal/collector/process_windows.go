@@ -0,0 +1,9 @@
+//go:build windows
+
+package collector
+
+import "os/exec"
+
+// setProcessGroup is a no-op on Windows; the default cancel kills the Docker
+// CLI and the container itself is stopped with docker kill
+func setProcessGroup(cmd *exec.Cmd) {}
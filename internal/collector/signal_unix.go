@@ -0,0 +1,26 @@
+//go:build !windows
+
+package collector
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchDrainSignal starts a drain when the process receives SIGUSR1
+func (c *Client) watchDrainSignal() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-sigCh:
+			c.Logger.Info("Received SIGUSR1, draining collector")
+			c.Drain()
+		}
+	}
+}
@@ -0,0 +1,7 @@
+//go:build windows
+
+package collector
+
+// watchDrainSignal is a no-op on Windows, which has no SIGUSR1; use the
+// admin broadcast drain command instead
+func (c *Client) watchDrainSignal() {}
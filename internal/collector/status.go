@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"argus-sdr/pkg/version"
+)
+
+// Status is the collector's local view of itself, served on GET /status
+type Status struct {
+	StationID        string          `json:"station_id"`
+	Version          string          `json:"version"`
+	Status           string          `json:"status"`
+	Uptime           string          `json:"uptime"`
+	Connected        bool            `json:"connected"`
+	Authenticated    bool            `json:"authenticated"`
+	LastHeartbeatAck *time.Time      `json:"last_heartbeat_ack,omitempty"`
+	ContainerImage   string          `json:"container_image"`
+	Image            *ImageStatus    `json:"image,omitempty"`
+	ActiveRequests   []ActiveRequest `json:"active_requests"`
+	InFlight         int             `json:"in_flight"`
+	AwaitingTransfer []string        `json:"awaiting_transfer"`
+	PeerConnections  []PeerStatus    `json:"peer_connections"`
+	Disk             DiskStatus      `json:"disk"`
+	CircuitBreaker   *BreakerStatus  `json:"circuit_breaker,omitempty"`
+}
+
+// ActiveRequest describes a data request the collector is working on
+type ActiveRequest struct {
+	ID          string    `json:"id"`
+	RequestType string    `json:"request_type"`
+	Parameters  string    `json:"parameters,omitempty"`
+	RequestedBy string    `json:"requested_by,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// PeerStatus describes an open WebRTC peer connection
+type PeerStatus struct {
+	SessionID string `json:"session_id"`
+	State     string `json:"state"`
+}
+
+// DiskStatus reports free space in the data directory
+type DiskStatus struct {
+	DataDir    string `json:"data_dir"`
+	FreeBytes  uint64 `json:"free_bytes,omitempty"`
+	TotalBytes uint64 `json:"total_bytes,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// startStatusServer serves the local status endpoint until the client stops
+func (c *Client) startStatusServer() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", c.handleStatus)
+
+	server := &http.Server{
+		Addr:              c.StatusAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-c.stopCh
+		server.Close()
+	}()
+
+	c.Logger.Info("Status server listening on http://%s/status", c.StatusAddress)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		c.Logger.Error("Status server failed: %v", err)
+	}
+}
+
+// handleStatus handles GET /status
+func (c *Client) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(c.Status()); err != nil {
+		c.Logger.Error("Failed to write status response: %v", err)
+	}
+}
+
+// Status returns a snapshot of the collector's state
+func (c *Client) Status() Status {
+	c.mu.RLock()
+	status := Status{
+		StationID:        c.StationID,
+		Version:          version.String(),
+		Uptime:           time.Since(c.startedAt).Round(time.Second).String(),
+		Connected:        c.connected,
+		Authenticated:    c.authToken != "",
+		ContainerImage:   c.ContainerImage,
+		ActiveRequests:   make([]ActiveRequest, 0, len(c.activeRequests)),
+		InFlight:         c.inFlight,
+		AwaitingTransfer: make([]string, 0, len(c.awaitingTransfer)),
+		PeerConnections:  make([]PeerStatus, 0, len(c.peerConnections)),
+	}
+	if c.draining {
+		status.Status = "draining"
+	} else {
+		status.Status = "active"
+	}
+	if c.image != nil {
+		image := *c.image
+		status.Image = &image
+	}
+	status.CircuitBreaker = c.breakerStatus()
+	if !c.draining && status.CircuitBreaker != nil && status.CircuitBreaker.State == breakerOpen {
+		status.Status = "unhealthy"
+	}
+	if !c.lastHeartbeatAck.IsZero() {
+		ack := c.lastHeartbeatAck
+		status.LastHeartbeatAck = &ack
+	}
+	for _, request := range c.activeRequests {
+		status.ActiveRequests = append(status.ActiveRequests, ActiveRequest{
+			ID:          request.ID,
+			RequestType: request.RequestType,
+			Parameters:  request.Parameters,
+			RequestedBy: request.RequestedBy,
+			Image:       request.Image,
+			RequestedAt: time.Unix(request.Timestamp, 0),
+		})
+	}
+	for requestID := range c.awaitingTransfer {
+		status.AwaitingTransfer = append(status.AwaitingTransfer, requestID)
+	}
+	for sessionID, pc := range c.peerConnections {
+		status.PeerConnections = append(status.PeerConnections, PeerStatus{
+			SessionID: sessionID,
+			State:     pc.ConnectionState().String(),
+		})
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(status.ActiveRequests, func(i, j int) bool {
+		return status.ActiveRequests[i].RequestedAt.Before(status.ActiveRequests[j].RequestedAt)
+	})
+	sort.Strings(status.AwaitingTransfer)
+	sort.Slice(status.PeerConnections, func(i, j int) bool {
+		return status.PeerConnections[i].SessionID < status.PeerConnections[j].SessionID
+	})
+
+	status.Disk = DiskStatus{DataDir: c.DataDir}
+	free, total, err := diskUsage(c.DataDir)
+	if err != nil {
+		status.Disk.Error = err.Error()
+	} else {
+		status.Disk.FreeBytes = free
+		status.Disk.TotalBytes = total
+	}
+
+	return status
+}
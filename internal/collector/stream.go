@@ -0,0 +1,219 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"argus-sdr/internal/convert"
+	"argus-sdr/internal/shared"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// lostFrameTimeout is how long a stream with partial reliability waits for
+// acknowledgements with a full window before assuming the unacknowledged
+// frames, or their acknowledgements, were dropped
+const lostFrameTimeout = 10 * time.Second
+
+// claimStream takes a stream request that is waiting for its receiver. Each
+// stream is served to a single session.
+func (c *Client) claimStream(requestID string) (shared.DataRequest, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	request, ok := c.streams[requestID]
+	delete(c.streams, requestID)
+	return request, ok
+}
+
+// streamViaWebRTC streams captures for a request to the session's receiver
+func (c *Client) streamViaWebRTC(sessionID string, request shared.DataRequest) error {
+	return c.sendViaWebRTC(sessionID, shared.StreamProtocol, func(dataChannel *webrtc.DataChannel, cancelled <-chan struct{}) error {
+		return c.streamFrames(dataChannel, request, cancelled)
+	})
+}
+
+// streamFrames captures and sends frames back to back until the receiver
+// stops the stream, the collector drains or StreamMaxDuration passes. No more
+// than shared.StreamWindow frames are sent ahead of the receiver's
+// acknowledgements, so a slow receiver pauses capturing rather than piling
+// frames up in the data channel. On a partially reliable channel frames and
+// acknowledgements can be dropped, so after lostFrameTimeout without progress
+// the outstanding frames are given up on. A cancelled session stops without
+// a stream-end message, since the receiver is stopping too.
+func (c *Client) streamFrames(dataChannel *webrtc.DataChannel, request shared.DataRequest, cancelled <-chan struct{}) error {
+	var mu sync.Mutex
+	var acked int
+	var stopped bool
+	progress := make(chan struct{}, 1)
+
+	dataChannel.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if !msg.IsString {
+			return
+		}
+		var message shared.StreamMessage
+		if err := json.Unmarshal(msg.Data, &message); err != nil {
+			c.Logger.Warn("Ignoring invalid stream message for request %s: %v", request.ID, err)
+			return
+		}
+
+		mu.Lock()
+		switch message.Type {
+		case shared.StreamMessageAck:
+			if message.Sequence > acked {
+				acked = message.Sequence
+			}
+		case shared.StreamMessageStop:
+			c.Logger.Info("Receiver stopped stream %s", request.ID)
+			stopped = true
+		}
+		mu.Unlock()
+
+		select {
+		case progress <- struct{}{}:
+		default:
+		}
+	})
+
+	deadline := time.Now().Add(c.StreamMaxDuration)
+	endReason := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case stopped:
+			return shared.StreamEndStopped
+		case c.IsDraining():
+			return shared.StreamEndDraining
+		case !time.Now().Before(deadline):
+			return shared.StreamEndLimit
+		}
+		return ""
+	}
+	windowOpen := func(sent int) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return sent-acked < shared.StreamWindow
+	}
+	reliable := shared.IsReliableOrdered(dataChannel)
+	// giveUpOnFrames treats the frames sent so far as acknowledged
+	giveUpOnFrames := func(sent int) {
+		mu.Lock()
+		defer mu.Unlock()
+		c.Logger.Warn("No acknowledgement of frames %d-%d of stream %s for %s, assuming they were dropped", acked+1, sent, request.ID, lostFrameTimeout)
+		acked = sent
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	c.Logger.Info("Streaming captures for request %s (up to %s)", request.ID, c.StreamMaxDuration)
+	sent := 0
+	for {
+		// Wait until the receiver has consumed enough frames
+		reason := endReason()
+		waitingSince := time.Now()
+		for reason == "" && !windowOpen(sent) {
+			if dataChannel.ReadyState() != webrtc.DataChannelStateOpen {
+				return fmt.Errorf("data channel closed after %d frames", sent)
+			}
+			if !reliable && time.Since(waitingSince) >= lostFrameTimeout {
+				giveUpOnFrames(sent)
+				break
+			}
+			select {
+			case <-progress:
+				waitingSince = time.Now()
+			case <-ticker.C:
+			case <-cancelled:
+				return errTransferCancelled
+			}
+			reason = endReason()
+		}
+		if reason != "" {
+			return c.endStream(dataChannel, request.ID, sent, reason, nil)
+		}
+
+		if err := c.sendFrame(dataChannel, request, sent+1, cancelled); err != nil {
+			if errors.Is(err, errTransferCancelled) {
+				return err
+			}
+			if dataChannel.ReadyState() != webrtc.DataChannelStateOpen {
+				return fmt.Errorf("data channel closed after %d frames: %w", sent, err)
+			}
+			return c.endStream(dataChannel, request.ID, sent, shared.StreamEndError, err)
+		}
+		sent++
+	}
+}
+
+// sendFrame captures one frame of a stream and sends its header and data
+func (c *Client) sendFrame(dataChannel *webrtc.DataChannel, request shared.DataRequest, sequence int, cancelled <-chan struct{}) error {
+	filePath, metadata, err := c.collectData(request)
+	if err != nil {
+		return fmt.Errorf("capture failed: %w", err)
+	}
+	// Frames aren't kept once sent
+	defer c.removeRequestData(request.ID)
+
+	if request.Format != "" && request.Format != convert.FormatNPZ {
+		if filePath, err = convert.File(request.Format, filePath); err != nil {
+			return err
+		}
+	}
+	if err := describeCaptureFile(metadata, request.Format, filePath); err != nil {
+		return fmt.Errorf("failed to describe frame: %w", err)
+	}
+
+	header, err := json.Marshal(shared.StreamMessage{
+		Type:     shared.StreamMessageFrame,
+		Sequence: sequence,
+		Size:     metadata.FileSize,
+		Capture:  metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal frame header: %w", err)
+	}
+	if err := dataChannel.SendText(string(header)); err != nil {
+		return fmt.Errorf("failed to send frame header: %w", err)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open frame: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := c.sendChunks(dataChannel, file, metadata.FileSize, cancelled); err != nil {
+		return err
+	}
+	c.Logger.Info("Sent frame %d of stream %s (%d bytes)", sequence, request.ID, metadata.FileSize)
+	return nil
+}
+
+// endStream tells the receiver the stream is over and why. It returns cause,
+// so a stream that ended on an error is reported as failed.
+func (c *Client) endStream(dataChannel *webrtc.DataChannel, requestID string, frames int, reason string, cause error) error {
+	c.Logger.Info("Stream %s ended after %d frames (%s)", requestID, frames, reason)
+
+	message := shared.StreamMessage{Type: shared.StreamMessageEnd, Frames: frames, Reason: reason}
+	if cause != nil {
+		message.Error = cause.Error()
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stream end: %w", err)
+	}
+	if err := dataChannel.SendText(string(data)); err != nil {
+		return fmt.Errorf("failed to send stream end: %w", err)
+	}
+
+	// Let the end message reach the receiver before the connection closes
+	for dataChannel.BufferedAmount() > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	return cause
+}
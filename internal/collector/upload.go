@@ -0,0 +1,117 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"argus-sdr/internal/models"
+	"argus-sdr/internal/shared"
+)
+
+// uploadFile streams a captured file to the server cache so receivers can
+// download it over HTTP without a WebRTC session to this collector
+func (c *Client) uploadFile(requestID, filePath string) error {
+	checksum, err := fileSHA256(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	if limit := c.negotiated.MaxFileSize; limit > 0 && info.Size() > limit {
+		return fmt.Errorf("file is %d bytes, the server accepts at most %d", info.Size(), limit)
+	}
+
+	uploadURL := fmt.Sprintf("%s/api/collector/upload/%s?station_id=%s",
+		strings.TrimSuffix(c.APIServerURL, "/"), url.PathEscape(requestID), url.QueryEscape(c.StationID))
+	req, err := http.NewRequest("POST", uploadURL, file)
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer "+c.authToken)
+	req.Header.Set("X-Content-SHA256", checksum)
+	if capture, err := readCaptureMetadata(filePath); err == nil {
+		if value, err := capture.HeaderValue(); err == nil {
+			req.Header.Set(models.CaptureMetadataHeader, value)
+		}
+	} else if !os.IsNotExist(err) {
+		c.Logger.Warn("Failed to read capture metadata for %s: %v", filePath, err)
+	}
+
+	c.Logger.Info("Uploading %s (%d bytes) to the server cache for request %s", filePath, info.Size(), requestID)
+	httpClient := c.newHTTPClient(10 * time.Minute)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	c.Logger.Info("Uploaded file for request %s (sha256 %s)", requestID, checksum)
+	return nil
+}
+
+// handleUploadRequest uploads a finished file the server wants to fan out to
+// several receivers. Failures are reported so receivers fall back to WebRTC.
+func (c *Client) handleUploadRequest(upload shared.UploadRequest) {
+	c.Logger.Info("Server requested upload of request %s", upload.RequestID)
+
+	filePath, err := c.findFileForRequest(upload.RequestID)
+	if err == nil {
+		err = c.uploadFile(upload.RequestID, filePath)
+	}
+	if err != nil {
+		c.Logger.Error("Upload for request %s failed: %v", upload.RequestID, err)
+		message := shared.WebSocketMessage{
+			Type: "upload_failed",
+			Payload: shared.UploadFailed{
+				RequestID: upload.RequestID,
+				StationID: c.StationID,
+				Error:     err.Error(),
+			},
+		}
+		if err := c.sendWebSocketMessage(message); err != nil {
+			c.Logger.Error("Failed to report upload failure: %v", err)
+		}
+		return
+	}
+
+	// Receivers download from the server now, so the request is finished here
+	c.transferDone(upload.RequestID)
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 of a file
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
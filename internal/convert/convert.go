@@ -0,0 +1,94 @@
+// Package convert turns NPZ captures into the file formats receivers request
+package convert
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FormatNPZ is the collection container's native output; it is never converted
+const FormatNPZ = "npz"
+
+// npzContentType is served for NPZ captures, which have no registered media type
+const npzContentType = "application/octet-stream"
+
+// Converter converts an NPZ capture into another file format
+type Converter interface {
+	// Format is the name receivers use to request this conversion
+	Format() string
+	// Extension is the file extension of converted files, including the dot
+	Extension() string
+	// ContentType is the media type converted files are served with
+	ContentType() string
+	// Convert reads the capture at src and writes the converted file to dst
+	Convert(src, dst string) error
+}
+
+var converters = map[string]Converter{}
+
+// register makes a converter available; called from init in each format's file
+func register(c Converter) {
+	converters[c.Format()] = c
+}
+
+// Lookup returns the converter for format. It returns nil for NPZ (and an
+// empty format), which need no conversion, and an error for unknown formats.
+func Lookup(format string) (Converter, error) {
+	if format == "" || format == FormatNPZ {
+		return nil, nil
+	}
+	c, exists := converters[format]
+	if !exists {
+		return nil, fmt.Errorf("unsupported format %q: must be one of %s", format, strings.Join(Supported(), ", "))
+	}
+	return c, nil
+}
+
+// Supported lists the formats that can be requested
+func Supported() []string {
+	formats := []string{FormatNPZ}
+	for format := range converters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats[1:])
+	return formats
+}
+
+// Extension returns the file extension for a format, including the dot
+func Extension(format string) string {
+	if c, err := Lookup(format); err == nil && c != nil {
+		return c.Extension()
+	}
+	return ".npz"
+}
+
+// ContentType returns the media type files of a format are served with
+func ContentType(format string) string {
+	if c, err := Lookup(format); err == nil && c != nil {
+		return c.ContentType()
+	}
+	return npzContentType
+}
+
+// File converts the capture at src to format next to it and returns the
+// converted file's path. The original is removed once conversion succeeds.
+// For NPZ, src is returned unchanged.
+func File(format, src string) (string, error) {
+	c, err := Lookup(format)
+	if err != nil || c == nil {
+		return src, err
+	}
+
+	dst := strings.TrimSuffix(src, filepath.Ext(src)) + c.Extension()
+	if err := c.Convert(src, dst); err != nil {
+		os.Remove(dst)
+		return "", fmt.Errorf("failed to convert %s to %s: %w", filepath.Base(src), format, err)
+	}
+	if err := os.Remove(src); err != nil {
+		return "", fmt.Errorf("failed to remove original capture: %w", err)
+	}
+	return dst, nil
+}
@@ -0,0 +1,64 @@
+package convert
+
+import (
+	"bufio"
+	"encoding/csv"
+	"os"
+	"strconv"
+)
+
+func init() {
+	register(csvConverter{})
+}
+
+// csvConverter writes the capture's samples as CSV, one row per sample:
+// index,i,q for complex samples and index,value for real ones
+type csvConverter struct{}
+
+func (csvConverter) Format() string      { return "csv" }
+func (csvConverter) Extension() string   { return ".csv" }
+func (csvConverter) ContentType() string { return "text/csv; charset=utf-8" }
+
+func (csvConverter) Convert(src, dst string) error {
+	arrays, err := readNPZ(src)
+	if err != nil {
+		return err
+	}
+	samples := samplesArray(arrays)
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	buffered := bufio.NewWriter(out)
+	w := csv.NewWriter(buffered)
+
+	isComplex := samples.kind() == 'c'
+	if isComplex {
+		w.Write([]string{"index", "i", "q"})
+	} else {
+		w.Write([]string{"index", "value"})
+	}
+
+	for i := 0; i < samples.Len(); i++ {
+		value := samples.At(i)
+		row := []string{strconv.Itoa(i), strconv.FormatFloat(real(value), 'g', -1, 64)}
+		if isComplex {
+			row = append(row, strconv.FormatFloat(imag(value), 'g', -1, 64))
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
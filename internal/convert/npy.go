@@ -0,0 +1,308 @@
+package convert
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// array is one array from an NPZ file
+type array struct {
+	Name  string
+	Descr string // NumPy dtype string, e.g. "<c8"
+	Shape []int
+	Data  []byte // raw C-order element data
+}
+
+var (
+	descrPattern   = regexp.MustCompile(`'descr':\s*'([^']+)'`)
+	fortranPattern = regexp.MustCompile(`'fortran_order':\s*(True|False)`)
+	shapePattern   = regexp.MustCompile(`'shape':\s*\(([^)]*)\)`)
+)
+
+// readNPZ reads every array in an NPZ archive, in name order
+func readNPZ(path string) ([]*array, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("not an NPZ file: %w", err)
+	}
+	defer archive.Close()
+
+	var arrays []*array
+	for _, file := range archive.File {
+		if !strings.HasSuffix(file.Name, ".npy") {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		arr, err := readNPY(r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		arr.Name = strings.TrimSuffix(file.Name, ".npy")
+		arrays = append(arrays, arr)
+	}
+
+	if len(arrays) == 0 {
+		return nil, fmt.Errorf("no arrays found")
+	}
+	sort.Slice(arrays, func(i, j int) bool { return arrays[i].Name < arrays[j].Name })
+	return arrays, nil
+}
+
+// zipMagic starts every ZIP archive that holds at least one file
+var zipMagic = []byte("PK\x03\x04")
+
+// ValidateNPZ cheaply checks that path looks like a complete NPZ archive: it
+// isn't empty, starts with a ZIP header, has a readable central directory
+// (which comes last, so truncated files fail) and lists at least one .npy
+// array. The arrays themselves aren't read.
+func ValidateNPZ(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("file is empty")
+	}
+
+	magic := make([]byte, len(zipMagic))
+	if _, err := io.ReadFull(f, magic); err != nil || !bytes.Equal(magic, zipMagic) {
+		return fmt.Errorf("not an NPZ file: missing ZIP header")
+	}
+
+	archive, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		return fmt.Errorf("not an NPZ file: %w", err)
+	}
+	for _, file := range archive.File {
+		if strings.HasSuffix(file.Name, ".npy") {
+			return nil
+		}
+	}
+	return fmt.Errorf("no arrays found")
+}
+
+// readNPY parses a .npy stream (format versions 1.0 to 3.0)
+func readNPY(r io.Reader) (*array, error) {
+	arr, err := readNPYHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if size := arr.itemSize(); size == 0 || len(data) < arr.Len()*size {
+		return nil, fmt.Errorf("unsupported dtype %s or truncated data", arr.Descr)
+	}
+	arr.Data = data[:arr.Len()*arr.itemSize()]
+	return arr, nil
+}
+
+// readNPYHeader parses the header of a .npy stream, leaving r at the start
+// of the array's data
+func readNPYHeader(r io.Reader) (*array, error) {
+	var preamble [8]byte
+	if _, err := io.ReadFull(r, preamble[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(preamble[:6], []byte("\x93NUMPY")) {
+		return nil, fmt.Errorf("missing NPY magic")
+	}
+
+	var headerLen uint32
+	switch preamble[6] {
+	case 1:
+		var n uint16
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		headerLen = uint32(n)
+	case 2, 3:
+		if err := binary.Read(r, binary.LittleEndian, &headerLen); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported NPY version %d", preamble[6])
+	}
+
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	descr := descrPattern.FindSubmatch(header)
+	fortran := fortranPattern.FindSubmatch(header)
+	shape := shapePattern.FindSubmatch(header)
+	if descr == nil || fortran == nil || shape == nil {
+		return nil, fmt.Errorf("malformed NPY header")
+	}
+	if string(fortran[1]) == "True" {
+		return nil, fmt.Errorf("fortran-ordered arrays are not supported")
+	}
+
+	arr := &array{Descr: string(descr[1])}
+	for _, dim := range strings.Split(string(shape[1]), ",") {
+		dim = strings.TrimSpace(dim)
+		if dim == "" {
+			continue
+		}
+		n, err := strconv.Atoi(dim)
+		if err != nil {
+			return nil, fmt.Errorf("malformed NPY shape")
+		}
+		arr.Shape = append(arr.Shape, n)
+	}
+	return arr, nil
+}
+
+// Len returns the number of elements
+func (a *array) Len() int {
+	n := 1
+	for _, dim := range a.Shape {
+		n *= dim
+	}
+	return n
+}
+
+// kind returns the dtype kind: 'f' float, 'c' complex, 'i' signed or 'u' unsigned integer
+func (a *array) kind() byte {
+	if len(a.Descr) < 3 {
+		return 0
+	}
+	return a.Descr[1]
+}
+
+// littleEndian reports whether elements are stored little-endian
+// (single-byte types have no byte order)
+func (a *array) littleEndian() bool {
+	return len(a.Descr) > 0 && (a.Descr[0] == '<' || a.Descr[0] == '|')
+}
+
+// itemSize returns the size of one element in bytes, or 0 for unsupported dtypes
+func (a *array) itemSize() int {
+	if len(a.Descr) < 3 || !strings.ContainsRune("<>|=", rune(a.Descr[0])) {
+		return 0
+	}
+	size, err := strconv.Atoi(a.Descr[2:])
+	if err != nil {
+		return 0
+	}
+	switch a.kind() {
+	case 'f':
+		if size == 4 || size == 8 {
+			return size
+		}
+	case 'c':
+		if size == 8 || size == 16 {
+			return size
+		}
+	case 'i', 'u':
+		if size == 1 || size == 2 || size == 4 || size == 8 {
+			return size
+		}
+	}
+	return 0
+}
+
+// At returns element i as a complex number; real types have a zero imaginary part
+func (a *array) At(i int) complex128 {
+	size := a.itemSize()
+	b := a.Data[i*size : (i+1)*size]
+
+	var order binary.ByteOrder = binary.BigEndian
+	if a.littleEndian() {
+		order = binary.LittleEndian
+	}
+
+	switch a.kind() {
+	case 'c':
+		half := size / 2
+		return complex(floatAt(b[:half], order), floatAt(b[half:], order))
+	case 'f':
+		return complex(floatAt(b, order), 0)
+	case 'i':
+		return complex(float64(intAt(b, order)), 0)
+	default:
+		return complex(float64(uintAt(b, order)), 0)
+	}
+}
+
+func floatAt(b []byte, order binary.ByteOrder) float64 {
+	if len(b) == 4 {
+		return float64(math.Float32frombits(order.Uint32(b)))
+	}
+	return math.Float64frombits(order.Uint64(b))
+}
+
+func uintAt(b []byte, order binary.ByteOrder) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(order.Uint16(b))
+	case 4:
+		return uint64(order.Uint32(b))
+	default:
+		return order.Uint64(b)
+	}
+}
+
+func intAt(b []byte, order binary.ByteOrder) int64 {
+	switch len(b) {
+	case 1:
+		return int64(int8(b[0]))
+	case 2:
+		return int64(int16(order.Uint16(b)))
+	case 4:
+		return int64(int32(order.Uint32(b)))
+	default:
+		return int64(order.Uint64(b))
+	}
+}
+
+// samplesArray picks the array holding the capture's samples: one named
+// "samples" or "iq" if present, otherwise the largest array
+func samplesArray(arrays []*array) *array {
+	var largest *array
+	for _, arr := range arrays {
+		if arr.Name == "samples" || arr.Name == "iq" {
+			return arr
+		}
+		if largest == nil || arr.Len() > largest.Len() {
+			largest = arr
+		}
+	}
+	return largest
+}
+
+// scalars returns the single-element numeric arrays, which the collection
+// container uses for capture metadata such as center_freq and sample_rate
+func scalars(arrays []*array) map[string]float64 {
+	values := make(map[string]float64)
+	for _, arr := range arrays {
+		if arr.Len() == 1 && arr.kind() != 'c' {
+			values[arr.Name] = real(arr.At(0))
+		}
+	}
+	return values
+}
@@ -0,0 +1,84 @@
+package convert
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ArrayInfo describes an array of an NPZ capture without its data, for
+// receivers deciding whether to fetch the capture
+type ArrayInfo struct {
+	Name           string `json:"name"`
+	Dtype          string `json:"dtype"` // NumPy dtype string, e.g. "<c8"
+	Shape          []int  `json:"shape"`
+	Size           int64  `json:"size"`            // uncompressed bytes in the archive
+	CompressedSize int64  `json:"compressed_size"` // bytes in the archive
+	// Value is the element of a single-element real array, such as the
+	// center_freq and sample_rate the collection container stores
+	Value *float64 `json:"value,omitempty"`
+}
+
+// DescribeNPZ lists the arrays of an NPZ archive, in archive order, from its
+// central directory and each array's NPY header. Only single-element arrays
+// are read in full.
+func DescribeNPZ(path string) ([]ArrayInfo, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("not an NPZ file: %w", err)
+	}
+	defer archive.Close()
+
+	arrays := []ArrayInfo{}
+	for _, file := range archive.File {
+		if !strings.HasSuffix(file.Name, ".npy") {
+			continue
+		}
+		info, err := describeArray(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		arrays = append(arrays, info)
+	}
+
+	if len(arrays) == 0 {
+		return nil, fmt.Errorf("no arrays found")
+	}
+	return arrays, nil
+}
+
+// describeArray reads the header of one array of an NPZ archive, and its
+// value if it has a single real element
+func describeArray(file *zip.File) (ArrayInfo, error) {
+	r, err := file.Open()
+	if err != nil {
+		return ArrayInfo{}, err
+	}
+	defer r.Close()
+
+	arr, err := readNPYHeader(r)
+	if err != nil {
+		return ArrayInfo{}, err
+	}
+	info := ArrayInfo{
+		Name:           strings.TrimSuffix(file.Name, ".npy"),
+		Dtype:          arr.Descr,
+		Shape:          arr.Shape,
+		Size:           int64(file.UncompressedSize64),
+		CompressedSize: int64(file.CompressedSize64),
+	}
+	if info.Shape == nil {
+		info.Shape = []int{}
+	}
+
+	if size := arr.itemSize(); size > 0 && arr.Len() == 1 && arr.kind() != 'c' {
+		arr.Data = make([]byte, size)
+		if _, err := io.ReadFull(r, arr.Data); err != nil {
+			return ArrayInfo{}, err
+		}
+		value := real(arr.At(0))
+		info.Value = &value
+	}
+	return info, nil
+}
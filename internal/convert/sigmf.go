@@ -0,0 +1,165 @@
+package convert
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(sigmfConverter{})
+}
+
+// sigmfConverter writes a SigMF archive: a tar holding the recording's
+// .sigmf-meta JSON and its samples as .sigmf-data
+type sigmfConverter struct{}
+
+func (sigmfConverter) Format() string      { return "sigmf" }
+func (sigmfConverter) Extension() string   { return ".sigmf" }
+func (sigmfConverter) ContentType() string { return "application/x-tar" }
+
+// Capture metadata names the collection container may store as scalars
+var (
+	frequencyKeys  = []string{"center_freq", "center_frequency", "frequency"}
+	sampleRateKeys = []string{"sample_rate", "samp_rate", "fs"}
+	timestampKeys  = []string{"timestamp", "start_time"}
+)
+
+func (sigmfConverter) Convert(src, dst string) error {
+	arrays, err := readNPZ(src)
+	if err != nil {
+		return err
+	}
+	samples := samplesArray(arrays)
+	datatype, err := sigmfDatatype(samples)
+	if err != nil {
+		return err
+	}
+	meta := sigmfMeta(samples, datatype, scalars(arrays))
+
+	metaJSON, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// Files in a SigMF archive live in a directory named after the recording
+	name := strings.TrimSuffix(filepath.Base(dst), filepath.Ext(dst))
+	modTime := time.Now()
+	tw := tar.NewWriter(out)
+	for _, entry := range []struct {
+		name string
+		data []byte
+	}{
+		{name + "/" + name + ".sigmf-meta", metaJSON},
+		{name + "/" + name + ".sigmf-data", samples.Data},
+	} {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.data)), ModTime: modTime}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entry.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// sigmfDatatype maps a NumPy dtype to a SigMF core:datatype
+func sigmfDatatype(a *array) (string, error) {
+	size := a.itemSize()
+	var datatype string
+	switch a.kind() {
+	case 'c':
+		datatype = fmt.Sprintf("cf%d", size*4) // two components of size/2 bytes
+	case 'f':
+		datatype = fmt.Sprintf("rf%d", size*8)
+	case 'i':
+		datatype = fmt.Sprintf("ri%d", size*8)
+	case 'u':
+		datatype = fmt.Sprintf("ru%d", size*8)
+	default:
+		return "", fmt.Errorf("unsupported sample dtype %s", a.Descr)
+	}
+	if size == 1 {
+		return datatype, nil
+	}
+	if a.littleEndian() {
+		return datatype + "_le", nil
+	}
+	return datatype + "_be", nil
+}
+
+func sigmfMeta(samples *array, datatype string, metadata map[string]float64) map[string]interface{} {
+	global := map[string]interface{}{
+		"core:datatype":    datatype,
+		"core:version":     "1.0.0",
+		"core:recorder":    "argus-sdr",
+		"core:description": fmt.Sprintf("Converted from NPZ array %q", samples.Name),
+	}
+	capture := map[string]interface{}{
+		"core:sample_start": 0,
+	}
+
+	used := make(map[string]bool)
+	if rate, key, ok := lookup(metadata, sampleRateKeys); ok {
+		global["core:sample_rate"] = rate
+		used[key] = true
+	}
+	if freq, key, ok := lookup(metadata, frequencyKeys); ok {
+		capture["core:frequency"] = freq
+		used[key] = true
+	}
+	if ts, key, ok := lookup(metadata, timestampKeys); ok {
+		sec := int64(ts)
+		nsec := int64((ts - float64(sec)) * 1e9)
+		capture["core:datetime"] = time.Unix(sec, nsec).UTC().Format(time.RFC3339Nano)
+		used[key] = true
+	}
+
+	// Other scalar metadata is kept under the argus namespace
+	names := make([]string, 0, len(metadata))
+	for name := range metadata {
+		if !used[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		global["argus:"+name] = metadata[name]
+	}
+	if len(names) > 0 {
+		global["core:extensions"] = []map[string]interface{}{
+			{"name": "argus", "version": "1.0.0", "optional": true},
+		}
+	}
+
+	return map[string]interface{}{
+		"global":      global,
+		"captures":    []interface{}{capture},
+		"annotations": []interface{}{},
+	}
+}
+
+// lookup returns the first of keys present in values
+func lookup(values map[string]float64, keys []string) (float64, string, bool) {
+	for _, key := range keys {
+		if value, ok := values[key]; ok {
+			return value, key, true
+		}
+	}
+	return 0, "", false
+}
@@ -0,0 +1,14 @@
+//go:build !cgo
+
+package database
+
+// IsBusy always reports false without cgo, where the SQLite driver is a stub
+// that can't open a database
+func IsBusy(err error) bool {
+	return false
+}
+
+// IsUniqueViolation always reports false without cgo, like IsBusy
+func IsUniqueViolation(err error) bool {
+	return false
+}
@@ -2,12 +2,15 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func Initialize(dbPath string) (*sql.DB, error) {
+// Initialize opens the SQLite database. Writers wait up to busyTimeoutMs for
+// a lock held by another connection before failing with SQLITE_BUSY.
+func Initialize(dbPath string, busyTimeoutMs int) (*sql.DB, error) {
 	// Create directory if it doesn't exist
 	if dir := dbPath[:len(dbPath)-len("/sdr.db")]; dir != "." {
 		if err := os.MkdirAll(dir, 0755); err != nil {
@@ -15,7 +18,7 @@ func Initialize(dbPath string) (*sql.DB, error) {
 		}
 	}
 
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := sql.Open("sqlite3", fmt.Sprintf("%s?_busy_timeout=%d", dbPath, busyTimeoutMs))
 	if err != nil {
 		return nil, err
 	}
@@ -35,6 +38,8 @@ func Migrate(db *sql.DB) error {
 			email TEXT UNIQUE NOT NULL,
 			password_hash TEXT NOT NULL,
 			client_type INTEGER NOT NULL,
+			role TEXT NOT NULL DEFAULT 'user',
+			webhook_secret TEXT,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
@@ -73,6 +78,13 @@ func Migrate(db *sql.DB) error {
 			id TEXT PRIMARY KEY,
 			request_type TEXT NOT NULL,
 			parameters TEXT,
+			format TEXT,
+			image TEXT,
+			callback_url TEXT,
+			region TEXT,
+			region_fallback BOOLEAN,
+			selection_strategy TEXT,
+			duration_seconds REAL,
 			requested_by INTEGER NOT NULL,
 			assigned_station TEXT,
 			status TEXT DEFAULT 'pending',
@@ -91,6 +103,9 @@ func Migrate(db *sql.DB) error {
 			download_url TEXT,
 			file_size INTEGER,
 			error_message TEXT,
+			cached_path TEXT,
+			sha256 TEXT,
+			capture_metadata TEXT,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			completed_at DATETIME,
 			FOREIGN KEY (request_id) REFERENCES data_requests(id),
@@ -101,7 +116,18 @@ func Migrate(db *sql.DB) error {
 			station_id TEXT UNIQUE NOT NULL,
 			connected_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			last_heartbeat DATETIME DEFAULT CURRENT_TIMESTAMP,
-			status TEXT DEFAULT 'connected'
+			status TEXT DEFAULT 'connected',
+			disk_free_bytes INTEGER,
+			clock_synchronized BOOLEAN,
+			image_ready BOOLEAN,
+			latitude REAL,
+			longitude REAL
+		)`,
+		`CREATE TABLE IF NOT EXISTS stations (
+			station_id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
 		`CREATE TABLE IF NOT EXISTS ice_candidates (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -127,6 +153,48 @@ func Migrate(db *sql.DB) error {
 			completed_at DATETIME,
 			FOREIGN KEY (session_id) REFERENCES ice_sessions(session_id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS request_subscribers (
+			request_id TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (request_id, user_id),
+			FOREIGN KEY (request_id) REFERENCES data_requests(id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS pending_notifications (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			request_id TEXT NOT NULL,
+			message TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			delivered_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS request_templates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			request_type TEXT,
+			parameters TEXT,
+			format TEXT,
+			image TEXT,
+			region TEXT,
+			duration_seconds REAL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, name),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS transfer_usage (
+			user_id INTEGER NOT NULL,
+			day TEXT NOT NULL,
+			station_id TEXT NOT NULL,
+			transfer TEXT NOT NULL,
+			bytes INTEGER NOT NULL DEFAULT 0,
+			files INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (user_id, day, station_id, transfer),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
 		`CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)`,
 		`CREATE INDEX IF NOT EXISTS idx_type1_clients_user_id ON type1_clients(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_active_connections_client_id ON active_connections(client_id)`,
@@ -135,6 +203,11 @@ func Migrate(db *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_file_transfers_session_id ON file_transfers(session_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_collector_responses_request_id ON collector_responses(request_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_collector_responses_station_id ON collector_responses(station_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_request_subscribers_user_id ON request_subscribers(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_data_requests_requested_by_created_at ON data_requests(requested_by, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_pending_notifications_user_id ON pending_notifications(user_id, delivered_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_transfer_usage_day ON transfer_usage(day)`,
+		`CREATE INDEX IF NOT EXISTS idx_transfer_usage_station_id_day ON transfer_usage(station_id, day)`,
 	}
 
 	for _, migration := range migrations {
@@ -143,9 +216,69 @@ func Migrate(db *sql.DB) error {
 		}
 	}
 
+	// Columns added after a table was first created; CREATE TABLE IF NOT EXISTS
+	// doesn't add them to existing databases
+	columns := []struct {
+		table, column, definition string
+	}{
+		{"collector_responses", "cached_path", "TEXT"},
+		{"collector_responses", "sha256", "TEXT"},
+		{"users", "role", "TEXT NOT NULL DEFAULT 'user'"},
+		{"data_requests", "format", "TEXT"},
+		{"users", "webhook_secret", "TEXT"},
+		{"data_requests", "callback_url", "TEXT"},
+		{"data_requests", "image", "TEXT"},
+		{"collector_responses", "capture_metadata", "TEXT"},
+		{"collector_sessions", "disk_free_bytes", "INTEGER"},
+		{"collector_sessions", "clock_synchronized", "BOOLEAN"},
+		{"collector_sessions", "latitude", "REAL"},
+		{"collector_sessions", "longitude", "REAL"},
+		{"data_requests", "region", "TEXT"},
+		{"data_requests", "duration_seconds", "REAL"},
+		{"data_requests", "region_fallback", "BOOLEAN"},
+		{"data_requests", "selection_strategy", "TEXT"},
+		{"collector_sessions", "image_ready", "BOOLEAN"},
+	}
+	for _, col := range columns {
+		if err := ensureColumn(db, col.table, col.column, col.definition); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// ensureColumn adds a column to a table if it doesn't exist yet
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid          int
+			name, ctype  string
+			notNull, pk  int
+			defaultValue sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
 // CleanupStaleConnections resets all stale connections from previous server runs
 func CleanupStaleConnections(db *sql.DB) error {
 	// Clear all active connections (they're all stale on server restart)
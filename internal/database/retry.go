@@ -0,0 +1,34 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Bounds for ExecWithRetry: up to busyAttempts tries, waiting busyBaseDelay
+// after the first and doubling up to busyMaxDelay, so a write gives up after
+// at most 1.2s of backoff on top of each attempt's busy timeout
+const (
+	busyAttempts  = 7
+	busyBaseDelay = 25 * time.Millisecond
+	busyMaxDelay  = 400 * time.Millisecond
+)
+
+// ExecWithRetry runs a write statement, retrying with a short backoff while
+// the database is busy. It's meant for writes from concurrent WebSocket and
+// signaling handlers, where a dropped heartbeat or response is worse than a
+// short delay; reads don't need it.
+func ExecWithRetry(db *sql.DB, query string, args ...interface{}) (sql.Result, error) {
+	delay := busyBaseDelay
+	for attempt := 1; ; attempt++ {
+		result, err := db.Exec(query, args...)
+		if err == nil || !IsBusy(err) || attempt >= busyAttempts {
+			return result, err
+		}
+
+		time.Sleep(delay)
+		if delay *= 2; delay > busyMaxDelay {
+			delay = busyMaxDelay
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Queryer is what *sql.DB and *sql.Tx have in common, for code that runs both
+// on its own and as part of a transaction
+type Queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// WithTx runs fn in a transaction, committing it if fn returns nil and
+// rolling it back otherwise, so multi-step writes happen entirely or not at
+// all. Like ExecWithRetry, it retries the whole transaction while the
+// database is busy, so fn may run more than once and must only touch the
+// database.
+func WithTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	delay := busyBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := runTx(db, fn)
+		if err == nil || !IsBusy(err) || attempt >= busyAttempts {
+			return err
+		}
+
+		time.Sleep(delay)
+		if delay *= 2; delay > busyMaxDelay {
+			delay = busyMaxDelay
+		}
+	}
+}
+
+// runTx runs fn in a single transaction
+func runTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,175 @@
+// Package geometry rates how well a set of stations can locate a transmitter
+// by time difference of arrival (TDOA)
+package geometry
+
+import (
+	"fmt"
+	"math"
+)
+
+// earthRadius is the mean Earth radius in meters
+const earthRadius = 6371000.0
+
+// Position is a station's location in degrees (WGS 84)
+type Position struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Validate checks that a position is a real place on Earth
+func (p Position) Validate() error {
+	if math.IsNaN(p.Latitude) || p.Latitude < -90 || p.Latitude > 90 {
+		return fmt.Errorf("latitude %v is not between -90 and 90", p.Latitude)
+	}
+	if math.IsNaN(p.Longitude) || p.Longitude < -180 || p.Longitude > 180 {
+		return fmt.Errorf("longitude %v is not between -180 and 180", p.Longitude)
+	}
+	return nil
+}
+
+// Assessment describes the geometry of a set of stations
+type Assessment struct {
+	// GDOP is the geometric dilution of precision of a TDOA fix: how much
+	// the error of the measured time differences (as distances) is magnified
+	// in the position. It is the worst over the area the stations cover, see
+	// Assess. Lower is better; it is +Inf when the stations are collinear or
+	// coincide.
+	GDOP float64
+	// MinBaseline and MaxBaseline are the shortest and longest distances
+	// between two stations, in meters
+	MinBaseline float64
+	MaxBaseline float64
+	// Score is 1/GDOP capped at 1: near 1 for well spread stations, 0 for
+	// degenerate ones
+	Score float64
+}
+
+// coverageSamples is the number of points around the centroid GDOP is evaluated at
+const coverageSamples = 8
+
+// Assess rates the geometry of three or more stations. GDOP is evaluated at
+// the stations' centroid and at points a quarter of the longest baseline
+// away from it in every direction, and the worst value is kept: nearly
+// collinear stations give a good fix between them but a poor one to either
+// side. A transmitter far outside the network always gets a poor fix, so
+// points further out aren't considered.
+func Assess(positions []Position) (Assessment, error) {
+	if len(positions) < 3 {
+		return Assessment{}, fmt.Errorf("need at least 3 stations, got %d", len(positions))
+	}
+	for i, p := range positions {
+		if err := p.Validate(); err != nil {
+			return Assessment{}, fmt.Errorf("station %d: %w", i, err)
+		}
+	}
+
+	assessment := Assessment{MinBaseline: math.Inf(1)}
+	for i := range positions {
+		for j := i + 1; j < len(positions); j++ {
+			d := Distance(positions[i], positions[j])
+			assessment.MinBaseline = math.Min(assessment.MinBaseline, d)
+			assessment.MaxBaseline = math.Max(assessment.MaxBaseline, d)
+		}
+	}
+
+	points := project(positions)
+	assessment.GDOP = gdop(points, 0, 0)
+	radius := assessment.MaxBaseline / 4
+	for i := 0; i < coverageSamples; i++ {
+		angle := 2 * math.Pi * float64(i) / coverageSamples
+		assessment.GDOP = math.Max(assessment.GDOP, gdop(points, radius*math.Cos(angle), radius*math.Sin(angle)))
+	}
+	if !math.IsInf(assessment.GDOP, 1) {
+		assessment.Score = math.Min(1, 1/assessment.GDOP)
+	}
+	return assessment, nil
+}
+
+// Distance returns the great-circle distance between two positions in meters
+func Distance(a, b Position) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat := lat2 - lat1
+	dLon := radians(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// project maps positions onto a plane tangent at their centroid, in meters
+// east and north of it. Stations of one network are close enough together
+// for the distortion not to matter.
+func project(positions []Position) [][2]float64 {
+	var lat0, sinLon, cosLon float64
+	for _, p := range positions {
+		lat0 += p.Latitude
+		sinLon += math.Sin(radians(p.Longitude))
+		cosLon += math.Cos(radians(p.Longitude))
+	}
+	lat0 /= float64(len(positions))
+	// Average longitudes as angles so networks across the antimeridian work
+	lon0 := math.Atan2(sinLon, cosLon)
+
+	points := make([][2]float64, len(positions))
+	var cx, cy float64
+	for i, p := range positions {
+		dLon := math.Remainder(radians(p.Longitude)-lon0, 2*math.Pi)
+		points[i] = [2]float64{
+			earthRadius * dLon * math.Cos(radians(lat0)),
+			earthRadius * radians(p.Latitude-lat0),
+		}
+		cx += points[i][0]
+		cy += points[i][1]
+	}
+
+	// Center on the centroid of the projected points
+	cx /= float64(len(points))
+	cy /= float64(len(points))
+	for i := range points {
+		points[i][0] -= cx
+		points[i][1] -= cy
+	}
+	return points
+}
+
+// gdop returns the TDOA GDOP at (x, y) for stations at the given points.
+// Each time difference is the difference of two ranges, whose gradients are
+// the unit vectors u from (x, y) towards the stations. With independent,
+// equal range errors, the information about the position is the scatter
+// matrix of those unit vectors, sum((u - mean(u))(u - mean(u))^T), whatever
+// station the differences are taken against; GDOP is the square root of the
+// trace of its inverse.
+func gdop(points [][2]float64, x, y float64) float64 {
+	units := make([][2]float64, len(points))
+	var mx, my float64
+	for i, p := range points {
+		dx, dy := p[0]-x, p[1]-y
+		norm := math.Hypot(dx, dy)
+		// A station right at (x, y) adds no direction
+		if norm > 0 {
+			units[i] = [2]float64{dx / norm, dy / norm}
+		}
+		mx += units[i][0]
+		my += units[i][1]
+	}
+	mx /= float64(len(units))
+	my /= float64(len(units))
+
+	var sxx, sxy, syy float64
+	for _, u := range units {
+		dx, dy := u[0]-mx, u[1]-my
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+
+	// trace of the inverse of [[sxx sxy] [sxy syy]]
+	det := sxx*syy - sxy*sxy
+	if det <= 1e-9*(sxx+syy)*(sxx+syy) {
+		return math.Inf(1)
+	}
+	return math.Sqrt((sxx + syy) / det)
+}
+
+// radians converts degrees to radians
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
@@ -0,0 +1,74 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+)
+
+// BoundingBox is an area between two latitudes and two longitudes, in
+// degrees. A box whose West is east of its East crosses the antimeridian.
+type BoundingBox struct {
+	South float64 `json:"south"`
+	West  float64 `json:"west"`
+	North float64 `json:"north"`
+	East  float64 `json:"east"`
+}
+
+// Region is where stations are selected from: either a bounding box or the
+// stations within RadiusMeters of Center
+type Region struct {
+	BoundingBox  *BoundingBox `json:"bbox,omitempty"`
+	Center       *Position    `json:"center,omitempty"`
+	RadiusMeters float64      `json:"radius_m,omitempty"`
+}
+
+// Validate checks that a region is either a well formed bounding box or a
+// valid center with a positive radius
+func (r Region) Validate() error {
+	switch {
+	case r.BoundingBox != nil && r.Center != nil:
+		return fmt.Errorf("region must be either a bbox or a center and radius_m, not both")
+	case r.BoundingBox != nil:
+		box := r.BoundingBox
+		if err := (Position{Latitude: box.South, Longitude: box.West}).Validate(); err != nil {
+			return fmt.Errorf("bbox south-west corner: %w", err)
+		}
+		if err := (Position{Latitude: box.North, Longitude: box.East}).Validate(); err != nil {
+			return fmt.Errorf("bbox north-east corner: %w", err)
+		}
+		if box.South > box.North {
+			return fmt.Errorf("bbox south %v is north of north %v", box.South, box.North)
+		}
+		if r.RadiusMeters != 0 {
+			return fmt.Errorf("radius_m only applies to a center")
+		}
+	case r.Center != nil:
+		if err := r.Center.Validate(); err != nil {
+			return fmt.Errorf("center: %w", err)
+		}
+		if math.IsNaN(r.RadiusMeters) || r.RadiusMeters <= 0 {
+			return fmt.Errorf("radius_m must be positive")
+		}
+	default:
+		return fmt.Errorf("region must have a bbox or a center and radius_m")
+	}
+	return nil
+}
+
+// Contains reports whether a position is inside the region. Boundaries
+// belong to it.
+func (r Region) Contains(p Position) bool {
+	if box := r.BoundingBox; box != nil {
+		if p.Latitude < box.South || p.Latitude > box.North {
+			return false
+		}
+		if box.West <= box.East {
+			return p.Longitude >= box.West && p.Longitude <= box.East
+		}
+		return p.Longitude >= box.West || p.Longitude <= box.East
+	}
+	if r.Center != nil {
+		return Distance(*r.Center, p) <= r.RadiusMeters
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CaptureMetadataVersion is bumped when CaptureMetadata changes incompatibly
+const CaptureMetadataVersion = 1
+
+// CaptureMetadataHeader carries base64-encoded CaptureMetadata JSON on
+// collector uploads and cached downloads
+const CaptureMetadataHeader = "X-Capture-Metadata"
+
+// maxCaptureMetadataSize bounds an encoded CaptureMetadata header
+const maxCaptureMetadataSize = 16 * 1024
+
+// CaptureMetadata records where, when and how a capture was taken. Collectors
+// send it with each file and receivers save it next to the file, so TDOA
+// analysis can be reproduced without the collector's logs.
+type CaptureMetadata struct {
+	Version          int             `json:"version"`
+	RequestID        string          `json:"request_id"`
+	StationID        string          `json:"station_id"`
+	CollectorVersion string          `json:"collector_version"`
+	SDRModel         string          `json:"sdr_model,omitempty"`
+	Image            string          `json:"image"`
+	Parameters       json.RawMessage `json:"parameters,omitempty"` // as requested
+	DurationSeconds  float64         `json:"duration_seconds,omitempty"`
+	Format           string          `json:"format"`
+	FileName         string          `json:"file_name"`
+	FileSize         int64           `json:"file_size"`
+	SHA256           string          `json:"sha256"`
+	CaptureStart     time.Time       `json:"capture_start"`
+	CaptureEnd       time.Time       `json:"capture_end"`
+	Clock            ClockStatus     `json:"clock"`
+}
+
+// ClockStatus is the state of the collector's system clock when a capture ended
+type ClockStatus struct {
+	Synchronized   bool   `json:"synchronized"`           // disciplined by NTP, PTP or GPS
+	MaxErrorMicros int64  `json:"max_error_us,omitempty"` // kernel's maximum error estimate
+	EstErrorMicros int64  `json:"est_error_us,omitempty"` // kernel's estimated error
+	Error          string `json:"error,omitempty"`        // why the status couldn't be read
+}
+
+// HeaderValue encodes the metadata for CaptureMetadataHeader
+func (m *CaptureMetadata) HeaderValue() (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// ParseCaptureMetadataHeader decodes a CaptureMetadataHeader value
+func ParseCaptureMetadataHeader(value string) (*CaptureMetadata, error) {
+	if len(value) > maxCaptureMetadataSize {
+		return nil, fmt.Errorf("capture metadata exceeds %d bytes", maxCaptureMetadataSize)
+	}
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("capture metadata is not valid base64: %w", err)
+	}
+	var metadata CaptureMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("capture metadata is not valid JSON: %w", err)
+	}
+	return &metadata, nil
+}
@@ -4,11 +4,18 @@ import (
 	"time"
 )
 
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID           int       `json:"id" db:"id"`
 	Email        string    `json:"email" db:"email"`
 	PasswordHash string    `json:"-" db:"password_hash"`
 	ClientType   int       `json:"client_type" db:"client_type"` // 1 or 2
+	Role         string    `json:"role" db:"role"`               // RoleUser or RoleAdmin
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -65,7 +72,7 @@ type SessionDescription struct {
 
 type ICESignalRequest struct {
 	SessionID           string              `json:"session_id" binding:"required"`
-	Type                string              `json:"type" binding:"required,oneof=offer answer candidate"`
+	Type                string              `json:"type" binding:"required,oneof=offer answer candidate restart"`
 	SessionDescription  *SessionDescription `json:"session_description,omitempty"`
 	ICECandidate        *ICECandidate       `json:"ice_candidate,omitempty"`
 	TargetClientType    int                 `json:"target_client_type"`
@@ -82,9 +89,53 @@ type FileTransferRequest struct {
 	Parameters   string `json:"parameters"` // JSON string with request parameters (optional)
 }
 
+// FileTransferComplete is the body of POST /api/ice/complete
+type FileTransferComplete struct {
+	SessionID string `json:"session_id" binding:"required"`
+	Bytes     int64  `json:"bytes"` // received over the session
+}
+
 type FileTransferResponse struct {
 	SessionID string `json:"session_id"`
 	Success   bool   `json:"success"`
 	Message   string `json:"message,omitempty"`
 	FileURL   string `json:"file_url,omitempty"`
-}
\ No newline at end of file
+}
+// Type 1 measurement messages, sent over the /ws WebSocket
+type SpectrumRequest struct {
+	Type      string    `json:"type"` // "spectrum_request"
+	RequestID string    `json:"request_id"`
+	StartHz   float64   `json:"start_hz"`
+	EndHz     float64   `json:"end_hz"`
+	Bins      int       `json:"bins"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type SpectrumResponse struct {
+	Type        string    `json:"type"` // "spectrum_response"
+	RequestID   string    `json:"request_id"`
+	StartHz     float64   `json:"start_hz"`
+	EndHz       float64   `json:"end_hz"`
+	PowerLevels []float64 `json:"power_levels"` // dBm per frequency bin
+	Error       string    `json:"error,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+type SignalRequest struct {
+	Type            string    `json:"type"` // "signal_request"
+	RequestID       string    `json:"request_id"`
+	CenterFrequency float64   `json:"center_frequency_hz"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+type SignalResponse struct {
+	Type            string    `json:"type"` // "signal_response"
+	RequestID       string    `json:"request_id"`
+	CenterFrequency float64   `json:"center_frequency_hz"`
+	Bandwidth       float64   `json:"bandwidth_hz"`
+	SignalStrength  float64   `json:"signal_strength"` // dBm
+	SNR             float64   `json:"snr"`             // dB
+	Modulation      string    `json:"modulation"`
+	Error           string    `json:"error,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+}
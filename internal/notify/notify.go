@@ -0,0 +1,12 @@
+// Package notify delivers request notifications to receivers that don't keep
+// a WebSocket open
+package notify
+
+// Notifier delivers a notification payload to a receiver's callback URL
+type Notifier interface {
+	// Validate checks a callback URL before it is accepted with a request
+	Validate(url string) error
+	// Notify sends payload to url, signed with secret. Delivery (including
+	// retries) happens in the background; failures are logged, not returned.
+	Notify(url, secret string, payload []byte)
+}
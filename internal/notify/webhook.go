@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"argus-sdr/internal/safehttp"
+	"argus-sdr/internal/shared"
+	"argus-sdr/pkg/logger"
+)
+
+// SignatureHeader carries "sha256=" followed by the hex HMAC-SHA256 of the
+// request body, keyed with the receiver's webhook secret
+const SignatureHeader = "X-Argus-Signature"
+
+// maxResponseBytes bounds how much of a webhook response is read
+const maxResponseBytes = 64 * 1024
+
+// Webhook POSTs notifications to callback URLs, retrying failed deliveries
+// with exponential backoff
+type Webhook struct {
+	client      *http.Client
+	opts        safehttp.Options
+	maxAttempts int
+	baseDelay   time.Duration
+	log         *logger.Logger
+}
+
+// NewWebhook creates a webhook notifier. Callbacks go through a safehttp
+// client, so they can't reach internal addresses unless opts allows them.
+func NewWebhook(log *logger.Logger, opts safehttp.Options, maxAttempts int) *Webhook {
+	// Redirects could point anywhere; receivers must give the final URL
+	opts.MaxRedirects = 0
+	opts.MaxResponseBytes = maxResponseBytes
+
+	return &Webhook{
+		client:      safehttp.NewClient(opts),
+		opts:        opts,
+		maxAttempts: maxAttempts,
+		baseDelay:   time.Second,
+		log:         log,
+	}
+}
+
+// Validate checks that a callback URL is an absolute http(s) URL that
+// doesn't resolve to an internal address
+func (w *Webhook) Validate(callbackURL string) error {
+	if err := safehttp.ValidateURL(context.Background(), callbackURL, w.opts); err != nil {
+		return fmt.Errorf("invalid callback URL: %w", err)
+	}
+	return nil
+}
+
+// Notify implements Notifier
+func (w *Webhook) Notify(callbackURL, secret string, payload []byte) {
+	go w.deliver(callbackURL, secret, payload)
+}
+
+// deliver POSTs the payload until the receiver accepts it with a 2xx, the
+// attempts run out or the receiver rejects it with a non-retryable status
+func (w *Webhook) deliver(callbackURL, secret string, payload []byte) {
+	signature := Sign(secret, payload)
+
+	for attempt := 1; ; attempt++ {
+		wait := w.baseDelay << (attempt - 1)
+
+		req, err := http.NewRequest("POST", callbackURL, bytes.NewReader(payload))
+		if err != nil {
+			w.log.Error("Invalid webhook URL %s: %v", callbackURL, err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(SignatureHeader, signature)
+
+		resp, err := w.client.Do(req)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				w.log.Debug("Delivered webhook to %s (attempt %d)", callbackURL, attempt)
+				return
+			}
+			if resp.StatusCode < 500 && !shared.Retryable(resp.StatusCode) {
+				w.log.Warn("Webhook %s rejected with status %d; not retrying", callbackURL, resp.StatusCode)
+				return
+			}
+			if retryAfter, ok := shared.RetryAfter(resp); ok {
+				wait = retryAfter
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		if errors.Is(err, safehttp.ErrBlockedAddress) {
+			w.log.Warn("Webhook %s not delivered: %v", callbackURL, err)
+			return
+		}
+
+		if attempt >= w.maxAttempts {
+			w.log.Warn("Giving up on webhook %s after %d attempts: %v", callbackURL, attempt, err)
+			return
+		}
+		if wait > time.Minute {
+			wait = time.Minute
+		}
+		w.log.Debug("Webhook %s failed (attempt %d): %v, retrying in %s", callbackURL, attempt, err, wait)
+		time.Sleep(wait)
+	}
+}
+
+// Sign returns the SignatureHeader value for a body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
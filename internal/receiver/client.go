@@ -3,21 +3,27 @@ package receiver
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"argus-sdr/internal/convert"
 	"argus-sdr/internal/models"
 	"argus-sdr/internal/shared"
 	"argus-sdr/pkg/logger"
+	"argus-sdr/pkg/version"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/pion/webrtc/v3"
 )
@@ -29,11 +35,65 @@ type Client struct {
 	DownloadDir  string
 	Logger       *logger.Logger
 
+	// ICETimeouts bounds ICE gathering and how quickly dead WebRTC connections fail
+	ICETimeouts shared.ICETimeouts
+	// NotificationBuffer and NotificationOverflow size the WebSocket notification queue
+	// and decide what happens when it fills up
+	NotificationBuffer   int
+	NotificationOverflow shared.OverflowPolicy
+	// Format is the file format to request (empty for the collector's native npz)
+	Format string
+	// Image is the processing image to request (empty for each collector's default)
+	Image string
+	// Duration is how long the stations capture (0 for the image's default)
+	Duration time.Duration
+	// WriteManifest writes a <request_id>_manifest.json indexing the request's downloads
+	WriteManifest bool
+	// Stream requests a continuous stream of captures instead of a single file. The
+	// receiver stops it after StreamFrames frames or StreamDuration (0 for no limit).
+	Stream         bool
+	StreamFrames   int
+	StreamDuration time.Duration
+	// SingleStation asks the server for data from only the best station it
+	// selects and returns once that station's file is downloaded
+	SingleStation bool
+	// MinTransferThroughput aborts a file transfer averaging fewer bytes per second
+	// than this over TransferStallWindow, and bounds the whole transfer by the
+	// file's size at that rate (0 disables both)
+	MinTransferThroughput int64
+	TransferStallWindow   time.Duration
+	// TransferIdleTimeout aborts a file transfer that receives nothing for this long (0 disables it)
+	TransferIdleTimeout time.Duration
+	// KeepPartialDownloads keeps files of failed downloads as <name>.partial instead of deleting them
+	KeepPartialDownloads bool
+	// MaxConcurrentDownloads bounds how many stations are downloaded from at once; further
+	// downloads wait their turn (0 for no limit). Streams aren't limited.
+	MaxConcurrentDownloads int
+	// GeometryCheck rates the stations a request would go to before sending it:
+	// "warn" logs a warning if they can't give a usable TDOA fix and "refuse"
+	// doesn't send the request; anything else skips the check
+	GeometryCheck string
+	// AllowPartialReliability accepts stream data channels that may drop messages;
+	// frames that lose data are discarded. File transfers must always be reliable.
+	AllowPartialReliability bool
+	// MetadataOnly asks each station for a preview of its file first (see
+	// shared.FilePreview), saved as <request_id>_<station_id>_preview.json.
+	// The file is only fetched if TriageCommand accepts the preview.
+	MetadataOnly bool
+	// TriageCommand is run with each preview on its standard input; the file
+	// is fetched if it exits with status 0. Its arguments are split on
+	// spaces, without a shell.
+	TriageCommand string
+	// ICERestarts is how many times an established transfer whose ICE
+	// connection fails asks the collector to restart ICE (0 disables it)
+	ICERestarts int
+
 	httpClient      *http.Client
 	authToken       string
 	wsConn          *websocket.Conn
 	waitingForOffer map[string]chan webrtc.SessionDescription
 	peerConnections map[string]*webrtc.PeerConnection
+	sessionCancels  map[string]chan struct{} // closed when the server cancels a transfer session
 	mu              sync.RWMutex
 }
 
@@ -44,6 +104,11 @@ func (c *Client) RequestAndDownload() error {
 		Timeout: 30 * time.Second,
 	}
 
+	// Make sure the server speaks a compatible protocol
+	if err := c.checkServerVersion(); err != nil {
+		return fmt.Errorf("incompatible server: %w", err)
+	}
+
 	// Authenticate with API server
 	if err := c.authenticate(); err != nil {
 		return fmt.Errorf("authentication failed: %w", err)
@@ -51,9 +116,14 @@ func (c *Client) RequestAndDownload() error {
 
 	c.Logger.Info("Authenticated with API server")
 
+	if err := c.checkStationGeometry(); err != nil {
+		return err
+	}
+
 	// Initialize maps
 	c.waitingForOffer = make(map[string]chan webrtc.SessionDescription)
 	c.peerConnections = make(map[string]*webrtc.PeerConnection)
+	c.sessionCancels = make(map[string]chan struct{})
 
 	// Connect to WebSocket for notifications - REQUIRED
 	if err := c.connectWebSocket(); err != nil {
@@ -64,30 +134,90 @@ func (c *Client) RequestAndDownload() error {
 
 	// Create and send data request
 	request := shared.DataRequest{
-		ID:          uuid.New().String(),
 		RequestType: "data_collection", // Single request type
 		Parameters:  "{}",
 		RequestedBy: c.ID,
 		Timestamp:   time.Now().Unix(),
+		Format:      c.Format,
+		Image:       c.Image,
+
+		DurationSeconds: c.Duration.Seconds(),
+	}
+	if c.Stream {
+		request.RequestType = shared.RequestTypeStream
+	}
+	if c.SingleStation {
+		request.MaxStations = 1
 	}
 
-	c.Logger.Info("Sending data request with ID: %s", request.ID)
+	c.Logger.Info("Sending data request")
 
 	// Send request to API
-	if err := c.sendDataRequest(request); err != nil {
+	collectorCount, err := c.sendDataRequest(&request)
+	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 
-	c.Logger.Info("Request submitted, waiting for data to be ready...")
+	c.Logger.Info("Request %s submitted to %d collectors, waiting for data to be ready...", request.ID, collectorCount)
 
 	// Wait for data to be ready
-	if err := c.waitForData(request.ID); err != nil {
+	if err := c.waitForData(request.ID, collectorCount); err != nil {
 		return fmt.Errorf("failed waiting for data: %w", err)
 	}
 
 	return nil
 }
 
+// checkChannelReliability rejects data channels whose delivery guarantees
+// aren't enough for what they carry
+func (c *Client) checkChannelReliability(dataChannel *webrtc.DataChannel, stream bool) error {
+	if shared.IsReliableOrdered(dataChannel) {
+		return nil
+	}
+	reliability := shared.DescribeReliability(dataChannel)
+	switch {
+	case !stream:
+		return fmt.Errorf("data channel '%s' is %s; file transfers need a reliable, ordered channel", dataChannel.Label(), reliability)
+	case !dataChannel.Ordered():
+		return fmt.Errorf("stream data channel '%s' is %s; streams need an ordered channel", dataChannel.Label(), reliability)
+	case !c.AllowPartialReliability:
+		return fmt.Errorf("stream data channel '%s' is %s; set RECEIVER_ALLOW_PARTIAL_RELIABILITY to accept it", dataChannel.Label(), reliability)
+	}
+	c.Logger.Warn("Stream data channel '%s' is %s; frames that lose data will be discarded", dataChannel.Label(), reliability)
+	return nil
+}
+
+// retryPolicy is how the receiver retries requests the server answers with
+// 429 or 503, honoring their Retry-After header
+func (c *Client) retryPolicy() shared.RetryPolicy {
+	policy := shared.DefaultRetryPolicy
+	policy.OnRetry = func(status int, wait time.Duration) {
+		c.Logger.Warn("Server returned status %d, retrying in %s", status, wait.Round(time.Millisecond))
+	}
+	return policy
+}
+
+// checkServerVersion verifies the API server is compatible with this receiver.
+// Version differences only warn; an unsupported protocol version is an error.
+func (c *Client) checkServerVersion() error {
+	info, err := shared.FetchServerVersion(c.httpClient, c.APIServerURL)
+	if err != nil {
+		c.Logger.Warn("Could not verify server version: %v", err)
+		return nil
+	}
+
+	if err := version.CheckCompatible(info); err != nil {
+		return err
+	}
+
+	if info.Version != version.Get() {
+		c.Logger.Warn("Server version %s differs from receiver version %s", info.Version, version.Get())
+	}
+
+	c.Logger.Info("Connected to API server version %s (protocol %d)", info.Version, info.ProtocolVersion)
+	return nil
+}
+
 // authenticate performs authentication with the API server
 func (c *Client) authenticate() error {
 	// For demo purposes, use hardcoded credentials
@@ -102,14 +232,17 @@ func (c *Client) authenticate() error {
 		return fmt.Errorf("failed to marshal login data: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", c.APIServerURL+"/api/auth/login", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create login request: %w", err)
+	login := func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", c.APIServerURL+"/api/auth/login", bytes.NewBuffer(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create login request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
+	// Login is rate limited per IP, so back off as the server asks
+	resp, err := c.retryPolicy().Do(c.httpClient, login)
 	if err != nil {
 		return fmt.Errorf("failed to send login request: %w", err)
 	}
@@ -120,15 +253,9 @@ func (c *Client) authenticate() error {
 		if err := c.register(); err != nil {
 			return fmt.Errorf("failed to register user: %w", err)
 		}
-		// Try login again after registration - need to create a new request since the body was consumed
+		// Try login again after registration
 		resp.Body.Close()
-		retryReq, err := http.NewRequest("POST", c.APIServerURL+"/api/auth/login", bytes.NewBuffer(jsonData))
-		if err != nil {
-			return fmt.Errorf("failed to create retry login request: %w", err)
-		}
-		retryReq.Header.Set("Content-Type", "application/json")
-
-		resp, err = c.httpClient.Do(retryReq)
+		resp, err = c.retryPolicy().Do(c.httpClient, login)
 		if err != nil {
 			return fmt.Errorf("failed to send login request after registration: %w", err)
 		}
@@ -164,14 +291,14 @@ func (c *Client) register() error {
 		return fmt.Errorf("failed to marshal register data: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", c.APIServerURL+"/api/auth/register", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create register request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.retryPolicy().Do(c.httpClient, func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", c.APIServerURL+"/api/auth/register", bytes.NewBuffer(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create register request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
 	if err != nil {
 		return fmt.Errorf("failed to send register request: %w", err)
 	}
@@ -186,18 +313,11 @@ func (c *Client) register() error {
 
 // connectWebSocket establishes a WebSocket connection for notifications
 func (c *Client) connectWebSocket() error {
-	// Parse API server URL to get host and build WebSocket URL
-	apiURL, err := url.Parse(c.APIServerURL)
+	// Build WebSocket URL from the API server URL
+	wsURL, err := shared.WebSocketURL(c.APIServerURL, "/receiver-ws")
 	if err != nil {
-		return fmt.Errorf("failed to parse API server URL: %w", err)
-	}
-
-	// Build WebSocket URL
-	wsScheme := "ws"
-	if apiURL.Scheme == "https" {
-		wsScheme = "wss"
+		return err
 	}
-	wsURL := fmt.Sprintf("%s://%s/receiver-ws", wsScheme, apiURL.Host)
 
 	c.Logger.Debug("Connecting to WebSocket URL: %s", wsURL)
 
@@ -206,13 +326,17 @@ func (c *Client) connectWebSocket() error {
 	headers.Set("Authorization", "Bearer "+c.authToken)
 
 	// Connect to WebSocket
-	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, headers)
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = shared.WebSocketSubprotocols
+	conn, resp, err := dialer.Dial(wsURL, headers)
 	if err != nil {
 		if resp != nil {
 			c.Logger.Error("WebSocket connection failed with status: %d %s", resp.StatusCode, resp.Status)
 		}
 		return fmt.Errorf("failed to connect to WebSocket: %w", err)
 	}
+	// Servers that predate subprotocols don't choose one
+	c.Logger.Info("WebSocket connected (subprotocol %s)", shared.SubprotocolName(conn.Subprotocol()))
 
 	// Set up ping/pong handler to respond to server pings
 	conn.SetPongHandler(func(appData string) error {
@@ -229,36 +353,79 @@ func (c *Client) connectWebSocket() error {
 	return nil
 }
 
-// sendDataRequest sends a data request to the API server
-func (c *Client) sendDataRequest(request shared.DataRequest) error {
-	jsonData, err := json.Marshal(request)
-	if err != nil {
-		return err
-	}
+// sendDataRequest sends a data request to the API server, sets request.ID
+// to the ID the server gave it and returns the number of collectors the
+// server forwarded it to. It retries while no collectors are available; the
+// server marks a refused request as failed, so every retry makes a new one.
+func (c *Client) sendDataRequest(request *shared.DataRequest) (int, error) {
+	attempt := 0
+	resp, err := c.retryPolicy().Do(c.httpClient, func() (*http.Request, error) {
+		if attempt > 0 {
+			request.Timestamp = time.Now().Unix()
+			c.Logger.Info("Retrying data request")
+		}
+		attempt++
 
-	req, err := http.NewRequest("POST", c.APIServerURL+"/api/data/request", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return err
-	}
+		jsonData, err := json.Marshal(request)
+		if err != nil {
+			return nil, err
+		}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.authToken)
+		req, err := http.NewRequest("POST", c.APIServerURL+"/api/data/request", bytes.NewBuffer(jsonData))
+		if err != nil {
+			return nil, err
+		}
 
-	resp, err := c.httpClient.Do(req)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+		return req, nil
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer resp.Body.Close()
 
+	if shared.QuotaExhausted(resp) {
+		var refusal struct {
+			Error   string `json:"error"`
+			ResetAt string `json:"reset_at"`
+		}
+		json.NewDecoder(resp.Body).Decode(&refusal)
+		return 0, fmt.Errorf("%s, it resets at %s", refusal.Error, refusal.ResetAt)
+	}
 	if resp.StatusCode != http.StatusAccepted {
-		return fmt.Errorf("server returned status %d", resp.StatusCode)
+		return 0, fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+	if remaining := resp.Header.Get(shared.QuotaRemainingHeader); remaining != "" {
+		c.Logger.Info("%s of %s data requests left today", remaining, resp.Header.Get(shared.QuotaLimitHeader))
 	}
 
-	return nil
+	var result struct {
+		RequestID  string `json:"request_id"`
+		Status     string `json:"status"`
+		Collectors int    `json:"collectors"`
+		ETASeconds int    `json:"eta_seconds"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		// Older servers may not report the collector count, which is fine
+		c.Logger.Debug("Failed to decode data request response: %v", err)
+	}
+	if result.RequestID == "" {
+		return 0, fmt.Errorf("server did not return a request ID")
+	}
+	request.ID = result.RequestID
+	// Servers only estimate once stations have completed requests before
+	if result.ETASeconds > 0 {
+		c.Logger.Info("Server expects the data to be ready in about %v", time.Duration(result.ETASeconds)*time.Second)
+	}
+
+	return result.Collectors, nil
 }
 
 // waitForData waits for WebSocket notifications when data is ready, then downloads it
-func (c *Client) waitForData(requestID string) error {
+// If expectedCollectors is known, it returns as soon as every collector has either
+// delivered data or reported a failure.
+func (c *Client) waitForData(requestID string, expectedCollectors int) error {
 	// WebSocket connection is required
 	if c.wsConn == nil {
 		return fmt.Errorf("WebSocket connection is required but not available")
@@ -266,7 +433,22 @@ func (c *Client) waitForData(requestID string) error {
 
 	timeout := time.After(10 * time.Minute) // Increased timeout for docker processing
 	downloadedFromStations := make(map[string]bool) // Track which stations we've downloaded from
+	failedStations := make(map[string]string)       // Track which stations reported errors and why
+	skippedStations := make(map[string]bool)        // Stations whose file was skipped after its preview
 	firstDownloadTime := time.Time{}
+	streaming := make(map[string]bool)   // Stations whose stream has been started
+	activeStreams := 0                   // Streams that haven't ended yet
+	downloading := make(map[string]bool) // Stations whose download is queued or in progress
+	results := make(chan stationResult)  // Streams and downloads report here when they end
+	finished := make(chan struct{})
+	defer close(finished)
+	timedOut := false
+
+	// Downloads wait for a slot so a burst of ready stations doesn't open a WebRTC connection each at once
+	var downloadSlots chan struct{}
+	if c.MaxConcurrentDownloads > 0 {
+		downloadSlots = make(chan struct{}, c.MaxConcurrentDownloads)
+	}
 
 	c.Logger.Info("Waiting for collectors to complete...")
 
@@ -276,9 +458,22 @@ func (c *Client) waitForData(requestID string) error {
 		}
 	}()
 
-	// Channel to receive WebSocket notifications
-	notifications := make(chan map[string]interface{}, 10)
-	wsErrors := make(chan error, 1)
+	// Index whatever came back, including partial results after a timeout; streams have their frame index instead
+	if c.WriteManifest && !c.Stream {
+		defer func() {
+			c.writeManifest(requestID, expectedCollectors, downloadedFromStations, skippedStations, failedStations)
+		}()
+	}
+
+	// Queue for WebSocket notifications
+	queue := shared.NewQueue[map[string]interface{}]("receiver_notifications", c.NotificationBuffer, c.NotificationOverflow, nil)
+	notifications := queue.C
+	wsErrors := make(chan error, 1) // the reader reports exactly one error before it exits
+	defer func() {
+		if dropped := queue.Dropped(); dropped > 0 {
+			c.Logger.Warn("Dropped %d notifications because the notification queue was full", dropped)
+		}
+	}()
 
 	// Start a goroutine to read WebSocket messages
 	go func() {
@@ -315,19 +510,24 @@ func (c *Client) waitForData(requestID string) error {
 					c.handleICEOffer(notification)
 				case "ice_candidate":
 					c.handleICECandidate(notification)
-				case "data_ready":
-					// This is a data ready notification, not an ICE message
+				case "session_cancelled":
+					c.handleSessionCancelled(notification)
+				case "session_failed":
+					c.handleSessionFailed(notification)
+				case "data_ready", "collection_error":
+					// These are request notifications, not ICE messages
 					// Fall through to the general notification channel
 				default:
 					// Unknown message type, could be other notifications
 				}
 			}
 			
-			select {
-			case notifications <- notification:
-			case <-time.After(5 * time.Second):
-				// Channel is full, skip this notification
-				c.Logger.Warn("Notification channel full, skipping message")
+			if err := queue.Put(notification); err != nil {
+				c.Logger.Warn("Notification queue full, dropping message: %v", err)
+				if c.NotificationOverflow.Policy == shared.OverflowDisconnect {
+					wsErrors <- err
+					return
+				}
 			}
 		}
 	}()
@@ -335,12 +535,19 @@ func (c *Client) waitForData(requestID string) error {
 	for {
 		select {
 		case <-timeout:
-			if len(downloadedFromStations) > 0 {
-				c.Logger.Info("Timeout reached but successfully downloaded from %d collectors: %v",
-					len(downloadedFromStations), getStationList(downloadedFromStations))
-				return nil
+			// Streams run until they're stopped, so they aren't cut off by the timeout
+			if activeStreams > 0 {
+				c.Logger.Info("Timeout reached while streaming from %d stations, waiting for the streams to end", activeStreams)
+				timedOut = true
+				continue
 			}
-			return fmt.Errorf("timeout waiting for data (10 minutes)")
+			// Started downloads are bounded by the transfer timeouts, and queued ones were announced in time
+			if len(downloading) > 0 {
+				c.Logger.Info("Timeout reached with %d downloads queued or in progress, waiting for them to finish", len(downloading))
+				timedOut = true
+				continue
+			}
+			return c.timeoutResult(downloadedFromStations, failedStations)
 			
 		case err := <-wsErrors:
 			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
@@ -349,12 +556,114 @@ func (c *Client) waitForData(requestID string) error {
 				return fmt.Errorf("WebSocket connection error: %w", err)
 			}
 
+		case result := <-results:
+			if c.Stream {
+				activeStreams--
+				if result.err != nil {
+					c.Logger.Error("Stream from station %s failed: %v", result.stationID, result.err)
+					failedStations[result.stationID] = result.err.Error()
+				} else {
+					downloadedFromStations[result.stationID] = true
+				}
+
+				// Stop waiting once every collector's stream has ended
+				if expectedCollectors > 0 && len(downloadedFromStations)+len(failedStations) >= expectedCollectors {
+					if len(downloadedFromStations) > 0 {
+						c.Logger.Info("Streams ended from %d collectors: %v", len(downloadedFromStations), getStationList(downloadedFromStations))
+						return nil
+					}
+					return fmt.Errorf("all %d collectors failed: %s", expectedCollectors, formatStationFailures(failedStations))
+				}
+				if timedOut && activeStreams == 0 {
+					return c.timeoutResult(downloadedFromStations, failedStations)
+				}
+				continue
+			}
+
+			delete(downloading, result.stationID)
+			if errors.Is(result.err, errFileSkipped) {
+				delete(failedStations, result.stationID)
+				skippedStations[result.stationID] = true
+				c.Logger.Info("Skipped the file of station %s after its preview", result.stationID)
+			} else if result.err != nil {
+				c.Logger.Error("Failed to download from station %s: %v", result.stationID, result.err)
+				failedStations[result.stationID] = result.err.Error()
+			} else {
+				// A retry after an earlier failure succeeded
+				delete(failedStations, result.stationID)
+				downloadedFromStations[result.stationID] = true
+				c.Logger.Info("Successfully downloaded from station %s (%d total downloads)",
+					result.stationID, len(downloadedFromStations))
+
+				// Record the time of first download
+				if firstDownloadTime.IsZero() {
+					firstDownloadTime = time.Now()
+				}
+
+				// One file is all that was asked for, even if the server sent the request to more stations
+				if c.SingleStation {
+					c.Logger.Info("Completed the download from station %s", result.stationID)
+					return nil
+				}
+			}
+
+			// Stop waiting once every collector has either delivered or failed and nothing is left queued
+			if expectedCollectors > 0 && len(downloading) == 0 && len(downloadedFromStations)+len(skippedStations)+len(failedStations) >= expectedCollectors {
+				if len(downloadedFromStations)+len(skippedStations) == 0 {
+					return fmt.Errorf("all %d collectors failed: %s", expectedCollectors, formatStationFailures(failedStations))
+				}
+				c.Logger.Info("Completed downloads from %d collectors: %v",
+					len(downloadedFromStations), getStationList(downloadedFromStations))
+				if len(skippedStations) > 0 {
+					c.Logger.Info("Skipped the files of %d collectors after their previews: %v", len(skippedStations), getStationList(skippedStations))
+				}
+				if len(failedStations) > 0 {
+					c.Logger.Warn("Some collectors failed: %s", formatStationFailures(failedStations))
+				}
+				return nil
+			}
+			if timedOut && len(downloading) == 0 {
+				return c.timeoutResult(downloadedFromStations, failedStations)
+			}
+
 		case notification := <-notifications:
+			// Check if a collector reported a failure for our request
+			if notification["type"] == "collection_error" && notification["request_id"] == requestID {
+				var collectionError shared.CollectionErrorNotification
+				if err := shared.DecodePayload(notification, &collectionError); err != nil {
+					c.Logger.Error("Failed to decode collection error notification: %v", err)
+					continue
+				}
+				stationID, errorMessage := collectionError.StationID, collectionError.Error
+				if errorMessage == "" {
+					errorMessage = "unknown error"
+				}
+
+				c.Logger.Error("Collection failed at station %s: %s", stationID, errorMessage)
+				failedStations[stationID] = errorMessage
+
+				// Stop waiting once every collector has either delivered or failed
+				if expectedCollectors > 0 && len(downloading) == 0 && len(downloadedFromStations)+len(skippedStations)+len(failedStations) >= expectedCollectors {
+					if len(downloadedFromStations)+len(skippedStations) > 0 {
+						c.Logger.Info("Completed downloads from %d collectors: %v (%s)",
+							len(downloadedFromStations), getStationList(downloadedFromStations), formatStationFailures(failedStations))
+						return nil
+					}
+					return fmt.Errorf("all %d collectors failed: %s", expectedCollectors, formatStationFailures(failedStations))
+				}
+				continue
+			}
+
 			// Check if this notification is for our request
 			if notification["type"] == "data_ready" && notification["request_id"] == requestID {
-				stationID := notification["station_id"].(string)
+				var dataReady shared.DataReadyNotification
+				if err := shared.DecodePayload(notification, &dataReady); err != nil {
+					c.Logger.Error("Failed to decode data ready notification: %v", err)
+					continue
+				}
+				stationID := dataReady.StationID
 				
-				if !downloadedFromStations[stationID] {
+				if !downloadedFromStations[stationID] && !skippedStations[stationID] && !streaming[stationID] && !downloading[stationID] {
 					c.Logger.Info("Timestamp: Received WebSocket notification for station %s at %s", stationID, time.Now().Format("2006-01-02 15:04:05.000"))
 					c.Logger.Info("New data available from station %s! Starting download...", stationID)
 
@@ -375,20 +684,47 @@ func (c *Client) waitForData(requestID string) error {
 								FilePath:  download.FilePath,
 								FileSize:  download.FileSize,
 								StationID: download.StationID,
+								Transfer:  download.Transfer,
+							}
+							// The notification reflects the server's latest decision on how to fetch the file
+							if dataReady.Transfer != "" {
+								status.Transfer = dataReady.Transfer
 							}
 
-							if err := c.downloadFile(requestID, status); err != nil {
-								c.Logger.Error("Failed to download from station %s: %v", stationID, err)
-							} else {
-								downloadedFromStations[stationID] = true
-								c.Logger.Info("Successfully downloaded from station %s (%d total downloads)",
-									stationID, len(downloadedFromStations))
+							// Streams run until they end, so several stations' are consumed at once
+							if c.Stream {
+								streaming[stationID] = true
+								activeStreams++
+								go func() {
+									result := stationResult{stationID: status.StationID, err: c.downloadFile(requestID, status)}
+									select {
+									case results <- result:
+									case <-finished:
+									}
+								}()
+								break
+							}
 
-								// Record the time of first download
-								if firstDownloadTime.IsZero() {
-									firstDownloadTime = time.Now()
-								}
+							// Downloads run in the background so notifications keep being handled meanwhile
+							if downloadSlots != nil && len(downloading) >= cap(downloadSlots) {
+								c.Logger.Info("Download from station %s queued, %d downloads already in progress", stationID, cap(downloadSlots))
 							}
+							downloading[stationID] = true
+							go func() {
+								if downloadSlots != nil {
+									select {
+									case downloadSlots <- struct{}{}:
+									case <-finished:
+										return
+									}
+									defer func() { <-downloadSlots }()
+								}
+								result := stationResult{stationID: status.StationID, err: c.downloadFile(requestID, status)}
+								select {
+								case results <- result:
+								case <-finished:
+								}
+							}()
 							break
 						}
 					}
@@ -397,7 +733,7 @@ func (c *Client) waitForData(requestID string) error {
 
 		case <-time.After(5 * time.Second):
 			// Periodic check - continue waiting for additional collectors after first download
-			if !firstDownloadTime.IsZero() {
+			if !firstDownloadTime.IsZero() && activeStreams == 0 && len(downloading) == 0 {
 				// If we've been waiting for additional collectors for more than 2 minutes after first download, stop
 				if time.Since(firstDownloadTime) > 2*time.Minute {
 					c.Logger.Info("Completed downloads from %d collectors: %v",
@@ -409,6 +745,19 @@ func (c *Client) waitForData(requestID string) error {
 	}
 }
 
+// timeoutResult is the outcome of a request whose wait for data timed out
+func (c *Client) timeoutResult(downloadedFromStations map[string]bool, failedStations map[string]string) error {
+	if len(downloadedFromStations) > 0 {
+		c.Logger.Info("Timeout reached but successfully downloaded from %d collectors: %v",
+			len(downloadedFromStations), getStationList(downloadedFromStations))
+		return nil
+	}
+	if len(failedStations) > 0 {
+		return fmt.Errorf("timeout waiting for data (10 minutes); %s", formatStationFailures(failedStations))
+	}
+	return fmt.Errorf("timeout waiting for data (10 minutes)")
+}
+
 // waitForDataPolling is a fallback function that polls for data availability
 func (c *Client) waitForDataPolling(requestID string) error {
 	ticker := time.NewTicker(5 * time.Second)
@@ -451,6 +800,7 @@ func (c *Client) waitForDataPolling(requestID string) error {
 						FilePath:  download.FilePath,
 						FileSize:  download.FileSize,
 						StationID: download.StationID,
+						Transfer:  download.Transfer,
 					}
 
 					if err := c.downloadFile(requestID, status); err != nil {
@@ -495,6 +845,7 @@ type AvailableDownload struct {
 	FilePath    string `json:"file_path"`
 	FileSize    int64  `json:"file_size"`
 	CompletedAt string `json:"completed_at"`
+	Transfer    string `json:"transfer"`
 }
 
 // checkAvailableDownloads checks for available downloads from collectors
@@ -543,8 +894,40 @@ func (c *Client) downloadFile(requestID string, status *shared.DataRequestStatus
 		return fmt.Errorf("failed to create download directory: %w", err)
 	}
 
-	// Use ICE WebRTC transfer for all stations (consistent behavior)
-	return c.downloadViaICE(requestID, status)
+	// Files the server has cached are fetched over HTTP so the collector only uploads once,
+	// otherwise transfer peer-to-peer from the collector
+	// Only collectors can send a preview, so files the server has cached aren't fetched from it then
+	var err error
+	if status.Transfer == shared.TransferHTTP && !c.MetadataOnly {
+		err = c.downloadViaHTTP(requestID, status)
+	} else {
+		err = c.downloadViaICE(requestID, status)
+	}
+
+	// Whatever a failed download left behind is incomplete or corrupt; streams clean up their own frames
+	if err != nil && !c.Stream {
+		c.discardPartial(filepath.Join(c.DownloadDir, c.fileName(requestID, status.StationID)))
+	}
+	return err
+}
+
+// discardPartial deletes the file of a failed download, or keeps it as
+// <path>.partial for debugging when KeepPartialDownloads is set
+func (c *Client) discardPartial(path string) {
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	if !c.KeepPartialDownloads {
+		if err := os.Remove(path); err != nil {
+			c.Logger.Warn("Failed to remove partial download %s: %v", path, err)
+		}
+		return
+	}
+	if err := os.Rename(path, path+".partial"); err != nil {
+		c.Logger.Warn("Failed to keep partial download %s: %v", path, err)
+		return
+	}
+	c.Logger.Info("Partial download kept for debugging: %s.partial", path)
 }
 
 // downloadViaICE downloads the file via ICE WebRTC for all stations (consistent behavior)
@@ -553,32 +936,35 @@ func (c *Client) downloadViaICE(requestID string, status *shared.DataRequestStat
 	return c.requestFileViaICE(requestID, status)
 }
 
-// downloadViaHTTP downloads the file via HTTP endpoint with ICE fallback
-func (c *Client) downloadViaHTTP(requestID string, status *shared.DataRequestStatus) error {
-	// Request download URL from API - now includes station ID
-	downloadURL := fmt.Sprintf("%s/api/data/download/%s/%s", c.APIServerURL, requestID, status.StationID)
-	req, err := http.NewRequest("GET", downloadURL, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create download request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+c.authToken)
+// fileName returns the local file name for a station's download, with the
+// extension of the requested format
+func (c *Client) fileName(requestID, stationID string) string {
+	return fmt.Sprintf("%s_%s_data%s", requestID, stationID, convert.Extension(c.Format))
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		c.Logger.Warn("HTTP download failed: %v, trying ICE fallback", err)
-		return c.requestFileViaICE(requestID, status)
+// saveCaptureMetadata writes a collector's capture metadata next to the
+// station's download. Failing to save it doesn't fail the download.
+func (c *Client) saveCaptureMetadata(requestID, stationID string, metadata *models.CaptureMetadata) {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err == nil {
+		path := filepath.Join(c.DownloadDir, metadataFileName(requestID, stationID))
+		if err = os.WriteFile(path, data, 0644); err == nil {
+			c.Logger.Info("Capture metadata saved: %s", path)
+			return
+		}
 	}
-	defer resp.Body.Close()
+	c.Logger.Warn("Failed to save capture metadata for station %s: %v", stationID, err)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		c.Logger.Warn("HTTP download failed with status %d, trying ICE fallback", resp.StatusCode)
-		return c.requestFileViaICE(requestID, status)
-	}
+// downloadViaHTTP downloads the file via HTTP endpoint with ICE fallback.
+// Interrupted downloads are resumed with Range requests, and the file is
+// checked against the server's X-Content-SHA256 header when present.
+func (c *Client) downloadViaHTTP(requestID string, status *shared.DataRequestStatus) error {
+	// Request download URL from API - now includes station ID
+	downloadURL := fmt.Sprintf("%s/api/data/download/%s/%s", c.APIServerURL, requestID, status.StationID)
 
 	// Create output file with station ID to avoid conflicts
-	fileName := fmt.Sprintf("%s_%s_data.npz", requestID, status.StationID)
-	filePath := filepath.Join(c.DownloadDir, fileName)
+	filePath := filepath.Join(c.DownloadDir, c.fileName(requestID, status.StationID))
 
 	file, err := os.Create(filePath)
 	if err != nil {
@@ -586,14 +972,90 @@ func (c *Client) downloadViaHTTP(requestID string, status *shared.DataRequestSta
 	}
 	defer file.Close()
 
-	// Copy response body to file
-	c.Logger.Info("Downloading file from station %s...", status.StationID)
-	bytesWritten, err := io.Copy(file, resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to download file: %w", err)
+	c.Logger.Info("Downloading file from station %s over HTTP...", status.StationID)
+
+	hash := sha256.New()
+	var bytesWritten int64
+	var checksum, captureMetadata string
+	const maxAttempts = 3
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest("GET", downloadURL, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create download request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+		if bytesWritten > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", bytesWritten))
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			if bytesWritten == 0 {
+				c.Logger.Warn("HTTP download failed: %v, trying ICE fallback", err)
+				return c.requestFileViaICE(requestID, status)
+			}
+			if attempt >= maxAttempts {
+				return fmt.Errorf("failed to resume download: %w", err)
+			}
+			c.Logger.Warn("Resuming download at byte %d failed: %v, retrying", bytesWritten, err)
+			continue
+		}
+
+		expected := http.StatusOK
+		if bytesWritten > 0 {
+			expected = http.StatusPartialContent
+		}
+		if resp.StatusCode != expected {
+			resp.Body.Close()
+			if bytesWritten == 0 {
+				c.Logger.Warn("HTTP download failed with status %d, trying ICE fallback", resp.StatusCode)
+				return c.requestFileViaICE(requestID, status)
+			}
+			if shared.Retryable(resp.StatusCode) && attempt < maxAttempts {
+				wait := c.retryPolicy().Delay(resp, attempt)
+				c.Logger.Warn("Resuming download at byte %d returned status %d, retrying in %s", bytesWritten, resp.StatusCode, wait.Round(time.Millisecond))
+				time.Sleep(wait)
+				continue
+			}
+			return fmt.Errorf("failed to resume download: server returned status %d", resp.StatusCode)
+		}
+		if checksum == "" {
+			checksum = resp.Header.Get("X-Content-SHA256")
+		}
+		if captureMetadata == "" {
+			captureMetadata = resp.Header.Get(models.CaptureMetadataHeader)
+		}
+
+		// Copy response body to file
+		n, err := io.Copy(io.MultiWriter(file, hash), resp.Body)
+		resp.Body.Close()
+		bytesWritten += n
+		if err == nil {
+			break
+		}
+		if attempt >= maxAttempts {
+			return fmt.Errorf("failed to download file: %w", err)
+		}
+		c.Logger.Warn("Download interrupted after %d bytes: %v, resuming", bytesWritten, err)
+	}
+
+	if checksum != "" {
+		if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, checksum) {
+			return fmt.Errorf("downloaded file checksum %s does not match %s", sum, checksum)
+		}
 	}
 
 	c.Logger.Info("File downloaded successfully: %s (%d bytes)", filePath, bytesWritten)
+
+	// Collectors older than the capture metadata sidecar don't send it
+	if captureMetadata != "" {
+		if metadata, err := models.ParseCaptureMetadataHeader(captureMetadata); err != nil {
+			c.Logger.Warn("Ignoring capture metadata from station %s: %v", status.StationID, err)
+		} else {
+			c.saveCaptureMetadata(requestID, status.StationID, metadata)
+		}
+	}
 	return nil
 }
 
@@ -603,7 +1065,7 @@ func (c *Client) requestFileViaICE(requestID string, status *shared.DataRequestS
 
 	// Create file transfer request
 	transferReq := models.FileTransferRequest{
-		Parameters: fmt.Sprintf(`{"request_id": "%s", "station_id": "%s"}`, requestID, status.StationID),
+		Parameters: c.sessionParameters(requestID, status.StationID),
 	}
 
 	// Initiate ICE session
@@ -656,23 +1118,66 @@ func (c *Client) initiateICESession(req models.FileTransferRequest) (string, err
 	return response.SessionID, nil
 }
 
+// completeICESession tells the server that a file arrived over an ICE
+// session, so it counts towards the user's usage. The file is already saved,
+// so failing to report it is only logged.
+func (c *Client) completeICESession(sessionID string, received int64) {
+	jsonData, err := json.Marshal(models.FileTransferComplete{SessionID: sessionID, Bytes: received})
+	if err != nil {
+		c.Logger.Warn("Failed to report completed session %s: %v", sessionID, err)
+		return
+	}
+
+	httpReq, err := http.NewRequest("POST", c.APIServerURL+"/api/ice/complete", bytes.NewBuffer(jsonData))
+	if err != nil {
+		c.Logger.Warn("Failed to report completed session %s: %v", sessionID, err)
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+c.authToken)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		c.Logger.Warn("Failed to report completed session %s: %v", sessionID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		// Servers without usage accounting don't know the endpoint
+		c.Logger.Debug("Server didn't record completed session %s: not found", sessionID)
+	case resp.StatusCode != http.StatusOK:
+		c.Logger.Warn("Server returned status %d for completed session %s", resp.StatusCode, sessionID)
+	default:
+		c.Logger.Debug("Reported %d bytes received over session %s", received, sessionID)
+	}
+}
+
+// iceServers fetches the STUN and TURN servers for a transfer from the API
+// server, falling back to the default STUN server
+func (c *Client) iceServers() []webrtc.ICEServer {
+	config, err := shared.FetchICEServers(c.httpClient, c.APIServerURL, c.authToken)
+	if err != nil {
+		c.Logger.Warn("Using default STUN server %s: %v", shared.DefaultSTUNServer, err)
+		return shared.DefaultICEServers()
+	}
+	servers := config.WebRTCServers()
+	c.Logger.Debug("Using %d ICE servers from the API server", len(servers))
+	return servers
+}
+
 // establishWebRTCConnection sets up the WebRTC peer connection for file transfer
 func (c *Client) establishWebRTCConnection(sessionID, requestID, stationID string) error {
 	c.Logger.Debug("=== Starting WebRTC connection for session %s ===", sessionID)
 	
-	// Create WebRTC configuration
+	// Create WebRTC configuration with fresh ICE servers; TURN credentials expire
 	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: []string{"stun:stun.l.google.com:19302"},
-			},
-		},
+		ICEServers: c.iceServers(),
 	}
 
-	c.Logger.Debug("Creating peer connection with STUN server: stun:stun.l.google.com:19302")
-	
-	// Create peer connection
-	peerConnection, err := webrtc.NewPeerConnection(config)
+	// Create peer connection with the configured ICE timeouts
+	peerConnection, err := shared.NewWebRTCAPI(c.ICETimeouts).NewPeerConnection(config)
 	if err != nil {
 		c.Logger.Error("Failed to create peer connection for session %s: %v", sessionID, err)
 		return fmt.Errorf("failed to create peer connection: %w", err)
@@ -680,19 +1185,34 @@ func (c *Client) establishWebRTCConnection(sessionID, requestID, stationID strin
 
 	c.Logger.Debug("Peer connection created successfully for session %s", sessionID)
 
+	// Fail fast when ICE fails or gathers nothing instead of waiting out the transfer timeout
+	transferFailed := make(chan error, 2)
+	var candidateCount int32
+	progress := &transferProgress{}
+
+	// ICE restarts are only tried once the connection was up
+	var established, restarts int32
+
 	// Store peer connection
+	cancelled := make(chan struct{})
 	c.Logger.Debug("establishWebRTCConnection: acquiring lock for peerConnections")
 	c.mu.Lock()
 	c.peerConnections[sessionID] = peerConnection
+	c.sessionCancels[sessionID] = cancelled
 	c.mu.Unlock()
 	c.Logger.Debug("establishWebRTCConnection: released lock for peerConnections")
 
+	// The collector may offer as soon as the session is initiated
+	offerChannel := c.expectOffer(sessionID)
+
 	defer func() {
 		c.Logger.Debug("Closing peer connection for session %s", sessionID)
 		peerConnection.Close()
 		c.Logger.Debug("establishWebRTCConnection: acquiring lock for peerConnections (defer)")
 		c.mu.Lock()
 		delete(c.peerConnections, sessionID)
+		delete(c.sessionCancels, sessionID)
+		delete(c.waitingForOffer, sessionID)
 		c.mu.Unlock()
 		c.Logger.Debug("establishWebRTCConnection: released lock for peerConnections (defer)")
 		c.Logger.Debug("=== Finished WebRTC connection cleanup for session %s ===", sessionID)
@@ -704,10 +1224,31 @@ func (c *Client) establishWebRTCConnection(sessionID, requestID, stationID strin
 		switch connectionState {
 		case webrtc.ICEConnectionStateConnected:
 			c.Logger.Info("ICE connection established for session %s", sessionID)
+			if atomic.SwapInt32(&established, 1) == 1 {
+				c.Logger.Info("ICE connection restored for session %s", sessionID)
+			}
+			progress.connectionUp()
 		case webrtc.ICEConnectionStateDisconnected:
 			c.Logger.Warn("ICE connection disconnected for session %s", sessionID)
+			// It may come back by itself, or be restarted once it fails
+			if c.ICERestarts > 0 {
+				progress.connectionDown()
+			}
 		case webrtc.ICEConnectionStateFailed:
 			c.Logger.Error("ICE connection failed for session %s", sessionID)
+			// An established connection that fails has usually lost its
+			// network path, as when the receiver changes networks; a restart
+			// finds a new one and the transfer carries on
+			attempt := int(atomic.AddInt32(&restarts, 1))
+			if atomic.LoadInt32(&established) == 1 && attempt <= c.ICERestarts {
+				progress.connectionDown()
+				go c.restartICE(peerConnection, sessionID, attempt, cancelled, transferFailed)
+				return
+			}
+			select {
+			case transferFailed <- fmt.Errorf("ICE connection failed"):
+			default:
+			}
 		case webrtc.ICEConnectionStateClosed:
 			c.Logger.Debug("ICE connection closed for session %s", sessionID)
 		}
@@ -726,6 +1267,7 @@ func (c *Client) establishWebRTCConnection(sessionID, requestID, stationID strin
 		}
 
 		c.Logger.Debug("Generated ICE candidate for session %s: %s", sessionID, candidate.String())
+		atomic.AddInt32(&candidateCount, 1)
 		
 		// Send ICE candidate to signaling server
 		if err := c.sendICECandidate(sessionID, candidate); err != nil {
@@ -741,6 +1283,31 @@ func (c *Client) establishWebRTCConnection(sessionID, requestID, stationID strin
 	// Handle incoming data channels from collector
 	peerConnection.OnDataChannel(func(dataChannel *webrtc.DataChannel) {
 		c.Logger.Info("Data channel '%s' created for session %s", dataChannel.Label(), sessionID)
+
+		// Only accept transfer protocols we know how to decode
+		streamChannel := c.Stream && dataChannel.Protocol() == shared.StreamProtocol
+		if !streamChannel && !shared.IsSupportedFileTransferProtocol(dataChannel.Protocol()) {
+			err := fmt.Errorf("unsupported file transfer protocol %q on data channel '%s' (supported: %v)",
+				dataChannel.Protocol(), dataChannel.Label(), shared.SupportedFileTransferProtocols)
+			c.Logger.Error("Rejecting data channel for session %s: %v", sessionID, err)
+			dataChannel.Close()
+			select {
+			case transferFailed <- err:
+			default:
+			}
+			return
+		}
+		// Files are written as chunks arrive, so a lost or reordered chunk would corrupt them;
+		// streams can tolerate dropped frames, but only if allowed and still in order
+		if err := c.checkChannelReliability(dataChannel, streamChannel); err != nil {
+			c.Logger.Error("Rejecting data channel for session %s: %v", sessionID, err)
+			dataChannel.Close()
+			select {
+			case transferFailed <- err:
+			default:
+			}
+			return
+		}
 		c.Logger.Debug("Data channel state: %s, ready state: %s", dataChannel.ReadyState().String(), dataChannel.ReadyState().String())
 		
 		// Add data channel state monitoring
@@ -756,12 +1323,16 @@ func (c *Client) establishWebRTCConnection(sessionID, requestID, stationID strin
 			c.Logger.Error("Data channel error for session %s: %v", sessionID, err)
 		})
 		
-		c.setupFileReception(dataChannel, requestID, stationID, sessionID, fileTransferComplete)
+		if streamChannel {
+			c.setupStreamReception(dataChannel, requestID, stationID, fileTransferComplete, transferFailed)
+			return
+		}
+		c.setupFileReception(dataChannel, requestID, stationID, sessionID, progress, fileTransferComplete, transferFailed, cancelled)
 	})
 
 	// Wait for offer from collector
 	c.Logger.Debug("Waiting for offer from collector for session %s", sessionID)
-	offer, err := c.waitForOffer(sessionID)
+	offer, err := c.waitForOffer(sessionID, offerChannel, offerTimeout, cancelled)
 	if err != nil {
 		c.Logger.Error("Failed to receive offer for session %s: %v", sessionID, err)
 		return fmt.Errorf("failed to get offer: %w", err)
@@ -789,6 +1360,7 @@ func (c *Client) establishWebRTCConnection(sessionID, requestID, stationID strin
 	c.Logger.Debug("Answer created for session %s, SDP length: %d", sessionID, len(answer.SDP))
 
 	// Set local description
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
 	c.Logger.Debug("Setting local description (answer) for session %s", sessionID)
 	if err := peerConnection.SetLocalDescription(answer); err != nil {
 		c.Logger.Error("Failed to set local description for session %s: %v", sessionID, err)
@@ -797,6 +1369,19 @@ func (c *Client) establishWebRTCConnection(sessionID, requestID, stationID strin
 
 	c.Logger.Debug("Local description set successfully for session %s", sessionID)
 
+	// Bound ICE gathering time
+	go func() {
+		if err := shared.AwaitICEGathering(gatherComplete, c.ICETimeouts, func() int {
+			return int(atomic.LoadInt32(&candidateCount))
+		}); err != nil {
+			c.Logger.Error("ICE gathering failed for session %s: %v", sessionID, err)
+			select {
+			case transferFailed <- err:
+			default:
+			}
+		}
+	}()
+
 	// Send answer to signaling server
 	c.Logger.Debug("Sending answer to signaling server for session %s", sessionID)
 	if err := c.sendAnswer(sessionID, answer); err != nil {
@@ -809,9 +1394,14 @@ func (c *Client) establishWebRTCConnection(sessionID, requestID, stationID strin
 	// Wait for file transfer to complete
 	transferComplete := make(chan error, 1)
 
-	// We'll use a context with timeout for the transfer
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	// Streams run until they end; file transfers run while they keep making
+	// progress. A stalled transfer returns an error, which closes the peer connection.
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	transferStalled := make(chan error, 1)
+	if !c.Stream {
+		go c.watchTransfer(sessionID, progress, ctx.Done(), transferStalled)
+	}
 
 	// Create a combined done channel that closes when either transfer completes or context times out
 	combinedDone := make(chan struct{})
@@ -834,29 +1424,70 @@ func (c *Client) establishWebRTCConnection(sessionID, requestID, stationID strin
 		case <-fileTransferComplete:
 			c.Logger.Debug("File transfer completed for session %s", sessionID)
 			transferComplete <- nil
+		case err := <-transferFailed:
+			if errors.Is(err, errFileSkipped) {
+				transferComplete <- err
+				return
+			}
+			c.Logger.Debug("WebRTC connection failed for session %s: %v", sessionID, err)
+			transferComplete <- fmt.Errorf("WebRTC connection failed: %w", err)
+		case err := <-transferStalled:
+			transferComplete <- err
+		case <-cancelled:
+			c.Logger.Info("Transfer cancelled for session %s", sessionID)
+			transferComplete <- errTransferCancelled
 		case <-ctx.Done():
 			c.Logger.Debug("Transfer timed out for session %s", sessionID)
 			transferComplete <- ctx.Err()
 		}
 	}()
 
-	return <-transferComplete
+	if err := <-transferComplete; err != nil {
+		return err
+	}
+	if !c.Stream {
+		_, received, _, _ := progress.snapshot()
+		c.completeICESession(sessionID, received)
+	}
+	return nil
 }
 
-// setupFileReception handles receiving file data through the WebRTC data channel
-func (c *Client) setupFileReception(dataChannel *webrtc.DataChannel, requestID, stationID, sessionID string, transferComplete chan<- struct{}) {
+// setupFileReception handles receiving file data through the WebRTC data
+// channel. Once cancelled is closed nothing more is written; the partial file
+// is closed and left for downloadFile to discard. A file skipped after its
+// preview is reported as errFileSkipped on transferFailed.
+func (c *Client) setupFileReception(dataChannel *webrtc.DataChannel, requestID, stationID, sessionID string, progress *transferProgress, transferComplete chan<- struct{}, transferFailed chan<- error, cancelled <-chan struct{}) {
 	var currentFile *os.File
 	var currentFileSize int64
 	var bytesReceived int64
 	var mu sync.Mutex
 	var completed bool
+	var capture *models.CaptureMetadata
 
-	fileName := fmt.Sprintf("%s_%s_data.npz", requestID, stationID)
+	fileName := c.fileName(requestID, stationID)
 	filePath := filepath.Join(c.DownloadDir, fileName)
 
+	// stopIfCancelled closes the partial file of a cancelled session; mu must be held
+	stopIfCancelled := func() bool {
+		select {
+		case <-cancelled:
+		default:
+			return false
+		}
+		if currentFile != nil {
+			c.Logger.Info("ICE transfer cancelled after %d/%d bytes", bytesReceived, currentFileSize)
+			currentFile.Close()
+			currentFile = nil
+		}
+		return true
+	}
+
 	dataChannel.OnClose(func() {
 		mu.Lock()
 		defer mu.Unlock()
+		if stopIfCancelled() {
+			return
+		}
 		if currentFile != nil && !completed {
 			c.Logger.Error("Data channel closed unexpectedly! Received %d/%d bytes", bytesReceived, currentFileSize)
 			currentFile.Close()
@@ -868,7 +1499,7 @@ func (c *Client) setupFileReception(dataChannel *webrtc.DataChannel, requestID,
 		mu.Lock()
 		defer mu.Unlock()
 
-		if completed {
+		if completed || stopIfCancelled() {
 			return
 		}
 
@@ -880,6 +1511,12 @@ func (c *Client) setupFileReception(dataChannel *webrtc.DataChannel, requestID,
 				return
 			}
 
+			// Metadata-first transfers start with a preview; the file follows only if it's wanted
+			if metadata["type"] == shared.FileMessagePreview {
+				go c.handlePreview(dataChannel, requestID, stationID, msg.Data, transferFailed)
+				return
+			}
+
 			if metadata["type"] == "file-metadata" {
 				size := int64(metadata["size"].(float64))
 				c.Logger.Info("Receiving file via ICE: %s (%d bytes)", fileName, size)
@@ -894,6 +1531,16 @@ func (c *Client) setupFileReception(dataChannel *webrtc.DataChannel, requestID,
 				currentFile = file
 				currentFileSize = size
 				bytesReceived = 0
+				progress.start(size)
+
+				// Collectors embed the capture's metadata in the file header
+				var header struct {
+					Capture *models.CaptureMetadata `json:"capture"`
+				}
+				if err := json.Unmarshal(msg.Data, &header); err != nil {
+					c.Logger.Warn("Ignoring capture metadata from station %s: %v", stationID, err)
+				}
+				capture = header.Capture
 			}
 		} else {
 			// Handle file data
@@ -916,13 +1563,14 @@ func (c *Client) setupFileReception(dataChannel *webrtc.DataChannel, requestID,
 			}
 
 			bytesReceived += int64(n)
-			progress := float64(bytesReceived) / float64(currentFileSize) * 100
+			progress.add(int64(n))
+			percent := float64(bytesReceived) / float64(currentFileSize) * 100
 
-			c.Logger.Debug("Progress: %.2f%% (%d/%d bytes)", progress, bytesReceived, currentFileSize)
+			c.Logger.Debug("Progress: %.2f%% (%d/%d bytes)", percent, bytesReceived, currentFileSize)
 
 			if bytesReceived%1048576 == 0 { // Log every MB
 				c.Logger.Info("ICE transfer progress: %.2f%% (%d/%d bytes)",
-					progress, bytesReceived, currentFileSize)
+					percent, bytesReceived, currentFileSize)
 			}
 
 			// Check if file is complete
@@ -934,6 +1582,9 @@ func (c *Client) setupFileReception(dataChannel *webrtc.DataChannel, requestID,
 				currentFile.Close()
 				currentFile = nil
 				completed = true
+				if capture != nil {
+					c.saveCaptureMetadata(requestID, stationID, capture)
+				}
 				
 				// Signal completion to stop ICE candidate polling
 				c.Logger.Debug("Sending transfer completion signal for session %s", sessionID)
@@ -1019,22 +1670,35 @@ func (c *Client) sendSignal(signal models.ICESignalRequest) error {
 	return nil
 }
 
-// waitForOffer waits for a WebRTC offer from the collector via WebSocket - no HTTP polling
-func (c *Client) waitForOffer(sessionID string) (webrtc.SessionDescription, error) {
+// offerTimeout bounds the wait for a collector's offer
+const offerTimeout = 30 * time.Second
+
+// expectOffer returns the channel the session's next offer is delivered on
+func (c *Client) expectOffer(sessionID string) chan webrtc.SessionDescription {
 	// Create a channel to wait for the offer
 	offerChannel := make(chan webrtc.SessionDescription, 1)
-	c.Logger.Debug("waitForOffer: acquiring lock for waitingForOffer")
+	c.Logger.Debug("expectOffer: acquiring lock for waitingForOffer")
 	c.mu.Lock()
 	c.waitingForOffer[sessionID] = offerChannel
 	c.mu.Unlock()
-	c.Logger.Debug("waitForOffer: released lock for waitingForOffer")
-	
+	c.Logger.Debug("expectOffer: released lock for waitingForOffer")
+	return offerChannel
+}
+
+// waitForOffer waits up to timeout for a WebRTC offer from the collector,
+// delivered via WebSocket on a channel from expectOffer - no HTTP polling
+func (c *Client) waitForOffer(sessionID string, offerChannel chan webrtc.SessionDescription, timeout time.Duration, cancelled <-chan struct{}) (webrtc.SessionDescription, error) {
 	var offer webrtc.SessionDescription
 	select {
 	case offer = <-offerChannel:
 		// Offer received via WebSocket
 		c.Logger.Debug("Received offer for session %s via WebSocket", sessionID)
-	case <-time.After(30 * time.Second):
+	case <-cancelled:
+		c.mu.Lock()
+		delete(c.waitingForOffer, sessionID)
+		c.mu.Unlock()
+		return webrtc.SessionDescription{}, errTransferCancelled
+	case <-time.After(timeout):
 		c.Logger.Debug("waitForOffer: acquiring lock for waitingForOffer (timeout)")
 		c.mu.Lock()
 		delete(c.waitingForOffer, sessionID)
@@ -1065,16 +1729,29 @@ func getStationList(stationMap map[string]bool) []string {
 	return stations
 }
 
+// formatStationFailures describes which stations failed and why, in a stable order
+func formatStationFailures(failures map[string]string) string {
+	stations := make([]string, 0, len(failures))
+	for station := range failures {
+		stations = append(stations, station)
+	}
+	sort.Strings(stations)
+
+	parts := make([]string, 0, len(stations))
+	for _, station := range stations {
+		parts = append(parts, fmt.Sprintf("%s: %s", station, failures[station]))
+	}
+	return "failed stations: " + strings.Join(parts, "; ")
+}
+
 // handleICEOffer processes the ICE offer received via WebSocket
 func (c *Client) handleICEOffer(notification map[string]interface{}) {
-	sessionID, ok := notification["session_id"].(string)
-	if !ok {
-		return
-	}
-	offerSDP, ok := notification["offer_sdp"].(string)
-	if !ok {
+	var offerData shared.ICEOfferNotification
+	if err := shared.DecodePayload(notification, &offerData); err != nil {
+		c.Logger.Error("Failed to decode ICE offer: %v", err)
 		return
 	}
+	sessionID, offerSDP := offerData.SessionID, offerData.OfferSDP
 
 	c.Logger.Debug("Received WebRTC offer for session %s", sessionID)
 	c.Logger.Debug("handleICEOffer: acquiring read lock for waitingForOffer")
@@ -1097,50 +1774,75 @@ func (c *Client) handleICEOffer(notification map[string]interface{}) {
 	}
 }
 
-// handleICECandidate processes the ICE candidate received via WebSocket
-func (c *Client) handleICECandidate(notification map[string]interface{}) {
-	sessionID, ok := notification["session_id"].(string)
-	if !ok {
+// errTransferCancelled marks a transfer stopped because the server cancelled its session
+var errTransferCancelled = errors.New("transfer cancelled")
+
+// handleSessionCancelled stops the transfer of a session whose request was
+// cancelled. Sessions without a transfer in progress are ignored.
+func (c *Client) handleSessionCancelled(notification map[string]interface{}) {
+	var cancelled shared.SessionCancelledNotification
+	if err := shared.DecodePayload(notification, &cancelled); err != nil {
+		c.Logger.Error("Failed to decode session cancellation: %v", err)
 		return
 	}
 
-	c.Logger.Debug("handleICECandidate: acquiring read lock for peerConnections")
-	c.mu.RLock()
-	pc, exists := c.peerConnections[sessionID]
-	c.mu.RUnlock()
-	c.Logger.Debug("handleICECandidate: released read lock for peerConnections")
-
-	if !exists {
-		c.Logger.Warn("No peer connection found for session %s to add ICE candidate", sessionID)
+	if !c.stopSession(cancelled.SessionID) {
+		c.Logger.Debug("No transfer in progress for cancelled session %s", cancelled.SessionID)
 		return
 	}
+	c.Logger.Warn("Request %s was cancelled, stopping the transfer of session %s", cancelled.RequestID, cancelled.SessionID)
+}
 
-	// The candidate in the payload is a string that needs to be unmarshaled
-	candidate, ok := notification["candidate"].(string)
-	if !ok {
-		c.Logger.Error("Invalid ICE candidate format in notification")
+// handleSessionFailed stops the transfer of a session the server gave up on,
+// such as one still waiting for an offer after ICE_SESSION_PENDING_TTL_SECONDS
+func (c *Client) handleSessionFailed(notification map[string]interface{}) {
+	var failed shared.SessionFailedNotification
+	if err := shared.DecodePayload(notification, &failed); err != nil {
+		c.Logger.Error("Failed to decode session failure: %v", err)
 		return
 	}
-	sdpmLineIndex, ok := notification["sdpMLineIndex"].(float64)
-	if !ok {
-		c.Logger.Error("Invalid sdpMLineIndex format in notification")
+
+	if !c.stopSession(failed.SessionID) {
+		c.Logger.Debug("No transfer in progress for failed session %s", failed.SessionID)
 		return
 	}
-	sdpmid, ok := notification["sdpMid"].(string)
-	if !ok {
-		c.Logger.Error("Invalid sdpMid format in notification")
+	c.Logger.Warn("Server failed session %s: %s", failed.SessionID, failed.Reason)
+}
+
+// stopSession stops a session's transfer, reporting whether one was in progress
+func (c *Client) stopSession(sessionID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cancel, exists := c.sessionCancels[sessionID]
+	if exists {
+		close(cancel)
+		delete(c.sessionCancels, sessionID)
+	}
+	return exists
+}
+
+// handleICECandidate processes the ICE candidate received via WebSocket
+func (c *Client) handleICECandidate(notification map[string]interface{}) {
+	var candidate shared.ICECandidateNotification
+	if err := shared.DecodePayload(notification, &candidate); err != nil {
+		c.Logger.Error("Ignoring malformed ICE candidate: %v", err)
 		return
 	}
+	sessionID := candidate.SessionID
 
-	sdpMLineIndexUint16 := uint16(sdpmLineIndex)
+	c.Logger.Debug("handleICECandidate: acquiring read lock for peerConnections")
+	c.mu.RLock()
+	pc, exists := c.peerConnections[sessionID]
+	c.mu.RUnlock()
+	c.Logger.Debug("handleICECandidate: released read lock for peerConnections")
 
-	candidateInit := webrtc.ICECandidateInit{
-		Candidate:     candidate,
-		SDPMLineIndex: &sdpMLineIndexUint16,
-		SDPMid:        &sdpmid,
+	if !exists {
+		c.Logger.Warn("No peer connection found for session %s to add ICE candidate", sessionID)
+		return
 	}
 
-	if err := pc.AddICECandidate(candidateInit); err != nil {
+	if err := pc.AddICECandidate(candidate.CandidateInit()); err != nil {
 		c.Logger.Error("Failed to add ICE candidate for session %s: %v", sessionID, err)
 	} else {
 		c.Logger.Debug("Successfully added ICE candidate for session %s", sessionID)
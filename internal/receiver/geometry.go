@@ -0,0 +1,80 @@
+package receiver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// stationGeometry is the server's rating of the stations a request would go to
+type stationGeometry struct {
+	Stations []struct {
+		StationID string `json:"station_id"`
+	} `json:"stations"`
+	MissingLocations []string `json:"missing_locations"`
+	GDOP             *float64 `json:"gdop"`
+	MinBaseline      *float64 `json:"min_baseline_m"`
+	MaxBaseline      *float64 `json:"max_baseline_m"`
+	Score            float64  `json:"score"`
+	Usable           bool     `json:"usable"`
+	Reason           string   `json:"reason"`
+}
+
+// checkStationGeometry asks the server whether the stations a request would be
+// sent to can locate a transmitter by TDOA. With GeometryCheck "warn" an
+// unusable set is only logged, with "refuse" it is an error. A server that
+// can't rate the stations doesn't hold the request back.
+func (c *Client) checkStationGeometry() error {
+	if c.GeometryCheck != "warn" && c.GeometryCheck != "refuse" {
+		return nil
+	}
+
+	req, err := http.NewRequest("GET", c.APIServerURL+"/api/stations/geometry", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.authToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.Logger.Warn("Could not check station geometry: %v", err)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		c.Logger.Warn("Server can't rate station geometry, sending the request unchecked")
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		c.Logger.Warn("Could not check station geometry: server returned status %d", resp.StatusCode)
+		return nil
+	}
+
+	var geometry stationGeometry
+	if err := json.NewDecoder(resp.Body).Decode(&geometry); err != nil {
+		c.Logger.Warn("Could not check station geometry: %v", err)
+		return nil
+	}
+
+	stations := make([]string, len(geometry.Stations))
+	for i, station := range geometry.Stations {
+		stations[i] = station.StationID
+	}
+	if len(geometry.MissingLocations) > 0 {
+		c.Logger.Warn("Stations without a known location: %s", strings.Join(geometry.MissingLocations, ", "))
+	}
+
+	if geometry.Usable {
+		c.Logger.Info("Station geometry of %s is usable (GDOP %.1f, score %.2f, baselines %.0f-%.0f m)",
+			strings.Join(stations, ", "), *geometry.GDOP, geometry.Score, *geometry.MinBaseline, *geometry.MaxBaseline)
+		return nil
+	}
+
+	if c.GeometryCheck == "refuse" {
+		return fmt.Errorf("stations can't give a usable TDOA fix: %s", geometry.Reason)
+	}
+	c.Logger.Warn("Stations may not give a usable TDOA fix: %s", geometry.Reason)
+	return nil
+}
@@ -0,0 +1,70 @@
+package receiver
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"argus-sdr/internal/models"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// iceRestartOfferTimeout bounds the wait for the collector's ice-restart offer
+const iceRestartOfferTimeout = 15 * time.Second
+
+// restartICE asks the collector to restart ICE for a session whose
+// established connection failed, and answers its ice-restart offer. The peer
+// connection, its data channel and the partly received file are kept, so the
+// transfer carries on where it stopped once ICE connects again. If the
+// restart can't be negotiated the transfer fails on transferFailed.
+func (c *Client) restartICE(peerConnection *webrtc.PeerConnection, sessionID string, attempt int, cancelled <-chan struct{}, transferFailed chan<- error) {
+	c.Logger.Warn("Restarting ICE for session %s (attempt %d of %d)", sessionID, attempt, c.ICERestarts)
+
+	err := c.negotiateICERestart(peerConnection, sessionID, cancelled)
+	if errors.Is(err, errTransferCancelled) {
+		return
+	}
+	if err != nil {
+		c.Logger.Error("ICE restart for session %s failed: %v", sessionID, err)
+		select {
+		case transferFailed <- fmt.Errorf("ICE connection failed and could not be restarted: %w", err):
+		default:
+		}
+		return
+	}
+	c.Logger.Info("ICE restart for session %s negotiated, checking connectivity", sessionID)
+}
+
+// negotiateICERestart requests an ice-restart offer for a session and answers it
+func (c *Client) negotiateICERestart(peerConnection *webrtc.PeerConnection, sessionID string, cancelled <-chan struct{}) error {
+	// The offer may come back before the request does
+	offerChannel := c.expectOffer(sessionID)
+	if err := c.sendSignal(models.ICESignalRequest{SessionID: sessionID, Type: "restart"}); err != nil {
+		c.mu.Lock()
+		delete(c.waitingForOffer, sessionID)
+		c.mu.Unlock()
+		return fmt.Errorf("failed to request ICE restart: %w", err)
+	}
+
+	offer, err := c.waitForOffer(sessionID, offerChannel, iceRestartOfferTimeout, cancelled)
+	if err != nil {
+		return err
+	}
+
+	// An offer with new ICE credentials restarts ICE on this side too
+	if err := peerConnection.SetRemoteDescription(offer); err != nil {
+		return fmt.Errorf("failed to set remote description: %w", err)
+	}
+	answer, err := peerConnection.CreateAnswer(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create answer: %w", err)
+	}
+	if err := peerConnection.SetLocalDescription(answer); err != nil {
+		return fmt.Errorf("failed to set local description: %w", err)
+	}
+	if err := c.sendAnswer(sessionID, answer); err != nil {
+		return fmt.Errorf("failed to send answer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package receiver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"argus-sdr/internal/convert"
+	"argus-sdr/internal/models"
+)
+
+// ManifestVersion is bumped when Manifest changes incompatibly
+const ManifestVersion = 1
+
+// Manifest indexes everything a request left in the download directory, so
+// downstream tooling has one file to start from. File names are relative to
+// the manifest's directory.
+type Manifest struct {
+	Version          int               `json:"version"`
+	RequestID        string            `json:"request_id"`
+	ReceiverID       string            `json:"receiver_id"`
+	Format           string            `json:"format"`
+	Image            string            `json:"image,omitempty"`
+	GeneratedAt      time.Time         `json:"generated_at"`
+	ExpectedStations int               `json:"expected_stations"`
+	Stations         []ManifestStation `json:"stations"`
+	FailedStations   []ManifestFailure `json:"failed_stations"`
+
+	// SkippedStations are the stations whose file was skipped after its
+	// preview (see Client.MetadataOnly)
+	SkippedStations []ManifestSkipped `json:"skipped_stations,omitempty"`
+}
+
+// ManifestStation describes one station's downloaded file
+type ManifestStation struct {
+	StationID    string                  `json:"station_id"`
+	File         string                  `json:"file"`
+	FileSize     int64                   `json:"file_size"`
+	SHA256       string                  `json:"sha256"`
+	MetadataFile string                  `json:"metadata_file,omitempty"`
+	Capture      *models.CaptureMetadata `json:"capture,omitempty"`
+}
+
+// ManifestSkipped is a station whose file was only previewed
+type ManifestSkipped struct {
+	StationID   string `json:"station_id"`
+	PreviewFile string `json:"preview_file"`
+}
+
+// ManifestFailure records why a station didn't deliver
+type ManifestFailure struct {
+	StationID string `json:"station_id"`
+	Error     string `json:"error"`
+}
+
+// manifestFileName returns the local file name of a request's manifest
+func manifestFileName(requestID string) string {
+	return fmt.Sprintf("%s_manifest.json", requestID)
+}
+
+// metadataFileName returns the local file name of a station's capture metadata sidecar
+func metadataFileName(requestID, stationID string) string {
+	return fmt.Sprintf("%s_%s_metadata.json", requestID, stationID)
+}
+
+// writeManifest summarizes a request's downloads, skipped files and failures
+// in the download directory. Requests nothing came back for get no manifest.
+func (c *Client) writeManifest(requestID string, expectedStations int, downloaded, skipped map[string]bool, failed map[string]string) {
+	if len(downloaded) == 0 && len(skipped) == 0 && len(failed) == 0 {
+		return
+	}
+
+	format := c.Format
+	if format == "" {
+		format = convert.FormatNPZ
+	}
+	manifest := Manifest{
+		Version:          ManifestVersion,
+		RequestID:        requestID,
+		ReceiverID:       c.ID,
+		Format:           format,
+		Image:            c.Image,
+		GeneratedAt:      time.Now().UTC(),
+		ExpectedStations: expectedStations,
+		Stations:         []ManifestStation{},
+		FailedStations:   []ManifestFailure{},
+	}
+
+	for _, stationID := range getStationList(downloaded) {
+		station, err := c.manifestStation(requestID, stationID)
+		if err != nil {
+			c.Logger.Warn("Leaving station %s out of the manifest: %v", stationID, err)
+			continue
+		}
+		manifest.Stations = append(manifest.Stations, station)
+	}
+	for _, stationID := range getStationList(skipped) {
+		manifest.SkippedStations = append(manifest.SkippedStations, ManifestSkipped{StationID: stationID, PreviewFile: previewFileName(requestID, stationID)})
+	}
+	for stationID, reason := range failed {
+		manifest.FailedStations = append(manifest.FailedStations, ManifestFailure{StationID: stationID, Error: reason})
+	}
+	sort.Slice(manifest.Stations, func(i, j int) bool { return manifest.Stations[i].StationID < manifest.Stations[j].StationID })
+	sort.Slice(manifest.SkippedStations, func(i, j int) bool {
+		return manifest.SkippedStations[i].StationID < manifest.SkippedStations[j].StationID
+	})
+	sort.Slice(manifest.FailedStations, func(i, j int) bool {
+		return manifest.FailedStations[i].StationID < manifest.FailedStations[j].StationID
+	})
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err == nil {
+		path := filepath.Join(c.DownloadDir, manifestFileName(requestID))
+		if err = os.WriteFile(path, data, 0644); err == nil {
+			c.Logger.Info("Manifest written: %s (%d stations, %d failed)", path, len(manifest.Stations), len(manifest.FailedStations))
+			return
+		}
+	}
+	c.Logger.Error("Failed to write manifest for request %s: %v", requestID, err)
+}
+
+// manifestStation describes a station's downloaded file and its capture metadata
+func (c *Client) manifestStation(requestID, stationID string) (ManifestStation, error) {
+	station := ManifestStation{
+		StationID: stationID,
+		File:      c.fileName(requestID, stationID),
+	}
+
+	file, err := os.Open(filepath.Join(c.DownloadDir, station.File))
+	if err != nil {
+		return station, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if station.FileSize, err = io.Copy(hash, file); err != nil {
+		return station, err
+	}
+	station.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	// Collectors older than the metadata sidecar don't send one
+	metadataFile := metadataFileName(requestID, stationID)
+	data, err := os.ReadFile(filepath.Join(c.DownloadDir, metadataFile))
+	if err != nil {
+		return station, nil
+	}
+	var capture models.CaptureMetadata
+	if err := json.Unmarshal(data, &capture); err != nil {
+		c.Logger.Warn("Ignoring unreadable capture metadata %s: %v", metadataFile, err)
+		return station, nil
+	}
+	station.MetadataFile = metadataFile
+	station.Capture = &capture
+	return station, nil
+}
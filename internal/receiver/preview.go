@@ -0,0 +1,124 @@
+package receiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"argus-sdr/internal/shared"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// triageTimeout bounds a TriageCommand run; it stays well within the
+// collector's wait for an answer to the preview
+const triageTimeout = time.Minute
+
+// errFileSkipped marks a metadata-first transfer whose file the receiver
+// decided not to fetch after its preview
+var errFileSkipped = errors.New("file skipped after its preview")
+
+// previewFileName returns the local file name of a station's file preview
+func previewFileName(requestID, stationID string) string {
+	return fmt.Sprintf("%s_%s_preview.json", requestID, stationID)
+}
+
+// sessionParameters returns the parameters of an ICE session for a
+// station's file, asking for a preview first with MetadataOnly
+func (c *Client) sessionParameters(requestID, stationID string) string {
+	parameters := map[string]interface{}{
+		"request_id": requestID,
+		"station_id": stationID,
+	}
+	if c.MetadataOnly {
+		parameters["metadata_only"] = true
+	}
+	data, _ := json.Marshal(parameters)
+	return string(data)
+}
+
+// handlePreview saves a file's preview, decides whether to fetch the file
+// and answers the collector. It reports errFileSkipped on skipped when the
+// file isn't wanted. It runs TriageCommand, so it must not block the data
+// channel's message handler.
+func (c *Client) handlePreview(dataChannel *webrtc.DataChannel, requestID, stationID string, data []byte, skipped chan<- error) {
+	var preview shared.FilePreview
+	if err := json.Unmarshal(data, &preview); err != nil {
+		c.Logger.Error("Failed to decode preview from station %s: %v", stationID, err)
+		return
+	}
+	c.Logger.Info("Received preview of %s from station %s (%d bytes, %d arrays)", preview.Filename, stationID, preview.Size, len(preview.Arrays))
+
+	// Keep the collector's message as is, including anything newer collectors add
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err == nil {
+		path := filepath.Join(c.DownloadDir, previewFileName(requestID, stationID))
+		if err := os.WriteFile(path, indented.Bytes(), 0644); err != nil {
+			c.Logger.Warn("Failed to save preview from station %s: %v", stationID, err)
+		} else {
+			c.Logger.Info("Preview saved: %s", path)
+		}
+	}
+
+	decision := shared.FileDecision{Type: shared.FileMessageSkip}
+	if c.triage(stationID, data) {
+		decision.Type = shared.FileMessageFetch
+	}
+	message, _ := json.Marshal(decision)
+	if err := dataChannel.SendText(string(message)); err != nil {
+		c.Logger.Error("Failed to answer preview from station %s: %v", stationID, err)
+		return
+	}
+
+	if decision.Type == shared.FileMessageSkip {
+		// The connection closes once the skip is reported, so let the answer
+		// reach the collector first; the collector may close the channel itself
+		for dataChannel.BufferedAmount() > 0 && dataChannel.ReadyState() == webrtc.DataChannelStateOpen {
+			time.Sleep(10 * time.Millisecond)
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		select {
+		case skipped <- errFileSkipped:
+		default:
+		}
+	}
+}
+
+// triage reports whether to fetch a file after its preview: only if
+// TriageCommand is set and exits with status 0 when given the preview on its
+// standard input
+func (c *Client) triage(stationID string, preview []byte) bool {
+	args := strings.Fields(c.TriageCommand)
+	if len(args) == 0 {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), triageTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(preview)
+	output, err := cmd.CombinedOutput()
+	if len(output) > 0 {
+		c.Logger.Debug("Triage command output for station %s: %s", stationID, strings.TrimSpace(string(output)))
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		c.Logger.Info("Triage command accepted the file of station %s", stationID)
+		return true
+	case errors.As(err, &exitErr) && ctx.Err() == nil:
+		c.Logger.Info("Triage command rejected the file of station %s (exit status %d)", stationID, exitErr.ExitCode())
+	default:
+		c.Logger.Warn("Triage command failed for station %s, skipping its file: %v", stationID, err)
+	}
+	return false
+}
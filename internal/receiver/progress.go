@@ -0,0 +1,180 @@
+package receiver
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// transferHeaderTimeout bounds the wait for a collector to announce its file
+// once the WebRTC connection is being set up
+const transferHeaderTimeout = 2 * time.Minute
+
+// sctpMaxRetransmitTimeout is the longest a WebRTC sender waits between
+// retransmissions, pion's default
+const sctpMaxRetransmitTimeout = 60 * time.Second
+
+// transferProgress tracks a WebRTC file transfer so stalled ones can be aborted
+type transferProgress struct {
+	mu       sync.Mutex
+	size     int64     // advertised file size
+	received int64     // bytes written so far
+	started  time.Time // when the file header arrived; zero before that
+	lastData time.Time // when the header or the latest chunk arrived
+
+	downSince time.Time     // when the connection went down; zero while it is up
+	downFor   time.Duration // how long the connection was down before downSince
+}
+
+// start records the file header
+func (p *transferProgress) start(size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.size = size
+	p.received = 0
+	p.started = time.Now()
+	p.lastData = p.started
+}
+
+// add records received bytes
+func (p *transferProgress) add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.received += n
+	p.lastData = time.Now()
+}
+
+// connectionDown records that the ICE connection went down
+func (p *transferProgress) connectionDown() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.downSince.IsZero() {
+		p.downSince = time.Now()
+	}
+}
+
+// connectionUp records that the ICE connection is up again. The idle clock
+// starts over, but not right away: the sender's SCTP backed off its
+// retransmissions while nothing got through, so it may stay quiet for about
+// as long again before it resends.
+func (p *transferProgress) connectionUp() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.downSince.IsZero() {
+		return
+	}
+	now := time.Now()
+	p.downFor += now.Sub(p.downSince)
+	p.downSince = time.Time{}
+	if !p.started.IsZero() {
+		quiet := now.Sub(p.lastData)
+		if quiet > sctpMaxRetransmitTimeout {
+			quiet = sctpMaxRetransmitTimeout
+		}
+		p.lastData = now.Add(quiet)
+	}
+}
+
+// outage reports whether the connection is down and how long it has been
+// down in total
+func (p *transferProgress) outage() (bool, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.downSince.IsZero() {
+		return false, p.downFor
+	}
+	return true, p.downFor + time.Since(p.downSince)
+}
+
+// snapshot returns the advertised size, bytes received, start time and time of the latest data
+func (p *transferProgress) snapshot() (int64, int64, time.Time, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size, p.received, p.started, p.lastData
+}
+
+// transferDeadline is how long a file of size bytes may take at
+// MinTransferThroughput, plus one stall window of slack
+func (c *Client) transferDeadline(size int64) time.Duration {
+	return time.Duration(size/c.MinTransferThroughput)*time.Second + c.TransferStallWindow
+}
+
+// watchTransfer reports a transfer that is no longer making progress on
+// stalled: no file header within transferHeaderTimeout, no chunk for
+// TransferIdleTimeout, average throughput below MinTransferThroughput over the
+// last TransferStallWindow, or no completion within transferDeadline. While
+// the ICE connection is down and may still be restarted it is left to ICE to
+// restore or fail, and the time it was down extends the deadline. It
+// returns when done is closed.
+func (c *Client) watchTransfer(sessionID string, progress *transferProgress, done <-chan struct{}, stalled chan<- error) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	setupStarted := time.Now()
+	var deadline time.Time
+	var samples []int64 // bytes received at each tick, newest last
+
+	report := func(err error) {
+		c.Logger.Error("Aborting transfer for session %s: %v", sessionID, err)
+		select {
+		case stalled <- err:
+		default:
+		}
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		size, received, started, lastData := progress.snapshot()
+		if started.IsZero() {
+			if time.Since(setupStarted) > transferHeaderTimeout {
+				report(fmt.Errorf("collector did not start sending a file within %v", transferHeaderTimeout))
+				return
+			}
+			continue
+		}
+
+		// lastData is ahead while a restored connection waits for the sender to resend
+		down, downFor := progress.outage()
+		if down || time.Now().Before(lastData) {
+			samples = nil
+			continue
+		}
+
+		// The data channel can stay open while nothing arrives on it
+		if idle := time.Since(lastData); c.TransferIdleTimeout > 0 && idle > c.TransferIdleTimeout {
+			report(fmt.Errorf("transfer stalled: no data for %v (%d/%d bytes received)", idle.Round(time.Second), received, size))
+			return
+		}
+
+		if c.MinTransferThroughput <= 0 {
+			continue
+		}
+
+		if deadline.IsZero() {
+			deadline = started.Add(c.transferDeadline(size))
+			c.Logger.Debug("Transfer for session %s of %d bytes must finish by %s", sessionID, size, deadline.Format(time.RFC3339))
+		}
+		if time.Now().After(deadline.Add(downFor)) {
+			report(fmt.Errorf("transfer timed out after %v with %d/%d bytes received", c.transferDeadline(size)+downFor, received, size))
+			return
+		}
+
+		window := int(c.TransferStallWindow / time.Second)
+		samples = append(samples, received)
+		if len(samples) <= window {
+			continue
+		}
+		samples = samples[len(samples)-window-1:]
+		rate := (samples[window] - samples[0]) / int64(window)
+		if rate < c.MinTransferThroughput {
+			report(fmt.Errorf("transfer stalled: %.1f KB/s over the last %v is below the minimum of %.1f KB/s (%d/%d bytes received)",
+				float64(rate)/1024, c.TransferStallWindow, float64(c.MinTransferThroughput)/1024, received, size))
+			return
+		}
+	}
+}
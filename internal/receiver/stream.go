@@ -0,0 +1,242 @@
+package receiver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"argus-sdr/internal/convert"
+	"argus-sdr/internal/models"
+	"argus-sdr/internal/shared"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// StreamFrameRecord is a line of a stream's frame index,
+// <request_id>_<station_id>_frames.jsonl in the download directory
+type StreamFrameRecord struct {
+	Sequence   int                     `json:"sequence"`
+	File       string                  `json:"file"`
+	FileSize   int64                   `json:"file_size"`
+	ReceivedAt time.Time               `json:"received_at"`
+	Capture    *models.CaptureMetadata `json:"capture,omitempty"`
+}
+
+// stationResult is how a station's stream or download ended
+type stationResult struct {
+	stationID string
+	err       error
+}
+
+// frameFileName returns the local file name of a stream frame
+func (c *Client) frameFileName(requestID, stationID string, sequence int) string {
+	return fmt.Sprintf("%s_%s_frame%06d%s", requestID, stationID, sequence, convert.Extension(c.Format))
+}
+
+// setupStreamReception consumes a station's capture stream. Each frame is
+// written to the download directory, recorded in the frame index and then
+// acknowledged, so the collector never gets more than shared.StreamWindow
+// frames ahead of the disk. The receiver stops the stream after StreamFrames
+// frames or StreamDuration, whichever comes first. On a partially reliable
+// channel a frame that loses data is discarded, and the stop message is
+// repeated with each frame that still arrives, since it may be dropped too.
+func (c *Client) setupStreamReception(dataChannel *webrtc.DataChannel, requestID, stationID string, streamComplete chan<- struct{}, streamFailed chan<- error) {
+	var mu sync.Mutex
+	var currentFile *os.File
+	var header shared.StreamMessage
+	var bytesReceived int64
+	var frames int
+	var stopSent, ended bool
+	var skipping bool // discarding the data of a frame that lost some
+	var durationTimer *time.Timer
+	reliable := shared.IsReliableOrdered(dataChannel)
+
+	indexPath := filepath.Join(c.DownloadDir, fmt.Sprintf("%s_%s_frames.jsonl", requestID, stationID))
+
+	// send marshals a stream message to the collector; mu must be held
+	send := func(message shared.StreamMessage) {
+		data, err := json.Marshal(message)
+		if err == nil {
+			err = dataChannel.SendText(string(data))
+		}
+		if err != nil {
+			c.Logger.Warn("Failed to send %s to station %s: %v", message.Type, stationID, err)
+		}
+	}
+	// stop asks the collector to end the stream; mu must be held
+	stop := func() {
+		if stopSent || ended {
+			return
+		}
+		stopSent = true
+		c.Logger.Info("Stopping stream from station %s after %d frames", stationID, frames)
+		send(shared.StreamMessage{Type: shared.StreamMessageStop})
+	}
+	// finish reports how the stream ended; mu must be held
+	finish := func(err error) {
+		ended = true
+		if durationTimer != nil {
+			durationTimer.Stop()
+		}
+		if err != nil && frames == 0 {
+			select {
+			case streamFailed <- err:
+			default:
+			}
+			return
+		}
+		select {
+		case streamComplete <- struct{}{}:
+		default:
+		}
+	}
+	// completeFrame indexes and acknowledges the frame just received; mu must be held
+	completeFrame := func() {
+		if err := currentFile.Close(); err != nil {
+			c.Logger.Error("Failed to close frame %d from station %s: %v", header.Sequence, stationID, err)
+		}
+		record := StreamFrameRecord{
+			Sequence:   header.Sequence,
+			File:       filepath.Base(currentFile.Name()),
+			FileSize:   bytesReceived,
+			ReceivedAt: time.Now().UTC(),
+			Capture:    header.Capture,
+		}
+		currentFile = nil
+		frames++
+
+		if err := appendJSONLine(indexPath, record); err != nil {
+			c.Logger.Warn("Failed to index frame %d from station %s: %v", record.Sequence, stationID, err)
+		}
+		c.Logger.Info("Received frame %d from station %s (%d bytes)", record.Sequence, stationID, record.FileSize)
+
+		send(shared.StreamMessage{Type: shared.StreamMessageAck, Sequence: record.Sequence})
+		if stopSent && !reliable {
+			send(shared.StreamMessage{Type: shared.StreamMessageStop})
+		}
+		if c.StreamFrames > 0 && frames >= c.StreamFrames {
+			stop()
+		}
+	}
+	// discardFrame drops the frame being received; mu must be held
+	discardFrame := func(reason string) {
+		c.Logger.Warn("Frame %d from station %s %s, discarding it", header.Sequence, stationID, reason)
+		currentFile.Close()
+		c.discardPartial(currentFile.Name())
+		currentFile = nil
+	}
+
+	if c.StreamDuration > 0 {
+		mu.Lock()
+		durationTimer = time.AfterFunc(c.StreamDuration, func() {
+			mu.Lock()
+			defer mu.Unlock()
+			stop()
+		})
+		mu.Unlock()
+	}
+
+	dataChannel.OnClose(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if currentFile != nil {
+			currentFile.Close()
+			c.discardPartial(currentFile.Name())
+			currentFile = nil
+		}
+		if !ended {
+			c.Logger.Error("Stream from station %s closed without an end message after %d frames", stationID, frames)
+			finish(fmt.Errorf("stream closed before it ended"))
+		}
+	})
+
+	dataChannel.OnMessage(func(msg webrtc.DataChannelMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if ended {
+			return
+		}
+
+		if !msg.IsString {
+			if currentFile == nil {
+				if !skipping {
+					c.Logger.Error("Received stream data from station %s but no frame was announced", stationID)
+				}
+				return
+			}
+			// More data than announced means the next frame's header was dropped
+			if bytesReceived+int64(len(msg.Data)) > header.Size {
+				discardFrame("ran past its size")
+				skipping = true
+				return
+			}
+			n, err := currentFile.Write(msg.Data)
+			if err != nil {
+				c.Logger.Error("Failed to write frame %d from station %s: %v", header.Sequence, stationID, err)
+				return
+			}
+			bytesReceived += int64(n)
+			if bytesReceived >= header.Size {
+				completeFrame()
+			}
+			return
+		}
+
+		var message shared.StreamMessage
+		if err := json.Unmarshal(msg.Data, &message); err != nil {
+			c.Logger.Error("Failed to unmarshal stream message from station %s: %v", stationID, err)
+			return
+		}
+
+		switch message.Type {
+		case shared.StreamMessageFrame:
+			if currentFile != nil {
+				discardFrame("was cut short")
+			}
+			skipping = false
+			file, err := os.Create(filepath.Join(c.DownloadDir, c.frameFileName(requestID, stationID, message.Sequence)))
+			if err != nil {
+				c.Logger.Error("Failed to create frame file: %v", err)
+				currentFile = nil
+				return
+			}
+			currentFile = file
+			header = message
+			bytesReceived = 0
+			if header.Size <= 0 {
+				completeFrame()
+			}
+
+		case shared.StreamMessageEnd:
+			var err error
+			if message.Error != "" {
+				c.Logger.Error("Stream from station %s ended after %d frames: %s", stationID, message.Frames, message.Error)
+				err = fmt.Errorf("stream ended: %s", message.Error)
+			} else {
+				c.Logger.Info("Stream from station %s ended after %d frames (%s)", stationID, message.Frames, message.Reason)
+			}
+			finish(err)
+		}
+	})
+}
+
+// appendJSONLine appends v to a JSON Lines file
+func appendJSONLine(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,204 @@
+// Package safehttp provides HTTP clients for requests the server makes to
+// URLs it doesn't control (collector download URLs, receiver webhooks), so
+// they can't be pointed at the server's internal network
+package safehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrBlockedAddress is returned for targets that resolve to loopback,
+	// private, link-local or other internal addresses
+	ErrBlockedAddress = errors.New("destination address is not allowed")
+	// ErrTooManyRedirects is returned when a response redirects more than Options.MaxRedirects times
+	ErrTooManyRedirects = errors.New("too many redirects")
+	// ErrResponseTooLarge is returned while reading a body larger than Options.MaxResponseBytes
+	ErrResponseTooLarge = errors.New("response body too large")
+)
+
+// Options configure a safe client
+type Options struct {
+	Timeout time.Duration
+	// AllowedNetworks are internal ranges that may be reached anyway, e.g. a collector LAN
+	AllowedNetworks []*net.IPNet
+	// AllowPrivate disables address checks entirely (for testing)
+	AllowPrivate bool
+	// MaxRedirects is how many redirects are followed; 0 returns the redirect response itself
+	MaxRedirects int
+	// MaxResponseBytes bounds response bodies; 0 means unlimited
+	MaxResponseBytes int64
+}
+
+// NewClient returns an HTTP client that refuses to connect to blocked
+// addresses. The check runs on the resolved address of every connection,
+// including redirects, so DNS names that resolve to internal addresses are
+// caught too.
+func NewClient(opts Options) *http.Client {
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if !opts.AllowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			return opts.checkIP(net.ParseIP(host))
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would make the connection on our behalf, bypassing the dial check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: &limitTransport{base: transport, max: opts.MaxResponseBytes},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if opts.MaxRedirects == 0 {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > opts.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			return checkScheme(req.URL)
+		},
+	}
+}
+
+// ValidateURL checks that rawURL is an absolute http(s) URL without
+// credentials whose host doesn't resolve to a blocked address. Clients from
+// NewClient check again when connecting, since DNS answers can change.
+func ValidateURL(ctx context.Context, rawURL string, opts Options) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if err := checkScheme(u); err != nil {
+		return err
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("URL has no host")
+	}
+	if u.User != nil {
+		return fmt.Errorf("URL must not contain credentials")
+	}
+	if opts.AllowPrivate {
+		return nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", u.Hostname(), err)
+	}
+	for _, ip := range ips {
+		if err := opts.checkIP(ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseNetworks parses IP addresses and CIDRs for Options.AllowedNetworks
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range values {
+		if ip := net.ParseIP(value); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: must be an IP address or CIDR", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// checkIP rejects internal addresses that aren't explicitly allowed
+func (o Options) checkIP(ip net.IP) error {
+	if ip == nil {
+		return ErrBlockedAddress
+	}
+	if !isInternal(ip) {
+		return nil
+	}
+	for _, network := range o.AllowedNetworks {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("URL must use http or https")
+	}
+	return nil
+}
+
+// carrierNAT is the shared address space (RFC 6598), which net.IP doesn't treat as private
+var carrierNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isInternal reports whether ip is anything but a public unicast address
+func isInternal(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		carrierNAT.Contains(ip)
+}
+
+// limitTransport caps response body sizes
+type limitTransport struct {
+	base http.RoundTripper
+	max  int64
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || t.max <= 0 {
+		return resp, err
+	}
+	if resp.ContentLength > t.max {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %d bytes", ErrResponseTooLarge, resp.ContentLength)
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: t.max}
+	return resp, nil
+}
+
+// limitedBody fails reads once more than its limit has been read
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		// Only hand over the bytes within the limit
+		return n + int(b.remaining), ErrResponseTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,48 @@
+package shared
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"argus-sdr/pkg/version"
+)
+
+// AuthSuccess is the payload of the auth_success message that completes a
+// collector's handshake. Besides accepting the station it tells the collector
+// what the server expects, so these settings live on the server only. Older
+// servers send just the status; collectors keep their defaults then.
+type AuthSuccess struct {
+	Status string `json:"status"` // "authenticated"
+
+	// Server is the server's version and the protocol versions it speaks
+	Server *version.Info `json:"server,omitempty"`
+
+	// ICE is the server's STUN and TURN configuration as on GET /api/ice/config.
+	// Collectors use it for transfers until its TURN credentials expire.
+	ICE *ICEServerConfig `json:"ice,omitempty"`
+
+	// FilePattern is the glob a capture's file name must match (empty for any file)
+	FilePattern string `json:"file_pattern,omitempty"`
+
+	// MaxFileSize is the largest file the server cache accepts, in bytes (0 for no limit)
+	MaxFileSize int64 `json:"max_file_size,omitempty"`
+}
+
+// Validate checks that a collector built from this code can work with what
+// the server asked for
+func (a AuthSuccess) Validate() error {
+	if a.Server != nil {
+		if err := version.CheckCompatible(a.Server); err != nil {
+			return err
+		}
+	}
+	if a.FilePattern != "" {
+		if _, err := filepath.Match(a.FilePattern, ""); err != nil {
+			return fmt.Errorf("invalid file pattern %q: %w", a.FilePattern, err)
+		}
+	}
+	if a.MaxFileSize < 0 {
+		return fmt.Errorf("invalid max file size %d", a.MaxFileSize)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// DefaultSTUNServer is used when the server doesn't hand out ICE servers (older servers)
+const DefaultSTUNServer = "stun:stun.l.google.com:19302"
+
+// ErrICEConfigUnavailable is returned when the server doesn't expose /api/ice/config (older servers)
+var ErrICEConfigUnavailable = fmt.Errorf("server does not provide ICE servers")
+
+// ICEServer is a STUN or TURN server as served on GET /api/ice/config
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// ICEServerConfig is the response of GET /api/ice/config. TURN credentials
+// expire after TTL seconds, so clients fetch it before every transfer.
+type ICEServerConfig struct {
+	ICEServers []ICEServer `json:"ice_servers"`
+	TTL        int         `json:"ttl,omitempty"` // seconds
+}
+
+// DefaultICEServers returns the ICE servers used when the server provides none
+func DefaultICEServers() []webrtc.ICEServer {
+	return []webrtc.ICEServer{{URLs: []string{DefaultSTUNServer}}}
+}
+
+// WebRTCServers converts the configuration for a webrtc.Configuration
+func (c ICEServerConfig) WebRTCServers() []webrtc.ICEServer {
+	servers := make([]webrtc.ICEServer, 0, len(c.ICEServers))
+	for _, server := range c.ICEServers {
+		iceServer := webrtc.ICEServer{URLs: server.URLs}
+		if server.Username != "" || server.Credential != "" {
+			iceServer.Username = server.Username
+			iceServer.Credential = server.Credential
+			iceServer.CredentialType = webrtc.ICECredentialTypePassword
+		}
+		servers = append(servers, iceServer)
+	}
+	return servers
+}
+
+// FetchICEServers retrieves the STUN and TURN servers to use for a transfer
+// from GET /api/ice/config
+func FetchICEServers(httpClient *http.Client, apiServerURL, authToken string) (*ICEServerConfig, error) {
+	req, err := http.NewRequest("GET", apiServerURL+"/api/ice/config", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ICE config request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch ICE config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrICEConfigUnavailable
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned status %d for ICE config", resp.StatusCode)
+	}
+
+	var config ICEServerConfig
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to decode ICE config: %w", err)
+	}
+	if len(config.ICEServers) == 0 {
+		return nil, fmt.Errorf("server returned no ICE servers")
+	}
+
+	return &config, nil
+}
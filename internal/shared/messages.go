@@ -1,18 +1,50 @@
 package shared
 
+import (
+	"encoding/json"
+
+	"argus-sdr/internal/geometry"
+)
+
 // DataRequest represents a request for data collection
 type DataRequest struct {
-	ID          string `json:"id"`
+	ID          string `json:"id"` // generated by the server; IDs sent with a new request are ignored
 	RequestType string `json:"request_type"`
 	Parameters  string `json:"parameters"`
 	RequestedBy string `json:"requested_by"`
 	Timestamp   int64  `json:"timestamp"`
+	Format      string `json:"format,omitempty"`       // output file format; empty means npz
+	CallbackURL string `json:"callback_url,omitempty"` // webhook notified when each station's data is ready or fails
+	Image       string `json:"image,omitempty"`        // processing image; must be on each collector's allowlist, empty uses its default
+
+	// Region restricts the request to stations that report a location inside it (nil for any station)
+	Region *geometry.Region `json:"region,omitempty"`
+
+	// RegionFallback lets the server fill up with stations outside Region
+	// when too few inside it are available
+	RegionFallback bool `json:"region_fallback,omitempty"`
+
+	// MinStations is how many stations must get the request; with fewer
+	// available it fails instead (0 for at least one)
+	MinStations int `json:"min_stations,omitempty"`
+
+	// MaxStations is the most stations the request goes to, the best ranked
+	// first (0 for as many as the server sends a request to)
+	MaxStations int `json:"max_stations,omitempty"`
+
+	// SelectionStrategy is how the server ranks the stations the request may
+	// go to, one of SelectionStrategies (empty for SelectionWeighted)
+	SelectionStrategy string `json:"selection_strategy,omitempty"`
+
+	// DurationSeconds is how long each station captures, or each stream
+	// frame lasts (0 leaves it to the image or the duration parameter)
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
 }
 
 // DataResponse represents the response from a collector
 type DataResponse struct {
 	RequestID   string `json:"request_id"`
-	Status      string `json:"status"` // "processing", "ready", "error"
+	Status      string `json:"status"` // "processing", "ready", "error", "rejected"
 	FilePath    string `json:"file_path,omitempty"`
 	DownloadURL string `json:"download_url,omitempty"` // URL for downloading the file
 	FileSize    int64  `json:"file_size,omitempty"`
@@ -36,6 +68,60 @@ type DataRequestStatus struct {
 	FileSize  int64  `json:"file_size,omitempty"`
 	Error     string `json:"error,omitempty"`
 	StationID string `json:"station_id,omitempty"`
+	Transfer  string `json:"transfer,omitempty"` // TransferWebRTC or TransferHTTP
+
+	// DurationSeconds is the capture duration the request asked for (0 if none)
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+
+	// Summary and Collectors break a request down by the stations it was sent
+	// to; only GET /api/data/status/:id fills them in
+	Summary    *RequestSummary   `json:"summary,omitempty"`
+	Collectors []CollectorStatus `json:"collectors,omitempty"`
+
+	// EstimatedReadyAt is when the last station still working is expected to
+	// deliver, from how long past requests took (RFC 3339; empty if unknown)
+	EstimatedReadyAt string `json:"estimated_ready_at,omitempty"`
+}
+
+// RequestSummary counts the stations a request was sent to by outcome.
+// Stations that rejected the request and had it rerouted aren't counted.
+type RequestSummary struct {
+	Ready    int  `json:"ready"`
+	Error    int  `json:"error"`
+	Pending  int  `json:"pending"`
+	Total    int  `json:"total"`
+	Complete bool `json:"complete"` // every station is ready or failed
+}
+
+// CollectorStatus is one station's part in a request
+type CollectorStatus struct {
+	StationID   string `json:"station_id"`
+	Status      string `json:"status"` // pending, processing, ready, error or rejected
+	FileSize    int64  `json:"file_size,omitempty"`
+	Error       string `json:"error,omitempty"`
+	CompletedAt string `json:"completed_at,omitempty"`
+
+	EstimatedReadyAt string `json:"estimated_ready_at,omitempty"` // while pending, see DataRequestStatus
+}
+
+// How a receiver fetches a collector's file
+const (
+	TransferWebRTC = "webrtc" // Peer-to-peer from the collector
+	TransferHTTP   = "http"   // From the server cache via GET /api/data/download
+)
+
+// UploadRequest asks a collector to upload a finished file to the server
+// cache so it can be served to several receivers
+type UploadRequest struct {
+	RequestID string `json:"request_id"`
+}
+
+// UploadFailed tells the server a requested upload couldn't be done, so
+// receivers should fall back to WebRTC
+type UploadFailed struct {
+	RequestID string `json:"request_id"`
+	StationID string `json:"station_id"`
+	Error     string `json:"error"`
 }
 
 // ICESessionInfo contains information about an ICE session for direct transfers
@@ -47,12 +133,47 @@ type ICESessionInfo struct {
 	Status      string `json:"status"`
 }
 
+// MessageVersion is the version of the WebSocket message envelope and payloads.
+//
+// Compatibility policy:
+//   - Adding message types, payload fields or status values is compatible and
+//     doesn't change the version. Payload decoders ignore unknown fields, and
+//     unknown message types are logged and skipped, so older peers keep working.
+//   - Removing or renaming a field, or changing its type or meaning, is a
+//     breaking change: bump MessageVersion, and keep handling the previous
+//     version until every deployed peer sends the new one.
+//   - Messages without a version come from peers that predate versioning and
+//     are treated as version 1.
+//
+// Peers that send a newer version are still processed on a best-effort basis.
+const MessageVersion = 1
+
 // WebSocketMessage is the base message type for WebSocket communication
 type WebSocketMessage struct {
 	Type    string      `json:"type"`
+	Version int         `json:"version,omitempty"`
 	Payload interface{} `json:"payload"`
 }
 
+// MarshalJSON stamps outgoing messages with MessageVersion unless a version
+// was set explicitly
+func (m WebSocketMessage) MarshalJSON() ([]byte, error) {
+	type envelope WebSocketMessage
+	if m.Version == 0 {
+		m.Version = MessageVersion
+	}
+	return json.Marshal(envelope(m))
+}
+
+// EffectiveVersion returns the message's envelope version; unversioned
+// messages are version 1
+func (m WebSocketMessage) EffectiveVersion() int {
+	if m.Version == 0 {
+		return 1
+	}
+	return m.Version
+}
+
 // StationRegistration contains station registration information
 type StationRegistration struct {
 	StationID       string `json:"station_id"`
@@ -65,4 +186,39 @@ type HeartbeatMessage struct {
 	StationID string `json:"station_id"`
 	Timestamp int64  `json:"timestamp"`
 	Status    string `json:"status"`
-}
\ No newline at end of file
+
+	ActiveRequests int `json:"active_requests,omitempty"` // requests the collector is collecting or streaming
+
+	// Health the server routes on; unset when the collector can't tell
+	DiskFreeBytes     *uint64 `json:"disk_free_bytes,omitempty"`    // free space in the data directory
+	ClockSynchronized *bool   `json:"clock_synchronized,omitempty"` // whether the kernel clock is synchronized
+	ImageReady        *bool   `json:"image_ready,omitempty"`        // whether the container image was pulled and verified
+
+	// Location of the station's antenna, if the collector is configured with it
+	Location *geometry.Position `json:"location,omitempty"`
+}
+
+// Control commands that can be broadcast to collectors
+const (
+	ControlCommandDrain  = "drain"  // Stop accepting new requests, finish in-flight ones
+	ControlCommandResume = "resume" // Start accepting requests again after a drain
+	ControlCommandReload = "reload" // Apply updated settings such as the container image
+)
+
+// ControlMessage is an operator command sent to collectors
+type ControlMessage struct {
+	Command        string `json:"command"`
+	ContainerImage string `json:"container_image,omitempty"` // Only used by reload
+	Reason         string `json:"reason,omitempty"`
+	IssuedBy       string `json:"issued_by,omitempty"`
+	Timestamp      int64  `json:"timestamp"`
+}
+
+// IsValidControlCommand reports whether a control command is supported
+func IsValidControlCommand(command string) bool {
+	switch command {
+	case ControlCommandDrain, ControlCommandResume, ControlCommandReload:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package shared
+
+import (
+	"encoding/json"
+	"time"
+
+	"argus-sdr/internal/models"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Notifications the server pushes to clients. Collectors receive them as the
+// payload of a WebSocketMessage; receivers receive them as a ReceiverMessage,
+// with the payload's fields next to type and version. The message type each
+// payload is sent as is noted on it.
+
+// DataReadyNotification (data_ready) tells a request's subscribers that a
+// station's file can be fetched
+type DataReadyNotification struct {
+	RequestID   string `json:"request_id"`
+	StationID   string `json:"station_id"`
+	Transfer    string `json:"transfer"`               // how to fetch the file, see TransferHTTP
+	DownloadURL string `json:"download_url,omitempty"` // set for HTTP transfers
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// CollectionErrorNotification (collection_error) tells a request's
+// subscribers that a station failed to collect
+type CollectionErrorNotification struct {
+	RequestID string `json:"request_id"`
+	StationID string `json:"station_id"`
+	Error     string `json:"error"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// ICEOfferNotification (ice_offer) relays a collector's WebRTC offer to the
+// receiver of a session
+type ICEOfferNotification struct {
+	SessionID string `json:"session_id"`
+	OfferSDP  string `json:"offer_sdp"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// ICEAnswerNotification (ice_answer) relays a receiver's WebRTC answer to the
+// collector of a session
+type ICEAnswerNotification struct {
+	SessionID string `json:"session_id"`
+	AnswerSDP string `json:"answer_sdp"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// ICERestartNotification (ice_restart) asks the collector of a session to
+// restart ICE, because its receiver's connection failed. The collector
+// answers with an ice-restart offer, which is relayed as an ice_offer.
+type ICERestartNotification struct {
+	SessionID string `json:"session_id"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// NewICESessionNotification (new_ice_session) tells collectors a receiver
+// opened a session. Parameters is the JSON object the receiver posted, naming
+// the request_id and station_id the session is for.
+type NewICESessionNotification struct {
+	SessionID   string `json:"session_id"`
+	RequestType string `json:"request_type"`
+	FromUser    int    `json:"from_user"`
+	Parameters  string `json:"parameters"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// ICECandidateNotification (ice_candidate) relays a candidate from the other
+// peer of a session. The candidate fields are named like WebRTC's
+// RTCIceCandidateInit, as in the candidates clients post to /api/ice/signal.
+type ICECandidateNotification struct {
+	SessionID     string  `json:"session_id"`
+	Candidate     string  `json:"candidate"`
+	SDPMLineIndex *uint16 `json:"sdpMLineIndex"`
+	SDPMid        *string `json:"sdpMid"`
+	Timestamp     int64   `json:"timestamp"`
+}
+
+// NewICECandidateNotification builds the notification relaying a stored
+// candidate. The server stores a null sdpMid as an empty string, which is
+// sent as null again.
+func NewICECandidateNotification(sessionID string, candidate *models.ICECandidate) ICECandidateNotification {
+	lineIndex := uint16(candidate.SDPMLineIndex)
+	notification := ICECandidateNotification{
+		SessionID:     sessionID,
+		Candidate:     candidate.Candidate,
+		SDPMLineIndex: &lineIndex,
+		Timestamp:     time.Now().Unix(),
+	}
+	if candidate.SDPMid != "" {
+		mid := candidate.SDPMid
+		notification.SDPMid = &mid
+	}
+	return notification
+}
+
+// CandidateInit returns the candidate to add to the peer connection. WebRTC
+// allows sdpMid to be null, which may also arrive as a missing key, so an
+// absent or empty sdpMid is left nil; a missing sdpMLineIndex is left nil too,
+// unless sdpMid is also missing, in which case it defaults to 0 since a
+// candidate needs at least one of them.
+func (n ICECandidateNotification) CandidateInit() webrtc.ICECandidateInit {
+	init := webrtc.ICECandidateInit{
+		Candidate:     n.Candidate,
+		SDPMLineIndex: n.SDPMLineIndex,
+		SDPMid:        n.SDPMid,
+	}
+	if init.SDPMid != nil && *init.SDPMid == "" {
+		init.SDPMid = nil
+	}
+	if init.SDPMid == nil && init.SDPMLineIndex == nil {
+		zero := uint16(0)
+		init.SDPMLineIndex = &zero
+	}
+	return init
+}
+
+// SessionCancelledNotification (session_cancelled) tells both peers of an ICE
+// session that its request was cancelled, so the transfer should stop
+type SessionCancelledNotification struct {
+	SessionID string `json:"session_id"`
+	RequestID string `json:"request_id"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// SessionFailedNotification (session_failed) tells both peers of an ICE
+// session that the server gave up on it, such as when it was still being
+// negotiated after ICE_SESSION_PENDING_TTL_SECONDS
+type SessionFailedNotification struct {
+	SessionID string `json:"session_id"`
+	RequestID string `json:"request_id,omitempty"`
+	Reason    string `json:"reason"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// ReceiverMessage is a notification as sent to receivers and request
+// webhooks: a flat JSON object holding type, version and the payload's fields
+type ReceiverMessage struct {
+	Type    string
+	Version int
+	Payload interface{}
+}
+
+// MarshalJSON flattens the payload into the message and stamps it with
+// MessageVersion unless a version was set explicitly
+func (m ReceiverMessage) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	if m.Payload != nil {
+		data, err := json.Marshal(m.Payload)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+	}
+	if m.Version == 0 {
+		m.Version = MessageVersion
+	}
+	fields["type"], _ = json.Marshal(m.Type)
+	fields["version"], _ = json.Marshal(m.Version)
+	return json.Marshal(fields)
+}
+
+// DecodePayload decodes a notification that was read as generic JSON, such
+// as a WebSocketMessage payload or a receiver message, into its typed struct.
+// Fields the struct doesn't have are ignored.
+func DecodePayload(payload interface{}, v interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,34 @@
+package shared
+
+import (
+	"argus-sdr/internal/convert"
+	"argus-sdr/internal/models"
+)
+
+// Text messages of a metadata-first file transfer. When a receiver opens a
+// session with metadata_only in its parameters, the collector sends a
+// preview of the file before anything else and waits for the receiver's
+// answer: after a fetch message the transfer goes on as usual, with the
+// file-metadata message and the file's bytes; after a skip message the
+// collector ends the transfer without sending the file.
+const (
+	FileMessagePreview = "file-preview" // collector: what the file holds, see FilePreview
+	FileMessageFetch   = "file-fetch"   // receiver: send the file
+	FileMessageSkip    = "file-skip"    // receiver: don't send the file
+)
+
+// FilePreview is the file-preview message of a metadata-first transfer
+type FilePreview struct {
+	Type     string `json:"type"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	// Arrays lists what an NPZ capture holds; captures converted to other
+	// formats have none
+	Arrays  []convert.ArrayInfo     `json:"arrays,omitempty"`
+	Capture *models.CaptureMetadata `json:"capture,omitempty"`
+}
+
+// FileDecision is a receiver's answer to a file preview
+type FileDecision struct {
+	Type string `json:"type"` // FileMessageFetch or FileMessageSkip
+}
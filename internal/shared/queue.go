@@ -0,0 +1,186 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Overflow policies for buffered message queues
+const (
+	OverflowBlock      = "block"       // Wait up to the block timeout for room, then drop the new message
+	OverflowDropOldest = "drop-oldest" // Discard the oldest queued message to make room
+	OverflowDisconnect = "disconnect"  // Report overflow so the caller closes the connection
+)
+
+var (
+	// ErrQueueOverflow is returned by Put when a message could not be queued
+	ErrQueueOverflow = errors.New("queue overflow")
+	// ErrQueueClosed is returned by Put once the queue has been closed
+	ErrQueueClosed = errors.New("queue closed")
+)
+
+// ValidOverflowPolicy reports whether policy is a known overflow policy
+func ValidOverflowPolicy(policy string) bool {
+	switch policy {
+	case OverflowBlock, OverflowDropOldest, OverflowDisconnect:
+		return true
+	}
+	return false
+}
+
+// OverflowPolicy controls what a Queue does when it is full
+type OverflowPolicy struct {
+	Policy       string
+	BlockTimeout time.Duration // only used by OverflowBlock; 0 waits forever
+}
+
+// Queue is a buffered channel with an explicit overflow policy. Dropped
+// messages are counted per queue name in the QueueDrops the queue was
+// created with.
+//
+// Queues with several producers are closed with Close rather than by closing
+// C, so a producer still in Put returns instead of sending on a closed channel.
+type Queue[T any] struct {
+	C chan T
+
+	name      string
+	policy    OverflowPolicy
+	dropped   *atomic.Int64
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewQueue creates a queue holding up to size messages. Its drops are counted
+// in drops together with those of other queues with the same name; with nil
+// drops only the queue's own are counted.
+func NewQueue[T any](name string, size int, policy OverflowPolicy, drops *QueueDrops) *Queue[T] {
+	if size < 1 {
+		size = 1
+	}
+	if !ValidOverflowPolicy(policy.Policy) {
+		policy.Policy = OverflowBlock
+	}
+	dropped := &atomic.Int64{}
+	if drops != nil {
+		dropped = drops.counter(name)
+	}
+	return &Queue[T]{
+		C:       make(chan T, size),
+		name:    name,
+		policy:  policy,
+		dropped: dropped,
+		closed:  make(chan struct{}),
+	}
+}
+
+// Close tells the consumer to stop and makes Put, including a Put blocked on
+// a full queue, return ErrQueueClosed. C stays open.
+func (q *Queue[T]) Close() {
+	q.closeOnce.Do(func() { close(q.closed) })
+}
+
+// Closed returns a channel that is closed once Close has been called
+func (q *Queue[T]) Closed() <-chan struct{} {
+	return q.closed
+}
+
+// Put queues a message according to the overflow policy. It returns
+// ErrQueueOverflow if the message was dropped, or if the queue is full and
+// the policy is OverflowDisconnect, and ErrQueueClosed if the queue is closed.
+func (q *Queue[T]) Put(msg T) error {
+	select {
+	case <-q.closed:
+		return fmt.Errorf("%w: %s", ErrQueueClosed, q.name)
+	default:
+	}
+
+	select {
+	case q.C <- msg:
+		return nil
+	default:
+	}
+
+	switch q.policy.Policy {
+	case OverflowDropOldest:
+		// Another producer may refill the slot, so retry a few times
+		for i := 0; i < 3; i++ {
+			select {
+			case <-q.C:
+				q.dropped.Add(1)
+			default:
+			}
+			select {
+			case q.C <- msg:
+				return nil
+			default:
+			}
+		}
+		q.dropped.Add(1)
+		return fmt.Errorf("%w: %s", ErrQueueOverflow, q.name)
+
+	case OverflowDisconnect:
+		q.dropped.Add(1)
+		return fmt.Errorf("%w: %s", ErrQueueOverflow, q.name)
+
+	default:
+		var timeout <-chan time.Time
+		if q.policy.BlockTimeout > 0 {
+			timer := time.NewTimer(q.policy.BlockTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case q.C <- msg:
+			return nil
+		case <-q.closed:
+			return fmt.Errorf("%w: %s", ErrQueueClosed, q.name)
+		case <-timeout:
+			q.dropped.Add(1)
+			return fmt.Errorf("%w: %s (blocked for %v)", ErrQueueOverflow, q.name, q.policy.BlockTimeout)
+		}
+	}
+}
+
+// Dropped returns the number of messages dropped by queues with this queue's name
+func (q *Queue[T]) Dropped() int64 {
+	return q.dropped.Load()
+}
+
+// QueueDrops counts the messages dropped by queues, per queue name
+type QueueDrops struct {
+	counters map[string]*atomic.Int64
+	mu       sync.Mutex
+}
+
+// NewQueueDrops creates an empty set of drop counters
+func NewQueueDrops() *QueueDrops {
+	return &QueueDrops{counters: make(map[string]*atomic.Int64)}
+}
+
+// counter returns the shared drop counter for a queue name
+func (d *QueueDrops) counter(name string) *atomic.Int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	counter, exists := d.counters[name]
+	if !exists {
+		counter = &atomic.Int64{}
+		d.counters[name] = counter
+	}
+	return counter
+}
+
+// Counts returns the number of dropped messages for every queue name
+func (d *QueueDrops) Counts() map[string]int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	drops := make(map[string]int64, len(d.counters))
+	for name, counter := range d.counters {
+		drops[name] = counter.Load()
+	}
+	return drops
+}
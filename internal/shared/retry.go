@@ -0,0 +1,111 @@
+package shared
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy retries HTTP requests the server answered with 429 (rate
+// limited) or 503 (temporarily unavailable). It waits as long as the
+// response's Retry-After header asks, or backs off exponentially with jitter
+// when there is none, so clients don't all retry at once. A 429 for an
+// exhausted daily quota is returned at once, see QuotaExhausted.
+type RetryPolicy struct {
+	Attempts  int           // total attempts, including the first
+	BaseDelay time.Duration // first backoff delay, doubled on each retry
+	MaxDelay  time.Duration // upper bound on any single wait
+
+	// OnRetry is called before each wait, e.g. for logging
+	OnRetry func(status int, wait time.Duration)
+}
+
+// DefaultRetryPolicy is used by the collector and receiver clients
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  5,
+	BaseDelay: time.Second,
+	MaxDelay:  time.Minute,
+}
+
+// Headers the server sets on data requests of users with a daily quota
+const (
+	QuotaLimitHeader     = "X-Quota-Limit"     // requests allowed per UTC day
+	QuotaRemainingHeader = "X-Quota-Remaining" // requests left today
+	QuotaResetHeader     = "X-Quota-Reset"     // Unix time the quota resets at (next UTC midnight)
+)
+
+// Retryable reports whether a response status asks the client to try again later
+func Retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// QuotaExhausted reports whether a response refused a request because the
+// user's daily quota is used up. Retrying is pointless until the day ends.
+func QuotaExhausted(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests && resp.Header.Get(QuotaRemainingHeader) == "0"
+}
+
+// Do sends the request built by newRequest, retrying while the server
+// answers with a retryable status. newRequest is called for every attempt
+// because request bodies can only be read once. The last response is
+// returned even if it is still retryable; the caller owns its body.
+func (p RetryPolicy) Do(client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if !Retryable(resp.StatusCode) || QuotaExhausted(resp) || attempt >= p.Attempts {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		wait := p.Delay(resp, attempt)
+		if p.OnRetry != nil {
+			p.OnRetry(resp.StatusCode, wait)
+		}
+		time.Sleep(wait)
+	}
+}
+
+// Delay returns how long to wait after the given attempt's response
+func (p RetryPolicy) Delay(resp *http.Response, attempt int) time.Duration {
+	wait, ok := RetryAfter(resp)
+	if !ok {
+		wait = p.BaseDelay << (attempt - 1)
+		if wait > 0 {
+			// Up to 50% jitter spreads out clients that failed together
+			wait += time.Duration(rand.Int63n(int64(wait)/2 + 1))
+		}
+	}
+	if p.MaxDelay > 0 && wait > p.MaxDelay {
+		wait = p.MaxDelay
+	}
+	return wait
+}
+
+// RetryAfter parses a response's Retry-After header, given either as
+// seconds or as an HTTP date
+func RetryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
@@ -0,0 +1,27 @@
+package shared
+
+// Selection strategies a data request can name in selection_strategy to
+// choose how the server ranks the stations it may go to
+const (
+	SelectionWeighted        = "weighted"         // SELECTION_WEIGHT_* as configured (the default)
+	SelectionLeastLoaded     = "least_loaded"     // fewest requests in flight
+	SelectionBestPerformance = "best_performance" // best success rate and quickest delivery
+	SelectionSpread          = "spread"           // stations far apart, for a wide view or a better TDOA fix
+)
+
+// SelectionStrategies lists the selection strategies in the order they are documented
+var SelectionStrategies = []string{SelectionWeighted, SelectionLeastLoaded, SelectionBestPerformance, SelectionSpread}
+
+// IsValidSelectionStrategy reports whether a selection strategy is supported;
+// empty means the default
+func IsValidSelectionStrategy(strategy string) bool {
+	if strategy == "" {
+		return true
+	}
+	for _, known := range SelectionStrategies {
+		if strategy == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package shared
+
+import "argus-sdr/internal/models"
+
+// RequestTypeStream asks collectors for a continuous stream of captures over
+// WebRTC instead of a single file. Collectors that don't know it answer with
+// a single file.
+const RequestTypeStream = "stream"
+
+// StreamProtocol identifies the capture streaming protocol spoken over the data channel
+const StreamProtocol = "argus-stream-v1"
+
+// StreamWindow is how many frames a collector sends ahead of the receiver's
+// acknowledgements. A collector with a full window stops capturing until the
+// receiver catches up.
+const StreamWindow = 2
+
+// Text messages on a stream data channel. The collector sends a frame header
+// followed by the frame's bytes as binary messages, and an end message when it
+// stops. The receiver acknowledges each frame once it has been consumed and
+// sends a stop message when it wants no more.
+const (
+	StreamMessageFrame = "stream-frame" // collector: a frame of Size bytes follows
+	StreamMessageEnd   = "stream-end"   // collector: no more frames, see Reason and Error
+	StreamMessageAck   = "stream-ack"   // receiver: frame Sequence was consumed
+	StreamMessageStop  = "stream-stop"  // receiver: end the stream
+)
+
+// Reasons a collector ends a stream
+const (
+	StreamEndStopped  = "stopped"  // the receiver sent a stop message
+	StreamEndLimit    = "limit"    // the collector's maximum stream duration passed
+	StreamEndDraining = "draining" // the collector is draining
+	StreamEndError    = "error"    // a capture failed
+)
+
+// StreamMessage is a text message on a stream data channel
+type StreamMessage struct {
+	Type     string                  `json:"type"`
+	Sequence int                     `json:"sequence,omitempty"` // frame numbers start at 1
+	Size     int64                   `json:"size,omitempty"`
+	Capture  *models.CaptureMetadata `json:"capture,omitempty"`
+	Frames   int                     `json:"frames,omitempty"` // frames sent, on stream-end
+	Reason   string                  `json:"reason,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+}
@@ -0,0 +1,32 @@
+package shared
+
+// WebSocketSubprotocolV1 is the first version of the collector and receiver
+// WebSocket APIs, negotiated with Sec-WebSocket-Protocol. The subprotocol
+// versions a connection as a whole; MessageVersion versions the messages
+// sent over it.
+const WebSocketSubprotocolV1 = "argus.v1"
+
+// WebSocketSubprotocols lists the subprotocols this build speaks, the
+// preferred one first
+var WebSocketSubprotocols = []string{WebSocketSubprotocolV1}
+
+// SupportsSubprotocol reports whether any of the offered subprotocols is one
+// this build speaks
+func SupportsSubprotocol(offered []string) bool {
+	for _, protocol := range offered {
+		for _, supported := range WebSocketSubprotocols {
+			if protocol == supported {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SubprotocolName describes a negotiated subprotocol for logs
+func SubprotocolName(protocol string) string {
+	if protocol == "" {
+		return "none"
+	}
+	return protocol
+}
@@ -0,0 +1,36 @@
+package shared
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// WebSocketURL derives the WebSocket URL for path from the API server URL,
+// using wss:// for https:// servers and ws:// for http:// servers
+func WebSocketURL(apiServerURL, path string) (string, error) {
+	apiURL, err := url.Parse(apiServerURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid API server URL %q: %w", apiServerURL, err)
+	}
+
+	var scheme string
+	switch apiURL.Scheme {
+	case "https":
+		scheme = "wss"
+	case "http":
+		scheme = "ws"
+	default:
+		return "", fmt.Errorf("invalid API server URL %q: scheme must be http or https", apiServerURL)
+	}
+	if apiURL.Host == "" {
+		return "", fmt.Errorf("invalid API server URL %q: missing host", apiServerURL)
+	}
+
+	wsURL := url.URL{
+		Scheme: scheme,
+		Host:   apiURL.Host,
+		Path:   strings.TrimSuffix(apiURL.Path, "/") + path,
+	}
+	return wsURL.String(), nil
+}
@@ -0,0 +1,35 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"argus-sdr/pkg/version"
+)
+
+// ErrVersionUnavailable is returned when the server doesn't expose /api/version (older servers)
+var ErrVersionUnavailable = fmt.Errorf("server does not report its version")
+
+// FetchServerVersion retrieves the server's version information from GET /api/version
+func FetchServerVersion(httpClient *http.Client, apiServerURL string) (*version.Info, error) {
+	resp, err := httpClient.Get(apiServerURL + "/api/version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch server version: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrVersionUnavailable
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned status %d for version check", resp.StatusCode)
+	}
+
+	var info version.Info
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode server version: %w", err)
+	}
+
+	return &info, nil
+}
@@ -0,0 +1,142 @@
+package shared
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// FileTransferProtocol identifies the file transfer protocol spoken over the data channel.
+// Bump it when the framing changes so mismatched peers fail clearly instead of corrupting files.
+const FileTransferProtocol = "argus-file-v1"
+
+// DefaultDataChannelLabel is the label used for the file transfer data channel
+const DefaultDataChannelLabel = "file-transfer"
+
+// SupportedFileTransferProtocols lists the protocols a receiver can accept, newest first
+var SupportedFileTransferProtocols = []string{FileTransferProtocol}
+
+// IsSupportedFileTransferProtocol reports whether a data channel protocol can be received
+func IsSupportedFileTransferProtocol(protocol string) bool {
+	for _, supported := range SupportedFileTransferProtocols {
+		if protocol == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// FileTransferChannelInit returns the options of a data channel carrying
+// files. A file transfer needs every message delivered in order: chunks are
+// written as they arrive and the checksum is only checked at the end. So
+// Ordered is set explicitly and neither MaxRetransmits nor MaxPacketLifeTime,
+// either of which would let SCTP drop messages.
+func FileTransferChannelInit(protocol string) *webrtc.DataChannelInit {
+	ordered := true
+	return &webrtc.DataChannelInit{
+		Ordered:  &ordered,
+		Protocol: &protocol,
+	}
+}
+
+// StreamChannelInit returns the options of a capture stream's data channel.
+// It is reliable like a file transfer unless maxPacketLifeTime is positive,
+// in which case SCTP stops retransmitting a message that hasn't been
+// delivered within it (partial reliability). Delivery stays ordered.
+func StreamChannelInit(maxPacketLifeTime time.Duration) *webrtc.DataChannelInit {
+	init := FileTransferChannelInit(StreamProtocol)
+	if maxPacketLifeTime > 0 {
+		milliseconds := uint16(maxPacketLifeTime.Milliseconds())
+		init.MaxPacketLifeTime = &milliseconds
+	}
+	return init
+}
+
+// IsReliableOrdered reports whether a data channel delivers every message, in order
+func IsReliableOrdered(dataChannel *webrtc.DataChannel) bool {
+	return dataChannel.Ordered() && dataChannel.MaxRetransmits() == nil && dataChannel.MaxPacketLifeTime() == nil
+}
+
+// DescribeReliability describes a data channel's delivery guarantees for logs and errors
+func DescribeReliability(dataChannel *webrtc.DataChannel) string {
+	ordering := "ordered"
+	if !dataChannel.Ordered() {
+		ordering = "unordered"
+	}
+	switch {
+	case dataChannel.MaxRetransmits() != nil:
+		return fmt.Sprintf("%s, at most %d retransmits", ordering, *dataChannel.MaxRetransmits())
+	case dataChannel.MaxPacketLifeTime() != nil:
+		return fmt.Sprintf("%s, messages dropped after %d ms", ordering, *dataChannel.MaxPacketLifeTime())
+	}
+	return ordering + ", reliable"
+}
+
+// ICETimeouts controls how quickly WebRTC connections give up on a bad network
+type ICETimeouts struct {
+	Gathering    time.Duration // Maximum time to wait for local ICE candidate gathering
+	Disconnected time.Duration // Time without traffic before the ICE agent reports Disconnected
+	Failed       time.Duration // Time after Disconnected before the ICE agent reports Failed
+	KeepAlive    time.Duration // Interval between ICE keepalive checks
+}
+
+// DefaultICETimeouts returns the timeouts used when none are configured
+func DefaultICETimeouts() ICETimeouts {
+	return ICETimeouts{
+		Gathering:    10 * time.Second,
+		Disconnected: 5 * time.Second,
+		Failed:       15 * time.Second,
+		KeepAlive:    2 * time.Second,
+	}
+}
+
+// withDefaults fills in any unset timeouts
+func (t ICETimeouts) withDefaults() ICETimeouts {
+	defaults := DefaultICETimeouts()
+	if t.Gathering <= 0 {
+		t.Gathering = defaults.Gathering
+	}
+	if t.Disconnected <= 0 {
+		t.Disconnected = defaults.Disconnected
+	}
+	if t.Failed <= 0 {
+		t.Failed = defaults.Failed
+	}
+	if t.KeepAlive <= 0 {
+		t.KeepAlive = defaults.KeepAlive
+	}
+	return t
+}
+
+// NewWebRTCAPI creates a WebRTC API whose peer connections use the given ICE timeouts
+func NewWebRTCAPI(timeouts ICETimeouts) *webrtc.API {
+	timeouts = timeouts.withDefaults()
+
+	settingEngine := webrtc.SettingEngine{}
+	settingEngine.SetICETimeouts(timeouts.Disconnected, timeouts.Failed, timeouts.KeepAlive)
+
+	return webrtc.NewAPI(webrtc.WithSettingEngine(settingEngine))
+}
+
+// AwaitICEGathering waits for ICE gathering to complete, up to the gathering timeout.
+// Pion has no gathering timeout of its own, so on a bad network gathering can run
+// for a long time. If the timeout passes with no local candidates gathered the
+// connection can never succeed and an error is returned; otherwise the
+// connection proceeds with the candidates gathered so far.
+func AwaitICEGathering(gatherComplete <-chan struct{}, timeouts ICETimeouts, candidateCount func() int) error {
+	timeouts = timeouts.withDefaults()
+
+	select {
+	case <-gatherComplete:
+		if candidateCount() == 0 {
+			return fmt.Errorf("ICE gathering completed without any candidates")
+		}
+		return nil
+	case <-time.After(timeouts.Gathering):
+		if candidateCount() == 0 {
+			return fmt.Errorf("no ICE candidates gathered within %v", timeouts.Gathering)
+		}
+		return nil
+	}
+}
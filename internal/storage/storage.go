@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"argus-sdr/internal/convert"
+)
+
+var (
+	// ErrTooLarge is returned when an upload exceeds the size limit
+	ErrTooLarge = errors.New("file exceeds maximum size")
+	// ErrChecksumMismatch is returned when stored data doesn't match the expected SHA-256
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrInvalidKey is returned for keys that would escape the storage root
+	ErrInvalidKey = errors.New("invalid storage key")
+)
+
+// Object describes a stored file
+type Object struct {
+	Key    string
+	Size   int64
+	SHA256 string
+}
+
+// Storage stores files uploaded to the server
+type Storage interface {
+	// Put streams r into key, failing if it is larger than maxSize bytes or its
+	// SHA-256 doesn't match expectedSHA256 (hex). Nothing is stored on failure.
+	Put(key string, r io.Reader, maxSize int64, expectedSHA256 string) (*Object, error)
+	// Open opens a stored file for reading
+	Open(key string) (*os.File, error)
+	// Delete removes a stored file; deleting a missing file is not an error
+	Delete(key string) error
+}
+
+// Local stores files in a directory on the server's filesystem
+type Local struct {
+	root string
+}
+
+// NewLocal creates local storage rooted at dir, creating it if needed
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &Local{root: dir}, nil
+}
+
+// Key builds the storage key for a collector's file for a request, named
+// for the format the file was converted to
+func Key(requestID, stationID, format string) string {
+	return requestID + "/" + stationID + convert.Extension(format)
+}
+
+// path resolves a key to a file path inside the storage root
+func (l *Local) path(key string) (string, error) {
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `\:`) {
+			return "", ErrInvalidKey
+		}
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+// Put implements Storage. Data is written to a temporary file and only moved
+// into place once its size and checksum have been verified.
+func (l *Local) Put(key string, r io.Reader, maxSize int64, expectedSHA256 string) (*Object, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Read one byte past the limit so oversized uploads can be detected
+	hash := sha256.New()
+	reader := r
+	if maxSize > 0 {
+		reader = io.LimitReader(r, maxSize+1)
+	}
+	size, err := io.Copy(io.MultiWriter(tmp, hash), reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write file: %w", err)
+	}
+	if maxSize > 0 && size > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if expectedSHA256 != "" && !strings.EqualFold(sum, expectedSHA256) {
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expectedSHA256, sum)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
+
+	return &Object{Key: key, Size: size, SHA256: sum}, nil
+}
+
+// Open implements Storage
+func (l *Local) Open(key string) (*os.File, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Delete implements Storage
+func (l *Local) Delete(key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// The request's directory goes with its last file; removing a directory
+	// that isn't empty fails, which is fine
+	if dir := filepath.Dir(path); dir != filepath.Clean(l.root) {
+		os.Remove(dir)
+	}
+	return nil
+}
@@ -1,20 +1,30 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
+	"net/mail"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"argus-sdr/internal/api"
+	"argus-sdr/internal/auth"
 	"argus-sdr/internal/collector"
+	"argus-sdr/internal/convert"
 	"argus-sdr/internal/database"
+	"argus-sdr/internal/models"
 	"argus-sdr/internal/receiver"
+	"argus-sdr/internal/shared"
 	"argus-sdr/pkg/config"
 	"argus-sdr/pkg/logger"
+	"argus-sdr/pkg/version"
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cobra"
@@ -26,18 +36,39 @@ var (
 	stationID    string
 	apiServerURL string
 	dataDir      string
+	pullImage    bool
 	receiverID   string
 	receiverAPIURL string
 	downloadDir  string
+	receiverFormat string
+	receiverImage  string
+	captureSeconds int
+	receiverStream bool
+	streamFrames   int
+	streamDuration int
+
+	singleStation bool
+
+	metadataOnly  bool
+	triageCommand string
+
+	newUserEmail      string
+	newUserPassword   string
+	newUserClientType int
+	newUserAdmin      bool
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "argus-sdr",
 	Short: "SDR API system with three operational modes",
 	Long: `Argus SDR system supports three operational modes:
-- api: Run the REST API server (default)
+- api: Run the REST API server
 - collector: Run the SDR data collection client
-- receiver: Run the data request client`,
+- receiver: Run the data request client
+
+Without a mode, the one named by the MODE environment variable runs.
+Use "admin" for database administration such as creating users.`,
+	RunE: runDefaultMode,
 }
 
 var apiCmd = &cobra.Command{
@@ -61,38 +92,82 @@ var receiverCmd = &cobra.Command{
 	Run:   runReceiverClient,
 }
 
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Administer the API server database",
+	Long:  `Administrative commands that work directly on the API server database (DATABASE_PATH).`,
+}
+
+var createUserCmd = &cobra.Command{
+	Use:   "create-user",
+	Short: "Create a user account",
+	Long: `Create a user account directly in the database, for bootstrapping admins and
+provisioning collector and receiver accounts when ALLOW_REGISTRATION is false.
+The password is read from standard input when --password is not given.`,
+	Run: runCreateUser,
+}
+
 func init() {
 	// Add collector flags
 	collectorCmd.Flags().StringVar(&stationID, "station-id", "", "Station ID (overrides STATION_ID environment variable)")
 	collectorCmd.Flags().StringVar(&apiServerURL, "api-server-url", "", "API server URL (overrides API_SERVER_URL environment variable)")
 	collectorCmd.Flags().StringVar(&dataDir, "data-dir", "", "Data directory (overrides DATA_DIR environment variable)")
+	collectorCmd.Flags().BoolVar(&pullImage, "pull", false, "Pull and verify the container image before connecting (overrides COLLECTOR_PULL_IMAGE environment variable)")
 
 	// Add receiver flags
 	receiverCmd.Flags().StringVar(&receiverID, "receiver-id", "", "Receiver ID (overrides RECEIVER_ID environment variable)")
 	receiverCmd.Flags().StringVar(&receiverAPIURL, "api-server-url", "", "API server URL (overrides API_SERVER_URL environment variable)")
 	receiverCmd.Flags().StringVar(&downloadDir, "download-dir", "", "Download directory (overrides DOWNLOAD_DIR environment variable)")
+	receiverCmd.Flags().StringVar(&receiverFormat, "format", "", "File format to request: npz, csv or sigmf (overrides RECEIVER_FORMAT environment variable)")
+	receiverCmd.Flags().StringVar(&receiverImage, "image", "", "Processing image to request; must be allowlisted by the collectors (overrides RECEIVER_IMAGE environment variable)")
+	receiverCmd.Flags().IntVar(&captureSeconds, "duration", 0, "Seconds the stations capture for (overrides RECEIVER_DURATION_SECONDS environment variable)")
+	receiverCmd.Flags().BoolVar(&receiverStream, "stream", false, "Stream captures continuously instead of downloading one file (overrides RECEIVER_STREAM environment variable)")
+	receiverCmd.Flags().IntVar(&streamFrames, "stream-frames", 0, "Stop a stream after this many frames (overrides RECEIVER_STREAM_FRAMES environment variable)")
+	receiverCmd.Flags().IntVar(&streamDuration, "stream-duration", 0, "Stop a stream after this many seconds (overrides RECEIVER_STREAM_DURATION_SECONDS environment variable)")
+	receiverCmd.Flags().BoolVar(&metadataOnly, "metadata-only", false, "Get a preview of each station's file first and fetch the file only if the triage command accepts it (overrides RECEIVER_METADATA_ONLY environment variable)")
+	receiverCmd.Flags().StringVar(&triageCommand, "triage-command", "", "Command given each preview on stdin; exit status 0 fetches the file (overrides RECEIVER_TRIAGE_COMMAND environment variable)")
+	receiverCmd.Flags().BoolVar(&singleStation, "single-station", false, "Request data from only the best station and exit once it is downloaded (overrides RECEIVER_SINGLE_STATION environment variable)")
+
+	// Add admin create-user flags
+	createUserCmd.Flags().StringVar(&newUserEmail, "email", "", "Email address of the new user")
+	createUserCmd.Flags().StringVar(&newUserPassword, "password", "", "Password of the new user (read from stdin if omitted)")
+	createUserCmd.Flags().IntVar(&newUserClientType, "client-type", 2, "Client type: 1 for collectors, 2 for receivers and web users")
+	createUserCmd.Flags().BoolVar(&newUserAdmin, "admin", false, "Give the user the admin role")
+	createUserCmd.MarkFlagRequired("email")
+	adminCmd.AddCommand(createUserCmd)
 
 	// Add subcommands
 	rootCmd.AddCommand(apiCmd)
 	rootCmd.AddCommand(collectorCmd)
 	rootCmd.AddCommand(receiverCmd)
+	rootCmd.AddCommand(adminCmd)
 
 	// Set default command to api if no subcommand is specified
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
+
+	// --version prints the build as the startup logs describe it
+	rootCmd.Version = version.String()
+	rootCmd.SetVersionTemplate("{{.Name}} {{.Version}}\n")
 }
 
 func runAPIServer(cmd *cobra.Command, args []string) {
 	// Initialize logger
 	log := logger.New()
+	log.Info("Argus SDR API server %s", version.String())
 
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatal("Failed to load configuration: %v", err)
 	}
+	log.SetLevel(logLevel(cfg))
+
+	if cfg.LogRecentEnabled {
+		log.KeepRecent(cfg.LogRecentLines)
+	}
 
 	// Initialize database
-	db, err := database.Initialize(cfg.Database.Path)
+	db, err := database.Initialize(cfg.Database.Path, cfg.Database.BusyTimeout)
 	if err != nil {
 		log.Fatal("Failed to initialize database: %v", err)
 	}
@@ -114,7 +189,7 @@ func runAPIServer(cmd *cobra.Command, args []string) {
 	}
 
 	// Initialize API router
-	router := api.NewRouter(db, log, cfg)
+	router, shutdown := api.NewRouter(db, log, cfg)
 
 	// Create HTTP server
 	server := &http.Server{
@@ -124,7 +199,7 @@ func runAPIServer(cmd *cobra.Command, args []string) {
 
 	// Start server in goroutine
 	go func() {
-		log.Info("Starting API server on %s", cfg.Server.Address)
+		log.Info("Starting API server on %s (role: %s)", cfg.Server.Address, cfg.Server.Role)
 		if cfg.SSL.Enabled {
 			// Use LetsEncrypt in production
 			if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
@@ -144,12 +219,27 @@ func runAPIServer(cmd *cobra.Command, args []string) {
 
 	log.Info("Shutting down server...")
 
-	// Graceful shutdown with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// WebSocket clients are hijacked connections Shutdown doesn't wait for,
+	// so they are told to go away as soon as the listeners are closed
+	server.RegisterOnShutdown(func() {
+		log.Info("Sent a going-away close to %d WebSocket clients", shutdown.GoingAway("server shutting down"))
+	})
+
+	// Graceful shutdown, waiting for in-flight transfers up to the grace period
+	grace := time.Duration(cfg.Server.ShutdownGrace) * time.Second
+	inFlight := shutdown.InFlightTransfers()
+	if inFlight > 0 {
+		log.Info("Waiting up to %s for %d in-flight transfers", grace, inFlight)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown: %v", err)
+		log.Warn("Abandoning %d in-flight transfers after the %s grace period: %v", shutdown.InFlightTransfers(), grace, err)
+		server.Close()
+	} else if inFlight > 0 {
+		log.Info("Waited for %d in-flight transfers to finish", inFlight)
 	}
 
 	log.Info("Server exited")
@@ -164,6 +254,7 @@ func runCollectorClient(cmd *cobra.Command, args []string) {
 	if err != nil {
 		log.Fatal("Failed to load configuration: %v", err)
 	}
+	log.SetLevel(logLevel(cfg))
 
 	// Override config with command line flags if provided
 	if stationID != "" {
@@ -175,6 +266,9 @@ func runCollectorClient(cmd *cobra.Command, args []string) {
 	if dataDir != "" {
 		cfg.Collector.DataDir = dataDir
 	}
+	if pullImage {
+		cfg.Collector.PullImage = true
+	}
 
 	// Validate collector configuration
 	if cfg.Collector.StationID == "" {
@@ -184,6 +278,9 @@ func runCollectorClient(cmd *cobra.Command, args []string) {
 		log.Fatal("API server URL is required. Provide via --api-server-url flag or API_SERVER_URL environment variable")
 	}
 
+	// The location was validated with the rest of the configuration
+	location, _ := cfg.Collector.Location()
+
 	// Create collector instance
 	client := &collector.Client{
 		ID:             cfg.Collector.StationID,
@@ -192,9 +289,50 @@ func runCollectorClient(cmd *cobra.Command, args []string) {
 		DataDir:        cfg.Collector.DataDir,
 		ContainerImage: cfg.Collector.ContainerImage,
 		Logger:         log,
+
+		LogDockerCommand: cfg.Collector.LogDockerCommand,
+		ErrorOutputLimit: cfg.Collector.ErrorOutputLimit,
+
+		ExitAfterDrain:    cfg.Collector.ExitAfterDrain,
+		DrainTransferWait: time.Duration(cfg.Collector.DrainTransferWait) * time.Second,
+		ICETimeouts:       iceTimeouts(cfg),
+		DataChannelLabel:  cfg.ICE.DataChannelLabel,
+		AllowedParameters: cfg.Collector.AllowedParameters,
+		AllowedImages:     cfg.Collector.AllowedImages,
+		SDRModel:          cfg.Collector.SDRModel,
+		Location:          location,
+
+		DockerMemory:      cfg.Collector.DockerMemory,
+		DockerCPUs:        cfg.Collector.DockerCPUs,
+		DockerPidsLimit:   cfg.Collector.DockerPidsLimit,
+		OutputMountPath:   cfg.Collector.OutputMountPath,
+		InputDir:          cfg.Collector.InputDir,
+		InputMountPath:    cfg.Collector.InputMountPath,
+		ReadOnlyRoot:      cfg.Collector.ReadOnlyRoot,
+		TmpfsPaths:        cfg.Collector.TmpfsPaths,
+		CollectionTimeout: time.Duration(cfg.Collector.CollectionTimeout) * time.Second,
+		CaptureGrace:      time.Duration(cfg.Collector.CaptureGrace) * time.Second,
+		StatusAddress:     cfg.Collector.StatusAddress(),
+		UploadFiles:       cfg.Collector.UploadFiles,
+		DataRetention:     time.Duration(cfg.Collector.DataRetention) * time.Second,
+		StreamMaxDuration: time.Duration(cfg.Collector.StreamMaxDuration) * time.Second,
+		ValidateCaptures:  cfg.Collector.ValidateCaptures,
+
+		StreamMaxPacketLifeTime: time.Duration(cfg.Collector.StreamMaxPacketLifeTime) * time.Millisecond,
+
+		BreakerThreshold: cfg.Collector.BreakerThreshold,
+		BreakerCooldown:  time.Duration(cfg.Collector.BreakerCooldown) * time.Second,
+
+		PullImage:        cfg.Collector.PullImage,
+		ImageDigest:      cfg.Collector.ImageDigest,
+		ImagePullTimeout: time.Duration(cfg.Collector.ImagePullTimeout) * time.Second,
+
+		TLSCAFile:   cfg.Collector.TLSCAFile,
+		TLSCertFile: cfg.Collector.TLSCertFile,
+		TLSKeyFile:  cfg.Collector.TLSKeyFile,
 	}
 
-	log.Info("Starting collector client (Station: %s)", cfg.Collector.StationID)
+	log.Info("Starting collector client %s (Station: %s)", version.String(), cfg.Collector.StationID)
 
 	// Start the collector client
 	if err := client.Start(); err != nil {
@@ -211,6 +349,7 @@ func runReceiverClient(cmd *cobra.Command, args []string) {
 	if err != nil {
 		log.Fatal("Failed to load configuration: %v", err)
 	}
+	log.SetLevel(logLevel(cfg))
 
 	// Override config with command line flags if provided
 	if receiverID != "" {
@@ -222,6 +361,33 @@ func runReceiverClient(cmd *cobra.Command, args []string) {
 	if downloadDir != "" {
 		cfg.Receiver.DownloadDir = downloadDir
 	}
+	if receiverFormat != "" {
+		cfg.Receiver.Format = receiverFormat
+	}
+	if receiverImage != "" {
+		cfg.Receiver.Image = receiverImage
+	}
+	if captureSeconds > 0 {
+		cfg.Receiver.Duration = captureSeconds
+	}
+	if receiverStream {
+		cfg.Receiver.Stream = true
+	}
+	if streamFrames > 0 {
+		cfg.Receiver.StreamFrames = streamFrames
+	}
+	if streamDuration > 0 {
+		cfg.Receiver.StreamDuration = streamDuration
+	}
+	if singleStation {
+		cfg.Receiver.SingleStation = true
+	}
+	if metadataOnly {
+		cfg.Receiver.MetadataOnly = true
+	}
+	if triageCommand != "" {
+		cfg.Receiver.TriageCommand = triageCommand
+	}
 
 	// Validate receiver configuration
 	if cfg.Receiver.ReceiverID == "" {
@@ -230,6 +396,9 @@ func runReceiverClient(cmd *cobra.Command, args []string) {
 	if cfg.Receiver.APIServerURL == "" {
 		log.Fatal("API server URL is required. Provide via --api-server-url flag or API_SERVER_URL environment variable")
 	}
+	if _, err := convert.Lookup(cfg.Receiver.Format); err != nil {
+		log.Fatal("Invalid RECEIVER_FORMAT: %v", err)
+	}
 
 	// Create receiver instance
 	client := &receiver.Client{
@@ -237,9 +406,42 @@ func runReceiverClient(cmd *cobra.Command, args []string) {
 		APIServerURL: cfg.Receiver.APIServerURL,
 		DownloadDir:  cfg.Receiver.DownloadDir,
 		Logger:       log,
+		ICETimeouts:  iceTimeouts(cfg),
+		Format:       cfg.Receiver.Format,
+		Image:        cfg.Receiver.Image,
+		Duration:     time.Duration(cfg.Receiver.Duration) * time.Second,
+
+		WriteManifest: cfg.Receiver.WriteManifest,
+
+		Stream:         cfg.Receiver.Stream,
+		StreamFrames:   cfg.Receiver.StreamFrames,
+		StreamDuration: time.Duration(cfg.Receiver.StreamDuration) * time.Second,
+
+		SingleStation: cfg.Receiver.SingleStation,
+
+		MinTransferThroughput: int64(cfg.Receiver.TransferMinThroughput) * 1024,
+		TransferStallWindow:   time.Duration(cfg.Receiver.TransferStallWindow) * time.Second,
+		TransferIdleTimeout:   time.Duration(cfg.Receiver.TransferIdleTimeout) * time.Second,
+
+		KeepPartialDownloads:   cfg.Receiver.KeepPartialDownloads,
+		MaxConcurrentDownloads: cfg.Receiver.MaxConcurrentDownloads,
+		GeometryCheck:          cfg.Receiver.GeometryCheck,
+
+		AllowPartialReliability: cfg.Receiver.AllowPartialReliability,
+
+		MetadataOnly:  cfg.Receiver.MetadataOnly,
+		TriageCommand: cfg.Receiver.TriageCommand,
+
+		ICERestarts: cfg.Receiver.ICERestarts,
+
+		NotificationBuffer: cfg.Queues.ReceiverNotificationBuffer,
+		NotificationOverflow: shared.OverflowPolicy{
+			Policy:       cfg.Queues.ReceiverNotificationOverflow,
+			BlockTimeout: time.Duration(cfg.Queues.BlockTimeout) * time.Second,
+		},
 	}
 
-	log.Info("Starting receiver client (ID: %s)", cfg.Receiver.ReceiverID)
+	log.Info("Starting receiver client %s (ID: %s)", version.String(), cfg.Receiver.ReceiverID)
 
 	// Start the receiver client
 	if err := client.RequestAndDownload(); err != nil {
@@ -247,14 +449,122 @@ func runReceiverClient(cmd *cobra.Command, args []string) {
 	}
 }
 
-func main() {
-	// If no arguments provided, default to api mode
-	if len(os.Args) == 1 {
-		os.Args = append(os.Args, "api")
+// iceTimeouts converts the ICE configuration into WebRTC timeouts
+func iceTimeouts(cfg *config.Config) shared.ICETimeouts {
+	return shared.ICETimeouts{
+		Gathering:    time.Duration(cfg.ICE.GatheringTimeout) * time.Second,
+		Disconnected: time.Duration(cfg.ICE.DisconnectedTimeout) * time.Second,
+		Failed:       time.Duration(cfg.ICE.FailedTimeout) * time.Second,
+		KeepAlive:    time.Duration(cfg.ICE.KeepAliveInterval) * time.Second,
+	}
+}
+
+// logLevel returns the configured log level; config.Load has already rejected invalid ones
+func logLevel(cfg *config.Config) logger.Level {
+	level, _ := logger.ParseLevel(cfg.LogLevel)
+	return level
+}
+
+// runDefaultMode runs the mode MODE names when no subcommand is given, so
+// that a bare argus-sdr only starts a server when it was configured to and
+// containers can pick their role through the environment. An explicit
+// subcommand always wins over MODE.
+func runDefaultMode(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if cfg.Mode == "" {
+		return fmt.Errorf("no mode given: run argus-sdr api, collector or receiver, or set MODE")
 	}
 
+	for _, mode := range []*cobra.Command{apiCmd, collectorCmd, receiverCmd} {
+		if mode.Name() == cfg.Mode {
+			log := logger.New()
+			log.SetLevel(logLevel(cfg))
+			log.Info("No subcommand given, running %s mode from MODE", cfg.Mode)
+			mode.Run(mode, args)
+			return nil
+		}
+	}
+	// config.Load has already rejected other modes
+	return nil
+}
+
+func main() {
 	if err := rootCmd.Execute(); err != nil {
 		log.Printf("Error: %v", err)
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
+
+func runCreateUser(cmd *cobra.Command, args []string) {
+	log := logger.New()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Failed to load configuration: %v", err)
+	}
+	log.SetLevel(logLevel(cfg))
+
+	// Validate input the same way the registration endpoint does
+	if _, err := mail.ParseAddress(newUserEmail); err != nil {
+		log.Fatal("Invalid email address %q", newUserEmail)
+	}
+	if newUserClientType != 1 && newUserClientType != 2 {
+		log.Fatal("Invalid client type %d: must be 1 (collector) or 2 (receiver)", newUserClientType)
+	}
+
+	password := newUserPassword
+	if password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			log.Fatal("Failed to read password: %v", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if len(password) < 6 {
+		log.Fatal("Password must be at least 6 characters")
+	}
+
+	role := models.RoleUser
+	if newUserAdmin {
+		role = models.RoleAdmin
+	}
+
+	db, err := database.Initialize(cfg.Database.Path, cfg.Database.BusyTimeout)
+	if err != nil {
+		log.Fatal("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	if err := database.Migrate(db); err != nil {
+		log.Fatal("Failed to run migrations: %v", err)
+	}
+
+	var existingID int
+	err = db.QueryRow("SELECT id FROM users WHERE email = ?", newUserEmail).Scan(&existingID)
+	if err == nil {
+		log.Fatal("User %s already exists (id %d)", newUserEmail, existingID)
+	}
+	if err != sql.ErrNoRows {
+		log.Fatal("Failed to check for existing user: %v", err)
+	}
+
+	hashedPassword, err := auth.HashPassword(password, cfg.Auth.BCryptCost)
+	if err != nil {
+		log.Fatal("Failed to hash password: %v", err)
+	}
+
+	result, err := db.Exec(
+		"INSERT INTO users (email, password_hash, client_type, role) VALUES (?, ?, ?, ?)",
+		newUserEmail, hashedPassword, newUserClientType, role,
+	)
+	if err != nil {
+		log.Fatal("Failed to create user: %v", err)
+	}
+
+	userID, _ := result.LastInsertId()
+	log.Info("Created user %s (id %d, client type %d, role %s) in %s", newUserEmail, userID, newUserClientType, role, cfg.Database.Path)
+}
@@ -1,15 +1,30 @@
 package config
 
 import (
+	"fmt"
+	"math"
+	"net"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
+
+	"argus-sdr/internal/geometry"
+	"argus-sdr/pkg/logger"
 )
 
 type Config struct {
 	// Common
-	Mode        string `env:"MODE" default:"api"`
+	Mode        string `env:"MODE"` // mode run without a subcommand
 	Environment string
 	LogLevel    string `env:"LOG_LEVEL" default:"info"`
+	// The API server keeps the last LogRecentLines log lines in memory for
+	// GET /api/admin/logs/recent when LogRecentEnabled is set
+	LogRecentEnabled bool `env:"LOG_RECENT_ENABLED" default:"false"`
+	LogRecentLines   int  `env:"LOG_RECENT_LINES" default:"1000"`
 
 	// Mode-specific configs
 	Server    ServerConfig
@@ -18,15 +33,150 @@ type Config struct {
 	Auth      AuthConfig
 	Collector CollectorConfig
 	Receiver  ReceiverConfig
+	ICE       ICEConfig
+	Storage   StorageConfig
+	Queues    QueueConfig
+	Webhook   WebhookConfig
 }
 
+// Fan-out modes
+const (
+	FanOutAuto   = "auto"   // Cache on the server when a request has more than one subscriber
+	FanOutAlways = "always" // Always cache on the server
+	FanOutNever  = "never"  // Always transfer peer-to-peer
+)
+
+// MaxCollectorTokenExpiry bounds collector token lifetime so a leaked token
+// can't be used forever
+const MaxCollectorTokenExpiry = 24 * 365 // hours
+
+// imageDigestPattern matches the content digest COLLECTOR_IMAGE_DIGEST pins
+var imageDigestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// Receiver geometry checks
+const (
+	GeometryCheckOff    = "off"    // Send requests without checking station geometry
+	GeometryCheckWarn   = "warn"   // Warn when the stations can't give a usable fix
+	GeometryCheckRefuse = "refuse" // Don't send a request the stations can't give a usable fix for
+)
+
+// Server roles
+const (
+	ServerRoleFull          = "full"           // Signaling plus HTTP download proxy and file caching
+	ServerRoleSignalingOnly = "signaling-only" // Auth and signaling only; files only move peer-to-peer
+)
+
 type ServerConfig struct {
 	Address string
 	Port    int
+	Role    string `env:"SERVER_ROLE" default:"full"`
+
+	// WebSocket liveness for collector and receiver connections
+	WSPingInterval int // seconds
+	WSPongTimeout  int // seconds
+
+	// MaxICECandidates caps the ICE candidates each peer may submit per session
+	MaxICECandidates int
+	// MaxSignalsReturned bounds the ICE candidates one GetSignals poll returns (0 means unlimited)
+	MaxSignalsReturned int
+	// ICEPollingEnabled keeps the deprecated HTTP polling signaling endpoints; WebSocket signaling is always on
+	ICEPollingEnabled bool `env:"ICE_POLLING_ENABLED" default:"true"`
+	// ICESessionPendingTTL fails ICE sessions still negotiating this long after
+	// their last signaling step (0 disables)
+	ICESessionPendingTTL int `env:"ICE_SESSION_PENDING_TTL_SECONDS" default:"120"` // seconds
+
+	// FanOutMode decides when collectors upload to the server cache instead of serving receivers peer-to-peer
+	FanOutMode string `env:"FANOUT_MODE" default:"auto"`
+	// FanOutUploadTimeout is how long receivers wait for a fan-out upload before falling back to WebRTC
+	FanOutUploadTimeout int `env:"FANOUT_UPLOAD_TIMEOUT_SECONDS" default:"120"` // seconds
+
+	// Type1ResponseTimeout is how long Type 2 endpoints wait for Type 1 clients to answer
+	Type1ResponseTimeout int // seconds
+
+	// Type1ReconcileInterval is how often the Type 1 connections stored in the
+	// database are checked against the live ones (0 disables)
+	Type1ReconcileInterval int `env:"TYPE1_RECONCILE_INTERVAL_SECONDS" default:"60"` // seconds
+
+	// RequestRetentionDays deletes data requests, their collector responses
+	// and cached files this many days after they were made (0 keeps them)
+	RequestRetentionDays int `env:"REQUEST_RETENTION_DAYS" default:"0"` // days
+
+	// ShutdownGrace is how long a shutdown waits for in-flight downloads and
+	// uploads before abandoning them
+	ShutdownGrace int `env:"SHUTDOWN_GRACE_SECONDS" default:"30"` // seconds
+
+	// TrustedProxies lists the proxy IPs/CIDRs whose X-Forwarded-For headers are trusted
+	TrustedProxies []string `env:"TRUSTED_PROXIES"`
+
+	// Maximum concurrent WebSocket connections per client kind (0 means unlimited)
+	MaxCollectorConnections int `env:"MAX_COLLECTOR_CONNECTIONS" default:"1000"`
+	MaxReceiverConnections  int `env:"MAX_RECEIVER_CONNECTIONS" default:"1000"`
+	MaxType1Connections     int `env:"MAX_TYPE1_CONNECTIONS" default:"1000"`
+
+	// A connected station only gets new requests while its heartbeat is recent,
+	// it isn't draining, it has disk space and, if required, its clock is synchronized
+	StationHeartbeatMaxAge  int  `env:"STATION_HEARTBEAT_MAX_AGE_SECONDS" default:"120"` // seconds
+	StationHeartbeatTimeout int  `env:"STATION_HEARTBEAT_TIMEOUT_SECONDS" default:"180"` // seconds; close the connection (0 disables)
+	StationMinFreeDiskMB    int  `env:"STATION_MIN_FREE_DISK_MB" default:"512"`
+	StationRequireClockSync bool `env:"STATION_REQUIRE_CLOCK_SYNC" default:"false"`
+
+	// A set of stations is usable for TDOA when its GDOP is at most
+	// StationGeometryMaxGDOP and no two stations are closer than StationGeometryMinBaseline
+	StationGeometryMaxGDOP     int `env:"STATION_GEOMETRY_MAX_GDOP" default:"4"`
+	StationGeometryMinBaseline int `env:"STATION_GEOMETRY_MIN_BASELINE_METERS" default:"1000"` // meters
+
+	// Data requests each user may make per UTC day, by client type; admins
+	// get DailyRequestQuotaAdmin whatever their client type (0 means unlimited)
+	DailyRequestQuotaCollector int `env:"DAILY_REQUEST_QUOTA_COLLECTOR" default:"0"`
+	DailyRequestQuotaReceiver  int `env:"DAILY_REQUEST_QUOTA_RECEIVER" default:"0"`
+	DailyRequestQuotaAdmin     int `env:"DAILY_REQUEST_QUOTA_ADMIN" default:"0"`
+
+	// Range a request's duration_seconds must be in
+	CaptureMinDuration int `env:"CAPTURE_MIN_DURATION_SECONDS" default:"1"`  // seconds
+	CaptureMaxDuration int `env:"CAPTURE_MAX_DURATION_SECONDS" default:"60"` // seconds
+
+	// MaxParametersBytes caps the length of a request's parameters
+	MaxParametersBytes int `env:"REQUEST_MAX_PARAMETERS_BYTES" default:"4096"`
+
+	// CaptureFilePattern is the glob collectors find a capture's file in their
+	// data directory with; they get it when they connect
+	CaptureFilePattern string `env:"CAPTURE_FILE_PATTERN" default:"*"`
+
+	// RetryAfter is the Retry-After hint sent with 503 responses (0 omits the header)
+	RetryAfter int `env:"RETRY_AFTER_SECONDS" default:"10"` // seconds
+
+	// NotificationQueueTTL is how long request notifications for receivers that
+	// aren't connected are kept for when they reconnect (0 disables the queue)
+	NotificationQueueTTL int `env:"NOTIFICATION_QUEUE_TTL_HOURS" default:"24"` // hours
+
+	// ReforwardMaxAge is how old a request a station never answered may be to
+	// be sent to it again when it reconnects; older ones are failed instead
+	// (0 leaves them alone)
+	ReforwardMaxAge int `env:"REQUEST_REFORWARD_MAX_AGE_SECONDS" default:"300"` // seconds
+
+	// Writes to receiver WebSockets get NotifyWriteTimeout each; failed ones are
+	// retried NotifyWriteRetries times NotifyWriteRetryDelay apart, and a
+	// connection is dropped after NotifyMaxWriteFailures consecutive failures
+	NotifyWriteTimeout     int `env:"NOTIFY_WRITE_TIMEOUT_SECONDS" default:"10"` // seconds
+	NotifyWriteRetries     int `env:"NOTIFY_WRITE_RETRIES" default:"2"`
+	NotifyWriteRetryDelay  int `env:"NOTIFY_WRITE_RETRY_DELAY_MS" default:"500"` // milliseconds
+	NotifyMaxWriteFailures int `env:"NOTIFY_MAX_WRITE_FAILURES" default:"3"`
+
+	// LongPollMaxTimeout caps how long GET /api/data/wait/:id holds a request
+	LongPollMaxTimeout int `env:"LONG_POLL_MAX_TIMEOUT_SECONDS" default:"60"` // seconds
+
+	// SelectionWeights decides which available stations get a request first
+	SelectionWeights SelectionWeights
+
+	// OutboundAllowedNetworks lists internal IPs/CIDRs the server may connect to
+	// for collector downloads and webhooks, which otherwise only reach public addresses
+	OutboundAllowedNetworks []string `env:"OUTBOUND_ALLOWED_NETWORKS"`
 }
 
 type DatabaseConfig struct {
 	Path string
+	// BusyTimeout is how long a write waits for another connection's lock
+	BusyTimeout int `env:"DATABASE_BUSY_TIMEOUT_MS" default:"5000"` // milliseconds
 }
 
 type SSLConfig struct {
@@ -37,9 +187,17 @@ type SSLConfig struct {
 }
 
 type AuthConfig struct {
-	JWTSecret     string
-	TokenExpiry   int // hours
-	BCryptCost    int
+	JWTSecret            string
+	TokenExpiry          int // hours
+	CollectorTokenExpiry int // hours, for collector (client_type 1) tokens
+	ReceiverTokenExpiry  int // hours, for receiver and web user (client_type 2) tokens
+	BCryptCost           int
+	AdminEmails          []string // users given the admin role when they log in, in addition to the role stored in the database
+
+	// AllowRegistration enables POST /api/auth/register; when false accounts must be provisioned by an admin
+	AllowRegistration bool `env:"ALLOW_REGISTRATION" default:"true"`
+	// RateLimit caps register and login attempts per client IP per minute (0 disables it)
+	RateLimit int `env:"AUTH_RATE_LIMIT_PER_MINUTE" default:"10"`
 }
 
 type CollectorConfig struct {
@@ -47,28 +205,268 @@ type CollectorConfig struct {
 	DataDir         string `env:"DATA_DIR" default:"./nice_data"`
 	ContainerImage  string `env:"CONTAINER_IMAGE" default:"argussdr/sdr-tdoa-df:release-0.3"`
 	APIServerURL    string `env:"API_SERVER_URL"`
+
+	// LogDockerCommand controls whether the (redacted) Docker command line is logged
+	LogDockerCommand bool `env:"LOG_DOCKER_COMMAND" default:"true"`
+	// ErrorOutputLimit bounds how many bytes of container output are sent back with an error response
+	ErrorOutputLimit int `env:"COLLECTOR_ERROR_OUTPUT_LIMIT" default:"2048"`
+
+	// ExitAfterDrain stops the collector once a drain has finished all in-flight work
+	ExitAfterDrain bool `env:"COLLECTOR_EXIT_AFTER_DRAIN" default:"false"`
+	// DrainTransferWait is how long a finished collection waits for its transfer during a drain
+	DrainTransferWait int `env:"COLLECTOR_DRAIN_TRANSFER_WAIT_SECONDS" default:"300"` // seconds
+	// AllowedParameters restricts which request parameters are passed to the collection container
+	AllowedParameters []string `env:"COLLECTOR_ALLOWED_PARAMETERS"`
+	// AllowedImages lists extra processing images a request may ask for; CONTAINER_IMAGE is always allowed
+	AllowedImages []string `env:"ALLOWED_IMAGES"`
+	// SDRModel is recorded in each capture's metadata
+	SDRModel string `env:"COLLECTOR_SDR_MODEL"`
+	// Latitude and Longitude locate the station's antenna in decimal degrees; the
+	// server uses them to rate the geometry of the stations a request goes to
+	Latitude  string `env:"COLLECTOR_LATITUDE"`
+	Longitude string `env:"COLLECTOR_LONGITUDE"`
+
+	// Resource limits for the collection container (empty or 0 disables a limit)
+	DockerMemory    string `env:"COLLECTOR_DOCKER_MEMORY" default:"2g"`
+	DockerCPUs      string `env:"COLLECTOR_DOCKER_CPUS" default:"2"`
+	DockerPidsLimit int    `env:"COLLECTOR_DOCKER_PIDS_LIMIT" default:"256"`
+	// Container filesystem: the request's directory is the only writable mount,
+	// InputDir is mounted read-only, and ReadOnlyRoot makes the image's own
+	// filesystem read-only with tmpfs mounts at TmpfsPaths
+	OutputMountPath string   `env:"COLLECTOR_OUTPUT_MOUNT_PATH" default:"/SDR-TDOA-DF/nice_data"`
+	InputDir        string   `env:"COLLECTOR_INPUT_DIR"`
+	InputMountPath  string   `env:"COLLECTOR_INPUT_MOUNT_PATH" default:"/SDR-TDOA-DF/input"`
+	ReadOnlyRoot    bool     `env:"COLLECTOR_READ_ONLY_ROOT" default:"false"`
+	TmpfsPaths      []string `env:"COLLECTOR_TMPFS_PATHS" default:"/tmp"`
+	// CollectionTimeout kills a collection that runs longer than this
+	CollectionTimeout int `env:"COLLECTOR_COLLECTION_TIMEOUT_SECONDS" default:"600"` // seconds
+	// CaptureGrace kills a collection with a duration_seconds once it runs this much longer than the duration
+	CaptureGrace int `env:"COLLECTOR_CAPTURE_GRACE_SECONDS" default:"60"` // seconds
+
+	// Local status server; disabled unless a port is set
+	StatusPort int    `env:"COLLECTOR_STATUS_PORT" default:"0"`
+	StatusBind string `env:"COLLECTOR_STATUS_BIND" default:"127.0.0.1"`
+
+	// UploadFiles uploads each capture to the server cache in addition to offering it over WebRTC
+	UploadFiles bool `env:"COLLECTOR_UPLOAD_FILES" default:"false"`
+	// DataRetention is how long a capture is kept after its last transfer (0 keeps captures forever)
+	DataRetention int `env:"COLLECTOR_DATA_RETENTION_SECONDS" default:"3600"` // seconds
+	// StreamMaxDuration ends capture streams that run longer than this (0 disables streaming)
+	StreamMaxDuration int `env:"COLLECTOR_STREAM_MAX_DURATION_SECONDS" default:"3600"` // seconds
+	// StreamMaxPacketLifeTime lets stream data channels drop messages not delivered in time (0 keeps them reliable)
+	StreamMaxPacketLifeTime int `env:"COLLECTOR_STREAM_MAX_PACKET_LIFETIME_MS" default:"0"` // milliseconds
+	// ValidateCaptures checks each collected file is a complete NPZ archive before offering it
+	ValidateCaptures bool `env:"COLLECTOR_VALIDATE_CAPTURES" default:"true"`
+
+	// BreakerThreshold consecutive failed collections make the collector reject
+	// requests and report itself unhealthy for BreakerCooldown (0 disables it)
+	BreakerThreshold int `env:"COLLECTOR_BREAKER_THRESHOLD" default:"5"`
+	BreakerCooldown  int `env:"COLLECTOR_BREAKER_COOLDOWN_SECONDS" default:"60"` // seconds
+
+	// PullImage pulls CONTAINER_IMAGE before the collector connects, so the
+	// first request doesn't pay for it; leave it off in air-gapped setups.
+	// ImageDigest pins the image to a digest (sha256:...) checked at startup.
+	PullImage        bool   `env:"COLLECTOR_PULL_IMAGE" default:"false"`
+	ImageDigest      string `env:"COLLECTOR_IMAGE_DIGEST"`
+	ImagePullTimeout int    `env:"COLLECTOR_IMAGE_PULL_TIMEOUT_SECONDS" default:"1800"` // seconds
+
+	// Custom CA bundle and client certificate for servers with an internal CA
+	TLSCAFile   string `env:"COLLECTOR_TLS_CA_FILE"`
+	TLSCertFile string `env:"COLLECTOR_TLS_CERT_FILE"`
+	TLSKeyFile  string `env:"COLLECTOR_TLS_KEY_FILE"`
+}
+
+// ICEConfig controls WebRTC connection timeouts for collectors and receivers,
+// and the STUN and TURN servers the API server hands out to them
+type ICEConfig struct {
+	GatheringTimeout    int `env:"ICE_GATHERING_TIMEOUT_SECONDS" default:"10"`   // seconds
+	DisconnectedTimeout int `env:"ICE_DISCONNECTED_TIMEOUT_SECONDS" default:"5"` // seconds
+	FailedTimeout       int `env:"ICE_FAILED_TIMEOUT_SECONDS" default:"15"`      // seconds
+	KeepAliveInterval   int `env:"ICE_KEEPALIVE_INTERVAL_SECONDS" default:"2"`   // seconds
+
+	// DataChannelLabel is the label of the data channel collectors open for file transfers
+	DataChannelLabel string `env:"DATA_CHANNEL_LABEL" default:"file-transfer"`
+
+	// STUN and TURN servers served on /api/ice/config. TURN credentials are
+	// generated per request from TURNSecret and expire after TURNCredentialTTL.
+	STUNURLs          []string `env:"ICE_STUN_URLS" default:"stun:stun.l.google.com:19302"`
+	TURNURLs          []string `env:"TURN_URLS"`
+	TURNSecret        string   `env:"TURN_SECRET"`
+	TURNCredentialTTL int      `env:"TURN_CREDENTIAL_TTL_SECONDS" default:"3600"` // seconds
+}
+
+// SelectionWeights sets how much each factor counts when the server orders
+// the stations a request can go to. Only their ratios matter; a factor with
+// weight 0 is ignored.
+type SelectionWeights struct {
+	Load     int `env:"SELECTION_WEIGHT_LOAD" default:"1" json:"load"`         // fewest requests in flight
+	Success  int `env:"SELECTION_WEIGHT_SUCCESS" default:"0" json:"success"`   // most recent requests delivered
+	Response int `env:"SELECTION_WEIGHT_RESPONSE" default:"0" json:"response"` // quickest to deliver
+	Disk     int `env:"SELECTION_WEIGHT_DISK" default:"0" json:"disk"`         // most free disk space
+}
+
+// Total is the sum of the weights
+func (w SelectionWeights) Total() int {
+	return w.Load + w.Success + w.Response + w.Disk
+}
+
+// StorageConfig controls the server-side cache of files uploaded by collectors
+type StorageConfig struct {
+	Dir           string `env:"CACHE_DIR" default:"./cache"`
+	MaxUploadSize int    `env:"MAX_UPLOAD_SIZE_MB" default:"512"` // MB
+	// MaxProxyDownloadSize bounds files proxied from collector download URLs (0 disables the limit)
+	MaxProxyDownloadSize int `env:"PROXY_MAX_DOWNLOAD_MB" default:"512"` // MB
+}
+
+// QueueConfig sizes buffered message queues and sets what happens when they fill up.
+// Overflow policies are "block", "drop-oldest" or "disconnect".
+type QueueConfig struct {
+	ReceiverNotificationBuffer   int    `env:"RECEIVER_NOTIFICATION_BUFFER" default:"10"`
+	ReceiverNotificationOverflow string `env:"RECEIVER_NOTIFICATION_OVERFLOW" default:"block"`
+	Type1SendBuffer              int    `env:"TYPE1_SEND_BUFFER" default:"256"`
+	Type1SendOverflow            string `env:"TYPE1_SEND_OVERFLOW" default:"drop-oldest"`
+	// BlockTimeout bounds how long the "block" policy waits before dropping a message
+	BlockTimeout int `env:"QUEUE_BLOCK_TIMEOUT_SECONDS" default:"5"` // seconds
+}
+
+// WebhookConfig controls delivery of request notifications to receivers' callback URLs
+type WebhookConfig struct {
+	Timeout     int `env:"WEBHOOK_TIMEOUT_SECONDS" default:"10"` // seconds, per attempt
+	MaxAttempts int `env:"WEBHOOK_MAX_ATTEMPTS" default:"5"`
+	// AllowPrivateAddresses permits callbacks to loopback and private networks (for testing only)
+	AllowPrivateAddresses bool `env:"WEBHOOK_ALLOW_PRIVATE_ADDRESSES" default:"false"`
 }
 
 type ReceiverConfig struct {
 	ReceiverID   string `env:"RECEIVER_ID"`
 	DownloadDir  string `env:"DOWNLOAD_DIR" default:"./downloads"`
 	APIServerURL string `env:"API_SERVER_URL"`
+	// Format is the file format to request: npz, csv or sigmf
+	Format string `env:"RECEIVER_FORMAT" default:"npz"`
+	// Image is the processing image to request (empty for each collector's default)
+	Image string `env:"RECEIVER_IMAGE"`
+	// Duration is how long the stations capture (0 for the image's default)
+	Duration int `env:"RECEIVER_DURATION_SECONDS" default:"0"` // seconds
+	// WriteManifest writes a JSON manifest of each request's downloads to the download directory
+	WriteManifest bool `env:"RECEIVER_WRITE_MANIFEST" default:"true"`
+	// Stream requests a continuous stream of captures, stopped after StreamFrames frames
+	// or StreamDuration (0 for no limit)
+	Stream         bool `env:"RECEIVER_STREAM" default:"false"`
+	StreamFrames   int  `env:"RECEIVER_STREAM_FRAMES" default:"0"`
+	StreamDuration int  `env:"RECEIVER_STREAM_DURATION_SECONDS" default:"0"` // seconds
+	// SingleStation requests data from only the best station and stops once it is downloaded
+	SingleStation bool `env:"RECEIVER_SINGLE_STATION" default:"false"`
+	// A WebRTC file transfer averaging less than TransferMinThroughput over
+	// TransferStallWindow is aborted (0 disables the check)
+	TransferMinThroughput int `env:"RECEIVER_TRANSFER_MIN_THROUGHPUT_KBPS" default:"16"` // KB/s
+	TransferStallWindow   int `env:"RECEIVER_TRANSFER_STALL_SECONDS" default:"30"`       // seconds
+	// TransferIdleTimeout aborts a WebRTC file transfer that receives no data for this long (0 disables it)
+	TransferIdleTimeout int `env:"RECEIVER_TRANSFER_IDLE_SECONDS" default:"15"` // seconds
+	// KeepPartialDownloads keeps failed downloads as <file>.partial instead of deleting them
+	KeepPartialDownloads bool `env:"KEEP_PARTIAL_DOWNLOADS" default:"false"`
+	// MaxConcurrentDownloads bounds how many stations are downloaded from at once (0 for no limit)
+	MaxConcurrentDownloads int `env:"RECEIVER_MAX_CONCURRENT_DOWNLOADS" default:"3"`
+	// GeometryCheck asks the server how well the stations a request would go to
+	// can locate a transmitter before sending it: off, warn or refuse
+	GeometryCheck string `env:"RECEIVER_GEOMETRY_CHECK" default:"off"`
+	// AllowPartialReliability accepts stream data channels that may drop messages
+	AllowPartialReliability bool `env:"RECEIVER_ALLOW_PARTIAL_RELIABILITY" default:"false"`
+	// MetadataOnly asks stations for a preview of each file first; TriageCommand
+	// decides from it whether to fetch the file (without one, no file is fetched)
+	MetadataOnly  bool   `env:"RECEIVER_METADATA_ONLY" default:"false"`
+	TriageCommand string `env:"RECEIVER_TRIAGE_COMMAND"`
+
+	// ICERestarts is how many times a transfer's failed ICE connection is restarted (0 disables it)
+	ICERestarts int `env:"RECEIVER_ICE_RESTARTS" default:"2"`
 }
 
 func Load() (*Config, error) {
 	cfg := &Config{
 		// Common
-		Mode:        getEnv("MODE", "api"),
+		Mode:        getEnv("MODE", ""),
 		Environment: getEnv("ENVIRONMENT", "production"),
 		LogLevel:    getEnv("LOG_LEVEL", "info"),
 
+		LogRecentEnabled: getEnvBool("LOG_RECENT_ENABLED", false),
+		LogRecentLines:   getEnvInt("LOG_RECENT_LINES", 1000),
+
 		// API Server
 		Server: ServerConfig{
 			Address: getEnv("SERVER_ADDRESS", ":8080"),
 			Port:    getEnvInt("SERVER_PORT", 8080),
+			Role:    getEnv("SERVER_ROLE", ServerRoleFull),
+
+			WSPingInterval: getEnvInt("WS_PING_INTERVAL_SECONDS", 30),
+			WSPongTimeout:  getEnvInt("WS_PONG_TIMEOUT_SECONDS", 75),
+
+			MaxICECandidates: getEnvInt("ICE_MAX_CANDIDATES_PER_SESSION", 50),
+
+			MaxSignalsReturned: getEnvInt("ICE_MAX_SIGNALS_RETURNED", 50),
+			ICEPollingEnabled:  getEnvBool("ICE_POLLING_ENABLED", true),
+
+			ICESessionPendingTTL: getEnvInt("ICE_SESSION_PENDING_TTL_SECONDS", 120),
+
+			FanOutMode:          getEnv("FANOUT_MODE", FanOutAuto),
+			FanOutUploadTimeout: getEnvInt("FANOUT_UPLOAD_TIMEOUT_SECONDS", 120),
+
+			Type1ResponseTimeout: getEnvInt("TYPE1_RESPONSE_TIMEOUT_SECONDS", 10),
+
+			Type1ReconcileInterval: getEnvInt("TYPE1_RECONCILE_INTERVAL_SECONDS", 60),
+
+			RequestRetentionDays: getEnvInt("REQUEST_RETENTION_DAYS", 0),
+
+			ShutdownGrace: getEnvInt("SHUTDOWN_GRACE_SECONDS", 30),
+
+			TrustedProxies: getEnvList("TRUSTED_PROXIES", nil),
+
+			MaxCollectorConnections: getEnvInt("MAX_COLLECTOR_CONNECTIONS", 1000),
+			MaxReceiverConnections:  getEnvInt("MAX_RECEIVER_CONNECTIONS", 1000),
+			MaxType1Connections:     getEnvInt("MAX_TYPE1_CONNECTIONS", 1000),
+
+			StationHeartbeatMaxAge:  getEnvInt("STATION_HEARTBEAT_MAX_AGE_SECONDS", 120),
+			StationHeartbeatTimeout: getEnvInt("STATION_HEARTBEAT_TIMEOUT_SECONDS", 180),
+			StationMinFreeDiskMB:    getEnvInt("STATION_MIN_FREE_DISK_MB", 512),
+			StationRequireClockSync: getEnvBool("STATION_REQUIRE_CLOCK_SYNC", false),
+
+			StationGeometryMaxGDOP:     getEnvInt("STATION_GEOMETRY_MAX_GDOP", 4),
+			StationGeometryMinBaseline: getEnvInt("STATION_GEOMETRY_MIN_BASELINE_METERS", 1000),
+
+			DailyRequestQuotaCollector: getEnvInt("DAILY_REQUEST_QUOTA_COLLECTOR", 0),
+			DailyRequestQuotaReceiver:  getEnvInt("DAILY_REQUEST_QUOTA_RECEIVER", 0),
+			DailyRequestQuotaAdmin:     getEnvInt("DAILY_REQUEST_QUOTA_ADMIN", 0),
+
+			CaptureMinDuration: getEnvInt("CAPTURE_MIN_DURATION_SECONDS", 1),
+			CaptureMaxDuration: getEnvInt("CAPTURE_MAX_DURATION_SECONDS", 60),
+
+			MaxParametersBytes: getEnvInt("REQUEST_MAX_PARAMETERS_BYTES", 4096),
+
+			CaptureFilePattern: getEnv("CAPTURE_FILE_PATTERN", "*"),
+
+			RetryAfter: getEnvInt("RETRY_AFTER_SECONDS", 10),
+
+			NotificationQueueTTL: getEnvInt("NOTIFICATION_QUEUE_TTL_HOURS", 24),
+
+			ReforwardMaxAge: getEnvInt("REQUEST_REFORWARD_MAX_AGE_SECONDS", 300),
+
+			NotifyWriteTimeout:     getEnvInt("NOTIFY_WRITE_TIMEOUT_SECONDS", 10),
+			NotifyWriteRetries:     getEnvInt("NOTIFY_WRITE_RETRIES", 2),
+			NotifyWriteRetryDelay:  getEnvInt("NOTIFY_WRITE_RETRY_DELAY_MS", 500),
+			NotifyMaxWriteFailures: getEnvInt("NOTIFY_MAX_WRITE_FAILURES", 3),
+
+			LongPollMaxTimeout: getEnvInt("LONG_POLL_MAX_TIMEOUT_SECONDS", 60),
+
+			SelectionWeights: SelectionWeights{
+				Load:     getEnvInt("SELECTION_WEIGHT_LOAD", 1),
+				Success:  getEnvInt("SELECTION_WEIGHT_SUCCESS", 0),
+				Response: getEnvInt("SELECTION_WEIGHT_RESPONSE", 0),
+				Disk:     getEnvInt("SELECTION_WEIGHT_DISK", 0),
+			},
+
+			OutboundAllowedNetworks: getEnvList("OUTBOUND_ALLOWED_NETWORKS", nil),
 		},
 		Database: DatabaseConfig{
-			Path: getEnv("DATABASE_PATH", "/config/sdr.db"),
+			Path:        getEnv("DATABASE_PATH", "/config/sdr.db"),
+			BusyTimeout: getEnvInt("DATABASE_BUSY_TIMEOUT_MS", 5000),
 		},
 		SSL: SSLConfig{
 			Enabled:  getEnvBool("SSL_ENABLED", false),
@@ -80,6 +478,10 @@ func Load() (*Config, error) {
 			JWTSecret:   getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
 			TokenExpiry: getEnvInt("TOKEN_EXPIRY_HOURS", 24),
 			BCryptCost:  getEnvInt("BCRYPT_COST", 12),
+			AdminEmails: getEnvList("ADMIN_EMAILS", nil),
+
+			AllowRegistration: getEnvBool("ALLOW_REGISTRATION", true),
+			RateLimit:         getEnvInt("AUTH_RATE_LIMIT_PER_MINUTE", 10),
 		},
 
 		// Collector Client
@@ -88,6 +490,52 @@ func Load() (*Config, error) {
 			DataDir:        getEnv("DATA_DIR", "./nice_data"),
 			ContainerImage: getEnv("CONTAINER_IMAGE", "argussdr/sdr-tdoa-df:release-0.4"),
 			APIServerURL:   getEnv("API_SERVER_URL", "http://localhost:8080"),
+
+			LogDockerCommand: getEnvBool("LOG_DOCKER_COMMAND", true),
+			ErrorOutputLimit: getEnvInt("COLLECTOR_ERROR_OUTPUT_LIMIT", 2048),
+
+			ExitAfterDrain:    getEnvBool("COLLECTOR_EXIT_AFTER_DRAIN", false),
+			DrainTransferWait: getEnvInt("COLLECTOR_DRAIN_TRANSFER_WAIT_SECONDS", 300),
+			AllowedParameters: getEnvList("COLLECTOR_ALLOWED_PARAMETERS", nil),
+			AllowedImages:     getEnvList("ALLOWED_IMAGES", nil),
+			SDRModel:          getEnv("COLLECTOR_SDR_MODEL", ""),
+			Latitude:          getEnv("COLLECTOR_LATITUDE", ""),
+			Longitude:         getEnv("COLLECTOR_LONGITUDE", ""),
+
+			DockerMemory:      getEnv("COLLECTOR_DOCKER_MEMORY", "2g"),
+			DockerCPUs:        getEnv("COLLECTOR_DOCKER_CPUS", "2"),
+			DockerPidsLimit:   getEnvInt("COLLECTOR_DOCKER_PIDS_LIMIT", 256),
+			CollectionTimeout: getEnvInt("COLLECTOR_COLLECTION_TIMEOUT_SECONDS", 600),
+
+			CaptureGrace: getEnvInt("COLLECTOR_CAPTURE_GRACE_SECONDS", 60),
+
+			OutputMountPath: getEnv("COLLECTOR_OUTPUT_MOUNT_PATH", "/SDR-TDOA-DF/nice_data"),
+			InputDir:        getEnv("COLLECTOR_INPUT_DIR", ""),
+			InputMountPath:  getEnv("COLLECTOR_INPUT_MOUNT_PATH", "/SDR-TDOA-DF/input"),
+			ReadOnlyRoot:    getEnvBool("COLLECTOR_READ_ONLY_ROOT", false),
+			TmpfsPaths:      getEnvList("COLLECTOR_TMPFS_PATHS", []string{"/tmp"}),
+
+			StatusPort: getEnvInt("COLLECTOR_STATUS_PORT", 0),
+			StatusBind: getEnv("COLLECTOR_STATUS_BIND", "127.0.0.1"),
+
+			UploadFiles:   getEnvBool("COLLECTOR_UPLOAD_FILES", false),
+			DataRetention: getEnvInt("COLLECTOR_DATA_RETENTION_SECONDS", 3600),
+
+			StreamMaxDuration: getEnvInt("COLLECTOR_STREAM_MAX_DURATION_SECONDS", 3600),
+			ValidateCaptures:  getEnvBool("COLLECTOR_VALIDATE_CAPTURES", true),
+
+			StreamMaxPacketLifeTime: getEnvInt("COLLECTOR_STREAM_MAX_PACKET_LIFETIME_MS", 0),
+
+			BreakerThreshold: getEnvInt("COLLECTOR_BREAKER_THRESHOLD", 5),
+			BreakerCooldown:  getEnvInt("COLLECTOR_BREAKER_COOLDOWN_SECONDS", 60),
+
+			PullImage:        getEnvBool("COLLECTOR_PULL_IMAGE", false),
+			ImageDigest:      getEnv("COLLECTOR_IMAGE_DIGEST", ""),
+			ImagePullTimeout: getEnvInt("COLLECTOR_IMAGE_PULL_TIMEOUT_SECONDS", 1800),
+
+			TLSCAFile:   getEnv("COLLECTOR_TLS_CA_FILE", ""),
+			TLSCertFile: getEnv("COLLECTOR_TLS_CERT_FILE", ""),
+			TLSKeyFile:  getEnv("COLLECTOR_TLS_KEY_FILE", ""),
 		},
 
 		// Receiver Client
@@ -95,12 +543,367 @@ func Load() (*Config, error) {
 			ReceiverID:   getEnv("RECEIVER_ID", ""),
 			DownloadDir:  getEnv("DOWNLOAD_DIR", "./downloads"),
 			APIServerURL: getEnv("API_SERVER_URL", "http://localhost:8080"),
+			Format:       getEnv("RECEIVER_FORMAT", "npz"),
+			Image:        getEnv("RECEIVER_IMAGE", ""),
+
+			Duration: getEnvInt("RECEIVER_DURATION_SECONDS", 0),
+
+			WriteManifest: getEnvBool("RECEIVER_WRITE_MANIFEST", true),
+
+			Stream:         getEnvBool("RECEIVER_STREAM", false),
+			StreamFrames:   getEnvInt("RECEIVER_STREAM_FRAMES", 0),
+			StreamDuration: getEnvInt("RECEIVER_STREAM_DURATION_SECONDS", 0),
+
+			SingleStation: getEnvBool("RECEIVER_SINGLE_STATION", false),
+
+			TransferMinThroughput: getEnvInt("RECEIVER_TRANSFER_MIN_THROUGHPUT_KBPS", 16),
+			TransferStallWindow:   getEnvInt("RECEIVER_TRANSFER_STALL_SECONDS", 30),
+			TransferIdleTimeout:   getEnvInt("RECEIVER_TRANSFER_IDLE_SECONDS", 15),
+
+			KeepPartialDownloads:   getEnvBool("KEEP_PARTIAL_DOWNLOADS", false),
+			MaxConcurrentDownloads: getEnvInt("RECEIVER_MAX_CONCURRENT_DOWNLOADS", 3),
+
+			GeometryCheck:           getEnv("RECEIVER_GEOMETRY_CHECK", GeometryCheckOff),
+			AllowPartialReliability: getEnvBool("RECEIVER_ALLOW_PARTIAL_RELIABILITY", false),
+
+			MetadataOnly:  getEnvBool("RECEIVER_METADATA_ONLY", false),
+			TriageCommand: getEnv("RECEIVER_TRIAGE_COMMAND", ""),
+
+			ICERestarts: getEnvInt("RECEIVER_ICE_RESTARTS", 2),
+		},
+
+		// WebRTC (collector and receiver)
+		ICE: ICEConfig{
+			GatheringTimeout:    getEnvInt("ICE_GATHERING_TIMEOUT_SECONDS", 10),
+			DisconnectedTimeout: getEnvInt("ICE_DISCONNECTED_TIMEOUT_SECONDS", 5),
+			FailedTimeout:       getEnvInt("ICE_FAILED_TIMEOUT_SECONDS", 15),
+			KeepAliveInterval:   getEnvInt("ICE_KEEPALIVE_INTERVAL_SECONDS", 2),
+
+			DataChannelLabel: getEnv("DATA_CHANNEL_LABEL", "file-transfer"),
+
+			STUNURLs:          getEnvList("ICE_STUN_URLS", []string{"stun:stun.l.google.com:19302"}),
+			TURNURLs:          getEnvList("TURN_URLS", nil),
+			TURNSecret:        getEnv("TURN_SECRET", ""),
+			TURNCredentialTTL: getEnvInt("TURN_CREDENTIAL_TTL_SECONDS", 3600),
+		},
+
+		// Server file cache
+		Storage: StorageConfig{
+			Dir:           getEnv("CACHE_DIR", "./cache"),
+			MaxUploadSize: getEnvInt("MAX_UPLOAD_SIZE_MB", 512),
+
+			MaxProxyDownloadSize: getEnvInt("PROXY_MAX_DOWNLOAD_MB", 512),
+		},
+
+		// Message queues
+		Queues: QueueConfig{
+			ReceiverNotificationBuffer:   getEnvInt("RECEIVER_NOTIFICATION_BUFFER", 10),
+			ReceiverNotificationOverflow: getEnv("RECEIVER_NOTIFICATION_OVERFLOW", "block"),
+			Type1SendBuffer:              getEnvInt("TYPE1_SEND_BUFFER", 256),
+			Type1SendOverflow:            getEnv("TYPE1_SEND_OVERFLOW", "drop-oldest"),
+			BlockTimeout:                 getEnvInt("QUEUE_BLOCK_TIMEOUT_SECONDS", 5),
+		},
+
+		// Request completion webhooks
+		Webhook: WebhookConfig{
+			Timeout:               getEnvInt("WEBHOOK_TIMEOUT_SECONDS", 10),
+			MaxAttempts:           getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5),
+			AllowPrivateAddresses: getEnvBool("WEBHOOK_ALLOW_PRIVATE_ADDRESSES", false),
 		},
 	}
 
+	// Per-client-type expiries fall back to TOKEN_EXPIRY_HOURS
+	cfg.Auth.CollectorTokenExpiry = getEnvInt("COLLECTOR_TOKEN_EXPIRY_HOURS", cfg.Auth.TokenExpiry)
+	cfg.Auth.ReceiverTokenExpiry = getEnvInt("RECEIVER_TOKEN_EXPIRY_HOURS", cfg.Auth.TokenExpiry)
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
+// validate checks configuration values that have a fixed set of options
+func (c *Config) validate() error {
+	if _, err := logger.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("invalid LOG_LEVEL %q: must be \"debug\", \"info\", \"warn\" or \"error\"", c.LogLevel)
+	}
+	if c.LogRecentEnabled && c.LogRecentLines <= 0 {
+		return fmt.Errorf("LOG_RECENT_LINES must be greater than 0 when LOG_RECENT_ENABLED is set")
+	}
+
+	switch c.Mode {
+	case "", "api", "collector", "receiver":
+	default:
+		return fmt.Errorf("invalid MODE %q: must be \"api\", \"collector\" or \"receiver\"", c.Mode)
+	}
+
+	switch c.Server.Role {
+	case ServerRoleFull, ServerRoleSignalingOnly:
+	default:
+		return fmt.Errorf("invalid SERVER_ROLE %q: must be %q or %q", c.Server.Role, ServerRoleFull, ServerRoleSignalingOnly)
+	}
+
+	switch c.Server.FanOutMode {
+	case FanOutAuto, FanOutAlways, FanOutNever:
+	default:
+		return fmt.Errorf("invalid FANOUT_MODE %q: must be %q, %q or %q", c.Server.FanOutMode, FanOutAuto, FanOutAlways, FanOutNever)
+	}
+
+	for name, policy := range map[string]string{
+		"RECEIVER_NOTIFICATION_OVERFLOW": c.Queues.ReceiverNotificationOverflow,
+		"TYPE1_SEND_OVERFLOW":            c.Queues.Type1SendOverflow,
+	} {
+		switch policy {
+		case "block", "drop-oldest", "disconnect":
+		default:
+			return fmt.Errorf("invalid %s %q: must be \"block\", \"drop-oldest\" or \"disconnect\"", name, policy)
+		}
+	}
+
+	for name, value := range map[string]int{
+		"ICE_MAX_SIGNALS_RETURNED":              c.Server.MaxSignalsReturned,
+		"COLLECTOR_STREAM_MAX_DURATION_SECONDS": c.Collector.StreamMaxDuration,
+		"RECEIVER_STREAM_FRAMES":                c.Receiver.StreamFrames,
+		"RECEIVER_STREAM_DURATION_SECONDS":      c.Receiver.StreamDuration,
+		"RECEIVER_TRANSFER_MIN_THROUGHPUT_KBPS": c.Receiver.TransferMinThroughput,
+		"RECEIVER_TRANSFER_IDLE_SECONDS":        c.Receiver.TransferIdleTimeout,
+		"RECEIVER_MAX_CONCURRENT_DOWNLOADS":     c.Receiver.MaxConcurrentDownloads,
+		"STATION_MIN_FREE_DISK_MB":              c.Server.StationMinFreeDiskMB,
+		"STATION_GEOMETRY_MIN_BASELINE_METERS":  c.Server.StationGeometryMinBaseline,
+		"DAILY_REQUEST_QUOTA_COLLECTOR":         c.Server.DailyRequestQuotaCollector,
+		"DAILY_REQUEST_QUOTA_RECEIVER":          c.Server.DailyRequestQuotaReceiver,
+		"DAILY_REQUEST_QUOTA_ADMIN":             c.Server.DailyRequestQuotaAdmin,
+		"NOTIFICATION_QUEUE_TTL_HOURS":          c.Server.NotificationQueueTTL,
+		"REQUEST_REFORWARD_MAX_AGE_SECONDS":     c.Server.ReforwardMaxAge,
+		"NOTIFY_WRITE_RETRIES":                  c.Server.NotifyWriteRetries,
+		"NOTIFY_WRITE_RETRY_DELAY_MS":           c.Server.NotifyWriteRetryDelay,
+		"CAPTURE_MIN_DURATION_SECONDS":          c.Server.CaptureMinDuration,
+		"COLLECTOR_CAPTURE_GRACE_SECONDS":       c.Collector.CaptureGrace,
+		"RECEIVER_DURATION_SECONDS":             c.Receiver.Duration,
+		"SELECTION_WEIGHT_LOAD":                 c.Server.SelectionWeights.Load,
+		"SELECTION_WEIGHT_SUCCESS":              c.Server.SelectionWeights.Success,
+		"SELECTION_WEIGHT_RESPONSE":             c.Server.SelectionWeights.Response,
+		"SELECTION_WEIGHT_DISK":                 c.Server.SelectionWeights.Disk,
+		"STATION_HEARTBEAT_TIMEOUT_SECONDS":     c.Server.StationHeartbeatTimeout,
+		"TYPE1_RECONCILE_INTERVAL_SECONDS":      c.Server.Type1ReconcileInterval,
+		"ICE_SESSION_PENDING_TTL_SECONDS":       c.Server.ICESessionPendingTTL,
+		"REQUEST_RETENTION_DAYS":                c.Server.RequestRetentionDays,
+		"SHUTDOWN_GRACE_SECONDS":                c.Server.ShutdownGrace,
+		"COLLECTOR_BREAKER_THRESHOLD":           c.Collector.BreakerThreshold,
+		"COLLECTOR_BREAKER_COOLDOWN_SECONDS":    c.Collector.BreakerCooldown,
+		"RECEIVER_ICE_RESTARTS":                 c.Receiver.ICERestarts,
+		"COLLECTOR_IMAGE_PULL_TIMEOUT_SECONDS":  c.Collector.ImagePullTimeout,
+	} {
+		if value < 0 {
+			return fmt.Errorf("invalid %s %d: must not be negative", name, value)
+		}
+	}
+
+	if c.Collector.BreakerThreshold > 0 && c.Collector.BreakerCooldown == 0 {
+		return fmt.Errorf("invalid COLLECTOR_BREAKER_COOLDOWN_SECONDS 0: must be positive while COLLECTOR_BREAKER_THRESHOLD is set")
+	}
+
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(proxy); err != nil {
+			return fmt.Errorf("invalid TRUSTED_PROXIES entry %q: must be an IP address or CIDR", proxy)
+		}
+	}
+
+	for _, network := range c.Server.OutboundAllowedNetworks {
+		if net.ParseIP(network) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(network); err != nil {
+			return fmt.Errorf("invalid OUTBOUND_ALLOWED_NETWORKS entry %q: must be an IP address or CIDR", network)
+		}
+	}
+
+	if c.Receiver.TransferMinThroughput > 0 && c.Receiver.TransferStallWindow <= 0 {
+		return fmt.Errorf("RECEIVER_TRANSFER_STALL_SECONDS must be positive when RECEIVER_TRANSFER_MIN_THROUGHPUT_KBPS is set")
+	}
+
+	if len(c.ICE.TURNURLs) > 0 && c.ICE.TURNSecret == "" {
+		return fmt.Errorf("TURN_SECRET is required when TURN_URLS is set")
+	}
+	if c.ICE.TURNCredentialTTL <= 0 {
+		return fmt.Errorf("TURN_CREDENTIAL_TTL_SECONDS must be positive")
+	}
+
+	if c.Server.StationHeartbeatMaxAge <= 0 {
+		return fmt.Errorf("STATION_HEARTBEAT_MAX_AGE_SECONDS must be positive")
+	}
+	// Collectors send a heartbeat every 30 seconds
+	if c.Server.StationHeartbeatTimeout > 0 && c.Server.StationHeartbeatTimeout <= 30 {
+		return fmt.Errorf("STATION_HEARTBEAT_TIMEOUT_SECONDS must be more than 30 or 0")
+	}
+	if c.Server.CaptureMaxDuration < c.Server.CaptureMinDuration {
+		return fmt.Errorf("CAPTURE_MAX_DURATION_SECONDS must not be less than CAPTURE_MIN_DURATION_SECONDS")
+	}
+	if c.Server.MaxParametersBytes <= 0 {
+		return fmt.Errorf("REQUEST_MAX_PARAMETERS_BYTES must be positive")
+	}
+	if c.Server.NotifyWriteTimeout <= 0 {
+		return fmt.Errorf("NOTIFY_WRITE_TIMEOUT_SECONDS must be positive")
+	}
+	if c.Server.NotifyMaxWriteFailures <= 0 {
+		return fmt.Errorf("NOTIFY_MAX_WRITE_FAILURES must be positive")
+	}
+	if c.Server.LongPollMaxTimeout <= 0 {
+		return fmt.Errorf("LONG_POLL_MAX_TIMEOUT_SECONDS must be positive")
+	}
+	if c.Server.SelectionWeights.Total() <= 0 {
+		return fmt.Errorf("at least one SELECTION_WEIGHT_* must be positive")
+	}
+	if _, err := filepath.Match(c.Server.CaptureFilePattern, ""); err != nil {
+		return fmt.Errorf("invalid CAPTURE_FILE_PATTERN %q: %w", c.Server.CaptureFilePattern, err)
+	}
+
+	// SCTP carries the packet lifetime as 16 bits
+	if c.Collector.StreamMaxPacketLifeTime < 0 || c.Collector.StreamMaxPacketLifeTime > math.MaxUint16 {
+		return fmt.Errorf("invalid COLLECTOR_STREAM_MAX_PACKET_LIFETIME_MS %d: must be between 0 and %d", c.Collector.StreamMaxPacketLifeTime, math.MaxUint16)
+	}
+
+	if c.Server.StationGeometryMaxGDOP <= 0 {
+		return fmt.Errorf("STATION_GEOMETRY_MAX_GDOP must be positive")
+	}
+
+	switch c.Receiver.GeometryCheck {
+	case GeometryCheckOff, GeometryCheckWarn, GeometryCheckRefuse:
+	default:
+		return fmt.Errorf("invalid RECEIVER_GEOMETRY_CHECK %q: must be %q, %q or %q", c.Receiver.GeometryCheck, GeometryCheckOff, GeometryCheckWarn, GeometryCheckRefuse)
+	}
+
+	if err := c.Collector.validateMounts(); err != nil {
+		return err
+	}
+
+	if _, err := c.Collector.Location(); err != nil {
+		return err
+	}
+
+	if c.Collector.ImageDigest != "" && !imageDigestPattern.MatchString(c.Collector.ImageDigest) {
+		return fmt.Errorf("invalid COLLECTOR_IMAGE_DIGEST %q: must be sha256: followed by 64 hex digits", c.Collector.ImageDigest)
+	}
+
+	if (c.Collector.TLSCertFile == "") != (c.Collector.TLSKeyFile == "") {
+		return fmt.Errorf("COLLECTOR_TLS_CERT_FILE and COLLECTOR_TLS_KEY_FILE must be set together")
+	}
+
+	if c.Webhook.Timeout <= 0 || c.Webhook.MaxAttempts <= 0 {
+		return fmt.Errorf("WEBHOOK_TIMEOUT_SECONDS and WEBHOOK_MAX_ATTEMPTS must be positive")
+	}
+
+	if c.Auth.TokenExpiry <= 0 || c.Auth.ReceiverTokenExpiry <= 0 || c.Auth.CollectorTokenExpiry <= 0 {
+		return fmt.Errorf("token expiry hours must be positive")
+	}
+	if c.Auth.CollectorTokenExpiry > MaxCollectorTokenExpiry {
+		return fmt.Errorf("invalid COLLECTOR_TOKEN_EXPIRY_HOURS %d: must be at most %d", c.Auth.CollectorTokenExpiry, MaxCollectorTokenExpiry)
+	}
+
+	return nil
+}
+
+// validateMounts checks the container paths the collector mounts into the
+// collection container: they must be absolute and mustn't overlap, or a
+// writable mount could hide or shadow a read-only one
+func (c CollectorConfig) validateMounts() error {
+	type mount struct{ name, path string }
+	mounts := []mount{{"COLLECTOR_OUTPUT_MOUNT_PATH", c.OutputMountPath}}
+	if c.InputDir != "" {
+		mounts = append(mounts, mount{"COLLECTOR_INPUT_MOUNT_PATH", c.InputMountPath})
+	}
+	if c.ReadOnlyRoot {
+		for _, tmpfs := range c.TmpfsPaths {
+			mounts = append(mounts, mount{"COLLECTOR_TMPFS_PATHS entry", tmpfs})
+		}
+	}
+	for i, m := range mounts {
+		if !path.IsAbs(m.path) {
+			return fmt.Errorf("invalid %s %q: must be an absolute container path", m.name, m.path)
+		}
+		for _, other := range mounts[:i] {
+			a, b := path.Clean(m.path), path.Clean(other.path)
+			if pathWithin(a, b) || pathWithin(b, a) {
+				return fmt.Errorf("%s %q overlaps %s %q", m.name, m.path, other.name, other.path)
+			}
+		}
+	}
+	return nil
+}
+
+// Location returns the station's configured position, or nil if
+// COLLECTOR_LATITUDE and COLLECTOR_LONGITUDE aren't set
+func (c CollectorConfig) Location() (*geometry.Position, error) {
+	if c.Latitude == "" && c.Longitude == "" {
+		return nil, nil
+	}
+	if c.Latitude == "" || c.Longitude == "" {
+		return nil, fmt.Errorf("COLLECTOR_LATITUDE and COLLECTOR_LONGITUDE must be set together")
+	}
+	latitude, err := strconv.ParseFloat(c.Latitude, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid COLLECTOR_LATITUDE %q: must be decimal degrees", c.Latitude)
+	}
+	longitude, err := strconv.ParseFloat(c.Longitude, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid COLLECTOR_LONGITUDE %q: must be decimal degrees", c.Longitude)
+	}
+	location := geometry.Position{Latitude: latitude, Longitude: longitude}
+	if err := location.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid collector location: %w", err)
+	}
+	return &location, nil
+}
+
+// pathWithin reports whether p is dir or inside it
+func pathWithin(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// TokenExpiryFor returns how long tokens issued to the given client type are valid
+func (a AuthConfig) TokenExpiryFor(clientType int) time.Duration {
+	hours := a.TokenExpiry
+	switch clientType {
+	case 1:
+		hours = a.CollectorTokenExpiry
+	case 2:
+		hours = a.ReceiverTokenExpiry
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// DailyRequestQuotaFor returns how many data requests a user may make per UTC
+// day, 0 meaning no limit. Admins get the admin quota whatever their client type.
+func (s ServerConfig) DailyRequestQuotaFor(clientType int, admin bool) int {
+	switch {
+	case admin:
+		return s.DailyRequestQuotaAdmin
+	case clientType == 1:
+		return s.DailyRequestQuotaCollector
+	case clientType == 2:
+		return s.DailyRequestQuotaReceiver
+	}
+	return 0
+}
+
+// IsSignalingOnly reports whether the server only handles auth and signaling
+func (s ServerConfig) IsSignalingOnly() bool {
+	return s.Role == ServerRoleSignalingOnly
+}
+
+// StatusAddress returns the listen address of the collector status server,
+// or an empty string when it is disabled
+func (c CollectorConfig) StatusAddress() string {
+	if c.StatusPort <= 0 {
+		return ""
+	}
+	return net.JoinHostPort(c.StatusBind, strconv.Itoa(c.StatusPort))
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -125,3 +928,16 @@ func getEnvBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getEnvList(key string, defaultValue []string) []string {
+	if value := os.Getenv(key); value != "" {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+	return defaultValue
+}
@@ -6,22 +6,86 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// Level is the lowest severity a Logger writes
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// ParseLevel parses a LOG_LEVEL value: debug, info, warn (or warning) or error
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q: must be debug, info, warn or error", s)
+}
+
 type Logger struct {
 	*log.Logger
+	level  atomic.Int32 // Level; read by every log call, changed at runtime by SetLevel
+	writer *timestampWriter
 }
 
+// New returns a Logger writing info and above until SetLevel is called
 func New() *Logger {
+	writer := &timestampWriter{}
 	logger := log.New(os.Stdout, "", 0)
-	logger.SetOutput(&timestampWriter{})
-	return &Logger{
+	logger.SetOutput(writer)
+	l := &Logger{
 		Logger: logger,
+		writer: writer,
 	}
+	l.level.Store(int32(LevelInfo))
+	return l
 }
 
-type timestampWriter struct{}
+// SetLevel changes the lowest severity written; safe to call while logging
+func (l *Logger) SetLevel(level Level) {
+	l.level.Store(int32(level))
+}
+
+// Level returns the lowest severity written
+func (l *Logger) Level() Level {
+	return Level(l.level.Load())
+}
+
+func (l *Logger) enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+type timestampWriter struct {
+	recent atomic.Pointer[recentBuffer] // nil unless KeepRecent enabled it
+}
 
 func (w *timestampWriter) Write(p []byte) (n int, err error) {
 	// Get caller info for file:line
@@ -32,29 +96,46 @@ func (w *timestampWriter) Write(p []byte) (n int, err error) {
 	}
 	
 	// Format timestamp with milliseconds
-	timestamp := time.Now().Format("2006/01/02 15:04:05.000")
+	now := time.Now()
+	timestamp := now.Format("2006/01/02 15:04:05.000")
 	
 	// Write formatted log entry
 	formatted := fmt.Sprintf("%s%s %s", timestamp, fileInfo, string(p))
+	if recent := w.recent.Load(); recent != nil {
+		recent.add(newEntry(now, strings.TrimSuffix(strings.TrimSpace(fileInfo), ":"), string(p)))
+	}
 	return os.Stdout.Write([]byte(formatted))
 }
 
 func (l *Logger) Info(format string, v ...interface{}) {
+	if !l.enabled(LevelInfo) {
+		return
+	}
 	l.Logger.Printf("[INFO] "+format, v...)
 }
 
 func (l *Logger) Error(format string, v ...interface{}) {
+	if !l.enabled(LevelError) {
+		return
+	}
 	l.Logger.Printf("[ERROR] "+format, v...)
 }
 
 func (l *Logger) Debug(format string, v ...interface{}) {
+	if !l.enabled(LevelDebug) {
+		return
+	}
 	l.Logger.Printf("[DEBUG] "+format, v...)
 }
 
 func (l *Logger) Warn(format string, v ...interface{}) {
+	if !l.enabled(LevelWarn) {
+		return
+	}
 	l.Logger.Printf("[WARN] "+format, v...)
 }
 
+// Fatal is written at every level
 func (l *Logger) Fatal(format string, v ...interface{}) {
 	l.Logger.Printf("[FATAL] "+format, v...)
 	os.Exit(1)
@@ -0,0 +1,85 @@
+package logger
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a log line kept in memory by KeepRecent
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Caller  string    `json:"caller,omitempty"` // file:line
+	Message string    `json:"message"`
+}
+
+// newEntry splits a line written by the level methods, "[INFO] message\n", into an Entry
+func newEntry(t time.Time, caller, line string) Entry {
+	entry := Entry{Time: t, Caller: caller, Message: strings.TrimRight(line, "\n")}
+	if strings.HasPrefix(entry.Message, "[") {
+		if end := strings.Index(entry.Message, "] "); end > 0 {
+			entry.Level = strings.ToLower(entry.Message[1:end])
+			entry.Message = entry.Message[end+2:]
+		}
+	}
+	return entry
+}
+
+// recentBuffer is a fixed-size ring of the latest entries
+type recentBuffer struct {
+	mu      sync.Mutex
+	entries []Entry
+	next    int // where the next entry goes
+	full    bool
+}
+
+func (b *recentBuffer) add(entry Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[b.next] = entry
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// snapshot returns a copy of the entries, oldest first
+func (b *recentBuffer) snapshot() []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.full {
+		return append([]Entry(nil), b.entries[:b.next]...)
+	}
+	entries := make([]Entry, 0, len(b.entries))
+	entries = append(entries, b.entries[b.next:]...)
+	return append(entries, b.entries[:b.next]...)
+}
+
+// KeepRecent keeps the last n lines written in memory for Recent; n <= 0 stops
+// keeping them and drops those already kept. Lines below the log level are
+// never written, so they aren't kept either.
+func (l *Logger) KeepRecent(n int) {
+	if n <= 0 {
+		l.writer.recent.Store(nil)
+		return
+	}
+	l.writer.recent.Store(&recentBuffer{entries: make([]Entry, n)})
+}
+
+// Recent returns the kept lines, oldest first, and whether KeepRecent is enabled
+func (l *Logger) Recent() ([]Entry, bool) {
+	recent := l.writer.recent.Load()
+	if recent == nil {
+		return nil, false
+	}
+	return recent.snapshot(), true
+}
+
+// RecentCapacity returns how many lines KeepRecent keeps (0 when disabled)
+func (l *Logger) RecentCapacity() int {
+	if recent := l.writer.recent.Load(); recent != nil {
+		return len(recent.entries)
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+package version
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// Build information, set at build time with:
+//
+//	go build -ldflags "-X argus-sdr/pkg/version.Version=v1.2.3 \
+//	  -X argus-sdr/pkg/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X argus-sdr/pkg/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// When they are not set, Resolve fills them in from the Go build info.
+var (
+	Version   = ""
+	Commit    = ""
+	BuildTime = ""
+)
+
+// ProtocolVersion is the version of the client/server API and WebSocket message protocol.
+// Bump it when a change breaks compatibility between clients and the server.
+const ProtocolVersion = 1
+
+// SupportedProtocolVersions lists the protocol versions this build can talk to
+var SupportedProtocolVersions = []int{ProtocolVersion}
+
+// Info describes a server's version, as returned by GET /api/version
+type Info struct {
+	Version                   string   `json:"version"`
+	Commit                    string   `json:"commit,omitempty"`
+	BuildTime                 string   `json:"build_time,omitempty"`
+	ProtocolVersion           int      `json:"protocol_version"`
+	SupportedProtocolVersions []int    `json:"supported_protocol_versions"`
+	FileTransferProtocols     []string `json:"file_transfer_protocols,omitempty"`
+}
+
+var resolveOnce sync.Once
+
+// Resolve fills in any build information not set via ldflags from the
+// module and VCS information Go embeds in the binary
+func Resolve() {
+	resolveOnce.Do(func() {
+		// A commit set via ldflags is reported as given, never marked dirty
+		commitFromBuildInfo := Commit == ""
+		dirty := false
+		if info, ok := debug.ReadBuildInfo(); ok {
+			if Version == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+				Version = info.Main.Version
+			}
+			for _, setting := range info.Settings {
+				switch setting.Key {
+				case "vcs.revision":
+					if Commit == "" {
+						Commit = setting.Value
+						if len(Commit) > 12 {
+							Commit = Commit[:12]
+						}
+					}
+				case "vcs.time":
+					if BuildTime == "" {
+						BuildTime = setting.Value
+					}
+				case "vcs.modified":
+					dirty = setting.Value == "true"
+				}
+			}
+		}
+		if dirty && commitFromBuildInfo && Commit != "" {
+			Commit += "-dirty"
+		}
+
+		if Version == "" {
+			Version = "dev"
+		}
+	})
+}
+
+// Get returns the resolved build version
+func Get() string {
+	Resolve()
+	return Version
+}
+
+// String describes the build for startup logs, e.g. "v1.2.3 (commit abc123, built 2024-01-01T00:00:00Z)"
+func String() string {
+	Resolve()
+
+	details := ""
+	if Commit != "" {
+		details = "commit " + Commit
+	}
+	if BuildTime != "" {
+		if details != "" {
+			details += ", "
+		}
+		details += "built " + BuildTime
+	}
+
+	if details == "" {
+		return Version
+	}
+	return fmt.Sprintf("%s (%s)", Version, details)
+}
+
+// Current returns the version information for this build
+func Current() Info {
+	Resolve()
+	return Info{
+		Version:                   Version,
+		Commit:                    Commit,
+		BuildTime:                 BuildTime,
+		ProtocolVersion:           ProtocolVersion,
+		SupportedProtocolVersions: SupportedProtocolVersions,
+	}
+}
+
+// CheckCompatible returns an error if a client built from this code cannot
+// talk to a server reporting the given version information
+func CheckCompatible(server *Info) error {
+	for _, supported := range server.SupportedProtocolVersions {
+		if supported == ProtocolVersion {
+			return nil
+		}
+	}
+	return fmt.Errorf("server %s supports protocol versions %v, but this client speaks version %d",
+		server.Version, server.SupportedProtocolVersions, ProtocolVersion)
+}
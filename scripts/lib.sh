@@ -0,0 +1,91 @@
+#!/bin/bash
+
+# Helpers shared by the test scripts. A script sets E2E_PORT, then sources
+# this file from the repository root:
+#
+#   E2E_PORT="${E2E_PORT:-18080}"
+#   source "$(dirname "$0")/lib.sh"
+#
+# It gets a temporary WORK_DIR, the binary path BIN and API_URL. On exit the
+# API server and every process in PIDS are stopped and WORK_DIR is removed,
+# unless E2E_KEEP is set. Scripts with more to stop define on_cleanup, which
+# runs first.
+
+API_URL="http://localhost:${E2E_PORT}"
+WORK_DIR=$(mktemp -d)
+BIN="${WORK_DIR}/argus-sdr"
+PIDS=()
+API_PID=""
+
+cleanup() {
+    declare -F on_cleanup > /dev/null && on_cleanup
+    stop_api
+    for pid in "${PIDS[@]}"; do
+        # Stopped processes can't exit until they are resumed
+        kill -CONT "$pid" 2>/dev/null
+        kill "$pid" 2>/dev/null
+        wait "$pid" 2>/dev/null
+    done
+    if [ -n "${E2E_KEEP:-}" ]; then
+        echo "Keeping test files in ${WORK_DIR}"
+    else
+        rm -rf "${WORK_DIR}"
+    fi
+}
+trap cleanup EXIT
+
+# fail <message> reports a failure with the last lines of every log and client
+# output in WORK_DIR, and exits
+fail() {
+    echo "❌ $1"
+    for log in "${WORK_DIR}"/*.log "${WORK_DIR}"/*.out; do
+        [ -f "$log" ] || continue
+        echo -e "\n--- last lines of $(basename "$log") ---"
+        tail -n 20 "$log"
+    done
+    exit 1
+}
+
+# build builds the application into BIN
+build() {
+    echo "Building application..."
+    go build -o "${BIN}" . || fail "Build failed"
+    echo "✅ Build successful"
+}
+
+# wait_healthy waits for the API server to answer GET /health
+wait_healthy() {
+    for i in $(seq 1 20); do
+        curl -sf "${API_URL}/health" > /dev/null && return
+        sleep 0.5
+    done
+    fail "API server did not become healthy"
+}
+
+# start_api [<name>] starts the API server with the current environment,
+# logging to <name>.log (default: api), and waits for it to become healthy.
+# Sets API_PID.
+start_api() {
+    "${BIN}" api > "${WORK_DIR}/${1:-api}.log" 2>&1 &
+    API_PID=$!
+    wait_healthy
+}
+
+# stop_api stops the API server started by start_api
+stop_api() {
+    if [ -n "${API_PID}" ]; then
+        kill "${API_PID}" 2>/dev/null
+        wait "${API_PID}" 2>/dev/null
+        API_PID=""
+    fi
+}
+
+# wait_collector <log> [<message>] waits for the collector logging to <log> to
+# connect to the API server, failing with <message> if it doesn't
+wait_collector() {
+    for i in $(seq 1 20); do
+        grep -q "Collector client started successfully" "$1" && return
+        sleep 0.5
+    done
+    fail "${2:-Collector did not connect to the API server}"
+}
@@ -0,0 +1,129 @@
+#!/bin/bash
+
+# Checks that a collector forgets requests once their collection has finished,
+# whether it succeeded or failed, so activeRequests doesn't grow forever.
+#
+# Submits a batch of data requests without a receiver to fetch them. The docker
+# shim fails every third capture. Once the batch is through, the collector's
+# status endpoint must list no active requests.
+#
+# Usage: scripts/test-active-requests.sh
+#   E2E_PORT     Port for the API server (default: 18092)
+#   STATUS_PORT  Port for the collector status server (default: 18093)
+#   REQUESTS     Number of data requests to submit (default: 30)
+#   E2E_KEEP     Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18092}"
+STATUS_PORT="${STATUS_PORT:-18093}"
+REQUESTS="${REQUESTS:-30}"
+STATUS_URL="http://127.0.0.1:${STATUS_PORT}/status"
+
+echo "Active Request Cleanup Test"
+echo "==========================="
+
+source "$(dirname "$0")/lib.sh"
+
+# status_field NAME prints a field of the collector status as JSON
+status_field() {
+    curl -sf "${STATUS_URL}" | python3 -c "import json, sys; print(json.dumps(json.load(sys.stdin)[\"$1\"]))"
+}
+
+build
+
+# Fake docker: write an NPZ file into the bind mount source, except that every
+# third run fails like a capture with the SDR unplugged
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data"
+cat > "${WORK_DIR}/bin/docker" <<EOF2
+#!/bin/bash
+[ "\$1" = "run" ] || exit 0
+
+echo run >> "${WORK_DIR}/docker-run.log"
+if [ \$(( \$(wc -l < "${WORK_DIR}/docker-run.log") % 3 )) -eq 0 ]; then
+    echo "fake docker: no SDR device found" >&2
+    exit 1
+fi
+
+src=""
+while [ \$# -gt 0 ]; do
+    case "\$1" in
+        --mount)
+            shift
+            src=\$(echo "\$1" | tr ',' '\n' | sed -n 's/^src=//p')
+            ;;
+    esac
+    shift
+done
+
+[ -n "\$src" ] || { echo "fake docker: no bind mount source" >&2; exit 1; }
+
+python3 - "\$src" <<'PY'
+import struct, sys, time, zipfile
+
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+
+with zipfile.ZipFile("%s/active_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+echo "✅ Docker shim installed"
+
+export DATABASE_PATH="${WORK_DIR}/active.db"
+export JWT_SECRET="active-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting collector..."
+PATH="${WORK_DIR}/bin:${PATH}" COLLECTOR_STATUS_PORT="${STATUS_PORT}" COLLECTOR_DRAIN_TRANSFER_WAIT_SECONDS=2 "${BIN}" collector \
+    --station-id active-station-1 \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "active@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the receiver user"
+
+echo -e "\n🔍 Submitting ${REQUESTS} data requests..."
+for i in $(seq 1 "${REQUESTS}"); do
+    status=$(curl -s -o /dev/null -w "%{http_code}" -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d '{"request_type": "data_collection", "parameters": "{}"}')
+    [ "${status}" = "202" ] || fail "Data request ${i} returned ${status}"
+done
+echo "✅ ${REQUESTS} requests submitted"
+
+for i in $(seq 1 60); do
+    [ "$(wc -l < "${WORK_DIR}/docker-run.log" 2>/dev/null || echo 0)" -ge "${REQUESTS}" ] && break
+    sleep 0.5
+done
+RUNS=$(wc -l < "${WORK_DIR}/docker-run.log" 2>/dev/null || echo 0)
+[ "${RUNS}" -ge "${REQUESTS}" ] || fail "Collector ran ${RUNS} of ${REQUESTS} captures"
+echo "✅ Collector ran every capture, $(( RUNS / 3 )) of them failing"
+
+for i in $(seq 1 20); do
+    [ "$(status_field active_requests)" = "[]" ] && break
+    sleep 0.5
+done
+[ "$(status_field active_requests)" = "[]" ] || fail "Collector still lists active requests: $(status_field active_requests)"
+echo "✅ No active requests left"
+
+for i in $(seq 1 20); do
+    [ "$(status_field in_flight)" = "0" ] && break
+    sleep 0.5
+done
+[ "$(status_field in_flight)" = "0" ] || fail "Collector still has $(status_field in_flight) collections in flight"
+echo "✅ Nothing in flight once the transfer wait passed"
+
+echo -e "\n🎉 Active request cleanup test passed!"
@@ -0,0 +1,81 @@
+#!/bin/bash
+
+# Checks that /api/admin routes are allowed for users with the admin role and
+# rejected with 403 for everyone else.
+#
+# The admin is created with "admin create-user --admin"; the regular user
+# registers through the API.
+#
+# Usage: scripts/test-admin-rbac.sh
+#   E2E_PORT  Port for the API server (default: 18083)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18083}"
+
+echo "Admin Role Test"
+echo "==============="
+
+source "$(dirname "$0")/lib.sh"
+
+# login EMAIL prints the token
+login() {
+    curl -s -X POST "${API_URL}/api/auth/login" \
+        -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\"}" |
+        sed -n 's/.*"token":"\([^"]*\)".*/\1/p'
+}
+
+# broadcast TOKEN prints the HTTP status code of an admin request
+broadcast() {
+    curl -s -o /dev/null -w "%{http_code}" -X POST "${API_URL}/api/admin/collectors/broadcast" \
+        -H "Authorization: Bearer $1" \
+        -H "Content-Type: application/json" \
+        -d '{"command": "resume", "reason": "rbac test"}'
+}
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/rbac.db"
+export JWT_SECRET="rbac-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+"${BIN}" admin create-user --email admin@example.com --password password123 --admin \
+    > "${WORK_DIR}/create-user.log" 2>&1 || fail "admin create-user failed: $(cat "${WORK_DIR}/create-user.log")"
+echo "✅ Admin user created"
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+curl -s -o /dev/null -X POST "${API_URL}/api/auth/register" \
+    -H "Content-Type: application/json" \
+    -d '{"email": "user@example.com", "password": "password123", "client_type": 2}'
+
+ADMIN_TOKEN=$(login admin@example.com)
+USER_TOKEN=$(login user@example.com)
+[ -n "${ADMIN_TOKEN}" ] || fail "Admin login failed"
+[ -n "${USER_TOKEN}" ] || fail "User login failed"
+echo "✅ Admin and user logged in"
+
+curl -s "${API_URL}/api/auth/me" -H "Authorization: Bearer ${ADMIN_TOKEN}" | grep -q '"role":"admin"' ||
+    fail "/api/auth/me does not report the admin role"
+curl -s "${API_URL}/api/auth/me" -H "Authorization: Bearer ${USER_TOKEN}" | grep -q '"role":"user"' ||
+    fail "/api/auth/me does not report the user role"
+echo "✅ /api/auth/me reports roles"
+
+status=$(broadcast "${ADMIN_TOKEN}")
+[ "${status}" = "200" ] || fail "Admin request returned ${status}, expected 200"
+echo "✅ Admin allowed"
+
+status=$(broadcast "${USER_TOKEN}")
+[ "${status}" = "403" ] || fail "Non-admin request returned ${status}, expected 403"
+echo "✅ Non-admin rejected with 403"
+
+status=$(broadcast "")
+[ "${status}" = "401" ] || fail "Unauthenticated request returned ${status}, expected 401"
+echo "✅ Unauthenticated request rejected with 401"
+
+echo -e "\n🎉 Admin role test completed successfully!"
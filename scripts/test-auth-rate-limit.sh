@@ -0,0 +1,72 @@
+#!/bin/bash
+
+# Checks that register and login are rate limited per client IP and that
+# registration can be switched off with ALLOW_REGISTRATION=false.
+#
+# Usage: scripts/test-auth-rate-limit.sh
+#   E2E_PORT  Port for the API server (default: 18082)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18082}"
+RATE_LIMIT=3
+
+echo "Auth Rate Limit Test"
+echo "===================="
+
+source "$(dirname "$0")/lib.sh"
+
+# post PATH BODY prints the HTTP status code
+post() {
+    curl -s -o /dev/null -w "%{http_code}" -X POST "${API_URL}$1" \
+        -H "Content-Type: application/json" -d "$2"
+}
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/ratelimit.db"
+export JWT_SECRET="ratelimit-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+export AUTH_RATE_LIMIT_PER_MINUTE="${RATE_LIMIT}"
+
+echo -e "\n🔍 Starting API server with ${RATE_LIMIT} auth requests per minute..."
+start_api
+echo "✅ API server healthy"
+
+USER='{"email": "ratelimit@example.com", "password": "password123", "client_type": 2}'
+
+status=$(post /api/auth/register "${USER}")
+[ "${status}" = "201" ] || fail "Registration returned ${status}, expected 201"
+echo "✅ Registration allowed"
+
+for i in $(seq 1 "${RATE_LIMIT}"); do
+    status=$(post /api/auth/login "${USER}")
+    [ "${status}" = "200" ] || fail "Login ${i} returned ${status}, expected 200"
+done
+echo "✅ ${RATE_LIMIT} logins allowed"
+
+status=$(post /api/auth/login "${USER}")
+[ "${status}" = "429" ] || fail "Login over the limit returned ${status}, expected 429"
+retry_after=$(curl -s -D - -o /dev/null -X POST "${API_URL}/api/auth/login" \
+    -H "Content-Type: application/json" -d "${USER}" | tr -d '\r' | awk -F': ' 'tolower($1) == "retry-after" {print $2}')
+[ -n "${retry_after}" ] || fail "429 response has no Retry-After header"
+echo "✅ Login over the limit rejected with 429 (Retry-After: ${retry_after}s)"
+
+stop_api
+
+echo -e "\n🔍 Restarting API server with registration disabled..."
+export ALLOW_REGISTRATION=false
+start_api
+echo "✅ API server healthy"
+
+status=$(post /api/auth/register '{"email": "new@example.com", "password": "password123", "client_type": 2}')
+[ "${status}" = "403" ] || fail "Registration returned ${status}, expected 403"
+echo "✅ Registration rejected with 403"
+
+status=$(post /api/auth/login "${USER}")
+[ "${status}" = "200" ] || fail "Login of an existing user returned ${status}, expected 200"
+echo "✅ Existing users can still log in"
+
+echo -e "\n🎉 Auth rate limit test completed successfully!"
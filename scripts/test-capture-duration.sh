@@ -0,0 +1,129 @@
+#!/bin/bash
+
+# Checks that a request's duration_seconds reaches the collection command,
+# the capture metadata, the request status and the ETA, that out of range
+# durations are rejected and that a capture running well past its duration
+# is killed after COLLECTOR_CAPTURE_GRACE_SECONDS.
+#
+# Docker is replaced by a shim that captures for the requested duration, or
+# hangs when asked for exactly 1 second, standing in for a wedged SDR.
+#
+# Usage: scripts/test-capture-duration.sh
+#   E2E_PORT  Port for the API server (default: 18101)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18101}"
+CAPTURE_GRACE=2
+
+echo "Capture Duration Test"
+echo "====================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: "run" logs its arguments, then sleeps for --duration and writes
+# an NPZ file into the bind mount, or hangs for --duration 1
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data" "${WORK_DIR}/downloads"
+cat > "${WORK_DIR}/bin/docker" <<EOF2
+#!/bin/bash
+[ "\$1" = "run" ] || exit 0
+echo "\$@" >> "${WORK_DIR}/docker-run.log"
+src=\$(echo "\$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+duration=\$(echo "\$@" | sed -n 's/.*--duration \([^ ]*\).*/\1/p')
+[ "\${duration}" = "1" ] && exec sleep 600
+sleep "\${duration:-0}"
+python3 - "\${src}" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/duration_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+echo "✅ Docker shim installed"
+
+export DATABASE_PATH="${WORK_DIR}/duration.db"
+export JWT_SECRET="duration-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export CAPTURE_MAX_DURATION_SECONDS=30
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting collector with a ${CAPTURE_GRACE}s capture grace..."
+PATH="${WORK_DIR}/bin:${PATH}" COLLECTOR_CAPTURE_GRACE_SECONDS="${CAPTURE_GRACE}" "${BIN}" collector \
+    --station-id duration-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+echo -e "\n🔍 Running receiver with --duration 2..."
+timeout 120s "${BIN}" receiver \
+    --receiver-id duration-receiver-1 \
+    --api-server-url "${API_URL}" \
+    --duration 2 \
+    --download-dir "${WORK_DIR}/downloads" > "${WORK_DIR}/receiver.log" 2>&1 || fail "Receiver failed"
+grep -q -- "--duration 2" "${WORK_DIR}/docker-run.log" || fail "Collection command has no --duration 2: $(cat "${WORK_DIR}/docker-run.log")"
+echo "✅ Collection ran with --duration 2"
+
+REQUEST_ID=$(sed -n 's/.*Request \([^ ]*\) submitted to .*/\1/p' "${WORK_DIR}/receiver.log" | tail -n 1)
+METADATA="${WORK_DIR}/downloads/${REQUEST_ID}_duration-station_metadata.json"
+[ "$(python3 -c 'import json, sys; print(json.load(open(sys.argv[1]))["duration_seconds"])' "${METADATA}")" = "2" ] ||
+    fail "Capture metadata does not record the duration: $(cat "${METADATA}")"
+echo "✅ Capture metadata records the duration"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/login" -H "Content-Type: application/json" \
+    -d '{"email": "receiver@example.com", "password": "password123"}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to log in as the receiver user"
+[ "$(curl -s "${API_URL}/api/data/status/${REQUEST_ID}" -H "Authorization: Bearer ${TOKEN}" |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["duration_seconds"])')" = "2" ] ||
+    fail "Request status does not report the duration"
+echo "✅ Request status reports the duration"
+
+# request <duration_seconds> sends a request and prints the HTTP status and the body
+request() {
+    curl -s -o "${WORK_DIR}/body" -w "%{http_code}\n" -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d "{\"request_type\": \"data_collection\", \"parameters\": \"{}\", \"duration_seconds\": $1}"
+    cat "${WORK_DIR}/body"
+}
+
+for duration in 0.5 -3 31; do
+    RESULT=$(request "${duration}")
+    [ "$(echo "${RESULT}" | head -n 1)" = "400" ] || fail "duration_seconds ${duration} was not rejected: ${RESULT}"
+done
+echo "${RESULT}" | grep -q "duration_seconds must be between 1 and 30" || fail "Rejection does not give the range: ${RESULT}"
+echo "✅ Out of range durations are rejected"
+
+echo -e "\n🔍 Running receiver with --duration 1 against a hanging capture..."
+START=$(date +%s)
+timeout 60s "${BIN}" receiver \
+    --receiver-id duration-receiver-2 \
+    --api-server-url "${API_URL}" \
+    --duration 1 \
+    --download-dir "${WORK_DIR}/downloads" > "${WORK_DIR}/receiver-hang.log" 2>&1
+RECEIVER_EXIT=$?
+ELAPSED=$(( $(date +%s) - START ))
+[ $RECEIVER_EXIT -ne 0 ] || fail "Receiver succeeded even though the capture hung"
+[ $RECEIVER_EXIT -ne 124 ] || fail "Receiver hung instead of getting a timeout error"
+grep -q "collection timed out after $((1 + CAPTURE_GRACE))s" "${WORK_DIR}/receiver-hang.log" || fail "Receiver error does not give the bounded timeout"
+grep -q "duration_seconds plus COLLECTOR_CAPTURE_GRACE_SECONDS" "${WORK_DIR}/collector.log" || fail "Collector does not say what bounded the collection"
+echo "✅ Capture killed after its duration plus the grace (${ELAPSED}s)"
+
+echo -e "\n🔍 Checking the estimate for a longer capture..."
+RESULT=$(request 20)
+[ "$(echo "${RESULT}" | head -n 1)" = "202" ] || fail "Request for 20 seconds failed: ${RESULT}"
+ETA=$(echo "${RESULT}" | tail -n 1 | python3 -c 'import json, sys; print(json.load(sys.stdin).get("eta_seconds", -1))')
+[ "${ETA}" -ge 20 ] && [ "${ETA}" -lt 30 ] || fail "ETA of a 20 second capture is ${ETA} seconds"
+echo "✅ ETA includes the capture duration (${ETA}s)"
+
+echo -e "\n🎉 Capture duration test passed!"
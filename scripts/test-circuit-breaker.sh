@@ -0,0 +1,189 @@
+#!/bin/bash
+
+# Checks the collector's circuit breaker: after COLLECTOR_BREAKER_THRESHOLD
+# consecutive failed collections the collector reports itself unhealthy and
+# rejects requests, the server stops choosing it, and once the cooldown has
+# passed one trial request reopens the breaker if it fails or closes it if it
+# succeeds. Negative settings must keep the collector from starting.
+#
+# Docker is replaced by a shim on PATH that fails while ${WORK_DIR}/fail
+# exists and is slow while ${WORK_DIR}/slow exists.
+#
+# Usage: scripts/test-circuit-breaker.sh
+#   E2E_PORT     Port for the API server (default: 18123)
+#   STATUS_PORT  Port for the collector status server (default: 18124)
+#   E2E_KEEP     Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18123}"
+STATUS_PORT="${STATUS_PORT:-18124}"
+STATUS_URL="http://127.0.0.1:${STATUS_PORT}/status"
+COOLDOWN=3
+
+echo "Circuit Breaker Test"
+echo "===================="
+
+source "$(dirname "$0")/lib.sh"
+
+# breaker prints the state of the collector's circuit breaker and its status
+breaker() {
+    curl -sf "${STATUS_URL}" |
+        python3 -c 'import json, sys; s = json.load(sys.stdin); print(s["circuit_breaker"]["state"], s["status"])'
+}
+
+# wait_breaker <state> <status> waits for the circuit breaker to reach a state
+wait_breaker() {
+    for i in $(seq 1 40); do
+        [ "$(breaker)" = "$1 $2" ] && return
+        sleep 0.25
+    done
+    fail "The circuit breaker is '$(breaker)' instead of '$1 $2'"
+}
+
+# request sends a data collection request and sets STATUS to its HTTP status
+# and REQUEST_ID to its ID, if it was accepted
+request() {
+    local response
+    response=$(curl -s -w "\n%{http_code}" -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d '{"request_type": "data_collection", "parameters": "{}"}')
+    STATUS=$(echo "${response}" | tail -n 1)
+    REQUEST_ID=$(echo "${response}" | head -n 1 | python3 -c 'import json, sys; print(json.load(sys.stdin).get("request_id", ""))')
+}
+
+# unavailable prints why the plan for a request leaves the station out, if it does
+unavailable() {
+    curl -s -X POST "${API_URL}/api/data/request/plan" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d '{"request_type": "data_collection", "parameters": "{}"}' |
+        python3 -c 'import json, sys; print(",".join(s["reason"] for s in json.load(sys.stdin)["unavailable"]))'
+}
+
+# wait_available waits for the server to choose the station again
+wait_available() {
+    for i in $(seq 1 20); do
+        [ -z "$(unavailable)" ] && return
+        sleep 0.25
+    done
+    fail "The half-open station is still unavailable: $(unavailable)"
+}
+
+# wait_log <count> <pattern> waits until the collector logged a line count times
+wait_log() {
+    for i in $(seq 1 40); do
+        [ "$(grep -c "$2" "${WORK_DIR}/collector.log")" -ge "$1" ] && return
+        sleep 0.25
+    done
+    fail "The collector did not log '$2' $1 times"
+}
+
+build
+
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data"
+cat > "${WORK_DIR}/bin/docker" <<EOF2
+#!/bin/bash
+[ "\$1" = "run" ] || exit 0
+[ -f "${WORK_DIR}/slow" ] && sleep 3
+if [ -f "${WORK_DIR}/fail" ]; then
+    echo "no SDR found" >&2
+    exit 1
+fi
+src=\$(echo "\$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+python3 - "\$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/breaker_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/breaker.db"
+export JWT_SECRET="breaker-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Checking that negative settings are rejected..."
+for setting in COLLECTOR_BREAKER_THRESHOLD COLLECTOR_BREAKER_COOLDOWN_SECONDS; do
+    env "${setting}=-1" timeout 10s "${BIN}" collector --station-id breaker-station \
+        --api-server-url "${API_URL}" --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/invalid.log" 2>&1 &&
+        fail "The collector started with ${setting}=-1"
+    grep -q "invalid ${setting} -1: must not be negative" "${WORK_DIR}/invalid.log" ||
+        fail "The collector did not explain why ${setting}=-1 is invalid"
+done
+rm -f "${WORK_DIR}/invalid.log"
+echo "✅ Negative settings are rejected"
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting a collector with a threshold of 2..."
+PATH="${WORK_DIR}/bin:${PATH}" COLLECTOR_STATUS_PORT="${STATUS_PORT}" \
+    COLLECTOR_BREAKER_THRESHOLD=2 COLLECTOR_BREAKER_COOLDOWN_SECONDS="${COOLDOWN}" "${BIN}" collector \
+    --station-id breaker-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+wait_breaker closed active
+echo "✅ Collector connected with a closed circuit breaker"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "breaker@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+
+echo -e "\n🔍 Failing two collections in a row..."
+touch "${WORK_DIR}/fail"
+for n in 1 2; do
+    request; [ "${STATUS}" = "202" ] || fail "Request ${n} was not accepted"
+    wait_log "${n}" "Docker command failed for request"
+done
+wait_breaker open unhealthy
+grep -q "Circuit breaker open after 2 consecutive failed collections: rejecting requests for ${COOLDOWN}s" "${WORK_DIR}/collector.log" ||
+    fail "The collector did not log the open circuit breaker"
+for i in $(seq 1 20); do
+    [ "$(unavailable)" = "unhealthy: its collections keep failing" ] && break
+    sleep 0.25
+done
+[ "$(unavailable)" = "unhealthy: its collections keep failing" ] || fail "The plan gives the station as: $(unavailable)"
+request; [ "${STATUS}" = "503" ] || fail "A request was accepted while the only station is unhealthy"
+echo "✅ The breaker opens, the collector reports itself unhealthy and the server stops choosing it"
+
+echo -e "\n🔍 Failing the trial request after the cooldown..."
+wait_breaker half-open active
+grep -q "Circuit breaker half-open: accepting a trial request" "${WORK_DIR}/collector.log" ||
+    fail "The collector did not log the half-open circuit breaker"
+wait_available
+touch "${WORK_DIR}/slow"
+request; [ "${STATUS}" = "202" ] || fail "The trial request was not accepted"
+request; [ "${STATUS}" = "202" ] || fail "The request during the trial was not sent"
+SECOND_ID="${REQUEST_ID}"
+for i in $(seq 1 20); do
+    grep -q "Collector breaker-station rejected request ${SECOND_ID}: circuit breaker half-open, a trial collection is running" "${WORK_DIR}/api.log" && break
+    sleep 0.25
+done
+grep -q "Collector breaker-station rejected request ${SECOND_ID}: circuit breaker half-open, a trial collection is running" "${WORK_DIR}/api.log" ||
+    fail "A second request was not rejected during the trial"
+wait_log 3 "Docker command failed for request"
+wait_breaker open unhealthy
+grep -q "Circuit breaker open after 3 consecutive failed collections" "${WORK_DIR}/collector.log" ||
+    fail "The failed trial did not open the circuit breaker again"
+echo "✅ Only one trial runs at a time and its failure opens the breaker again"
+
+echo -e "\n🔍 Succeeding the trial request after the cooldown..."
+rm -f "${WORK_DIR}/fail" "${WORK_DIR}/slow"
+wait_breaker half-open active
+wait_available
+request; [ "${STATUS}" = "202" ] || fail "The trial request was not accepted"
+wait_log 1 "Circuit breaker closed: the collection for request ${REQUEST_ID} succeeded"
+wait_breaker closed active
+curl -sf "${STATUS_URL}" | python3 -c 'import json, sys; sys.exit(json.load(sys.stdin)["circuit_breaker"]["consecutive_failures"] != 0)' ||
+    fail "The closed circuit breaker still counts failures"
+request; [ "${STATUS}" = "202" ] || fail "A request was not accepted after the breaker closed"
+echo "✅ A successful trial closes the breaker"
+
+echo -e "\n🎉 Circuit breaker test passed!"
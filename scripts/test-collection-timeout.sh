@@ -0,0 +1,82 @@
+#!/bin/bash
+
+# Checks that a hung collection is killed after COLLECTOR_COLLECTION_TIMEOUT_SECONDS
+# and that the timeout is reported back to the receiver.
+#
+# Docker is replaced by a shim on PATH whose "run" just sleeps, standing in for
+# a wedged SDR capture.
+#
+# Usage: scripts/test-collection-timeout.sh
+#   E2E_PORT  Port for the API server (default: 18081)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18081}"
+COLLECTION_TIMEOUT=3
+
+echo "Collection Timeout Test"
+echo "======================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: "run" hangs well past the collection timeout and records that it
+# was started; "kill" records the container it was asked to kill
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data" "${WORK_DIR}/downloads"
+cat > "${WORK_DIR}/bin/docker" <<EOF2
+#!/bin/bash
+case "\$1" in
+    run)  echo started >> "${WORK_DIR}/docker-run.log"; sleep 600 ;;
+    kill) echo "\$2" >> "${WORK_DIR}/docker-kill.log" ;;
+esac
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+echo "✅ Docker shim installed"
+
+export DATABASE_PATH="${WORK_DIR}/timeout.db"
+export JWT_SECRET="timeout-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting collector with a ${COLLECTION_TIMEOUT}s collection timeout..."
+PATH="${WORK_DIR}/bin:${PATH}" COLLECTOR_COLLECTION_TIMEOUT_SECONDS="${COLLECTION_TIMEOUT}" "${BIN}" collector \
+    --station-id timeout-station-1 \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+echo -e "\n🔍 Running receiver..."
+START=$(date +%s)
+timeout 60s "${BIN}" receiver \
+    --receiver-id timeout-receiver-1 \
+    --api-server-url "${API_URL}" \
+    --download-dir "${WORK_DIR}/downloads" > "${WORK_DIR}/receiver.log" 2>&1
+RECEIVER_EXIT=$?
+ELAPSED=$(( $(date +%s) - START ))
+
+[ -f "${WORK_DIR}/docker-run.log" ] || fail "Collector never started the container"
+[ $RECEIVER_EXIT -ne 0 ] || fail "Receiver succeeded even though the collection hung"
+[ $RECEIVER_EXIT -ne 124 ] || fail "Receiver hung instead of getting a timeout error"
+echo "✅ Receiver failed after ${ELAPSED}s"
+
+grep -q "collection timed out" "${WORK_DIR}/receiver.log" || fail "Receiver error does not mention the timeout"
+echo "✅ Receiver reported the collection timeout"
+
+grep -q "timed out after ${COLLECTION_TIMEOUT}s" "${WORK_DIR}/collector.log" || fail "Collector did not log the timeout"
+echo "✅ Collector logged the timeout"
+
+grep -q "^argus-" "${WORK_DIR}/docker-kill.log" 2>/dev/null || fail "Collector did not kill the container"
+echo "✅ Collector killed container $(head -n 1 "${WORK_DIR}/docker-kill.log")"
+
+pgrep -f "sleep 600" > /dev/null && pkill -f "sleep 600" && fail "Collection process group was not killed"
+echo "✅ No collection processes left behind"
+
+echo -e "\n🎉 Collection timeout test completed successfully!"
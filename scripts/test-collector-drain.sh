@@ -0,0 +1,110 @@
+#!/bin/bash
+
+# Checks that a drain command broadcast to collectors is reported to the
+# server with exactly one heartbeat, that draining again sends none, and that
+# resuming sends one heartbeat that is no longer draining. Then checks that a
+# collector drained with SIGUSR1 reports it before exiting after the drain.
+#
+# The API server logs every heartbeat it gets at debug level, and the
+# periodic heartbeat is 30 seconds away, so the heartbeats in the log are the
+# ones the commands sent.
+#
+# Usage: scripts/test-collector-drain.sh
+#   E2E_PORT  Port for the API server (default: 18138)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18138}"
+
+echo "Collector Drain Test"
+echo "===================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/drain.db"
+export JWT_SECRET="drain-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+"${BIN}" admin create-user --email admin@example.com --password password123 --admin \
+    > "${WORK_DIR}/create-user.log" 2>&1 || fail "admin create-user failed"
+LOG_LEVEL=debug start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting a collector..."
+mkdir -p "${WORK_DIR}/data"
+"${BIN}" collector \
+    --station-id drain-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+ADMIN_TOKEN=$(curl -s -X POST "${API_URL}/api/auth/login" -H "Content-Type: application/json" \
+    -d '{"email": "admin@example.com", "password": "password123"}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to log in as the admin"
+
+# broadcast <command> <collector log message> broadcasts a control command
+# and waits for the collector to log the message, then for any heartbeats
+# it sent to arrive
+broadcast() {
+    curl -sf -X POST "${API_URL}/api/admin/collectors/broadcast" \
+        -H "Authorization: Bearer ${ADMIN_TOKEN}" -H "Content-Type: application/json" \
+        -d "{\"command\": \"$1\", \"reason\": \"drain test\"}" > /dev/null || fail "Failed to broadcast $1"
+    for i in $(seq 1 20); do
+        grep -q "$2" "${WORK_DIR}/collector.log" && break
+        sleep 0.25
+    done
+    grep -q "$2" "${WORK_DIR}/collector.log" || fail "The collector did not act on $1"
+    sleep 2
+}
+
+# heartbeats [<status>] [<station>] prints how many heartbeats the server got
+# from the station, only counting those with the status if given
+heartbeats() {
+    grep -c "Heartbeat from station ${2:-drain-station}: ${1:-}" "${WORK_DIR}/api.log"
+}
+
+BEFORE=$(heartbeats)
+
+echo -e "\n🔍 Draining the collector..."
+broadcast drain "Collector draining: no longer accepting new requests"
+[ "$(heartbeats)" = "$((BEFORE + 1))" ] || fail "Draining sent $(($(heartbeats) - BEFORE)) heartbeats, not 1"
+[ "$(heartbeats draining)" = "1" ] || fail "The heartbeat sent on draining did not report draining"
+echo "✅ Draining sent one heartbeat, reporting draining"
+
+echo -e "\n🔍 Draining the collector again..."
+broadcast drain "Collector already draining"
+[ "$(heartbeats)" = "$((BEFORE + 1))" ] || fail "Draining again sent $(($(heartbeats) - BEFORE - 1)) heartbeats"
+echo "✅ Draining again sent none"
+
+echo -e "\n🔍 Resuming the collector..."
+broadcast resume "Collector resumed accepting requests"
+[ "$(heartbeats)" = "$((BEFORE + 2))" ] || fail "Resuming sent $(($(heartbeats) - BEFORE - 1)) heartbeats, not 1"
+[ "$(heartbeats draining)" = "1" ] || fail "The heartbeat sent on resuming still reported draining"
+echo "✅ Resuming sent one heartbeat, no longer draining"
+
+echo -e "\n🔍 Draining a collector with SIGUSR1..."
+COLLECTOR_EXIT_AFTER_DRAIN=true "${BIN}" collector \
+    --station-id signal-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/signal.log" 2>&1 &
+SIGNAL_PID=$!
+PIDS+=(${SIGNAL_PID})
+wait_collector "${WORK_DIR}/signal.log"
+kill -USR1 "${SIGNAL_PID}"
+for i in $(seq 1 20); do
+    kill -0 "${SIGNAL_PID}" 2>/dev/null || break
+    sleep 0.25
+done
+kill -0 "${SIGNAL_PID}" 2>/dev/null && fail "The collector did not exit after draining"
+grep -q "Exiting after drain" "${WORK_DIR}/signal.log" || fail "The collector exited without draining"
+[ "$(heartbeats draining signal-station)" = "1" ] || fail "The collector did not report draining before exiting"
+echo "✅ The collector reported draining, then exited"
+
+echo -e "\n🎉 Collector drain test passed!"
@@ -0,0 +1,89 @@
+#!/bin/bash
+
+# Checks that a collector applies what the API server sends in its
+# auth_success: it picks the capture matching CAPTURE_FILE_PATTERN, doesn't
+# upload files larger than MAX_UPLOAD_SIZE_MB and uses the handshake's ICE
+# servers for transfers.
+#
+# Docker is replaced by a shim that writes a 2 MB NPZ file next to a newer
+# log file the pattern has to skip.
+#
+# Usage: scripts/test-collector-handshake.sh
+#   E2E_PORT  Port for the API server (default: 18103)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18103}"
+
+echo "Collector Handshake Test"
+echo "========================"
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: write a 2 MB NPZ file, then a log file that is newer
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data" "${WORK_DIR}/downloads"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+python3 - "$src" <<'PY'
+import struct, sys, zipfile
+count = 512 * 1024
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (%d,), }" % count
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + bytes(range(256)) * (count * 4 // 256)
+with zipfile.ZipFile("%s/capture.npz" % sys.argv[1], "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+sleep 1
+echo "capture finished" > "$src/capture.log"
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/handshake.db"
+export JWT_SECRET="handshake-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export CACHE_DIR="${WORK_DIR}/cache"
+export CAPTURE_FILE_PATTERN="*.npz"
+export MAX_UPLOAD_SIZE_MB=1
+export ICE_STUN_URLS="stun:127.0.0.1:3478"
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting collector..."
+PATH="${WORK_DIR}/bin:${PATH}" LOG_LEVEL=debug COLLECTOR_UPLOAD_FILES=true "${BIN}" collector \
+    --station-id handshake-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+
+wait_collector "${WORK_DIR}/collector.log"
+grep -q 'Server expects capture files matching "\*.npz" of at most 1048576 bytes (protocol 1)' "${WORK_DIR}/collector.log" ||
+    fail "Collector did not get the server's settings in the handshake"
+echo "✅ Collector got the server's settings"
+
+echo -e "\n🔍 Running receiver..."
+timeout 120s "${BIN}" receiver \
+    --receiver-id handshake-receiver \
+    --api-server-url "${API_URL}" \
+    --download-dir "${WORK_DIR}/downloads" > "${WORK_DIR}/receiver.log" 2>&1 || fail "Receiver failed"
+
+ls "${WORK_DIR}"/downloads/*.npz > /dev/null 2>&1 || fail "No NPZ file was downloaded: $(ls "${WORK_DIR}/downloads")"
+ls "${WORK_DIR}"/downloads/*.log > /dev/null 2>&1 && fail "The newer log file was sent instead of the capture"
+echo "✅ Collector sent the file matching the pattern"
+
+grep -q "falling back to WebRTC only: file is [0-9]* bytes, the server accepts at most 1048576" "${WORK_DIR}/collector.log" ||
+    fail "Collector did not skip uploading a file over the server's limit"
+grep -q "Uploading " "${WORK_DIR}/collector.log" && fail "Collector uploaded a file over the server's limit"
+echo "✅ File over the upload limit was sent over WebRTC only"
+
+grep -q "Using 1 ICE servers from the handshake" "${WORK_DIR}/collector.log" ||
+    fail "Collector did not use the handshake's ICE servers"
+echo "✅ Transfer used the handshake's ICE servers"
+
+echo -e "\n🎉 Collector handshake test passed!"
@@ -0,0 +1,148 @@
+#!/bin/bash
+
+# Checks that a request a collector was working on when its connection
+# dropped is sent to it again once it reconnects, and still reaches the
+# requester, while one older than REQUEST_REFORWARD_MAX_AGE_SECONDS is
+# failed for the station instead.
+#
+# Usage: scripts/test-collector-reconnect.sh
+#   E2E_PORT  Port for the API server (default: 18102)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18102}"
+
+echo "Collector Reconnect Test"
+echo "========================"
+
+source "$(dirname "$0")/lib.sh"
+COLLECTOR_PID=""
+
+build
+
+# Fake docker: logs the run, takes three seconds, then writes an NPZ file
+# into the bind mount
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data"
+cat > "${WORK_DIR}/bin/docker" <<EOF2
+#!/bin/bash
+[ "\$1" = "run" ] || exit 0
+echo "\$@" >> "${WORK_DIR}/docker-run.log"
+src=\$(echo "\$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+sleep 3
+python3 - "\${src}" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/reconnect_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/reconnect.db"
+export JWT_SECRET="reconnect-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+export REQUEST_REFORWARD_MAX_AGE_SECONDS=60
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+# start_collector <log> starts the collector and waits for it to connect
+start_collector() {
+    PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+        --station-id reconnect-station \
+        --api-server-url "${API_URL}" \
+        --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/$1" 2>&1 &
+    COLLECTOR_PID=$!
+    PIDS+=(${COLLECTOR_PID})
+    wait_collector "${WORK_DIR}/$1"
+}
+
+# drop_collector kills the collector without letting it close its connection
+drop_collector() {
+    local disconnects
+    disconnects=$(grep -c "Station disconnected: reconnect-station" "${WORK_DIR}/api.log")
+    kill -9 "${COLLECTOR_PID}"
+    wait "${COLLECTOR_PID}" 2>/dev/null
+    for i in $(seq 1 20); do
+        [ "$(grep -c "Station disconnected: reconnect-station" "${WORK_DIR}/api.log")" -gt "${disconnects}" ] && return
+        sleep 0.5
+    done
+    fail "API server did not notice the collector going away"
+}
+
+start_collector collector-1.log
+echo "✅ Collector connected"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "reconnect@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the receiver user"
+
+# request prints the ID of a new data request
+request() {
+    curl -s -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d '{"request_type": "data_collection", "parameters": "{}"}' |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["request_id"])'
+}
+
+# response_status <request ID> prints the station's response status and error
+response_status() {
+    python3 - "${DATABASE_PATH}" "$1" <<'PY'
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1])
+row = db.execute("SELECT status, COALESCE(error_message, '') FROM collector_responses WHERE request_id = ?", (sys.argv[2],)).fetchone()
+print("%s %s" % row if row else "none")
+PY
+}
+
+echo -e "\n🔍 Dropping the collector in the middle of a request..."
+REQUEST_ID=$(request) || fail "Request failed"
+for i in $(seq 1 20); do
+    [ -s "${WORK_DIR}/docker-run.log" ] && break
+    sleep 0.5
+done
+[ -s "${WORK_DIR}/docker-run.log" ] || fail "Collector did not start collecting"
+drop_collector
+[ "$(response_status "${REQUEST_ID}")" = "pending " ] || fail "Request is not pending after the drop: $(response_status "${REQUEST_ID}")"
+echo "✅ Collector dropped with request ${REQUEST_ID} unanswered"
+
+echo -e "\n🔍 Reconnecting the collector..."
+start_collector collector-2.log
+grep -q "Sent unanswered request ${REQUEST_ID} to reconnected station reconnect-station again" "${WORK_DIR}/api.log" ||
+    fail "API server did not send the request again"
+for i in $(seq 1 30); do
+    [ "$(response_status "${REQUEST_ID}")" = "ready " ] && break
+    sleep 0.5
+done
+[ "$(response_status "${REQUEST_ID}")" = "ready " ] || fail "Request was not answered after the reconnect: $(response_status "${REQUEST_ID}")"
+STATUS=$(curl -s "${API_URL}/api/data/status/${REQUEST_ID}" -H "Authorization: Bearer ${TOKEN}" |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["status"])')
+[ "${STATUS}" = "complete" ] || fail "Request status is ${STATUS}"
+echo "✅ Reconnected collector answered the request"
+
+echo -e "\n🔍 Dropping the collector with a request that is then too old..."
+STALE_ID=$(request) || fail "Request failed"
+for i in $(seq 1 20); do
+    grep -q "Received data request: ${STALE_ID}" "${WORK_DIR}/collector-2.log" && break
+    sleep 0.5
+done
+drop_collector
+python3 - "${DATABASE_PATH}" "${STALE_ID}" <<'PY'
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1])
+db.execute("UPDATE data_requests SET created_at = datetime('now', '-2 minutes') WHERE id = ?", (sys.argv[2],))
+db.commit()
+PY
+start_collector collector-3.log
+sleep 1
+grep -q "Received data request: ${STALE_ID}" "${WORK_DIR}/collector-3.log" && fail "Stale request was sent to the collector again"
+[ "$(response_status "${STALE_ID}")" = "error station disconnected before answering and the request is older than 60s" ] ||
+    fail "Stale request was not failed for the station: $(response_status "${STALE_ID}")"
+echo "✅ Stale request failed instead of sent again"
+
+echo -e "\n🎉 Collector reconnect test passed!"
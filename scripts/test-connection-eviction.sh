@@ -0,0 +1,188 @@
+#!/bin/bash
+
+# Checks that the API server reclaims the slots of receiver WebSockets that
+# stopped answering pings: with MAX_RECEIVER_CONNECTIONS reached, a new
+# connection evicts the least recently seen receiver if it has missed its
+# pings and is refused with 1013 if every receiver still answers them, and a
+# receiver that stays silent is closed once WS_PONG_TIMEOUT_SECONDS has
+# passed. /health must count both under connection_evictions.
+#
+# Usage: scripts/test-connection-eviction.sh
+#   E2E_PORT  Port for the API server (default: 18126)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18126}"
+LIMIT=2
+PING_INTERVAL=1
+PONG_TIMEOUT=6
+
+echo "Connection Eviction Test"
+echo "========================"
+
+source "$(dirname "$0")/lib.sh"
+
+# register <email> registers a receiver user and prints its token and ID
+register() {
+    curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\", \"client_type\": 2}" |
+        python3 -c 'import json, sys; r = json.load(sys.stdin); print(r["token"], r["user"]["id"])'
+}
+
+# receiver <name> <token> <mode> opens /receiver-ws with a raw handshake in
+# the background, writing to <name>.out. It prints "open" once connected, and
+# "close <code>" or "eof" when the server closes the connection. With mode
+# pong it answers the server's pings; with mode silent it never does. Sets
+# RECEIVER_PID.
+receiver() {
+    python3 - "${E2E_PORT}" "$2" "$3" > "${WORK_DIR}/$1.out" 2>&1 <<'PY' &
+import base64, os, socket, struct, sys
+
+port, token, mode = int(sys.argv[1]), sys.argv[2], sys.argv[3]
+sock = socket.create_connection(("localhost", port))
+sock.sendall((
+    "GET /receiver-ws HTTP/1.1\r\n"
+    f"Host: localhost:{port}\r\n"
+    "Upgrade: websocket\r\nConnection: Upgrade\r\n"
+    f"Sec-WebSocket-Key: {base64.b64encode(os.urandom(16)).decode()}\r\nSec-WebSocket-Version: 13\r\n"
+    f"Authorization: Bearer {token}\r\n\r\n").encode())
+
+buf = b""
+while b"\r\n\r\n" not in buf:
+    chunk = sock.recv(4096)
+    if not chunk:
+        print("eof", flush=True)
+        sys.exit(0)
+    buf += chunk
+head, buf = buf.split(b"\r\n\r\n", 1)
+if b" 101 " not in head.split(b"\r\n")[0]:
+    print("handshake failed: " + head.split(b"\r\n")[0].decode(), flush=True)
+    sys.exit(1)
+print("open", flush=True)
+
+def pong(payload):
+    # Client frames must be masked
+    mask = os.urandom(4)
+    masked = bytes(b ^ mask[i % 4] for i, b in enumerate(payload))
+    sock.sendall(bytes([0x8A, 0x80 | len(payload)]) + mask + masked)
+
+while True:
+    while len(buf) < 2:
+        chunk = sock.recv(4096)
+        if not chunk:
+            print("eof", flush=True)
+            sys.exit(0)
+        buf += chunk
+    opcode, length = buf[0] & 0x0F, buf[1] & 0x7F
+    offset = 2
+    if length == 126:
+        length, offset = struct.unpack(">H", buf[2:4])[0], 4
+    elif length == 127:
+        length, offset = struct.unpack(">Q", buf[2:10])[0], 10
+    while len(buf) < offset + length:
+        chunk = sock.recv(4096)
+        if not chunk:
+            print("eof", flush=True)
+            sys.exit(0)
+        buf += chunk
+    payload, buf = buf[offset:offset + length], buf[offset + length:]
+    if opcode == 0x8:
+        print("close", struct.unpack(">H", payload[:2])[0], flush=True)
+        sys.exit(0)
+    if opcode == 0x9 and mode == "pong":
+        pong(payload)
+PY
+    RECEIVER_PID=$!
+    PIDS+=($RECEIVER_PID)
+}
+
+# wait_output <name> <line> waits for a receiver to print a line
+wait_output() {
+    for i in $(seq 1 40); do
+        grep -q "^$2\$" "${WORK_DIR}/$1.out" 2>/dev/null && return
+        sleep 0.25
+    done
+    fail "Receiver $1 did not print '$2'"
+}
+
+# health <key> <kind> prints /health's count of receiver connections under key
+health() {
+    curl -s "${API_URL}/health" | python3 -c "import json, sys; print(json.load(sys.stdin)['$1']['$2'])"
+}
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/eviction.db"
+export JWT_SECRET="eviction-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+export MAX_RECEIVER_CONNECTIONS="${LIMIT}"
+export WS_PING_INTERVAL_SECONDS="${PING_INTERVAL}"
+export WS_PONG_TIMEOUT_SECONDS="${PONG_TIMEOUT}"
+
+echo -e "\n🔍 Starting API server with ${LIMIT} receiver connections allowed..."
+start_api
+echo "✅ API server healthy"
+
+for name in silent responsive newcomer refused latecomer; do
+    read -r token id <<< "$(register "${name}@example.com")" || fail "Failed to register ${name}"
+    [ -n "${id:-}" ] || fail "Failed to register ${name}"
+    eval "TOKEN_${name}=${token} ID_${name}=${id}"
+done
+
+echo -e "\n🔍 Filling the limit with a silent and a responsive receiver..."
+receiver silent "${TOKEN_silent}" silent
+wait_output silent open
+receiver responsive "${TOKEN_responsive}" pong
+wait_output responsive open
+[ "$(health connections receiver)" = "${LIMIT}" ] || fail "/health does not report ${LIMIT} receiver connections"
+# Let the silent receiver miss two pings
+sleep $(( 2 * PING_INTERVAL + 1 ))
+echo "✅ ${LIMIT} receiver connections open"
+
+echo -e "\n🔍 Connecting another receiver past the limit..."
+receiver newcomer "${TOKEN_newcomer}" pong
+NEWCOMER_PID="${RECEIVER_PID}"
+wait_output newcomer open
+wait_output silent eof
+grep -q "Evicting the receiver connection of user ${ID_silent} to make room: no pong for" "${WORK_DIR}/api.log" ||
+    fail "The server did not log evicting the silent receiver"
+grep -q "Evicting the receiver connection of user ${ID_responsive}" "${WORK_DIR}/api.log" &&
+    fail "The responsive receiver was evicted"
+sleep 1
+grep -q "open" "${WORK_DIR}/newcomer.out" && ! grep -q "close\|eof" "${WORK_DIR}/newcomer.out" ||
+    fail "The new receiver did not keep its connection"
+[ "$(health connections receiver)" = "${LIMIT}" ] || fail "/health does not report ${LIMIT} receiver connections after the eviction"
+[ "$(health connection_evictions receiver)" = "1" ] || fail "/health does not count the eviction"
+echo "✅ The silent receiver was evicted to make room and the new one kept its slot"
+
+echo -e "\n🔍 Connecting past the limit while every receiver answers pings..."
+sleep $(( 2 * PING_INTERVAL + 1 ))
+receiver refused "${TOKEN_refused}" pong
+wait_output refused "close 1013"
+grep -q "close\|eof" "${WORK_DIR}/responsive.out" "${WORK_DIR}/newcomer.out" &&
+    fail "A responsive receiver lost its connection"
+echo "✅ The connection was refused with 1013 and the responsive receivers kept theirs"
+
+echo -e "\n🔍 Leaving a silent receiver alone past the pong timeout..."
+kill "${NEWCOMER_PID}"
+for i in $(seq 1 20); do
+    [ "$(health connections receiver)" = "1" ] && break
+    sleep 0.25
+done
+[ "$(health connections receiver)" = "1" ] || fail "The closed receiver's slot was not freed"
+receiver latecomer "${TOKEN_latecomer}" silent
+wait_output latecomer open
+for i in $(seq 1 $(( 4 * (PONG_TIMEOUT + 2) ))); do
+    grep -q "^eof$" "${WORK_DIR}/latecomer.out" && break
+    sleep 0.25
+done
+grep -q "^eof$" "${WORK_DIR}/latecomer.out" || fail "The silent receiver was not closed after ${PONG_TIMEOUT}s"
+grep -q "Receiver of user ${ID_latecomer} missed liveness deadline (${PONG_TIMEOUT}s), closing connection" "${WORK_DIR}/api.log" ||
+    fail "The server did not log the missed liveness deadline"
+[ "$(health connections receiver)" = "1" ] || fail "/health does not report 1 receiver connection after the timeout"
+[ "$(health connection_evictions receiver)" = "2" ] || fail "/health does not count the closed receiver"
+echo "✅ The silent receiver was closed after ${PONG_TIMEOUT}s without a pong"
+
+echo -e "\n🎉 Connection eviction test passed!"
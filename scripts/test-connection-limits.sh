@@ -0,0 +1,141 @@
+#!/bin/bash
+
+# Checks that the API server enforces MAX_RECEIVER_CONNECTIONS: connections
+# past the limit are closed with 1013 (try again later) and /health reports
+# the current count.
+#
+# Usage: scripts/test-connection-limits.sh
+#   E2E_PORT  Port for the API server (default: 18084)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18084}"
+LIMIT=2
+
+echo "Connection Limit Test"
+echo "====================="
+
+source "$(dirname "$0")/lib.sh"
+HOLD_PIDS=""
+
+# on_cleanup stops the held connections and their python children
+on_cleanup() {
+    for pid in ${HOLD_PIDS}; do
+        pkill -P "${pid}" 2>/dev/null
+        kill "${pid}" 2>/dev/null
+    done
+}
+
+# register EMAIL prints a receiver token for a new user
+register() {
+    curl -s -X POST "${API_URL}/api/auth/register" \
+        -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\", \"client_type\": 2}" |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])'
+}
+
+# ws_client TOKEN MODE opens /receiver-ws with a raw handshake. With MODE=hold
+# it prints "open" and keeps the connection until killed; with MODE=probe it
+# prints "open" if the connection stays up, or the close code it receives.
+ws_client() {
+    python3 - "${E2E_PORT}" "$1" "$2" <<'PY'
+import base64, os, socket, struct, sys, time
+
+port, token, mode = int(sys.argv[1]), sys.argv[2], sys.argv[3]
+sock = socket.create_connection(("localhost", port))
+key = base64.b64encode(os.urandom(16)).decode()
+sock.sendall((
+    "GET /receiver-ws HTTP/1.1\r\n"
+    f"Host: localhost:{port}\r\n"
+    "Upgrade: websocket\r\nConnection: Upgrade\r\n"
+    f"Sec-WebSocket-Key: {key}\r\nSec-WebSocket-Version: 13\r\n"
+    f"Authorization: Bearer {token}\r\n\r\n").encode())
+
+buf = b""
+while b"\r\n\r\n" not in buf:
+    chunk = sock.recv(4096)
+    if not chunk:
+        print("handshake failed")
+        sys.exit(1)
+    buf += chunk
+head, buf = buf.split(b"\r\n\r\n", 1)
+if b" 101 " not in head.split(b"\r\n")[0]:
+    print("handshake failed: " + head.split(b"\r\n")[0].decode())
+    sys.exit(1)
+
+if mode == "hold":
+    print("open", flush=True)
+    while sock.recv(4096):
+        pass
+    sys.exit(0)
+
+# Read frames until a close frame arrives or the connection stays quiet
+sock.settimeout(2)
+try:
+    while True:
+        while len(buf) < 2:
+            chunk = sock.recv(4096)
+            if not chunk:
+                print("eof")
+                sys.exit(0)
+            buf += chunk
+        opcode, length = buf[0] & 0x0F, buf[1] & 0x7F
+        offset = 2
+        if length == 126:
+            length, offset = struct.unpack(">H", buf[2:4])[0], 4
+        while len(buf) < offset + length:
+            buf += sock.recv(4096)
+        payload, buf = buf[offset:offset + length], buf[offset + length:]
+        if opcode == 0x8:
+            print(struct.unpack(">H", payload[:2])[0])
+            sys.exit(0)
+except socket.timeout:
+    print("open")
+PY
+}
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/connlimit.db"
+export JWT_SECRET="connlimit-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+export MAX_RECEIVER_CONNECTIONS="${LIMIT}"
+
+echo -e "\n🔍 Starting API server with ${LIMIT} receiver connections allowed..."
+start_api
+echo "✅ API server healthy"
+
+for i in $(seq 1 "${LIMIT}"); do
+    token=$(register "receiver${i}@example.com") || fail "Failed to register receiver ${i}"
+    ws_client "${token}" hold > "${WORK_DIR}/hold${i}.out" 2>&1 &
+    HOLD_PIDS="${HOLD_PIDS} $!"
+done
+
+for i in $(seq 1 20); do
+    opened=$(cat "${WORK_DIR}"/hold*.out 2>/dev/null | grep -c '^open$')
+    [ "${opened}" = "${LIMIT}" ] && break
+    [ "${i}" = "20" ] && fail "Only ${opened} of ${LIMIT} receiver connections opened"
+    sleep 0.5
+done
+echo "✅ ${LIMIT} receiver connections open"
+
+active=$(curl -s "${API_URL}/health" | python3 -c 'import json, sys; print(json.load(sys.stdin)["connections"]["receiver"])')
+[ "${active}" = "${LIMIT}" ] || fail "/health reports ${active} receiver connections, expected ${LIMIT}"
+echo "✅ /health reports ${active} receiver connections"
+
+token=$(register "receiver-extra@example.com") || fail "Failed to register the extra receiver"
+result=$(ws_client "${token}" probe)
+[ "${result}" = "1013" ] || fail "Connection over the limit got '${result}', expected close code 1013"
+echo "✅ Connection over the limit closed with 1013"
+
+# Freeing a slot lets the next receiver in
+first_pid=$(echo "${HOLD_PIDS}" | awk '{print $1}')
+pkill -P "${first_pid}" 2>/dev/null
+sleep 1
+result=$(ws_client "${token}" probe)
+[ "${result}" = "open" ] || fail "Connection after a slot was freed got '${result}', expected it to stay open"
+echo "✅ Connection accepted once a slot is free"
+
+echo -e "\n🎉 Connection limit test completed successfully!"
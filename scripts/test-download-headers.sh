@@ -0,0 +1,120 @@
+#!/bin/bash
+
+# Checks the headers downloads are served with when the station ID holds
+# characters that don't belong in a header: quotes, semicolons, spaces,
+# non-ASCII letters and a CRLF. The file name in Content-Disposition must only
+# keep safe characters from the IDs, no header may be injected, and the
+# Content-Type and the extension of the cached file must match the format
+# the request asked for.
+#
+# Docker is replaced by a shim on PATH, and the collector uploads its captures
+# so they are served from the server cache.
+#
+# Usage: scripts/test-download-headers.sh
+#   E2E_PORT  Port for the API server (default: 18129)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18129}"
+# Storage keys can't hold a colon, so the injected line isn't a full header
+STATION_ID=$'odd "station"; ü\r\nX-Injected yes'
+SAFE_STATION_ID="odd__station______X-Injected_yes"
+
+echo "Download Headers Test"
+echo "====================="
+
+source "$(dirname "$0")/lib.sh"
+
+# download <format> requests a collection in a format, waits for its file in
+# the server cache and saves the download's headers to <format>.headers
+download() {
+    local request_id url
+    request_id=$(curl -s -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d "{\"request_type\": \"data_collection\", \"parameters\": \"{}\", \"format\": \"$1\"}" |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["request_id"])') || fail "The $1 request was not accepted"
+    url="${API_URL}/api/data/download/${request_id}/$(python3 -c 'import sys, urllib.parse; print(urllib.parse.quote(sys.argv[1], safe=""))' "${STATION_ID}")"
+    for i in $(seq 1 40); do
+        curl -sf -D "${WORK_DIR}/$1.headers" -o "${WORK_DIR}/$1.body" -H "Authorization: Bearer ${TOKEN}" "${url}" && break
+        sleep 0.5
+    done
+    [ -s "${WORK_DIR}/$1.body" ] || fail "The $1 file was not served"
+    REQUEST_ID="${request_id}"
+}
+
+# cached <extension> checks that the last request's file is cached under the extension
+cached() {
+    [ -n "$(find "${CACHE_DIR}/${REQUEST_ID}" -type f -name "*$1" 2>/dev/null)" ] ||
+        fail "The file is not cached as $1: $(ls "${CACHE_DIR}/${REQUEST_ID}" 2>&1)"
+}
+
+# header <format> <name> prints a header of a download, without its CR
+header() {
+    tr -d '\r' < "${WORK_DIR}/$1.headers" | awk -v name="$2" 'tolower($0) ~ "^" tolower(name) ": " { sub(/^[^:]*: /, ""); print }'
+}
+
+build
+
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/headers_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/headers.db"
+export JWT_SECRET="headers-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export CACHE_DIR="${WORK_DIR}/cache"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting a collector whose station ID needs sanitizing..."
+PATH="${WORK_DIR}/bin:${PATH}" COLLECTOR_UPLOAD_FILES=true "${BIN}" collector \
+    --station-id "${STATION_ID}" \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "headers@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+
+echo -e "\n🔍 Downloading an NPZ capture..."
+download npz
+[ "$(header npz Content-Disposition)" = "attachment; filename=${REQUEST_ID}_${SAFE_STATION_ID}_data.npz" ] ||
+    fail "Unexpected Content-Disposition: $(header npz Content-Disposition)"
+[ "$(header npz Content-Type)" = "application/octet-stream" ] || fail "Unexpected Content-Type: $(header npz Content-Type)"
+tr -d '\r' < "${WORK_DIR}/npz.headers" | grep -q "^X-Injected" && fail "The station ID injected a header line"
+python3 - "${WORK_DIR}/npz.body" <<'PY' || fail "The NPZ download is not a ZIP archive"
+import sys, zipfile
+sys.exit(not zipfile.is_zipfile(sys.argv[1]))
+PY
+cached .npz
+echo "✅ The file name only keeps safe characters and no header is injected"
+
+echo -e "\n🔍 Downloading a CSV capture..."
+download csv
+[ "$(header csv Content-Disposition)" = "attachment; filename=${REQUEST_ID}_${SAFE_STATION_ID}_data.csv" ] ||
+    fail "Unexpected Content-Disposition: $(header csv Content-Disposition)"
+[ "$(header csv Content-Type)" = "text/csv; charset=utf-8" ] || fail "Unexpected Content-Type: $(header csv Content-Type)"
+head -n 1 "${WORK_DIR}/csv.body" | grep -q "^index," || fail "The CSV download has no header row"
+cached .csv
+echo "✅ CSV captures are served as text/csv and cached as .csv"
+
+echo -e "\n🎉 Download headers test passed!"
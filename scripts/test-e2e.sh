@@ -0,0 +1,141 @@
+#!/bin/bash
+
+# End-to-end test of the request -> collect -> transfer -> download flow.
+#
+# Runs the API server, a collector and a receiver on this machine. Docker is
+# replaced by a shim on PATH that writes a small NPZ file into the collector's
+# data directory, so no SDR hardware or container image is needed.
+#
+# Usage: scripts/test-e2e.sh
+#   E2E_PORT     Port for the API server (default: 18080)
+#   E2E_TIMEOUT  Seconds to wait for the receiver to finish (default: 120)
+#   E2E_KEEP     Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18080}"
+E2E_TIMEOUT="${E2E_TIMEOUT:-120}"
+
+echo "End-to-End Test: API + Collector + Receiver"
+echo "==========================================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: find the bind mount source and write an NPZ file into it
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data" "${WORK_DIR}/downloads"
+cat > "${WORK_DIR}/bin/docker" <<'EOF'
+#!/bin/bash
+# Only "docker run" is simulated; everything else succeeds silently
+[ "$1" = "run" ] || exit 0
+
+src=""
+while [ $# -gt 0 ]; do
+    case "$1" in
+        --mount)
+            shift
+            src=$(echo "$1" | tr ',' '\n' | sed -n 's/^src=//p')
+            ;;
+        --mount=*)
+            src=$(echo "${1#--mount=}" | tr ',' '\n' | sed -n 's/^src=//p')
+            ;;
+    esac
+    shift
+done
+
+[ -n "$src" ] || { echo "fake docker: no bind mount source" >&2; exit 1; }
+
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+
+# A minimal .npy holding four little-endian float32 values
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+
+path = "%s/e2e_%d.npz" % (sys.argv[1], int(time.time() * 1000))
+with zipfile.ZipFile(path, "w") as zf:
+    zf.writestr("samples.npy", npy)
+print("fake docker wrote", path)
+PY
+EOF
+chmod +x "${WORK_DIR}/bin/docker"
+echo "✅ Docker shim installed"
+
+export DATABASE_PATH="${WORK_DIR}/e2e.db"
+export JWT_SECRET="e2e-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+
+# Start the API server
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+# Start the collector with the docker shim first on PATH
+echo -e "\n🔍 Starting collector..."
+PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+    --station-id e2e-station-1 \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+# Run the receiver and wait for it to finish
+echo -e "\n🔍 Running receiver..."
+timeout "${E2E_TIMEOUT}s" "${BIN}" receiver \
+    --receiver-id e2e-receiver-1 \
+    --api-server-url "${API_URL}" \
+    --download-dir "${WORK_DIR}/downloads" > "${WORK_DIR}/receiver.log" 2>&1
+RECEIVER_EXIT=$?
+
+[ $RECEIVER_EXIT -eq 0 ] || fail "Receiver exited with status ${RECEIVER_EXIT}"
+echo "✅ Receiver finished"
+
+# Candidates relayed by the server must be understood by both clients
+grep -h "Ignoring malformed ICE candidate" "${WORK_DIR}/receiver.log" "${WORK_DIR}/collector.log" &&
+    fail "A client could not read a relayed ICE candidate"
+echo "✅ Relayed ICE candidates accepted"
+
+# Verify the downloaded file matches what the collector produced
+SOURCE_FILE=$(ls -t "${WORK_DIR}"/data/*/*.npz 2>/dev/null | head -n 1)
+DOWNLOADED_FILE=$(ls -t "${WORK_DIR}"/downloads/*.npz 2>/dev/null | head -n 1)
+
+[ -n "${SOURCE_FILE}" ] || fail "Collector did not produce a file"
+[ -n "${DOWNLOADED_FILE}" ] || fail "Receiver did not download a file"
+cmp -s "${SOURCE_FILE}" "${DOWNLOADED_FILE}" || fail "Downloaded file does not match the collected file"
+echo "✅ Downloaded file matches collected file ($(wc -c < "${DOWNLOADED_FILE}") bytes)"
+
+# Verify the capture metadata sidecar describes the downloaded file
+METADATA_FILE=$(ls -t "${WORK_DIR}"/downloads/*_metadata.json 2>/dev/null | head -n 1)
+[ -n "${METADATA_FILE}" ] || fail "Receiver did not save capture metadata"
+python3 - "${METADATA_FILE}" "${DOWNLOADED_FILE}" <<'PY' || fail "Capture metadata does not describe the downloaded file"
+import hashlib, json, sys
+metadata = json.load(open(sys.argv[1]))
+data = open(sys.argv[2], "rb").read()
+assert metadata["station_id"] == "e2e-station-1", metadata
+assert metadata["sha256"] == hashlib.sha256(data).hexdigest(), metadata
+assert metadata["file_size"] == len(data), metadata
+assert metadata["capture_start"] <= metadata["capture_end"], metadata
+PY
+echo "✅ Capture metadata saved alongside the download"
+
+# Verify the request manifest indexes the download and its metadata
+MANIFEST_FILE=$(ls -t "${WORK_DIR}"/downloads/*_manifest.json 2>/dev/null | head -n 1)
+[ -n "${MANIFEST_FILE}" ] || fail "Receiver did not write a manifest"
+python3 - "${MANIFEST_FILE}" "${DOWNLOADED_FILE}" <<'PY' || fail "Manifest does not describe the download"
+import hashlib, json, os, sys
+manifest = json.load(open(sys.argv[1]))
+data = open(sys.argv[2], "rb").read()
+assert len(manifest["stations"]) == 1 and manifest["failed_stations"] == [], manifest
+station = manifest["stations"][0]
+assert station["station_id"] == "e2e-station-1", station
+assert station["file"] == os.path.basename(sys.argv[2]), station
+assert station["sha256"] == hashlib.sha256(data).hexdigest(), station
+assert station["capture"]["sha256"] == station["sha256"], station
+PY
+echo "✅ Manifest indexes the download"
+
+echo -e "\n🎉 End-to-end flow completed successfully!"
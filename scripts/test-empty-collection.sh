@@ -0,0 +1,83 @@
+#!/bin/bash
+
+# Checks that a collection whose container exits cleanly without writing a
+# capture file fails with "no data file produced" instead of reporting success
+# with no file.
+#
+# Docker is replaced by a shim on PATH whose "run" only creates a directory in
+# the output mount, which matches CAPTURE_FILE_PATTERN but isn't a file.
+#
+# Usage: scripts/test-empty-collection.sh
+#   E2E_PORT  Port for the API server (default: 18133)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18133}"
+
+echo "Empty Collection Test"
+echo "====================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: "run" finds the bind mount source and leaves only a directory in it
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data" "${WORK_DIR}/downloads"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+
+src=""
+while [ $# -gt 0 ]; do
+    case "$1" in
+        --mount) shift; src=$(echo "$1" | tr ',' '\n' | sed -n 's/^src=//p') ;;
+        --mount=*) src=$(echo "${1#--mount=}" | tr ',' '\n' | sed -n 's/^src=//p') ;;
+    esac
+    shift
+done
+
+[ -n "$src" ] || { echo "fake docker: no bind mount source" >&2; exit 1; }
+mkdir -p "$src/scratch"
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+echo "✅ Docker shim installed"
+
+export DATABASE_PATH="${WORK_DIR}/empty.db"
+export JWT_SECRET="empty-collection-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting collector..."
+PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+    --station-id empty-station-1 \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+echo -e "\n🔍 Running receiver..."
+timeout 60s "${BIN}" receiver \
+    --receiver-id empty-receiver-1 \
+    --api-server-url "${API_URL}" \
+    --download-dir "${WORK_DIR}/downloads" > "${WORK_DIR}/receiver.log" 2>&1
+RECEIVER_EXIT=$?
+
+[ -d "${WORK_DIR}"/data/*/scratch ] || fail "Collector never ran the container"
+[ $RECEIVER_EXIT -ne 0 ] || fail "Receiver succeeded even though no capture file was written"
+[ $RECEIVER_EXIT -ne 124 ] || fail "Receiver hung instead of getting an error"
+echo "✅ Receiver failed"
+
+grep -q "no data file produced" "${WORK_DIR}/collector.log" || fail "Collector did not report the missing capture file"
+grep -q "no data file produced" "${WORK_DIR}/receiver.log" || fail "Receiver error does not mention the missing capture file"
+echo "✅ The missing capture file was reported"
+
+grep -q "Data collection completed" "${WORK_DIR}/collector.log" && fail "Collector reported the collection as completed"
+echo "✅ The collection was not reported as completed"
+
+echo -e "\n🎉 Empty collection test passed!"
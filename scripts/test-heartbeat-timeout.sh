@@ -0,0 +1,92 @@
+#!/bin/bash
+
+# Checks that the server closes the connection of a collector that stopped
+# sending heartbeats, even though its socket stays open, and marks its
+# session disconnected, while a working collector stays connected. Pings are
+# made too rare to notice the stopped collector, so only the heartbeat
+# timeout can.
+#
+# Usage: scripts/test-heartbeat-timeout.sh
+#   E2E_PORT  Port for the API server (default: 18112)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18112}"
+TIMEOUT=35
+
+echo "Heartbeat Timeout Test"
+echo "======================"
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/heartbeat.db"
+export JWT_SECRET="heartbeat-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Checking timeout validation..."
+STATION_HEARTBEAT_TIMEOUT_SECONDS=30 timeout 10 "${BIN}" api > "${WORK_DIR}/invalid.log" 2>&1 &&
+    fail "API server started with a heartbeat timeout of 30 seconds"
+grep -q "STATION_HEARTBEAT_TIMEOUT_SECONDS must be more than 30 or 0" "${WORK_DIR}/invalid.log" ||
+    fail "Invalid heartbeat timeout was not reported"
+rm -f "${WORK_DIR}/invalid.log"
+echo "✅ A timeout within the heartbeat interval is refused"
+
+echo -e "\n🔍 Starting API server on ${API_URL} with a ${TIMEOUT} second heartbeat timeout..."
+STATION_HEARTBEAT_TIMEOUT_SECONDS=${TIMEOUT} WS_PING_INTERVAL_SECONDS=600 WS_PONG_TIMEOUT_SECONDS=1200 \
+    start_api
+echo "✅ API server healthy"
+
+# start_collector <station> starts a collector and waits for it to connect
+start_collector() {
+    mkdir -p "${WORK_DIR}/data-$1"
+    "${BIN}" collector \
+        --station-id "$1" \
+        --api-server-url "${API_URL}" \
+        --data-dir "${WORK_DIR}/data-$1" > "${WORK_DIR}/$1.log" 2>&1 &
+    PIDS+=($!)
+
+    wait_collector "${WORK_DIR}/$1.log" "Collector $1 did not connect to the API server"
+}
+
+# session_status <station> prints the station's collector session status
+session_status() {
+    python3 - "${DATABASE_PATH}" "$1" <<'PY'
+import sqlite3, sys
+row = sqlite3.connect(sys.argv[1]).execute(
+    "SELECT status FROM collector_sessions WHERE station_id = ?", (sys.argv[2],)).fetchone()
+print(row[0] if row else "")
+PY
+}
+
+echo -e "\n🔍 Starting two collectors and stopping one..."
+start_collector st-alive
+start_collector st-stuck
+STUCK_PID=${PIDS[-1]}
+[ "$(session_status st-stuck)" = "connected" ] || fail "st-stuck is not connected"
+# A stopped process still has its socket open, but sends nothing
+kill -STOP "${STUCK_PID}"
+echo "✅ st-stuck stopped"
+
+echo -e "\n🔍 Waiting for the heartbeat timeout..."
+for i in $(seq 1 $((TIMEOUT + 20))); do
+    grep -q "Station st-stuck sent no heartbeat for" "${WORK_DIR}/api.log" && break
+    sleep 1
+done
+grep -q "Station st-stuck sent no heartbeat for" "${WORK_DIR}/api.log" || fail "st-stuck was not dropped"
+for i in $(seq 1 10); do
+    [ "$(session_status st-stuck)" = "disconnected" ] && break
+    sleep 0.5
+done
+[ "$(session_status st-stuck)" = "disconnected" ] || fail "st-stuck's session is $(session_status st-stuck)"
+grep -q "Station disconnected: st-stuck" "${WORK_DIR}/api.log" || fail "st-stuck's connection was not cleaned up"
+echo "✅ st-stuck was disconnected"
+
+[ "$(session_status st-alive)" = "connected" ] || fail "st-alive's session is $(session_status st-alive)"
+grep -q "Station st-alive sent no heartbeat" "${WORK_DIR}/api.log" && fail "st-alive was dropped"
+echo "✅ st-alive, which kept sending heartbeats, is still connected"
+
+echo -e "\n🎉 Heartbeat timeout test passed!"
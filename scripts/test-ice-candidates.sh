@@ -0,0 +1,245 @@
+#!/bin/bash
+
+# Checks that ICE candidates survive the trip between peers: the collector's
+# candidates reach the receiver's WebSocket with the field names and values
+# they were stored with, one of them posted back is added to the collector's
+# peer connection, and so are candidates whose sdpMid is null, missing or
+# empty, as WebRTC allows.
+#
+# The receiver is played by curl and a WebSocket client: it opens a session
+# for a finished request, answers the collector's offer with the offer's own
+# media section, then posts candidates in each form.
+#
+# Usage: scripts/test-ice-candidates.sh
+#   E2E_PORT  Port for the API server (default: 18136)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18136}"
+
+echo "ICE Candidate Test"
+echo "=================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: write an NPZ file into the bind mount
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data"
+cat > "${WORK_DIR}/bin/docker" <<'EOF'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+[ -n "$src" ] || { echo "fake docker: no bind mount source" >&2; exit 1; }
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/candidate_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/candidates.db"
+export JWT_SECRET="candidates-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting a collector..."
+PATH="${WORK_DIR}/bin:${PATH}" LOG_LEVEL=debug "${BIN}" collector \
+    --station-id candidate-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "candidates@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the receiver user"
+
+# api <method> <path> [body] prints the HTTP status and saves the body
+api() {
+    curl -s -o "${WORK_DIR}/body" -w "%{http_code}" -X "$1" "${API_URL}$2" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" ${3:+-d "$3"}
+}
+
+# field <expression> evaluates a Python expression on the last body as r
+field() {
+    python3 -c "import json, sys; r = json.load(open(sys.argv[1])); print($1)" "${WORK_DIR}/body"
+}
+
+# Relayed candidates arrive on the receiver's WebSocket, which is connected
+# before the session is opened; each is written to relayed.out
+python3 - "${E2E_PORT}" "${TOKEN}" > "${WORK_DIR}/relayed.out" 2> "${WORK_DIR}/relayed.err" <<'PY' &
+import base64, json, os, socket, struct, sys
+
+port, token = int(sys.argv[1]), sys.argv[2]
+sock = socket.create_connection(("localhost", port))
+key = base64.b64encode(os.urandom(16)).decode()
+sock.sendall((
+    "GET /receiver-ws HTTP/1.1\r\n"
+    f"Host: localhost:{port}\r\n"
+    "Upgrade: websocket\r\nConnection: Upgrade\r\n"
+    f"Sec-WebSocket-Key: {key}\r\nSec-WebSocket-Version: 13\r\n"
+    f"Authorization: Bearer {token}\r\n\r\n").encode())
+
+buf = b""
+while b"\r\n\r\n" not in buf:
+    buf += sock.recv(4096)
+head, buf = buf.split(b"\r\n\r\n", 1)
+if b" 101 " not in head.split(b"\r\n")[0]:
+    sys.exit("handshake failed: " + head.split(b"\r\n")[0].decode())
+
+def read(n):
+    global buf
+    while len(buf) < n:
+        chunk = sock.recv(65536)
+        if not chunk:
+            sys.exit(0)
+        buf += chunk
+    data, buf = buf[:n], buf[n:]
+    return data
+
+while True:
+    first, second = read(2)
+    length = second & 0x7F
+    if length == 126:
+        length = struct.unpack(">H", read(2))[0]
+    elif length == 127:
+        length = struct.unpack(">Q", read(8))[0]
+    payload = read(length)
+    if first & 0x0F == 1:
+        message = json.loads(payload)
+        if message["type"] == "ice_candidate":
+            print(json.dumps(message), flush=True)
+PY
+PIDS+=($!)
+
+echo -e "\n🔍 Collecting a file to transfer..."
+[ "$(api POST /api/data/request '{"request_type": "data_collection", "parameters": "{}"}')" = "202" ] ||
+    fail "Request failed: $(cat "${WORK_DIR}/body")"
+REQUEST_ID=$(field 'r["request_id"]')
+[ "$(api GET "/api/data/wait/${REQUEST_ID}?timeout=20")" = "200" ] && [ "$(field 'r["status"]')" = "complete" ] ||
+    fail "Request did not complete: $(cat "${WORK_DIR}/body")"
+echo "✅ Request ${REQUEST_ID} complete"
+
+echo -e "\n🔍 Opening an ICE session and answering the collector's offer..."
+PARAMETERS=$(python3 -c 'import json, sys; print(json.dumps({"parameters": json.dumps({"request_id": sys.argv[1], "station_id": "candidate-station"})}))' "${REQUEST_ID}")
+[ "$(api POST /api/ice/request "${PARAMETERS}")" = "201" ] || fail "Opening the session failed: $(cat "${WORK_DIR}/body")"
+SESSION_ID=$(field 'r["session_id"]')
+
+for i in $(seq 1 40); do
+    [ "$(api GET "/api/ice/signals/${SESSION_ID}")" = "200" ] && [ "$(field 'r.get("offer_sdp", "")')" != "" ] && break
+    sleep 0.25
+done
+OFFER=$(field 'r.get("offer_sdp", "")')
+[ -n "${OFFER}" ] || fail "The collector did not send an offer"
+
+# The offer's media section with the roles swapped and fresh ICE credentials
+# is an answer the collector can set, which it must before adding candidates
+ANSWER=$(python3 - "${SESSION_ID}" "${OFFER}" <<'PY'
+import json, sys, uuid
+lines = []
+for line in sys.argv[2].splitlines():
+    if line.startswith(("a=candidate", "a=end-of-candidates")):
+        continue
+    if line.startswith("a=setup:"):
+        line = "a=setup:active"
+    elif line.startswith("a=ice-ufrag:"):
+        line = "a=ice-ufrag:" + uuid.uuid4().hex[:8]
+    elif line.startswith("a=ice-pwd:"):
+        line = "a=ice-pwd:" + uuid.uuid4().hex
+    lines.append(line)
+print(json.dumps({"session_id": sys.argv[1], "type": "answer",
+                  "session_description": {"type": "answer", "sdp": "\r\n".join(lines) + "\r\n"}}))
+PY
+)
+[ "$(api POST /api/ice/signal "${ANSWER}")" = "200" ] || fail "Answering failed: $(cat "${WORK_DIR}/body")"
+for i in $(seq 1 40); do
+    grep -q "Remote description set successfully for session ${SESSION_ID}" "${WORK_DIR}/collector.log" && break
+    sleep 0.25
+done
+grep -q "Remote description set successfully for session ${SESSION_ID}" "${WORK_DIR}/collector.log" ||
+    fail "The collector did not accept the answer"
+echo "✅ Session ${SESSION_ID} answered"
+
+echo -e "\n🔍 Comparing the candidates relayed to the receiver with the stored ones..."
+for i in $(seq 1 40); do
+    [ -s "${WORK_DIR}/relayed.out" ] && break
+    sleep 0.25
+done
+[ -s "${WORK_DIR}/relayed.out" ] || fail "No candidates were relayed to the receiver: $(cat "${WORK_DIR}/relayed.err")"
+[ "$(api GET "/api/ice/signals/${SESSION_ID}")" = "200" ] || fail "Fetching the session's signals failed"
+RELAYED=$(python3 - "${SESSION_ID}" "${WORK_DIR}/relayed.out" "${WORK_DIR}/body" <<'PY'
+import json, sys
+session_id = sys.argv[1]
+relayed = [json.loads(line) for line in open(sys.argv[2])]
+stored = json.load(open(sys.argv[3]))["candidates"]
+for candidate in relayed:
+    keys = sorted(candidate)
+    assert keys == ["candidate", "sdpMLineIndex", "sdpMid", "session_id", "timestamp", "type", "version"], "relayed with fields %s" % keys
+    assert candidate["session_id"] == session_id, candidate
+    assert candidate["candidate"].startswith("candidate:"), candidate
+    assert isinstance(candidate["sdpMLineIndex"], int), candidate
+# The collector may still be gathering, so later candidates can be stored but
+# not yet read, and an empty stored sdpMid is relayed as null
+fields = lambda c: (c["candidate"], c["sdpMLineIndex"], c["sdpMid"] or None)
+assert set(map(fields, relayed)) <= set(map(fields, stored)), "relayed %s, stored %s" % (relayed, stored)
+print(len(relayed))
+PY
+) || fail "Relayed candidates differ from the stored ones: ${RELAYED}"
+echo "✅ ${RELAYED} candidates relayed as stored, with WebRTC's field names"
+
+echo -e "\n🔍 Posting a relayed candidate back as the receiver's..."
+ECHOED=$(python3 - "${SESSION_ID}" "${WORK_DIR}/relayed.out" <<'PY'
+import json, sys
+candidate = json.loads(open(sys.argv[2]).readline())
+print(json.dumps({"session_id": sys.argv[1], "type": "candidate", "ice_candidate": {
+    "candidate": candidate["candidate"], "sdpMLineIndex": candidate["sdpMLineIndex"], "sdpMid": candidate["sdpMid"]}}))
+PY
+)
+[ "$(api POST /api/ice/signal "${ECHOED}")" = "200" ] || fail "The echoed candidate was refused: $(cat "${WORK_DIR}/body")"
+for i in $(seq 1 20); do
+    grep -q "Successfully added ICE candidate for session ${SESSION_ID}" "${WORK_DIR}/collector.log" && break
+    sleep 0.25
+done
+grep -q "Successfully added ICE candidate for session ${SESSION_ID}" "${WORK_DIR}/collector.log" ||
+    fail "The collector did not add the echoed candidate: $(grep "ICE candidate" "${WORK_DIR}/collector.log")"
+echo "✅ The collector added it"
+
+# candidate <port> <fields> posts a host candidate on the port with the extra
+# JSON fields, which must be accepted
+candidate() {
+    local status
+    status=$(api POST /api/ice/signal "{\"session_id\": \"${SESSION_ID}\", \"type\": \"candidate\",
+        \"ice_candidate\": {\"candidate\": \"candidate:$1 1 udp 2130706431 127.0.0.1 $1 typ host\"$2}}")
+    [ "${status}" = "200" ] || fail "Candidate with${2:- no other fields} was refused (${status}): $(cat "${WORK_DIR}/body")"
+}
+
+echo -e "\n🔍 Sending candidates without an sdpMid..."
+candidate 40001 ', "sdpMLineIndex": 0, "sdpMid": null'
+candidate 40002 ', "sdpMLineIndex": 0'
+candidate 40003 ', "sdpMLineIndex": 0, "sdpMid": ""'
+candidate 40004 ', "sdpMLineIndex": null, "sdpMid": null'
+candidate 40005 ''
+echo "✅ The server accepted all five"
+
+for i in $(seq 1 20); do
+    [ "$(grep -c "Successfully added ICE candidate for session ${SESSION_ID}" "${WORK_DIR}/collector.log")" -ge 6 ] && break
+    sleep 0.25
+done
+grep "ICE candidate" "${WORK_DIR}/collector.log" | grep -E "Ignoring malformed|Failed to add" &&
+    fail "The collector could not use a candidate without an sdpMid"
+ADDED=$(grep -c "Successfully added ICE candidate for session ${SESSION_ID}" "${WORK_DIR}/collector.log")
+[ "${ADDED}" = "6" ] || fail "The collector added $((ADDED - 1)) of the 5 candidates"
+echo "✅ The collector added all five"
+
+echo -e "\n🎉 ICE candidate test passed!"
@@ -0,0 +1,170 @@
+#!/bin/bash
+
+# Checks that a receiver restarts a WebRTC transfer's ICE connection when it
+# fails instead of failing the transfer, and that the transfer then carries on
+# where it stopped.
+#
+# The collector sends a large file and the receiver is frozen with SIGSTOP
+# mid-transfer until the collector's ICE connection has failed, standing in
+# for a network change. Once resumed, the receiver's connection fails too and
+# it must ask the collector to restart ICE and then get the whole file
+# without its idle timeout firing. A second run freezes the collector
+# instead, so the restart is never answered, and checks that the transfer
+# fails.
+#
+# Usage: scripts/test-ice-restart.sh
+#   E2E_PORT  Port for the API server (default: 18125)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18125}"
+FILE_MB=100
+IDLE_TIMEOUT=8
+
+echo "ICE Restart Test"
+echo "================"
+
+source "$(dirname "$0")/lib.sh"
+FROZEN_PID=""
+
+# on_cleanup resumes the frozen process, which may be the receiver's child
+on_cleanup() {
+    [ -n "${FROZEN_PID}" ] && kill -CONT "${FROZEN_PID}" 2>/dev/null
+}
+
+build
+
+# Fake docker: write an NPZ file large enough that the transfer takes a while
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data"
+cat > "${WORK_DIR}/bin/docker" <<EOF2
+#!/bin/bash
+[ "\$1" = "run" ] || exit 0
+src=\$(echo "\$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+python3 - "\$src" <<'PY'
+import os, struct, sys, time, zipfile
+
+count = ${FILE_MB} * 1024 * 1024 // 4
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (%d,), }" % count
+header += " " * (63 - len(header) % 64) + "\n"
+
+with zipfile.ZipFile("%s/restart_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    with zf.open("samples.npy", "w", force_zip64=True) as npy:
+        npy.write(b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode())
+        for _ in range(${FILE_MB}):
+            npy.write(os.urandom(1024 * 1024))
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/restart.db"
+export JWT_SECRET="restart-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+# Lose the ICE connection quickly once the collector is frozen. Keepalives
+# must come more often than the disconnected timeout, or the connection
+# flaps whenever the data channel is briefly quiet.
+export ICE_KEEPALIVE_INTERVAL_SECONDS=1
+export ICE_DISCONNECTED_TIMEOUT_SECONDS=2
+export ICE_FAILED_TIMEOUT_SECONDS=2
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting collector..."
+PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+    --station-id restart-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+COLLECTOR_PID=$!
+PIDS+=($COLLECTOR_PID)
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+# run_receiver <name> <restarts> <frozen> starts a receiver with
+# RECEIVER_ICE_RESTARTS set to restarts, freezes the frozen process ("receiver"
+# or "collector") once 20 MB of the file have arrived and sets RECEIVER_PID,
+# LOG and FROZEN_PID. Freezing either any earlier can leave the data channel's
+# opening unacknowledged, which makes pion's SCTP fall back to zero checksums
+# that the collector then rejects.
+run_receiver() {
+    LOG="${WORK_DIR}/$1.log"
+    mkdir -p "${WORK_DIR}/$1-downloads"
+    RECEIVER_ICE_RESTARTS="$2" RECEIVER_TRANSFER_IDLE_SECONDS="${IDLE_TIMEOUT}" RECEIVER_TRANSFER_MIN_THROUGHPUT_KBPS=0 \
+        timeout 120s "${BIN}" receiver \
+        --receiver-id "restart-$1" \
+        --api-server-url "${API_URL}" \
+        --download-dir "${WORK_DIR}/$1-downloads" > "${LOG}" 2>&1 &
+    RECEIVER_PID=$!
+
+    for i in $(seq 1 1200); do
+        grep -q "ICE transfer progress: .* (20971520/" "${LOG}" && break
+        kill -0 "${RECEIVER_PID}" 2>/dev/null || break
+        sleep 0.05
+    done
+    grep -q "ICE transfer progress: .* (20971520/" "${LOG}" || fail "Receiver $1 never started receiving the file"
+    # RECEIVER_PID is timeout's; the receiver is its child
+    if [ "$3" = "receiver" ]; then FROZEN_PID=$(pgrep -P "${RECEIVER_PID}"); else FROZEN_PID="${COLLECTOR_PID}"; fi
+    kill -STOP "${FROZEN_PID}"
+}
+
+# wait_restart waits for the receiver to ask for an ICE restart
+wait_restart() {
+    for i in $(seq 1 40); do
+        grep -q "Restarting ICE for session .* (attempt 1 of $1)" "${LOG}" && return
+        sleep 0.25
+    done
+    fail "Receiver did not restart ICE after the connection failed"
+}
+
+echo -e "\n🔍 Freezing the receiver mid-transfer until the collector's connection fails..."
+run_receiver receiver 2 receiver
+echo "✅ Receiver frozen mid-transfer"
+# Freezing the collector instead would have it read the receiver's last
+# acknowledgements late on resuming, which skews its retransmission timeout
+for i in $(seq 1 40); do
+    grep -q "ICE connection failed for session" "${WORK_DIR}/collector.log" && break
+    sleep 0.25
+done
+grep -q "ICE connection failed for session" "${WORK_DIR}/collector.log" || fail "Collector's ICE connection did not fail"
+kill -CONT "${FROZEN_PID}"
+wait_restart 2
+wait "${RECEIVER_PID}" || fail "Receiver failed after the ICE restart"
+grep -q "ICE file transfer completed" "${LOG}" || fail "Receiver did not complete the transfer"
+grep -q "ICE connection restored for session" "${LOG}" || fail "Receiver did not log the restored connection"
+grep -q "transfer stalled" "${LOG}" && fail "The idle timeout fired during the restart"
+grep -q "Receiver asked to restart ICE for session" "${WORK_DIR}/collector.log" || fail "Collector did not get the restart request"
+grep -q "ICE restart for session .* negotiated" "${WORK_DIR}/collector.log" || fail "Collector did not negotiate the restart"
+grep -q "ICE restart requested for session .* by user" "${WORK_DIR}/api.log" || fail "API server did not log the restart request"
+
+DOWNLOADED=$(ls "${WORK_DIR}/receiver-downloads"/*_restart-station_data.npz 2>/dev/null | head -n 1)
+[ -n "${DOWNLOADED}" ] || fail "Receiver saved no file"
+SENT=$(ls "${WORK_DIR}/data"/*/restart_*.npz | head -n 1)
+cmp -s "${DOWNLOADED}" "${SENT}" || fail "Downloaded file differs from the collector's ($(stat -c %s "${DOWNLOADED}")/$(stat -c %s "${SENT}") bytes)"
+echo "✅ The transfer survived the failed connection and the file is complete ($(stat -c %s "${DOWNLOADED}") bytes)"
+
+echo -e "\n🔍 Restarting ICE as someone else..."
+SESSION_ID=$(grep -o "Restarting ICE for session [^ ]*" "${LOG}" | head -n 1 | awk '{print $5}')
+OTHER_TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "restart-other@example.com", "password": "password123", "client_type": 1}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register another user"
+STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST "${API_URL}/api/ice/signal" \
+    -H "Authorization: Bearer ${OTHER_TOKEN}" -H "Content-Type: application/json" \
+    -d "{\"session_id\": \"${SESSION_ID}\", \"type\": \"restart\"}")
+[ "${STATUS}" = "403" ] || fail "A restart from someone other than the session's receiver got ${STATUS}"
+echo "✅ Only the session's receiver can restart its ICE"
+
+echo -e "\n🔍 Freezing the collector through the restart..."
+run_receiver unanswered 1 collector
+wait_restart 1
+wait "${RECEIVER_PID}"
+EXIT=$?
+kill -CONT "${FROZEN_PID}"
+[ "${EXIT}" -ne 0 ] || fail "Receiver succeeded although the restart was never answered"
+[ "${EXIT}" -ne 124 ] || fail "Receiver hung instead of giving up on the restart"
+grep -q "ICE connection failed and could not be restarted: timeout waiting for offer" "${LOG}" ||
+    fail "Receiver error does not report the failed restart"
+echo "✅ The transfer fails once the restart can't be negotiated"
+
+echo -e "\n🎉 ICE restart test passed!"
@@ -0,0 +1,154 @@
+#!/bin/bash
+
+# Checks that the API server fails ICE sessions that aren't established
+# within ICE_SESSION_PENDING_TTL_SECONDS: the session and its file transfer
+# are failed, the receiver is told with session_failed, /health counts it
+# and further signals for it are rejected with 410.
+#
+# Usage: scripts/test-ice-session-expiry.sh
+#   E2E_PORT  Port for the API server (default: 18118)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18118}"
+
+echo "ICE Session Expiry Test"
+echo "======================="
+
+source "$(dirname "$0")/lib.sh"
+
+# sql <statement> runs a statement on the server's database and prints the
+# first column of the first row, if any
+sql() {
+    python3 - "${DATABASE_PATH}" "$1" <<'PY'
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1], timeout=10)
+row = db.execute(sys.argv[2]).fetchone()
+db.commit()
+if row is not None:
+    print(row[0])
+PY
+}
+
+# wait_for <statement> <expected> waits for a query to return a value
+wait_for() {
+    for i in $(seq 1 30); do
+        [ "$(sql "$1")" = "$2" ] && return 0
+        sleep 0.5
+    done
+    return 1
+}
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/expiry.db"
+export JWT_SECRET="expiry-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Checking TTL validation..."
+ICE_SESSION_PENDING_TTL_SECONDS=-1 timeout 10 "${BIN}" api > "${WORK_DIR}/invalid.log" 2>&1 &&
+    fail "API server started with ICE_SESSION_PENDING_TTL_SECONDS=-1"
+grep -q "ICE_SESSION_PENDING_TTL_SECONDS" "${WORK_DIR}/invalid.log" || fail "Invalid TTL was not reported"
+rm -f "${WORK_DIR}/invalid.log"
+echo "✅ A negative TTL is refused"
+
+echo -e "\n🔍 Starting API server on ${API_URL} with a 4 second TTL..."
+ICE_SESSION_PENDING_TTL_SECONDS=4 start_api
+echo "✅ API server healthy"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "receiver@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+
+# Hold a /receiver-ws connection open and print the type and session ID of
+# each message it gets
+python3 - "${E2E_PORT}" "${TOKEN}" > "${WORK_DIR}/receiver.out" 2>&1 <<'PY' &
+import base64, json, os, socket, struct, sys
+
+port, token = int(sys.argv[1]), sys.argv[2]
+sock = socket.create_connection(("localhost", port))
+key = base64.b64encode(os.urandom(16)).decode()
+sock.sendall((
+    "GET /receiver-ws HTTP/1.1\r\n"
+    f"Host: localhost:{port}\r\n"
+    "Upgrade: websocket\r\nConnection: Upgrade\r\n"
+    f"Sec-WebSocket-Key: {key}\r\nSec-WebSocket-Version: 13\r\n"
+    f"Authorization: Bearer {token}\r\n\r\n").encode())
+
+buf = b""
+while b"\r\n\r\n" not in buf:
+    buf += sock.recv(4096)
+head, buf = buf.split(b"\r\n\r\n", 1)
+print(head.split(b"\r\n")[0].decode(), flush=True)
+
+def read(n):
+    global buf
+    while len(buf) < n:
+        chunk = sock.recv(4096)
+        if not chunk:
+            raise EOFError
+        buf += chunk
+    data, buf = buf[:n], buf[n:]
+    return data
+
+try:
+    while True:
+        first, second = read(2)
+        length = second & 0x7F
+        if length == 126:
+            length = struct.unpack(">H", read(2))[0]
+        elif length == 127:
+            length = struct.unpack(">Q", read(8))[0]
+        payload = read(length)
+        if first & 0x0F == 1:
+            message = json.loads(payload)
+            print(message["type"], message.get("session_id", ""), message.get("request_id", ""), flush=True)
+except EOFError:
+    pass
+PY
+PIDS+=($!)
+
+for i in $(seq 1 20); do
+    grep -q " 101 " "${WORK_DIR}/receiver.out" && break
+    sleep 0.25
+done
+grep -q " 101 " "${WORK_DIR}/receiver.out" || fail "The receiver did not connect: $(cat "${WORK_DIR}/receiver.out")"
+echo "✅ Receiver connected"
+
+echo -e "\n🔍 Opening an ICE session and never signaling it..."
+SESSION_ID=$(curl -s -X POST "${API_URL}/api/ice/request" -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+    -d '{"parameters": "{\"request_id\": \"expiry-request\", \"station_id\": \"expiry-station\"}"}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["session_id"])') || fail "Failed to open the session"
+[ "$(sql "SELECT status FROM ice_sessions WHERE session_id = '${SESSION_ID}'")" = "pending" ] ||
+    fail "The new session is not pending"
+echo "✅ Session ${SESSION_ID} is pending"
+
+echo -e "\n🔍 Waiting for the TTL to pass..."
+wait_for "SELECT status FROM ice_sessions WHERE session_id = '${SESSION_ID}'" failed || fail "The session was not failed"
+[ "$(sql "SELECT status FROM file_transfers WHERE session_id = '${SESSION_ID}'")" = "failed" ] ||
+    fail "The session's file transfer was not failed"
+grep -q "ICE session ${SESSION_ID} .* was not established within" "${WORK_DIR}/api.log" || fail "The expiry was not logged"
+echo "✅ The session and its file transfer were failed"
+
+for i in $(seq 1 20); do
+    grep -q "^session_failed ${SESSION_ID} expiry-request" "${WORK_DIR}/receiver.out" && break
+    sleep 0.25
+done
+grep -q "^session_failed ${SESSION_ID} expiry-request" "${WORK_DIR}/receiver.out" ||
+    fail "The receiver was not told: $(cat "${WORK_DIR}/receiver.out")"
+echo "✅ The receiver got session_failed"
+
+EXPIRED=$(curl -s "${API_URL}/health" | python3 -c 'import json, sys; print(json.load(sys.stdin)["ice_sessions"]["expired"])')
+[ "${EXPIRED}" = "1" ] || fail "/health reports ${EXPIRED} expired sessions, not 1"
+echo "✅ /health counts the expired session"
+
+echo -e "\n🔍 Signaling the expired session..."
+STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST "${API_URL}/api/ice/signal" -H "Authorization: Bearer ${TOKEN}" \
+    -H "Content-Type: application/json" \
+    -d "{\"session_id\": \"${SESSION_ID}\", \"type\": \"offer\", \"session_description\": {\"type\": \"offer\", \"sdp\": \"v=0\"}}")
+[ "${STATUS}" = "410" ] || fail "Signaling the expired session returned ${STATUS}, not 410"
+echo "✅ Signaling the expired session returns 410"
+
+echo -e "\n🎉 ICE session expiry test passed!"
@@ -0,0 +1,218 @@
+#!/bin/bash
+
+# Checks that a collector started with --pull pulls and verifies its container
+# image before connecting: a failed pull or a digest that doesn't match
+# COLLECTOR_IMAGE_DIGEST stops it at startup, a pulled image is reported ready
+# on its status server and to the API server, and an image a reload switches
+# to that can't be pulled keeps the server from choosing the collector until
+# a reload to a good image. Without --pull or a pinned digest the collector
+# must not touch the image at all.
+#
+# Docker is replaced by a shim on PATH that logs its calls to docker.calls,
+# fails to pull images listed in ${WORK_DIR}/missing and reports pulled
+# images with the digest in ${WORK_DIR}/digest.
+#
+# Usage: scripts/test-image-pull.sh
+#   E2E_PORT     Port for the API server (default: 18127)
+#   STATUS_PORT  Port for the collector status server (default: 18128)
+#   E2E_KEEP     Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18127}"
+STATUS_PORT="${STATUS_PORT:-18128}"
+STATUS_URL="http://127.0.0.1:${STATUS_PORT}/status"
+IMAGE="example/sdr:1.0"
+DIGEST="sha256:$(printf 'a%.0s' $(seq 1 64))"
+OTHER_DIGEST="sha256:$(printf 'b%.0s' $(seq 1 64))"
+
+echo "Image Pull Test"
+echo "==============="
+
+source "$(dirname "$0")/lib.sh"
+
+# collector [args...] runs a collector in the foreground for at most 10s,
+# logging to collector.log; it only returns early if the collector exits
+collector() {
+    PATH="${WORK_DIR}/bin:${PATH}" CONTAINER_IMAGE="${IMAGE}" timeout 10s "${BIN}" collector \
+        --station-id pull-station --api-server-url "${API_URL}" --data-dir "${WORK_DIR}/data" "$@" \
+        > "${WORK_DIR}/collector.log" 2>&1
+}
+
+# image_status prints the state of the collector's image and its digest
+image_status() {
+    curl -sf "${STATUS_URL}" |
+        python3 -c 'import json, sys; i = json.load(sys.stdin).get("image") or {}; print(i.get("image"), i.get("state"), i.get("digest", ""))'
+}
+
+# wait_image <image> <state> <digest> waits for the status server to report the image
+wait_image() {
+    for i in $(seq 1 40); do
+        [ "$(image_status)" = "$1 $2 $3" ] && return
+        sleep 0.25
+    done
+    fail "The status server reports the image as '$(image_status)' instead of '$1 $2 $3'"
+}
+
+# unavailable prints why the plan for a request leaves the station out, if it does
+unavailable() {
+    curl -s -X POST "${API_URL}/api/data/request/plan" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d '{"request_type": "data_collection", "parameters": "{}"}' |
+        python3 -c 'import json, sys; print(",".join(s["reason"] for s in json.load(sys.stdin)["unavailable"]))'
+}
+
+# wait_unavailable <reason> waits for the plan to give the station as unavailable for reason
+wait_unavailable() {
+    for i in $(seq 1 40); do
+        [ "$(unavailable)" = "$1" ] && return
+        sleep 0.25
+    done
+    fail "The plan gives the station as '$(unavailable)' instead of '$1'"
+}
+
+# reload <image> broadcasts a reload to the image
+reload() {
+    curl -sf -X POST "${API_URL}/api/admin/collectors/broadcast" \
+        -H "Authorization: Bearer ${ADMIN_TOKEN}" -H "Content-Type: application/json" \
+        -d "{\"command\": \"reload\", \"container_image\": \"$1\"}" > /dev/null || fail "Failed to broadcast the reload to $1"
+}
+
+# pulls <image> prints how often the shim was asked to pull an image
+pulls() {
+    grep -c "^pull $1\$" "${WORK_DIR}/docker.calls" 2>/dev/null
+}
+
+build
+
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data" "${WORK_DIR}/images"
+echo "${DIGEST}" > "${WORK_DIR}/digest"
+touch "${WORK_DIR}/missing"
+cat > "${WORK_DIR}/bin/docker" <<EOF2
+#!/bin/bash
+echo "\$*" >> "${WORK_DIR}/docker.calls"
+case "\$1" in
+pull)
+    if grep -qx "\$2" "${WORK_DIR}/missing"; then
+        echo "Error response from daemon: manifest for \$2 not found: manifest unknown" >&2
+        exit 1
+    fi
+    touch "${WORK_DIR}/images/\$(echo "\$2" | tr '/:' '__')"
+    ;;
+image)
+    image="\${@: -1}"
+    if [ ! -f "${WORK_DIR}/images/\$(echo "\$image" | tr '/:' '__')" ]; then
+        echo "Error: No such image: \$image" >&2
+        exit 1
+    fi
+    echo "\${image%:*}@\$(cat "${WORK_DIR}/digest")"
+    ;;
+run)
+    src=\$(echo "\$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+    python3 - "\$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/pull_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+    ;;
+esac
+exit 0
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/pull.db"
+export JWT_SECRET="pull-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Checking that invalid settings are rejected..."
+COLLECTOR_IMAGE_DIGEST="sha256:1234" collector && fail "The collector started with a malformed COLLECTOR_IMAGE_DIGEST"
+grep -q 'invalid COLLECTOR_IMAGE_DIGEST "sha256:1234": must be sha256: followed by 64 hex digits' "${WORK_DIR}/collector.log" ||
+    fail "The collector did not explain why the digest is invalid"
+COLLECTOR_IMAGE_PULL_TIMEOUT_SECONDS=-1 collector && fail "The collector started with a negative COLLECTOR_IMAGE_PULL_TIMEOUT_SECONDS"
+grep -q "invalid COLLECTOR_IMAGE_PULL_TIMEOUT_SECONDS -1: must not be negative" "${WORK_DIR}/collector.log" ||
+    fail "The collector did not explain why the pull timeout is invalid"
+echo "✅ Invalid settings are rejected"
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+"${BIN}" admin create-user --email admin@example.com --password password123 --admin \
+    > "${WORK_DIR}/create-user.log" 2>&1 || fail "admin create-user failed"
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting collectors whose image can't be pulled or verified..."
+echo "${IMAGE}" > "${WORK_DIR}/missing"
+collector --pull && fail "The collector started although its image can't be pulled"
+grep -q "Failed to start collector: container image ${IMAGE} not ready: docker pull failed: .*manifest unknown" "${WORK_DIR}/collector.log" ||
+    fail "The collector did not explain that the pull failed"
+grep -q "Collector client started successfully" "${WORK_DIR}/collector.log" && fail "The collector connected before pulling its image"
+: > "${WORK_DIR}/missing"
+COLLECTOR_IMAGE_DIGEST="${OTHER_DIGEST}" collector --pull && fail "The collector started with an image that doesn't match its pinned digest"
+grep -q "not ready: image digest ${DIGEST} does not match the pinned ${OTHER_DIGEST}" "${WORK_DIR}/collector.log" ||
+    fail "The collector did not explain the digest mismatch"
+echo "✅ A failed pull and a digest mismatch stop the collector at startup"
+
+echo -e "\n🔍 Starting a collector without --pull or a pinned digest..."
+rm -f "${WORK_DIR}/images/"* "${WORK_DIR}/docker.calls"
+echo "${IMAGE}" > "${WORK_DIR}/missing"
+collector
+grep -q "Collector client started successfully" "${WORK_DIR}/collector.log" ||
+    fail "The collector without --pull did not start although its image is missing"
+[ -f "${WORK_DIR}/docker.calls" ] && fail "The collector without --pull ran docker: $(cat "${WORK_DIR}/docker.calls")"
+: > "${WORK_DIR}/missing"
+echo "✅ Without --pull or a pinned digest the image is left alone"
+
+echo -e "\n🔍 Starting a collector with --pull and the right digest..."
+PATH="${WORK_DIR}/bin:${PATH}" CONTAINER_IMAGE="${IMAGE}" COLLECTOR_IMAGE_DIGEST="${DIGEST}" \
+    COLLECTOR_STATUS_PORT="${STATUS_PORT}" "${BIN}" collector --pull \
+    --station-id pull-station --api-server-url "${API_URL}" --data-dir "${WORK_DIR}/data" \
+    > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+grep -q "Pulled container image ${IMAGE} in" "${WORK_DIR}/collector.log" || fail "The collector did not log the pull"
+grep -q "Container image ${IMAGE} matches its pinned digest ${DIGEST}" "${WORK_DIR}/collector.log" ||
+    fail "The collector did not log the verified digest"
+wait_image "${IMAGE}" ready "${DIGEST}"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "pull@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+ADMIN_TOKEN=$(curl -s -X POST "${API_URL}/api/auth/login" -H "Content-Type: application/json" \
+    -d '{"email": "admin@example.com", "password": "password123"}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to log in the admin"
+
+[ -z "$(unavailable)" ] || fail "The station is unavailable: $(unavailable)"
+curl -sf -X POST "${API_URL}/api/data/request" -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+    -d '{"request_type": "data_collection", "parameters": "{}"}' > /dev/null || fail "The request was not accepted"
+for i in $(seq 1 40); do
+    grep -q "^run " "${WORK_DIR}/docker.calls" && break
+    sleep 0.25
+done
+grep -q "^run " "${WORK_DIR}/docker.calls" || fail "The collection did not run"
+[ "$(pulls "${IMAGE}")" = "1" ] || fail "The image was pulled $(pulls "${IMAGE}") times instead of once"
+echo "✅ The image is pulled and verified once at startup and reported ready"
+
+echo -e "\n🔍 Reloading to an image that can't be pulled..."
+echo "example/sdr:broken" > "${WORK_DIR}/missing"
+reload example/sdr:broken
+wait_image example/sdr:broken failed ""
+grep -q "Container image example/sdr:broken is not ready: docker pull failed" "${WORK_DIR}/collector.log" ||
+    fail "The collector did not log the failed pull"
+wait_unavailable "container image not ready"
+status=$(curl -s -o /dev/null -w "%{http_code}" -X POST "${API_URL}/api/data/request" \
+    -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+    -d '{"request_type": "data_collection", "parameters": "{}"}')
+[ "${status}" = "503" ] || fail "A request returned ${status} while the only station's image isn't ready"
+echo "✅ The server stops choosing the collector whose image can't be pulled"
+
+echo -e "\n🔍 Reloading to an image that can be pulled..."
+reload example/sdr:2.0
+wait_image example/sdr:2.0 ready "${DIGEST}"
+wait_unavailable ""
+[ "$(pulls example/sdr:2.0)" = "1" ] || fail "The new image was not pulled"
+echo "✅ The collector is chosen again once its image is ready"
+
+echo -e "\n🎉 Image pull test passed!"
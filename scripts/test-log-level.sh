@@ -0,0 +1,112 @@
+#!/bin/bash
+
+# Checks that LOG_LEVEL filters what the API server logs and that an admin can
+# change the level at runtime with POST /api/admin/loglevel.
+#
+# Submitting a data request writes a debug message ("RequestData: ...") and
+# every HTTP request writes an info message ("Request: ..."), so the log shows
+# which levels are being written.
+#
+# Usage: scripts/test-log-level.sh
+#   E2E_PORT  Port for the API server (default: 18095)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18095}"
+
+echo "Log Level Test"
+echo "=============="
+
+source "$(dirname "$0")/lib.sh"
+
+# login EMAIL prints the token
+login() {
+    curl -s -X POST "${API_URL}/api/auth/login" \
+        -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\"}" |
+        sed -n 's/.*"token":"\([^"]*\)".*/\1/p'
+}
+
+# set_level TOKEN LEVEL prints the HTTP status code of the level change
+set_level() {
+    curl -s -o "${WORK_DIR}/loglevel.json" -w "%{http_code}" -X POST "${API_URL}/api/admin/loglevel" \
+        -H "Authorization: Bearer $1" \
+        -H "Content-Type: application/json" \
+        -d "{\"level\": \"$2\"}"
+}
+
+# request_data submits a data request and saves the lines it added to the log in request.log
+request_data() {
+    local before=$(wc -l < "${WORK_DIR}/api.log")
+    curl -s -o /dev/null -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${USER_TOKEN}" -H "Content-Type: application/json" \
+        -d '{"request_type": "data_collection", "parameters": "{}"}'
+    sleep 0.5
+    tail -n +$(( before + 1 )) "${WORK_DIR}/api.log" > "${WORK_DIR}/request.log"
+}
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/loglevel.db"
+export JWT_SECRET="loglevel-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+LOG_LEVEL=verbose timeout 10s "${BIN}" api > "${WORK_DIR}/invalid.log" 2>&1 && fail "API server started with LOG_LEVEL=verbose"
+grep -q "invalid LOG_LEVEL" "${WORK_DIR}/invalid.log" || fail "Unknown LOG_LEVEL was not reported: $(tail -n 1 "${WORK_DIR}/invalid.log")"
+echo "✅ Unknown LOG_LEVEL rejected"
+
+"${BIN}" admin create-user --email admin@example.com --password password123 --admin \
+    > "${WORK_DIR}/create-user.log" 2>&1 || fail "admin create-user failed: $(cat "${WORK_DIR}/create-user.log")"
+echo "✅ Admin user created"
+
+echo -e "\n🔍 Starting API server on ${API_URL} with LOG_LEVEL=info..."
+LOG_LEVEL=info start_api
+echo "✅ API server healthy"
+
+curl -s -o /dev/null -X POST "${API_URL}/api/auth/register" \
+    -H "Content-Type: application/json" \
+    -d '{"email": "user@example.com", "password": "password123", "client_type": 2}'
+
+ADMIN_TOKEN=$(login admin@example.com)
+USER_TOKEN=$(login user@example.com)
+[ -n "${ADMIN_TOKEN}" ] || fail "Admin login failed"
+[ -n "${USER_TOKEN}" ] || fail "User login failed"
+echo "✅ Admin and user logged in"
+
+request_data
+grep -q "\[INFO\] Request: POST /api/data/request" "${WORK_DIR}/request.log" || fail "Info message missing at level info"
+grep -q "\[DEBUG\]" "${WORK_DIR}/api.log" && fail "Debug messages written at level info: $(grep -m 1 "\[DEBUG\]" "${WORK_DIR}/api.log")"
+echo "✅ Debug messages filtered at level info"
+
+curl -s "${API_URL}/api/admin/loglevel" -H "Authorization: Bearer ${ADMIN_TOKEN}" | grep -q '"level":"info"' ||
+    fail "GET /api/admin/loglevel does not report info"
+echo "✅ Current level reported"
+
+status=$(set_level "${ADMIN_TOKEN}" debug)
+[ "${status}" = "200" ] || fail "Changing the level to debug returned ${status}: $(cat "${WORK_DIR}/loglevel.json")"
+grep -q '"previous":"info"' "${WORK_DIR}/loglevel.json" || fail "Response does not report the previous level: $(cat "${WORK_DIR}/loglevel.json")"
+request_data
+grep -q "\[DEBUG\] RequestData:" "${WORK_DIR}/request.log" || fail "Debug message missing after switching to debug"
+grep -q "changed the log level from info to debug" "${WORK_DIR}/api.log" || fail "Level change was not logged"
+echo "✅ Debug messages written after switching to debug"
+
+status=$(set_level "${ADMIN_TOKEN}" error)
+[ "${status}" = "200" ] || fail "Changing the level to error returned ${status}: $(cat "${WORK_DIR}/loglevel.json")"
+request_data
+grep -q "\[DEBUG\]\|\[INFO\]\|\[WARN\]" "${WORK_DIR}/request.log" &&
+    fail "Messages below error written at level error: $(grep -m 1 "\[DEBUG\]\|\[INFO\]\|\[WARN\]" "${WORK_DIR}/request.log")"
+echo "✅ Only errors written after switching to error"
+
+status=$(set_level "${ADMIN_TOKEN}" verbose)
+[ "${status}" = "400" ] || fail "Unknown level returned ${status}, expected 400"
+curl -s "${API_URL}/api/admin/loglevel" -H "Authorization: Bearer ${ADMIN_TOKEN}" | grep -q '"level":"error"' ||
+    fail "Unknown level changed the current level"
+echo "✅ Unknown level rejected with 400"
+
+status=$(set_level "${USER_TOKEN}" debug)
+[ "${status}" = "403" ] || fail "Non-admin level change returned ${status}, expected 403"
+echo "✅ Non-admin rejected with 403"
+
+echo -e "\n🎉 Log level test completed successfully!"
@@ -0,0 +1,125 @@
+#!/bin/bash
+
+# Checks that GET /api/data/wait/:id returns as soon as a station delivers,
+# returns the current status after its timeout, caps the timeout at
+# LONG_POLL_MAX_TIMEOUT_SECONDS, wakes up when the request is cancelled and
+# stops waiting when the client goes away.
+#
+# Docker is replaced by a shim that captures for the requested duration.
+#
+# Usage: scripts/test-long-poll.sh
+#   E2E_PORT  Port for the API server (default: 18105)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18105}"
+
+echo "Long-Poll Test"
+echo "=============="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: sleep for --duration, then write an NPZ file into the bind mount
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+duration=$(echo "$@" | sed -n 's/.*--duration \([^ ]*\).*/\1/p')
+sleep "${duration:-0}"
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/poll_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/poll.db"
+export JWT_SECRET="poll-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+export LONG_POLL_MAX_TIMEOUT_SECONDS=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+LOG_LEVEL=debug start_api
+echo "✅ API server healthy"
+
+PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+    --station-id poll-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "poll@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+
+# request <duration_seconds> prints the ID of a new data request
+request() {
+    curl -s -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d "{\"request_type\": \"data_collection\", \"parameters\": \"{}\", \"duration_seconds\": $1}" |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["request_id"])'
+}
+
+# wait_for <request ID> <query> prints the HTTP status, the request status
+# and the seconds the call took
+wait_for() {
+    local code elapsed
+    read -r code elapsed < <(curl -s -o "${WORK_DIR}/body" -w "%{http_code} %{time_total}" \
+        "${API_URL}/api/data/wait/$1?$2" -H "Authorization: Bearer ${TOKEN}")
+    echo "${code} $(python3 -c 'import json, sys; print(json.load(open(sys.argv[1])).get("status"))' "${WORK_DIR}/body") ${elapsed%.*}"
+}
+
+echo -e "\n🔍 Waiting for a 2 second capture..."
+REQUEST_ID=$(request 2) || fail "Request failed"
+RESULT=$(wait_for "${REQUEST_ID}" "timeout=30")
+read -r CODE STATUS ELAPSED <<< "${RESULT}"
+[ "${CODE}" = "200" ] && [ "${STATUS}" = "complete" ] || fail "Wait returned ${RESULT}"
+[ "${ELAPSED}" -ge 1 ] && [ "${ELAPSED}" -lt 4 ] || fail "Wait did not return when the station delivered (${ELAPSED}s)"
+echo "✅ Wait returned when the station delivered (${ELAPSED}s)"
+
+RESULT=$(wait_for "${REQUEST_ID}" "timeout=30")
+[ "${RESULT}" = "200 complete 0" ] || fail "Wait on a finished request did not return at once: ${RESULT}"
+echo "✅ Wait on a finished request returns at once"
+
+echo -e "\n🔍 Waiting for a 20 second capture..."
+LONG_ID=$(request 20) || fail "Request failed"
+RESULT=$(wait_for "${LONG_ID}" "timeout=1")
+read -r CODE STATUS ELAPSED <<< "${RESULT}"
+[ "${CODE}" = "200" ] && [ "${STATUS}" = "0_of_1_ready" ] && [ "${ELAPSED}" -eq 1 ] ||
+    fail "Wait with a 1 second timeout returned ${RESULT}"
+echo "✅ Wait returned the current status after its timeout"
+
+RESULT=$(wait_for "${LONG_ID}" "timeout=100")
+read -r CODE STATUS ELAPSED <<< "${RESULT}"
+[ "${CODE}" = "200" ] && [ "${ELAPSED}" -eq 4 ] || fail "Wait was not capped at LONG_POLL_MAX_TIMEOUT_SECONDS: ${RESULT}"
+echo "✅ Timeout capped at LONG_POLL_MAX_TIMEOUT_SECONDS"
+
+[ "$(wait_for "${LONG_ID}" "timeout=soon" | cut -d' ' -f1)" = "400" ] || fail "Invalid timeout was not rejected"
+[ "$(wait_for unknown-request "timeout=1" | cut -d' ' -f1)" = "404" ] || fail "Unknown request did not get 404"
+echo "✅ Invalid timeouts and unknown requests are rejected"
+
+echo -e "\n🔍 Leaving a wait early..."
+curl -s -m 1 -o /dev/null "${API_URL}/api/data/wait/${LONG_ID}" -H "Authorization: Bearer ${TOKEN}"
+sleep 0.5
+grep -q "Client stopped waiting for request ${LONG_ID}" "${WORK_DIR}/api.log" || fail "Server kept waiting for a client that left"
+echo "✅ Server stopped waiting when the client left"
+
+echo -e "\n🔍 Cancelling during a wait..."
+(sleep 1; curl -s -o /dev/null -X POST "${API_URL}/api/data/cancel/${LONG_ID}" -H "Authorization: Bearer ${TOKEN}") &
+RESULT=$(wait_for "${LONG_ID}" "timeout=30")
+read -r CODE STATUS ELAPSED <<< "${RESULT}"
+[ "${CODE}" = "200" ] && [ "${STATUS}" = "cancelled" ] && [ "${ELAPSED}" -lt 3 ] || fail "Cancelling did not end the wait: ${RESULT}"
+echo "✅ Cancelling ended the wait"
+
+echo -e "\n🎉 Long-poll test passed!"
@@ -0,0 +1,175 @@
+#!/bin/bash
+
+# Checks that request parameters are held to the collectors' allowlist and
+# can't smuggle anything onto the collection command line: flags as keys or
+# values, values with "=" or spaces, nested objects and arrays, non-finite and
+# out of range numbers, unknown keys and trailing JSON are all rejected, and
+# accepted values reach docker in canonical form.
+#
+# Templates are validated like collectors validate requests, so most payloads
+# are sent as templates; a few go through a collector, with docker replaced by
+# a shim that records its arguments.
+#
+# Usage: scripts/test-malicious-parameters.sh
+#   E2E_PORT  Port for the API server (default: 18134)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18134}"
+
+echo "Malicious Request Parameters Test"
+echo "================================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: record the arguments, then write an NPZ file into the bind mount
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data"
+cat > "${WORK_DIR}/bin/docker" <<EOF2
+#!/bin/bash
+[ "\$1" = "run" ] || exit 0
+echo "\$@" >> "${WORK_DIR}/docker-args.log"
+EOF2
+cat >> "${WORK_DIR}/bin/docker" <<'EOF2'
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/params_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+echo "✅ Docker shim installed"
+
+export DATABASE_PATH="${WORK_DIR}/parameters.db"
+export JWT_SECRET="malicious-parameters-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting collector that only allows center_freq, gain and gain_mode..."
+PATH="${WORK_DIR}/bin:${PATH}" COLLECTOR_ALLOWED_PARAMETERS=center_freq,gain,gain_mode "${BIN}" collector \
+    --station-id params-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "parameters@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+
+# api <method> <path> [body] prints the HTTP status and saves the body
+api() {
+    curl -s -o "${WORK_DIR}/body" -w "%{http_code}" -X "$1" "${API_URL}$2" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" ${3:+-d "$3"}
+}
+
+# field <expression> evaluates a Python expression on the last body as r
+field() {
+    python3 -c "import json, sys; r = json.load(open(sys.argv[1])); print($1)" "${WORK_DIR}/body"
+}
+
+# body <parameters> prints a request body carrying the raw parameters string
+body() {
+    python3 -c 'import json, sys; print(json.dumps({"name": "t", "request_type": "data_collection", "parameters": sys.argv[1]}))' "$1"
+}
+
+# reject <parameters> <error> checks that a template with the parameters is
+# refused with an error containing <error>
+reject() {
+    local status
+    status=$(api POST /api/data/templates "$(body "$1")")
+    [ "${status}" = "400" ] || fail "Parameters $1 were accepted (${status}): $(cat "${WORK_DIR}/body")"
+    field 'r["error"]' | grep -qF -- "$2" || fail "Parameters $1 were rejected for the wrong reason: $(cat "${WORK_DIR}/body")"
+}
+
+echo -e "\n🔍 Sending flags and option syntax..."
+reject '{"--privileged": true}' 'unknown parameter "--privileged"'
+reject '{"gain": "--privileged"}' 'invalid value for parameter "gain": expected a number'
+reject '{"gain": "20 --privileged"}' 'invalid value for parameter "gain": expected a number'
+reject '{"gain": "20"}' 'invalid value for parameter "gain": expected a number'
+reject '{"gain_mode": "-v"}' 'invalid value for parameter "gain_mode": expected one of'
+reject '{"gain_mode": "--gain-mode=auto"}' 'invalid value for parameter "gain_mode": expected one of'
+reject '{"gain_mode": "auto --privileged"}' 'invalid value for parameter "gain_mode": expected one of'
+reject '{"gain_mode": "manual -v /:/host"}' 'invalid value for parameter "gain_mode": expected one of'
+reject '{"gain_mode": "auto=manual"}' 'invalid value for parameter "gain_mode": expected one of'
+echo "✅ Flags, '=' and spaces are rejected"
+
+echo -e "\n🔍 Sending nested objects and arrays..."
+reject '{"gain": {"value": 20}}' 'invalid value for parameter "gain": expected a number'
+reject '{"gain": [20, "--privileged"]}' 'invalid value for parameter "gain": expected a number'
+reject '{"gain_mode": ["auto"]}' 'invalid value for parameter "gain_mode": expected one of'
+reject '{"num_samples": {"$gt": 0}}' 'invalid value for parameter "num_samples": expected an integer'
+reject '[{"gain": 20}]' 'parameters must be a JSON object'
+echo "✅ Nested objects and arrays are rejected"
+
+echo -e "\n🔍 Sending non-finite and out of range numbers..."
+reject '{"gain": NaN}' 'parameters must be a JSON object'
+reject '{"gain": "NaN"}' 'invalid value for parameter "gain": expected a number'
+reject '{"gain": Infinity}' 'parameters must be a JSON object'
+reject '{"gain": 1e400}' 'invalid value for parameter "gain": expected a number'
+reject '{"gain": -1e400}' 'invalid value for parameter "gain": expected a number'
+reject '{"gain": 51}' 'invalid value for parameter "gain": must be between 0 and 50'
+reject '{"gain": -0.001}' 'invalid value for parameter "gain": must be between 0 and 50'
+reject '{"center_freq": 1e12}' 'invalid value for parameter "center_freq": must be between'
+reject '{"num_samples": 1023}' 'invalid value for parameter "num_samples": must be between 1024 and'
+reject '{"num_samples": 2048.5}' 'invalid value for parameter "num_samples": expected an integer'
+reject '{"num_samples": 9223372036854775808}' 'invalid value for parameter "num_samples": expected an integer'
+echo "✅ NaN, infinities and out of range numbers are rejected"
+
+echo -e "\n🔍 Sending unknown keys..."
+reject '{"device": "/dev/sda"}' 'unknown parameter "device"'
+reject '{"gain": 20, "entrypoint": "sh"}' 'unknown parameter "entrypoint"'
+reject '{"Gain": 20}' 'unknown parameter "Gain"'
+reject '{"": 20}' 'unknown parameter ""'
+echo "✅ Unknown keys are rejected"
+
+echo -e "\n🔍 Sending trailing JSON..."
+reject '{"gain": 20} {"--privileged": true}' 'parameters must be a single JSON object'
+reject '{"gain": 20}}' 'parameters must be a single JSON object'
+reject '{"gain": 20}]' 'parameters must be a single JSON object'
+reject '{"gain": 20} 1' 'parameters must be a single JSON object'
+reject '{"gain": 20} --privileged' 'parameters must be a single JSON object'
+echo "✅ Trailing JSON is rejected"
+
+[ "$(api GET /api/data/templates)" = "200" ] && [ "$(field 'len(r["templates"])')" = "0" ] ||
+    fail "Rejected templates were stored: $(cat "${WORK_DIR}/body")"
+[ ! -s "${WORK_DIR}/docker-args.log" ] || fail "Docker ran while only templates were sent"
+
+# collect <parameters> sends a request with the parameters to the collector
+# and saves the finished request's status as the body
+collect() {
+    local request
+    request=$(python3 -c 'import json, sys; print(json.dumps({"request_type": "data_collection", "parameters": sys.argv[1]}))' "$1")
+    [ "$(api POST /api/data/request "${request}")" = "202" ] || fail "Request with $1 was refused: $(cat "${WORK_DIR}/body")"
+    api GET "/api/data/wait/$(field 'r["request_id"]')?timeout=20" > /dev/null
+}
+
+echo -e "\n🔍 Sending payloads through the collector..."
+for parameters in '{"gain": "--privileged"}' '{"gain_mode": "auto --privileged"}' '{"gain": [20]}' '{"sample_rate": 2400000}'; do
+    collect "${parameters}"
+    [ "$(field 'r["status"]')" = "failed" ] || fail "Collection with ${parameters} did not fail: $(cat "${WORK_DIR}/body")"
+done
+[ ! -s "${WORK_DIR}/docker-args.log" ] || fail "Docker ran for rejected parameters: $(cat "${WORK_DIR}/docker-args.log")"
+grep -q 'invalid request parameters: parameter "sample_rate" is not allowed on this collector' "${WORK_DIR}/api.log" ||
+    fail "Collector did not enforce COLLECTOR_ALLOWED_PARAMETERS"
+echo "✅ The collector refused them without running docker"
+
+collect '{"gain_mode": "manual", "gain": 2e1, "center_freq": 1.000e8}'
+[ "$(field 'r["status"]')" = "complete" ] || fail "Collection with valid parameters did not complete: $(cat "${WORK_DIR}/body")"
+ARGS=$(cat "${WORK_DIR}/docker-args.log")
+echo "${ARGS}" | grep -q -- "--center-freq 100000000 --gain 20 --gain-mode manual$" ||
+    fail "Parameters did not reach docker in canonical form: ${ARGS}"
+echo "✅ Valid parameters reached docker in canonical form"
+
+echo -e "\n🎉 Malicious request parameters test passed!"
@@ -0,0 +1,133 @@
+#!/bin/bash
+
+# Checks metadata-first transfers: a receiver with --metadata-only gets a
+# preview of each station's file listing the NPZ's arrays, saves it, and
+# fetches the file only if its --triage-command accepts the preview.
+#
+# Usage: scripts/test-metadata-first.sh
+#   E2E_PORT  Port for the API server (default: 18120)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18120}"
+STATION=preview-station
+
+echo "Metadata-First Transfer Test"
+echo "============================"
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: write an NPZ with 8192 complex samples and two scalars
+mkdir -p "${WORK_DIR}/bin"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+
+def npy(descr, shape, data):
+    header = "{'descr': '%s', 'fortran_order': False, 'shape': %s, }" % (descr, shape)
+    header += " " * (63 - len(header) % 64) + "\n"
+    return b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + data
+
+with zipfile.ZipFile("%s/preview_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w", zipfile.ZIP_DEFLATED) as zf:
+    zf.writestr("samples.npy", npy("<c8", "(8192,)", struct.pack("<16384f", *range(16384))))
+    zf.writestr("center_freq.npy", npy("<f8", "()", struct.pack("<d", 100e6)))
+    zf.writestr("sample_rate.npy", npy("<f8", "()", struct.pack("<d", 2.4e6)))
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+# Triage script: fetch captures at 100 MHz
+cat > "${WORK_DIR}/triage.py" <<'EOF2'
+import json, sys
+preview = json.load(sys.stdin)
+values = {a["name"]: a.get("value") for a in preview.get("arrays", [])}
+sys.exit(0 if values.get("center_freq") == 100e6 else 1)
+EOF2
+
+export DATABASE_PATH="${WORK_DIR}/preview.db"
+export JWT_SECRET="preview-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+    --station-id "${STATION}" \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+# run_receiver <name> [flags...] runs a receiver into its own download
+# directory and sets REQUEST_ID and DIR
+run_receiver() {
+    local name=$1
+    shift
+    DIR="${WORK_DIR}/${name}"
+    timeout 120s "${BIN}" receiver \
+        --receiver-id "${name}" \
+        --api-server-url "${API_URL}" \
+        --download-dir "${DIR}" "$@" > "${WORK_DIR}/${name}.log" 2>&1 || fail "Receiver ${name} failed"
+    REQUEST_ID=$(sed -n 's/.*Request \([^ ]*\) submitted to .*/\1/p' "${WORK_DIR}/${name}.log" | tail -n 1)
+}
+
+# manifest <directory> <request> <expression> evaluates a Python expression on a request's manifest
+manifest() {
+    python3 -c 'import json, sys; m = json.load(open(sys.argv[1])); print(eval(sys.argv[2]))' "$1/$2_manifest.json" "$3"
+}
+
+echo -e "\n🔍 Previewing without a triage command..."
+run_receiver preview-only --metadata-only
+PREVIEW="${DIR}/${REQUEST_ID}_${STATION}_preview.json"
+[ -f "${PREVIEW}" ] || fail "No preview saved: $(ls "${DIR}")"
+ARRAYS=$(python3 -c '
+import json, sys
+p = json.load(open(sys.argv[1]))
+print(" ".join("%s:%s:%s:%s" % (a["name"], a["dtype"], a["shape"], a.get("value")) for a in sorted(p["arrays"], key=lambda a: a["name"])))
+' "${PREVIEW}")
+[ "${ARRAYS}" = "center_freq:<f8:[]:100000000 sample_rate:<f8:[]:2400000 samples:<c8:[8192]:None" ] ||
+    fail "Preview lists unexpected arrays: ${ARRAYS}"
+ls "${DIR}" | grep -q '_data\.npz$' && fail "File was fetched without a triage command"
+[ "$(manifest "${DIR}" "${REQUEST_ID}" '[s["station_id"] for s in m["skipped_stations"]], len(m["stations"])')" = "(['${STATION}'], 0)" ] ||
+    fail "Manifest does not list the skipped station: $(cat "${DIR}/${REQUEST_ID}_manifest.json")"
+grep -q "Receiver skipped preview_" "${WORK_DIR}/collector.log" || fail "Collector did not log the skipped file"
+echo "✅ The preview lists the arrays with their scalar values and the file was skipped"
+
+echo -e "\n🔍 Previewing with a triage command that accepts the capture..."
+run_receiver triage-accept --metadata-only --triage-command "python3 ${WORK_DIR}/triage.py"
+[ -f "${DIR}/${REQUEST_ID}_${STATION}_preview.json" ] || fail "No preview saved: $(ls "${DIR}")"
+FILE="${DIR}/${REQUEST_ID}_${STATION}_data.npz"
+[ -f "${FILE}" ] || fail "Accepted file was not fetched: $(ls "${DIR}")"
+SIZE=$(python3 -c 'import json, sys; print(json.load(open(sys.argv[1]))["size"])' "${DIR}/${REQUEST_ID}_${STATION}_preview.json")
+[ "$(stat -c %s "${FILE}")" = "${SIZE}" ] || fail "Fetched file is not the ${SIZE} bytes the preview announced"
+python3 -c 'import sys, zipfile; zipfile.ZipFile(sys.argv[1]).testzip()' "${FILE}" || fail "Fetched file is not a valid NPZ"
+[ "$(manifest "${DIR}" "${REQUEST_ID}" '[s["station_id"] for s in m["stations"]], "skipped_stations" in m')" = "(['${STATION}'], False)" ] ||
+    fail "Manifest does not list the fetched file: $(cat "${DIR}/${REQUEST_ID}_manifest.json")"
+grep -q "Triage command accepted the file of station ${STATION}" "${WORK_DIR}/triage-accept.log" || fail "Receiver did not log the triage"
+echo "✅ The accepted file was fetched in full"
+
+echo -e "\n🔍 Previewing with a triage command that rejects the capture..."
+run_receiver triage-reject --metadata-only --triage-command "false"
+[ -f "${DIR}/${REQUEST_ID}_${STATION}_preview.json" ] || fail "No preview saved: $(ls "${DIR}")"
+ls "${DIR}" | grep -q '_data\.npz$' && fail "Rejected file was fetched"
+grep -q "Triage command rejected the file of station ${STATION} (exit status 1)" "${WORK_DIR}/triage-reject.log" ||
+    fail "Receiver did not log the rejection"
+echo "✅ The rejected file was skipped"
+
+echo -e "\n🔍 Downloading without --metadata-only..."
+run_receiver plain
+[ -f "${DIR}/${REQUEST_ID}_${STATION}_data.npz" ] || fail "File was not downloaded: $(ls "${DIR}")"
+ls "${DIR}" | grep -q '_preview\.json$' && fail "A plain download saved a preview"
+echo "✅ Plain downloads are unchanged"
+
+echo -e "\n🎉 Metadata-first transfer test passed!"
@@ -0,0 +1,159 @@
+#!/bin/bash
+
+# Checks that request notifications for a user without a connected receiver
+# are queued and delivered once when a receiver connects, and that
+# notifications of cancelled requests and expired ones are not delivered.
+#
+# Usage: scripts/test-notification-queue.sh
+#   E2E_PORT  Port for the API server (default: 18100)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18100}"
+
+echo "Notification Queue Test"
+echo "======================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: find the bind mount source and write an NPZ file into it
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data"
+cat > "${WORK_DIR}/bin/docker" <<'EOF'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+[ -n "$src" ] || { echo "fake docker: no bind mount source" >&2; exit 1; }
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/queue_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/queue.db"
+export JWT_SECRET="queue-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting a collector..."
+PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+    --station-id queue-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "queue@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the receiver user"
+
+# request prints the ID of a new data request once its notification is queued
+request() {
+    local id
+    id=$(curl -s -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d '{"request_type": "data_collection", "parameters": "{}"}' |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["request_id"])') || return 1
+    for i in $(seq 1 20); do
+        grep -q "Queued notification for request ${id}" "${WORK_DIR}/api.log" && { echo "${id}"; return; }
+        sleep 0.5
+    done
+    return 1
+}
+
+# receive connects to /receiver-ws like a receiver and prints the type and
+# request ID of each message it gets within two seconds
+receive() {
+    python3 - "${E2E_PORT}" "${TOKEN}" <<'PY'
+import base64, json, os, socket, struct, sys
+
+port, token = int(sys.argv[1]), sys.argv[2]
+sock = socket.create_connection(("localhost", port))
+key = base64.b64encode(os.urandom(16)).decode()
+sock.sendall((
+    "GET /receiver-ws HTTP/1.1\r\n"
+    f"Host: localhost:{port}\r\n"
+    "Upgrade: websocket\r\nConnection: Upgrade\r\n"
+    f"Sec-WebSocket-Key: {key}\r\nSec-WebSocket-Version: 13\r\n"
+    f"Authorization: Bearer {token}\r\n\r\n").encode())
+
+buf = b""
+while b"\r\n\r\n" not in buf:
+    buf += sock.recv(4096)
+head, buf = buf.split(b"\r\n\r\n", 1)
+if b" 101 " not in head.split(b"\r\n")[0]:
+    sys.exit("handshake failed: " + head.split(b"\r\n")[0].decode())
+
+sock.settimeout(2)
+def read(n):
+    global buf
+    while len(buf) < n:
+        chunk = sock.recv(4096)
+        if not chunk:
+            raise EOFError
+        buf += chunk
+    data, buf = buf[:n], buf[n:]
+    return data
+
+try:
+    while True:
+        first, second = read(2)
+        length = second & 0x7F
+        if length == 126:
+            length = struct.unpack(">H", read(2))[0]
+        elif length == 127:
+            length = struct.unpack(">Q", read(8))[0]
+        payload = read(length)
+        if first & 0x0F == 1:
+            message = json.loads(payload)
+            print(message["type"], message.get("request_id", ""))
+except (socket.timeout, EOFError):
+    pass
+PY
+}
+
+echo -e "\n🔍 Requesting data without a receiver connected..."
+READY_ID=$(request) || fail "Notification of the first request was not queued"
+CANCELLED_ID=$(request) || fail "Notification of the second request was not queued"
+STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST "${API_URL}/api/data/cancel/${CANCELLED_ID}" -H "Authorization: Bearer ${TOKEN}")
+[ "${STATUS}" = "200" ] || fail "Cancelling the second request returned ${STATUS}"
+EXPIRED_ID=$(request) || fail "Notification of the third request was not queued"
+python3 - "${DATABASE_PATH}" "${EXPIRED_ID}" <<'PY'
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1])
+db.execute("UPDATE pending_notifications SET expires_at = datetime('now', '-1 minute') WHERE request_id = ?", (sys.argv[2],))
+db.commit()
+PY
+echo "✅ Three notifications queued, one cancelled and one expired"
+
+echo -e "\n🔍 Connecting a receiver..."
+RESULT=$(receive)
+[ "${RESULT}" = "data_ready ${READY_ID}" ] || fail "Receiver got: ${RESULT:-nothing}"
+echo "✅ Receiver got the queued notification"
+
+RESULT=$(receive)
+[ -z "${RESULT}" ] || fail "Reconnected receiver got notifications again: ${RESULT}"
+echo "✅ Delivered notifications are not sent again"
+
+python3 - "${DATABASE_PATH}" "${READY_ID}" "${CANCELLED_ID}" <<'PY' || fail "Queue not updated as expected"
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1])
+rows = dict(db.execute("SELECT request_id, delivered_at IS NOT NULL FROM pending_notifications"))
+assert rows.get(sys.argv[2]) == 1, rows
+assert sys.argv[3] not in rows, rows
+PY
+echo "✅ Notification marked delivered and the cancelled one removed"
+
+echo -e "\n🎉 Notification queue test passed!"
@@ -0,0 +1,140 @@
+#!/bin/bash
+
+# Checks that a receiver WebSocket that stops reading only loses its
+# connection after NOTIFY_MAX_WRITE_FAILURES consecutive failed writes, that
+# each notification is retried NOTIFY_WRITE_RETRIES times, and that the
+# notifications it didn't get stay queued for its next connection.
+#
+# Large notifications are queued directly in the database so a receiver that
+# doesn't read fills the socket buffers and the server's writes time out.
+#
+# Usage: scripts/test-notify-retry.sh
+#   E2E_PORT  Port for the API server (default: 18104)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18104}"
+
+echo "Notification Write Retry Test"
+echo "============================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/retry.db"
+export JWT_SECRET="retry-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+export NOTIFY_WRITE_TIMEOUT_SECONDS=1
+export NOTIFY_WRITE_RETRIES=1
+export NOTIFY_WRITE_RETRY_DELAY_MS=200
+export NOTIFY_MAX_WRITE_FAILURES=2
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+REGISTRATION=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "retry@example.com", "password": "password123", "client_type": 2}')
+TOKEN=$(echo "${REGISTRATION}" | python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') ||
+    fail "Failed to register the receiver user: ${REGISTRATION}"
+USER_ID=$(echo "${REGISTRATION}" | python3 -c 'import json, sys; print(json.load(sys.stdin)["user"]["id"])') ||
+    fail "Registration does not return the user: ${REGISTRATION}"
+
+# Three 4 MB notifications, more than the socket buffers of a receiver that doesn't read hold
+python3 - "${DATABASE_PATH}" "${USER_ID}" <<'PY'
+import json, sqlite3, sys
+db = sqlite3.connect(sys.argv[1])
+for i in range(3):
+    message = json.dumps({"type": "data_ready", "payload": {"request_id": "big-%d" % i, "padding": "x" * (4 << 20)}})
+    db.execute("INSERT INTO pending_notifications (user_id, request_id, message, expires_at) VALUES (?, ?, ?, datetime('now', '+1 hour'))",
+               (sys.argv[2], "big-%d" % i, message))
+db.commit()
+PY
+echo "✅ Three large notifications queued"
+
+# receive <read> connects to /receiver-ws with a small receive buffer; it
+# prints the request ID of each notification it reads, or with "stall" reads
+# nothing for eight seconds
+receive() {
+    python3 - "${E2E_PORT}" "${TOKEN}" "$1" <<'PY'
+import base64, json, os, socket, struct, sys, time
+
+port, token, mode = int(sys.argv[1]), sys.argv[2], sys.argv[3]
+sock = socket.socket()
+sock.setsockopt(socket.SOL_SOCKET, socket.SO_RCVBUF, 4096)
+sock.connect(("localhost", port))
+key = base64.b64encode(os.urandom(16)).decode()
+sock.sendall((
+    "GET /receiver-ws HTTP/1.1\r\n"
+    f"Host: localhost:{port}\r\n"
+    "Upgrade: websocket\r\nConnection: Upgrade\r\n"
+    f"Sec-WebSocket-Key: {key}\r\nSec-WebSocket-Version: 13\r\n"
+    f"Authorization: Bearer {token}\r\n\r\n").encode())
+
+buf = b""
+while b"\r\n\r\n" not in buf:
+    buf += sock.recv(4096)
+head, buf = buf.split(b"\r\n\r\n", 1)
+if b" 101 " not in head.split(b"\r\n")[0]:
+    sys.exit("handshake failed: " + head.split(b"\r\n")[0].decode())
+
+if mode == "stall":
+    time.sleep(8)
+    sys.exit(0)
+
+sock.settimeout(3)
+def read(n):
+    global buf
+    while len(buf) < n:
+        chunk = sock.recv(1 << 20)
+        if not chunk:
+            raise EOFError
+        buf += chunk
+    data, buf = buf[:n], buf[n:]
+    return data
+
+try:
+    while True:
+        first, second = read(2)
+        length = second & 0x7F
+        if length == 126:
+            length = struct.unpack(">H", read(2))[0]
+        elif length == 127:
+            length = struct.unpack(">Q", read(8))[0]
+        payload = read(length)
+        if first & 0x0F == 1:
+            print(json.loads(payload)["payload"]["request_id"])
+except (socket.timeout, EOFError):
+    pass
+PY
+}
+
+echo -e "\n🔍 Connecting a receiver that doesn't read..."
+receive stall || fail "Stalled receiver could not connect"
+grep -q "Failed to write to the receiver of user ${USER_ID} (attempt 1 of 2, 1 consecutive failures)" "${WORK_DIR}/api.log" ||
+    fail "First failed write was not logged"
+grep -q "Dropping the receiver connection of user ${USER_ID} after 1 consecutive" "${WORK_DIR}/api.log" &&
+    fail "Connection was dropped after a single failed write"
+grep -q "(attempt 2 of 2, 2 consecutive failures)" "${WORK_DIR}/api.log" || fail "Failed write was not retried"
+grep -q "Dropping the receiver connection of user ${USER_ID} after 2 consecutive failed writes" "${WORK_DIR}/api.log" ||
+    fail "Connection was not dropped after NOTIFY_MAX_WRITE_FAILURES failed writes"
+echo "✅ Connection dropped after the second consecutive failed write"
+
+python3 - "${DATABASE_PATH}" <<'PY' || fail "Notifications that weren't written were not kept queued"
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1])
+undelivered = db.execute("SELECT COUNT(*) FROM pending_notifications WHERE delivered_at IS NULL").fetchone()[0]
+assert undelivered >= 2, undelivered
+PY
+echo "✅ Notifications that weren't written stay queued"
+
+echo -e "\n🔍 Connecting a receiver that reads..."
+RESULT=$(receive read | tr '\n' ' ')
+[ -n "${RESULT}" ] || fail "Reading receiver got nothing"
+echo "${RESULT}" | grep -q "big-2" || fail "Reading receiver did not get the last queued notification: ${RESULT}"
+echo "✅ Reading receiver got the queued notifications: ${RESULT}"
+
+echo -e "\n🎉 Notification write retry test passed!"
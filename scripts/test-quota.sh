@@ -0,0 +1,135 @@
+#!/bin/bash
+
+# Checks that data requests past a user's daily quota are refused with 429,
+# that the remaining quota is reported in response headers and by
+# GET /api/data/quota, that requests refused for lack of collectors don't
+# count, that admins are exempt and that the receiver gives up at once
+# instead of retrying.
+#
+# Usage: scripts/test-quota.sh
+#   E2E_PORT  Port for the API server (default: 18099)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18099}"
+
+echo "Daily Request Quota Test"
+echo "========================"
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: collections fail, the test only counts requests
+mkdir -p "${WORK_DIR}/bin"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+echo "fake docker: no collection in this test" >&2
+exit 1
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/quota.db"
+export JWT_SECRET="quota-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+export DAILY_REQUEST_QUOTA_RECEIVER=2
+
+"${BIN}" admin create-user --email admin@example.com --password password123 --admin \
+    > "${WORK_DIR}/create-user.log" 2>&1 || fail "admin create-user failed: $(cat "${WORK_DIR}/create-user.log")"
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+# The receiver logs in as this user too
+curl -s -o /dev/null -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "receiver@example.com", "password": "password123", "client_type": 2}'
+
+# login <email> prints a token
+login() {
+    curl -s -X POST "${API_URL}/api/auth/login" -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\"}" |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])'
+}
+
+TOKEN=$(login receiver@example.com) || fail "Failed to log in as the receiver user"
+ADMIN_TOKEN=$(login admin@example.com) || fail "Failed to log in as the admin"
+
+# request <token> sends a data request and prints the HTTP status, the
+# X-Quota-Remaining header and the body, one per line
+request() {
+    curl -s -D "${WORK_DIR}/headers" -o "${WORK_DIR}/body" -w "%{http_code}\n" -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer $1" -H "Content-Type: application/json" \
+        -d '{"request_type": "data_collection", "parameters": "{}"}'
+    grep -i "^X-Quota-Remaining:" "${WORK_DIR}/headers" | tr -d '\r' | cut -d' ' -f2
+    echo
+    cat "${WORK_DIR}/body"
+}
+
+# quota <token> <expression> evaluates a Python expression on GET /api/data/quota
+quota() {
+    curl -s "${API_URL}/api/data/quota" -H "Authorization: Bearer $1" |
+        python3 -c "import json, sys; q = json.load(sys.stdin); print($2)"
+}
+
+[ "$(quota "${TOKEN}" '(q["limit"], q["used"], q["remaining"], q["unlimited"])')" = "(2, 0, 2, False)" ] ||
+    fail "Unexpected quota before any request: $(quota "${TOKEN}" 'q')"
+RESET=$(quota "${TOKEN}" 'q["reset_at"]')
+[ "${RESET}" = "$(date -u -d tomorrow +%Y-%m-%dT00:00:00Z)" ] || fail "Quota does not reset at midnight UTC: ${RESET}"
+echo "✅ Quota reported before any request"
+
+echo -e "\n🔍 Requesting without collectors..."
+[ "$(request "${TOKEN}" | head -n 1)" = "503" ] || fail "Request without collectors was not refused with 503"
+[ "$(quota "${TOKEN}" 'q["used"]')" = "0" ] || fail "A request no collector could serve counted against the quota"
+echo "✅ Refused requests don't count"
+
+echo -e "\n🔍 Starting a collector..."
+mkdir -p "${WORK_DIR}/data"
+PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+    --station-id quota-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+echo -e "\n🔍 Using up the quota..."
+RESULT=$(request "${TOKEN}")
+[ "$(echo "${RESULT}" | sed -n 1,2p | tr '\n' ' ')" = "202 1 " ] || fail "First request: ${RESULT}"
+RESULT=$(request "${TOKEN}")
+[ "$(echo "${RESULT}" | sed -n 1,2p | tr '\n' ' ')" = "202 0 " ] || fail "Second request: ${RESULT}"
+RESULT=$(request "${TOKEN}")
+[ "$(echo "${RESULT}" | sed -n 1,2p | tr '\n' ' ')" = "429 0 " ] || fail "Request past the quota: ${RESULT}"
+echo "${RESULT}" | tail -n 1 | python3 -c 'import json, sys; r = json.load(sys.stdin); assert (r["limit"], r["used"]) == (2, 2), r' ||
+    fail "429 response does not describe the quota: ${RESULT}"
+RETRY_AFTER=$(grep -i "^Retry-After:" "${WORK_DIR}/headers" | tr -d '\r' | cut -d' ' -f2)
+[ -n "${RETRY_AFTER}" ] && [ "${RETRY_AFTER}" -gt 0 ] && [ "${RETRY_AFTER}" -le 86400 ] ||
+    fail "429 response has no Retry-After until the reset: ${RETRY_AFTER}"
+[ "$(quota "${TOKEN}" '(q["used"], q["remaining"])')" = "(2, 0)" ] || fail "Quota not used up: $(quota "${TOKEN}" 'q')"
+echo "✅ Third request refused with 429"
+
+echo -e "\n🔍 Running a receiver with the quota used up..."
+START=$(date +%s)
+timeout 60s "${BIN}" receiver \
+    --receiver-id quota-receiver \
+    --api-server-url "${API_URL}" \
+    --download-dir "${WORK_DIR}/downloads" > "${WORK_DIR}/receiver.log" 2>&1
+[ $? -ne 0 ] || fail "Receiver succeeded past its quota"
+[ $(($(date +%s) - START)) -lt 30 ] || fail "Receiver retried instead of giving up"
+grep -q "Daily request quota of 2 exceeded" "${WORK_DIR}/receiver.log" || fail "Receiver error does not mention the quota"
+grep -q "retrying" "${WORK_DIR}/receiver.log" && fail "Receiver retried a request refused for its quota"
+echo "✅ Receiver gave up at once"
+
+echo -e "\n🔍 Requesting as an admin..."
+for i in 1 2 3; do
+    RESULT=$(request "${ADMIN_TOKEN}")
+    [ "$(echo "${RESULT}" | sed -n 1,2p | tr '\n' ' ')" = "202  " ] || fail "Admin request ${i}: ${RESULT}"
+done
+[ "$(quota "${ADMIN_TOKEN}" '(q["unlimited"], q["used"], q["remaining"])')" = "(True, 3, None)" ] ||
+    fail "Unexpected admin quota: $(quota "${ADMIN_TOKEN}" 'q')"
+echo "✅ Admins are exempt"
+
+echo -e "\n🎉 Daily request quota test passed!"
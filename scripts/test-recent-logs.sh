@@ -0,0 +1,95 @@
+#!/bin/bash
+
+# Checks GET /api/admin/logs/recent: it returns 404 unless LOG_RECENT_ENABLED
+# is set, and otherwise the latest LOG_RECENT_LINES log lines, oldest first,
+# dropping older ones once the buffer is full.
+#
+# Usage: scripts/test-recent-logs.sh
+#   E2E_PORT  Port for the API server (default: 18096)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18096}"
+RECENT_LINES=20
+
+echo "Recent Logs Test"
+echo "================"
+
+source "$(dirname "$0")/lib.sh"
+
+# login EMAIL prints the token
+login() {
+    curl -s -X POST "${API_URL}/api/auth/login" \
+        -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\"}" |
+        sed -n 's/.*"token":"\([^"]*\)".*/\1/p'
+}
+
+# recent TOKEN [QUERY] saves the response in recent.json and prints the HTTP status code
+recent() {
+    curl -s -o "${WORK_DIR}/recent.json" -w "%{http_code}" "${API_URL}/api/admin/logs/recent${2:-}" \
+        -H "Authorization: Bearer $1"
+}
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/recent.db"
+export JWT_SECRET="recent-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+"${BIN}" admin create-user --email admin@example.com --password password123 --admin \
+    > "${WORK_DIR}/create-user.log" 2>&1 || fail "admin create-user failed: $(cat "${WORK_DIR}/create-user.log")"
+"${BIN}" admin create-user --email user@example.com --password password123 --client-type 2 \
+    > "${WORK_DIR}/create-user.log" 2>&1 || fail "admin create-user failed: $(cat "${WORK_DIR}/create-user.log")"
+echo "✅ Admin and user created"
+
+echo -e "\n🔍 Starting API server without LOG_RECENT_ENABLED..."
+start_api
+ADMIN_TOKEN=$(login admin@example.com)
+[ -n "${ADMIN_TOKEN}" ] || fail "Admin login failed"
+status=$(recent "${ADMIN_TOKEN}")
+[ "${status}" = "404" ] || fail "Recent logs returned ${status} while disabled, expected 404"
+echo "✅ Recent logs unavailable by default"
+
+echo -e "\n🔍 Starting API server with LOG_RECENT_LINES=${RECENT_LINES}..."
+stop_api
+LOG_RECENT_ENABLED=true LOG_RECENT_LINES="${RECENT_LINES}" start_api
+ADMIN_TOKEN=$(login admin@example.com)
+USER_TOKEN=$(login user@example.com)
+[ -n "${ADMIN_TOKEN}" ] || fail "Admin login failed"
+[ -n "${USER_TOKEN}" ] || fail "User login failed"
+
+# Write more lines than the buffer holds, each naming its own path
+for i in $(seq 1 $(( RECENT_LINES * 2 ))); do
+    curl -s -o /dev/null "${API_URL}/health?n=${i}"
+done
+
+status=$(recent "${ADMIN_TOKEN}")
+[ "${status}" = "200" ] || fail "Recent logs returned ${status}, expected 200"
+python3 - "${WORK_DIR}/recent.json" "${RECENT_LINES}" <<'PY' || fail "Recent logs are wrong: $(cat "${WORK_DIR}/recent.json")"
+import json, sys
+body, lines = json.load(open(sys.argv[1])), int(sys.argv[2])
+logs = body["logs"]
+assert body["capacity"] == lines and body["count"] == lines == len(logs), body
+assert all(log["level"] == "info" and log["caller"] and log["time"] for log in logs), logs
+# The last requests were /health?n=N+1 to /health?n=2N, in order
+expected = ["Request: GET /health?n=%d " % n for n in range(lines + 1, 2 * lines + 1)]
+assert [log["message"][:len(e)] for log, e in zip(logs, expected)] == expected, [log["message"] for log in logs]
+PY
+echo "✅ Last ${RECENT_LINES} lines returned, oldest first"
+
+status=$(recent "${ADMIN_TOKEN}" "?limit=5")
+[ "${status}" = "200" ] || fail "Recent logs with a limit returned ${status}, expected 200"
+python3 -c 'import json, sys; assert json.load(open(sys.argv[1]))["count"] == 5' "${WORK_DIR}/recent.json" ||
+    fail "limit=5 did not return 5 lines: $(cat "${WORK_DIR}/recent.json")"
+status=$(recent "${ADMIN_TOKEN}" "?limit=-1")
+[ "${status}" = "400" ] || fail "Negative limit returned ${status}, expected 400"
+echo "✅ limit returns only the latest lines"
+
+status=$(recent "${USER_TOKEN}")
+[ "${status}" = "403" ] || fail "Non-admin request returned ${status}, expected 403"
+echo "✅ Non-admin rejected with 403"
+
+echo -e "\n🎉 Recent logs test completed successfully!"
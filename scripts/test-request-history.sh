@@ -0,0 +1,191 @@
+#!/bin/bash
+
+# Checks that users can export their request history as JSON and CSV, with
+# collector responses and capture metadata, filtered by date and across
+# several pages, that admins can export every user's history, and that
+# REQUEST_RETENTION_DAYS deletes old requests with their responses and
+# cached files while keeping recent ones.
+#
+# The history is written straight into the database, so no collector runs.
+#
+# Usage: scripts/test-request-history.sh
+#   E2E_PORT  Port for the API server (default: 18121)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18121}"
+
+echo "Request History Test"
+echo "===================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/history.db"
+export JWT_SECRET="history-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export CACHE_DIR="${WORK_DIR}/cache"
+export BCRYPT_COST=4
+
+"${BIN}" admin create-user --email admin@example.com --password password123 --admin \
+    > "${WORK_DIR}/create-user.log" 2>&1 || fail "admin create-user failed: $(cat "${WORK_DIR}/create-user.log")"
+
+# register <email> registers a user and prints the token
+register() {
+    curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\", \"client_type\": 2}" |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])'
+}
+
+# token <email> logs in and prints the token
+token() {
+    curl -s -X POST "${API_URL}/api/auth/login" -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\"}" |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])'
+}
+
+# export_history <token> <path and query> <output file> downloads an export
+# and prints its status and content type
+export_history() {
+    curl -s -o "$3" -w "%{http_code} %{content_type}" "${API_URL}$2" -H "Authorization: Bearer $1"
+}
+
+# check_json <file> <python expression on u> <message>
+check_json() {
+    python3 -c "import json, sys; u = json.load(open(sys.argv[1])); sys.exit(0 if ($2) else 1)" "$1" ||
+        fail "$3: $(head -c 500 "$1")"
+}
+
+start_api api-export
+OWNER_TOKEN=$(register owner@example.com) || fail "Failed to register the owner"
+register other@example.com > /dev/null || fail "Failed to register the other user"
+ADMIN_TOKEN=$(token admin@example.com) || fail "Failed to log in as the admin"
+
+# The owner made 250 requests on 2025-03-01 answered by one station, one on
+# 2025-03-02 answered by two, one on 2025-03-03 nobody answered and one
+# yesterday with a cached file; the other user made one on 2025-03-02
+python3 - "${DATABASE_PATH}" <<'PY' || fail "Failed to seed the request history"
+import json, sqlite3, sys
+db = sqlite3.connect(sys.argv[1], timeout=10)
+users = dict(db.execute("SELECT email, id FROM users"))
+owner, other = users["owner@example.com"], users["other@example.com"]
+metadata = json.dumps({"version": 1, "station_id": "station-a", "note": "quoted \"value\", with a comma"})
+
+def request(id, user, created, completed=True, duration=None):
+    db.execute("""INSERT INTO data_requests (id, request_type, parameters, format, duration_seconds, requested_by,
+        status, created_at, completed_at) VALUES (?, 'iq', ?, 'npz', ?, ?, ?, ?, ?)""",
+        (id, json.dumps({"frequency": 100e6, "request_id": id}), duration, user,
+         "complete" if completed else "pending", created, created if completed else None))
+
+def response(request_id, station, status, error=None, cached=None):
+    db.execute("""INSERT INTO collector_responses (request_id, station_id, status, file_size, sha256, error_message,
+        capture_metadata, cached_path, created_at, completed_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, datetime('now'), datetime('now'))""",
+        (request_id, station, status, 1024 if status == "ready" else None, "ab" * 32 if status == "ready" else None,
+         error, metadata if status == "ready" else None, cached))
+
+for i in range(250):
+    request("bulk-%03d" % i, owner, "2025-03-01 %02d:%02d:00" % (i // 60, i % 60))
+    response("bulk-%03d" % i, "station-a", "ready", cached="bulk-%03d/station-a.npz" % i if i == 0 else None)
+request("pair", owner, "2025-03-02 12:00:00", duration=2.5)
+response("pair", "station-a", "ready")
+response("pair", "station-b", "failed", error="capture failed, device busy")
+request("other", other, "2025-03-02 13:00:00")
+response("other", "station-a", "ready")
+request("unanswered", owner, "2025-03-03 23:59:59", completed=False)
+db.execute("INSERT INTO data_requests (id, request_type, requested_by, status, created_at) VALUES ('recent', 'iq', ?, 'complete', datetime('now', '-1 day'))", (owner,))
+response("recent", "station-a", "ready", cached="recent/station-a.npz")
+db.execute("INSERT INTO request_subscribers (request_id, user_id) VALUES ('pair', ?)", (other,))
+db.execute("INSERT INTO pending_notifications (user_id, request_id, message, expires_at) VALUES (?, 'pair', '{}', datetime('now', '+1 day'))", (owner,))
+db.commit()
+PY
+for key in bulk-000 recent; do
+    mkdir -p "${CACHE_DIR}/${key}"
+    echo "cached" > "${CACHE_DIR}/${key}/station-a.npz"
+done
+
+echo -e "\n🔍 Exporting a user's history as JSON..."
+RESULT=$(export_history "${OWNER_TOKEN}" "/api/data/export" "${WORK_DIR}/owner.json")
+[ "${RESULT}" = "200 application/json; charset=utf-8" ] || fail "JSON export answered ${RESULT}"
+check_json "${WORK_DIR}/owner.json" "len(u) == 253 and [r['request_id'] for r in u[:2]] == ['bulk-000', 'bulk-001'] and [r['request_id'] for r in u[-3:]] == ['pair', 'unanswered', 'recent']" \
+    "The export doesn't list the owner's requests in order"
+check_json "${WORK_DIR}/owner.json" "all(r['email'] == 'owner@example.com' for r in u)" "The export includes other users' requests"
+check_json "${WORK_DIR}/owner.json" "u[250]['parameters']['frequency'] == 100e6 and u[250]['duration_seconds'] == 2.5 and u[250]['created_at'] == '2025-03-02T12:00:00Z'" \
+    "The request fields are wrong"
+check_json "${WORK_DIR}/owner.json" "[(s['station_id'], s['status'], s.get('error')) for s in u[250]['responses']] == [('station-a', 'ready', None), ('station-b', 'failed', 'capture failed, device busy')]" \
+    "The collector responses are wrong"
+check_json "${WORK_DIR}/owner.json" "u[250]['responses'][0]['capture_metadata']['station_id'] == 'station-a' and u[250]['responses'][0]['sha256'] == 'ab' * 32" \
+    "The capture metadata is missing"
+check_json "${WORK_DIR}/owner.json" "u[251]['responses'] == [] and 'completed_at' not in u[251]" "The unanswered request is wrong"
+echo "✅ All 253 requests are exported in order, across pages, with their responses"
+
+RESULT=$(export_history "${OWNER_TOKEN}" "/api/data/export?from=2025-03-02&to=2025-03-03" "${WORK_DIR}/range.json")
+[ "${RESULT%% *}" = "200" ] || fail "Export by date answered ${RESULT}"
+check_json "${WORK_DIR}/range.json" "[r['request_id'] for r in u] == ['pair', 'unanswered']" "The date range is not applied"
+export_history "${OWNER_TOKEN}" "/api/data/export?to=2025-02-28" "${WORK_DIR}/empty.json" > /dev/null
+[ "$(cat "${WORK_DIR}/empty.json")" = "[]" ] || fail "An empty export is not an empty array: $(cat "${WORK_DIR}/empty.json")"
+echo "✅ Exports are filtered by date, and an empty one is []"
+
+echo -e "\n🔍 Exporting a user's history as CSV..."
+RESULT=$(export_history "${OWNER_TOKEN}" "/api/data/export?format=csv" "${WORK_DIR}/owner.csv")
+[ "${RESULT}" = "200 text/csv; charset=utf-8" ] || fail "CSV export answered ${RESULT}"
+python3 - "${WORK_DIR}/owner.csv" <<'PY' || fail "The CSV export is wrong: $(head -n 3 "${WORK_DIR}/owner.csv")"
+import csv, json, sys
+rows = list(csv.DictReader(open(sys.argv[1], newline="")))
+assert len(rows) == 254, len(rows)
+pair = [r for r in rows if r["request_id"] == "pair"]
+assert [(r["station_id"], r["station_status"], r["error"]) for r in pair] == [
+    ("station-a", "ready", ""), ("station-b", "failed", "capture failed, device busy")], pair
+assert json.loads(pair[0]["capture_metadata"])["note"] == 'quoted "value", with a comma'
+assert json.loads(pair[0]["parameters"])["request_id"] == "pair" and pair[0]["duration_seconds"] == "2.5"
+unanswered = [r for r in rows if r["request_id"] == "unanswered"]
+assert len(unanswered) == 1 and unanswered[0]["station_id"] == "" and unanswered[0]["completed_at"] == ""
+PY
+echo "✅ The CSV export has a row per collector response and keeps JSON columns intact"
+
+echo -e "\n🔍 Exporting every user's history as an admin..."
+RESULT=$(export_history "${ADMIN_TOKEN}" "/api/admin/export?from=2025-03-02&to=2025-03-02" "${WORK_DIR}/admin.json")
+[ "${RESULT%% *}" = "200" ] || fail "Admin export answered ${RESULT}"
+check_json "${WORK_DIR}/admin.json" "[(r['request_id'], r['email']) for r in u] == [('pair', 'owner@example.com'), ('other', 'other@example.com')]" \
+    "The admin export is wrong"
+OTHER_ID=$(python3 -c 'import json, sys; print(json.load(open(sys.argv[1]))[1]["user_id"])' "${WORK_DIR}/admin.json")
+export_history "${ADMIN_TOKEN}" "/api/admin/export?user_id=${OTHER_ID}" "${WORK_DIR}/admin-other.json" > /dev/null
+check_json "${WORK_DIR}/admin-other.json" "[r['request_id'] for r in u] == ['other']" "The admin export for one user is wrong"
+for query in "format=xml" "from=yesterday" "to=2025-13-01" "from=2025-03-02&to=2025-03-01"; do
+    RESULT=$(export_history "${OWNER_TOKEN}" "/api/data/export?${query}" /dev/null)
+    [ "${RESULT%% *}" = "400" ] || fail "${query} answered ${RESULT}"
+done
+RESULT=$(export_history "${ADMIN_TOKEN}" "/api/admin/export?user_id=x" /dev/null)
+[ "${RESULT%% *}" = "400" ] || fail "An invalid user_id answered ${RESULT}"
+RESULT=$(export_history "${OWNER_TOKEN}" "/api/admin/export" /dev/null)
+[ "${RESULT%% *}" = "403" ] || fail "A non-admin got the admin export: ${RESULT}"
+echo "✅ Admins export every user's history, invalid queries get 400 and other users 403"
+stop_api
+
+echo -e "\n🔍 Purging requests past REQUEST_RETENTION_DAYS..."
+REQUEST_RETENTION_DAYS=-1 timeout 10s "${BIN}" api > "${WORK_DIR}/api-negative.log" 2>&1 &&
+    fail "The API server started with a negative REQUEST_RETENTION_DAYS"
+grep -q "REQUEST_RETENTION_DAYS" "${WORK_DIR}/api-negative.log" || fail "A negative REQUEST_RETENTION_DAYS was not reported"
+REQUEST_RETENTION_DAYS=30 start_api api-retention
+for i in $(seq 1 20); do
+    grep -q "Purged 253 requests older than 30 days and 1 cached files" "${WORK_DIR}/api-retention.log" && break
+    sleep 0.5
+done
+grep -q "Purged 253 requests older than 30 days and 1 cached files" "${WORK_DIR}/api-retention.log" ||
+    fail "Old requests were not purged"
+python3 - "${DATABASE_PATH}" <<'PY' || fail "Purged requests left rows behind"
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1], timeout=10)
+counts = [db.execute("SELECT COUNT(*) FROM " + table).fetchone()[0]
+          for table in ("data_requests", "collector_responses", "request_subscribers", "pending_notifications")]
+assert counts == [1, 1, 0, 0], counts
+PY
+[ ! -e "${CACHE_DIR}/bulk-000" ] || fail "The cached file of a purged request was kept"
+[ -f "${CACHE_DIR}/recent/station-a.npz" ] || fail "The cached file of a recent request was removed"
+export_history "${OWNER_TOKEN}" "/api/data/export" "${WORK_DIR}/after.json" > /dev/null
+check_json "${WORK_DIR}/after.json" "[r['request_id'] for r in u] == ['recent']" "The export after purging is wrong"
+echo "✅ Requests older than 30 days are deleted with their responses, subscribers, notifications and cached files"
+
+echo -e "\n🎉 Request history test passed!"
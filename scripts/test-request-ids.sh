@@ -0,0 +1,112 @@
+#!/bin/bash
+
+# Checks that the server generates every request's ID: IDs a client sends,
+# whether a path, a duplicate or a valid UUID, are ignored, even when sent
+# concurrently, and the ID in the response is the one the request is stored
+# and tracked under, together with the requester's subscription.
+#
+# Docker is replaced by a shim; collections fail, which doesn't matter here,
+# so the collector's circuit breaker is turned off to keep it available.
+#
+# Usage: scripts/test-request-ids.sh
+#   E2E_PORT  Port for the API server (default: 18115)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18115}"
+
+echo "Request ID Test"
+echo "==============="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data"
+printf '#!/bin/bash\nexit 1\n' > "${WORK_DIR}/bin/docker"
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/ids.db"
+export JWT_SECRET="ids-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL} and a collector..."
+start_api
+
+PATH="${WORK_DIR}/bin:${PATH}" COLLECTOR_BREAKER_THRESHOLD=0 "${BIN}" collector \
+    --station-id ids-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ API server and collector running"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "ids@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+
+# request <id> makes a request sending the ID and prints the ID it got
+request() {
+    local response
+    response=$(curl -s -w "\n%{http_code}" -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d "{\"id\": \"$1\", \"request_type\": \"data_collection\", \"parameters\": \"{}\"}")
+    [ "$(echo "${response}" | tail -n 1)" = "202" ] || fail "Request with ID $1 was not accepted: ${response}"
+    echo "${response}" | head -n 1 | python3 -c 'import json, sys; print(json.load(sys.stdin)["request_id"])'
+}
+
+is_uuid() {
+    python3 -c 'import sys, uuid; sys.exit(0 if str(uuid.UUID(sys.argv[1])) == sys.argv[1] else 1)' "$1" 2>/dev/null
+}
+
+echo -e "\n🔍 Sending requests with their own IDs..."
+IDS=()
+for id in "../../etc/passwd" "dup" "dup" "1' OR '1'='1" "7fd593ce-0000-4000-8000-000000000000"; do
+    ID=$(request "${id}") || exit 1
+    is_uuid "${ID}" || fail "Request sent with ID ${id} got ${ID}, not a UUID"
+    [ "${ID}" != "${id}" ] || fail "The server kept the client's ID ${id}"
+    IDS+=("${ID}")
+done
+[ "$(printf '%s\n' "${IDS[@]}" | sort -u | wc -l)" = "${#IDS[@]}" ] || fail "Request IDs are not unique: ${IDS[*]}"
+echo "✅ Every request got a new UUID, duplicates included"
+
+echo -e "\n🔍 Sending five requests with the same ID at once..."
+CONCURRENT=()
+for i in $(seq 1 5); do
+    request "concurrent" > "${WORK_DIR}/concurrent-${i}" &
+    CONCURRENT+=($!)
+done
+for pid in "${CONCURRENT[@]}"; do
+    wait "${pid}" || fail "A concurrent request failed"
+done
+for i in $(seq 1 5); do
+    ID=$(cat "${WORK_DIR}/concurrent-${i}")
+    is_uuid "${ID}" || fail "Concurrent request ${i} got ${ID}, not a UUID"
+    IDS+=("${ID}")
+done
+[ "$(printf '%s\n' "${IDS[@]}" | sort -u | wc -l)" = "${#IDS[@]}" ] || fail "Request IDs are not unique: ${IDS[*]}"
+echo "✅ Concurrent requests with the same ID were all accepted under their own IDs"
+
+echo -e "\n🔍 Checking the requests are stored under the returned IDs..."
+curl -s "${API_URL}/api/data/requests" -H "Authorization: Bearer ${TOKEN}" |
+    python3 -c 'import json, sys; ids = sorted({r["request_id"] for r in json.load(sys.stdin)["requests"]}); sys.exit(0 if ids == sorted(sys.argv[1:]) else 1)' "${IDS[@]}" ||
+    fail "Stored requests don't match the returned IDs"
+for ID in "${IDS[@]}"; do
+    [ "$(curl -s -o /dev/null -w "%{http_code}" "${API_URL}/api/data/status/${ID}" -H "Authorization: Bearer ${TOKEN}")" = "200" ] ||
+        fail "Status of request ${ID} is not available"
+done
+grep -q "ids-station" "${WORK_DIR}/api.log" || fail "Requests were not forwarded to the collector"
+echo "✅ Requests are listed and tracked under the returned IDs"
+
+python3 - "${DATABASE_PATH}" <<'PY' || fail "Requests and their requesters' subscriptions don't match"
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1])
+requests = set(db.execute("SELECT id, requested_by FROM data_requests"))
+subscriptions = set(db.execute("SELECT request_id, user_id FROM request_subscribers"))
+sys.exit(0 if requests == subscriptions else 1)
+PY
+echo "✅ Every request was stored with its requester's subscription"
+
+echo -e "\n🎉 Request ID test passed!"
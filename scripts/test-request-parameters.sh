@@ -0,0 +1,88 @@
+#!/bin/bash
+
+# Checks that request parameters longer than REQUEST_MAX_PARAMETERS_BYTES
+# and parameters that aren't a JSON object are rejected with 422 before the
+# request is stored, and that the limit must be positive.
+#
+# No collector is started: valid requests get past validation and are
+# refused with 503 for want of a station.
+#
+# Usage: scripts/test-request-parameters.sh
+#   E2E_PORT  Port for the API server (default: 18114)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18114}"
+MAX_BYTES=64
+
+echo "Request Parameters Test"
+echo "======================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/parameters.db"
+export JWT_SECRET="parameters-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Checking limit validation..."
+REQUEST_MAX_PARAMETERS_BYTES=0 timeout 10 "${BIN}" api > "${WORK_DIR}/invalid.log" 2>&1 &&
+    fail "API server started with REQUEST_MAX_PARAMETERS_BYTES=0"
+grep -q "REQUEST_MAX_PARAMETERS_BYTES must be positive" "${WORK_DIR}/invalid.log" || fail "Invalid limit was not reported"
+rm -f "${WORK_DIR}/invalid.log"
+echo "✅ A limit of 0 is refused"
+
+echo -e "\n🔍 Starting API server on ${API_URL} with a ${MAX_BYTES} byte limit..."
+REQUEST_MAX_PARAMETERS_BYTES=${MAX_BYTES} start_api
+echo "✅ API server healthy"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "parameters@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+
+# request <endpoint> <parameters> sends a request with the parameters and
+# prints the HTTP status and the body
+request() {
+    local body
+    body=$(python3 -c 'import json, sys; print(json.dumps({"request_type": "data_collection", "parameters": sys.argv[1]}))' "$2")
+    curl -s -o "${WORK_DIR}/body" -w "%{http_code}\n" -X POST "${API_URL}$1" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" -d "${body}"
+    cat "${WORK_DIR}/body"
+}
+
+# Exactly at and one byte over the limit
+AT_LIMIT=$(python3 -c "import json; print(json.dumps({'note': 'x' * (${MAX_BYTES} - 12)}))")
+OVER_LIMIT=$(python3 -c "import json; print(json.dumps({'note': 'x' * (${MAX_BYTES} - 11)}))")
+[ ${#AT_LIMIT} -eq ${MAX_BYTES} ] || fail "Test parameters are ${#AT_LIMIT} bytes, not ${MAX_BYTES}"
+
+echo -e "\n🔍 Sending oversized and malformed parameters..."
+for endpoint in /api/data/request /api/data/request/plan; do
+    RESULT=$(request "${endpoint}" "${OVER_LIMIT}")
+    [ "$(echo "${RESULT}" | head -n 1)" = "422" ] || fail "Oversized parameters to ${endpoint} were not rejected: ${RESULT}"
+    echo "${RESULT}" | grep -q "parameters are $((MAX_BYTES + 1)) bytes long, at most ${MAX_BYTES} are allowed" ||
+        fail "Rejection does not give the limit: ${RESULT}"
+
+    for parameters in '{"gain": 20' 'gain=20' '[20]' '"gain"'; do
+        RESULT=$(request "${endpoint}" "${parameters}")
+        [ "$(echo "${RESULT}" | head -n 1)" = "422" ] || fail "Parameters ${parameters} to ${endpoint} were not rejected: ${RESULT}"
+        echo "${RESULT}" | grep -q "parameters must be a JSON object" || fail "Rejection does not say why: ${RESULT}"
+    done
+done
+echo "✅ Oversized parameters and parameters that aren't a JSON object get 422"
+
+check_count=$(curl -s "${API_URL}/api/data/requests" -H "Authorization: Bearer ${TOKEN}" |
+    python3 -c 'import json, sys; print(len(json.load(sys.stdin)["requests"] or []))')
+[ "${check_count}" = "0" ] || fail "Rejected requests were stored: ${check_count}"
+echo "✅ Rejected requests were not stored"
+
+echo -e "\n🔍 Sending valid parameters..."
+for parameters in "${AT_LIMIT}" '{}' ''; do
+    RESULT=$(request /api/data/request "${parameters}")
+    [ "$(echo "${RESULT}" | head -n 1)" = "503" ] || fail "Parameters '${parameters}' did not pass validation: ${RESULT}"
+done
+echo "✅ Parameters at the limit, empty objects and no parameters pass"
+
+echo -e "\n🎉 Request parameters test passed!"
@@ -0,0 +1,121 @@
+#!/bin/bash
+
+# Checks that POST /api/data/request/plan reports the stations a request
+# would go to, with their scores, the stations that aren't available and why,
+# and whether a region was relaxed, without making a request.
+#
+# Docker is replaced by a shim; no collection is ever run.
+#
+# Usage: scripts/test-request-plan.sh
+#   E2E_PORT  Port for the API server (default: 18111)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18111}"
+
+echo "Request Plan Test"
+echo "================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+mkdir -p "${WORK_DIR}/bin"
+printf '#!/bin/bash\nexit 0\n' > "${WORK_DIR}/bin/docker"
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/plan.db"
+export JWT_SECRET="plan-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+# start_collector <station> <latitude> <longitude>
+start_collector() {
+    mkdir -p "${WORK_DIR}/data-$1"
+    COLLECTOR_LATITUDE="$2" COLLECTOR_LONGITUDE="$3" PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+        --station-id "$1" \
+        --api-server-url "${API_URL}" \
+        --data-dir "${WORK_DIR}/data-$1" > "${WORK_DIR}/$1.log" 2>&1 &
+    PIDS+=($!)
+
+    wait_collector "${WORK_DIR}/$1.log" "Collector $1 did not connect to the API server"
+}
+
+echo -e "\n🔍 Starting four collectors, one of them draining..."
+start_collector st-a 47.0 8.0
+start_collector st-b 47.05 8.1
+start_collector st-drain 47.02 8.05
+DRAIN_PID=${PIDS[-1]}
+start_collector st-far 48.0 10.0
+kill -USR1 "${DRAIN_PID}"
+echo "✅ Collectors connected"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "plan@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+
+REGION='"region": {"bbox": {"south": 46.9, "west": 7.9, "north": 47.2, "east": 8.3}}'
+
+# plan <extra fields> prints the plan for a request with them
+plan() {
+    curl -s -X POST "${API_URL}/api/data/request/plan" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d "{\"request_type\": \"data_collection\", \"parameters\": \"{}\"${1:+, $1}}"
+}
+
+# check <plan> <python expression on p> <message>
+check() {
+    echo "$1" | python3 -c "import json, sys; p = json.load(sys.stdin); sys.exit(0 if ($2) else 1)" ||
+        fail "$3: $1"
+}
+
+for i in $(seq 1 20); do
+    plan | grep -q '"station_id":"st-drain","reason":"draining"' && break
+    sleep 0.5
+done
+
+echo -e "\n🔍 Planning a request without a region..."
+PLAN=$(plan)
+check "${PLAN}" 'p["ok"] and p["strategy"] == "weighted" and len(p["chosen"]) == 3' "Three stations should be chosen"
+check "${PLAN}" '"st-drain" not in p["chosen"] and p["unavailable"] == [{"station_id": "st-drain", "reason": "draining"}]' \
+    "The draining station should be listed as unavailable"
+check "${PLAN}" 'all(s["chosen"] and s["score"] == 1 and s["ratings"] == {"load": 1} for s in p["stations"])' \
+    "Idle stations should score 1 by load"
+check "${PLAN}" 'p["geometry"]["usable"] in (True, False) and len(p["geometry"]["stations"]) == 3' "The chosen stations should be rated"
+echo "✅ The plan lists the chosen stations, their scores and the draining station"
+
+echo -e "\n🔍 Planning requests with a region..."
+PLAN=$(plan "${REGION}")
+check "${PLAN}" 'p["ok"] and sorted(p["chosen"]) == ["st-a", "st-b"] and p["outside_region"] == ["st-far"]' \
+    "Only the stations in the region should be chosen"
+check "${PLAN}" 'not p["region_relaxed"] and all(s["in_region"] for s in p["stations"])' "The region should not be relaxed"
+
+PLAN=$(plan "${REGION}, \"region_fallback\": true")
+check "${PLAN}" 'p["ok"] and p["region_relaxed"] and p["chosen"][-1] == "st-far"' "The region should be relaxed to add st-far"
+check "${PLAN}" '[s["in_region"] for s in p["stations"]] == [True, True, False]' "st-far should be marked outside the region"
+
+PLAN=$(plan "${REGION}, \"min_stations\": 3")
+check "${PLAN}" 'not p["ok"] and p["chosen"] == [] and p["error"] == "Fewer than min_stations (3) collectors available"' \
+    "A plan short of min_stations should say the request would be refused"
+echo "✅ Region plans report stations outside the region, the relaxation and min_stations"
+
+echo -e "\n🔍 Checking that planning makes no request..."
+check "$(curl -s "${API_URL}/api/data/requests" -H "Authorization: Bearer ${TOKEN}")" 'not p["requests"]' \
+    "Planning created a request"
+curl -s "${API_URL}/api/data/quota" -H "Authorization: Bearer ${TOKEN}" | grep -q '"used":0' ||
+    fail "Planning counted towards the quota"
+STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST "${API_URL}/api/data/request/plan" \
+    -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+    -d '{"request_type": "data_collection", "parameters": "{}", "selection_strategy": "fastest"}')
+[ "${STATUS}" = "400" ] || fail "Unknown strategy returned ${STATUS}"
+STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST "${API_URL}/api/data/request/plan" \
+    -H "Content-Type: application/json" -d '{"request_type": "data_collection"}')
+[ "${STATUS}" = "401" ] || fail "Unauthenticated plan returned ${STATUS}"
+echo "✅ No request was made, invalid requests get 400 and anonymous users 401"
+
+echo -e "\n🎉 Request plan test passed!"
@@ -0,0 +1,124 @@
+#!/bin/bash
+
+# Checks that a request's selection_strategy decides which stations it goes
+# to: least_loaded and the default ignore a station whose collections fail,
+# best_performance ranks it last and spread picks a distant station over
+# ones next to each other. Unknown strategies are rejected.
+#
+# Docker is replaced by a shim that fails for one station.
+#
+# Usage: scripts/test-selection-strategy.sh
+#   E2E_PORT  Port for the API server (default: 18110)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18110}"
+
+echo "Selection Strategy Test"
+echo "======================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: fail for st-bad, otherwise write an NPZ file into the bind mount
+mkdir -p "${WORK_DIR}/bin"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+[[ " $* " == *" st-bad "* ]] && exit 1
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/strategy_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/strategy.db"
+export JWT_SECRET="strategy-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+LOG_LEVEL=debug start_api
+echo "✅ API server healthy"
+
+# start_collector <station> <latitude> <longitude>
+start_collector() {
+    mkdir -p "${WORK_DIR}/data-$1"
+    COLLECTOR_LATITUDE="$2" COLLECTOR_LONGITUDE="$3" PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+        --station-id "$1" \
+        --api-server-url "${API_URL}" \
+        --data-dir "${WORK_DIR}/data-$1" > "${WORK_DIR}/$1.log" 2>&1 &
+    PIDS+=($!)
+
+    wait_collector "${WORK_DIR}/$1.log" "Collector $1 did not connect to the API server"
+}
+
+# Stations are listed in the order they connect: three close together, the
+# first of which fails, then one far away
+echo -e "\n🔍 Starting four collectors..."
+start_collector st-bad 47.0 8.0
+start_collector st-a 47.0 8.01
+start_collector st-b 47.01 8.0
+start_collector st-far 47.5 8.5
+echo "✅ Collectors connected"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "strategy@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+
+# request [<strategy>] prints the stations a new request went to, sorted,
+# once it is complete
+request() {
+    local id
+    id=$(curl -s -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d "{\"request_type\": \"data_collection\", \"parameters\": \"{}\", \"selection_strategy\": \"${1:-}\"}" |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["request_id"])') || return 1
+    for i in $(seq 1 60); do
+        curl -s "${API_URL}/api/data/status/${id}" -H "Authorization: Bearer ${TOKEN}" | grep -q '"complete":true' && break
+        sleep 0.5
+    done
+    curl -s "${API_URL}/api/data/status/${id}" -H "Authorization: Bearer ${TOKEN}" |
+        python3 -c 'import json, sys; print(",".join(sorted(c["station_id"] for c in json.load(sys.stdin)["collectors"])))'
+}
+
+echo -e "\n🔍 Requesting with each strategy..."
+RESULT=$(request)
+[ "${RESULT}" = "st-a,st-b,st-bad" ] || fail "Default request went to: ${RESULT}"
+echo "✅ The default strategy picks the first three idle stations"
+
+RESULT=$(request least_loaded)
+[ "${RESULT}" = "st-a,st-b,st-bad" ] || fail "least_loaded request went to: ${RESULT}"
+echo "✅ least_loaded ignores that st-bad failed"
+
+RESULT=$(request best_performance)
+[ "${RESULT}" = "st-a,st-b,st-far" ] || fail "best_performance request went to: ${RESULT}"
+echo "✅ best_performance ranks the failing station last"
+
+RESULT=$(request spread)
+[[ ",${RESULT}," == *",st-far,"* ]] || fail "spread request left out the distant station: ${RESULT}"
+grep -q "Stations spread out: \[st-bad st-far " "${WORK_DIR}/api.log" || fail "Spread order was not logged"
+echo "✅ spread includes the distant station (${RESULT})"
+
+echo -e "\n🔍 Checking strategy validation..."
+STATUS=$(curl -s -o "${WORK_DIR}/body" -w "%{http_code}" -X POST "${API_URL}/api/data/request" \
+    -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+    -d '{"request_type": "data_collection", "parameters": "{}", "selection_strategy": "fastest"}')
+[ "${STATUS}" = "400" ] || fail "Unknown strategy returned ${STATUS}"
+grep -q '"selection_strategies":\["weighted","least_loaded","best_performance","spread"\]' "${WORK_DIR}/body" ||
+    fail "Known strategies not listed: $(cat "${WORK_DIR}/body")"
+STATUS=$(curl -s -o /dev/null -w "%{http_code}" "${API_URL}/api/stations/geometry?selection_strategy=fastest" -H "Authorization: Bearer ${TOKEN}")
+[ "${STATUS}" = "400" ] || fail "Geometry with an unknown strategy returned ${STATUS}"
+curl -s "${API_URL}/api/stations/geometry?selection_strategy=spread" -H "Authorization: Bearer ${TOKEN}" | grep -q '"station_id":"st-far"' ||
+    fail "Geometry with the spread strategy left out the distant station"
+echo "✅ Unknown strategies are rejected and the geometry endpoint follows the strategy"
+
+echo -e "\n🎉 Selection strategy test passed!"
@@ -0,0 +1,140 @@
+#!/bin/bash
+
+# Checks the SELECTION_WEIGHT_* settings: that the server refuses to start
+# without a positive weight, that GET /api/admin/selection/config reports the
+# weights, and that with SELECTION_WEIGHT_SUCCESS a station whose collections
+# fail is ranked behind the others while it isn't by load alone.
+#
+# Docker is replaced by a shim that fails for one station.
+#
+# Usage: scripts/test-selection-weights.sh
+#   E2E_PORT  Port for the API server (default: 18109)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18109}"
+
+echo "Selection Weights Test"
+echo "======================"
+
+source "$(dirname "$0")/lib.sh"
+
+# stop_all stops the server and collectors
+stop_all() {
+    for pid in "${PIDS[@]}"; do
+        kill "$pid" 2>/dev/null
+        wait "$pid" 2>/dev/null
+    done
+    PIDS=()
+}
+
+build
+
+# Fake docker: fail for sel-bad, otherwise write an NPZ file into the bind mount
+mkdir -p "${WORK_DIR}/bin"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+[[ " $* " == *" sel-bad "* ]] && exit 1
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/selection_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export JWT_SECRET="selection-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Checking weight validation..."
+for setting in "SELECTION_WEIGHT_LOAD=0" "SELECTION_WEIGHT_DISK=-1"; do
+    env "${setting}" DATABASE_PATH="${WORK_DIR}/invalid.db" timeout 10s "${BIN}" api > "${WORK_DIR}/invalid.out" 2>&1 &&
+        fail "Server started with ${setting}"
+    grep -q "SELECTION_WEIGHT" "${WORK_DIR}/invalid.out" || fail "Server did not explain why ${setting} is invalid: $(cat "${WORK_DIR}/invalid.out")"
+done
+echo "✅ Server refuses weights that are all 0 or negative"
+
+# start_server <run> [<setting>...] starts the API server with a fresh database
+start_server() {
+    local run=$1
+    shift
+    export DATABASE_PATH="${WORK_DIR}/${run}.db"
+    "${BIN}" admin create-user --email admin@example.com --password password123 --admin \
+        > "${WORK_DIR}/create-user-${run}.log" 2>&1 || fail "admin create-user failed"
+    env "$@" LOG_LEVEL=debug "${BIN}" api > "${WORK_DIR}/api-${run}.log" 2>&1 &
+    PIDS+=($!)
+    wait_healthy
+
+    # Stations are listed in the order they connect, so sel-bad comes first
+    for station in sel-bad sel-a sel-b sel-c; do
+        mkdir -p "${WORK_DIR}/data-${run}-${station}"
+        PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+            --station-id "${station}" \
+            --api-server-url "${API_URL}" \
+            --data-dir "${WORK_DIR}/data-${run}-${station}" > "${WORK_DIR}/${run}-${station}.log" 2>&1 &
+        PIDS+=($!)
+        wait_collector "${WORK_DIR}/${run}-${station}.log" "Collector ${station} did not connect"
+    done
+
+    TOKEN=$(curl -s -X POST "${API_URL}/api/auth/login" -H "Content-Type: application/json" \
+        -d '{"email": "admin@example.com", "password": "password123"}' |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Admin login failed"
+}
+
+# request prints the stations a new request went to, sorted, once it is complete
+request() {
+    local id
+    id=$(curl -s -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d '{"request_type": "data_collection", "parameters": "{}"}' |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["request_id"])') || return 1
+    for i in $(seq 1 60); do
+        curl -s "${API_URL}/api/data/status/${id}" -H "Authorization: Bearer ${TOKEN}" | grep -q '"complete":true' && break
+        sleep 0.5
+    done
+    curl -s "${API_URL}/api/data/status/${id}" -H "Authorization: Bearer ${TOKEN}" |
+        python3 -c 'import json, sys; r = json.load(sys.stdin); print(r["status"], ",".join(sorted(c["station_id"] for c in r["collectors"])))'
+}
+
+# config prints each factor's weight and share
+config() {
+    curl -s "${API_URL}/api/admin/selection/config" -H "Authorization: Bearer ${TOKEN}" |
+        python3 -c 'import json, sys; r = json.load(sys.stdin); print(" ".join("%s=%d/%.2f" % (f, r["weights"][f], r["shares"][f]) for f in ("load", "success", "response", "disk")))'
+}
+
+echo -e "\n🔍 Ranking by load only (the default)..."
+start_server load
+CONFIG=$(config)
+[ "${CONFIG}" = "load=1/1.00 success=0/0.00 response=0/0.00 disk=0/0.00" ] ||
+    fail "Unexpected default selection config: ${CONFIG}"
+echo "✅ Default weights reported"
+
+[ "$(request)" = "complete sel-a,sel-b,sel-bad" ] || fail "First request did not go to the first three stations"
+[ "$(request)" = "complete sel-a,sel-b,sel-bad" ] || fail "By load alone, the failing station should still be chosen"
+echo "✅ By load alone the failing station keeps getting requests"
+stop_all
+
+echo -e "\n🔍 Ranking by success rate and load..."
+start_server success SELECTION_WEIGHT_SUCCESS=3
+CONFIG=$(config)
+[ "${CONFIG}" = "load=1/0.25 success=3/0.75 response=0/0.00 disk=0/0.00" ] ||
+    fail "Unexpected selection config: ${CONFIG}"
+echo "✅ Configured weights reported"
+
+[ "$(request)" = "complete sel-a,sel-b,sel-bad" ] || fail "First request did not go to the first three stations"
+RESULT=$(request)
+[ "${RESULT}" = "complete sel-a,sel-b,sel-c" ] || fail "Failing station was not ranked last: ${RESULT}"
+grep -q "Stations by score: \[.*sel-bad\]" "${WORK_DIR}/api-success.log" || fail "Scores were not logged"
+echo "✅ The failing station is ranked behind the others"
+
+STATUS=$(curl -s -o /dev/null -w "%{http_code}" "${API_URL}/api/admin/selection/config" -H "Authorization: Bearer bogus")
+[ "${STATUS}" = "401" ] || fail "Unauthenticated selection config request returned ${STATUS}"
+
+echo -e "\n🎉 Selection weights test passed!"
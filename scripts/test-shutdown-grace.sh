@@ -0,0 +1,200 @@
+#!/bin/bash
+
+# Checks how the API server shuts down: on SIGTERM it must send connected
+# WebSocket clients a going-away close (1001), let an in-flight collector
+# upload finish within SHUTDOWN_GRACE_SECONDS and log that it waited for it,
+# abandon an upload that outlasts the grace period and log that it did, and
+# refuse to start with a negative grace period.
+#
+# Usage: scripts/test-shutdown-grace.sh
+#   E2E_PORT  Port for the API server (default: 18130)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18130}"
+STATION_ID="station-a"
+
+echo "Shutdown Grace Test"
+echo "==================="
+
+source "$(dirname "$0")/lib.sh"
+
+# stop_server <within> sends SIGTERM to the API server and fails unless it
+# exits within <within> seconds
+stop_server() {
+    kill -TERM "${API_PID}"
+    for i in $(seq 1 $(( 4 * $1 ))); do
+        kill -0 "${API_PID}" 2>/dev/null || { wait "${API_PID}"; return; }
+        sleep 0.25
+    done
+    fail "API server did not exit within $1s of SIGTERM"
+}
+
+# register <email> <client type> registers a user and prints its token
+register() {
+    curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\", \"client_type\": $2}" |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])'
+}
+
+# upload <name> <request ID> <seconds> uploads a file for a request in the
+# background, spreading its body over <seconds>, and writes the response's
+# status line, or "eof" if there is none, to <name>.out
+upload() {
+    python3 - "${E2E_PORT}" "${COLLECTOR_TOKEN}" "$2" "${STATION_ID}" "$3" > "${WORK_DIR}/$1.out" 2>&1 <<'PY' &
+import hashlib, os, socket, sys, time
+
+port, token, request_id, station_id, seconds = int(sys.argv[1]), sys.argv[2], sys.argv[3], sys.argv[4], float(sys.argv[5])
+body = os.urandom(64 * 1024)
+chunks = 16
+sock = socket.create_connection(("localhost", port))
+sock.sendall((
+    f"POST /api/collector/upload/{request_id}?station_id={station_id} HTTP/1.1\r\n"
+    f"Host: localhost:{port}\r\n"
+    f"Authorization: Bearer {token}\r\n"
+    f"X-Content-SHA256: {hashlib.sha256(body).hexdigest()}\r\n"
+    "Content-Type: application/octet-stream\r\n"
+    f"Content-Length: {len(body)}\r\n\r\n").encode())
+size = len(body) // chunks
+try:
+    for i in range(chunks):
+        sock.sendall(body[i * size:(i + 1) * size])
+        time.sleep(seconds / chunks)
+    response = sock.recv(4096)
+except OSError:
+    response = b""
+print(response.split(b"\r\n")[0].decode() if response else "eof", flush=True)
+PY
+    PIDS+=($!)
+}
+
+# receiver <name> <token> opens /receiver-ws with a raw handshake in the
+# background, writing to <name>.out. It prints "open" once connected, and
+# "close <code>" or "eof" when the server closes the connection.
+receiver() {
+    python3 - "${E2E_PORT}" "$2" > "${WORK_DIR}/$1.out" 2>&1 <<'PY' &
+import base64, os, socket, struct, sys
+
+port, token = int(sys.argv[1]), sys.argv[2]
+sock = socket.create_connection(("localhost", port))
+sock.sendall((
+    "GET /receiver-ws HTTP/1.1\r\n"
+    f"Host: localhost:{port}\r\n"
+    "Upgrade: websocket\r\nConnection: Upgrade\r\n"
+    f"Sec-WebSocket-Key: {base64.b64encode(os.urandom(16)).decode()}\r\nSec-WebSocket-Version: 13\r\n"
+    f"Authorization: Bearer {token}\r\n\r\n").encode())
+
+def read(buf):
+    chunk = sock.recv(4096)
+    if not chunk:
+        print("eof", flush=True)
+        sys.exit(0)
+    return buf + chunk
+
+buf = b""
+while b"\r\n\r\n" not in buf:
+    buf = read(buf)
+head, buf = buf.split(b"\r\n\r\n", 1)
+if b" 101 " not in head.split(b"\r\n")[0]:
+    print("handshake failed: " + head.split(b"\r\n")[0].decode(), flush=True)
+    sys.exit(1)
+print("open", flush=True)
+
+while True:
+    while len(buf) < 2:
+        buf = read(buf)
+    opcode, length = buf[0] & 0x0F, buf[1] & 0x7F
+    offset = 2
+    if length == 126:
+        length, offset = struct.unpack(">H", buf[2:4])[0], 4
+    elif length == 127:
+        length, offset = struct.unpack(">Q", buf[2:10])[0], 10
+    while len(buf) < offset + length:
+        buf = read(buf)
+    payload, buf = buf[offset:offset + length], buf[offset + length:]
+    if opcode == 0x8:
+        print("close", struct.unpack(">H", payload[:2])[0], flush=True)
+        sys.exit(0)
+PY
+    PIDS+=($!)
+}
+
+# wait_output <name> <line> waits for a background client to print a line
+wait_output() {
+    for i in $(seq 1 40); do
+        grep -q "^$2\$" "${WORK_DIR}/$1.out" 2>/dev/null && return
+        sleep 0.25
+    done
+    fail "$1 did not print '$2'"
+}
+
+# wait_in_flight <count> waits for /health to report a number of transfers in flight
+wait_in_flight() {
+    for i in $(seq 1 20); do
+        [ "$(curl -s "${API_URL}/health" | python3 -c 'import json, sys; print(json.load(sys.stdin)["in_flight_transfers"])')" = "$1" ] && return
+        sleep 0.25
+    done
+    fail "/health does not report $1 in-flight transfers"
+}
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/shutdown.db"
+export JWT_SECRET="shutdown-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export CACHE_DIR="${WORK_DIR}/cache"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server with a 10s grace period..."
+SHUTDOWN_GRACE_SECONDS=10 start_api first
+echo "✅ API server healthy"
+
+COLLECTOR_TOKEN=$(register collector@example.com 1) || fail "Failed to register the collector user"
+RECEIVER_TOKEN=$(register receiver@example.com 2) || fail "Failed to register the receiver user"
+
+# Uploads are only accepted from the station's user, for requests sent to it
+python3 - "${DATABASE_PATH}" "${STATION_ID}" <<'PY' || fail "Failed to seed the requests"
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1], timeout=10)
+user = db.execute("SELECT id FROM users WHERE email = 'receiver@example.com'").fetchone()[0]
+collector = db.execute("SELECT id FROM users WHERE email = 'collector@example.com'").fetchone()[0]
+db.execute("INSERT INTO stations (station_id, user_id) VALUES (?, ?)", (sys.argv[2], collector))
+for request_id in ("finished", "abandoned"):
+    db.execute("INSERT INTO data_requests (id, request_type, requested_by, status) VALUES (?, 'iq', ?, 'pending')", (request_id, user))
+    db.execute("INSERT INTO collector_responses (request_id, station_id, status) VALUES (?, ?, 'processing')", (request_id, sys.argv[2]))
+db.commit()
+PY
+
+echo -e "\n🔍 Shutting down during a 3s upload..."
+receiver listener "${RECEIVER_TOKEN}"
+wait_output listener open
+upload finished finished 3
+wait_in_flight 1
+stop_server 10
+wait_output listener "close 1001"
+wait_output finished "HTTP/1.1 201 Created"
+grep -q "Sent a going-away close to 1 WebSocket clients" "${WORK_DIR}/first.log" ||
+    fail "The server did not log the going-away close"
+grep -q "Waiting up to 10s for 1 in-flight transfers" "${WORK_DIR}/first.log" ||
+    fail "The server did not log the transfer it waits for"
+grep -q "Waited for 1 in-flight transfers to finish" "${WORK_DIR}/first.log" ||
+    fail "The server did not log waiting for the transfer"
+echo "✅ The receiver was told the server is going away and the upload finished"
+
+echo -e "\n🔍 Shutting down with a 1s grace period during a 10s upload..."
+SHUTDOWN_GRACE_SECONDS=1 start_api second
+upload abandoned abandoned 10
+wait_in_flight 1
+stop_server 4
+wait_output abandoned eof
+grep -q "Abandoning 1 in-flight transfers after the 1s grace period" "${WORK_DIR}/second.log" ||
+    fail "The server did not log abandoning the transfer"
+echo "✅ The upload was abandoned once the grace period ran out"
+
+echo -e "\n🔍 Starting with a negative grace period..."
+SHUTDOWN_GRACE_SECONDS=-1 "${BIN}" api > "${WORK_DIR}/negative.log" 2>&1 && fail "The server started with a negative grace period"
+grep -q "invalid SHUTDOWN_GRACE_SECONDS -1" "${WORK_DIR}/negative.log" || fail "The negative grace period was not reported"
+echo "✅ A negative grace period keeps the server from starting"
+
+echo -e "\n🎉 Shutdown grace test passed!"
@@ -0,0 +1,125 @@
+#!/bin/bash
+
+# Checks single-station requests: max_stations limits a request to the best
+# ranked stations, conflicting min_stations values are rejected, and a
+# receiver with --single-station downloads one file and exits.
+#
+# Usage: scripts/test-single-station.sh
+#   E2E_PORT  Port for the API server (default: 18119)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18119}"
+
+echo "Single Station Test"
+echo "==================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: take a few seconds, then write an NPZ file into the bind mount
+mkdir -p "${WORK_DIR}/bin"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+sleep 3
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/single_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/single.db"
+export JWT_SECRET="single-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+# start_collector <station>
+start_collector() {
+    mkdir -p "${WORK_DIR}/data-$1"
+    PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+        --station-id "$1" \
+        --api-server-url "${API_URL}" \
+        --data-dir "${WORK_DIR}/data-$1" > "${WORK_DIR}/$1.log" 2>&1 &
+    PIDS+=($!)
+
+    wait_collector "${WORK_DIR}/$1.log" "Collector $1 did not connect to the API server"
+}
+
+echo -e "\n🔍 Starting three collectors..."
+start_collector single-a
+start_collector single-b
+start_collector single-c
+echo "✅ Collectors connected"
+
+# The receiver logs in with this account
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "receiver@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+
+# request <extra JSON fields> sends a request and prints the HTTP status, then
+# the stations it was sent to
+request() {
+    local response status
+    response=$(curl -s -w "\n%{http_code}" -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d "{\"request_type\": \"data_collection\", \"parameters\": \"{}\", $1}")
+    status=$(echo "${response}" | tail -n 1)
+    echo "${status}"
+    [ "${status}" = "202" ] || return
+    curl -s "${API_URL}/api/data/status/$(echo "${response}" | head -n 1 | python3 -c 'import json, sys; print(json.load(sys.stdin)["request_id"])')" \
+        -H "Authorization: Bearer ${TOKEN}" |
+        python3 -c 'import json, sys; print(",".join(sorted(c["station_id"] for c in json.load(sys.stdin)["collectors"])))'
+}
+
+echo -e "\n🔍 Limiting requests with max_stations..."
+RESULT=$(request '"max_stations": 2')
+[ "$(echo "${RESULT}" | head -n 1)" = "202" ] || fail "Request with max_stations 2 returned ${RESULT}"
+BUSY=$(echo "${RESULT}" | tail -n 1)
+[ "$(echo "${BUSY}" | tr ',' '\n' | wc -l)" = "2" ] || fail "Request with max_stations 2 went to: ${BUSY}"
+IDLE=$(printf 'single-a\nsingle-b\nsingle-c\n' | grep -v -x -F "$(echo "${BUSY}" | tr ',' '\n')")
+echo "✅ max_stations 2 sent the request to ${BUSY}"
+
+# The station without a request in flight ranks best
+PLAN=$(curl -s -X POST "${API_URL}/api/data/request/plan" -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+    -d '{"request_type": "data_collection", "parameters": "{}", "max_stations": 1}' |
+    python3 -c 'import json, sys; p = json.load(sys.stdin); print(",".join(p["chosen"]), len(p["stations"]))')
+[ "${PLAN}" = "${IDLE} 3" ] || fail "Plan with max_stations 1 chose ${PLAN}, not ${IDLE} of 3 candidates"
+RESULT=$(request '"max_stations": 1, "min_stations": 1')
+[ "${RESULT}" = "$(printf '202\n%s' "${IDLE}")" ] || fail "Request with max_stations 1 went to: ${RESULT}"
+echo "✅ max_stations 1 sent the request to the best ranked station, ${IDLE}"
+
+for fields in '"max_stations": -1' '"max_stations": 4' '"max_stations": 1, "min_stations": 2'; do
+    [ "$(request "${fields}")" = "400" ] || fail "Request with ${fields} was not rejected"
+done
+echo "✅ Out of range max_stations and a larger min_stations are rejected"
+
+echo -e "\n🔍 Running receiver with --single-station..."
+sleep 5 # let the earlier requests finish so all stations are idle
+START=$(date +%s)
+timeout 120s "${BIN}" receiver \
+    --receiver-id single-receiver \
+    --api-server-url "${API_URL}" \
+    --single-station \
+    --download-dir "${WORK_DIR}/downloads" > "${WORK_DIR}/receiver.log" 2>&1 || fail "Receiver failed"
+ELAPSED=$(( $(date +%s) - START ))
+grep -q "Request .* submitted to 1 collectors" "${WORK_DIR}/receiver.log" || fail "Receiver request did not go to one station"
+grep -q "Completed the download from station single-" "${WORK_DIR}/receiver.log" || fail "Receiver did not report its download"
+FILES=$(ls "${WORK_DIR}/downloads" | grep -c '\.npz$')
+[ "${FILES}" = "1" ] || fail "Receiver downloaded ${FILES} files: $(ls "${WORK_DIR}/downloads")"
+[ "${ELAPSED}" -lt 60 ] || fail "Receiver took ${ELAPSED}s to exit"
+echo "✅ Receiver downloaded one file and exited after ${ELAPSED}s"
+
+echo -e "\n🎉 Single station test passed!"
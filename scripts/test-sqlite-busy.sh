@@ -0,0 +1,80 @@
+#!/bin/bash
+
+# Checks that hot-path writes survive SQLite lock contention. Another process
+# repeatedly holds an exclusive lock on the database for longer than
+# DATABASE_BUSY_TIMEOUT_MS while receivers open ICE sessions in parallel; every
+# session must still be stored thanks to the busy retry.
+#
+# Usage: scripts/test-sqlite-busy.sh
+#   E2E_PORT  Port for the API server (default: 18089)
+#   WRITERS   Number of concurrent session requests (default: 20)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18089}"
+WRITERS="${WRITERS:-20}"
+
+echo "SQLite Busy Retry Test"
+echo "======================"
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/busy.db"
+export DATABASE_BUSY_TIMEOUT_MS=50
+export JWT_SECRET="busy-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server with a ${DATABASE_BUSY_TIMEOUT_MS}ms busy timeout..."
+start_api
+echo "✅ API server healthy"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "busy@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the receiver user"
+
+# Competing writer: holds an exclusive lock for 150ms at a time, 3x the busy timeout,
+# leaving 50ms gaps for the server's writes
+python3 - "${DATABASE_PATH}" "${WORK_DIR}/locker.done" <<'PY' &
+import os, sqlite3, sys, time
+
+db = sqlite3.connect(sys.argv[1], timeout=5, isolation_level=None)
+deadline = time.time() + 4
+locks = 0
+while time.time() < deadline:
+    db.execute("BEGIN EXCLUSIVE")
+    time.sleep(0.15)
+    db.execute("COMMIT")
+    locks += 1
+    time.sleep(0.05)
+open(sys.argv[2], "w").write(str(locks))
+PY
+LOCKER=$!
+PIDS+=(${LOCKER})
+sleep 0.2
+
+echo -e "\n🔍 Opening ${WRITERS} ICE sessions while the database is repeatedly locked..."
+for i in $(seq 1 "${WRITERS}"); do
+    curl -s -o /dev/null -w "%{http_code}\n" -X POST "${API_URL}/api/ice/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d '{"parameters": "{}"}' >> "${WORK_DIR}/statuses" &
+done
+wait $(jobs -p | grep -v "^${LOCKER}$" | grep -v "^${API_PID}$") 2>/dev/null
+wait "${LOCKER}"
+
+locks=$(cat "${WORK_DIR}/locker.done" 2>/dev/null)
+[ -n "${locks}" ] || fail "Competing writer did not run"
+echo "✅ Competing writer took the lock ${locks} times"
+
+created=$(grep -c '^201$' "${WORK_DIR}/statuses")
+[ "${created}" = "${WRITERS}" ] || fail "Only ${created} of ${WRITERS} session requests succeeded: $(sort "${WORK_DIR}/statuses" | uniq -c | tr '\n' ' ')"
+echo "✅ All ${WRITERS} session requests succeeded"
+
+stored=$(python3 -c 'import sqlite3, sys; print(sqlite3.connect(sys.argv[1]).execute("SELECT COUNT(*) FROM ice_sessions").fetchone()[0])' "${DATABASE_PATH}")
+[ "${stored}" = "${WRITERS}" ] || fail "${stored} sessions stored, expected ${WRITERS}"
+echo "✅ All ${WRITERS} sessions stored"
+
+echo -e "\n🎉 SQLite busy retry test completed successfully!"
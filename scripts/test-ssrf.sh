@@ -0,0 +1,157 @@
+#!/bin/bash
+
+# Checks that the server's download proxy won't fetch collector download URLs
+# that point at internal addresses, unless they are in OUTBOUND_ALLOWED_NETWORKS,
+# that redirects can't get around it, and that responses larger than
+# PROXY_MAX_DOWNLOAD_MB are cut off whether or not they declare a length. Collector
+# responses are written straight into the database, standing in for a
+# malicious collector.
+#
+# Usage: scripts/test-ssrf.sh
+#   E2E_PORT     Port for the API server (default: 18087)
+#   TARGET_PORT  Port for the internal service the payloads point at (default: 18088)
+#   E2E_KEEP     Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18087}"
+TARGET_PORT="${TARGET_PORT:-18088}"
+SECRET="internal-secret-$$"
+
+echo "SSRF Protection Test"
+echo "===================="
+
+source "$(dirname "$0")/lib.sh"
+
+# add_response STATION URL records a ready collector response with that download URL
+add_response() {
+    python3 - "${DATABASE_PATH}" "${REQUEST_ID}" "$1" "$2" <<'PY'
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1])
+db.execute("INSERT INTO collector_responses (request_id, station_id, status, download_url, completed_at) "
+           "VALUES (?, ?, 'ready', ?, CURRENT_TIMESTAMP)", sys.argv[2:5])
+db.commit()
+PY
+}
+
+# download STATION prints the HTTP status and saves the body to download.out
+download() {
+    curl -s -o "${WORK_DIR}/download.out" -w "%{http_code}" \
+        "${API_URL}/api/data/download/${REQUEST_ID}/$1" -H "Authorization: Bearer ${TOKEN}"
+}
+
+build
+
+# The "internal" service: serves the secret, a redirect to the metadata
+# address, and a body larger than the proxy allows
+python3 - "${TARGET_PORT}" "${SECRET}" > "${WORK_DIR}/target.log" 2>&1 <<'PY' &
+import http.server, sys
+
+port, secret = int(sys.argv[1]), sys.argv[2].encode()
+
+class Target(http.server.BaseHTTPRequestHandler):
+    def do_GET(self):
+        if self.path == "/redirect":
+            self.send_response(302)
+            self.send_header("Location", "http://169.254.169.254/latest/meta-data/")
+            self.end_headers()
+        elif self.path == "/large":
+            body = b"x" * (2 * 1024 * 1024)
+            self.send_response(200)
+            self.send_header("Content-Length", str(len(body)))
+            self.end_headers()
+            self.wfile.write(body)
+        elif self.path == "/chunked":
+            # 2 MB with no declared length
+            self.send_response(200)
+            self.send_header("Transfer-Encoding", "chunked")
+            self.end_headers()
+            chunk = b"x" * 65536
+            for _ in range(32):
+                self.wfile.write(b"%x\r\n%s\r\n" % (len(chunk), chunk))
+            self.wfile.write(b"0\r\n\r\n")
+        else:
+            self.send_response(200)
+            self.send_header("Content-Length", str(len(secret)))
+            self.end_headers()
+            self.wfile.write(secret)
+
+http.server.HTTPServer(("127.0.0.1", port), Target).serve_forever()
+PY
+PIDS+=($!)
+
+export DATABASE_PATH="${WORK_DIR}/ssrf.db"
+export JWT_SECRET="ssrf-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+export PROXY_MAX_DOWNLOAD_MB=1
+
+echo -e "\n🔍 Starting API server with default outbound settings..."
+start_api
+echo "✅ API server healthy"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "ssrf@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the receiver user"
+REQUEST_ID="ssrf-request"
+python3 - "${DATABASE_PATH}" "${REQUEST_ID}" <<'PY' || fail "Failed to create the data request"
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1])
+db.execute("INSERT INTO data_requests (id, request_type, requested_by, status) VALUES (?, 'data_collection', 1, 'completed')", (sys.argv[2],))
+db.commit()
+PY
+
+i=0
+for url in \
+    "http://127.0.0.1:${TARGET_PORT}/secret" \
+    "http://localhost:${TARGET_PORT}/secret" \
+    "http://[::1]:${TARGET_PORT}/secret" \
+    "http://0.0.0.0:${TARGET_PORT}/secret" \
+    "http://169.254.169.254/latest/meta-data/" \
+    "http://10.0.0.1/secret" \
+    "http://192.168.1.1/secret" \
+    "http://100.64.0.1/secret"; do
+    i=$((i + 1))
+    add_response "station-${i}" "${url}" || fail "Failed to add collector response"
+    status=$(download "station-${i}")
+    grep -q "${SECRET}" "${WORK_DIR}/download.out" && fail "Proxy returned the internal secret for ${url}"
+    [ "${status}" = "502" ] || fail "Download via ${url} returned ${status}, expected 502"
+done
+echo "✅ ${i} internal download URLs refused with 502"
+
+stop_api
+
+echo -e "\n🔍 Restarting API server with OUTBOUND_ALLOWED_NETWORKS=127.0.0.1..."
+export OUTBOUND_ALLOWED_NETWORKS=127.0.0.1
+start_api
+echo "✅ API server healthy"
+
+status=$(download "station-1")
+[ "${status}" = "200" ] || fail "Download from the allowlisted address returned ${status}, expected 200"
+grep -q "${SECRET}" "${WORK_DIR}/download.out" || fail "Download from the allowlisted address has the wrong body"
+echo "✅ Allowlisted address can be reached"
+
+status=$(download "station-5")
+[ "${status}" = "502" ] || fail "Metadata address returned ${status}, expected 502 even with an allowlist"
+echo "✅ Addresses outside the allowlist are still refused"
+
+add_response "station-redirect" "http://127.0.0.1:${TARGET_PORT}/redirect" || fail "Failed to add collector response"
+status=$(download "station-redirect")
+[ "${status}" = "502" ] || fail "Redirect to the metadata address returned ${status}, expected 502"
+echo "✅ Redirect to an internal address refused"
+
+add_response "station-large" "http://127.0.0.1:${TARGET_PORT}/large" || fail "Failed to add collector response"
+status=$(download "station-large")
+[ "${status}" = "502" ] || fail "Response declaring more than PROXY_MAX_DOWNLOAD_MB returned ${status}, expected 502"
+echo "✅ Oversized response refused with 502"
+
+add_response "station-chunked" "http://127.0.0.1:${TARGET_PORT}/chunked" || fail "Failed to add collector response"
+curl -s -o "${WORK_DIR}/download.out" "${API_URL}/api/data/download/${REQUEST_ID}/station-chunked" \
+    -H "Authorization: Bearer ${TOKEN}"
+curl_exit=$?
+size=$(wc -c < "${WORK_DIR}/download.out")
+[ "${size}" -le $((1024 * 1024)) ] || fail "Chunked response was proxied past the limit (${size} bytes)"
+[ "${curl_exit}" -ne 0 ] || fail "Truncated chunked download looked complete to the client"
+echo "✅ Chunked response cut off at the limit (${size} bytes, curl exit ${curl_exit})"
+
+echo -e "\n🎉 SSRF protection test completed successfully!"
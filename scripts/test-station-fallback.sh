@@ -0,0 +1,128 @@
+#!/bin/bash
+
+# Checks how stations are chosen when a request's region holds too few of
+# them: without region_fallback the request only goes to the stations inside
+# it, with region_fallback it is filled up with stations outside it, and
+# min_stations fails the request when even that isn't enough.
+#
+# Usage: scripts/test-station-fallback.sh
+#   E2E_PORT  Port for the API server (default: 18108)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18108}"
+
+echo "Station Fallback Test"
+echo "====================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: write an NPZ file into the bind mount
+mkdir -p "${WORK_DIR}/bin"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/fallback_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/fallback.db"
+export JWT_SECRET="fallback-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+# start_collector <station> <latitude> <longitude>
+start_collector() {
+    mkdir -p "${WORK_DIR}/data-$1"
+    COLLECTOR_LATITUDE="$2" COLLECTOR_LONGITUDE="$3" PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+        --station-id "$1" \
+        --api-server-url "${API_URL}" \
+        --data-dir "${WORK_DIR}/data-$1" > "${WORK_DIR}/$1.log" 2>&1 &
+    PIDS+=($!)
+
+    wait_collector "${WORK_DIR}/$1.log" "Collector $1 did not connect to the API server"
+}
+
+echo -e "\n🔍 Starting three collectors..."
+start_collector fb-west 47.0 8.0
+start_collector fb-middle 47.0 8.1
+start_collector fb-east 47.0 8.2
+EAST_PID=${PIDS[-1]}
+echo "✅ Collectors connected"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "fallback@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+
+# request <extra JSON fields> sends a request and prints the HTTP status, then
+# the stations it was sent to
+request() {
+    local response status
+    response=$(curl -s -w "\n%{http_code}" -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d "{\"request_type\": \"data_collection\", \"parameters\": \"{}\", $1}")
+    status=$(echo "${response}" | tail -n 1)
+    echo "${status}"
+    [ "${status}" = "202" ] || return
+    curl -s "${API_URL}/api/data/status/$(echo "${response}" | head -n 1 | python3 -c 'import json, sys; print(json.load(sys.stdin)["request_id"])')" \
+        -H "Authorization: Bearer ${TOKEN}" |
+        python3 -c 'import json, sys; print(",".join(sorted(c["station_id"] for c in json.load(sys.stdin)["collectors"])))'
+}
+
+NEAR_WEST='"region": {"center": {"latitude": 47.0, "longitude": 8.0}, "radius_m": 5000}'
+NOWHERE='"region": {"bbox": {"south": -10, "west": 170, "north": 10, "east": -170}}'
+
+echo -e "\n🔍 Requesting from a region with one station..."
+RESULT=$(request "${NEAR_WEST}")
+[ "${RESULT}" = "$(printf '202\nfb-west')" ] || fail "Request without region_fallback went to: ${RESULT}"
+echo "✅ Without region_fallback the request stays in its region"
+
+RESULT=$(request "${NEAR_WEST}, \"region_fallback\": true")
+[ "${RESULT}" = "$(printf '202\nfb-east,fb-middle,fb-west')" ] || fail "Request with region_fallback went to: ${RESULT}"
+grep -q "Only 1 of the 3 stations wanted for request .* are in its region; relaxed the region to add" "${WORK_DIR}/api.log" ||
+    fail "Server did not log the relaxed region"
+echo "✅ With region_fallback the request is filled up from outside its region"
+
+RESULT=$(request "${NOWHERE}, \"region_fallback\": true")
+[ "${RESULT}" = "$(printf '202\nfb-east,fb-middle,fb-west')" ] || fail "Request for an empty region with region_fallback went to: ${RESULT}"
+[ "$(request "${NOWHERE}")" = "503" ] || fail "Request for an empty region without region_fallback was not refused"
+echo "✅ An empty region is only refused without region_fallback"
+
+echo -e "\n🔍 Requiring a minimum number of stations..."
+[ "$(request "${NEAR_WEST}, \"min_stations\": 2")" = "503" ] || fail "Request with too few stations in its region was not refused"
+RESULT=$(request "${NEAR_WEST}, \"region_fallback\": true, \"min_stations\": 2")
+[ "${RESULT}" = "$(printf '202\nfb-east,fb-middle,fb-west')" ] || fail "Relaxed request with min_stations went to: ${RESULT}"
+RESULT=$(request '"min_stations": 3')
+[ "${RESULT}" = "$(printf '202\nfb-east,fb-middle,fb-west')" ] || fail "Request with min_stations 3 went to: ${RESULT}"
+for min in -1 4; do
+    [ "$(request "\"min_stations\": ${min}")" = "400" ] || fail "min_stations ${min} was accepted"
+done
+echo "✅ min_stations is met by relaxing the region and out of range values are rejected"
+
+kill "${EAST_PID}"
+for i in $(seq 1 20); do
+    [ "$(request '"min_stations": 3')" = "503" ] && break
+    sleep 0.5
+done
+[ "$(request "${NEAR_WEST}, \"region_fallback\": true, \"min_stations\": 3")" = "503" ] ||
+    fail "Request with region_fallback was not refused with fewer than min_stations stations"
+grep -q "fewer stations available than min_stations: 2 available, 3 required" "${WORK_DIR}/api.log" ||
+    fail "Server did not log why the request failed"
+echo "✅ min_stations fails the request when relaxing the region isn't enough"
+
+echo -e "\n🎉 Station fallback test passed!"
@@ -0,0 +1,170 @@
+#!/bin/bash
+
+# Checks that the server rates the TDOA geometry of stations from the
+# locations their collectors report, that a receiver with
+# RECEIVER_GEOMETRY_CHECK=refuse doesn't send a request its stations can't
+# give a usable fix for, and that requests with a region only go to the
+# stations inside it.
+#
+# Usage: scripts/test-station-geometry.sh
+#   E2E_PORT  Port for the API server (default: 18098)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18098}"
+
+echo "Station Geometry Test"
+echo "====================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: collections fail, the tests only look at where requests go
+mkdir -p "${WORK_DIR}/bin"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+echo "fake docker: no collection in this test" >&2
+exit 1
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/geometry.db"
+export JWT_SECRET="geometry-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+# start_collector <station> [<latitude> <longitude>]
+start_collector() {
+    mkdir -p "${WORK_DIR}/data-$1"
+    COLLECTOR_LATITUDE="${2:-}" COLLECTOR_LONGITUDE="${3:-}" PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+        --station-id "$1" \
+        --api-server-url "${API_URL}" \
+        --data-dir "${WORK_DIR}/data-$1" > "${WORK_DIR}/$1.log" 2>&1 &
+    PIDS+=($!)
+
+    wait_collector "${WORK_DIR}/$1.log" "Collector $1 did not connect to the API server"
+}
+
+# geometry <query> prints the geometry endpoint's response
+geometry() {
+    curl -s "${API_URL}/api/stations/geometry$1" -H "Authorization: Bearer ${TOKEN}"
+}
+
+# field <json> <expression> evaluates a Python expression on a response
+field() {
+    echo "$1" | python3 -c "import json, sys; g = json.load(sys.stdin); print($2)"
+}
+
+echo -e "\n🔍 Starting three collectors along a line..."
+start_collector geo-west 47.0 8.0
+start_collector geo-middle 47.0 8.1
+start_collector geo-east 47.0 8.2
+echo "✅ Collectors connected"
+
+echo -e "\n🔍 Running receiver with RECEIVER_GEOMETRY_CHECK=refuse..."
+RECEIVER_GEOMETRY_CHECK=refuse timeout 60s "${BIN}" receiver \
+    --receiver-id geo-receiver-1 \
+    --api-server-url "${API_URL}" \
+    --download-dir "${WORK_DIR}/downloads" > "${WORK_DIR}/receiver.log" 2>&1
+RECEIVER_EXIT=$?
+[ $RECEIVER_EXIT -ne 0 ] || fail "Receiver sent a request to collinear stations"
+[ $RECEIVER_EXIT -ne 124 ] || fail "Receiver hung instead of refusing"
+grep -q "can't give a usable TDOA fix" "${WORK_DIR}/receiver.log" || fail "Receiver error does not explain the refusal"
+grep -q "Sending data request" "${WORK_DIR}/receiver.log" && fail "Receiver sent the request anyway"
+echo "✅ Receiver refused to send the request"
+
+# The receiver's user exists once a receiver has logged in
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/login" -H "Content-Type: application/json" \
+    -d '{"email": "receiver@example.com", "password": "password123"}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to log in as the receiver user"
+
+RESULT=$(geometry "")
+[ "$(field "${RESULT}" 'len(g["stations"])')" = "3" ] || fail "Locations of the collectors were not reported: ${RESULT}"
+[ "$(field "${RESULT}" 'g["usable"]')" = "False" ] || fail "Collinear stations were rated usable: ${RESULT}"
+[ "$(field "${RESULT}" 'g["gdop"]')" = "None" ] || fail "Collinear stations got a finite GDOP: ${RESULT}"
+echo "✅ Collinear stations are unusable ($(field "${RESULT}" 'g["reason"]'))"
+
+echo -e "\n🔍 Running receiver with RECEIVER_GEOMETRY_CHECK=warn..."
+RECEIVER_GEOMETRY_CHECK=warn timeout 10s "${BIN}" receiver \
+    --receiver-id geo-receiver-2 \
+    --api-server-url "${API_URL}" \
+    --download-dir "${WORK_DIR}/downloads" > "${WORK_DIR}/receiver-warn.log" 2>&1
+grep -q "may not give a usable TDOA fix" "${WORK_DIR}/receiver-warn.log" || fail "Receiver did not warn about the geometry"
+grep -q "Sending data request" "${WORK_DIR}/receiver-warn.log" || fail "Receiver did not send the request after warning"
+echo "✅ Receiver warned and sent the request"
+
+echo -e "\n🔍 Starting a collector off the line and one without a location..."
+start_collector geo-north 47.12 8.1
+start_collector geo-unknown
+echo "✅ Collectors connected"
+
+RESULT=$(geometry "?station_ids=geo-west,geo-east,geo-north")
+[ "$(field "${RESULT}" 'g["usable"]')" = "True" ] || fail "A well spread triangle was rated unusable: ${RESULT}"
+field "${RESULT}" '0.25 < g["score"] <= 1 and 14000 < g["max_baseline_m"] < 16000' | grep -q True ||
+    fail "Unexpected rating of a well spread triangle: ${RESULT}"
+echo "✅ Triangle is usable (GDOP $(field "${RESULT}" 'round(g["gdop"], 2)'))"
+
+RESULT=$(geometry "?station_ids=geo-west,geo-middle,geo-north")
+[ "$(field "${RESULT}" 'g["usable"]')" = "True" ] || fail "A smaller triangle was rated unusable: ${RESULT}"
+RESULT=$(geometry "?station_ids=geo-west,geo-east,geo-unknown")
+[ "$(field "${RESULT}" 'g["usable"]')" = "False" ] || fail "Stations without a location were rated usable: ${RESULT}"
+[ "$(field "${RESULT}" 'g["missing_locations"]')" = "['geo-unknown']" ] || fail "Missing location not reported: ${RESULT}"
+echo "✅ Stations without a location are reported"
+
+STATUS=$(curl -s -o /dev/null -w "%{http_code}" "${API_URL}/api/stations/geometry?station_ids=,")
+[ "${STATUS}" = "401" ] || fail "Unauthenticated request returned ${STATUS}, not 401"
+STATUS=$(curl -s -o /dev/null -w "%{http_code}" "${API_URL}/api/stations/geometry?station_ids=," -H "Authorization: Bearer ${TOKEN}")
+[ "${STATUS}" = "400" ] || fail "Empty station_ids returned ${STATUS}, not 400"
+echo "✅ Bad requests are rejected"
+
+# request_region <region JSON> sends a request limited to a region and prints
+# the HTTP status, then the stations it was sent to
+request_region() {
+    local response status
+    response=$(curl -s -w "\n%{http_code}" -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d "{\"request_type\": \"data_collection\", \"parameters\": \"{}\", \"region\": $1}")
+    status=$(echo "${response}" | tail -n 1)
+    echo "${status}"
+    [ "${status}" = "202" ] || return
+    curl -s "${API_URL}/api/data/status/$(field "$(echo "${response}" | head -n 1)" 'g["request_id"]')" \
+        -H "Authorization: Bearer ${TOKEN}" |
+        python3 -c 'import json, sys; print(",".join(sorted(c["station_id"] for c in json.load(sys.stdin)["collectors"])))'
+}
+
+echo -e "\n🔍 Requesting data from regions..."
+RESULT=$(request_region '{"bbox": {"south": 47.1, "west": 8.05, "north": 47.2, "east": 8.15}}')
+[ "${RESULT}" = "$(printf '202\ngeo-north')" ] || fail "Bounding box request went to: ${RESULT}"
+RESULT=$(request_region '{"center": {"latitude": 47.0, "longitude": 8.0}, "radius_m": 5000}')
+[ "${RESULT}" = "$(printf '202\ngeo-west')" ] || fail "5 km radius request went to: ${RESULT}"
+RESULT=$(request_region '{"center": {"latitude": 47.0, "longitude": 8.0}, "radius_m": 9000}')
+[ "${RESULT}" = "$(printf '202\ngeo-middle,geo-west')" ] || fail "9 km radius request went to: ${RESULT}"
+echo "✅ Requests only go to stations in their region"
+
+[ "$(request_region '{"bbox": {"south": -10, "west": 170, "north": 10, "east": -170}}')" = "503" ] ||
+    fail "Request for a region without stations was not refused"
+grep -q "no stations available in the requested region" "${WORK_DIR}/api.log" || fail "Server did not log why the request failed"
+for region in '{}' '{"center": {"latitude": 47, "longitude": 8}}' '{"center": {"latitude": 95, "longitude": 8}, "radius_m": 1000}' \
+    '{"bbox": {"south": 48, "west": 8, "north": 47, "east": 9}}' \
+    '{"bbox": {"south": 47, "west": 8, "north": 48, "east": 9}, "center": {"latitude": 47, "longitude": 8}, "radius_m": 1000}'; do
+    [ "$(request_region "${region}")" = "400" ] || fail "Invalid region was accepted: ${region}"
+done
+echo "✅ Empty and invalid regions are rejected"
+
+echo -e "\n🔍 Starting a collector with only a latitude..."
+COLLECTOR_LATITUDE=47.0 timeout 10s "${BIN}" collector \
+    --station-id geo-broken \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data-broken" > "${WORK_DIR}/geo-broken.log" 2>&1
+[ $? -ne 124 ] || fail "Collector started without a longitude"
+grep -q "COLLECTOR_LATITUDE and COLLECTOR_LONGITUDE must be set together" "${WORK_DIR}/geo-broken.log" ||
+    fail "Collector did not explain the incomplete location"
+echo "✅ Incomplete location is rejected"
+
+echo -e "\n🎉 Station geometry test passed!"
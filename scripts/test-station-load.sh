@@ -0,0 +1,123 @@
+#!/bin/bash
+
+# Checks that requests go to the least busy stations: with four stations, a
+# request made while three of them are capturing must include the idle one,
+# and a station counts as idle again once it has delivered.
+#
+# Docker is replaced by a shim that captures for the requested duration.
+#
+# Usage: scripts/test-station-load.sh
+#   E2E_PORT  Port for the API server (default: 18107)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18107}"
+
+echo "Station Load Test"
+echo "================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: sleep for --duration, then write an NPZ file into the bind mount
+mkdir -p "${WORK_DIR}/bin"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+duration=$(echo "$@" | sed -n 's/.*--duration \([^ ]*\).*/\1/p')
+sleep "${duration:-0}"
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/load_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/load.db"
+export JWT_SECRET="load-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+LOG_LEVEL=debug start_api
+echo "✅ API server healthy"
+
+STATIONS="load-a load-b load-c load-d"
+for station in ${STATIONS}; do
+    mkdir -p "${WORK_DIR}/data-${station}"
+    PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+        --station-id "${station}" \
+        --api-server-url "${API_URL}" \
+        --data-dir "${WORK_DIR}/data-${station}" > "${WORK_DIR}/${station}.log" 2>&1 &
+    PIDS+=($!)
+
+    # Collectors register the same user on first start, so one at a time
+    wait_collector "${WORK_DIR}/${station}.log" "Collector ${station} did not connect"
+done
+echo "✅ Four collectors connected"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "load@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+
+# request <duration_seconds> prints the ID of a new data request
+request() {
+    curl -s -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d "{\"request_type\": \"data_collection\", \"parameters\": \"{}\", \"duration_seconds\": $1}" |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["request_id"])'
+}
+
+# stations_of <request ID> prints the stations a request went to, sorted
+stations_of() {
+    curl -s "${API_URL}/api/data/status/$1" -H "Authorization: Bearer ${TOKEN}" |
+        python3 -c 'import json, sys; print(" ".join(sorted(c["station_id"] for c in json.load(sys.stdin)["collectors"])))'
+}
+
+# idle_station <busy stations> prints the station not among them
+idle_station() {
+    for station in ${STATIONS}; do
+        [[ " $1 " == *" ${station} "* ]] || echo "${station}"
+    done
+}
+
+echo -e "\n🔍 Keeping three stations busy..."
+LONG_ID=$(request 30) || fail "Request failed"
+BUSY=$(stations_of "${LONG_ID}")
+IDLE=$(idle_station "${BUSY}")
+[ "$(echo "${BUSY}" | wc -w)" = "3" ] && [ -n "${IDLE}" ] || fail "Long request went to '${BUSY}'"
+echo "✅ Long request went to ${BUSY}; ${IDLE} is idle"
+
+SHORT_ID=$(request 1) || fail "Request failed"
+[[ " $(stations_of "${SHORT_ID}") " == *" ${IDLE} "* ]] ||
+    fail "Request made while three stations were busy skipped idle ${IDLE}: $(stations_of "${SHORT_ID}")"
+echo "✅ Next request included idle station ${IDLE}"
+
+# station_status <request ID> <station> prints the station's status for a request
+station_status() {
+    curl -s "${API_URL}/api/data/status/$1" -H "Authorization: Bearer ${TOKEN}" |
+        python3 -c 'import json, sys; print(" ".join(c["status"] for c in json.load(sys.stdin)["collectors"] if c["station_id"] == sys.argv[1]))' "$2"
+}
+for i in $(seq 1 20); do
+    [ "$(station_status "${SHORT_ID}" "${IDLE}")" = "ready" ] && break
+    sleep 0.5
+done
+[ "$(station_status "${SHORT_ID}" "${IDLE}")" = "ready" ] || fail "${IDLE} did not deliver the short request"
+
+echo -e "\n🔍 Requesting again once the short request is delivered..."
+NEXT_ID=$(request 1) || fail "Request failed"
+[[ " $(stations_of "${NEXT_ID}") " == *" ${IDLE} "* ]] ||
+    fail "Station ${IDLE} still counted as busy after delivering: $(stations_of "${NEXT_ID}")"
+grep -q "Stations by score: \[${IDLE} " "${WORK_DIR}/api.log" || fail "Station loads were not logged"
+echo "✅ ${IDLE} counted as idle again after delivering"
+
+curl -s -o /dev/null -X POST "${API_URL}/api/data/cancel/${LONG_ID}" -H "Authorization: Bearer ${TOKEN}"
+
+echo -e "\n🎉 Station load test passed!"
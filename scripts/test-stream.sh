@@ -0,0 +1,157 @@
+#!/bin/bash
+
+# Test of capture streaming: a receiver in --stream mode gets frames from a
+# collector until it has enough, then stops the stream.
+#
+# Runs the API server, a collector and a receiver on this machine with the
+# same docker shim as test-e2e.sh, slowed down to look like a real capture.
+# Checks that each frame arrives intact and is indexed with its capture
+# metadata, that the collector stops when asked without getting more than the
+# stream window ahead, and that sent frames don't pile up on the collector.
+# Then streams again over a partially reliable data channel, which the
+# receiver must only accept with RECEIVER_ALLOW_PARTIAL_RELIABILITY.
+#
+# Usage: scripts/test-stream.sh
+#   E2E_PORT     Port for the API server (default: 18090)
+#   E2E_TIMEOUT  Seconds to wait for the receiver to finish (default: 120)
+#   E2E_KEEP     Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18090}"
+E2E_TIMEOUT="${E2E_TIMEOUT:-120}"
+FRAMES=3
+
+echo "Capture Streaming Test"
+echo "======================"
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: write a small NPZ file into the bind mount source, taking a
+# moment like a real capture
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data" "${WORK_DIR}/downloads"
+cat > "${WORK_DIR}/bin/docker" <<'EOF'
+#!/bin/bash
+# Only "docker run" is simulated; everything else succeeds silently
+[ "$1" = "run" ] || exit 0
+
+src=""
+while [ $# -gt 0 ]; do
+    case "$1" in
+        --mount)
+            shift
+            src=$(echo "$1" | tr ',' '\n' | sed -n 's/^src=//p')
+            ;;
+    esac
+    shift
+done
+
+[ -n "$src" ] || { echo "fake docker: no bind mount source" >&2; exit 1; }
+sleep 0.3
+
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+
+# A minimal .npy holding four little-endian float32 values
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, time.time() % 1000)
+
+path = "%s/stream_%d.npz" % (sys.argv[1], int(time.time() * 1000))
+with zipfile.ZipFile(path, "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF
+chmod +x "${WORK_DIR}/bin/docker"
+echo "✅ Docker shim installed"
+
+export DATABASE_PATH="${WORK_DIR}/stream.db"
+export JWT_SECRET="stream-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+
+# Start the API server
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+# start_collector starts the collector with the docker shim first on PATH
+start_collector() {
+    PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+        --station-id stream-station-1 \
+        --api-server-url "${API_URL}" \
+        --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+    COLLECTOR_PID=$!
+    PIDS+=($COLLECTOR_PID)
+
+    wait_collector "${WORK_DIR}/collector.log"
+}
+
+# stream <receiver id> streams until the receiver has enough frames
+stream() {
+    timeout "${E2E_TIMEOUT}s" "${BIN}" receiver \
+        --receiver-id "$1" \
+        --api-server-url "${API_URL}" \
+        --download-dir "${WORK_DIR}/downloads/$1" \
+        --stream --stream-frames "${FRAMES}" > "${WORK_DIR}/receiver.log" 2>&1
+}
+
+# check_frames <receiver id> checks every indexed frame is on disk and matches its capture metadata
+check_frames() {
+    INDEX_FILE=$(ls "${WORK_DIR}"/downloads/$1/*_frames.jsonl 2>/dev/null | head -n 1)
+    [ -n "${INDEX_FILE}" ] || fail "Receiver did not write a frame index"
+    python3 - "${INDEX_FILE}" "${FRAMES}" <<'PY' || fail "Frame index does not match the received frames"
+import hashlib, json, os, sys
+index, frames = sys.argv[1], int(sys.argv[2])
+records = [json.loads(line) for line in open(index)]
+# The collector may have up to two more frames in flight when the stop arrives
+assert frames <= len(records) <= frames + 2, "got %d frames" % len(records)
+assert [r["sequence"] for r in records] == list(range(1, len(records) + 1)), records
+for record in records:
+    data = open(os.path.join(os.path.dirname(index), record["file"]), "rb").read()
+    assert len(data) == record["file_size"], record
+    assert hashlib.sha256(data).hexdigest() == record["capture"]["sha256"], record
+    assert record["capture"]["station_id"] == "stream-station-1", record
+PY
+}
+
+echo -e "\n🔍 Starting collector..."
+start_collector
+echo "✅ Collector connected"
+
+echo -e "\n🔍 Streaming ${FRAMES} frames..."
+stream stream-receiver-1
+RECEIVER_EXIT=$?
+
+[ $RECEIVER_EXIT -eq 0 ] || fail "Receiver exited with status ${RECEIVER_EXIT}"
+echo "✅ Receiver finished"
+
+check_frames stream-receiver-1
+echo "✅ Frames arrived intact and were indexed"
+
+grep -q "ended after [0-9]* frames (stopped)" "${WORK_DIR}/collector.log" || fail "Collector did not end the stream when the receiver stopped it"
+echo "✅ Collector ended the stream when asked"
+
+LEFTOVER=$(find "${WORK_DIR}/data" -type f | wc -l)
+[ "${LEFTOVER}" -eq 0 ] || fail "Collector kept ${LEFTOVER} frame files after sending them"
+echo "✅ Collector removed sent frames"
+
+echo -e "\n🔍 Restarting collector with partially reliable streams..."
+kill "${COLLECTOR_PID}"
+wait "${COLLECTOR_PID}" 2>/dev/null
+export COLLECTOR_STREAM_MAX_PACKET_LIFETIME_MS=500
+start_collector
+echo "✅ Collector connected"
+
+stream stream-receiver-2
+[ $? -ne 0 ] || fail "Receiver accepted a partially reliable stream without RECEIVER_ALLOW_PARTIAL_RELIABILITY"
+grep -q "set RECEIVER_ALLOW_PARTIAL_RELIABILITY to accept it" "${WORK_DIR}/receiver.log" || fail "Receiver did not explain why it rejected the stream"
+echo "✅ Receiver rejected the partially reliable stream by default"
+
+RECEIVER_ALLOW_PARTIAL_RELIABILITY=true stream stream-receiver-3 || fail "Receiver failed to stream over a partially reliable channel"
+grep -q "messages dropped after 500 ms" "${WORK_DIR}/receiver.log" || fail "Receiver did not report the channel's reliability"
+check_frames stream-receiver-3
+echo "✅ Frames arrived intact over a partially reliable channel"
+
+echo -e "\n🎉 Capture streaming test passed!"
@@ -0,0 +1,202 @@
+#!/bin/bash
+
+# Checks that when one subscriber of a request can't be written to, the
+# request's other subscribers are still notified: the failing subscriber's
+# connection is dropped after NOTIFY_MAX_WRITE_FAILURES and its notification
+# stays queued, while the healthy subscriber gets the notification.
+#
+# The failing subscriber's receiver never reads and has a large notification
+# queued for it, so its first write on connecting times out; the request's
+# notification is then its second consecutive failed write.
+#
+# Usage: scripts/test-subscriber-failure.sh
+#   E2E_PORT  Port for the API server (default: 18135)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18135}"
+
+echo "Failing Subscriber Test"
+echo "======================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: give the subscriber time to subscribe, then write an NPZ file
+# into the bind mount
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data"
+cat > "${WORK_DIR}/bin/docker" <<'EOF'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+[ -n "$src" ] || { echo "fake docker: no bind mount source" >&2; exit 1; }
+sleep 2
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/subscriber_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/subscriber.db"
+export JWT_SECRET="subscriber-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+export NOTIFY_WRITE_TIMEOUT_SECONDS=1
+export NOTIFY_WRITE_RETRIES=0
+export NOTIFY_MAX_WRITE_FAILURES=2
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting a collector..."
+PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+    --station-id subscriber-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+# register <email> registers a receiver user and prints its token and ID
+register() {
+    curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\", \"client_type\": 2}" |
+        python3 -c 'import json, sys; r = json.load(sys.stdin); print(r["token"], r["user"]["id"])'
+}
+read -r STALLED_TOKEN STALLED_ID <<< "$(register stalled@example.com)"
+[ -n "${STALLED_ID:-}" ] || fail "Failed to register the failing subscriber"
+read -r HEALTHY_TOKEN HEALTHY_ID <<< "$(register healthy@example.com)"
+[ -n "${HEALTHY_ID:-}" ] || fail "Failed to register the healthy subscriber"
+
+# An 8 MB notification, more than the socket buffers of a receiver that doesn't read hold
+python3 - "${DATABASE_PATH}" "${STALLED_ID}" <<'PY'
+import json, sqlite3, sys
+db = sqlite3.connect(sys.argv[1])
+message = json.dumps({"type": "data_ready", "request_id": "big", "padding": "x" * (8 << 20)})
+db.execute("INSERT INTO pending_notifications (user_id, request_id, message, expires_at) VALUES (?, 'big', ?, datetime('now', '+1 hour'))",
+           (sys.argv[2], message))
+db.commit()
+PY
+
+# receive <token> <mode> connects to /receiver-ws in the background with a
+# small receive buffer, writing to <mode>.out. A "stall" receiver reads
+# nothing; a "read" receiver prints the type and request ID of each message.
+receive() {
+    python3 - "${E2E_PORT}" "$1" "$2" > "${WORK_DIR}/$2.out" 2>&1 <<'PY' &
+import base64, json, os, socket, struct, sys, time
+
+port, token, mode = int(sys.argv[1]), sys.argv[2], sys.argv[3]
+sock = socket.socket()
+sock.setsockopt(socket.SOL_SOCKET, socket.SO_RCVBUF, 4096)
+sock.connect(("localhost", port))
+key = base64.b64encode(os.urandom(16)).decode()
+sock.sendall((
+    "GET /receiver-ws HTTP/1.1\r\n"
+    f"Host: localhost:{port}\r\n"
+    "Upgrade: websocket\r\nConnection: Upgrade\r\n"
+    f"Sec-WebSocket-Key: {key}\r\nSec-WebSocket-Version: 13\r\n"
+    f"Authorization: Bearer {token}\r\n\r\n").encode())
+
+buf = b""
+while b"\r\n\r\n" not in buf:
+    buf += sock.recv(1)
+print(buf.split(b"\r\n")[0].decode(), flush=True)
+buf = b""
+
+if mode == "stall":
+    time.sleep(60)
+    sys.exit(0)
+
+def read(n):
+    global buf
+    while len(buf) < n:
+        chunk = sock.recv(65536)
+        if not chunk:
+            sys.exit(0)
+        buf += chunk
+    data, buf = buf[:n], buf[n:]
+    return data
+
+while True:
+    first, second = read(2)
+    length = second & 0x7F
+    if length == 126:
+        length = struct.unpack(">H", read(2))[0]
+    elif length == 127:
+        length = struct.unpack(">Q", read(8))[0]
+    payload = read(length)
+    if first & 0x0F == 1:
+        message = json.loads(payload)
+        print(message["type"], message.get("request_id", ""), flush=True)
+PY
+    PIDS+=($!)
+}
+
+echo -e "\n🔍 Connecting a subscriber that doesn't read..."
+receive "${STALLED_TOKEN}" stall
+for i in $(seq 1 20); do
+    grep -q "Failed to write to the receiver of user ${STALLED_ID} " "${WORK_DIR}/api.log" && break
+    sleep 0.5
+done
+grep -q "Failed to write to the receiver of user ${STALLED_ID} (attempt 1 of 1, 1 consecutive failures)" "${WORK_DIR}/api.log" ||
+    fail "The queued notification did not fail to write"
+grep -q "Dropping the receiver connection of user ${STALLED_ID} " "${WORK_DIR}/api.log" &&
+    fail "The failing subscriber was dropped before the request was made"
+echo "✅ The subscriber's connection has one failed write"
+
+echo -e "\n🔍 Connecting a subscriber that reads..."
+receive "${HEALTHY_TOKEN}" read
+for i in $(seq 1 20); do
+    grep -q " 101 " "${WORK_DIR}/read.out" 2>/dev/null && break
+    sleep 0.25
+done
+grep -q " 101 " "${WORK_DIR}/read.out" || fail "The healthy subscriber could not connect"
+echo "✅ Healthy subscriber connected"
+
+echo -e "\n🔍 Requesting data with both users subscribed..."
+REQUEST_ID=$(curl -s -X POST "${API_URL}/api/data/request" \
+    -H "Authorization: Bearer ${STALLED_TOKEN}" -H "Content-Type: application/json" \
+    -d '{"request_type": "data_collection", "parameters": "{}"}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["request_id"])') || fail "Request failed"
+STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST "${API_URL}/api/data/subscribe/${REQUEST_ID}" \
+    -H "Authorization: Bearer ${HEALTHY_TOKEN}")
+[ "${STATUS}" = "200" ] || fail "Subscribing the healthy user returned ${STATUS}"
+
+for i in $(seq 1 40); do
+    grep -q "^data_ready ${REQUEST_ID}$" "${WORK_DIR}/read.out" && break
+    sleep 0.25
+done
+grep -q "^data_ready ${REQUEST_ID}$" "${WORK_DIR}/read.out" ||
+    fail "The healthy subscriber was not notified: $(cat "${WORK_DIR}/read.out")"
+grep -q "Sent data ready notification to 1 subscribers for request ${REQUEST_ID}" "${WORK_DIR}/api.log" ||
+    fail "The notification was not counted as sent to the healthy subscriber only"
+echo "✅ The healthy subscriber was notified"
+
+grep -q "Failed to write to the receiver of user ${STALLED_ID} (attempt 1 of 1, 2 consecutive failures)" "${WORK_DIR}/api.log" ||
+    fail "The request's notification was not written to the failing subscriber"
+grep -q "Dropping the receiver connection of user ${STALLED_ID} after 2 consecutive failed writes" "${WORK_DIR}/api.log" ||
+    fail "The failing subscriber was not dropped"
+grep -q "Dropping the receiver connection of user ${HEALTHY_ID} " "${WORK_DIR}/api.log" &&
+    fail "The healthy subscriber was dropped"
+echo "✅ The failing subscriber was dropped"
+
+python3 - "${DATABASE_PATH}" "${STALLED_ID}" "${HEALTHY_ID}" "${REQUEST_ID}" <<'PY' || fail "Queued notifications are not as expected"
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1])
+def undelivered(user):
+    return db.execute("SELECT COUNT(*) FROM pending_notifications WHERE user_id = ? AND request_id = ? AND delivered_at IS NULL",
+                      (user, sys.argv[4])).fetchone()[0]
+assert undelivered(sys.argv[2]) == 1, "failing subscriber"
+assert undelivered(sys.argv[3]) == 0, "healthy subscriber"
+PY
+echo "✅ The failing subscriber's notification stays queued"
+
+echo -e "\n🎉 Failing subscriber test passed!"
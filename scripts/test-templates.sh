@@ -0,0 +1,141 @@
+#!/bin/bash
+
+# Checks request templates: saving, listing and deleting them, that a request
+# with template_id starts from the template's fields with its own fields on
+# top, that templates are private to their user and that a template whose
+# parameters no longer validate is refused when used.
+#
+# Docker is replaced by a shim that records its arguments.
+#
+# Usage: scripts/test-templates.sh
+#   E2E_PORT  Port for the API server (default: 18106)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18106}"
+
+echo "Request Templates Test"
+echo "======================"
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: record the arguments, then write an NPZ file into the bind mount
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data"
+cat > "${WORK_DIR}/bin/docker" <<EOF2
+#!/bin/bash
+[ "\$1" = "run" ] || exit 0
+echo "\$@" >> "${WORK_DIR}/docker-args.log"
+EOF2
+cat >> "${WORK_DIR}/bin/docker" <<'EOF2'
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+with zipfile.ZipFile("%s/template_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/templates.db"
+export JWT_SECRET="templates-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+LOG_LEVEL=debug start_api
+echo "✅ API server healthy"
+
+PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+    --station-id template-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+# register <email> prints a token for a new user
+register() {
+    curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\", \"client_type\": 2}" |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])'
+}
+TOKEN=$(register owner@example.com) || fail "Failed to register the owner"
+OTHER_TOKEN=$(register other@example.com) || fail "Failed to register the other user"
+
+# api <token> <method> <path> [body] prints the HTTP status and saves the body
+api() {
+    curl -s -o "${WORK_DIR}/body" -w "%{http_code}" -X "$2" "${API_URL}$3" \
+        -H "Authorization: Bearer $1" -H "Content-Type: application/json" ${4:+-d "$4"}
+}
+
+# field <expression> evaluates a Python expression on the last body as r
+field() {
+    python3 -c "import json, sys; r = json.load(open(sys.argv[1])); print($1)" "${WORK_DIR}/body"
+}
+
+TEMPLATE='{"name": "fm-band", "request_type": "data_collection", "parameters": "{\"center_freq\": 100000000, \"gain\": 10}", "duration_seconds": 1}'
+
+echo -e "\n🔍 Saving templates..."
+[ "$(api "${TOKEN}" POST /api/data/templates "${TEMPLATE}")" = "201" ] || fail "Saving a template failed: $(cat "${WORK_DIR}/body")"
+TEMPLATE_ID=$(field 'r["id"]')
+echo "✅ Template ${TEMPLATE_ID} saved"
+
+[ "$(api "${TOKEN}" POST /api/data/templates "${TEMPLATE}")" = "409" ] || fail "A duplicate template name was not rejected"
+[ "$(api "${TOKEN}" POST /api/data/templates '{"name": " ", "parameters": "{}"}')" = "400" ] || fail "A template without a name was not rejected"
+[ "$(api "${TOKEN}" POST /api/data/templates '{"name": "loud", "parameters": "{\"gain\": 99}"}')" = "400" ] ||
+    fail "A template with invalid parameters was not rejected"
+[ "$(api "${TOKEN}" POST /api/data/templates '{"name": "odd", "format": "mp3"}')" = "400" ] ||
+    fail "A template with an unsupported format was not rejected"
+echo "✅ Duplicate, unnamed and invalid templates are rejected"
+
+[ "$(api "${TOKEN}" GET /api/data/templates)" = "200" ] || fail "Listing templates failed"
+[ "$(field '[t["name"] for t in r["templates"]]')" = "['fm-band']" ] || fail "Unexpected templates: $(cat "${WORK_DIR}/body")"
+[ "$(api "${OTHER_TOKEN}" GET /api/data/templates)" = "200" ] && [ "$(field 'len(r["templates"])')" = "0" ] ||
+    fail "Another user sees the owner's templates"
+echo "✅ Templates are listed for their owner only"
+
+echo -e "\n🔍 Requesting with the template..."
+[ "$(api "${TOKEN}" POST /api/data/request "{\"template_id\": ${TEMPLATE_ID}, \"parameters\": \"{\\\"gain\\\": 20}\"}")" = "202" ] ||
+    fail "Request with the template failed: $(cat "${WORK_DIR}/body")"
+REQUEST_ID=$(field 'r["request_id"]')
+[ "$(api "${TOKEN}" GET "/api/data/wait/${REQUEST_ID}?timeout=20")" = "200" ] && [ "$(field 'r["status"]')" = "complete" ] ||
+    fail "Request with the template did not complete: $(cat "${WORK_DIR}/body")"
+ARGS=$(cat "${WORK_DIR}/docker-args.log")
+echo "${ARGS}" | grep -q -- "--center-freq 100000000" || fail "Template parameter missing: ${ARGS}"
+echo "${ARGS}" | grep -q -- "--gain 20" || fail "Request parameter did not override the template: ${ARGS}"
+echo "${ARGS}" | grep -q -- "--duration 1" || fail "Template duration missing: ${ARGS}"
+echo "✅ Request used the template with its own parameters on top"
+
+[ "$(api "${OTHER_TOKEN}" POST /api/data/request "{\"template_id\": ${TEMPLATE_ID}}")" = "404" ] ||
+    fail "Another user could use the owner's template"
+[ "$(api "${OTHER_TOKEN}" DELETE "/api/data/templates/${TEMPLATE_ID}")" = "404" ] ||
+    fail "Another user could delete the owner's template"
+echo "✅ Other users can neither use nor delete the template"
+
+echo -e "\n🔍 Using a template that no longer validates..."
+python3 - "${DATABASE_PATH}" "${TEMPLATE_ID}" <<'PY'
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1])
+db.execute("UPDATE request_templates SET parameters = '{\"gain\": 99}' WHERE id = ?", (int(sys.argv[2]),))
+db.commit()
+PY
+[ "$(api "${TOKEN}" POST /api/data/request "{\"template_id\": ${TEMPLATE_ID}}")" = "400" ] ||
+    fail "A template that no longer validates was used: $(cat "${WORK_DIR}/body")"
+field 'r["error"]' | grep -q "no longer valid" || fail "Unexpected error: $(cat "${WORK_DIR}/body")"
+echo "✅ Template that no longer validates is refused"
+
+echo -e "\n🔍 Deleting the template..."
+[ "$(api "${TOKEN}" DELETE "/api/data/templates/${TEMPLATE_ID}")" = "200" ] || fail "Deleting the template failed"
+[ "$(api "${TOKEN}" GET /api/data/templates)" = "200" ] && [ "$(field 'len(r["templates"])')" = "0" ] ||
+    fail "Deleted template is still listed"
+[ "$(api "${TOKEN}" POST /api/data/request "{\"template_id\": ${TEMPLATE_ID}}")" = "404" ] ||
+    fail "Deleted template could still be used"
+echo "✅ Deleted template is gone"
+
+echo -e "\n🎉 Request templates test passed!"
@@ -0,0 +1,144 @@
+#!/bin/bash
+
+# Checks that multi-step database writes happen entirely or not at all: a
+# failure is injected into the last step of each with a SQLite trigger, and
+# none of the earlier steps may be left behind. Once the trigger is dropped,
+# the same operation must succeed.
+#
+# Docker is replaced by a shim that fails, so the collector reports an error
+# for every request.
+#
+# Usage: scripts/test-transactions.sh
+#   E2E_PORT  Port for the API server (default: 18116)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18116}"
+
+echo "Transaction Test"
+echo "================"
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data"
+printf '#!/bin/bash\nexit 1\n' > "${WORK_DIR}/bin/docker"
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/transactions.db"
+export JWT_SECRET="transactions-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+# sql <statement> runs a statement on the server's database and prints the
+# first column of the first row, if any
+sql() {
+    python3 - "${DATABASE_PATH}" "$1" <<'PY'
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1], timeout=10)
+row = db.execute(sys.argv[2]).fetchone()
+db.commit()
+if row is not None:
+    print(row[0])
+PY
+}
+
+# inject <table> makes every insert into the table fail
+inject() {
+    sql "CREATE TRIGGER injected_failure BEFORE INSERT ON $1 BEGIN SELECT RAISE(ABORT, 'injected failure'); END"
+}
+
+heal() {
+    sql "DROP TRIGGER injected_failure"
+}
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "transactions@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+
+# post <path> <body> prints the HTTP status and the body of a POST
+post() {
+    curl -s -w "\n%{http_code}" -X POST "${API_URL}$1" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" -d "$2"
+}
+
+REQUEST='{"request_type": "data_collection", "parameters": "{}"}'
+
+echo -e "\n🔍 Failing the subscription of a new request..."
+inject request_subscribers
+RESULT=$(post /api/data/request "${REQUEST}")
+[ "$(echo "${RESULT}" | tail -n 1)" = "500" ] || fail "Request should fail with 500: ${RESULT}"
+[ "$(sql "SELECT COUNT(*) FROM data_requests")" = "0" ] || fail "The request was stored without its subscription"
+heal
+# No collector is connected yet, so the request is stored and then refused
+RESULT=$(post /api/data/request "${REQUEST}")
+[ "$(echo "${RESULT}" | tail -n 1)" = "503" ] || fail "Request should get past creation: ${RESULT}"
+[ "$(sql "SELECT COUNT(*) FROM data_requests r JOIN request_subscribers s ON s.request_id = r.id")" = "1" ] ||
+    fail "The request was not stored with its subscription"
+echo "✅ A request is stored with its subscription or not at all"
+
+echo -e "\n🔍 Failing the file transfer record of a new ICE session..."
+SESSION='{"parameters": "{\"request_id\": \"r\", \"station_id\": \"tx-station\"}"}'
+inject file_transfers
+RESULT=$(post /api/ice/request "${SESSION}")
+[ "$(echo "${RESULT}" | tail -n 1)" = "500" ] || fail "Session should fail with 500: ${RESULT}"
+[ "$(sql "SELECT COUNT(*) FROM ice_sessions")" = "0" ] || fail "The session was stored without its file transfer"
+heal
+RESULT=$(post /api/ice/request "${SESSION}")
+[ "$(echo "${RESULT}" | tail -n 1)" = "201" ] || fail "Session should be created: ${RESULT}"
+SESSION_ID=$(echo "${RESULT}" | head -n 1 | python3 -c 'import json, sys; print(json.load(sys.stdin)["session_id"])')
+[ "$(sql "SELECT COUNT(*) FROM ice_sessions s JOIN file_transfers f ON f.session_id = s.session_id")" = "1" ] ||
+    fail "The session was not stored with its file transfer"
+echo "✅ An ICE session is stored with its file transfer or not at all"
+
+echo -e "\n🔍 Failing the usage record of a completed transfer..."
+inject transfer_usage
+RESULT=$(post /api/ice/complete "{\"session_id\": \"${SESSION_ID}\", \"bytes\": 1000}")
+[ "$(echo "${RESULT}" | tail -n 1)" = "500" ] || fail "Completion should fail with 500: ${RESULT}"
+[ "$(sql "SELECT status FROM file_transfers WHERE session_id = '${SESSION_ID}'")" != "completed" ] ||
+    fail "The transfer was completed without being counted"
+heal
+RESULT=$(post /api/ice/complete "{\"session_id\": \"${SESSION_ID}\", \"bytes\": 1000}")
+echo "${RESULT}" | head -n 1 | grep -q '"recorded":true' || fail "The transfer should be counted once reported again: ${RESULT}"
+[ "$(sql "SELECT SUM(bytes) FROM transfer_usage")" = "1000" ] || fail "The transfer was not counted"
+echo "✅ A transfer is completed and counted or neither"
+
+echo -e "\n🔍 Failing the status update of a collector response..."
+PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+    --station-id tx-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+
+sql "CREATE TRIGGER injected_failure BEFORE UPDATE OF status ON data_requests WHEN NEW.status = 'failed'
+    BEGIN SELECT RAISE(ABORT, 'injected failure'); END"
+RESULT=$(post /api/data/request "${REQUEST}")
+[ "$(echo "${RESULT}" | tail -n 1)" = "202" ] || fail "Request should be accepted: ${RESULT}"
+REQUEST_ID=$(echo "${RESULT}" | head -n 1 | python3 -c 'import json, sys; print(json.load(sys.stdin)["request_id"])')
+for i in $(seq 1 20); do
+    grep -q "Failed to store error response" "${WORK_DIR}/api.log" && break
+    sleep 0.5
+done
+grep -q "Failed to store error response" "${WORK_DIR}/api.log" || fail "The collector's error was not reported"
+[ "$(sql "SELECT status FROM collector_responses WHERE request_id = '${REQUEST_ID}'")" = "pending" ] ||
+    fail "The response was stored without updating the request's status"
+heal
+
+RESULT=$(post /api/data/request "${REQUEST}")
+REQUEST_ID=$(echo "${RESULT}" | head -n 1 | python3 -c 'import json, sys; print(json.load(sys.stdin)["request_id"])')
+for i in $(seq 1 20); do
+    [ "$(sql "SELECT status FROM data_requests WHERE id = '${REQUEST_ID}'")" = "failed" ] && break
+    sleep 0.5
+done
+[ "$(sql "SELECT status FROM collector_responses WHERE request_id = '${REQUEST_ID}'")" = "error" ] ||
+    fail "The response and the request's status were not stored"
+echo "✅ A collector response is stored with the request's status or not at all"
+
+echo -e "\n🎉 Transaction test passed!"
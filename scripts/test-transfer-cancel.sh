@@ -0,0 +1,142 @@
+#!/bin/bash
+
+# Checks that cancelling a request stops its WebRTC transfer on both sides.
+#
+# The collector sends a large file and the request is cancelled with
+# POST /api/data/cancel/:id as soon as the receiver starts writing it. The
+# server must tell both peers the session is cancelled: the collector stops
+# sending and removes the request's data, and the receiver stops writing and
+# removes what it received of the file.
+#
+# Usage: scripts/test-transfer-cancel.sh
+#   E2E_PORT  Port for the API server (default: 18097)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18097}"
+FILE_MB=300
+
+echo "Transfer Cancellation Test"
+echo "=========================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: write an NPZ file large enough that the transfer takes a while
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data" "${WORK_DIR}/downloads"
+cat > "${WORK_DIR}/bin/docker" <<EOF2
+#!/bin/bash
+[ "\$1" = "run" ] || exit 0
+
+src=""
+while [ \$# -gt 0 ]; do
+    case "\$1" in
+        --mount)
+            shift
+            src=\$(echo "\$1" | tr ',' '\n' | sed -n 's/^src=//p')
+            ;;
+    esac
+    shift
+done
+
+[ -n "\$src" ] || { echo "fake docker: no bind mount source" >&2; exit 1; }
+
+python3 - "\$src" <<'PY'
+import struct, sys, time, zipfile
+
+count = ${FILE_MB} * 1024 * 1024 // 4
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (%d,), }" % count
+header += " " * (63 - len(header) % 64) + "\n"
+
+with zipfile.ZipFile("%s/cancel_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    with zf.open("samples.npy", "w", force_zip64=True) as npy:
+        npy.write(b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode())
+        block = bytes(1024 * 1024)
+        for _ in range(${FILE_MB}):
+            npy.write(block)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+echo "✅ Docker shim installed"
+
+export DATABASE_PATH="${WORK_DIR}/cancel.db"
+export JWT_SECRET="cancel-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting collector..."
+PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+    --station-id cancel-station-1 \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+echo -e "\n🔍 Running receiver..."
+timeout 120s "${BIN}" receiver \
+    --receiver-id cancel-receiver-1 \
+    --api-server-url "${API_URL}" \
+    --download-dir "${WORK_DIR}/downloads" > "${WORK_DIR}/receiver.log" 2>&1 &
+RECEIVER_PID=$!
+
+for i in $(seq 1 1200); do
+    grep -q "Receiving file via ICE" "${WORK_DIR}/receiver.log" && break
+    kill -0 "${RECEIVER_PID}" 2>/dev/null || break
+    sleep 0.05
+done
+grep -q "Receiving file via ICE" "${WORK_DIR}/receiver.log" || fail "Receiver never started receiving the file"
+echo "✅ Transfer started"
+
+# Cancel as the receiver's user, which made the request
+REQUEST_ID=$(sed -n 's/.*Request \([^ ]*\) submitted to .*/\1/p' "${WORK_DIR}/receiver.log" | tail -n 1)
+[ -n "${REQUEST_ID}" ] || fail "Receiver did not log its request ID"
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/login" -H "Content-Type: application/json" \
+    -d '{"email": "receiver@example.com", "password": "password123"}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to log in as the receiver user"
+
+RESPONSE=$(curl -s -w "\n%{http_code}" -X POST "${API_URL}/api/data/cancel/${REQUEST_ID}" -H "Authorization: Bearer ${TOKEN}")
+CANCELLED=$(date +%s)
+[ "$(echo "${RESPONSE}" | tail -n 1)" = "200" ] || fail "Cancel returned: ${RESPONSE}"
+echo "${RESPONSE}" | head -n 1 | python3 -c 'import json, sys; assert json.load(sys.stdin)["cancelled_transfers"] >= 1' ||
+    fail "Cancel did not stop any transfer: ${RESPONSE}"
+echo "✅ Request ${REQUEST_ID} cancelled"
+
+wait "${RECEIVER_PID}"
+RECEIVER_EXIT=$?
+ELAPSED=$(( $(date +%s) - CANCELLED ))
+
+grep -q "ICE file transfer completed" "${WORK_DIR}/receiver.log" && fail "Transfer finished before it was cancelled; raise FILE_MB"
+[ $RECEIVER_EXIT -ne 0 ] || fail "Receiver succeeded even though its transfer was cancelled"
+[ $RECEIVER_EXIT -ne 124 ] || fail "Receiver hung instead of stopping the cancelled transfer"
+grep -q "transfer cancelled" "${WORK_DIR}/receiver.log" || fail "Receiver error does not report the cancellation"
+[ "${ELAPSED}" -le 5 ] || fail "Receiver took ${ELAPSED}s to stop the transfer"
+echo "✅ Receiver stopped after ${ELAPSED}s"
+
+LEFTOVER=$(find "${WORK_DIR}/downloads" -name "*.npz*" | wc -l)
+[ "${LEFTOVER}" -eq 0 ] || fail "Receiver left ${LEFTOVER} partial files behind: $(ls "${WORK_DIR}/downloads")"
+echo "✅ Receiver removed the partial file"
+
+for i in $(seq 1 20); do
+    grep -q "removing data of request ${REQUEST_ID}" "${WORK_DIR}/collector.log" && break
+    sleep 0.5
+done
+grep -q "ICE transfer cancelled after" "${WORK_DIR}/collector.log" || fail "Collector did not stop sending"
+grep -q "removing data of request ${REQUEST_ID}" "${WORK_DIR}/collector.log" || fail "Collector did not clean up the cancelled request"
+[ -z "$(find "${WORK_DIR}/data" -name "*.npz")" ] || fail "Collector kept the cancelled request's file: $(find "${WORK_DIR}/data" -name "*.npz")"
+echo "✅ Collector stopped sending and removed the file ($(grep -o "ICE transfer cancelled after [^ ]*" "${WORK_DIR}/collector.log" | tail -n 1 | cut -d' ' -f5) bytes sent)"
+
+STATUS=$(curl -s "${API_URL}/api/data/status/${REQUEST_ID}" -H "Authorization: Bearer ${TOKEN}" |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["status"])')
+[ "${STATUS}" = "cancelled" ] || fail "Request status is ${STATUS}, not cancelled"
+AGAIN=$(curl -s -o /dev/null -w "%{http_code}" -X POST "${API_URL}/api/data/cancel/${REQUEST_ID}" -H "Authorization: Bearer ${TOKEN}")
+[ "${AGAIN}" = "409" ] || fail "Cancelling twice returned ${AGAIN}, not 409"
+echo "✅ Request stays cancelled"
+
+echo -e "\n🎉 Transfer cancellation test passed!"
@@ -0,0 +1,137 @@
+#!/bin/bash
+
+# Checks that a receiver aborts a WebRTC transfer that stops making progress
+# while the data channel stays open, instead of waiting out the transfer.
+#
+# The collector sends a large file and is frozen with SIGSTOP as soon as the
+# receiver starts writing it, standing in for a collector that hangs mid-send.
+# The receiver must fail with a "transfer stalled" error within
+# RECEIVER_TRANSFER_IDLE_SECONDS, and remove what it received of the file
+# unless KEEP_PARTIAL_DOWNLOADS keeps it as a .partial file.
+#
+# Usage: scripts/test-transfer-stall.sh
+#   E2E_PORT  Port for the API server (default: 18094)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18094}"
+IDLE_TIMEOUT=3
+FILE_MB=300
+
+echo "Transfer Stall Test"
+echo "==================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: write an NPZ file large enough that the transfer takes a while
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data"
+cat > "${WORK_DIR}/bin/docker" <<EOF2
+#!/bin/bash
+[ "\$1" = "run" ] || exit 0
+
+src=""
+while [ \$# -gt 0 ]; do
+    case "\$1" in
+        --mount)
+            shift
+            src=\$(echo "\$1" | tr ',' '\n' | sed -n 's/^src=//p')
+            ;;
+    esac
+    shift
+done
+
+[ -n "\$src" ] || { echo "fake docker: no bind mount source" >&2; exit 1; }
+
+python3 - "\$src" <<'PY'
+import struct, sys, time, zipfile
+
+count = ${FILE_MB} * 1024 * 1024 // 4
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (%d,), }" % count
+header += " " * (63 - len(header) % 64) + "\n"
+
+with zipfile.ZipFile("%s/stall_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    with zf.open("samples.npy", "w", force_zip64=True) as npy:
+        npy.write(b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode())
+        block = bytes(1024 * 1024)
+        for _ in range(${FILE_MB}):
+            npy.write(block)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+echo "✅ Docker shim installed"
+
+export DATABASE_PATH="${WORK_DIR}/stall.db"
+export JWT_SECRET="stall-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+echo -e "\n🔍 Starting collector..."
+PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+    --station-id stall-station-1 \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+COLLECTOR_PID=$!
+PIDS+=($COLLECTOR_PID)
+
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+# stall_receiver NAME KEEP runs a receiver with the given KEEP_PARTIAL_DOWNLOADS,
+# freezes the collector as soon as the file starts arriving and checks that the
+# receiver reports the stall. Only the idle timeout is under test, so the
+# throughput floor and ICE restarts are off.
+stall_receiver() {
+    local name="$1" keep="$2"
+    local log="${WORK_DIR}/${name}.log"
+    local downloads="${WORK_DIR}/${name}-downloads"
+    mkdir -p "${downloads}"
+
+    echo -e "\n🔍 Running receiver with a ${IDLE_TIMEOUT}s idle timeout and KEEP_PARTIAL_DOWNLOADS=${keep}..."
+    KEEP_PARTIAL_DOWNLOADS="${keep}" RECEIVER_TRANSFER_IDLE_SECONDS="${IDLE_TIMEOUT}" RECEIVER_TRANSFER_MIN_THROUGHPUT_KBPS=0 RECEIVER_ICE_RESTARTS=0 timeout 120s "${BIN}" receiver \
+        --receiver-id "stall-${name}-1" \
+        --api-server-url "${API_URL}" \
+        --download-dir "${downloads}" > "${log}" 2>&1 &
+    local receiver_pid=$!
+
+    for i in $(seq 1 1200); do
+        grep -q "Receiving file via ICE" "${log}" && break
+        kill -0 "${receiver_pid}" 2>/dev/null || break
+        sleep 0.05
+    done
+    grep -q "Receiving file via ICE" "${log}" || fail "Receiver never started receiving the file"
+    kill -STOP "${COLLECTOR_PID}"
+    local stopped=$(date +%s)
+    echo "✅ Collector frozen mid-transfer"
+
+    wait "${receiver_pid}"
+    local receiver_exit=$?
+    local elapsed=$(( $(date +%s) - stopped ))
+    kill -CONT "${COLLECTOR_PID}"
+
+    grep -q "ICE file transfer completed" "${log}" && fail "Transfer finished before the collector was frozen; raise FILE_MB"
+    [ $receiver_exit -ne 0 ] || fail "Receiver succeeded even though the transfer stalled"
+    [ $receiver_exit -ne 124 ] || fail "Receiver hung instead of detecting the stall"
+    grep -q "transfer stalled: no data for" "${log}" || fail "Receiver error does not report the stall"
+    [ "${elapsed}" -le $(( IDLE_TIMEOUT + 5 )) ] || fail "Receiver took ${elapsed}s to detect the stall"
+    echo "✅ Receiver reported the stall after ${elapsed}s: $(grep -o "transfer stalled: [^\"]*" "${log}" | tail -n 1)"
+}
+
+stall_receiver receiver false
+LEFTOVER=$(find "${WORK_DIR}/receiver-downloads" -name "*.npz*" | wc -l)
+[ "${LEFTOVER}" -eq 0 ] || fail "Receiver left ${LEFTOVER} partial files behind: $(ls "${WORK_DIR}/receiver-downloads")"
+echo "✅ Partial file removed"
+
+stall_receiver keep-receiver true
+PARTIAL=$(find "${WORK_DIR}/keep-receiver-downloads" -name "*.npz.partial")
+[ -n "${PARTIAL}" ] || fail "Receiver did not keep the partial file: $(ls "${WORK_DIR}/keep-receiver-downloads")"
+[ -z "$(find "${WORK_DIR}/keep-receiver-downloads" -name "*.npz")" ] || fail "Receiver left the partial file under its final name"
+[ -s "${PARTIAL}" ] || fail "Kept partial file is empty"
+echo "✅ Partial file kept as $(basename "${PARTIAL}") ($(stat -c %s "${PARTIAL}") bytes)"
+
+echo -e "\n🎉 Transfer stall test passed!"
@@ -0,0 +1,187 @@
+#!/bin/bash
+
+# Checks that a Type 1 client that stops reading can't stall the connection
+# manager under the block overflow policy, even when blocking waits forever
+# (QUEUE_BLOCK_TIMEOUT_SECONDS=0): while a broadcast waits on the slow
+# client's full send queue, another client can still connect, and once the
+# server gives up on the slow client the broadcast finishes and later ones
+# reach the healthy client.
+#
+# Usage: scripts/test-type1-flood.sh
+#   E2E_PORT  Port for the API server (default: 18131)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18131}"
+
+echo "Type 1 Slow Client Flood Test"
+echo "============================="
+
+source "$(dirname "$0")/lib.sh"
+
+# sql <statement> prints the first column of the first row a query returns
+sql() {
+    python3 - "${DATABASE_PATH}" "$1" <<'PY'
+import sqlite3, sys
+row = sqlite3.connect(sys.argv[1], timeout=10).execute(sys.argv[2]).fetchone()
+if row is not None:
+    print(row[0])
+PY
+}
+
+# register <email> <client type> registers a user and prints its token
+register() {
+    curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\", \"client_type\": $2}" |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])'
+}
+
+# type1_client <name> <token> <mode> registers a Type 1 client and connects it
+# to /ws in the background, writing to <name>.out. A "flood" client sends
+# heartbeats as fast as it can and never reads; a "read" client prints the
+# type of every message it gets.
+type1_client() {
+    curl -sf -X POST "${API_URL}/api/type1/register" -H "Authorization: Bearer $2" -H "Content-Type: application/json" \
+        -d "{\"client_name\": \"$1\", \"capabilities\": \"{}\"}" > /dev/null || fail "Failed to register Type 1 client $1"
+    python3 - "${E2E_PORT}" "$2" "$3" > "${WORK_DIR}/$1.out" 2>&1 <<'PY' &
+import base64, json, os, socket, struct, sys
+
+port, token, mode = int(sys.argv[1]), sys.argv[2], sys.argv[3]
+sock = socket.socket()
+if mode == "flood":
+    sock.setsockopt(socket.SOL_SOCKET, socket.SO_RCVBUF, 4096)
+sock.connect(("localhost", port))
+sock.sendall((
+    "GET /ws HTTP/1.1\r\n"
+    f"Host: localhost:{port}\r\n"
+    "Upgrade: websocket\r\nConnection: Upgrade\r\n"
+    f"Sec-WebSocket-Key: {base64.b64encode(os.urandom(16)).decode()}\r\nSec-WebSocket-Version: 13\r\n"
+    f"Authorization: Bearer {token}\r\n\r\n").encode())
+buf = b""
+while b"\r\n\r\n" not in buf:
+    buf += sock.recv(1)
+print(buf.split(b"\r\n")[0].decode(), flush=True)
+
+if mode == "flood":
+    payload = b'{"type": "heartbeat"}'
+    mask = os.urandom(4)
+    frame = bytes([0x81, 0x80 | len(payload)]) + mask + bytes(b ^ mask[i % 4] for i, b in enumerate(payload))
+    print("flooding", flush=True)
+    try:
+        while True:
+            sock.sendall(frame * 1000)
+    except OSError:
+        print("closed", flush=True)
+    sys.exit(0)
+
+buf = b""
+def read():
+    global buf
+    chunk = sock.recv(65536)
+    if not chunk:
+        print("eof", flush=True)
+        sys.exit(0)
+    buf += chunk
+
+while True:
+    while len(buf) < 2:
+        read()
+    opcode, length = buf[0] & 0x0F, buf[1] & 0x7F
+    offset = 2
+    if length == 126:
+        while len(buf) < 4:
+            read()
+        length, offset = struct.unpack(">H", buf[2:4])[0], 4
+    elif length == 127:
+        while len(buf) < 10:
+            read()
+        length, offset = struct.unpack(">Q", buf[2:10])[0], 10
+    while len(buf) < offset + length:
+        read()
+    payload, buf = buf[offset:offset + length], buf[offset + length:]
+    if opcode == 0x1:
+        print(json.loads(payload)["type"], flush=True)
+    elif opcode == 0x8:
+        print("eof", flush=True)
+        sys.exit(0)
+PY
+    PIDS+=($!)
+}
+
+# ice_request <name> opens an ICE session in the background, which broadcasts
+# it to the Type 1 clients, and writes the response's status code to <name>.code
+ice_request() {
+    curl -s -m 30 -o /dev/null -w "%{http_code}" -X POST "${API_URL}/api/ice/request" \
+        -H "Authorization: Bearer ${RECEIVER_TOKEN}" -H "Content-Type: application/json" \
+        -d '{"parameters": "{}"}' > "${WORK_DIR}/$1.code" &
+    PIDS+=($!)
+}
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/flood.db"
+export JWT_SECRET="flood-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+export TYPE1_SEND_OVERFLOW=block
+export TYPE1_SEND_BUFFER=1
+export QUEUE_BLOCK_TIMEOUT_SECONDS=0
+
+echo -e "\n🔍 Starting API server with blocking, unbounded Type 1 send queues..."
+start_api
+echo "✅ API server healthy"
+
+SLOW_TOKEN=$(register slow@example.com 1) || fail "Failed to register the slow client's user"
+HEALTHY_TOKEN=$(register healthy@example.com 1) || fail "Failed to register the healthy client's user"
+RECEIVER_TOKEN=$(register receiver@example.com 2) || fail "Failed to register the receiver user"
+
+echo -e "\n🔍 Flooding the server from a Type 1 client that never reads..."
+type1_client slow "${SLOW_TOKEN}" flood
+for i in $(seq 1 20); do
+    grep -q "^flooding$" "${WORK_DIR}/slow.out" 2>/dev/null && break
+    sleep 0.25
+done
+grep -q "101" "${WORK_DIR}/slow.out" || fail "The slow client did not connect"
+# Let the socket buffers and the send queue fill up
+sleep 3
+echo "✅ The slow client's send queue is full"
+
+echo -e "\n🔍 Broadcasting an ICE session while the slow client's queue is full..."
+ice_request first
+sleep 0.5
+type1_client healthy "${HEALTHY_TOKEN}" read
+CONNECTED=""
+for i in $(seq 1 12); do
+    [ "$(sql "SELECT COUNT(*) FROM active_connections a JOIN type1_clients c ON c.id = a.client_id WHERE c.client_name = 'healthy'")" = "1" ] &&
+        CONNECTED=1 && break
+    sleep 0.25
+done
+[ -n "${CONNECTED}" ] || fail "A Type 1 client could not connect while a broadcast waited on the slow client"
+[ -s "${WORK_DIR}/first.code" ] && fail "The broadcast did not wait on the slow client, so the flood didn't fill its queue"
+echo "✅ Another client connected while the broadcast waited"
+
+echo -e "\n🔍 Waiting for the server to give up on the slow client..."
+for i in $(seq 1 100); do
+    [ -s "${WORK_DIR}/first.code" ] && break
+    sleep 0.25
+done
+[ "$(cat "${WORK_DIR}/first.code" 2>/dev/null)" = "201" ] || fail "The ICE session request did not finish once the slow client was dropped"
+SLOW_ID=$(sql "SELECT id FROM type1_clients WHERE client_name = 'slow'")
+for i in $(seq 1 20); do
+    grep -q "Type 1 client disconnected: client_id=${SLOW_ID}$" "${WORK_DIR}/api.log" && break
+    sleep 0.25
+done
+grep -q "Type 1 client disconnected: client_id=${SLOW_ID}$" "${WORK_DIR}/api.log" || fail "The slow client was not disconnected"
+echo "✅ The slow client was disconnected and the broadcast finished"
+
+echo -e "\n🔍 Broadcasting to the healthy client..."
+ice_request second
+for i in $(seq 1 20); do
+    grep -q "^ice_session_request$" "${WORK_DIR}/healthy.out" && break
+    sleep 0.25
+done
+grep -q "^ice_session_request$" "${WORK_DIR}/healthy.out" || fail "The healthy client did not get the broadcast"
+echo "✅ The healthy client got the broadcast"
+
+echo -e "\n🎉 Type 1 slow client flood test passed!"
@@ -0,0 +1,111 @@
+#!/bin/bash
+
+# Checks that the API server reconciles the Type 1 connections in the
+# database with the live ones: a stored connection that isn't live and a
+# client marked connected without a connection are cleaned up, and a live
+# connection whose row was deleted is stored again.
+#
+# Usage: scripts/test-type1-reconcile.sh
+#   E2E_PORT  Port for the API server (default: 18117)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18117}"
+
+echo "Type 1 Connection Reconciliation Test"
+echo "====================================="
+
+source "$(dirname "$0")/lib.sh"
+
+# sql <statement> runs a statement on the server's database and prints the
+# first column of the first row, if any
+sql() {
+    python3 - "${DATABASE_PATH}" "$1" <<'PY'
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1], timeout=10)
+row = db.execute(sys.argv[2]).fetchone()
+db.commit()
+if row is not None:
+    print(row[0])
+PY
+}
+
+# wait_for <statement> <expected> waits for a query to return a value
+wait_for() {
+    for i in $(seq 1 20); do
+        [ "$(sql "$1")" = "$2" ] && return 0
+        sleep 0.5
+    done
+    return 1
+}
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/reconcile.db"
+export JWT_SECRET="reconcile-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Checking interval validation..."
+TYPE1_RECONCILE_INTERVAL_SECONDS=-1 timeout 10 "${BIN}" api > "${WORK_DIR}/invalid.log" 2>&1 &&
+    fail "API server started with TYPE1_RECONCILE_INTERVAL_SECONDS=-1"
+grep -q "TYPE1_RECONCILE_INTERVAL_SECONDS" "${WORK_DIR}/invalid.log" || fail "Invalid interval was not reported"
+rm -f "${WORK_DIR}/invalid.log"
+echo "✅ A negative interval is refused"
+
+echo -e "\n🔍 Starting API server on ${API_URL}, reconciling every second..."
+TYPE1_RECONCILE_INTERVAL_SECONDS=1 start_api
+echo "✅ API server healthy"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "type1@example.com", "password": "password123", "client_type": 1}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the user"
+curl -sf -X POST "${API_URL}/api/type1/register" -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+    -d '{"client_name": "reconcile-client", "capabilities": "{}"}' > /dev/null || fail "Failed to register the Type 1 client"
+
+# Hold a /ws connection open with a raw handshake
+python3 - "${E2E_PORT}" "${TOKEN}" > "${WORK_DIR}/ws.out" 2>&1 <<'PY' &
+import base64, os, socket, sys
+
+port, token = int(sys.argv[1]), sys.argv[2]
+sock = socket.create_connection(("localhost", port))
+key = base64.b64encode(os.urandom(16)).decode()
+sock.sendall((
+    "GET /ws HTTP/1.1\r\n"
+    f"Host: localhost:{port}\r\n"
+    "Upgrade: websocket\r\nConnection: Upgrade\r\n"
+    f"Sec-WebSocket-Key: {key}\r\nSec-WebSocket-Version: 13\r\n"
+    f"Authorization: Bearer {token}\r\n\r\n").encode())
+print(sock.recv(4096).split(b"\r\n")[0].decode(), flush=True)
+while sock.recv(4096):
+    pass
+PY
+PIDS+=($!)
+
+wait_for "SELECT COUNT(*) FROM active_connections" 1 || fail "The connection was not stored: $(cat "${WORK_DIR}/ws.out")"
+CLIENT_ID=$(sql "SELECT id FROM type1_clients")
+CONNECTION_ID=$(sql "SELECT connection_id FROM active_connections")
+[ "$(sql "SELECT status FROM type1_clients WHERE id = ${CLIENT_ID}")" = "connected" ] || fail "The client was not marked connected"
+echo "✅ Type 1 client connected"
+
+echo -e "\n🔍 Leaving a stale connection and client behind..."
+sql "INSERT INTO active_connections (client_id, connection_id) VALUES (${CLIENT_ID}, 'stale-connection')"
+sql "INSERT INTO type1_clients (user_id, client_name, status) SELECT user_id, 'crashed-client', 'connected' FROM type1_clients WHERE id = ${CLIENT_ID}"
+wait_for "SELECT COUNT(*) FROM active_connections WHERE connection_id = 'stale-connection'" 0 ||
+    fail "The stale connection was not removed"
+wait_for "SELECT status FROM type1_clients WHERE client_name = 'crashed-client'" disconnected ||
+    fail "The client without a connection was not marked disconnected"
+[ "$(sql "SELECT status FROM type1_clients WHERE id = ${CLIENT_ID}")" = "connected" ] || fail "The live client was marked disconnected"
+echo "✅ The stale connection was removed and its client marked disconnected"
+
+echo -e "\n🔍 Deleting the live connection's row..."
+sql "DELETE FROM active_connections"
+sql "UPDATE type1_clients SET status = 'disconnected' WHERE id = ${CLIENT_ID}"
+wait_for "SELECT connection_id FROM active_connections WHERE client_id = ${CLIENT_ID}" "${CONNECTION_ID}" ||
+    fail "The live connection was not stored again"
+wait_for "SELECT status FROM type1_clients WHERE id = ${CLIENT_ID}" connected || fail "The live client was not marked connected again"
+grep -q "Restoring missing Type 1 connection ${CONNECTION_ID}" "${WORK_DIR}/api.log" || fail "The restore was not logged"
+echo "✅ The live connection was stored again and its client marked connected"
+
+echo -e "\n🎉 Type 1 connection reconciliation test passed!"
@@ -0,0 +1,88 @@
+#!/bin/bash
+
+# Checks that only the collector user a station is bound to may upload files
+# for it: another collector user gets 403 for the station, as does any user
+# for a station that was never bound, while the station's own user can upload
+# for a request sent to it.
+#
+# Usage: scripts/test-upload-ownership.sh
+#   E2E_PORT  Port for the API server (default: 18132)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18132}"
+
+echo "Upload Ownership Test"
+echo "====================="
+
+source "$(dirname "$0")/lib.sh"
+
+# register <email> <client type> registers a user and prints its token
+register() {
+    curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\", \"client_type\": $2}" |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])'
+}
+
+# upload <token> <station ID> uploads a file for the seeded request and prints
+# the response's status code
+upload() {
+    curl -s -o "${WORK_DIR}/upload.out" -w "%{http_code}" -X POST \
+        "${API_URL}/api/collector/upload/ownership-request?station_id=$2" \
+        -H "Authorization: Bearer $1" -H "Content-Type: application/octet-stream" \
+        -H "X-Content-SHA256: ${CHECKSUM}" --data-binary "@${WORK_DIR}/capture.npz"
+}
+
+build
+
+export DATABASE_PATH="${WORK_DIR}/ownership.db"
+export JWT_SECRET="ownership-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export CACHE_DIR="${WORK_DIR}/cache"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+OWNER_TOKEN=$(register owner@example.com 1) || fail "Failed to register the station's user"
+OTHER_TOKEN=$(register other@example.com 1) || fail "Failed to register the other collector user"
+register receiver@example.com 2 > /dev/null || fail "Failed to register the receiver user"
+
+# Bind the stations as their first /collector-ws connection would, and send
+# the request to both
+python3 - "${DATABASE_PATH}" <<'PY' || fail "Failed to seed the stations and request"
+import sqlite3, sys
+db = sqlite3.connect(sys.argv[1], timeout=10)
+owner = db.execute("SELECT id FROM users WHERE email = 'owner@example.com'").fetchone()[0]
+receiver = db.execute("SELECT id FROM users WHERE email = 'receiver@example.com'").fetchone()[0]
+db.execute("INSERT INTO stations (station_id, user_id) VALUES ('owned-station', ?)", (owner,))
+db.execute("INSERT INTO data_requests (id, request_type, requested_by, status) VALUES ('ownership-request', 'iq', ?, 'pending')", (receiver,))
+for station in ("owned-station", "unbound-station"):
+    db.execute("INSERT INTO collector_responses (request_id, station_id, status) VALUES ('ownership-request', ?, 'processing')", (station,))
+db.commit()
+PY
+
+head -c 4096 /dev/urandom > "${WORK_DIR}/capture.npz"
+CHECKSUM=$(sha256sum "${WORK_DIR}/capture.npz" | cut -d' ' -f1)
+
+echo -e "\n🔍 Uploading for another user's station..."
+STATUS=$(upload "${OTHER_TOKEN}" owned-station)
+[ "${STATUS}" = "403" ] || fail "Upload for another user's station got ${STATUS}, not 403: $(cat "${WORK_DIR}/upload.out")"
+grep -q "isn't bound to them" "${WORK_DIR}/api.log" || fail "The rejected upload was not logged"
+echo "✅ Rejected with 403"
+
+echo -e "\n🔍 Uploading for a station that was never bound..."
+STATUS=$(upload "${OWNER_TOKEN}" unbound-station)
+[ "${STATUS}" = "403" ] || fail "Upload for an unbound station got ${STATUS}, not 403: $(cat "${WORK_DIR}/upload.out")"
+echo "✅ Rejected with 403"
+
+[ -z "$(find "${CACHE_DIR}" -type f 2>/dev/null)" ] || fail "A rejected upload was cached"
+
+echo -e "\n🔍 Uploading for the user's own station..."
+STATUS=$(upload "${OWNER_TOKEN}" owned-station)
+[ "${STATUS}" = "201" ] || fail "Upload for the user's own station got ${STATUS}, not 201: $(cat "${WORK_DIR}/upload.out")"
+echo "✅ Accepted with 201"
+
+echo -e "\n🎉 Upload ownership test passed!"
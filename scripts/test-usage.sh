@@ -0,0 +1,144 @@
+#!/bin/bash
+
+# Checks that files received over WebRTC and downloaded from the server cache
+# are counted in the receiver user's usage, by day, station and transfer,
+# that reporting a session again doesn't count it twice, and that admins
+# can see the usage of every user.
+#
+# The API server runs twice on the same database: first with
+# FANOUT_MODE=never, so the receiver gets its file over WebRTC, then with
+# FANOUT_MODE=always, so it downloads it from the server cache.
+#
+# Usage: scripts/test-usage.sh
+#   E2E_PORT  Port for the API server (default: 18113)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18113}"
+
+echo "Usage Accounting Test"
+echo "====================="
+
+source "$(dirname "$0")/lib.sh"
+
+build
+
+# Fake docker: write an NPZ file into the bind mount
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data" "${WORK_DIR}/downloads"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (256,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<256f", *range(256))
+with zipfile.ZipFile("%s/usage_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/usage.db"
+export JWT_SECRET="usage-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+"${BIN}" admin create-user --email admin@example.com --password password123 --admin \
+    > "${WORK_DIR}/create-user.log" 2>&1 || fail "admin create-user failed: $(cat "${WORK_DIR}/create-user.log")"
+
+# start_servers <fan-out mode> starts the API server and a collector
+start_servers() {
+    FANOUT_MODE="$1" start_api "api-$1"
+
+    PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+        --station-id usage-station \
+        --api-server-url "${API_URL}" \
+        --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector-$1.log" 2>&1 &
+    COLLECTOR_PID=$!
+    PIDS+=(${COLLECTOR_PID})
+    wait_collector "${WORK_DIR}/collector-$1.log"
+}
+
+# stop_servers stops the API server and the collector
+stop_servers() {
+    kill "${COLLECTOR_PID}" 2>/dev/null
+    wait "${COLLECTOR_PID}" 2>/dev/null
+    stop_api
+}
+
+# run_receiver <name> runs the receiver and prints the size of the file it got
+run_receiver() {
+    timeout 120s "${BIN}" receiver \
+        --receiver-id "usage-$1" \
+        --api-server-url "${API_URL}" \
+        --download-dir "${WORK_DIR}/downloads" > "${WORK_DIR}/receiver-$1.log" 2>&1 || fail "Receiver $1 failed"
+    local request_id
+    request_id=$(sed -n 's/.*Request \([^ ]*\) submitted to .*/\1/p' "${WORK_DIR}/receiver-$1.log" | tail -n 1)
+    stat -c %s "${WORK_DIR}/downloads/${request_id}_usage-station_data.npz"
+}
+
+# token <email> logs in and prints the token
+token() {
+    curl -s -X POST "${API_URL}/api/auth/login" -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\"}" |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])'
+}
+
+# check <JSON> <python expression on u> <message>
+check() {
+    echo "$1" | python3 -c "import json, sys; u = json.load(sys.stdin); sys.exit(0 if ($2) else 1)" ||
+        fail "$3: $1"
+}
+
+echo -e "\n🔍 Receiving a file over WebRTC..."
+start_servers never
+WEBRTC_SIZE=$(run_receiver webrtc) || exit 1
+grep -q "received ${WEBRTC_SIZE} bytes from station usage-station" "${WORK_DIR}/api-never.log" ||
+    fail "Receiver did not report the completed session"
+SESSION_ID=$(sed -n 's/.*ICE session initiated: \(.*\)/\1/p' "${WORK_DIR}/receiver-webrtc.log" | tail -n 1)
+TOKEN=$(token receiver@example.com) || fail "Failed to log in as the receiver user"
+USAGE=$(curl -s "${API_URL}/api/data/usage" -H "Authorization: Bearer ${TOKEN}")
+check "${USAGE}" "u['bytes'] == ${WEBRTC_SIZE} and u['files'] == 1 and u['days'] == 30" "WebRTC file not counted"
+check "${USAGE}" "u['by_transfer'] == [{'transfer': 'webrtc', 'bytes': ${WEBRTC_SIZE}, 'files': 1}]" "Usage by transfer is wrong"
+echo "✅ ${WEBRTC_SIZE} bytes received over WebRTC are counted"
+
+RESULT=$(curl -s -X POST "${API_URL}/api/ice/complete" -H "Authorization: Bearer ${TOKEN}" \
+    -H "Content-Type: application/json" -d "{\"session_id\": \"${SESSION_ID}\", \"bytes\": 1000}")
+check "${RESULT}" "u['recorded'] == False" "Reporting a session again was recorded"
+check "$(curl -s "${API_URL}/api/data/usage" -H "Authorization: Bearer ${TOKEN}")" "u['files'] == 1" "A session was counted twice"
+ADMIN_TOKEN=$(token admin@example.com) || fail "Failed to log in as the admin"
+STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST "${API_URL}/api/ice/complete" -H "Authorization: Bearer ${ADMIN_TOKEN}" \
+    -H "Content-Type: application/json" -d "{\"session_id\": \"${SESSION_ID}\", \"bytes\": 1000}")
+[ "${STATUS}" = "404" ] || fail "Another user completed the session: ${STATUS}"
+echo "✅ A session is only counted once, and only for the user who opened it"
+stop_servers
+
+echo -e "\n🔍 Downloading a file from the server cache..."
+start_servers always
+HTTP_SIZE=$(run_receiver http) || exit 1
+USAGE=$(curl -s "${API_URL}/api/data/usage?days=1" -H "Authorization: Bearer ${TOKEN}")
+check "${USAGE}" "u['bytes'] == ${WEBRTC_SIZE} + ${HTTP_SIZE} and u['files'] == 2" "Cached download not counted"
+check "${USAGE}" "u['by_transfer'] == [{'transfer': 'http', 'bytes': ${HTTP_SIZE}, 'files': 1}, {'transfer': 'webrtc', 'bytes': ${WEBRTC_SIZE}, 'files': 1}]" \
+    "Usage by transfer is wrong"
+check "${USAGE}" "u['by_station'] == [{'station_id': 'usage-station', 'bytes': ${WEBRTC_SIZE} + ${HTTP_SIZE}, 'files': 2}] and len(u['by_day']) == 1 and u['from'] == u['to']" \
+    "Usage by station or day is wrong"
+echo "✅ ${HTTP_SIZE} bytes downloaded from the cache are counted"
+
+echo -e "\n🔍 Checking the admin report..."
+USAGE=$(curl -s "${API_URL}/api/admin/usage" -H "Authorization: Bearer ${ADMIN_TOKEN}")
+check "${USAGE}" "[(r['email'], r['files']) for r in u['by_user']] == [('receiver@example.com', 2)]" "Admin report by user is wrong"
+RECEIVER_ID=$(echo "${USAGE}" | python3 -c 'import json, sys; print(json.load(sys.stdin)["by_user"][0]["user_id"])')
+check "$(curl -s "${API_URL}/api/admin/usage?user_id=$((RECEIVER_ID + 100))" -H "Authorization: Bearer ${ADMIN_TOKEN}")" \
+    "u['files'] == 0 and u['by_user'] == []" "Admin report for another user is not empty"
+STATUS=$(curl -s -o /dev/null -w "%{http_code}" "${API_URL}/api/admin/usage" -H "Authorization: Bearer ${TOKEN}")
+[ "${STATUS}" = "403" ] || fail "Non-admin got the admin report: ${STATUS}"
+for days in 0 367 x; do
+    STATUS=$(curl -s -o /dev/null -w "%{http_code}" "${API_URL}/api/data/usage?days=${days}" -H "Authorization: Bearer ${TOKEN}")
+    [ "${STATUS}" = "400" ] || fail "days=${days} returned ${STATUS}"
+done
+echo "✅ Admins see every user's usage, other users get 403 and invalid periods 400"
+
+echo -e "\n🎉 Usage accounting test passed!"
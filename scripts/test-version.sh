@@ -0,0 +1,65 @@
+#!/bin/bash
+
+# Checks that the version, commit and build time set with -ldflags -X are
+# what --version, /api/version, /health and the startup log report, exactly
+# as given, and that a build without them reports the commit Go embeds.
+#
+# Usage: scripts/test-version.sh
+#   E2E_PORT  Port for the API server (default: 18137)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18137}"
+VERSION=v1.2.3-test
+COMMIT=abc1234
+BUILD_TIME=2026-01-02T03:04:05Z
+
+echo "Build Version Test"
+echo "=================="
+
+source "$(dirname "$0")/lib.sh"
+
+echo -e "\n🔍 Building without ldflags..."
+build
+HEAD_COMMIT=$(git rev-parse HEAD | cut -c1-12)
+OUTPUT=$("${BIN}" --version) || fail "--version failed: ${OUTPUT}"
+echo "${OUTPUT}" | grep -q "^argus-sdr .*(commit ${HEAD_COMMIT}\(-dirty\)\?, built " ||
+    fail "--version does not report the commit Go embedded: ${OUTPUT}"
+echo "✅ ${OUTPUT}"
+
+echo -e "\n🔍 Building with ldflags..."
+go build -o "${BIN}" -ldflags "-X argus-sdr/pkg/version.Version=${VERSION} \
+    -X argus-sdr/pkg/version.Commit=${COMMIT} \
+    -X argus-sdr/pkg/version.BuildTime=${BUILD_TIME}" . || fail "Build failed"
+OUTPUT=$("${BIN}" --version) || fail "--version failed: ${OUTPUT}"
+[ "${OUTPUT}" = "argus-sdr ${VERSION} (commit ${COMMIT}, built ${BUILD_TIME})" ] ||
+    fail "--version does not report the ldflags values: ${OUTPUT}"
+echo "✅ ${OUTPUT}"
+
+export DATABASE_PATH="${WORK_DIR}/version.db"
+export JWT_SECRET="version-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+# check <path> checks that the JSON at path reports the ldflags values
+check() {
+    curl -s "${API_URL}$1" | python3 -c '
+import json, sys
+r = json.load(sys.stdin)
+got = (r.get("version"), r.get("commit"), r.get("build_time"))
+assert got == tuple(sys.argv[1:]), got
+' "${VERSION}" "${COMMIT}" "${BUILD_TIME}" || fail "$1 does not report the ldflags values"
+}
+check /api/version
+check /health
+echo "✅ /api/version and /health report them"
+
+grep -q "Argus SDR API server ${VERSION} (commit ${COMMIT}, built ${BUILD_TIME})" "${WORK_DIR}/api.log" ||
+    fail "The startup log does not report them"
+echo "✅ The startup log reports them"
+
+echo -e "\n🎉 Build version test passed!"
@@ -0,0 +1,165 @@
+#!/bin/bash
+
+# Checks request webhooks: callback URLs pointing at internal addresses are
+# rejected, and when a collector finishes a request the server POSTs a
+# data_ready payload signed with the requester's webhook secret, retrying
+# after a failed delivery.
+#
+# Docker is replaced by the same shim as scripts/test-e2e.sh.
+#
+# Usage: scripts/test-webhook.sh
+#   E2E_PORT   Port for the API server (default: 18085)
+#   HOOK_PORT  Port for the webhook receiver (default: 18086)
+#   E2E_KEEP   Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18085}"
+HOOK_PORT="${HOOK_PORT:-18086}"
+
+echo "Webhook Test"
+echo "============"
+
+source "$(dirname "$0")/lib.sh"
+
+# request_status CALLBACK_URL prints the HTTP status of a data request with that callback
+request_status() {
+    curl -s -o "${WORK_DIR}/request.json" -w "%{http_code}" -X POST "${API_URL}/api/data/request" \
+        -H "Authorization: Bearer ${TOKEN}" -H "Content-Type: application/json" \
+        -d "{\"request_type\": \"data_collection\", \"parameters\": \"{}\", \"callback_url\": \"$1\"}"
+}
+
+build
+
+# Fake docker: find the bind mount source and write an NPZ file into it
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data" "${WORK_DIR}/hooks"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+
+src=""
+while [ $# -gt 0 ]; do
+    case "$1" in
+        --mount)
+            shift
+            src=$(echo "$1" | tr ',' '\n' | sed -n 's/^src=//p')
+            ;;
+    esac
+    shift
+done
+
+[ -n "$src" ] || { echo "fake docker: no bind mount source" >&2; exit 1; }
+
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<4f", 1, 2, 3, 4)
+
+with zipfile.ZipFile("%s/webhook_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/webhook.db"
+export JWT_SECRET="webhook-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+export WEBHOOK_MAX_ATTEMPTS=3
+
+echo -e "\n🔍 Starting API server with default webhook settings..."
+start_api
+echo "✅ API server healthy"
+
+TOKEN=$(curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+    -d '{"email": "webhook@example.com", "password": "password123", "client_type": 2}' |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])') || fail "Failed to register the receiver user"
+
+for url in "http://127.0.0.1:${HOOK_PORT}/hook" "http://169.254.169.254/latest/meta-data" "http://10.0.0.1/hook" "ftp://example.com/hook"; do
+    status=$(request_status "${url}")
+    [ "${status}" = "400" ] || fail "Callback ${url} returned ${status}, expected 400"
+done
+echo "✅ Internal and non-HTTP callback URLs rejected with 400"
+
+stop_api
+
+echo -e "\n🔍 Restarting API server with WEBHOOK_ALLOW_PRIVATE_ADDRESSES=true..."
+export WEBHOOK_ALLOW_PRIVATE_ADDRESSES=true
+start_api
+echo "✅ API server healthy"
+
+# Webhook receiver: fails the first delivery with 503, then records each body and signature
+python3 - "${HOOK_PORT}" "${WORK_DIR}/hooks" > "${WORK_DIR}/hooks.log" 2>&1 <<'PY' &
+import http.server, os, sys
+
+port, out = int(sys.argv[1]), sys.argv[2]
+attempts = 0
+
+class Hook(http.server.BaseHTTPRequestHandler):
+    def do_POST(self):
+        global attempts
+        attempts += 1
+        body = self.rfile.read(int(self.headers["Content-Length"]))
+        if attempts == 1:
+            self.send_response(503)
+            self.send_header("Retry-After", "1")
+            self.end_headers()
+            return
+        with open(os.path.join(out, "%d.json" % attempts), "wb") as f:
+            f.write(body)
+        with open(os.path.join(out, "%d.sig" % attempts), "w") as f:
+            f.write(self.headers.get("X-Argus-Signature", ""))
+        self.send_response(204)
+        self.end_headers()
+
+http.server.HTTPServer(("127.0.0.1", port), Hook).serve_forever()
+PY
+PIDS+=($!)
+
+PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+    --station-id webhook-station-1 \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+echo "✅ Collector connected"
+
+SECRET=$(curl -s "${API_URL}/api/auth/webhook-secret" -H "Authorization: Bearer ${TOKEN}" |
+    python3 -c 'import json, sys; print(json.load(sys.stdin)["webhook_secret"])') || fail "Failed to get the webhook secret"
+[ -n "${SECRET}" ] || fail "Empty webhook secret"
+echo "✅ Webhook secret issued"
+
+status=$(request_status "http://127.0.0.1:${HOOK_PORT}/hook")
+[ "${status}" = "202" ] || fail "Data request returned ${status}, expected 202"
+REQUEST_ID=$(python3 -c 'import json, sys; print(json.load(open(sys.argv[1]))["request_id"])' "${WORK_DIR}/request.json")
+echo "✅ Request ${REQUEST_ID} accepted with a callback URL"
+
+for i in $(seq 1 60); do
+    ls "${WORK_DIR}"/hooks/*.json > /dev/null 2>&1 && break
+    sleep 0.5
+done
+HOOK=$(ls "${WORK_DIR}"/hooks/*.json 2>/dev/null | head -n 1)
+[ -n "${HOOK}" ] || fail "No webhook was delivered"
+[ "$(basename "${HOOK}")" = "2.json" ] || fail "Expected delivery on the second attempt, got $(basename "${HOOK}")"
+echo "✅ Webhook delivered after a retry"
+
+python3 - "${HOOK}" "${HOOK%.json}.sig" "${SECRET}" "${REQUEST_ID}" <<'PY' || fail "Webhook payload or signature is wrong"
+import hashlib, hmac, json, sys
+
+body = open(sys.argv[1], "rb").read()
+signature = open(sys.argv[2]).read()
+expected = "sha256=" + hmac.new(sys.argv[3].encode(), body, hashlib.sha256).hexdigest()
+if not hmac.compare_digest(signature, expected):
+    sys.exit("signature %r does not match %r" % (signature, expected))
+
+payload = json.loads(body)
+if payload.get("type") != "data_ready" or payload.get("request_id") != sys.argv[4]:
+    sys.exit("unexpected payload %r" % payload)
+if payload.get("station_id") != "webhook-station-1":
+    sys.exit("unexpected station in %r" % payload)
+PY
+echo "✅ data_ready payload is signed with the webhook secret"
+
+echo -e "\n🎉 Webhook test completed successfully!"
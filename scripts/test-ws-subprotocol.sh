@@ -0,0 +1,139 @@
+#!/bin/bash
+
+# Checks WebSocket subprotocol negotiation on /collector-ws and /receiver-ws:
+# upgrades offering argus.v1 get it, upgrades offering none still connect,
+# and upgrades offering only unsupported subprotocols are refused with 400
+# before the upgrade. It then runs a collector and a receiver and checks that
+# both negotiate argus.v1 and that the server logs it.
+#
+# Usage: scripts/test-ws-subprotocol.sh
+#   E2E_PORT  Port for the API server (default: 18122)
+#   E2E_KEEP  Set to keep the temporary directory for inspection
+
+set -u
+
+E2E_PORT="${E2E_PORT:-18122}"
+
+echo "WebSocket Subprotocol Test"
+echo "=========================="
+
+source "$(dirname "$0")/lib.sh"
+
+# register <email> <client type> registers a user and prints the token
+register() {
+    curl -s -X POST "${API_URL}/api/auth/register" -H "Content-Type: application/json" \
+        -d "{\"email\": \"$1\", \"password\": \"password123\", \"client_type\": $2}" |
+        python3 -c 'import json, sys; print(json.load(sys.stdin)["token"])'
+}
+
+# handshake <path> <token> [subprotocols] sends a WebSocket upgrade offering
+# the comma-separated subprotocols, if any, and prints the status code, the
+# subprotocol the server chose ("-" for none) and the error of a refusal
+handshake() {
+    python3 - "${E2E_PORT}" "$1" "$2" "${3:-}" <<'PY'
+import base64, json, os, socket, sys
+
+port, path, token, protocols = int(sys.argv[1]), sys.argv[2], sys.argv[3], sys.argv[4]
+sock = socket.create_connection(("localhost", port))
+request = (
+    f"GET {path} HTTP/1.1\r\nHost: localhost:{port}\r\n"
+    "Upgrade: websocket\r\nConnection: Upgrade\r\n"
+    f"Sec-WebSocket-Key: {base64.b64encode(os.urandom(16)).decode()}\r\nSec-WebSocket-Version: 13\r\n"
+    f"Authorization: Bearer {token}\r\n")
+if protocols:
+    request += f"Sec-WebSocket-Protocol: {protocols}\r\n"
+sock.sendall((request + "\r\n").encode())
+
+buf = b""
+while b"\r\n\r\n" not in buf:
+    chunk = sock.recv(4096)
+    if not chunk:
+        break
+    buf += chunk
+head, _, body = buf.partition(b"\r\n\r\n")
+lines = head.decode().split("\r\n")
+status = lines[0].split(" ")[1]
+headers = {k.strip().lower(): v.strip() for k, _, v in (line.partition(":") for line in lines[1:])}
+error = ""
+if status != "101":
+    length = int(headers.get("content-length", "0"))
+    while len(body) < length:
+        body += sock.recv(4096)
+    error = json.loads(body).get("error", "")
+print(status, headers.get("sec-websocket-protocol", "-"), error)
+PY
+}
+
+build
+
+# Fake docker: write an NPZ file into the bind mount
+mkdir -p "${WORK_DIR}/bin" "${WORK_DIR}/data" "${WORK_DIR}/downloads"
+cat > "${WORK_DIR}/bin/docker" <<'EOF2'
+#!/bin/bash
+[ "$1" = "run" ] || exit 0
+src=$(echo "$@" | tr ' ,' '\n\n' | sed -n 's/^src=//p' | head -n 1)
+python3 - "$src" <<'PY'
+import struct, sys, time, zipfile
+header = "{'descr': '<f4', 'fortran_order': False, 'shape': (256,), }"
+header += " " * (63 - len(header) % 64) + "\n"
+npy = b"\x93NUMPY\x01\x00" + struct.pack("<H", len(header)) + header.encode() + struct.pack("<256f", *range(256))
+with zipfile.ZipFile("%s/subprotocol_%d.npz" % (sys.argv[1], int(time.time() * 1000)), "w") as zf:
+    zf.writestr("samples.npy", npy)
+PY
+EOF2
+chmod +x "${WORK_DIR}/bin/docker"
+
+export DATABASE_PATH="${WORK_DIR}/subprotocol.db"
+export JWT_SECRET="subprotocol-test-secret"
+export SERVER_ADDRESS=":${E2E_PORT}"
+export BCRYPT_COST=4
+
+echo -e "\n🔍 Starting API server on ${API_URL}..."
+start_api
+echo "✅ API server healthy"
+
+RECEIVER_TOKEN=$(register subprotocol-receiver@example.com 2) || fail "Failed to register the receiver user"
+COLLECTOR_TOKEN=$(register subprotocol-collector@example.com 1) || fail "Failed to register the collector user"
+
+echo -e "\n🔍 Negotiating subprotocols with raw upgrades..."
+for path in /receiver-ws /collector-ws; do
+    if [ "${path}" = "/receiver-ws" ]; then TOKEN="${RECEIVER_TOKEN}"; else TOKEN="${COLLECTOR_TOKEN}"; fi
+
+    RESULT=$(handshake "${path}" "${TOKEN}" "argus.v1")
+    [ "${RESULT}" = "101 argus.v1 " ] || fail "${path} with argus.v1 answered: ${RESULT}"
+    RESULT=$(handshake "${path}" "${TOKEN}" "argus.v9, argus.v1")
+    [ "${RESULT}" = "101 argus.v1 " ] || fail "${path} did not pick argus.v1 out of two: ${RESULT}"
+    RESULT=$(handshake "${path}" "${TOKEN}")
+    [ "${RESULT}" = "101 - " ] || fail "${path} without a subprotocol answered: ${RESULT}"
+    RESULT=$(handshake "${path}" "${TOKEN}" "argus.v9, chat")
+    [ "${RESULT}" = "400 - Unsupported WebSocket subprotocol: argus.v9, chat" ] ||
+        fail "${path} with unsupported subprotocols answered: ${RESULT}"
+done
+grep -q "Rejecting receiver connection for user .*: unsupported WebSocket subprotocols \[argus.v9 chat\]" "${WORK_DIR}/api.log" ||
+    fail "The refused receiver connection was not logged"
+grep -q "Rejecting collector connection from .*: unsupported WebSocket subprotocols \[argus.v9 chat\]" "${WORK_DIR}/api.log" ||
+    fail "The refused collector connection was not logged"
+echo "✅ argus.v1 is negotiated, no subprotocol is still accepted and unsupported ones get 400"
+
+echo -e "\n🔍 Connecting a collector and a receiver..."
+PATH="${WORK_DIR}/bin:${PATH}" "${BIN}" collector \
+    --station-id subprotocol-station \
+    --api-server-url "${API_URL}" \
+    --data-dir "${WORK_DIR}/data" > "${WORK_DIR}/collector.log" 2>&1 &
+PIDS+=($!)
+wait_collector "${WORK_DIR}/collector.log"
+grep -q "WebSocket connected (subprotocol argus.v1)" "${WORK_DIR}/collector.log" || fail "The collector did not negotiate argus.v1"
+grep -q "Station connected: subprotocol-station (subprotocol argus.v1)" "${WORK_DIR}/api.log" ||
+    fail "The server did not log the collector's subprotocol"
+
+timeout 120s "${BIN}" receiver \
+    --receiver-id subprotocol-receiver \
+    --api-server-url "${API_URL}" \
+    --download-dir "${WORK_DIR}/downloads" > "${WORK_DIR}/receiver.log" 2>&1 || fail "Receiver failed"
+grep -q "WebSocket connected (subprotocol argus.v1)" "${WORK_DIR}/receiver.log" || fail "The receiver did not negotiate argus.v1"
+grep -q "Receiver WebSocket connected: [0-9]* (subprotocol argus.v1)" "${WORK_DIR}/api.log" ||
+    fail "The server did not log the receiver's subprotocol"
+ls "${WORK_DIR}/downloads"/*_subprotocol-station_data.npz > /dev/null 2>&1 || fail "The receiver got no file"
+echo "✅ The collector and the receiver negotiate argus.v1 and the receiver gets its file"
+
+echo -e "\n🎉 WebSocket subprotocol test passed!"